@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// stackPorts are the ports the services listen on and reach each other at
+type stackPorts struct {
+	Authority int
+	Bank      int
+	Register  int
+	Webhook   int
+}
+
+// Authority key files, relative to the authority's working directory
+const (
+	authorityPrivateKey = "keys/private_key.pem"
+	authorityPublicKey  = "keys/public_key.pem"
+)
+
+// writeConfig copies a service's config.yaml into its working directory with the
+// stack's ports and URLs filled in. Everything else, comments included, stays as in the
+// service's own config, so the generated file documents itself. With ephemeralKeys the
+// authority signs with an in-memory key, so the bank and register fetch it from /public-key
+// instead of pinning a key file.
+func writeConfig(svc service, srcDir, svcDir string, ports stackPorts, selected map[string]bool, ephemeralKeys bool) error {
+	data, err := os.ReadFile(filepath.Join(srcDir, "config.yaml"))
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing %s/config.yaml: %w", srcDir, err)
+	}
+
+	authorityURL := fmt.Sprintf("http://127.0.0.1:%d", ports.Authority)
+	authorityKey := filepath.Join(filepath.Dir(svcDir), serviceAuthority, authorityPublicKey)
+	pinKey := selected[serviceAuthority] && !ephemeralKeys
+
+	var values map[string]string
+	switch svc.name {
+	case serviceAuthority:
+		values = map[string]string{
+			"server.port":           strconv.Itoa(ports.Authority),
+			"keys.private_key_path": authorityPrivateKey,
+			"keys.public_key_path":  authorityPublicKey,
+			"keys.ephemeral":        strconv.FormatBool(ephemeralKeys),
+		}
+	case serviceBank:
+		values = map[string]string{
+			"server.port":                    strconv.Itoa(ports.Bank),
+			"wallet.authority_url":           authorityURL,
+			"strict_mode.authority_url":      authorityURL,
+			"strict_mode.authority_key_file": "",
+		}
+		if pinKey {
+			values["strict_mode.authority_key_file"] = authorityKey
+		}
+	case serviceRegister:
+		values = map[string]string{
+			"server.port":           strconv.Itoa(ports.Register),
+			"server.webhook_host":   "127.0.0.1",
+			"server.webhook_port":   strconv.Itoa(ports.Webhook),
+			"revenue_authority.url": authorityURL,
+			"receipt_bank.url":      fmt.Sprintf("http://127.0.0.1:%d", ports.Bank),
+			// Without either real service the register runs against its mocks
+			"standalone_mode": strconv.FormatBool(!selected[serviceAuthority] && !selected[serviceBank]),
+		}
+		if pinKey {
+			values["revenue_authority.response_key_file"] = authorityKey
+		}
+		// The UI is served from ./web
+		if err := linkDir(filepath.Join(srcDir, "web"), filepath.Join(svcDir, "web")); err != nil {
+			return err
+		}
+	}
+
+	for path, value := range values {
+		if err := setValue(&doc, path, value); err != nil {
+			return fmt.Errorf("%s/config.yaml: %w", srcDir, err)
+		}
+	}
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(svcDir, "config.yaml"), out.Bytes(), 0644)
+}
+
+// setValue replaces the scalar at a dotted path like "server.port", keeping its comment
+func setValue(doc *yaml.Node, path string, value string) error {
+	node := doc
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	parts := strings.Split(path, ".")
+	for depth, part := range parts {
+		key := strings.Join(parts[:depth+1], ".")
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s is not a mapping", strings.Join(parts[:depth], "."))
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == part {
+				next = node.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			return fmt.Errorf("%s not found", key)
+		}
+		node = next
+	}
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("%s is not a single value", path)
+	}
+
+	// Keep numbers and booleans untagged so they don't turn into quoted strings
+	node.Value = value
+	node.Tag = ""
+	node.Style = 0
+	if _, err := strconv.Atoi(value); err != nil && value != "true" && value != "false" {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+	return nil
+}
+
+// linkDir points dst at src, replacing a link from an earlier run
+func linkDir(src, dst string) error {
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Lstat(dst); err == nil {
+		if info.Mode()&os.ModeSymlink == 0 {
+			return nil // A copy the user put there on purpose
+		}
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(abs, dst)
+}
+
+// ensureAuthorityKeys generates the authority's P-256 signing key pair in keyDir, unless
+// one exists and replace is false. It reports whether it wrote a new key.
+func ensureAuthorityKeys(keyDir string, replace bool) (bool, error) {
+	privatePath := filepath.Join(keyDir, filepath.Base(authorityPrivateKey))
+	publicPath := filepath.Join(keyDir, filepath.Base(authorityPublicKey))
+	if !replace {
+		if _, err := os.Stat(privatePath); err == nil {
+			if _, err := os.Stat(publicPath); err == nil {
+				return false, nil
+			}
+		}
+	}
+
+	if err := os.MkdirAll(keyDir, 0700); err != nil {
+		return false, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return false, err
+	}
+	privateDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return false, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return false, err
+	}
+
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateDER}), 0600); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
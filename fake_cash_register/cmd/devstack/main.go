@@ -0,0 +1,217 @@
+// Command devstack runs the revenue authority, the receipt bank and the cash register
+// together for local demos, without Docker: it builds each service from its directory
+// in this repository, writes a config.yaml per service with matching ports and URLs
+// into a working directory, generates the authority's signing key there and starts the
+// services as child processes, prefixing their output with the service name.
+//
+//	cd fake_cash_register
+//	go run ./cmd/devstack                        # everything on the default ports
+//	go run ./cmd/devstack -services bank,register -dir /tmp/demo
+//	go run ./cmd/devstack -ephemeral-keys        # authority key in memory, no key files
+//
+// Ctrl+C stops all services; the working directory keeps configs, keys and logs.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Service names accepted by -services, in start order
+const (
+	serviceAuthority = "authority"
+	serviceBank      = "bank"
+	serviceRegister  = "register"
+)
+
+// service describes how to build and run one service of the stack
+type service struct {
+	name   string
+	srcDir string // Relative to the repository root
+	pkg    string // Built with go build from srcDir
+	port   int
+}
+
+func main() {
+	var (
+		services      = flag.String("services", "authority,bank,register", "Comma-separated services to run: authority, bank, register")
+		dir           = flag.String("dir", ".devstack", "Working directory for generated configs, keys, binaries and logs")
+		root          = flag.String("root", "", "Repository root (default: found from the current directory)")
+		authorityPort = flag.Int("authority-port", 4406, "Revenue authority port")
+		bankPort      = flag.Int("bank-port", 4403, "Receipt bank port")
+		registerPort  = flag.Int("register-port", 8080, "Cash register UI and API port")
+		webhookPort   = flag.Int("webhook-port", 4407, "Cash register webhook port the bank calls back")
+		newKeys       = flag.Bool("new-keys", false, "Replace the authority key generated by an earlier run")
+		ephemeralKeys = flag.Bool("ephemeral-keys", false, "Have the authority sign with an in-memory key instead of generating key files")
+		startTimeout  = flag.Duration("start-timeout", 2*time.Minute, "How long to wait for each service to build and listen")
+	)
+	flag.Parse()
+
+	selected, err := parseServices(*services)
+	if err != nil {
+		log.Fatalf("Invalid -services: %v", err)
+	}
+
+	repoRoot := *root
+	if repoRoot == "" {
+		if repoRoot, err = findRepoRoot(); err != nil {
+			log.Fatalf("%v (pass -root)", err)
+		}
+	}
+	workDir, err := filepath.Abs(*dir)
+	if err != nil {
+		log.Fatalf("Invalid -dir: %v", err)
+	}
+
+	ports := stackPorts{
+		Authority: *authorityPort,
+		Bank:      *bankPort,
+		Register:  *registerPort,
+		Webhook:   *webhookPort,
+	}
+	stack := []service{
+		{name: serviceAuthority, srcDir: "revenue_authority_receipt_service", pkg: ".", port: ports.Authority},
+		{name: serviceBank, srcDir: "receipt_bank", pkg: "./cmd", port: ports.Bank},
+		{name: serviceRegister, srcDir: "fake_cash_register", pkg: "./cmd", port: ports.Register},
+	}
+
+	// Configs for everything first, so a bad template fails before anything is built
+	for _, svc := range stack {
+		if !selected[svc.name] {
+			continue
+		}
+		svcDir := filepath.Join(workDir, svc.name)
+		if err := os.MkdirAll(svcDir, 0755); err != nil {
+			log.Fatalf("Failed to create %s: %v", svcDir, err)
+		}
+		if err := writeConfig(svc, filepath.Join(repoRoot, svc.srcDir), svcDir, ports, selected, *ephemeralKeys); err != nil {
+			log.Fatalf("Failed to write %s config: %v", svc.name, err)
+		}
+	}
+	if selected[serviceAuthority] && !*ephemeralKeys {
+		created, err := ensureAuthorityKeys(filepath.Join(workDir, serviceAuthority, "keys"), *newKeys)
+		if err != nil {
+			log.Fatalf("Failed to generate authority keys: %v", err)
+		}
+		if created {
+			log.Printf("Generated authority signing key in %s", filepath.Join(workDir, serviceAuthority, "keys"))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var running []*process
+	shutdown := func() {
+		// Reverse order: the register goes before the services it calls
+		for i := len(running) - 1; i >= 0; i-- {
+			running[i].stop(10 * time.Second)
+		}
+	}
+
+	for _, svc := range stack {
+		if !selected[svc.name] {
+			continue
+		}
+		binary, err := build(ctx, svc, repoRoot, filepath.Join(workDir, "bin"))
+		if err != nil {
+			shutdown()
+			log.Fatalf("Failed to build %s: %v", svc.name, err)
+		}
+		proc, err := start(svc, binary, filepath.Join(workDir, svc.name))
+		if err != nil {
+			shutdown()
+			log.Fatalf("Failed to start %s: %v", svc.name, err)
+		}
+		running = append(running, proc)
+
+		if err := proc.waitListening(ctx, svc.port, *startTimeout); err != nil {
+			shutdown()
+			log.Fatalf("%s did not come up: %v", svc.name, err)
+		}
+		log.Printf("%s listening on http://127.0.0.1:%d", svc.name, svc.port)
+	}
+
+	if selected[serviceRegister] {
+		log.Printf("Stack ready: open http://localhost:%d (Ctrl+C stops all services)", ports.Register)
+	} else {
+		log.Printf("Stack ready (Ctrl+C stops all services)")
+	}
+
+	// Run until interrupted or until any service dies, which leaves the stack unusable
+	exited := make(chan *process, len(running))
+	for _, proc := range running {
+		go func(p *process) {
+			<-p.done
+			exited <- p
+		}(proc)
+	}
+	select {
+	case <-ctx.Done():
+		log.Printf("Stopping services")
+	case proc := <-exited:
+		// Ctrl+C reaches the services too, and one may exit before we see the signal
+		select {
+		case <-ctx.Done():
+			log.Printf("Stopping services")
+		case <-time.After(500 * time.Millisecond):
+			log.Printf("%s exited (%v), stopping the stack", proc.name, proc.err)
+		}
+	}
+	shutdown()
+}
+
+// parseServices turns the -services list into a set, refusing unknown names
+func parseServices(list string) (map[string]bool, error) {
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+			continue
+		case serviceAuthority, serviceBank, serviceRegister:
+			selected[name] = true
+		default:
+			return nil, fmt.Errorf("unknown service %q", name)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no services selected")
+	}
+	return selected, nil
+}
+
+// findRepoRoot walks up from the current directory to the one holding all three services
+func findRepoRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if isRepoRoot(dir) {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("repository root not found above the current directory")
+		}
+		dir = parent
+	}
+}
+
+func isRepoRoot(dir string) bool {
+	for _, sub := range []string{"revenue_authority_receipt_service", "receipt_bank", "fake_cash_register"} {
+		if info, err := os.Stat(filepath.Join(dir, sub, "config.yaml")); err != nil || info.IsDir() {
+			return false
+		}
+	}
+	return true
+}
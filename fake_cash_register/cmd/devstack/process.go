@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// process is a running service
+type process struct {
+	name string
+	cmd  *exec.Cmd
+	done chan struct{} // Closed when the process exited
+	err  error         // Exit status, valid after done
+}
+
+// build compiles a service into binDir with the Go toolchain, returning the binary path
+func build(ctx context.Context, svc service, repoRoot, binDir string) (string, error) {
+	binary := filepath.Join(binDir, svc.name)
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+	log.Printf("Building %s", svc.name)
+
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", binary, svc.pkg)
+	cmd.Dir = filepath.Join(repoRoot, svc.srcDir)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return binary, nil
+}
+
+// start runs a built service in its working directory, where it finds its config.yaml
+func start(svc service, binary, svcDir string) (*process, error) {
+	cmd := exec.Command(binary)
+	cmd.Dir = svcDir
+	output, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = cmd.Stdout // Both streams through one prefixer, so lines don't interleave
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &process{name: svc.name, cmd: cmd, done: make(chan struct{})}
+	go func() {
+		prefixLines(fmt.Sprintf("[%-9s] ", svc.name), output)
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// prefixLines copies a service's output to stdout, one prefixed line at a time
+func prefixLines(prefix string, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fmt.Fprintln(os.Stdout, prefix+scanner.Text())
+	}
+}
+
+// waitListening waits until the service accepts connections on port. It fails early
+// when the process exits, e.g. because the port is taken.
+func (p *process) waitListening(ctx context.Context, port int, timeout time.Duration) error {
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", address, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("nothing listening on %s after %s", address, timeout)
+		}
+		select {
+		case <-p.done:
+			return fmt.Errorf("exited: %v", p.err)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// stop asks the service to shut down and kills it if it hasn't after grace
+func (p *process) stop(grace time.Duration) {
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+
+	if runtime.GOOS == "windows" {
+		p.cmd.Process.Kill()
+	} else {
+		p.cmd.Process.Signal(syscall.SIGTERM)
+	}
+	select {
+	case <-p.done:
+	case <-time.After(grace):
+		log.Printf("%s did not stop within %s, killing it", p.name, grace)
+		p.cmd.Process.Kill()
+		<-p.done
+	}
+}
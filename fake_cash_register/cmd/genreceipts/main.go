@@ -0,0 +1,401 @@
+// Command genreceipts issues random but realistic receipts through the register's
+// standalone pipeline - the KISIM catalog, store, receipt format, device key and limits
+// of config.yaml, the mock revenue authority and the mock receipt bank - and writes what
+// comes out, for seeding demos and benchmarking the bank, wallets and verifiers.
+//
+//	cd fake_cash_register
+//	go run ./cmd/genreceipts -n 500 -out /tmp/receipts
+//	go run ./cmd/genreceipts -n 50 -seed 7 -payments Nakit,Kart -latency
+//
+// Every receipt is sold to a fresh wallet key, collected back from the mock bank,
+// decrypted and verified. The output directory gets <serial>.bin, the signed receipt a
+// wallet decrypts, <serial>.enc, the encrypted envelope the register submitted to the
+// bank, authority_public.pem, the mock authority's key the signatures verify against
+// (new on every run), and manifest.json listing every receipt with its wallet's key pair
+// and the pipeline step timings. -seed repeats the same sales; keys always differ.
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	rwcrypto "receiptwallet/crypto"
+
+	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/kisim"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/services/mock"
+	"fake-cash-register/internal/timing"
+)
+
+// authorityKeyFile is the name of the mock authority's public key in the output directory
+const authorityKeyFile = "authority_public.pem"
+
+// manifest describes one run's receipts
+type manifest struct {
+	GeneratedAt      string             `json:"generated_at"`
+	Seed             uint64             `json:"seed"`
+	StoreVKN         string             `json:"store_vkn"`
+	StoreName        string             `json:"store_name"`
+	FormatVersion    uint8              `json:"format_version"`
+	AuthorityKeyFile string             `json:"authority_key_file"`
+	Count            int                `json:"count"`
+	TotalAmount      float64            `json:"total_amount"`
+	ElapsedMs        float64            `json:"elapsed_ms"`
+	Pipeline         []timing.StepStats `json:"pipeline"`
+	Receipts         []manifestReceipt  `json:"receipts"`
+}
+
+// manifestReceipt is one generated receipt and the wallet it was issued to
+type manifestReceipt struct {
+	Serial        string  `json:"serial"`
+	TransactionID string  `json:"transaction_id"`
+	Timestamp     string  `json:"timestamp"`
+	Lines         int     `json:"lines"`
+	TotalAmount   float64 `json:"total_amount"`
+	PaymentMethod string  `json:"payment_method"`
+	ReceiptHash   string  `json:"receipt_hash"` // Hex SHA-256 of the binary receipt, as the authority signed it
+	SignedFile    string  `json:"signed_file"`
+	SignedSize    int     `json:"signed_size"`
+	EncryptedFile string  `json:"encrypted_file"`
+	EncryptedSize int     `json:"encrypted_size"`
+	EphemeralKey  string  `json:"ephemeral_key"`      // Base64 compressed public key, the bank's index
+	WalletKey     string  `json:"wallet_private_key"` // Base64 PKCS #8 DER, decrypts the envelope
+	IssueMs       float64 `json:"issue_ms"`
+}
+
+func main() {
+	var (
+		count       = flag.Int("n", 100, "Number of receipts to generate")
+		outDir      = flag.String("out", "generated-receipts", "Output directory for receipts, authority key and manifest")
+		seed        = flag.Uint64("seed", 0, "Seed for the random sales (0 = random)")
+		maxLines    = flag.Int("max-lines", 6, "Most KISIM lines per receipt")
+		maxQuantity = flag.Int("max-quantity", 5, "Most units per line of a KISIM sold by the piece")
+		payments    = flag.String("payments", "Nakit,Kart,Kredi Kartı", "Comma-separated payment methods to pick from")
+		serialStart = flag.Int("serial-start", 0, "Serial of the first receipt (0 = the register's default)")
+		latency     = flag.Bool("latency", false, "Keep the mock services' simulated signing and network delays")
+	)
+	flag.Parse()
+
+	if *count <= 0 || *maxLines <= 0 || *maxQuantity <= 0 {
+		log.Fatalf("-n, -max-lines and -max-quantity must be positive")
+	}
+	paymentMethods := splitList(*payments)
+	if len(paymentMethods) == 0 {
+		log.Fatalf("-payments names no payment method")
+	}
+	if *seed == 0 {
+		*seed = uint64(time.Now().UnixNano())
+	}
+
+	cfg := config.Load()
+	catalog, err := loadCatalog(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load the KISIM catalog: %v", err)
+	}
+
+	authority := mock.NewMockRevenueAuthority(false)
+	bank := mock.NewMockReceiptBank(false)
+	if !*latency {
+		authority.SetDelay(0)
+		bank.SetDelay(0)
+	}
+	cashReg, err := newRegister(cfg, catalog, authority, bank, *serialStart)
+	if err != nil {
+		log.Fatalf("Failed to set up the register: %v", err)
+	}
+
+	format := cashReg.FormatVersion()
+	generator, err := newSaleGenerator(*seed, catalog.Kisim(), paymentMethods, *maxLines, *maxQuantity, format >= 2)
+	if err != nil {
+		log.Fatalf("Failed to prepare sales: %v", err)
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatalf("Failed to create %s: %v", *outDir, err)
+	}
+	authorityDER, err := authority.GetPublicKey()
+	if err != nil {
+		log.Fatalf("Failed to get the mock authority key: %v", err)
+	}
+	authorityPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: authorityDER})
+	if err := os.WriteFile(filepath.Join(*outDir, authorityKeyFile), authorityPEM, 0644); err != nil {
+		log.Fatalf("Failed to write the authority key: %v", err)
+	}
+
+	run := manifest{
+		GeneratedAt:      time.Now().UTC().Format(time.RFC3339),
+		Seed:             *seed,
+		StoreVKN:         cfg.Store.VKN,
+		StoreName:        cfg.Store.Name,
+		FormatVersion:    format,
+		AuthorityKeyFile: authorityKeyFile,
+		Receipts:         make([]manifestReceipt, 0, *count),
+	}
+	started := time.Now()
+	for i := 0; i < *count; i++ {
+		entry, err := issue(cashReg, bank, generator.next(), authorityDER, *outDir)
+		if err != nil {
+			log.Fatalf("Receipt %d of %d: %v", i+1, *count, err)
+		}
+		run.Receipts = append(run.Receipts, entry)
+		run.TotalAmount += entry.TotalAmount
+		if (i+1)%100 == 0 {
+			log.Printf("Generated %d of %d receipts", i+1, *count)
+		}
+	}
+	elapsed := time.Since(started)
+
+	run.Count = len(run.Receipts)
+	run.TotalAmount = float64(int64(run.TotalAmount*100+0.5)) / 100
+	run.ElapsedMs = float64(elapsed.Microseconds()) / 1000
+	run.Pipeline = cashReg.Timings().Stats()
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode the manifest: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(*outDir, "manifest.json"), append(data, '\n'), 0644); err != nil {
+		log.Fatalf("Failed to write the manifest: %v", err)
+	}
+
+	fmt.Printf("Generated %d receipts (₺%.2f) in %v, %.1f ms per receipt, into %s\n",
+		run.Count, run.TotalAmount, elapsed.Round(time.Millisecond), run.ElapsedMs/float64(run.Count), *outDir)
+	for _, step := range run.Pipeline {
+		fmt.Printf("  %-9s avg %7.3f ms  min %7.3f ms  max %7.3f ms\n", step.Step, step.AverageMs, step.MinMs, step.MaxMs)
+	}
+}
+
+// loadCatalog builds the KISIM catalog from config.yaml as the register does
+func loadCatalog(cfg *config.Config) (*kisim.Catalog, error) {
+	kisimDefs := make([]kisim.KisimDef, len(cfg.Kisim))
+	for i, k := range cfg.Kisim {
+		info := models.KisimInfo{
+			ID:          k.ID,
+			Name:        k.Name,
+			TaxRate:     k.TaxRate,
+			PresetPrice: k.PresetPrice,
+			Weighed:     k.Weighed,
+		}
+		for _, change := range k.TaxRates {
+			validFrom, err := change.ValidFromTime()
+			if err != nil {
+				return nil, fmt.Errorf("KISIM %d: invalid tax rate valid_from %q", k.ID, change.ValidFrom)
+			}
+			info.TaxRates = append(info.TaxRates, models.TaxRateChange{Rate: change.Rate, ValidFrom: validFrom})
+		}
+		kisimDefs[i] = kisim.KisimDef{Info: info, Group: k.Group, Order: k.Order}
+	}
+	groupDefs := make([]kisim.GroupDef, len(cfg.KisimLayout.Groups))
+	for i, g := range cfg.KisimLayout.Groups {
+		groupDefs[i] = kisim.GroupDef{ID: g.ID, Name: g.Name, Color: g.Color, Order: g.Order}
+	}
+	return kisim.NewCatalog(groupDefs, kisimDefs, cfg.KisimLayout.PageSize, false)
+}
+
+// newRegister sets up a register with the receipt settings of config.yaml. Nothing is
+// kept: no history, holds, audit trail, Z-reports or stock.
+func newRegister(cfg *config.Config, catalog *kisim.Catalog, authority interfaces.RevenueAuthorityService, bank interfaces.ReceiptBankService, serialStart int) (*cashregister.CashRegister, error) {
+	storeInfo := interfaces.StoreInfo{
+		VKN:     cfg.Store.VKN,
+		Name:    cfg.Store.Name,
+		Address: cfg.Store.Address,
+	}
+	cashReg := cashregister.NewCashRegister(storeInfo, catalog, authority, bank, crypto.NewCryptoService(false), false)
+
+	cashReg.SetSerialStart(serialStart)
+	cashReg.SetTimestampTokens(cfg.RevenueAuthority.TimestampTokens)
+	cashReg.SetStrictSigning(cfg.RevenueAuthority.StrictSigning)
+	cashReg.SetAttestedSubmissions(cfg.ReceiptBank.AttestSubmissions)
+	if cfg.Receipt.FormatVersion != 0 {
+		if err := cashReg.SetFormatVersion(cfg.Receipt.FormatVersion); err != nil {
+			return nil, err
+		}
+	}
+	cashReg.SetCompression(cfg.Receipt.Compress)
+	cashReg.SetTimings(timing.NewRecorder(cfg.PipelineStats.Smoothing))
+	if cfg.Receipt.DeviceKeyFile != "" {
+		deviceKey, err := crypto.LoadDeviceKey(cfg.Receipt.DeviceKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cashReg.SetDeviceKey(deviceKey)
+	}
+	cashReg.SetLimits(cashregister.Limits{
+		MaxQuantity:     cfg.Limits.MaxQuantity,
+		MaxUnitPrice:    cfg.Limits.MaxUnitPrice,
+		MaxReceiptTotal: cfg.Limits.MaxReceiptTotal,
+		MaxItems:        cfg.Limits.MaxItems,
+		MaxWeight:       cfg.Limits.MaxWeight,
+		MaxNoteLength:   cfg.Limits.MaxNoteLength,
+	})
+	return cashReg, nil
+}
+
+// issue sells one sale to a fresh wallet key, collects it back from the bank as the
+// wallet would, verifies it and writes the signed receipt and envelope
+func issue(cashReg *cashregister.CashRegister, bank *mock.MockReceiptBank, s sale, authorityDER []byte, outDir string) (manifestReceipt, error) {
+	walletKey, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		return manifestReceipt{}, fmt.Errorf("failed to generate wallet key: %v", err)
+	}
+	ephemeralKey, err := rwcrypto.CompressKey(&walletKey.PublicKey)
+	if err != nil {
+		return manifestReceipt{}, err
+	}
+	walletKeyDER, err := x509.MarshalPKCS8PrivateKey(walletKey)
+	if err != nil {
+		return manifestReceipt{}, err
+	}
+
+	started := time.Now()
+	if err := cashReg.StartNewReceipt(); err != nil {
+		return manifestReceipt{}, err
+	}
+	for _, l := range s.lines {
+		if err := cashReg.AddItem(l.kisimID, l.quantity, l.unitPrice); err != nil {
+			cashReg.CancelCurrentReceipt()
+			return manifestReceipt{}, fmt.Errorf("failed to add KISIM %d: %v", l.kisimID, err)
+		}
+	}
+	if err := cashReg.SetPaymentMethod(s.paymentMethod); err != nil {
+		return manifestReceipt{}, err
+	}
+	receipt, err := cashReg.IssueCurrentReceipt(ephemeralKey)
+	if err != nil {
+		return manifestReceipt{}, err
+	}
+	issueTime := time.Since(started)
+
+	encrypted, err := bank.CollectReceipt(ephemeralKey)
+	if err != nil {
+		return manifestReceipt{}, fmt.Errorf("failed to collect %s: %v", receipt.ReceiptSerial, err)
+	}
+	signedReceipt, err := rwcrypto.Decrypt(encrypted, walletKey)
+	if err != nil {
+		return manifestReceipt{}, fmt.Errorf("failed to decrypt %s: %v", receipt.ReceiptSerial, err)
+	}
+	signed, _, err := binary.VerifySignedReceipt(signedReceipt, authorityDER)
+	if err != nil {
+		return manifestReceipt{}, fmt.Errorf("%s does not verify: %v", receipt.ReceiptSerial, err)
+	}
+
+	entry := manifestReceipt{
+		Serial:        receipt.ReceiptSerial,
+		TransactionID: receipt.TransactionID,
+		Timestamp:     receipt.Timestamp.Format(time.RFC3339),
+		Lines:         len(receipt.Items),
+		TotalAmount:   receipt.TotalAmount,
+		PaymentMethod: receipt.PaymentMethod,
+		SignedFile:    receipt.ReceiptSerial + ".bin",
+		SignedSize:    len(signedReceipt),
+		EncryptedFile: receipt.ReceiptSerial + ".enc",
+		EncryptedSize: len(encrypted),
+		EphemeralKey:  base64.StdEncoding.EncodeToString(ephemeralKey),
+		WalletKey:     base64.StdEncoding.EncodeToString(walletKeyDER),
+		IssueMs:       float64(issueTime.Microseconds()) / 1000,
+	}
+	hash := sha256.Sum256(signed.Receipt)
+	entry.ReceiptHash = hex.EncodeToString(hash[:])
+
+	if err := os.WriteFile(filepath.Join(outDir, entry.SignedFile), signedReceipt, 0644); err != nil {
+		return manifestReceipt{}, err
+	}
+	if err := os.WriteFile(filepath.Join(outDir, entry.EncryptedFile), encrypted, 0644); err != nil {
+		return manifestReceipt{}, err
+	}
+	return entry, nil
+}
+
+// sale is one generated basket
+type sale struct {
+	lines         []line
+	paymentMethod string
+}
+
+type line struct {
+	kisimID   int
+	quantity  int     // Units, or grams for weighed KISIMs
+	unitPrice float64 // 0 = the KISIM's preset price
+}
+
+// saleGenerator draws baskets shaped like a small shop's: a few lines, mostly single
+// units, open-price KISIMs rung up at varied amounts and weighed KISIMs by the gram
+type saleGenerator struct {
+	rng         *rand.Rand
+	kisims      []models.KisimInfo
+	payments    []string
+	maxLines    int
+	maxQuantity int
+}
+
+func newSaleGenerator(seed uint64, kisims []models.KisimInfo, payments []string, maxLines, maxQuantity int, weighing bool) (*saleGenerator, error) {
+	g := &saleGenerator{
+		rng:         rand.New(rand.NewPCG(seed, seed)),
+		payments:    payments,
+		maxLines:    maxLines,
+		maxQuantity: maxQuantity,
+	}
+	for _, k := range kisims {
+		// Weighed lines need receipt format v2
+		if k.Weighed && !weighing {
+			continue
+		}
+		g.kisims = append(g.kisims, k)
+	}
+	if len(g.kisims) == 0 {
+		return nil, fmt.Errorf("the catalog has no KISIM this receipt format can sell")
+	}
+	return g, nil
+}
+
+func (g *saleGenerator) next() sale {
+	s := sale{paymentMethod: g.payments[g.rng.IntN(len(g.payments))]}
+	for range 1 + g.rng.IntN(g.maxLines) {
+		k := g.kisims[g.rng.IntN(len(g.kisims))]
+		l := line{kisimID: k.ID, quantity: 1}
+		switch {
+		case k.Weighed:
+			l.quantity = 5 * (20 + g.rng.IntN(381)) // 100 g to 2 kg
+		default:
+			// Most lines are one unit; each further unit is less likely
+			for l.quantity < g.maxQuantity && g.rng.Float64() < 0.3 {
+				l.quantity++
+			}
+		}
+		// Open-price keys carry a nominal preset price (1.00) or none
+		if k.PresetPrice <= 1 {
+			l.unitPrice = float64(500+g.rng.IntN(24501)) / 100 // ₺5.00 to ₺250.00
+		}
+		s.lines = append(s.lines, l)
+	}
+	return s
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
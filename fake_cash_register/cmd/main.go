@@ -3,43 +3,122 @@ package main
 import (
 	"fmt"
 	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
 
+	"fake-cash-register/internal/audit"
 	"fake-cash-register/internal/cashregister"
 	"fake-cash-register/internal/config"
 	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/currency"
+	"fake-cash-register/internal/customer"
+	"fake-cash-register/internal/delivery"
+	"fake-cash-register/internal/display"
+	"fake-cash-register/internal/events"
+	"fake-cash-register/internal/faults"
 	"fake-cash-register/internal/handlers"
+	"fake-cash-register/internal/history"
+	"fake-cash-register/internal/hold"
+	"fake-cash-register/internal/hooks"
+	"fake-cash-register/internal/i18n"
+	"fake-cash-register/internal/idempotency"
 	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/kisim"
 	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/registers"
+	"fake-cash-register/internal/resilience"
+	"fake-cash-register/internal/rounding"
+	"fake-cash-register/internal/scale"
 	"fake-cash-register/internal/services"
+	"fake-cash-register/internal/stock"
+	"fake-cash-register/internal/surcharge"
+	"fake-cash-register/internal/timing"
+	"fake-cash-register/internal/transaction"
+	"fake-cash-register/internal/zreport"
 
 	"github.com/gin-gonic/gin"
 )
 
+// sharedServices are used by every register the process serves
+type sharedServices struct {
+	catalog          *kisim.Catalog
+	cryptoService    interfaces.CryptoService
+	revenueAuthority interfaces.RevenueAuthorityService
+	receiptBank      interfaces.ReceiptBankService
+	breakers         *resilience.Registry
+	injector         *faults.Injector
+	messages         *i18n.Bundle
+	converter        *currency.Converter
+	roundingPolicy   *rounding.Policy
+	surchargePolicy  *surcharge.Policy
+}
+
 func main() {
 	// Load configuration
 	cfg := config.Load()
 
-	// Create store info
-	storeInfo := interfaces.StoreInfo{
-		VKN:     cfg.Store.VKN,
-		Name:    cfg.Store.Name,
-		Address: cfg.Store.Address,
-	}
-
-	// Create KISIM lookup
-	kisimLookup := make(models.KisimLookup)
-	for _, k := range cfg.Kisim {
-		kisimLookup[k.ID] = models.KisimInfo{
+	// KISIM catalog, with department keys grouped and paged for the keypad
+	kisimDefs := make([]kisim.KisimDef, len(cfg.Kisim))
+	for i, k := range cfg.Kisim {
+		info := models.KisimInfo{
 			ID:          k.ID,
 			Name:        k.Name,
 			TaxRate:     k.TaxRate,
 			PresetPrice: k.PresetPrice,
+			Weighed:     k.Weighed,
+		}
+		for _, change := range k.TaxRates {
+			validFrom, err := change.ValidFromTime()
+			if err != nil {
+				log.Fatalf("KISIM %d: invalid tax rate valid_from %q: want a date or RFC 3339 time", k.ID, change.ValidFrom)
+			}
+			info.TaxRates = append(info.TaxRates, models.TaxRateChange{Rate: change.Rate, ValidFrom: validFrom})
+		}
+		kisimDefs[i] = kisim.KisimDef{Info: info, Group: k.Group, Order: k.Order}
+	}
+	groupDefs := make([]kisim.GroupDef, len(cfg.KisimLayout.Groups))
+	for i, g := range cfg.KisimLayout.Groups {
+		groupDefs[i] = kisim.GroupDef{ID: g.ID, Name: g.Name, Color: g.Color, Order: g.Order}
+	}
+	catalog, err := kisim.NewCatalog(groupDefs, kisimDefs, cfg.KisimLayout.PageSize, cfg.Server.Verbose)
+	if err != nil {
+		log.Fatalf("Failed to arrange KISIM keys: %v", err)
+	}
+
+	// Head office can replace the catalog while the registers run
+	if cfg.CatalogSync.URL != "" {
+		interval := cfg.CatalogSync.Interval
+		if interval <= 0 {
+			interval = 15 * time.Minute
 		}
+		catalog.StartSync(cfg.CatalogSync.URL, interval)
+		log.Printf("KISIM catalog synced from %s every %v", cfg.CatalogSync.URL, interval)
 	}
 
 	// Initialize services based on configuration (factory pattern)
 	cryptoService := crypto.NewCryptoService(cfg.Server.Verbose)
-	revenueAuthority, receiptBank, err := services.CreateServices(cfg)
+	breakers := resilience.NewRegistry()
+
+	// Standalone testing: make the mock services slow or failing on purpose
+	var injector *faults.Injector
+	if cfg.StandaloneMode && cfg.Faults.Enabled {
+		injector = faults.NewInjector(cfg.Faults.Seed, cfg.Server.Verbose)
+		for service, rule := range map[string]config.FaultRule{
+			faults.ServiceRevenueAuthority: cfg.Faults.RevenueAuthority,
+			faults.ServiceReceiptBank:      cfg.Faults.ReceiptBank,
+		} {
+			if err := injector.SetRule(service, faults.Rule(rule)); err != nil {
+				log.Fatalf("Invalid faults.%s: %v", service, err)
+			}
+		}
+		log.Printf("Fault injection enabled for mock services (seed %d)", injector.Seed())
+	} else if cfg.Faults.Enabled {
+		log.Printf("Warning: faults.enabled only applies in standalone mode")
+	}
+
+	revenueAuthority, receiptBank, err := services.CreateServices(cfg, breakers, injector)
 	if err != nil {
 		log.Fatalf("Failed to initialize services: %v", err)
 	}
@@ -60,19 +139,365 @@ func main() {
 		}
 	}
 
+	// Message catalogs for the UI, customer display and receipt text
+	messages, err := i18n.NewBundle(cfg.I18n.DefaultLocale, cfg.I18n.Messages)
+	if err != nil {
+		log.Fatalf("Failed to load message catalogs: %v", err)
+	}
+
+	// Foreign currency sales, converted at the rate in effect when the receipt is finalized
+	var converter *currency.Converter
+	if len(cfg.Currency.Accepted) > 0 {
+		accepted := make([]currency.Currency, len(cfg.Currency.Accepted))
+		for i, a := range cfg.Currency.Accepted {
+			accepted[i] = currency.Currency{Code: a.Code, Symbol: a.Symbol, Rate: a.Rate}
+		}
+		converter, err = currency.NewConverter(cfg.Currency.Base, cfg.Currency.Rounding, accepted, cfg.Server.Verbose)
+		if err != nil {
+			log.Fatalf("Failed to initialize currencies: %v", err)
+		}
+		converter.StartRefresh(cfg.Currency.RatesURL, cfg.Currency.RefreshInterval)
+	}
+
+	// Cash rounding of the amount due, per payment method
+	var roundingPolicy *rounding.Policy
+	if len(cfg.Rounding.Rules) > 0 {
+		rules := make([]rounding.Rule, len(cfg.Rounding.Rules))
+		for i, r := range cfg.Rounding.Rules {
+			rules[i] = rounding.Rule{PaymentMethod: r.PaymentMethod, Increment: int(math.Round(r.Increment * 100)), Mode: r.Mode}
+		}
+		roundingPolicy, err = rounding.NewPolicy(rules)
+		if err != nil {
+			log.Fatalf("Failed to initialize rounding: %v", err)
+		}
+		log.Printf("Rounding the amount due for %d payment methods", len(rules))
+	}
+
+	// Fees charged per payment method, as receipt lines with their own KDV
+	var surchargePolicy *surcharge.Policy
+	if len(cfg.Surcharges) > 0 {
+		rules := make([]surcharge.Rule, len(cfg.Surcharges))
+		for i, s := range cfg.Surcharges {
+			rules[i] = surcharge.Rule{PaymentMethod: s.PaymentMethod, Name: s.Name, Percent: s.Percent, Amount: s.Amount, TaxRate: s.TaxRate}
+		}
+		surchargePolicy, err = surcharge.NewPolicy(rules)
+		if err != nil {
+			log.Fatalf("Failed to initialize surcharges: %v", err)
+		}
+		log.Printf("Charging %d surcharges by payment method", len(rules))
+	}
+
+	sh := &sharedServices{
+		catalog:          catalog,
+		cryptoService:    cryptoService,
+		revenueAuthority: revenueAuthority,
+		receiptBank:      receiptBank,
+		breakers:         breakers,
+		injector:         injector,
+		messages:         messages,
+		converter:        converter,
+		roundingPolicy:   roundingPolicy,
+		surchargePolicy:  surchargePolicy,
+	}
+
+	// One register, or several selected by /r/<id>/... or X-Register-ID
+	var server http.Handler
+	var first *cashregister.CashRegister
+	var webhook gin.HandlerFunc
+	if len(cfg.Registers) == 0 {
+		cashReg, handler := newRegister(cfg, 0, sh)
+		first, webhook = cashReg, handler.WebhookHandler
+		server = newRouter(cfg, handler, webhook)
+		// Standalone: the mock bank reports its simulated collections straight to the register
+		if cfg.StandaloneMode {
+			receiptBank.SetWebhookHandler(cashReg)
+		}
+	} else {
+		set := registers.NewSet(cfg.Server.Verbose)
+		for _, profile := range cfg.Registers {
+			registerCfg := cfg.ForRegister(profile)
+			cashReg, handler := newRegister(registerCfg, profile.SerialStart, sh)
+			register := &registers.Register{ID: profile.ID, CashRegister: cashReg, Webhook: handler.WebhookHandler}
+			if err := set.Add(register); err != nil {
+				log.Fatalf("Invalid registers configuration: %v", err)
+			}
+			register.Handler = newRouter(registerCfg, handler, set.Webhook)
+			if first == nil {
+				first = cashReg
+			}
+			log.Printf("Register %s: %s (VKN %s) at /r/%s/", profile.ID, profile.Store.Name, profile.Store.VKN, profile.ID)
+		}
+		server, webhook = set, set.Webhook
+		if cfg.StandaloneMode {
+			receiptBank.SetWebhookHandler(set)
+		}
+	}
+
+	// Checkout scale for weighed KISIMs, read from a serial port or posted to /api/scale
+	if cfg.Scale.Enabled {
+		checkoutScale := scale.New(cfg.Scale.MaxAge, cfg.Server.Verbose)
+		if cfg.Scale.Device != "" {
+			checkoutScale.ReadSerial(cfg.Scale.Device)
+		}
+		first.SetScale(checkoutScale)
+	}
+
+	// Cash drawer opened by cash payments, beeper confirming items and refusals
+	deviceController, err := services.CreateDevices(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize devices: %v", err)
+	}
+	if deviceController != nil {
+		first.SetDevices(deviceController, cashregister.DevicePolicy{
+			DrawerPaymentMethods: cfg.Devices.DrawerPayment,
+			BeepOnItem:           cfg.Devices.BeepOnItem,
+			BeepOnError:          cfg.Devices.BeepOnError,
+		})
+	}
+
+	// Webhook endpoint, on its own listener unless it shares the UI/API port
+	if separateWebhook(cfg) {
+		webhookRouter := gin.New()
+		webhookRouter.Use(gin.Recovery())
+		if cfg.Server.Verbose {
+			webhookRouter.Use(gin.Logger())
+		}
+		webhookRouter.POST("/webhook", webhookChain(cfg, webhook)...)
+
+		webhookAddr := fmt.Sprintf("%s:%d", cfg.Server.WebhookBind, cfg.Server.WebhookPort)
+		go func() {
+			if err := webhookRouter.Run(webhookAddr); err != nil {
+				log.Fatalf("Failed to start webhook server: %v", err)
+			}
+		}()
+	}
+
+	// Start server
+	addr := fmt.Sprintf(":%d", cfg.Server.Port)
+	log.Printf("Starting fake cash register on port %d", cfg.Server.Port)
+
+	if cfg.StandaloneMode {
+		log.Printf("Running in STANDALONE mode - no external services required")
+	} else {
+		log.Printf("Running in ONLINE mode - connecting to external services")
+		log.Printf("  Revenue Authority: %s", cfg.RevenueAuthority.URL)
+		log.Printf("  Receipt Bank: %s", cfg.ReceiptBank.URL)
+	}
+	if separateWebhook(cfg) {
+		log.Printf("Webhook listener on %s:%d (callbacks to http://%s:%d/webhook)", cfg.Server.WebhookBind, cfg.Server.WebhookPort, cfg.Server.WebhookHost, cfg.Server.WebhookPort)
+	}
+	if cfg.Server.WebhookSecret != "" {
+		log.Printf("Webhook signatures required (%s)", handlers.WebhookSignatureHeader)
+	}
+
+	if err := http.ListenAndServe(addr, server); err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+}
+
+// newRegister sets up one register and its handlers on the shared services. The checkout
+// scale and cash drawer are attached by the caller, to the first register only.
+func newRegister(cfg *config.Config, serialStart int, sh *sharedServices) (*cashregister.CashRegister, *handlers.CashRegisterHandler) {
 	// Initialize CashRegister with all services directly
+	storeInfo := interfaces.StoreInfo{
+		VKN:     cfg.Store.VKN,
+		Name:    cfg.Store.Name,
+		Address: cfg.Store.Address,
+	}
 	cashReg := cashregister.NewCashRegister(
 		storeInfo,
-		kisimLookup,
-		revenueAuthority,
-		receiptBank,
-		cryptoService,
+		sh.catalog,
+		sh.revenueAuthority,
+		sh.receiptBank,
+		sh.cryptoService,
 		cfg.Server.Verbose,
 	)
 
+	// Issued receipts wait for the bank's collection webhook; uncollected ones expire
+	cashReg.SetTransactionTimeout(cfg.Transactions.Timeout)
+	if cfg.Transactions.ExpiryWebhookURL != "" {
+		cashReg.SetExpiryWebhook(transaction.NewExpiryWebhook(cfg.Transactions.ExpiryWebhookURL, cfg.Transactions.ExpiryWebhookSecret, 5*time.Second, cfg.Server.Verbose))
+	}
+	sweepInterval := cfg.Transactions.SweepInterval
+	if sweepInterval <= 0 {
+		sweepInterval = 30 * time.Second
+	}
+	cashReg.StartTransactionSweeper(sweepInterval)
+	cashReg.SetSerialStart(serialStart)
+
+	// Receipt history for lookups and bookkeeping exports
+	historyStore, err := history.NewStore(cfg.History.File, cfg.Server.Verbose)
+	if err != nil {
+		log.Fatalf("Failed to initialize receipt history: %v", err)
+	}
+	cashReg.SetHistory(historyStore)
+
+	// Held sales, kept across restarts so a parked customer can still be served
+	holds, err := hold.NewStore(cfg.Holds.File, cfg.Holds.Max, cfg.Server.Verbose)
+	if err != nil {
+		log.Fatalf("Failed to initialize held transactions: %v", err)
+	}
+	cashReg.SetHolds(holds)
+
+	// Tamper-evident audit trail of every significant operation
+	auditLog, err := audit.NewLog(cfg.Audit.File, cfg.Server.Verbose)
+	if err != nil {
+		log.Fatalf("Failed to initialize audit trail: %v", err)
+	}
+	cashReg.SetAudit(auditLog)
+
+	// Z-reports: closed reports are kept, optionally sent to the authority, and closed daily
+	zReports, err := zreport.NewStore(cfg.ZReport.File, cfg.Server.Verbose)
+	if err != nil {
+		log.Fatalf("Failed to initialize Z-reports: %v", err)
+	}
+	cashReg.SetZReports(zReports)
+	cashReg.SetZReportSubmission(cfg.ZReport.SubmitToAuthority)
+	if cfg.ZReport.AutoClose != "" {
+		scheduler, err := zreport.NewScheduler(cfg.ZReport.AutoClose, cashReg, cfg.Server.Verbose)
+		if err != nil {
+			log.Fatalf("Failed to schedule Z-report close: %v", err)
+		}
+		scheduler.Start()
+		log.Printf("Z-report closes automatically at %s", cfg.ZReport.AutoClose)
+	}
+
+	// Lifecycle hooks enabled from config
+	hookRegistry, err := hooks.FromConfig(cfg.Hooks.Enabled, cfg.Server.Verbose)
+	if err != nil {
+		log.Fatalf("Failed to initialize hooks: %v", err)
+	}
+	cashReg.SetHooks(hookRegistry)
+
+	cashReg.SetTimestampTokens(cfg.RevenueAuthority.TimestampTokens)
+	cashReg.SetStrictSigning(cfg.RevenueAuthority.StrictSigning)
+	cashReg.SetAttestedSubmissions(cfg.ReceiptBank.AttestSubmissions)
+	if cfg.Receipt.FormatVersion != 0 {
+		if err := cashReg.SetFormatVersion(cfg.Receipt.FormatVersion); err != nil {
+			log.Fatalf("Invalid receipt format version: %v", err)
+		}
+	}
+	cashReg.SetCompression(cfg.Receipt.Compress)
+	cashReg.SetTimings(timing.NewRecorder(cfg.PipelineStats.Smoothing))
+	if cfg.Receipt.DeviceKeyFile != "" {
+		deviceKey, err := crypto.LoadDeviceKey(cfg.Receipt.DeviceKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load device key: %v", err)
+		}
+		cashReg.SetDeviceKey(deviceKey)
+	}
+	cashReg.SetLimits(cashregister.Limits{
+		MaxQuantity:     cfg.Limits.MaxQuantity,
+		MaxUnitPrice:    cfg.Limits.MaxUnitPrice,
+		MaxReceiptTotal: cfg.Limits.MaxReceiptTotal,
+		MaxItems:        cfg.Limits.MaxItems,
+		MaxWeight:       cfg.Limits.MaxWeight,
+		MaxNoteLength:   cfg.Limits.MaxNoteLength,
+	})
+
+	// Stock per KISIM, taken down by every issued receipt
+	if cfg.Stock.Enabled {
+		initial := make([]stock.Initial, len(cfg.Stock.Initial))
+		for i, level := range cfg.Stock.Initial {
+			initial[i] = stock.Initial{KisimID: level.KisimID, Quantity: level.Quantity, LowStock: level.LowStock}
+		}
+		stockStore, err := stock.NewStore(stock.Options{
+			File:       cfg.Stock.File,
+			LowStock:   cfg.Stock.LowStock,
+			BlockSales: cfg.Stock.BlockSales,
+			Initial:    initial,
+		}, sh.catalog, cfg.Server.Verbose)
+		if err != nil {
+			log.Fatalf("Failed to initialize stock: %v", err)
+		}
+		cashReg.SetStock(stockStore)
+	}
+
+	// Foreign currencies and cash rounding are the same at every register
+	cashReg.SetCurrencyConverter(sh.converter)
+	cashReg.SetRounding(sh.roundingPolicy)
+	cashReg.SetSurcharges(sh.surchargePolicy)
+
+	// Store-specific header, footer, legal text and KDV labels on printed receipts
+	var receiptTemplate *models.ReceiptTemplate
+	if cfg.Store.ReceiptTemplate != "" {
+		var err error
+		receiptTemplate, err = models.LoadReceiptTemplate(cfg.Store.ReceiptTemplate)
+		if err != nil {
+			log.Fatalf("Failed to load receipt template: %v", err)
+		}
+		log.Printf("Receipt template loaded from %s", cfg.Store.ReceiptTemplate)
+	}
+
+	// Email/SMS receipts for customers without the wallet app
+	if cfg.Delivery.Enabled {
+		deliveryService, err := delivery.NewService(delivery.Options{
+			Email: delivery.EmailOptions{
+				Host:        cfg.Delivery.Email.SMTPHost,
+				Port:        cfg.Delivery.Email.SMTPPort,
+				ImplicitTLS: cfg.Delivery.Email.ImplicitTLS,
+				Username:    cfg.Delivery.Email.Username,
+				Password:    cfg.Delivery.Email.Password,
+				From:        cfg.Delivery.Email.From,
+			},
+			SMS: delivery.SMSOptions{
+				GatewayURL: cfg.Delivery.SMS.GatewayURL,
+				APIKey:     cfg.Delivery.SMS.APIKey,
+				Sender:     cfg.Delivery.SMS.Sender,
+			},
+			Timeout:  cfg.Delivery.Timeout,
+			Template: receiptTemplate,
+		}, sh.messages.Localizer(cfg.Delivery.Locale), cfg.Server.Verbose)
+		if err != nil {
+			log.Fatalf("Failed to initialize receipt delivery: %v", err)
+		}
+		cashReg.SetDelivery(deliveryService)
+		log.Printf("Receipt delivery enabled by %s", strings.Join(deliveryService.Channels(), " and "))
+	}
+
 	// Initialize handlers
-	handler := handlers.NewCashRegisterHandler(cashReg, cfg)
+	handler := handlers.NewCashRegisterHandler(cashReg, cfg, sh.messages)
+	handler.SetReceiptTemplate(receiptTemplate)
+	handler.SetCatalog(sh.catalog)
+
+	// Customer-facing display mirrors the sale over WebSocket
+	handler.SetDisplay(display.NewHub(cfg.Server.Verbose))
+
+	// Transaction lifecycle as Server-Sent Events for the UI and external displays
+	cashReg.SetEvents(events.NewBroker(cfg.Server.Verbose))
+
+	// External service circuit breakers reported by /api/status
+	handler.SetBreakers(sh.breakers)
+	handler.SetFaults(sh.injector)
+
+	// Retried sale requests carrying an Idempotency-Key get the original response
+	if cfg.Idempotency.Enabled {
+		window := cfg.Idempotency.Window
+		if window <= 0 {
+			window = 10 * time.Minute
+		}
+		maxKeys := cfg.Idempotency.MaxKeys
+		if maxKeys <= 0 {
+			maxKeys = 1000
+		}
+		handler.SetIdempotency(idempotency.NewStore(window, maxKeys))
+		log.Printf("Idempotency keys accepted on add-item, payment and issue requests (window %v)", window)
+	}
+
+	// Standalone demos: the register plays the customer's wallet against the mock bank
+	if cfg.StandaloneMode && cfg.Demo.VirtualCustomer {
+		if collector, ok := sh.receiptBank.(interfaces.ReceiptCollector); ok {
+			handler.SetVirtualCustomer(customer.NewVirtualCustomer(collector, sh.revenueAuthority, cfg.Server.Verbose))
+			log.Printf("Virtual customer enabled - receipts are collected and verified by the register itself")
+		}
+	}
+
+	return cashReg, handler
+}
 
+// newRouter serves the UI and API of one register. webhook handles the receipt bank's
+// webhook; with several registers it finds the register that issued the receipt.
+func newRouter(cfg *config.Config, handler *handlers.CashRegisterHandler, webhook gin.HandlerFunc) *gin.Engine {
 	// Set up Gin router with logging based on verbose config
 	var router *gin.Engine
 	if cfg.Server.Verbose {
@@ -92,44 +517,125 @@ func main() {
 	// Define routes
 	// Web UI
 	router.GET("/", handler.HomePage)
+	router.GET("/display", handler.DisplayPage)
+	router.GET("/ws/display", handler.DisplayFeed)
 
-	// API routes
+	// API routes, behind API keys when auth is enabled
 	api := router.Group("/api")
+	if cfg.Auth.Enabled {
+		auth, err := handlers.NewAPIKeyAuth(cfg.Auth.Keys, cfg.Auth.UIRole, cfg.Server.Verbose)
+		if err != nil {
+			log.Fatalf("Invalid API key configuration: %v", err)
+		}
+		api.Use(auth)
+		log.Printf("API key authentication enabled for %d key(s)", len(cfg.Auth.Keys))
+	}
 	{
 		// Kisim management
 		api.GET("/kisim", handler.GetKisim)
 
+		// Transaction lifecycle stream (Server-Sent Events)
+		api.GET("/events", handler.EventsFeed)
+
+		// External service status (retries, circuit breakers)
+		api.GET("/status", handler.GetStatus)
+
+		// Foreign currencies
+		api.GET("/currency", handler.GetCurrencies)
+		api.PUT("/currency/rates", handler.UpdateRates)
+
+		// Revenue authority public key for wallets verifying this store's receipts
+		api.GET("/authority-key", handler.GetAuthorityKey)
+
 		// Transaction management
 		tx := api.Group("/transaction")
 		{
 			tx.POST("/start", handler.StartTransaction)
-			tx.POST("/add-item", handler.AddItem)
-			tx.POST("/payment", handler.SetPaymentMethod)
-			tx.POST("/issue_receipt", handler.IssueReceipt)
+			tx.POST("/add-item", handler.Idempotent, handler.AddItem)
+			tx.POST("/remove-item", handler.RemoveItem)
+			tx.POST("/payment", handler.Idempotent, handler.SetPaymentMethod)
+			tx.POST("/currency", handler.SetCurrency)
+			tx.POST("/customer", handler.SetCustomer)
+			tx.POST("/refund", handler.StartRefund)
+			tx.GET("/refund", handler.GetRefund)
+			tx.POST("/refund/add-item", handler.AddRefundItem)
+			tx.POST("/issue_receipt", handler.Idempotent, handler.IssueReceipt)
+			tx.POST("/virtual_customer", handler.Idempotent, handler.IssueToVirtualCustomer)
 			tx.POST("/cancel", handler.CancelTransaction)
 			tx.GET("/current", handler.GetCurrentTransaction)
+			tx.GET("/preview", handler.PreviewReceipt)
+			tx.POST("/hold", handler.HoldTransaction)
+			tx.GET("/held", handler.ListHeld)
+			tx.POST("/held/:id/recall", handler.RecallHeld)
+			tx.DELETE("/held/:id", handler.DiscardHeld)
+		}
+
+		// Z-report (end of day)
+		api.GET("/zreport", handler.GetZReport)
+		api.POST("/zreport/close", handler.CloseZReport)
+
+		// Audit trail
+		api.GET("/audit", handler.GetAuditLog)
+		api.GET("/audit/verify", handler.VerifyAuditLog)
+
+		// Checkout scale
+		api.GET("/scale", handler.GetScale)
+		api.POST("/scale", handler.SetScale)
+
+		// Stock
+		stockGroup := api.Group("/stock")
+		{
+			stockGroup.GET("", handler.GetStock)
+			stockGroup.POST("/adjust", handler.AdjustStock)
+			stockGroup.POST("/count", handler.CountStock)
+			stockGroup.GET("/export", handler.ExportStock)
+		}
+
+		// Fault injection (standalone testing)
+		faultGroup := api.Group("/faults")
+		{
+			faultGroup.GET("", handler.GetFaults)
+			faultGroup.PUT("/:service", handler.SetFaultRule)
+			faultGroup.POST("/trigger", handler.TriggerFault)
+			faultGroup.DELETE("", handler.ResetFaults)
 		}
+
+		// Receipt history
+		receipts := api.Group("/receipts")
+		{
+			receipts.GET("/export", handler.ExportReceipts)
+			receipts.GET("/:serial/text", handler.GetReceiptText)
+			receipts.GET("/:serial/pdf", handler.GetReceiptPDF)
+			receipts.GET("/:serial/escpos", handler.GetReceiptESCPOS)
+		}
+	}
+
+	// Webhook endpoint when it shares the UI/API port (see serveWebhook)
+	if !separateWebhook(cfg) {
+		router.POST("/webhook", webhookChain(cfg, webhook)...)
 	}
 
-	// Webhook endpoint
-	router.POST("/webhook", handler.WebhookHandler)
+	// Issuance step timings for Prometheus, next to /health outside the API keys
+	if cfg.PipelineStats.Prometheus {
+		router.GET("/metrics", handler.Metrics)
+	}
 
 	// Health check
 	router.GET("/health", handler.HealthCheck)
 
-	// Start server
-	addr := fmt.Sprintf(":%d", cfg.Server.Port)
-	log.Printf("Starting fake cash register on port %d", cfg.Server.Port)
+	return router
+}
 
-	if cfg.StandaloneMode {
-		log.Printf("Running in STANDALONE mode - no external services required")
-	} else {
-		log.Printf("Running in ONLINE mode - connecting to external services")
-		log.Printf("  Revenue Authority: %s", cfg.RevenueAuthority.URL)
-		log.Printf("  Receipt Bank: %s", cfg.ReceiptBank.URL)
-	}
+// separateWebhook reports whether the webhook has a listener of its own
+func separateWebhook(cfg *config.Config) bool {
+	return cfg.Server.WebhookPort != 0 && cfg.Server.WebhookPort != cfg.Server.Port
+}
 
-	if err := router.Run(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+// webhookChain puts signature checking in front of webhook when a secret is configured
+func webhookChain(cfg *config.Config, webhook gin.HandlerFunc) []gin.HandlerFunc {
+	chain := []gin.HandlerFunc{webhook}
+	if cfg.Server.WebhookSecret != "" {
+		chain = append([]gin.HandlerFunc{handlers.VerifyWebhookSignature(cfg.Server.WebhookSecret, cfg.Server.Verbose)}, chain...)
 	}
+	return chain
 }
@@ -1,37 +1,83 @@
 package api
 
-// Revenue Authority API models
-type SignRequest struct {
-	Hash string `json:"hash"`
-}
+import (
+	"receiptwallet/authority"
+	"receiptwallet/receiptbank"
+)
 
-type SignResponse struct {
-	Signature string `json:"signature"`
-}
+// Revenue Authority API models, shared with the authority's Go client
+type (
+	SignRequest        = authority.SignRequest
+	SignReceiptRequest = authority.SignReceiptRequest
+	SignResponse       = authority.SignResponse
+	PublicKeyResponse  = authority.PublicKeyResponse
+	ZReportSubmission  = authority.ZReportSubmission
+	ZReportSummary     = authority.ZReportSummary
+	ZReportTaxTotal    = authority.ZReportTaxTotal
+)
 
-type PublicKeyResponse struct {
-	PublicKey string `json:"public_key"`
+// AuthorityKeyResponse is the register's GET /api/authority-key: the revenue authority
+// public key it verifies receipts with, for wallets collecting receipts from this store
+type AuthorityKeyResponse struct {
+	PublicKey    string `json:"public_key"` // Base64 DER, as the authority's /public-key serves it
+	PublicKeyPEM string `json:"public_key_pem"`
+	Fingerprint  string `json:"fingerprint"`          // SHA-256 of the DER public key, hex
+	FetchedAt    string `json:"fetched_at,omitempty"` // Last fetched or confirmed unchanged (RFC 3339)
+	Stale        bool   `json:"stale,omitempty"`      // The latest refresh failed; the key may have been rotated since
+	Error        string `json:"error,omitempty"`      // Why the latest refresh failed
 }
 
 type ErrorResponse struct {
 	Error string `json:"error"`
+	Code  string `json:"code,omitempty"` // Machine-readable code, sent by the receipt bank
 }
 
-// Receipt Bank API models
-type ReceiptSubmission struct {
-	EphemeralKey  string `json:"ephemeral_key"`
-	EncryptedData string `json:"encrypted_data"`
+// Receipt Bank API models, shared with the bank's Go client
+type (
+	ReceiptSubmission      = receiptbank.SubmitRequest
+	ReceiptBankResponse    = receiptbank.SubmitResponse
+	ReceiptBatchSubmission = receiptbank.SubmitBatchRequest // At most receiptbank.MaxBatchSize receipts
+	ReceiptBatchResult     = receiptbank.SubmitBatchResult
+	ReceiptBatchSummary    = receiptbank.SubmitBatchSummary
+	ReceiptBatchResponse   = receiptbank.SubmitBatchResponse
+	ReceiptBankVersion     = receiptbank.VersionResponse
+)
+
+// Webhook payload schema versions
+const (
+	WebhookSchemaV1 = 1 // receipt_id, status and timestamp only; sent without schema_version
+	WebhookSchemaV2 = 2 // Adds submission and collection times, latency and the delivery attempt
+)
+
+// WebhookTypeVerification marks the receipt bank's challenge to prove this register
+// asked for its webhooks; the handler echoes the challenge back
+const WebhookTypeVerification = "url_verification"
+
+// Webhook payload
+type WebhookPayload struct {
+	Type          string `json:"type,omitempty"`      // WebhookTypeVerification for challenges, empty for receipts
+	Challenge     string `json:"challenge,omitempty"` // Set on challenges only
+	SchemaVersion int    `json:"schema_version,omitempty"`
 	ReceiptID     string `json:"receipt_id"`
-	WebhookURL    string `json:"webhook_url"`
+	Status        string `json:"status"` // "downloaded", "expired", "error"
+	Timestamp     string `json:"timestamp"`
+
+	// Schema version 2
+	SubmittedAt         string `json:"submitted_at,omitempty"`
+	CollectedAt         string `json:"collected_at,omitempty"`
+	CollectionLatencyMs int64  `json:"collection_latency_ms,omitempty"`
+	Attempt             int    `json:"attempt,omitempty"` // 1 for the first delivery
 }
 
-type ReceiptBankResponse struct {
-	ReceiptID string `json:"receipt_id"`
+// WebhookChallengeResponse answers a verification challenge
+type WebhookChallengeResponse struct {
+	Challenge string `json:"challenge"`
 }
 
-// Webhook payload
-type WebhookPayload struct {
-	ReceiptID string `json:"receipt_id"`
-	Status    string `json:"status"` // "downloaded", "expired", "error"
-	Timestamp string `json:"timestamp"`
+// Version is the payload's schema version, WebhookSchemaV1 for banks that don't send one
+func (p WebhookPayload) Version() int {
+	if p.SchemaVersion == 0 {
+		return WebhookSchemaV1
+	}
+	return p.SchemaVersion
 }
@@ -16,14 +16,42 @@ type APIError struct {
 	Error   string `json:"error"`
 	Code    string `json:"code,omitempty"`
 	Details string `json:"details,omitempty"`
+	Limit   *Limit `json:"limit,omitempty"` // Set with ErrorCodeLimitExceeded
+}
+
+// Limit describes the validation policy limit a sale would exceed
+type Limit struct {
+	Name  string  `json:"name"` // quantity, unit_price, total, items or weight
+	Max   float64 `json:"max"`
+	Value float64 `json:"value"`
 }
 
 // Common error codes
 const (
-	ErrorCodeInvalidRequest   = "INVALID_REQUEST"
-	ErrorCodeInvalidKey       = "INVALID_KEY"
-	ErrorCodeNoActiveReceipt  = "NO_ACTIVE_RECEIPT"
-	ErrorCodeReceiptNotFound  = "RECEIPT_NOT_FOUND"
-	ErrorCodeInternalError    = "INTERNAL_ERROR"
-	ErrorCodeValidationFailed = "VALIDATION_FAILED"
+	ErrorCodeInvalidRequest        = "INVALID_REQUEST"
+	ErrorCodeInvalidKey            = "INVALID_KEY"
+	ErrorCodeNoActiveReceipt       = "NO_ACTIVE_RECEIPT"
+	ErrorCodeReceiptNotFound       = "RECEIPT_NOT_FOUND"
+	ErrorCodeInternalError         = "INTERNAL_ERROR"
+	ErrorCodeValidationFailed      = "VALIDATION_FAILED"
+	ErrorCodeServiceUnavailable    = "SERVICE_UNAVAILABLE"
+	ErrorCodeInvalidSignature      = "INVALID_SIGNATURE"
+	ErrorCodeZReportPending        = "Z_REPORT_PENDING"
+	ErrorCodeLimitExceeded         = "LIMIT_EXCEEDED"
+	ErrorCodeIncompatibleBank      = "INCOMPATIBLE_RECEIPT_BANK"
+	ErrorCodeWebhookUnverified     = "WEBHOOK_UNVERIFIED" // The receipt bank could not verify our webhook URL
+	ErrorCodeDeliveryUnavailable   = "DELIVERY_UNAVAILABLE"
+	ErrorCodeOutOfStock            = "OUT_OF_STOCK"
+	ErrorCodeStockDisabled         = "STOCK_DISABLED"
+	ErrorCodeUnauthorized          = "UNAUTHORIZED"
+	ErrorCodeForbidden             = "FORBIDDEN"
+	ErrorCodeFaultsDisabled        = "FAULTS_DISABLED"
+	ErrorCodeScaleDisabled         = "SCALE_DISABLED"
+	ErrorCodeScaleNotReady         = "SCALE_NOT_READY"
+	ErrorCodeIdempotencyInProgress = "IDEMPOTENCY_IN_PROGRESS"
+	ErrorCodeIdempotencyKeyReused  = "IDEMPOTENCY_KEY_REUSED"
+	ErrorCodeConflict              = "CONFLICT" // Another request is changing the sale
+	ErrorCodeHoldNotFound          = "HOLD_NOT_FOUND"
+	ErrorCodeRegisterNotFound      = "REGISTER_NOT_FOUND"
+	ErrorCodeReceiptVetoed         = "RECEIPT_VETOED" // A lifecycle hook rejected the receipt
 )
@@ -0,0 +1,264 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types recorded by the cash register
+const (
+	EventTransactionStarted  = "transaction_started"
+	EventItemAdded           = "item_added"
+	EventItemRemoved         = "item_removed"
+	EventPriceOverridden     = "price_overridden"
+	EventPaymentSet          = "payment_set"
+	EventCurrencySet         = "currency_set"
+	EventCustomerSet         = "customer_set"
+	EventRefundStarted       = "refund_started"
+	EventReceiptIssued       = "receipt_issued"
+	EventReceiptCancelled    = "receipt_cancelled"
+	EventReceiptDelivered    = "receipt_delivered"
+	EventReceiptExpired      = "receipt_expired"
+	EventDeliveryFailed      = "delivery_failed"
+	EventIssueFailed         = "issue_failed"
+	EventIssueVetoed         = "issue_vetoed" // A lifecycle hook rejected the receipt
+	EventExternalCallFailed  = "external_call_failed"
+	EventZReportClosed       = "zreport_closed"
+	EventStockAdjusted       = "stock_adjusted"
+	EventDrawerOpened        = "drawer_opened"
+	EventTransactionHeld     = "transaction_held"
+	EventTransactionRecalled = "transaction_recalled"
+	EventHoldDiscarded       = "hold_discarded"
+)
+
+// GenesisHash is the previous hash of the first event
+var GenesisHash = strings.Repeat("0", 64)
+
+// Event is one audit log entry. Hash is the hex SHA-256 of the entry's JSON
+// encoding with Hash empty; PrevHash chains it to the entry before, so editing,
+// removing or reordering entries breaks every later hash.
+type Event struct {
+	Sequence      uint64            `json:"seq"`
+	Time          time.Time         `json:"time"`
+	Type          string            `json:"type"`
+	TransactionID string            `json:"transaction_id,omitempty"`
+	Details       map[string]string `json:"details,omitempty"`
+	PrevHash      string            `json:"prev_hash"`
+	Hash          string            `json:"hash"`
+}
+
+// Query selects events; zero fields match everything
+type Query struct {
+	Type          string
+	TransactionID string
+	AfterSequence uint64 // Only events with a higher sequence number
+	From, To      time.Time
+	Limit         int // Oldest first; 0 = no limit
+}
+
+// Log is the append-only audit trail. When a file path is configured, events are
+// appended as JSON lines and the chain is verified when they are reloaded at startup.
+type Log struct {
+	mu       sync.RWMutex
+	events   []Event
+	filePath string
+	verbose  bool
+}
+
+// NewLog creates an audit log, loading and verifying existing entries from filePath if set
+func NewLog(filePath string, verbose bool) (*Log, error) {
+	l := &Log{
+		events:   make([]Event, 0),
+		filePath: filePath,
+		verbose:  verbose,
+	}
+
+	if filePath != "" {
+		events, err := readFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyChain(events); err != nil {
+			return nil, fmt.Errorf("audit log %s failed verification: %v", filePath, err)
+		}
+		l.events = events
+
+		if verbose && len(events) > 0 {
+			log.Printf("[AUDIT] Loaded %d events from %s", len(events), filePath)
+		}
+	}
+
+	return l, nil
+}
+
+// Record appends an event. The event is kept in memory even when it cannot be
+// written to the file, so the returned error only reports the lost persistence.
+func (l *Log) Record(eventType, transactionID string, details map[string]string) (Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	event := Event{
+		Sequence:      uint64(len(l.events)) + 1,
+		Time:          time.Now().UTC(),
+		Type:          eventType,
+		TransactionID: transactionID,
+		Details:       details,
+		PrevHash:      GenesisHash,
+	}
+	if n := len(l.events); n > 0 {
+		event.PrevHash = l.events[n-1].Hash
+	}
+	event.Hash = hashEvent(event)
+
+	l.events = append(l.events, event)
+
+	if l.verbose {
+		log.Printf("[AUDIT] #%d %s %s %v", event.Sequence, event.Type, event.TransactionID, event.Details)
+	}
+
+	if l.filePath != "" {
+		if err := l.appendToFile(event); err != nil {
+			return event, err
+		}
+	}
+	return event, nil
+}
+
+// Query returns matching events, oldest first
+func (l *Log) Query(q Query) []Event {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	result := make([]Event, 0)
+	for _, event := range l.events {
+		if event.Sequence <= q.AfterSequence {
+			continue
+		}
+		if q.Type != "" && event.Type != q.Type {
+			continue
+		}
+		if q.TransactionID != "" && event.TransactionID != q.TransactionID {
+			continue
+		}
+		if !q.From.IsZero() && event.Time.Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && event.Time.After(q.To) {
+			continue
+		}
+		result = append(result, event)
+		if q.Limit > 0 && len(result) == q.Limit {
+			break
+		}
+	}
+	return result
+}
+
+// Head returns the sequence number and hash of the newest event
+// (0 and GenesisHash for an empty log). Publishing the head hash anchors
+// the log: rewriting history would have to reproduce it.
+func (l *Log) Head() (uint64, string) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if n := len(l.events); n > 0 {
+		return l.events[n-1].Sequence, l.events[n-1].Hash
+	}
+	return 0, GenesisHash
+}
+
+// Verify checks the hash chain of the persisted log, or of the in-memory
+// events when no file is configured, and returns the number of events checked
+func (l *Log) Verify() (int, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	events := l.events
+	if l.filePath != "" {
+		var err error
+		if events, err = readFile(l.filePath); err != nil {
+			return 0, err
+		}
+	}
+	return len(events), verifyChain(events)
+}
+
+// verifyChain checks sequence numbers, previous-hash links and event hashes
+func verifyChain(events []Event) error {
+	prevHash := GenesisHash
+	for i, event := range events {
+		if event.Sequence != uint64(i)+1 {
+			return fmt.Errorf("event %d has sequence number %d", i+1, event.Sequence)
+		}
+		if event.PrevHash != prevHash {
+			return fmt.Errorf("event %d does not chain to event %d", event.Sequence, event.Sequence-1)
+		}
+		if hashEvent(event) != event.Hash {
+			return fmt.Errorf("event %d was modified", event.Sequence)
+		}
+		prevHash = event.Hash
+	}
+	return nil
+}
+
+func hashEvent(event Event) string {
+	event.Hash = ""
+	data, _ := json.Marshal(event)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func readFile(filePath string) ([]Event, error) {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("failed to parse audit event %d: %v", len(events)+1, err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+	return events, nil
+}
+
+func (l *Log) appendToFile(event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %v", err)
+	}
+
+	file, err := os.OpenFile(l.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit event: %v", err)
+	}
+	return nil
+}
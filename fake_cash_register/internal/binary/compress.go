@@ -0,0 +1,44 @@
+package binary
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+
+	"receiptwallet/receiptformat"
+)
+
+// MaxDecompressedSize bounds the body a compressed receipt may inflate to. A v2 body can
+// be far larger (65,535 items with 255-byte notes come to about 18 MB), so compressBody
+// leaves bodies above the cap uncompressed instead of writing receipts parsers refuse.
+const MaxDecompressedSize = receiptformat.MaxDecompressedSize
+
+// compressBody replaces the body of a serialized receipt with its zlib stream. Receipts
+// the stream would not shrink, which is most short ones, and bodies above
+// MaxDecompressedSize are returned uncompressed with FlagCompressed cleared.
+func compressBody(receipt []byte) ([]byte, error) {
+	if len(receipt)-HeaderSize > MaxDecompressedSize {
+		receipt[3] &^= FlagCompressed
+		return receipt, nil
+	}
+
+	compressed := bytes.NewBuffer(make([]byte, 0, len(receipt)))
+	compressed.Write(receipt[:HeaderSize])
+
+	w, err := zlib.NewWriterLevel(compressed, zlib.BestCompression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create compressor: %v", err)
+	}
+	if _, err := w.Write(receipt[HeaderSize:]); err != nil {
+		return nil, fmt.Errorf("failed to compress receipt: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress receipt: %v", err)
+	}
+
+	if compressed.Len() >= len(receipt) {
+		receipt[3] &^= FlagCompressed
+		return receipt, nil
+	}
+	return compressed.Bytes(), nil
+}
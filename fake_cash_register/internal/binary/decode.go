@@ -0,0 +1,181 @@
+package binary
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"receiptwallet/receiptformat"
+
+	"fake-cash-register/internal/currency"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/taxid"
+)
+
+// Decoding errors (messages follow BINARY_RECEIPT_FORMAT.md error handling). Both wrap
+// the receiptformat error that caused them.
+var (
+	ErrInvalidFormat = errors.New("invalid receipt format")
+	ErrCorrupted     = errors.New("corrupted receipt data")
+)
+
+// SignedReceipt is a signed receipt split into its parts
+type SignedReceipt struct {
+	Version        uint8
+	Flags          uint8
+	Receipt        []byte // Binary receipt (the signed bytes)
+	Signature      []byte // 64-byte r || s
+	TimestampToken []byte // Present only when FlagTimestampToken is set
+	// The register device's 64-byte r || s over the same hash as Signature, present only
+	// when the receipt carries a device key extension
+	DeviceSignature []byte
+	DeviceKey       []byte // Compressed key from the device key extension
+}
+
+// parseOptions reads the versions this register writes, strictly: unknown flags and
+// extensions are errors rather than skipped
+var parseOptions = receiptformat.Options{Versions: []uint8{FormatVersion1, FormatVersion2}}
+
+// DeserializeReceipt parses binary format v1 or v2 back into a models.Receipt with
+// receiptformat, the parser the wallet and the authority use, then applies the checks only
+// the register makes (checkDecoded). Hostile input can only produce an error.
+func DeserializeReceipt(data []byte) (*models.Receipt, error) {
+	decoded, err := parseOptions.Parse(data)
+	if err != nil {
+		return nil, parseError(err)
+	}
+	return toModel(decoded)
+}
+
+// ParseSignedReceipt splits a signed receipt into receipt bytes, signature, optional device
+// signature and optional timestamp token with receiptformat, and validates the receipt part
+// like DeserializeReceipt
+func ParseSignedReceipt(data []byte) (*SignedReceipt, error) {
+	signed, err := parseOptions.ParseSigned(data)
+	if err != nil {
+		return nil, parseError(err)
+	}
+	if _, err := toModel(signed.Receipt); err != nil {
+		return nil, err
+	}
+	return &SignedReceipt{
+		Version:         signed.Receipt.Version,
+		Flags:           signed.Receipt.Flags,
+		Receipt:         signed.Bytes,
+		Signature:       signed.Signature,
+		TimestampToken:  signed.TimestampToken,
+		DeviceSignature: signed.DeviceSignature,
+		DeviceKey:       signed.Receipt.DeviceKey,
+	}, nil
+}
+
+// parseError wraps a receiptformat error in the register's decoding errors: receipts the
+// parser won't read are ErrInvalidFormat, everything else ErrCorrupted
+func parseError(err error) error {
+	if errors.Is(err, receiptformat.ErrBadMagic) || errors.Is(err, receiptformat.ErrUnsupported) {
+		return fmt.Errorf("%w: %w", ErrInvalidFormat, err)
+	}
+	return fmt.Errorf("%w: %w", ErrCorrupted, err)
+}
+
+// toModel converts a parsed receipt to a models.Receipt after checkDecoded
+func toModel(decoded *receiptformat.Receipt) (*models.Receipt, error) {
+	if err := checkDecoded(decoded); err != nil {
+		return nil, err
+	}
+
+	receipt := &models.Receipt{
+		ZReportNumber: fmt.Sprintf("Z%04d", decoded.ZReport),
+		TransactionID: decoded.TransactionID(),
+		Timestamp:     decoded.Timestamp,
+		StoreVKN:      decoded.StoreVKN,
+		StoreName:     decoded.StoreName,
+		StoreAddress:  decoded.StoreAddress,
+		TotalAmount:   fromKurus(decoded.Total),
+		PaymentMethod: decoded.PaymentMethod,
+		ReceiptSerial: decoded.Serial,
+		Items:         make([]models.Item, len(decoded.Items)),
+		TaxBreakdown: models.TaxBreakdown{
+			Tax10Percent: models.TaxDetail{TaxableAmount: fromKurus(decoded.Tax.Taxable10), TaxAmount: fromKurus(decoded.Tax.Tax10)},
+			Tax20Percent: models.TaxDetail{TaxableAmount: fromKurus(decoded.Tax.Taxable20), TaxAmount: fromKurus(decoded.Tax.Tax20)},
+			TotalTax:     fromKurus(decoded.Tax.TotalTax),
+		},
+		DeviceKey: decoded.DeviceKey,
+	}
+	for i, item := range decoded.Items {
+		receipt.Items[i] = models.Item{
+			KisimID:    item.KisimID,
+			Quantity:   item.Quantity,
+			UnitPrice:  fromKurus(item.UnitPrice),
+			TotalPrice: fromKurus(item.TotalPrice),
+			TaxRate:    item.TaxRate,
+			Weighed:    item.Weighed,
+			Note:       item.Note,
+		}
+	}
+	for _, surcharge := range decoded.Surcharges {
+		receipt.Surcharges = append(receipt.Surcharges, models.Surcharge{
+			Name:    surcharge.Name,
+			Amount:  fromKurus(surcharge.Amount),
+			TaxRate: surcharge.TaxRate,
+		})
+	}
+	if decoded.Flags&FlagCurrency != 0 {
+		receipt.Currency = decoded.Currency
+		receipt.ExchangeRate = decoded.ExchangeRate
+		receipt.ForeignTotal = float64(decoded.ForeignTotal) / math.Pow10(currency.MinorUnitExponent(decoded.Currency))
+	}
+	if decoded.Flags&FlagCustomer != 0 {
+		receipt.Customer = &models.Customer{TaxNumber: decoded.CustomerTaxNumber, Name: decoded.CustomerName}
+	}
+	if decoded.RefundOf != nil {
+		receipt.RefundOf = &models.ReceiptRef{
+			TransactionID: decoded.RefundOf.TransactionID(),
+			ReceiptSerial: decoded.RefundOf.Serial,
+			Timestamp:     decoded.RefundOf.Timestamp,
+		}
+	}
+	return receipt, nil
+}
+
+// checkDecoded rejects receipts that parse but that this register would never have
+// written: dates outside four-digit years (transaction IDs embed YYYYMMDD), item flags
+// without such items, malformed currency fields and customer tax numbers with bad check digits
+func checkDecoded(decoded *receiptformat.Receipt) error {
+	if year := decoded.Timestamp.Year(); year < 1 || year > 9999 {
+		return fmt.Errorf("%w: timestamp out of range", ErrCorrupted)
+	}
+	if decoded.Flags&FlagWeighedItems != 0 && !slices.ContainsFunc(decoded.Items, func(item receiptformat.Item) bool { return item.Weighed }) {
+		return fmt.Errorf("%w: weighed items flag without weighed items", ErrCorrupted)
+	}
+	if decoded.Flags&FlagItemNotes != 0 && !slices.ContainsFunc(decoded.Items, func(item receiptformat.Item) bool { return item.Note != "" }) {
+		return fmt.Errorf("%w: item notes flag without item notes", ErrCorrupted)
+	}
+	if decoded.Flags&FlagCurrency != 0 {
+		if !validCurrencyCode(decoded.Currency) {
+			return fmt.Errorf("%w: invalid currency code", ErrCorrupted)
+		}
+		if decoded.ExchangeRate <= 0 || decoded.ExchangeRate > MaxExchangeRate {
+			return fmt.Errorf("%w: exchange rate out of range", ErrCorrupted)
+		}
+		if decoded.ForeignTotal > layouts[decoded.Version].maxAmount {
+			return fmt.Errorf("%w: foreign total out of range", ErrCorrupted)
+		}
+	}
+	if decoded.Flags&FlagCustomer != 0 {
+		if _, err := taxid.Validate(decoded.CustomerTaxNumber); err != nil {
+			return fmt.Errorf("%w: invalid customer tax number", ErrCorrupted)
+		}
+	}
+	if decoded.RefundOf != nil {
+		if year := decoded.RefundOf.Timestamp.Year(); year < 1 || year > 9999 {
+			return fmt.Errorf("%w: refunded sale timestamp out of range", ErrCorrupted)
+		}
+	}
+	return nil
+}
+
+func fromKurus(kurus int64) float64 {
+	return float64(kurus) / 100
+}
@@ -3,18 +3,57 @@ package binary
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
+	"unicode/utf8"
 
+	rwcrypto "receiptwallet/crypto"
+
+	"fake-cash-register/internal/currency"
 	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/taxid"
 )
 
 const (
 	// Binary receipt format constants
-	MagicBytes    = 0x5452 // 'TR' for Turkish Receipt
-	FormatVersion = 0x01   // Version 1
-	Reserved      = 0x00   // Reserved byte (must be zero)
-
-	// Fixed field sizes
+	MagicBytes     = 0x5452         // 'TR' for Turkish Receipt
+	FormatVersion1 = 0x01           // uint16 quantities, uint32 kuruş amounts
+	FormatVersion2 = 0x02           // uint32 quantities, uint64 kuruş amounts
+	FormatVersion  = FormatVersion1 // Version written by SerializeReceipt
+	Reserved       = 0x00           // Flags byte with no flags set
+
+	// Header flags (stored in the former reserved byte)
+	FlagTimestampToken = 0x01 // Signed receipt carries an authority timestamp token trailer
+	FlagCurrency       = 0x02 // Receipt carries a foreign currency extension after the tax breakdown
+	FlagCompressed     = 0x04 // Everything after the header is a zlib stream
+	FlagWeighedItems   = 0x08 // Every item ends with a unit byte; v2 only
+	FlagItemNotes      = 0x10 // Every item ends with a length-prefixed note (after the unit byte); v2 only
+	FlagCustomer       = 0x20 // Receipt carries a customer extension (tax number and name) after the currency extension
+	FlagRefund         = 0x40 // Receipt refunds an earlier sale and carries a refund extension naming it
+	FlagExtensions     = 0x80 // Receipt ends with tagged extensions; the last flag bit, so later extensions get tags
+	KnownFlags         = FlagTimestampToken | FlagCurrency | FlagCompressed | FlagWeighedItems | FlagItemNotes | FlagCustomer | FlagRefund | FlagExtensions
+
+	// Tagged extensions (after the refund extension when FlagExtensions is set): Tag(1) +
+	// Length(4) + that many bytes each, in ascending tag order
+	ExtensionSurcharges = 0x01 // Count(1), then per line Name(4+N) + Amount + TaxRate(1)
+	ExtensionDeviceKey  = 0x02 // Compressed P-256 device key(33); the signed receipt ends with its signature
+
+	// Item units (the byte after each item when FlagWeighedItems is set)
+	UnitPieces = 0x00 // Quantity counts items
+	UnitGrams  = 0x01 // Quantity is a weight in grams; the unit price is per kilogram
+
+	// Field limits enforced on both serialize and deserialize
+	MaxStringFieldLength = 1024           // Bytes per length-prefixed string
+	MaxItemCount         = math.MaxUint16 // Item count is a uint16 in every version
+	MaxItemNoteLength    = math.MaxUint8  // Bytes per item note (uint8 length prefix)
+	MaxSurcharges        = math.MaxUint8  // Surcharge lines per receipt (uint8 count)
+
+	// v2 amounts are uint64 but decode to float64, so they stop at 2^53 kuruş
+	// where every value is still exactly representable
+	MaxAmountV2Kurus = 1 << 53
+
+	// Fixed field sizes (v1; see layout for the widths of other versions)
 	HeaderSize       = 4
 	TimestampSize    = 8
 	ZReportSize      = 4
@@ -25,24 +64,167 @@ const (
 	ItemCountSize    = 2
 	ItemSize         = 13 // KisimID(2) + Quantity(2) + UnitPrice(4) + TotalPrice(4) + TaxRate(1)
 	TaxBreakdownSize = 20 // Tax10Base(4) + Tax10Amount(4) + Tax20Base(4) + Tax20Amount(4) + TotalTax(4)
+	CurrencyExtSize  = 15 // Code(3) + ExchangeRate(8) + ForeignTotal(4)
+	RefundExtSize    = 16 // OriginalTimestamp(8) + OriginalTransaction(4) + OriginalSerial(4); same in v2
+
+	// Field sizes that differ in v2
+	ItemSizeV2         = 23 // KisimID(2) + Quantity(4) + UnitPrice(8) + TotalPrice(8) + TaxRate(1)
+	TaxBreakdownSizeV2 = 40 // Five uint64 amounts
+	CurrencyExtSizeV2  = 19 // Code(3) + ExchangeRate(8) + ForeignTotal(8)
+
+	// Exchange rates are stored in millionths of a base unit; the upper bound
+	// keeps every stored value exactly representable as a float64
+	ExchangeRateScale = 1_000_000
+	MaxExchangeRate   = 1 << 53 / ExchangeRateScale
 
 	// ECDSA signature size (P-256: r(32) + s(32))
 	SignatureSize = 64
+
+	// Compressed P-256 public key size (0x02/0x03 || X)
+	DeviceKeySize = 33
+
+	// Authority timestamp token: version(1) + unix seconds(8) + signature(64)
+	TimestampTokenSize = 73
 )
 
+// ErrOutOfRange is returned when a receipt field does not fit the format version's field width
+var ErrOutOfRange = errors.New("field out of range")
+
+// layout holds the field widths of one format version
+type layout struct {
+	version      uint8
+	quantitySize int    // Bytes per quantity
+	amountSize   int    // Bytes per kuruş amount
+	maxQuantity  uint64 // Largest quantity the field holds
+	maxAmount    uint64 // Largest kuruş amount the field holds
+	weights      bool   // Supports FlagWeighedItems
+	notes        bool   // Supports FlagItemNotes
+	unitSize     int    // Bytes after each item, set for receipts with FlagWeighedItems
+	noteSize     int    // Note length byte after each item, set for receipts with FlagItemNotes
+}
+
+var layouts = map[uint8]layout{
+	FormatVersion1: {version: FormatVersion1, quantitySize: 2, amountSize: 4, maxQuantity: math.MaxUint16, maxAmount: math.MaxUint32},
+	FormatVersion2: {version: FormatVersion2, quantitySize: 4, amountSize: 8, maxQuantity: math.MaxUint32, maxAmount: MaxAmountV2Kurus, weights: true, notes: true},
+}
+
+func layoutFor(version uint8) (layout, error) {
+	l, ok := layouts[version]
+	if !ok {
+		return layout{}, fmt.Errorf("unsupported receipt version %d", version)
+	}
+	return l, nil
+}
+
+// itemSize is the size of an item without its note text, the smallest an item can be
+func (l layout) itemSize() int {
+	return 2 + l.quantitySize + 2*l.amountSize + 1 + l.unitSize + l.noteSize
+}
+
+func (l layout) taxBreakdownSize() int {
+	return 5 * l.amountSize
+}
+
+// Limits are the largest values a format version can encode
+type Limits struct {
+	MaxQuantity int     // Per item line (grams on weighed lines)
+	MaxItems    int     // Lines per receipt
+	MaxAmount   float64 // Lira, for every amount field
+	Weights     bool    // Can hold weighed items
+	MaxNote     int     // Bytes per item note (0 = no notes)
+}
+
+// VersionLimits returns the field limits of a format version
+func VersionLimits(version uint8) (Limits, error) {
+	l, err := layoutFor(version)
+	if err != nil {
+		return Limits{}, err
+	}
+	limits := Limits{
+		MaxQuantity: int(l.maxQuantity),
+		MaxItems:    MaxItemCount,
+		MaxAmount:   float64(l.maxAmount) / 100,
+		Weights:     l.weights,
+	}
+	if l.notes {
+		limits.MaxNote = MaxItemNoteLength
+	}
+	return limits, nil
+}
+
 // SerializeReceipt converts a models.Receipt to binary format v1
 func SerializeReceipt(receipt *models.Receipt) ([]byte, error) {
+	return SerializeReceiptVersion(receipt, FormatVersion, Reserved)
+}
+
+// SerializeReceiptWithFlags converts a models.Receipt to binary format v1 with header flags set.
+// Flags are part of the hashed receipt so they cannot be altered after signing.
+// FlagCurrency is derived from the receipt itself and set whenever it has a currency.
+func SerializeReceiptWithFlags(receipt *models.Receipt, flags uint8) ([]byte, error) {
+	return SerializeReceiptVersion(receipt, FormatVersion, flags)
+}
+
+// SerializeReceiptVersion converts a models.Receipt to the given format version with header flags set.
+// Fields that do not fit the version's widths fail with ErrOutOfRange instead of wrapping.
+// FlagWeighedItems and FlagItemNotes are, like FlagCurrency, FlagCustomer, FlagRefund and
+// FlagExtensions, derived from the receipt; weighed items and item notes need v2.
+// FlagCompressed compresses the receipt body only when that makes it smaller, and is
+// cleared otherwise; the receipt is hashed and signed in its compressed form.
+func SerializeReceiptVersion(receipt *models.Receipt, version uint8, flags uint8) ([]byte, error) {
+	l, err := layoutFor(version)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFieldLimits(receipt, l); err != nil {
+		return nil, err
+	}
+	if flags&^KnownFlags != 0 {
+		return nil, fmt.Errorf("unknown header flags 0x%02x", flags&^KnownFlags)
+	}
+	if receipt.Currency != "" {
+		flags |= FlagCurrency
+	} else if flags&FlagCurrency != 0 {
+		return nil, fmt.Errorf("currency flag set on a receipt without currency")
+	}
+	if hasWeighedItems(receipt) {
+		flags |= FlagWeighedItems
+		l.unitSize = 1
+	} else if flags&FlagWeighedItems != 0 {
+		return nil, fmt.Errorf("weighed items flag set on a receipt without weighed items")
+	}
+	if hasItemNotes(receipt) {
+		flags |= FlagItemNotes
+		l.noteSize = 1
+	} else if flags&FlagItemNotes != 0 {
+		return nil, fmt.Errorf("item notes flag set on a receipt without item notes")
+	}
+	if receipt.Customer != nil {
+		flags |= FlagCustomer
+	} else if flags&FlagCustomer != 0 {
+		return nil, fmt.Errorf("customer flag set on a receipt without customer")
+	}
+	if receipt.RefundOf != nil {
+		flags |= FlagRefund
+	} else if flags&FlagRefund != 0 {
+		return nil, fmt.Errorf("refund flag set on a receipt that refunds no sale")
+	}
+	if len(receipt.Surcharges) > 0 || receipt.DeviceKey != nil {
+		flags |= FlagExtensions
+	} else if flags&FlagExtensions != 0 {
+		return nil, fmt.Errorf("extensions flag set on a receipt without extensions")
+	}
+
 	buf := new(bytes.Buffer)
 
 	// Header (4 bytes)
 	if err := binary.Write(buf, binary.BigEndian, uint16(MagicBytes)); err != nil {
 		return nil, fmt.Errorf("failed to write magic bytes: %v", err)
 	}
-	if err := binary.Write(buf, binary.BigEndian, uint8(FormatVersion)); err != nil {
+	if err := binary.Write(buf, binary.BigEndian, version); err != nil {
 		return nil, fmt.Errorf("failed to write version: %v", err)
 	}
-	if err := binary.Write(buf, binary.BigEndian, uint8(Reserved)); err != nil {
-		return nil, fmt.Errorf("failed to write reserved byte: %v", err)
+	if err := binary.Write(buf, binary.BigEndian, flags); err != nil {
+		return nil, fmt.Errorf("failed to write flags byte: %v", err)
 	}
 
 	// Receipt metadata
@@ -97,8 +279,7 @@ func SerializeReceipt(receipt *models.Receipt) ([]byte, error) {
 	}
 
 	// Total amount (convert to kuruş)
-	totalKurus := uint32(receipt.TotalAmount * 100)
-	if err := binary.Write(buf, binary.BigEndian, totalKurus); err != nil {
+	if err := l.writeAmount(buf, receipt.TotalAmount); err != nil {
 		return nil, fmt.Errorf("failed to write total amount: %v", err)
 	}
 
@@ -128,24 +309,60 @@ func SerializeReceipt(receipt *models.Receipt) ([]byte, error) {
 
 	// Items
 	for i, item := range receipt.Items {
-		if err := serializeItem(buf, item); err != nil {
+		if err := serializeItem(buf, l, item); err != nil {
 			return nil, fmt.Errorf("failed to serialize item %d: %v", i, err)
 		}
 	}
 
 	// Tax breakdown
-	if err := serializeTaxBreakdown(buf, receipt.TaxBreakdown); err != nil {
+	if err := serializeTaxBreakdown(buf, l, receipt.TaxBreakdown); err != nil {
 		return nil, fmt.Errorf("failed to serialize tax breakdown: %v", err)
 	}
 
+	// Currency extension
+	if flags&FlagCurrency != 0 {
+		if err := serializeCurrency(buf, l, receipt); err != nil {
+			return nil, fmt.Errorf("failed to serialize currency: %v", err)
+		}
+	}
+
+	// Customer extension
+	if flags&FlagCustomer != 0 {
+		if err := serializeCustomer(buf, receipt.Customer); err != nil {
+			return nil, fmt.Errorf("failed to serialize customer: %v", err)
+		}
+	}
+
+	// Refund extension
+	if flags&FlagRefund != 0 {
+		if err := serializeRefund(buf, receipt.RefundOf); err != nil {
+			return nil, fmt.Errorf("failed to serialize refund: %v", err)
+		}
+	}
+
+	// Tagged extensions
+	if len(receipt.Surcharges) > 0 {
+		if err := serializeExtension(buf, ExtensionSurcharges, func(ext *bytes.Buffer) error {
+			return serializeSurcharges(ext, l, receipt.Surcharges)
+		}); err != nil {
+			return nil, fmt.Errorf("failed to serialize surcharges: %v", err)
+		}
+	}
+	if receipt.DeviceKey != nil {
+		if err := serializeExtension(buf, ExtensionDeviceKey, func(ext *bytes.Buffer) error {
+			_, err := ext.Write(receipt.DeviceKey)
+			return err
+		}); err != nil {
+			return nil, fmt.Errorf("failed to serialize device key: %v", err)
+		}
+	}
+
+	if flags&FlagCompressed != 0 {
+		return compressBody(buf.Bytes())
+	}
 	return buf.Bytes(), nil
 }
 
-// NOTE: DeserializeReceipt and ParseSignedReceipt functions are intentionally NOT implemented.
-// This cash register system only ISSUES receipts (serialize → hash → sign → encrypt → submit).
-// It does not need to READ back or verify receipts, so deserialization functions would be dead code.
-// If receipt retrieval/verification features are needed in the future, implement them then.
-
 // CreateSignedReceipt concatenates binary receipt with ECDSA signature
 func CreateSignedReceipt(binaryReceipt []byte, signature []byte) ([]byte, error) {
 	if len(signature) != SignatureSize {
@@ -159,6 +376,224 @@ func CreateSignedReceipt(binaryReceipt []byte, signature []byte) ([]byte, error)
 	return result, nil
 }
 
+// CreateDeviceSignedReceipt concatenates a binary receipt that carries a device key extension
+// with the authority signature and the device signature, both over the receipt's hash
+func CreateDeviceSignedReceipt(binaryReceipt []byte, signature []byte, deviceSignature []byte) ([]byte, error) {
+	if len(deviceSignature) != SignatureSize {
+		return nil, fmt.Errorf("invalid device signature size: expected %d bytes, got %d", SignatureSize, len(deviceSignature))
+	}
+	signed, err := CreateSignedReceipt(binaryReceipt, signature)
+	if err != nil {
+		return nil, err
+	}
+	return append(signed, deviceSignature...), nil
+}
+
+// AppendTimestampToken appends the authority timestamp token trailer to a signed receipt.
+// The receipt header must carry FlagTimestampToken so parsers know the trailer is present.
+func AppendTimestampToken(signedReceipt []byte, token []byte) ([]byte, error) {
+	if len(token) != TimestampTokenSize {
+		return nil, fmt.Errorf("invalid timestamp token size: expected %d bytes, got %d", TimestampTokenSize, len(token))
+	}
+	if len(signedReceipt) < HeaderSize || signedReceipt[3]&FlagTimestampToken == 0 {
+		return nil, fmt.Errorf("receipt header does not declare a timestamp token")
+	}
+
+	result := make([]byte, 0, len(signedReceipt)+len(token))
+	result = append(result, signedReceipt...)
+	result = append(result, token...)
+
+	return result, nil
+}
+
+// checkFieldLimits rejects receipts whose fields do not fit the format version
+func checkFieldLimits(receipt *models.Receipt, l layout) error {
+	textFields := []struct{ name, value string }{
+		{"store name", receipt.StoreName},
+		{"store address", receipt.StoreAddress},
+		{"payment method", receipt.PaymentMethod},
+	}
+	for _, field := range textFields {
+		if len(field.value) > MaxStringFieldLength {
+			return fmt.Errorf("%w: %s too long: %d bytes (max %d)", ErrOutOfRange, field.name, len(field.value), MaxStringFieldLength)
+		}
+	}
+	if len(receipt.Items) > MaxItemCount {
+		return fmt.Errorf("%w: too many items: %d (max %d)", ErrOutOfRange, len(receipt.Items), MaxItemCount)
+	}
+	if hasWeighedItems(receipt) && !l.weights {
+		return fmt.Errorf("%w: weighed items need format v2 (receipt is v%d)", ErrOutOfRange, l.version)
+	}
+	if hasItemNotes(receipt) && !l.notes {
+		return fmt.Errorf("%w: item notes need format v2 (receipt is v%d)", ErrOutOfRange, l.version)
+	}
+
+	amounts := []struct {
+		name  string
+		value float64
+	}{
+		{"total amount", receipt.TotalAmount},
+		{"tax 10% base", receipt.TaxBreakdown.Tax10Percent.TaxableAmount},
+		{"tax 10% amount", receipt.TaxBreakdown.Tax10Percent.TaxAmount},
+		{"tax 20% base", receipt.TaxBreakdown.Tax20Percent.TaxableAmount},
+		{"tax 20% amount", receipt.TaxBreakdown.Tax20Percent.TaxAmount},
+		{"total tax", receipt.TaxBreakdown.TotalTax},
+	}
+	for _, amount := range amounts {
+		if err := l.checkAmount(amount.name, amount.value); err != nil {
+			return err
+		}
+	}
+
+	for i, item := range receipt.Items {
+		if item.KisimID < 0 || item.KisimID > math.MaxUint16 {
+			return fmt.Errorf("%w: item %d: KisimID %d (max %d)", ErrOutOfRange, i, item.KisimID, math.MaxUint16)
+		}
+		if item.Quantity < 0 || uint64(item.Quantity) > l.maxQuantity {
+			return fmt.Errorf("%w: item %d: quantity %d (format v%d holds 0..%d)", ErrOutOfRange, i, item.Quantity, l.version, l.maxQuantity)
+		}
+		if err := l.checkAmount(fmt.Sprintf("item %d: unit price", i), item.UnitPrice); err != nil {
+			return err
+		}
+		if err := l.checkAmount(fmt.Sprintf("item %d: total price", i), item.TotalPrice); err != nil {
+			return err
+		}
+		if item.TaxRate < 0 || item.TaxRate > math.MaxUint8 {
+			return fmt.Errorf("%w: item %d: tax rate %d (max %d)", ErrOutOfRange, i, item.TaxRate, math.MaxUint8)
+		}
+		if len(item.Note) > MaxItemNoteLength {
+			return fmt.Errorf("%w: item %d: note too long: %d bytes (max %d)", ErrOutOfRange, i, len(item.Note), MaxItemNoteLength)
+		}
+		if !utf8.ValidString(item.Note) {
+			return fmt.Errorf("item %d: note is not valid UTF-8", i)
+		}
+	}
+	if receipt.Currency != "" {
+		if !validCurrencyCode(receipt.Currency) {
+			return fmt.Errorf("invalid currency code %q", receipt.Currency)
+		}
+		if receipt.ExchangeRate <= 0 || receipt.ExchangeRate > MaxExchangeRate {
+			return fmt.Errorf("%w: exchange rate %v (max %d)", ErrOutOfRange, receipt.ExchangeRate, MaxExchangeRate)
+		}
+		if receipt.ForeignTotal < 0 || toMinorUnits(receipt.ForeignTotal, receipt.Currency) > float64(l.maxAmount) {
+			return fmt.Errorf("%w: foreign total %v (format v%d holds up to %d minor units)",
+				ErrOutOfRange, receipt.ForeignTotal, l.version, l.maxAmount)
+		}
+	}
+	if len(receipt.Surcharges) > MaxSurcharges {
+		return fmt.Errorf("%w: too many surcharges: %d (max %d)", ErrOutOfRange, len(receipt.Surcharges), MaxSurcharges)
+	}
+	for i, surcharge := range receipt.Surcharges {
+		if surcharge.Name == "" || !utf8.ValidString(surcharge.Name) {
+			return fmt.Errorf("surcharge %d: name must be non-empty UTF-8", i)
+		}
+		if len(surcharge.Name) > MaxStringFieldLength {
+			return fmt.Errorf("%w: surcharge %d: name too long: %d bytes (max %d)", ErrOutOfRange, i, len(surcharge.Name), MaxStringFieldLength)
+		}
+		if err := l.checkAmount(fmt.Sprintf("surcharge %d: amount", i), surcharge.Amount); err != nil {
+			return err
+		}
+		if surcharge.TaxRate < 0 || surcharge.TaxRate > math.MaxUint8 {
+			return fmt.Errorf("%w: surcharge %d: tax rate %d (max %d)", ErrOutOfRange, i, surcharge.TaxRate, math.MaxUint8)
+		}
+	}
+	if receipt.DeviceKey != nil {
+		if _, err := rwcrypto.DecompressKey(receipt.DeviceKey); err != nil {
+			return fmt.Errorf("device key: %v", err)
+		}
+	}
+	if customer := receipt.Customer; customer != nil {
+		if _, err := taxid.Validate(customer.TaxNumber); err != nil {
+			return fmt.Errorf("customer: %v", err)
+		}
+		if customer.Name == "" || !utf8.ValidString(customer.Name) {
+			return fmt.Errorf("customer name must be non-empty UTF-8")
+		}
+		if len(customer.Name) > MaxStringFieldLength {
+			return fmt.Errorf("%w: customer name too long: %d bytes (max %d)", ErrOutOfRange, len(customer.Name), MaxStringFieldLength)
+		}
+	}
+	if original := receipt.RefundOf; original != nil {
+		if original.Timestamp.Unix() < 0 {
+			return fmt.Errorf("%w: refunded sale timestamp %v", ErrOutOfRange, original.Timestamp)
+		}
+		if _, err := parseTransactionID(original.TransactionID); err != nil {
+			return fmt.Errorf("refunded sale: %v", err)
+		}
+		if _, err := parseReceiptSerial(original.ReceiptSerial); err != nil {
+			return fmt.Errorf("refunded sale: %v", err)
+		}
+	}
+	return nil
+}
+
+func hasWeighedItems(receipt *models.Receipt) bool {
+	for _, item := range receipt.Items {
+		if item.Weighed {
+			return true
+		}
+	}
+	return false
+}
+
+func hasItemNotes(receipt *models.Receipt) bool {
+	for _, item := range receipt.Items {
+		if item.Note != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAmount rejects a lira amount that is negative or above the version's kuruş field
+func (l layout) checkAmount(name string, amount float64) error {
+	kurus := math.Round(amount * 100)
+	if kurus < 0 || kurus > float64(l.maxAmount) {
+		return fmt.Errorf("%w: %s %.2f (format v%d holds 0..%.2f)", ErrOutOfRange, name, amount, l.version, float64(l.maxAmount)/100)
+	}
+	return nil
+}
+
+// writeAmount writes a lira amount as kuruş in the version's amount width
+func (l layout) writeAmount(buf *bytes.Buffer, amount float64) error {
+	return l.writeUint(buf, l.amountSize, toKurus(amount))
+}
+
+// writeUint writes value big-endian in size bytes; checkFieldLimits has ensured it fits
+func (l layout) writeUint(buf *bytes.Buffer, size int, value uint64) error {
+	switch size {
+	case 2:
+		return binary.Write(buf, binary.BigEndian, uint16(value))
+	case 4:
+		return binary.Write(buf, binary.BigEndian, uint32(value))
+	default:
+		return binary.Write(buf, binary.BigEndian, value)
+	}
+}
+
+// validCurrencyCode reports whether code is three upper-case ASCII letters (ISO 4217 form)
+func validCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < 'A' || code[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// toMinorUnits converts an amount to the currency's minor unit (cents, yen...)
+func toMinorUnits(amount float64, code string) float64 {
+	return math.Round(amount * math.Pow10(currency.MinorUnitExponent(code)))
+}
+
+// toKurus converts a lira amount to kuruş, rounding so 0.29 encodes as 29 rather than 28
+func toKurus(amount float64) uint64 {
+	return uint64(math.Round(amount * 100))
+}
+
 // Helper functions for parsing string fields to integers
 
 func parseZReportNumber(zReport string) (uint32, error) {
@@ -206,26 +641,24 @@ func parseReceiptSerial(serial string) (uint32, error) {
 	return num, nil
 }
 
-func serializeItem(buf *bytes.Buffer, item models.Item) error {
+func serializeItem(buf *bytes.Buffer, l layout, item models.Item) error {
 	// KisimID (2 bytes)
 	if err := binary.Write(buf, binary.BigEndian, uint16(item.KisimID)); err != nil {
 		return fmt.Errorf("failed to write KisimID: %v", err)
 	}
 
-	// Quantity (2 bytes)
-	if err := binary.Write(buf, binary.BigEndian, uint16(item.Quantity)); err != nil {
+	// Quantity (2 bytes in v1, 4 in v2)
+	if err := l.writeUint(buf, l.quantitySize, uint64(item.Quantity)); err != nil {
 		return fmt.Errorf("failed to write quantity: %v", err)
 	}
 
-	// Unit price in kuruş (4 bytes)
-	unitPriceKurus := uint32(item.UnitPrice * 100)
-	if err := binary.Write(buf, binary.BigEndian, unitPriceKurus); err != nil {
+	// Unit price in kuruş (4 bytes in v1, 8 in v2)
+	if err := l.writeAmount(buf, item.UnitPrice); err != nil {
 		return fmt.Errorf("failed to write unit price: %v", err)
 	}
 
-	// Total price in kuruş (4 bytes)
-	totalPriceKurus := uint32(item.TotalPrice * 100)
-	if err := binary.Write(buf, binary.BigEndian, totalPriceKurus); err != nil {
+	// Total price in kuruş (4 bytes in v1, 8 in v2)
+	if err := l.writeAmount(buf, item.TotalPrice); err != nil {
 		return fmt.Errorf("failed to write total price: %v", err)
 	}
 
@@ -234,39 +667,171 @@ func serializeItem(buf *bytes.Buffer, item models.Item) error {
 		return fmt.Errorf("failed to write tax rate: %v", err)
 	}
 
+	// Unit (1 byte, only in receipts with weighed items)
+	if l.unitSize > 0 {
+		unit := uint8(UnitPieces)
+		if item.Weighed {
+			unit = UnitGrams
+		}
+		if err := buf.WriteByte(unit); err != nil {
+			return fmt.Errorf("failed to write unit: %v", err)
+		}
+	}
+
+	// Note (1-byte length + UTF-8 bytes, only in receipts with item notes; 0 = none)
+	if l.noteSize > 0 {
+		if err := buf.WriteByte(uint8(len(item.Note))); err != nil {
+			return fmt.Errorf("failed to write note length: %v", err)
+		}
+		if _, err := buf.WriteString(item.Note); err != nil {
+			return fmt.Errorf("failed to write note: %v", err)
+		}
+	}
+
 	return nil
 }
 
-func serializeTaxBreakdown(buf *bytes.Buffer, tax models.TaxBreakdown) error {
+func serializeTaxBreakdown(buf *bytes.Buffer, l layout, tax models.TaxBreakdown) error {
 	// Tax 10% base amount in kuruş
-	tax10BaseKurus := uint32(tax.Tax10Percent.TaxableAmount * 100)
-	if err := binary.Write(buf, binary.BigEndian, tax10BaseKurus); err != nil {
+	if err := l.writeAmount(buf, tax.Tax10Percent.TaxableAmount); err != nil {
 		return fmt.Errorf("failed to write tax 10 base: %v", err)
 	}
 
 	// Tax 10% amount in kuruş
-	tax10AmountKurus := uint32(tax.Tax10Percent.TaxAmount * 100)
-	if err := binary.Write(buf, binary.BigEndian, tax10AmountKurus); err != nil {
+	if err := l.writeAmount(buf, tax.Tax10Percent.TaxAmount); err != nil {
 		return fmt.Errorf("failed to write tax 10 amount: %v", err)
 	}
 
 	// Tax 20% base amount in kuruş
-	tax20BaseKurus := uint32(tax.Tax20Percent.TaxableAmount * 100)
-	if err := binary.Write(buf, binary.BigEndian, tax20BaseKurus); err != nil {
+	if err := l.writeAmount(buf, tax.Tax20Percent.TaxableAmount); err != nil {
 		return fmt.Errorf("failed to write tax 20 base: %v", err)
 	}
 
 	// Tax 20% amount in kuruş
-	tax20AmountKurus := uint32(tax.Tax20Percent.TaxAmount * 100)
-	if err := binary.Write(buf, binary.BigEndian, tax20AmountKurus); err != nil {
+	if err := l.writeAmount(buf, tax.Tax20Percent.TaxAmount); err != nil {
 		return fmt.Errorf("failed to write tax 20 amount: %v", err)
 	}
 
 	// Total tax amount in kuruş
-	totalTaxKurus := uint32(tax.TotalTax * 100)
-	if err := binary.Write(buf, binary.BigEndian, totalTaxKurus); err != nil {
+	if err := l.writeAmount(buf, tax.TotalTax); err != nil {
 		return fmt.Errorf("failed to write total tax: %v", err)
 	}
 
 	return nil
 }
+
+func serializeCurrency(buf *bytes.Buffer, l layout, receipt *models.Receipt) error {
+	// ISO 4217 code (3 ASCII bytes)
+	if _, err := buf.WriteString(receipt.Currency); err != nil {
+		return fmt.Errorf("failed to write currency code: %v", err)
+	}
+
+	// Exchange rate in millionths of a base unit per foreign unit
+	rate := uint64(math.Round(receipt.ExchangeRate * ExchangeRateScale))
+	if err := binary.Write(buf, binary.BigEndian, rate); err != nil {
+		return fmt.Errorf("failed to write exchange rate: %v", err)
+	}
+
+	// Foreign total in the currency's minor units (amount width)
+	foreignTotal := uint64(toMinorUnits(receipt.ForeignTotal, receipt.Currency))
+	if err := l.writeUint(buf, l.amountSize, foreignTotal); err != nil {
+		return fmt.Errorf("failed to write foreign total: %v", err)
+	}
+
+	return nil
+}
+
+func serializeCustomer(buf *bytes.Buffer, customer *models.Customer) error {
+	// Tax number (length + ASCII digits: 10 for a VKN, 11 for a TCKN)
+	if err := binary.Write(buf, binary.BigEndian, uint32(len(customer.TaxNumber))); err != nil {
+		return fmt.Errorf("failed to write tax number length: %v", err)
+	}
+	if _, err := buf.WriteString(customer.TaxNumber); err != nil {
+		return fmt.Errorf("failed to write tax number: %v", err)
+	}
+
+	// Name (length + UTF-8 bytes)
+	if err := binary.Write(buf, binary.BigEndian, uint32(len(customer.Name))); err != nil {
+		return fmt.Errorf("failed to write customer name length: %v", err)
+	}
+	if _, err := buf.WriteString(customer.Name); err != nil {
+		return fmt.Errorf("failed to write customer name: %v", err)
+	}
+
+	return nil
+}
+
+func serializeRefund(buf *bytes.Buffer, original *models.ReceiptRef) error {
+	// Original sale time (unix seconds); its date is part of the transaction ID
+	if err := binary.Write(buf, binary.BigEndian, uint64(original.Timestamp.Unix())); err != nil {
+		return fmt.Errorf("failed to write original timestamp: %v", err)
+	}
+
+	// Original transaction number (the transaction ID without 'TX' and the date)
+	txID, err := parseTransactionID(original.TransactionID)
+	if err != nil {
+		return fmt.Errorf("failed to parse original transaction ID: %v", err)
+	}
+	if err := binary.Write(buf, binary.BigEndian, txID); err != nil {
+		return fmt.Errorf("failed to write original transaction ID: %v", err)
+	}
+
+	// Original receipt serial (without 'F')
+	serial, err := parseReceiptSerial(original.ReceiptSerial)
+	if err != nil {
+		return fmt.Errorf("failed to parse original receipt serial: %v", err)
+	}
+	if err := binary.Write(buf, binary.BigEndian, serial); err != nil {
+		return fmt.Errorf("failed to write original receipt serial: %v", err)
+	}
+
+	return nil
+}
+
+// serializeExtension writes a tagged extension: the tag, the length of the data write
+// produces, then the data
+func serializeExtension(buf *bytes.Buffer, tag uint8, write func(*bytes.Buffer) error) error {
+	ext := new(bytes.Buffer)
+	if err := write(ext); err != nil {
+		return err
+	}
+	if err := buf.WriteByte(tag); err != nil {
+		return fmt.Errorf("failed to write extension tag: %v", err)
+	}
+	if err := binary.Write(buf, binary.BigEndian, uint32(ext.Len())); err != nil {
+		return fmt.Errorf("failed to write extension length: %v", err)
+	}
+	if _, err := buf.Write(ext.Bytes()); err != nil {
+		return fmt.Errorf("failed to write extension: %v", err)
+	}
+	return nil
+}
+
+func serializeSurcharges(buf *bytes.Buffer, l layout, surcharges []models.Surcharge) error {
+	// Line count (1 byte)
+	if err := buf.WriteByte(uint8(len(surcharges))); err != nil {
+		return fmt.Errorf("failed to write surcharge count: %v", err)
+	}
+
+	for i, surcharge := range surcharges {
+		// Name (length + UTF-8 bytes)
+		if err := binary.Write(buf, binary.BigEndian, uint32(len(surcharge.Name))); err != nil {
+			return fmt.Errorf("failed to write surcharge %d name length: %v", i, err)
+		}
+		if _, err := buf.WriteString(surcharge.Name); err != nil {
+			return fmt.Errorf("failed to write surcharge %d name: %v", i, err)
+		}
+
+		// Amount in kuruş, KDV included (4 bytes in v1, 8 in v2)
+		if err := l.writeAmount(buf, surcharge.Amount); err != nil {
+			return fmt.Errorf("failed to write surcharge %d amount: %v", i, err)
+		}
+
+		// Tax rate (1 byte)
+		if err := buf.WriteByte(uint8(surcharge.TaxRate)); err != nil {
+			return fmt.Errorf("failed to write surcharge %d tax rate: %v", i, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package binary
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	rwcrypto "receiptwallet/crypto"
+
+	"fake-cash-register/internal/models"
+)
+
+// ErrInvalidSignature is returned when a signed receipt does not verify against the
+// revenue authority's public key
+var ErrInvalidSignature = errors.New("revenue authority signature does not verify")
+
+// ErrInvalidDeviceSignature is returned when a device signed receipt's device signature does
+// not verify against the device key it declares
+var ErrInvalidDeviceSignature = errors.New("register device signature does not verify")
+
+// VerifySignedReceipt splits a signed receipt, checks the authority signature over its
+// receipt bytes against authorityKeyDER (PKIX, as the authority publishes it) and, when the
+// receipt is device signed, the device signature against its device key, then decodes the
+// receipt. Only receipts whose signatures verify are decoded.
+func VerifySignedReceipt(data, authorityKeyDER []byte) (*SignedReceipt, *models.Receipt, error) {
+	signed, err := ParseSignedReceipt(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse signed receipt: %w", err)
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(authorityKeyDER)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse revenue authority public key: %v", err)
+	}
+	authorityKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("revenue authority public key is not ECDSA")
+	}
+
+	hash := sha256.Sum256(signed.Receipt)
+	if !rwcrypto.Verify(authorityKey, hash[:], signed.Signature) {
+		return nil, nil, ErrInvalidSignature
+	}
+	if signed.DeviceKey != nil {
+		deviceKey, err := rwcrypto.DecompressKey(signed.DeviceKey)
+		if err != nil || !rwcrypto.Verify(deviceKey, hash[:], signed.DeviceSignature) {
+			return nil, nil, ErrInvalidDeviceSignature
+		}
+	}
+
+	receipt, err := DeserializeReceipt(signed.Receipt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode receipt: %w", err)
+	}
+	return signed, receipt, nil
+}
@@ -0,0 +1,63 @@
+package cashregister
+
+import (
+	"log"
+	"strconv"
+
+	"fake-cash-register/internal/audit"
+	"fake-cash-register/internal/models"
+)
+
+// SetAudit configures the audit trail that records every significant operation
+func (cr *CashRegister) SetAudit(l *audit.Log) {
+	cr.audit = l
+}
+
+// Audit returns the audit trail (nil if not configured)
+func (cr *CashRegister) Audit() *audit.Log {
+	return cr.audit
+}
+
+// record appends an event to the audit trail, if one is configured. The
+// operation has already happened, so a failed write is only logged.
+func (cr *CashRegister) record(eventType, transactionID string, details map[string]string) {
+	if cr.audit == nil {
+		return
+	}
+	if _, err := cr.audit.Record(eventType, transactionID, details); err != nil {
+		log.Printf("[CASH-REGISTER] Failed to persist audit event %s: %v", eventType, err)
+	}
+}
+
+// itemDetails describes a receipt line for audit events
+func itemDetails(line int, item models.Item) map[string]string {
+	return map[string]string{
+		"line":       strconv.Itoa(line),
+		"kisim_id":   strconv.Itoa(item.KisimID),
+		"quantity":   strconv.Itoa(item.Quantity),
+		"unit_price": formatAmount(item.UnitPrice),
+	}
+}
+
+// recordItemAdded records a sale of item on line, preceded by a price override
+// when the item was not sold at the KISIM preset price
+func (cr *CashRegister) recordItemAdded(line int, item models.Item, presetPrice float64) {
+	if item.UnitPrice != presetPrice {
+		details := itemDetails(line, item)
+		details["preset_price"] = formatAmount(presetPrice)
+		cr.record(audit.EventPriceOverridden, "", details)
+	}
+	cr.record(audit.EventItemAdded, "", itemDetails(line, item))
+}
+
+// recordExternalFailure records a failed call to an external service while issuing receipt
+func (cr *CashRegister) recordExternalFailure(service string, receipt *models.Receipt, err error) {
+	cr.record(audit.EventExternalCallFailed, receipt.TransactionID, map[string]string{
+		"service": service,
+		"error":   err.Error(),
+	})
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
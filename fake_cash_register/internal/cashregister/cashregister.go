@@ -1,22 +1,45 @@
 package cashregister
 
 import (
+	"crypto/ecdsa"
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	rwcrypto "receiptwallet/crypto"
+
+	"fake-cash-register/internal/audit"
 	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/currency"
+	"fake-cash-register/internal/events"
+	"fake-cash-register/internal/history"
+	"fake-cash-register/internal/hold"
+	"fake-cash-register/internal/hooks"
 	"fake-cash-register/internal/interfaces"
 	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/rounding"
+	"fake-cash-register/internal/scale"
+	"fake-cash-register/internal/stock"
+	"fake-cash-register/internal/surcharge"
+	"fake-cash-register/internal/timing"
 	"fake-cash-register/internal/transaction"
+	"fake-cash-register/internal/zreport"
 )
 
 // CashRegister represents a cash register that manages complete receipt lifecycle
 type CashRegister struct {
 	// Core business data
 	storeInfo   interfaces.StoreInfo
-	kisimLookup models.KisimLookup
+	kisimLookup models.KisimSource
 	verbose     bool
 
 	// Service dependencies for complete receipt lifecycle
@@ -24,39 +47,290 @@ type CashRegister struct {
 	receiptBank      interfaces.ReceiptBankService
 	cryptoService    interfaces.CryptoService
 
-	// Internal state management
+	// The open sale and receipt numbering, guarded by saleMu. saleOp is held for the
+	// whole of an operation that changes them (see beginSale).
+	saleOp         sync.Mutex
+	saleMu         sync.Mutex
 	currentReceipt *models.Receipt
-	zReportCounter int
+	refundOriginal *models.Receipt // Verified sale the current receipt refunds
 	receiptCounter int
+	zReportCounter int // Guarded by zMu
+
+	// Transaction manager for webhook confirmations, and where expiries are reported (optional)
+	txManager     *transaction.Manager
+	expiryWebhook *transaction.ExpiryWebhook
+
+	// Issued receipt history (optional)
+	history *history.Store
+
+	// Email/SMS delivery for customers without the wallet app (optional)
+	delivery   interfaces.ReceiptDeliverer
+	deliveries sync.WaitGroup
+
+	// Sales parked for later, in memory unless SetHolds gives a file-backed store
+	holds *hold.Store
+
+	// Stock levels per KISIM (optional)
+	stock *stock.Store
+
+	// Checkout scale for weighed KISIMs (optional)
+	scale *scale.Scale
+
+	// Cash drawer and beeper (optional), and pending commands to them
+	devices      interfaces.DeviceController
+	devicePolicy DevicePolicy
+	deviceOps    sync.WaitGroup
+
+	// Lifecycle hooks (loyalty, stock, custom logging...)
+	hooks *hooks.Registry
+
+	// Lifecycle event stream for UIs and external displays (optional)
+	events *events.Broker
+
+	// Tamper-evident trail of significant operations (optional)
+	audit *audit.Log
+
+	// Request authority timestamp tokens and embed them in signed receipts
+	timestampTokens bool
+
+	// Send the whole binary receipt for checking instead of a bare hash
+	strictSigning bool
+	// Send the receipt hash and authority signature with submissions
+	attestSubmissions bool
+
+	// Binary receipt format version and sale validation policy; zero limits
+	// fall back to the version's field ceilings
+	formatVersion uint8
+	limits        Limits
+	// Compress receipt bodies that shrink with zlib (binary.FlagCompressed)
+	compress bool
+	// Device key signing every receipt next to the authority (optional)
+	deviceKey *ecdsa.PrivateKey
+
+	// How long each issuance step takes, for /api/status and /metrics
+	timings *timing.Recorder
+
+	// Foreign currency conversion (optional)
+	currency *currency.Converter
 
-	// Transaction manager for webhook confirmations
-	txManager *transaction.Manager
+	// Cash rounding of the amount due per payment method (optional)
+	rounding *rounding.Policy
+
+	// Fees charged per payment method (optional)
+	surcharges *surcharge.Policy
+
+	// Z-report running totals, pending close and closed reports (optional store)
+	zMu      sync.Mutex
+	zOpen    *models.ZReport
+	zClosing bool
+	zReports *zreport.Store
+	zSubmit  bool
 }
 
 // NewCashRegister creates a new cash register with complete receipt lifecycle capabilities
 func NewCashRegister(
 	storeInfo interfaces.StoreInfo,
-	kisimLookup models.KisimLookup,
+	kisimLookup models.KisimSource,
 	revenueAuthority interfaces.RevenueAuthorityService,
 	receiptBank interfaces.ReceiptBankService,
 	cryptoService interfaces.CryptoService,
 	verbose bool,
 ) *CashRegister {
-	return &CashRegister{
+	cr := &CashRegister{
 		storeInfo:        storeInfo,
 		kisimLookup:      kisimLookup,
 		revenueAuthority: revenueAuthority,
 		receiptBank:      receiptBank,
 		cryptoService:    cryptoService,
 		verbose:          verbose,
+		timings:          timing.NewRecorder(timing.DefaultSmoothing),
 		zReportCounter:   1,
 		receiptCounter:   1,
+		formatVersion:    binary.FormatVersion,
 		txManager:        transaction.NewManager(verbose),
+		hooks:            hooks.NewRegistry(verbose),
+	}
+	cr.holds, _ = hold.NewStore("", 0, verbose) // Only loading a file can fail
+	cr.openZReport()
+	cr.txManager.SetExpiryHandler(cr.transactionExpired)
+
+	return cr
+}
+
+// Hooks returns the lifecycle hook registry
+func (cr *CashRegister) Hooks() *hooks.Registry {
+	return cr.hooks
+}
+
+// SetHooks replaces the lifecycle hook registry
+func (cr *CashRegister) SetHooks(registry *hooks.Registry) {
+	cr.hooks = registry
+}
+
+// SetHistory configures the store that records every issued receipt
+func (cr *CashRegister) SetHistory(store *history.Store) {
+	cr.history = store
+}
+
+// History returns the issued receipt history store (nil if not configured)
+func (cr *CashRegister) History() *history.Store {
+	return cr.history
+}
+
+// SetSerialStart continues receipt numbering at serial, so registers sharing a store's
+// books keep apart sequences
+func (cr *CashRegister) SetSerialStart(serial int) {
+	cr.saleMu.Lock()
+	defer cr.saleMu.Unlock()
+	if serial > 0 {
+		cr.receiptCounter = serial
+	}
+}
+
+// NextSerial returns the serial the next issued receipt gets
+func (cr *CashRegister) NextSerial() string {
+	cr.saleMu.Lock()
+	defer cr.saleMu.Unlock()
+	return fmt.Sprintf("F%04d", cr.receiptCounter)
+}
+
+// StoreInfo returns the store the register issues receipts for
+func (cr *CashRegister) StoreInfo() interfaces.StoreInfo {
+	return cr.storeInfo
+}
+
+// SetTimestampTokens enables embedding revenue authority timestamp tokens in signed receipts
+func (cr *CashRegister) SetTimestampTokens(enabled bool) {
+	cr.timestampTokens = enabled
+}
+
+// SetStrictSigning makes the register submit binary receipts to the authority's
+// checked signing flow; the authority service must implement interfaces.ReceiptSigner
+func (cr *CashRegister) SetStrictSigning(enabled bool) {
+	cr.strictSigning = enabled
+}
+
+// SetAttestedSubmissions makes the register send the receipt hash and authority signature
+// to the receipt bank; the bank service must implement interfaces.AttestedSubmitter
+func (cr *CashRegister) SetAttestedSubmissions(enabled bool) {
+	cr.attestSubmissions = enabled
+}
+
+// SetFormatVersion selects the binary receipt format version written for new receipts.
+// Version 2 widens quantities to uint32 and amounts to uint64 kuruş.
+func (cr *CashRegister) SetFormatVersion(version uint8) error {
+	if _, err := binary.VersionLimits(version); err != nil {
+		return err
+	}
+	cr.formatVersion = version
+	return nil
+}
+
+// SetCompression compresses the body of new binary receipts when that makes them
+// smaller, shrinking large itemized receipts before signing and encryption. Every
+// wallet collecting from the bank must be able to inflate them.
+func (cr *CashRegister) SetCompression(enabled bool) {
+	cr.compress = enabled
+}
+
+// SetDeviceKey makes the register sign every receipt with its own device key besides the
+// authority: the receipt carries the key's public half and ends with the device signature.
+// Wallets must understand the device key extension.
+func (cr *CashRegister) SetDeviceKey(key *ecdsa.PrivateKey) {
+	cr.deviceKey = key
+}
+
+// SetTimings replaces the recorder of issuance step timings, e.g. with other smoothing
+func (cr *CashRegister) SetTimings(recorder *timing.Recorder) {
+	cr.timings = recorder
+}
+
+// Timings returns the recorder of issuance step timings
+func (cr *CashRegister) Timings() *timing.Recorder {
+	return cr.timings
+}
+
+// FormatVersion returns the binary receipt format version written for new receipts
+func (cr *CashRegister) FormatVersion() uint8 {
+	return cr.formatVersion
+}
+
+// SetCurrencyConverter enables foreign currency sales
+func (cr *CashRegister) SetCurrencyConverter(converter *currency.Converter) {
+	cr.currency = converter
+}
+
+// RevenueAuthority returns the revenue authority receipts are signed by
+func (cr *CashRegister) RevenueAuthority() interfaces.RevenueAuthorityService {
+	return cr.revenueAuthority
+}
+
+// CurrencyConverter returns the currency converter (nil if foreign currencies are disabled)
+func (cr *CashRegister) CurrencyConverter() *currency.Converter {
+	return cr.currency
+}
+
+// SetCurrency selects the currency the customer pays the current receipt in.
+// The base currency (or an empty code) switches back to a regular sale.
+func (cr *CashRegister) SetCurrency(code string) error {
+	if err := cr.beginSale(); err != nil {
+		return err
+	}
+	defer cr.endSale()
+
+	if cr.currentReceipt == nil {
+		return fmt.Errorf("no active receipt - call StartNewReceipt first")
+	}
+
+	code = strings.ToUpper(code)
+	if code == "" || (cr.currency != nil && code == cr.currency.Base()) {
+		cr.currentReceipt.Currency = ""
+		cr.currentReceipt.ExchangeRate = 0
+		cr.currentReceipt.ForeignTotal = 0
+		cr.record(audit.EventCurrencySet, "", map[string]string{"currency": "base"})
+		return nil
+	}
+	if cr.currency == nil || !cr.currency.Accepts(code) {
+		return fmt.Errorf("currency %s is not accepted", code)
 	}
+
+	// Quote the current rate for display; it is locked in again when finalizing
+	quote, err := cr.currency.Quote(0, code)
+	if err != nil {
+		return err
+	}
+
+	if cr.verbose {
+		log.Printf("[CASH-REGISTER] Currency set to: %s (rate %.6f)", code, quote.Rate)
+	}
+
+	cr.currentReceipt.Currency = code
+	cr.currentReceipt.ExchangeRate = quote.Rate
+	cr.currentReceipt.ForeignTotal = 0
+	cr.record(audit.EventCurrencySet, "", map[string]string{
+		"currency": code,
+		"rate":     strconv.FormatFloat(quote.Rate, 'f', -1, 64),
+	})
+	return nil
 }
 
-// StartNewReceipt begins a new receipt transaction
-func (cr *CashRegister) StartNewReceipt() {
+// StartNewReceipt begins a new receipt transaction, discarding an open one. It fails
+// with zreport.ErrClosePending while a Z-report close is waiting to complete.
+func (cr *CashRegister) StartNewReceipt() error {
+	if err := cr.beginSale(); err != nil {
+		return err
+	}
+	defer cr.endSale()
+
+	return cr.startReceipt()
+}
+
+// startReceipt opens a new receipt. Callers hold the sale.
+func (cr *CashRegister) startReceipt() error {
+	if cr.ZReportClosing() {
+		return zreport.ErrClosePending
+	}
+
 	if cr.verbose {
 		log.Printf("[CASH-REGISTER] Starting new receipt")
 	}
@@ -64,13 +338,35 @@ func (cr *CashRegister) StartNewReceipt() {
 	cr.currentReceipt = &models.Receipt{
 		Items: make([]models.Item, 0),
 	}
+	cr.refundOriginal = nil
+	cr.record(audit.EventTransactionStarted, "", nil)
+	cr.publish(events.TypeStarted, cr.currentReceipt)
+	return nil
 }
 
-// AddItem adds an item to the current receipt with optional custom unit price
+// AddItem adds an item to the current receipt with optional custom unit price.
+// For a weighed KISIM quantity is the weight in grams, read from the scale when 0,
+// and the unit price is per kilogram.
 func (cr *CashRegister) AddItem(kisimID int, quantity int, customUnitPrice float64) error {
+	return cr.AddItemWithNote(kisimID, quantity, customUnitPrice, "")
+}
+
+// AddItemWithNote adds an item like AddItem with a free-text note printed under its
+// line. Items only join an existing line when their notes match, so every device sold
+// with its own serial number keeps a line of its own.
+func (cr *CashRegister) AddItemWithNote(kisimID int, quantity int, customUnitPrice float64, note string) (err error) {
+	defer func() { cr.itemFeedback(err) }()
+	if err := cr.beginSale(); err != nil {
+		return err
+	}
+	defer cr.endSale()
+
 	if cr.currentReceipt == nil {
 		return fmt.Errorf("no active receipt - call StartNewReceipt first")
 	}
+	if cr.currentReceipt.IsRefund() {
+		return ErrRefundLinesOnly
+	}
 
 	// Look up KISIM information
 	kisimInfo, exists := cr.kisimLookup.GetKisimInfo(kisimID)
@@ -84,43 +380,119 @@ func (cr *CashRegister) AddItem(kisimID int, quantity int, customUnitPrice float
 		unitPrice = customUnitPrice
 	}
 
+	weighed := kisimInfo.Weighed
+	if weighed {
+		grams, err := cr.weigh(quantity)
+		if err != nil {
+			return err
+		}
+		quantity = grams
+	}
+
+	note = strings.TrimSpace(note)
+	limits := cr.Limits()
+	if err := limits.checkLine(quantity, unitPrice, weighed); err != nil {
+		return err
+	}
+	if err := limits.checkNote(note); err != nil {
+		return err
+	}
+	if err := cr.checkStock(append(slices.Clone(cr.currentReceipt.Items), models.Item{KisimID: kisimID, Quantity: quantity})); err != nil {
+		return err
+	}
+
 	if cr.verbose {
-		log.Printf("[CASH-REGISTER] Adding item: %s (₺%.2f) x%d", kisimInfo.Name, unitPrice, quantity)
+		if weighed {
+			log.Printf("[CASH-REGISTER] Adding item: %s (₺%.2f/kg) %dg", kisimInfo.Name, unitPrice, quantity)
+		} else {
+			log.Printf("[CASH-REGISTER] Adding item: %s (₺%.2f) x%d", kisimInfo.Name, unitPrice, quantity)
+		}
 	}
 
-	// Check if this kisim already exists in the receipt (same ID and same unit price)
+	// Check if this kisim already exists in the receipt (same ID, unit price and note).
+	// Every weighing gets its own line.
 	for i, item := range cr.currentReceipt.Items {
-		if item.KisimID == kisimID && item.UnitPrice == unitPrice {
+		if !weighed && item.KisimID == kisimID && item.UnitPrice == unitPrice && item.Note == note {
+			if err := limits.checkLine(item.Quantity+quantity, unitPrice, false); err != nil {
+				return err
+			}
+			if err := limits.checkTotal(cr.currentReceipt, unitPrice*float64(quantity)); err != nil {
+				return err
+			}
+
 			// Increment quantity of existing item with same price
 			cr.currentReceipt.Items[i].Quantity += quantity
-			cr.currentReceipt.Items[i].TotalPrice = cr.currentReceipt.Items[i].UnitPrice * float64(cr.currentReceipt.Items[i].Quantity)
+			cr.currentReceipt.Items[i].TotalPrice = models.LineTotal(cr.currentReceipt.Items[i].Quantity, cr.currentReceipt.Items[i].UnitPrice, false)
 			if cr.verbose {
 				log.Printf("[CASH-REGISTER] Incremented %s quantity to %d", kisimInfo.Name, cr.currentReceipt.Items[i].Quantity)
 			}
+			cr.recordItemAdded(i, models.Item{KisimID: kisimID, Quantity: quantity, UnitPrice: unitPrice}, kisimInfo.PresetPrice)
+			cr.hooks.ItemAdded(cr.currentReceipt, cr.currentReceipt.Items[i])
+			cr.publishItem(cr.currentReceipt, cr.currentReceipt.Items[i])
 			return nil
 		}
 	}
 
 	// Add new item if not found (different kisim or different price = new line)
-	totalPrice := unitPrice * float64(quantity)
+	if len(cr.currentReceipt.Items) >= limits.MaxItems {
+		return &LimitError{Limit: LimitItems, Max: float64(limits.MaxItems), Value: float64(len(cr.currentReceipt.Items) + 1)}
+	}
+	totalPrice := models.LineTotal(quantity, unitPrice, weighed)
+	if err := limits.checkTotal(cr.currentReceipt, totalPrice); err != nil {
+		return err
+	}
 	newItem := models.Item{
 		KisimID:    kisimID,
 		KisimName:  kisimInfo.Name,
 		UnitPrice:  unitPrice,
 		Quantity:   quantity,
 		TotalPrice: totalPrice,
-		TaxRate:    kisimInfo.TaxRate,
+		TaxRate:    kisimInfo.TaxRateAt(time.Now()),
+		Weighed:    weighed,
+		Note:       note,
 	}
 
 	cr.currentReceipt.Items = append(cr.currentReceipt.Items, newItem)
 	if cr.verbose {
 		log.Printf("[CASH-REGISTER] Added new item: %s x%d @ ₺%.2f", kisimInfo.Name, quantity, unitPrice)
 	}
+	cr.recordItemAdded(len(cr.currentReceipt.Items)-1, newItem, kisimInfo.PresetPrice)
+	cr.hooks.ItemAdded(cr.currentReceipt, newItem)
+	cr.publishItem(cr.currentReceipt, newItem)
+	return nil
+}
+
+// RemoveItem voids the line at index (0-based) of the current receipt
+func (cr *CashRegister) RemoveItem(index int) error {
+	if err := cr.beginSale(); err != nil {
+		return err
+	}
+	defer cr.endSale()
+
+	if cr.currentReceipt == nil {
+		return fmt.Errorf("no active receipt - call StartNewReceipt first")
+	}
+	if index < 0 || index >= len(cr.currentReceipt.Items) {
+		return fmt.Errorf("%w: no line %d on the receipt", ErrNoSuchLine, index)
+	}
+
+	item := cr.currentReceipt.Items[index]
+	cr.currentReceipt.Items = append(cr.currentReceipt.Items[:index], cr.currentReceipt.Items[index+1:]...)
+
+	if cr.verbose {
+		log.Printf("[CASH-REGISTER] Removed item: %s x%d @ ₺%.2f", item.KisimName, item.Quantity, item.UnitPrice)
+	}
+	cr.record(audit.EventItemRemoved, "", itemDetails(index, item))
 	return nil
 }
 
 // SetPaymentMethod sets the payment method for the current receipt
 func (cr *CashRegister) SetPaymentMethod(method string) error {
+	if err := cr.beginSale(); err != nil {
+		return err
+	}
+	defer cr.endSale()
+
 	if cr.currentReceipt == nil {
 		return fmt.Errorf("no active receipt - call StartNewReceipt first")
 	}
@@ -130,11 +502,19 @@ func (cr *CashRegister) SetPaymentMethod(method string) error {
 	}
 
 	cr.currentReceipt.PaymentMethod = method
+	cr.applySurcharges(cr.currentReceipt)
+	cr.record(audit.EventPaymentSet, "", map[string]string{"payment_method": method})
+	cr.publish(events.TypePaymentSet, cr.currentReceipt)
 	return nil
 }
 
 // FinalizeCurrentReceipt completes the current receipt and returns it
 func (cr *CashRegister) FinalizeCurrentReceipt() (*models.Receipt, error) {
+	if err := cr.beginSale(); err != nil {
+		return nil, err
+	}
+	defer cr.endSale()
+
 	if cr.currentReceipt == nil {
 		return nil, fmt.Errorf("no active receipt - call StartNewReceipt first")
 	}
@@ -146,18 +526,17 @@ func (cr *CashRegister) FinalizeCurrentReceipt() (*models.Receipt, error) {
 	if len(cr.currentReceipt.Items) == 0 {
 		return nil, fmt.Errorf("cannot finalize receipt with no items")
 	}
+	if err := cr.Limits().checkReceipt(cr.currentReceipt); err != nil {
+		return nil, err
+	}
 
-	// Add metadata to the receipt
-	cr.currentReceipt.ZReportNumber = fmt.Sprintf("Z%04d", cr.zReportCounter)
-	cr.currentReceipt.TransactionID = fmt.Sprintf("TX%s%04d", time.Now().Format("20060102"), cr.receiptCounter)
-	cr.currentReceipt.Timestamp = time.Now()
-	cr.currentReceipt.StoreVKN = cr.storeInfo.VKN
-	cr.currentReceipt.StoreName = cr.storeInfo.Name
-	cr.currentReceipt.StoreAddress = cr.storeInfo.Address
-	cr.currentReceipt.ReceiptSerial = fmt.Sprintf("F%04d", cr.receiptCounter)
+	if err := cr.finalize(cr.currentReceipt); err != nil {
+		return nil, err
+	}
 
-	// Calculate totals
-	cr.calculateTotals(cr.currentReceipt)
+	if err := cr.hooks.Finalize(cr.currentReceipt); err != nil {
+		return nil, err
+	}
 
 	cr.receiptCounter++
 
@@ -173,62 +552,202 @@ func (cr *CashRegister) FinalizeCurrentReceipt() (*models.Receipt, error) {
 	return finalizedReceipt, nil
 }
 
-// CancelCurrentReceipt cancels the current receipt
-func (cr *CashRegister) CancelCurrentReceipt() {
-	if cr.verbose && cr.currentReceipt != nil {
-		log.Printf("[CASH-REGISTER] Canceling current receipt")
+// finalize adds the store, serial and Z-report metadata to a receipt, calculates its
+// totals, locks in the exchange rate and rounds the amount due. It takes the serial
+// from the receipt counter without consuming it; the caller does that once it issues.
+func (cr *CashRegister) finalize(receipt *models.Receipt) error {
+	now := time.Now()
+	receipt.ZReportNumber = cr.currentZReportNumber()
+	receipt.TransactionID = fmt.Sprintf("TX%s%04d", now.Format("20060102"), cr.receiptCounter)
+	receipt.Timestamp = now
+	receipt.StoreVKN = cr.storeInfo.VKN
+	receipt.StoreName = cr.storeInfo.Name
+	receipt.StoreAddress = cr.storeInfo.Address
+	receipt.ReceiptSerial = fmt.Sprintf("F%04d", cr.receiptCounter)
+	if catalog, ok := cr.kisimLookup.(interface{ Version() string }); ok {
+		receipt.CatalogVersion = catalog.Version()
 	}
-	cr.currentReceipt = nil
+	cr.applyTaxRates(receipt)
+
+	cr.applySurcharges(receipt)
+	cr.calculateTotals(receipt)
+	if err := cr.convertCurrency(receipt); err != nil {
+		return err
+	}
+	cr.applyRounding(receipt)
+	return nil
 }
 
-// HasActiveReceipt returns true if there's an active receipt
-func (cr *CashRegister) HasActiveReceipt() bool {
-	return cr.currentReceipt != nil
+// CancelCurrentReceipt cancels the current receipt
+func (cr *CashRegister) CancelCurrentReceipt() error {
+	if err := cr.beginSale(); err != nil {
+		return err
+	}
+	defer cr.endSale()
+
+	if cr.currentReceipt != nil {
+		if cr.verbose {
+			log.Printf("[CASH-REGISTER] Canceling current receipt")
+		}
+		cr.record(audit.EventReceiptCancelled, cr.currentReceipt.TransactionID, map[string]string{
+			"items": strconv.Itoa(len(cr.currentReceipt.Items)),
+		})
+	}
+	cr.currentReceipt = nil
+	return nil
 }
 
-// GetCurrentReceipt returns the current receipt (for testing/debugging)
-func (cr *CashRegister) GetCurrentReceipt() *models.Receipt {
-	return cr.currentReceipt
+// applyTaxRates charges each line the rate in force at the receipt time, which changes
+// when the sale runs past a rate change. Refunds pay back the tax the sale charged.
+func (cr *CashRegister) applyTaxRates(receipt *models.Receipt) {
+	if receipt.IsRefund() {
+		return
+	}
+	for i, item := range receipt.Items {
+		kisimInfo, ok := cr.kisimLookup.GetKisimInfo(item.KisimID)
+		if !ok {
+			continue
+		}
+		if rate := kisimInfo.TaxRateAt(receipt.Timestamp); rate != item.TaxRate {
+			if cr.verbose {
+				log.Printf("[CASH-REGISTER] Tax rate of %s changed from %%%d to %%%d", item.KisimName, item.TaxRate, rate)
+			}
+			receipt.Items[i].TaxRate = rate
+		}
+	}
 }
 
 // calculateTotals calculates tax breakdown and total amount for a receipt
 // This is moved from Receipt.CalculateTotals() to keep Receipt as pure data
 func (cr *CashRegister) calculateTotals(receipt *models.Receipt) {
 	var total float64
-	var tax10Base, tax20Base float64
+	var breakdown models.TaxBreakdown
 
+	addLine := func(amount float64, taxRate int) {
+		total += amount
+
+		baseAmount := amount / (1 + float64(taxRate)/100)
+		breakdown.AddRate(taxRate, baseAmount, baseAmount*(float64(taxRate)/100))
+	}
 	for _, item := range receipt.Items {
-		total += item.TotalPrice
+		addLine(item.TotalPrice, item.TaxRate)
+	}
+	for _, surcharge := range receipt.Surcharges {
+		addLine(surcharge.Amount, surcharge.TaxRate)
+	}
 
-		baseAmount := item.TotalPrice / (1 + float64(item.TaxRate)/100)
-		switch item.TaxRate {
+	// The binary receipt's breakdown, and so its total tax, carries 10% and 20% only
+	for _, rate := range breakdown.Rates {
+		switch rate.Rate {
 		case 10:
-			tax10Base += baseAmount
+			breakdown.Tax10Percent = rate.TaxDetail
 		case 20:
-			tax20Base += baseAmount
+			breakdown.Tax20Percent = rate.TaxDetail
 		}
 	}
+	breakdown.TotalTax = breakdown.Tax10Percent.TaxAmount + breakdown.Tax20Percent.TaxAmount
 
-	receipt.TaxBreakdown.Tax10Percent = models.TaxDetail{
-		TaxableAmount: tax10Base,
-		TaxAmount:     tax10Base * 0.10,
+	receipt.TaxBreakdown = breakdown
+	receipt.TotalAmount = total
+}
+
+// convertCurrency converts the receipt total at the current rate for foreign currency sales
+func (cr *CashRegister) convertCurrency(receipt *models.Receipt) error {
+	if receipt.Currency == "" {
+		return nil
+	}
+	if cr.currency == nil {
+		return fmt.Errorf("currency %s is not accepted", receipt.Currency)
 	}
 
-	receipt.TaxBreakdown.Tax20Percent = models.TaxDetail{
-		TaxableAmount: tax20Base,
-		TaxAmount:     tax20Base * 0.20,
+	quote, err := cr.currency.Quote(receipt.TotalAmount, receipt.Currency)
+	if err != nil {
+		return err
 	}
+	receipt.ExchangeRate = quote.Rate
+	receipt.ForeignTotal = quote.Amount
 
-	receipt.TaxBreakdown.TotalTax = receipt.TaxBreakdown.Tax10Percent.TaxAmount + receipt.TaxBreakdown.Tax20Percent.TaxAmount
-	receipt.TotalAmount = total
+	if cr.verbose {
+		log.Printf("[CASH-REGISTER] Converted ₺%.2f to %s at %.6f",
+			receipt.TotalAmount, cr.currency.Format(quote.Amount, quote.Code), quote.Rate)
+	}
+	return nil
+}
+
+// SetRounding rounds the amount due for payment methods with a rule in policy
+func (cr *CashRegister) SetRounding(policy *rounding.Policy) {
+	cr.rounding = policy
+}
+
+// SetSurcharges charges the fees in policy for payment methods with rules
+func (cr *CashRegister) SetSurcharges(policy *surcharge.Policy) {
+	cr.surcharges = policy
+}
+
+// applySurcharges sets the surcharge lines for the receipt's payment method on its
+// current items. Refunds pay back lines only and carry no surcharges.
+func (cr *CashRegister) applySurcharges(receipt *models.Receipt) {
+	receipt.Surcharges = nil
+	if cr.surcharges == nil || receipt.IsRefund() {
+		return
+	}
+
+	var itemsTotal float64
+	for _, item := range receipt.Items {
+		itemsTotal += item.TotalPrice
+	}
+	receipt.Surcharges = cr.surcharges.Apply(itemsTotal, receipt.PaymentMethod)
+
+	if cr.verbose {
+		for _, s := range receipt.Surcharges {
+			log.Printf("[CASH-REGISTER] %s surcharge %s: ₺%.2f", receipt.PaymentMethod, s.Name, s.Amount)
+		}
+	}
+}
+
+// applyRounding sets the amount due when the payment method has a rounding rule.
+// Foreign currency sales are paid in the foreign total and are not rounded.
+func (cr *CashRegister) applyRounding(receipt *models.Receipt) {
+	receipt.Rounding, receipt.AmountDue = 0, 0
+	if cr.rounding == nil || receipt.Currency != "" {
+		return
+	}
+
+	due, ok := cr.rounding.Round(receipt.TotalAmount, receipt.PaymentMethod)
+	if !ok {
+		return
+	}
+	receipt.AmountDue = due
+	receipt.Rounding = math.Round((due-receipt.TotalAmount)*100) / 100
+
+	if cr.verbose && receipt.Rounding != 0 {
+		log.Printf("[CASH-REGISTER] Rounded %s payment of ₺%.2f to ₺%.2f",
+			receipt.PaymentMethod, receipt.TotalAmount, receipt.AmountDue)
+	}
 }
 
 // IssueCurrentReceipt finalizes and issues the current receipt in one atomic operation
 func (cr *CashRegister) IssueCurrentReceipt(userEphemeralKeyCompressed []byte) (*models.Receipt, error) {
+	return cr.IssueCurrentReceiptTo(userEphemeralKeyCompressed, nil)
+}
+
+// IssueCurrentReceiptTo issues the current receipt to the wallet's ephemeral key and/or
+// sends it to recipient by email or SMS. Without a key the receipt is signed but not
+// submitted to the receipt bank.
+func (cr *CashRegister) IssueCurrentReceiptTo(userEphemeralKeyCompressed []byte, recipient *models.Recipient) (*models.Receipt, error) {
+	if err := cr.beginSale(); err != nil {
+		return nil, err
+	}
+	defer cr.endSale()
+
 	if cr.currentReceipt == nil {
 		return nil, fmt.Errorf("no active receipt - call StartNewReceipt first")
 	}
 
+	if err := cr.checkDestination(userEphemeralKeyCompressed, recipient); err != nil {
+		return nil, err
+	}
+
 	if cr.verbose {
 		log.Printf("[CASH-REGISTER] Issuing receipt with %d items", len(cr.currentReceipt.Items))
 	}
@@ -237,31 +756,141 @@ func (cr *CashRegister) IssueCurrentReceipt(userEphemeralKeyCompressed []byte) (
 		return nil, fmt.Errorf("cannot issue receipt with no items")
 	}
 
-	// Step 1: Finalize receipt with metadata and calculations
-	cr.currentReceipt.ZReportNumber = fmt.Sprintf("Z%04d", cr.zReportCounter)
-	cr.currentReceipt.TransactionID = fmt.Sprintf("TX%s%04d", time.Now().Format("20060102"), cr.receiptCounter)
-	cr.currentReceipt.Timestamp = time.Now()
-	cr.currentReceipt.StoreVKN = cr.storeInfo.VKN
-	cr.currentReceipt.StoreName = cr.storeInfo.Name
-	cr.currentReceipt.StoreAddress = cr.storeInfo.Address
-	cr.currentReceipt.ReceiptSerial = fmt.Sprintf("F%04d", cr.receiptCounter)
+	// Re-check the whole receipt: the policy may have changed since the items were added
+	if err := cr.Limits().checkReceipt(cr.currentReceipt); err != nil {
+		return nil, err
+	}
+	// Stock may have been counted or written off since the items were added; refunds
+	// bring goods back instead
+	if !cr.currentReceipt.IsRefund() {
+		if err := cr.checkStock(cr.currentReceipt.Items); err != nil {
+			return nil, err
+		}
+	}
 
-	// Calculate totals
-	cr.calculateTotals(cr.currentReceipt)
-	cr.receiptCounter++
+	// Step 1: Finalize a copy with metadata and calculations. The signing and submission
+	// calls run without saleMu, so reads show the open sale meanwhile; the serial is only
+	// consumed, and the sale only closed, once the receipt is issued.
+	receipt := copyReceipt(cr.currentReceipt)
+	if err := cr.finalize(receipt); err != nil {
+		return nil, err
+	}
 
 	if cr.verbose {
 		log.Printf("[CASH-REGISTER] Finalized receipt %s with total ₺%.2f",
-			cr.currentReceipt.TransactionID, cr.currentReceipt.TotalAmount)
+			receipt.TransactionID, receipt.TotalAmount)
+	}
+
+	var signedReceipt []byte
+	var err error
+	cr.withoutSaleMu(func() {
+		signedReceipt, err = cr.issueFinalizedReceipt(receipt, userEphemeralKeyCompressed, recipient)
+	})
+	var veto *hooks.VetoError
+	if errors.As(err, &veto) {
+		cr.record(audit.EventIssueVetoed, receipt.TransactionID, map[string]string{
+			"receipt_serial": receipt.ReceiptSerial,
+			"hook":           veto.Hook,
+			"reason":         veto.Err.Error(),
+		})
+		cr.issueFailedFeedback()
+		cr.publishVeto(receipt, veto)
+		return nil, err
+	}
+	if err != nil {
+		cr.record(audit.EventIssueFailed, receipt.TransactionID, map[string]string{
+			"receipt_serial": receipt.ReceiptSerial,
+			"error":          err.Error(),
+		})
+		cr.hooks.IssueFailed(receipt, err)
+		cr.issueFailedFeedback()
+		cr.publishFailure(receipt, err)
+		return nil, err
+	}
+
+	details := map[string]string{
+		"receipt_serial":  receipt.ReceiptSerial,
+		"z_report_number": receipt.ZReportNumber,
+		"items":           strconv.Itoa(len(receipt.Items)),
+		"total":           formatAmount(receipt.TotalAmount),
+		"payment_method":  receipt.PaymentMethod,
+	}
+	if receipt.Rounding != 0 {
+		details["rounding"] = formatAmount(receipt.Rounding)
+	}
+	if len(receipt.Surcharges) > 0 {
+		var surcharges float64
+		for _, s := range receipt.Surcharges {
+			surcharges += s.Amount
+		}
+		details["surcharges"] = formatAmount(surcharges)
+	}
+	if receipt.CatalogVersion != "" {
+		details["catalog_version"] = receipt.CatalogVersion
+	}
+	if original := receipt.RefundOf; original != nil {
+		details["refund_of"] = original.TransactionID
+		details["refund_of_serial"] = original.ReceiptSerial
+	}
+	cr.record(audit.EventReceiptIssued, receipt.TransactionID, details)
+	cr.hooks.Issued(receipt)
+	cr.openDrawerFor(receipt)
+	cr.publish(events.TypeIssued, receipt)
+	if cr.stock != nil {
+		if receipt.IsRefund() {
+			cr.stock.Return(receipt)
+		} else {
+			cr.stock.Sell(receipt)
+		}
 	}
 
-	// Step 2: Validate receipt
-	if err := cr.validateReceipt(cr.currentReceipt); err != nil {
+	if recipient != nil {
+		cr.deliver(receipt, signedReceipt, *recipient)
+	}
+
+	// Step 9: Consume the serial, clear current state and return the issued receipt
+	cr.receiptCounter++
+	cr.currentReceipt = nil
+	return receipt, nil
+}
+
+// issueFinalizedReceipt runs the signing and delivery pipeline for a finalized receipt
+// and returns the signed binary receipt
+func (cr *CashRegister) issueFinalizedReceipt(receipt *models.Receipt, userEphemeralKeyCompressed []byte, recipient *models.Recipient) ([]byte, error) {
+	// Step 2: Validate receipt and let hooks veto it
+	if err := cr.validateReceipt(receipt); err != nil {
 		return nil, fmt.Errorf("receipt validation failed: %v", err)
 	}
 
+	if err := cr.hooks.Finalize(receipt); err != nil {
+		return nil, err
+	}
+
+	// Refuse before signing when the bank or its wallets can't take this format
+	if checker, ok := cr.receiptBank.(interfaces.FormatChecker); ok {
+		if err := checker.CheckFormat(cr.formatVersion); err != nil {
+			return nil, err
+		}
+	}
+
 	// Step 3: Serialize receipt to binary format
-	binaryReceipt, err := binary.SerializeReceipt(cr.currentReceipt)
+	var flags uint8 = binary.Reserved
+	if cr.timestampTokens {
+		flags |= binary.FlagTimestampToken
+	}
+	if cr.compress {
+		flags |= binary.FlagCompressed
+	}
+	if cr.deviceKey != nil {
+		deviceKey, err := rwcrypto.CompressKey(&cr.deviceKey.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid device key: %v", err)
+		}
+		receipt.DeviceKey = deviceKey
+	}
+	done := cr.timings.Start(timing.StepSerialize)
+	binaryReceipt, err := binary.SerializeReceiptVersion(receipt, cr.formatVersion, flags)
+	done(err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize receipt: %v", err)
 	}
@@ -271,58 +900,130 @@ func (cr *CashRegister) IssueCurrentReceipt(userEphemeralKeyCompressed []byte) (
 	}
 
 	// Step 4: Generate hash of binary receipt
+	done = cr.timings.Start(timing.StepHash)
 	binaryHash := cr.cryptoService.GenerateReceiptHash(binaryReceipt)
+	done(nil)
 	hashBase64 := base64.StdEncoding.EncodeToString(binaryHash)
 
 	if cr.verbose {
 		log.Printf("[CASH-REGISTER] Generated receipt hash: %s", hashBase64[:16]+"...")
 	}
 
-	// Step 5: Get signature from revenue authority
-	binarySignature, err := cr.revenueAuthority.SignHash(binaryHash)
+	// Step 5: Get signature (and optional timestamp token) from revenue authority
+	var binarySignature, timestampToken []byte
+	done = cr.timings.Start(timing.StepSign)
+	if cr.strictSigning {
+		signer, ok := cr.revenueAuthority.(interfaces.ReceiptSigner)
+		if !ok {
+			return nil, fmt.Errorf("revenue authority does not support strict signing")
+		}
+		binarySignature, timestampToken, err = signer.SignReceipt(binaryReceipt, cr.timestampTokens)
+	} else if cr.timestampTokens {
+		binarySignature, timestampToken, err = cr.revenueAuthority.SignHashWithTimestamp(binaryHash)
+	} else {
+		binarySignature, err = cr.revenueAuthority.SignHash(binaryHash)
+	}
+	done(err)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get signature from revenue authority: %v", err)
+		cr.recordExternalFailure("revenue_authority", receipt, err)
+		return nil, fmt.Errorf("failed to get signature from revenue authority: %w", err)
 	}
 
 	if cr.verbose {
 		log.Printf("[CASH-REGISTER] Received signature from revenue authority")
 	}
 
-	// Step 6: Create signed receipt (binary receipt + signature)
-	binarySignedReceipt, err := binary.CreateSignedReceipt(binaryReceipt, binarySignature)
+	// Step 6: Create signed receipt (binary receipt + signature [+ device signature])
+	var binarySignedReceipt []byte
+	if cr.deviceKey != nil {
+		deviceSignature, err := rwcrypto.Sign(cr.deviceKey, binaryHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign receipt with device key: %v", err)
+		}
+		binarySignedReceipt, err = binary.CreateDeviceSignedReceipt(binaryReceipt, binarySignature, deviceSignature)
+	} else {
+		binarySignedReceipt, err = binary.CreateSignedReceipt(binaryReceipt, binarySignature)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create signed receipt: %v", err)
 	}
 
+	if timestampToken != nil {
+		binarySignedReceipt, err = binary.AppendTimestampToken(binarySignedReceipt, timestampToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to attach timestamp token: %v", err)
+		}
+	}
+
 	if cr.verbose {
 		log.Printf("[CASH-REGISTER] Created signed receipt: %d bytes", len(binarySignedReceipt))
 	}
 
-	// Step 7: Encrypt signed receipt with user's ephemeral key (privacy-preserving)
-	binaryEncrypted, err := cr.cryptoService.EncryptWithUserEphemeralKey(binarySignedReceipt, userEphemeralKeyCompressed)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt receipt data: %v", err)
-	}
+	// Steps 7-8 reach the customer's wallet; receipts only sent by email or SMS skip them
+	if userEphemeralKeyCompressed != nil {
+		// Step 7: Encrypt signed receipt with user's ephemeral key (privacy-preserving)
+		done = cr.timings.Start(timing.StepEncrypt)
+		binaryEncrypted, err := cr.cryptoService.EncryptWithUserEphemeralKey(binarySignedReceipt, userEphemeralKeyCompressed)
+		done(err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt receipt data: %v", err)
+		}
 
-	if cr.verbose {
-		log.Printf("[CASH-REGISTER] Privacy-preserving encryption completed")
+		if cr.verbose {
+			log.Printf("[CASH-REGISTER] Privacy-preserving encryption completed")
+		}
+
+		// Step 8: Submit to receipt bank using user's ephemeral key as index
+		var attestHash, attestSignature []byte
+		if cr.attestSubmissions {
+			attestHash, attestSignature = binaryHash, binarySignature
+		}
+		receiptID := submissionID(receipt)
+		tracker, tracked := cr.receiptBank.(interfaces.TrackedSubmitter)
+		done = cr.timings.Start(timing.StepSubmit)
+		switch {
+		case tracked:
+			err = tracker.SubmitTrackedReceipt(receiptID, userEphemeralKeyCompressed, binaryEncrypted, attestHash, attestSignature)
+		case cr.attestSubmissions:
+			submitter, ok := cr.receiptBank.(interfaces.AttestedSubmitter)
+			if !ok {
+				return nil, fmt.Errorf("receipt bank does not support attested submissions")
+			}
+			err = submitter.SubmitAttestedReceipt(userEphemeralKeyCompressed, binaryEncrypted, binaryHash, binarySignature)
+		default:
+			err = cr.receiptBank.SubmitReceipt(userEphemeralKeyCompressed, binaryEncrypted)
+		}
+		done(err)
+		if err != nil {
+			cr.recordExternalFailure("receipt_bank", receipt, err)
+			return nil, fmt.Errorf("failed to submit to receipt bank: %w", err)
+		}
+
+		if cr.verbose {
+			log.Printf("[CASH-REGISTER] Successfully submitted to receipt bank (user anonymous)")
+		}
+
+		// Wait for the bank's collection webhook; the sweeper expires it otherwise
+		if tracked {
+			cr.txManager.AddPendingTransaction(receiptID, receipt)
+		}
 	}
 
-	// Step 8: Submit to receipt bank using user's ephemeral key as index
-	err = cr.receiptBank.SubmitReceipt(userEphemeralKeyCompressed, binaryEncrypted)
-	if err != nil {
-		return nil, fmt.Errorf("failed to submit to receipt bank: %v", err)
+	if recipient != nil {
+		receipt.Delivery = pendingDelivery(*recipient)
 	}
 
-	if cr.verbose {
-		log.Printf("[CASH-REGISTER] Successfully submitted to receipt bank (user anonymous)")
+	// Record in history - the receipt is already issued, so failures are only logged.
+	// The signed receipt is kept so the sale can be refunded by serial.
+	if cr.history != nil {
+		if err := cr.history.AddSigned(receipt, binarySignedReceipt); err != nil {
+			log.Printf("[CASH-REGISTER] Failed to record receipt in history: %v", err)
+		}
 	}
 
-	// Step 9: Return finalized receipt and clear current state
-	finalizedReceipt := cr.currentReceipt
-	cr.currentReceipt = nil
+	cr.recordInZReport(receipt)
 
-	return finalizedReceipt, nil
+	return binarySignedReceipt, nil
 }
 
 // validateReceipt ensures the receipt is complete and valid before issuing
@@ -342,6 +1043,14 @@ func (cr *CashRegister) validateReceipt(receipt *models.Receipt) error {
 	return nil
 }
 
+// submissionID is the receipt ID sent to the receipt bank: the transaction ID, made unique
+// across registers and restarts (the bank refuses duplicate IDs)
+func submissionID(receipt *models.Receipt) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return receipt.TransactionID + "-" + hex.EncodeToString(suffix)
+}
+
 // ConfirmTransaction is called by webhook handler when wallet downloads receipt
 func (cr *CashRegister) ConfirmTransaction(receiptID string) bool {
 	if cr.txManager == nil {
@@ -0,0 +1,98 @@
+package cashregister
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"fake-cash-register/internal/audit"
+	"fake-cash-register/internal/delivery"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/models"
+)
+
+var (
+	// ErrNoDestination is returned when a receipt has neither a wallet key nor a delivery recipient
+	ErrNoDestination = errors.New("receipt needs a wallet ephemeral key or a delivery recipient")
+	// ErrDeliveryUnavailable is returned when the requested delivery channel is not configured
+	ErrDeliveryUnavailable = errors.New("receipt delivery channel is not available")
+)
+
+// SetDelivery enables email/SMS delivery for customers without the wallet app
+func (cr *CashRegister) SetDelivery(deliverer interfaces.ReceiptDeliverer) {
+	cr.delivery = deliverer
+}
+
+// Delivery returns the receipt deliverer (nil if delivery is disabled)
+func (cr *CashRegister) Delivery() interfaces.ReceiptDeliverer {
+	return cr.delivery
+}
+
+// checkDestination makes sure an issued receipt can reach the customer
+func (cr *CashRegister) checkDestination(userEphemeralKeyCompressed []byte, recipient *models.Recipient) error {
+	if recipient == nil {
+		if userEphemeralKeyCompressed == nil {
+			return ErrNoDestination
+		}
+		return nil
+	}
+	if cr.delivery == nil || !cr.delivery.Supports(recipient.Channel) {
+		return fmt.Errorf("%w: %s", ErrDeliveryUnavailable, recipient.Channel)
+	}
+	return nil
+}
+
+// pendingDelivery is the delivery status recorded with a receipt when it is issued
+func pendingDelivery(recipient models.Recipient) *models.Delivery {
+	return &models.Delivery{
+		Channel:   recipient.Channel,
+		Recipient: delivery.Mask(recipient),
+		Status:    models.DeliveryPending,
+		UpdatedAt: time.Now().UTC(),
+	}
+}
+
+// deliver sends an issued receipt in the background: the sale is complete once signed,
+// so a slow mail server must not hold up the register. The outcome is recorded in the
+// history and the audit trail.
+func (cr *CashRegister) deliver(receipt *models.Receipt, signedReceipt []byte, recipient models.Recipient) {
+	status := *receipt.Delivery
+	snapshot := *receipt
+
+	cr.deliveries.Add(1)
+	go func() {
+		defer cr.deliveries.Done()
+
+		eventType := audit.EventReceiptDelivered
+		status.Status = models.DeliverySent
+		if err := cr.delivery.Deliver(&snapshot, signedReceipt, recipient); err != nil {
+			log.Printf("[CASH-REGISTER] Failed to deliver receipt %s by %s: %v", snapshot.ReceiptSerial, recipient.Channel, err)
+			eventType = audit.EventDeliveryFailed
+			status.Status = models.DeliveryFailed
+			status.Error = err.Error()
+		}
+		status.UpdatedAt = time.Now().UTC()
+
+		details := map[string]string{
+			"receipt_serial": snapshot.ReceiptSerial,
+			"channel":        status.Channel,
+			"recipient":      status.Recipient,
+		}
+		if status.Error != "" {
+			details["error"] = status.Error
+		}
+		cr.record(eventType, snapshot.TransactionID, details)
+
+		if cr.history != nil {
+			if err := cr.history.UpdateDelivery(snapshot.TransactionID, status); err != nil {
+				log.Printf("[CASH-REGISTER] Failed to record delivery status: %v", err)
+			}
+		}
+	}()
+}
+
+// WaitForDeliveries blocks until background deliveries have finished
+func (cr *CashRegister) WaitForDeliveries() {
+	cr.deliveries.Wait()
+}
@@ -0,0 +1,92 @@
+package cashregister
+
+import (
+	"log"
+	"slices"
+
+	"fake-cash-register/internal/audit"
+	"fake-cash-register/internal/devices"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/models"
+)
+
+// DevicePolicy says when the register opens the cash drawer and beeps
+type DevicePolicy struct {
+	DrawerPaymentMethods []string // Issued receipts paid this way open the drawer
+	BeepOnItem           bool
+	BeepOnError          bool // Refused items and failed issues
+}
+
+// SetDevices connects the cash drawer and beeper, used as policy says
+func (cr *CashRegister) SetDevices(controller interfaces.DeviceController, policy DevicePolicy) {
+	cr.devices = controller
+	cr.devicePolicy = policy
+}
+
+// Devices returns the drawer and beeper controller (nil if none is connected)
+func (cr *CashRegister) Devices() interfaces.DeviceController {
+	return cr.devices
+}
+
+// WaitForDevices blocks until pending drawer and beeper commands have finished
+func (cr *CashRegister) WaitForDevices() {
+	cr.deviceOps.Wait()
+}
+
+// itemFeedback beeps for an item that was added, or refused with err
+func (cr *CashRegister) itemFeedback(err error) {
+	switch {
+	case err != nil && cr.devicePolicy.BeepOnError:
+		cr.beep(devices.BeepError)
+	case err == nil && cr.devicePolicy.BeepOnItem:
+		cr.beep(devices.BeepItem)
+	}
+}
+
+// issueFailedFeedback beeps when a receipt could not be issued
+func (cr *CashRegister) issueFailedFeedback() {
+	if cr.devicePolicy.BeepOnError {
+		cr.beep(devices.BeepError)
+	}
+}
+
+// beep sounds signal in the background; a beeper fault never holds up a sale
+func (cr *CashRegister) beep(signal string) {
+	if cr.devices == nil {
+		return
+	}
+	cr.deviceOps.Add(1)
+	go func() {
+		defer cr.deviceOps.Done()
+		if err := cr.devices.Beep(signal); err != nil {
+			log.Printf("[CASH-REGISTER] Beeper failed: %v", err)
+		}
+	}()
+}
+
+// openDrawerFor opens the cash drawer in the background when an issued receipt was
+// paid with one of the policy's payment methods. The opening is audited; a drawer that
+// fails to open is only logged, the sale stands.
+func (cr *CashRegister) openDrawerFor(receipt *models.Receipt) {
+	if cr.devices == nil || !slices.Contains(cr.devicePolicy.DrawerPaymentMethods, receipt.PaymentMethod) {
+		return
+	}
+	transactionID := receipt.TransactionID
+	details := map[string]string{
+		"receipt_serial": receipt.ReceiptSerial,
+		"payment_method": receipt.PaymentMethod,
+	}
+
+	cr.deviceOps.Add(1)
+	go func() {
+		defer cr.deviceOps.Done()
+		if err := cr.devices.OpenDrawer(); err != nil {
+			log.Printf("[CASH-REGISTER] Failed to open the cash drawer for %s: %v", transactionID, err)
+			return
+		}
+		if cr.verbose {
+			log.Printf("[CASH-REGISTER] Opened the cash drawer for %s", transactionID)
+		}
+		cr.record(audit.EventDrawerOpened, transactionID, details)
+	}()
+}
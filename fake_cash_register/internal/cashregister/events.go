@@ -0,0 +1,61 @@
+package cashregister
+
+import (
+	"fake-cash-register/internal/events"
+	"fake-cash-register/internal/hooks"
+	"fake-cash-register/internal/models"
+)
+
+// SetEvents connects the broker that streams the transaction lifecycle (GET /api/events)
+func (cr *CashRegister) SetEvents(broker *events.Broker) {
+	cr.events = broker
+}
+
+// Events returns the lifecycle event broker (nil if none is connected)
+func (cr *CashRegister) Events() *events.Broker {
+	return cr.events
+}
+
+// publish streams an event about the sale; the receipt is copied into the event, so
+// callers may keep changing it
+func (cr *CashRegister) publish(eventType string, receipt *models.Receipt) {
+	if cr.events != nil {
+		cr.events.Publish(events.FromReceipt(eventType, receipt))
+	}
+}
+
+// publishItem streams an item_added event with the line as it now stands
+func (cr *CashRegister) publishItem(receipt *models.Receipt, item models.Item) {
+	if cr.events != nil {
+		event := events.FromReceipt(events.TypeItemAdded, receipt)
+		event.Item = &item
+		cr.events.Publish(event)
+	}
+}
+
+// publishFailure streams a failed event for a receipt that could not be issued
+func (cr *CashRegister) publishFailure(receipt *models.Receipt, err error) {
+	if cr.events != nil {
+		event := events.FromReceipt(events.TypeFailed, receipt)
+		event.Error = err.Error()
+		cr.events.Publish(event)
+	}
+}
+
+// publishVeto streams a vetoed event with the hook's reason
+func (cr *CashRegister) publishVeto(receipt *models.Receipt, veto *hooks.VetoError) {
+	if cr.events != nil {
+		event := events.FromReceipt(events.TypeVetoed, receipt)
+		event.Error = veto.Error()
+		cr.events.Publish(event)
+	}
+}
+
+// publishConfirmed streams a webhook_confirmed event for a receipt the wallet collected
+func (cr *CashRegister) publishConfirmed(receiptID string) {
+	if cr.events != nil {
+		event := events.FromReceipt(events.TypeWebhookConfirmed, nil)
+		event.ReceiptID = receiptID
+		cr.events.Publish(event)
+	}
+}
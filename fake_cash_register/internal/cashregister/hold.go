@@ -0,0 +1,122 @@
+package cashregister
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"strconv"
+
+	"fake-cash-register/internal/audit"
+	"fake-cash-register/internal/events"
+	"fake-cash-register/internal/hold"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/zreport"
+)
+
+var (
+	// ErrHoldRefund is returned for holding a refund, which is tied to the original sale
+	// verified when it was opened
+	ErrHoldRefund = errors.New("refunds cannot be held - finish or cancel the refund")
+	// ErrSaleOpen is returned for recalling a held sale while another sale has items
+	ErrSaleOpen = errors.New("a sale is open - issue, hold or cancel it first")
+)
+
+// SetHolds replaces the store of held sales, e.g. with one kept in a file
+func (cr *CashRegister) SetHolds(store *hold.Store) {
+	cr.holds = store
+}
+
+// Holds returns the store of held sales
+func (cr *CashRegister) Holds() *hold.Store {
+	return cr.holds
+}
+
+// HoldCurrentReceipt parks the open sale, with its items, custom prices, payment method,
+// currency and customer, under a new hold ID, and leaves the register free for the next
+// customer. It fails with ErrEmptyReceipt for a sale without items.
+func (cr *CashRegister) HoldCurrentReceipt(label string) (*hold.Held, error) {
+	if err := cr.beginSale(); err != nil {
+		return nil, err
+	}
+	defer cr.endSale()
+
+	if cr.currentReceipt == nil {
+		return nil, ErrNoActiveReceipt
+	}
+	if cr.currentReceipt.IsRefund() {
+		return nil, ErrHoldRefund
+	}
+	if len(cr.currentReceipt.Items) == 0 {
+		return nil, ErrEmptyReceipt
+	}
+
+	held, err := cr.holds.Hold(cr.currentReceipt, label)
+	if err != nil {
+		return nil, err
+	}
+
+	if cr.verbose {
+		log.Printf("[CASH-REGISTER] Held receipt as %s", held.ID)
+	}
+	cr.record(audit.EventTransactionHeld, "", map[string]string{
+		"hold_id": held.ID,
+		"items":   strconv.Itoa(held.Items),
+		"total":   formatAmount(held.Total),
+	})
+	cr.publish(events.TypeHeld, cr.currentReceipt)
+	cr.currentReceipt = nil
+	return held, nil
+}
+
+// RecallReceipt resumes a held sale as the open sale. An open sale without items is
+// replaced; one with items fails with ErrSaleOpen. Like starting a sale, it fails with
+// zreport.ErrClosePending while a Z-report close is waiting to complete.
+func (cr *CashRegister) RecallReceipt(id string) (*models.Receipt, error) {
+	if err := cr.beginSale(); err != nil {
+		return nil, err
+	}
+	defer cr.endSale()
+
+	if cr.currentReceipt != nil && len(cr.currentReceipt.Items) > 0 {
+		return nil, ErrSaleOpen
+	}
+	if cr.ZReportClosing() {
+		return nil, zreport.ErrClosePending
+	}
+
+	held, err := cr.holds.Take(id)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := *held.Receipt
+	receipt.Items = slices.Clone(held.Receipt.Items)
+	cr.currentReceipt = &receipt
+	cr.refundOriginal = nil
+
+	if cr.verbose {
+		log.Printf("[CASH-REGISTER] Recalled %s with %d items", held.ID, len(receipt.Items))
+	}
+	cr.record(audit.EventTransactionRecalled, "", map[string]string{
+		"hold_id": held.ID,
+		"items":   strconv.Itoa(len(receipt.Items)),
+	})
+	cr.publish(events.TypeRecalled, cr.currentReceipt)
+
+	snapshot := receipt
+	snapshot.Items = slices.Clone(receipt.Items)
+	return &snapshot, nil
+}
+
+// DiscardHeld drops a held sale without recalling it
+func (cr *CashRegister) DiscardHeld(id string) (*hold.Held, error) {
+	held, err := cr.holds.Discard(id)
+	if err != nil {
+		return nil, err
+	}
+	cr.record(audit.EventHoldDiscarded, "", map[string]string{
+		"hold_id": held.ID,
+		"items":   strconv.Itoa(held.Items),
+	})
+	return held, nil
+}
@@ -0,0 +1,60 @@
+package cashregister
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"fake-cash-register/internal/audit"
+	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/taxid"
+)
+
+// ErrInvalidCustomerName is returned for a corporate customer without a usable name
+var ErrInvalidCustomerName = errors.New("customer name must be a single line of printable text")
+
+// SetCustomer makes the current receipt an invoiced sale to the business customer with
+// taxNumber (VKN or TCKN, spaces and dashes allowed) and name, who can then claim it as
+// an expense. An empty tax number makes it an anonymous sale again. Invalid numbers
+// fail with an error wrapping taxid.ErrInvalid.
+func (cr *CashRegister) SetCustomer(taxNumber, name string) error {
+	if err := cr.beginSale(); err != nil {
+		return err
+	}
+	defer cr.endSale()
+
+	if cr.currentReceipt == nil {
+		return fmt.Errorf("no active receipt - call StartNewReceipt first")
+	}
+
+	taxNumber = taxid.Normalize(taxNumber)
+	if taxNumber == "" {
+		cr.currentReceipt.Customer = nil
+		cr.record(audit.EventCustomerSet, "", map[string]string{"customer": "none"})
+		return nil
+	}
+	kind, err := taxid.Validate(taxNumber)
+	if err != nil {
+		return err
+	}
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" || len(name) > binary.MaxStringFieldLength ||
+		strings.IndexFunc(name, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+		return ErrInvalidCustomerName
+	}
+
+	if cr.verbose {
+		log.Printf("[CASH-REGISTER] Customer set: %s %s", kind, taxid.Mask(taxNumber))
+	}
+
+	cr.currentReceipt.Customer = &models.Customer{TaxNumber: taxNumber, Name: name}
+	// The audit trail keeps the kind and a masked number, like delivery keeps masked recipients
+	cr.record(audit.EventCustomerSet, "", map[string]string{
+		"kind":       kind,
+		"tax_number": taxid.Mask(taxNumber),
+	})
+	return nil
+}
@@ -0,0 +1,162 @@
+package cashregister
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/models"
+)
+
+// Limit names reported in LimitError.Limit
+const (
+	LimitQuantity  = "quantity"   // Quantity on one line
+	LimitUnitPrice = "unit_price" // Unit price of one item
+	LimitTotal     = "total"      // Receipt total
+	LimitItems     = "items"      // Lines on one receipt
+	LimitWeight    = "weight"     // Grams on one weighed line
+	LimitNote      = "note"       // Bytes in one line note
+)
+
+var (
+	// ErrLimitExceeded is wrapped by every LimitError
+	ErrLimitExceeded = errors.New("limit exceeded")
+	// ErrInvalidQuantity is returned for a zero or negative quantity
+	ErrInvalidQuantity = errors.New("quantity must be at least 1")
+	// ErrNoSuchLine is returned when removing a line the receipt does not have
+	ErrNoSuchLine = errors.New("no such receipt line")
+	// ErrNotesUnsupported is returned for a line note on a format v1 register
+	ErrNotesUnsupported = errors.New("item notes need binary receipt format v2")
+	// ErrInvalidNote is returned for a note that isn't one line of printable text
+	ErrInvalidNote = errors.New("note must be a single line of printable text")
+)
+
+// Limits is the validation policy for sales. A zero field falls back to the
+// ceiling of the binary format version the register writes.
+type Limits struct {
+	MaxQuantity     int     // Per line
+	MaxUnitPrice    float64 // Lira
+	MaxReceiptTotal float64 // Lira
+	MaxItems        int     // Lines per receipt
+	MaxWeight       int     // Grams per weighed line
+	MaxNoteLength   int     // Bytes (UTF-8) per line note
+}
+
+// LimitError reports a sale rejected by the validation policy
+type LimitError struct {
+	Limit string  // One of the Limit* names
+	Max   float64 // Largest allowed value
+	Value float64 // Value the sale would have reached
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s %s exceeds the limit of %s", e.Limit,
+		strconv.FormatFloat(e.Value, 'f', -1, 64), strconv.FormatFloat(e.Max, 'f', -1, 64))
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// SetLimits configures the sale validation policy
+func (cr *CashRegister) SetLimits(limits Limits) {
+	cr.limits = limits
+}
+
+// Limits returns the effective validation policy, format ceilings filled in.
+// The ceilings apply even when no policy is configured, so a sale can never
+// overflow a binary receipt field.
+func (cr *CashRegister) Limits() Limits {
+	format, err := binary.VersionLimits(cr.formatVersion)
+	if err != nil {
+		format, _ = binary.VersionLimits(binary.FormatVersion)
+	}
+
+	limits := cr.limits
+	if limits.MaxQuantity <= 0 || limits.MaxQuantity > format.MaxQuantity {
+		limits.MaxQuantity = format.MaxQuantity
+	}
+	if limits.MaxUnitPrice <= 0 || limits.MaxUnitPrice > format.MaxAmount {
+		limits.MaxUnitPrice = format.MaxAmount
+	}
+	if limits.MaxReceiptTotal <= 0 || limits.MaxReceiptTotal > format.MaxAmount {
+		limits.MaxReceiptTotal = format.MaxAmount
+	}
+	if limits.MaxItems <= 0 || limits.MaxItems > format.MaxItems {
+		limits.MaxItems = format.MaxItems
+	}
+	if limits.MaxWeight <= 0 || limits.MaxWeight > format.MaxQuantity {
+		limits.MaxWeight = format.MaxQuantity
+	}
+	if limits.MaxNoteLength <= 0 || limits.MaxNoteLength > format.MaxNote {
+		limits.MaxNoteLength = format.MaxNote
+	}
+	return limits
+}
+
+// checkLine validates a line that would hold quantity items (grams, when weighed) at unitPrice
+func (l Limits) checkLine(quantity int, unitPrice float64, weighed bool) error {
+	if quantity < 1 {
+		return fmt.Errorf("%w, got %d", ErrInvalidQuantity, quantity)
+	}
+	if weighed && quantity > l.MaxWeight {
+		return &LimitError{Limit: LimitWeight, Max: float64(l.MaxWeight), Value: float64(quantity)}
+	}
+	if !weighed && quantity > l.MaxQuantity {
+		return &LimitError{Limit: LimitQuantity, Max: float64(l.MaxQuantity), Value: float64(quantity)}
+	}
+	if unitPrice > l.MaxUnitPrice {
+		return &LimitError{Limit: LimitUnitPrice, Max: l.MaxUnitPrice, Value: unitPrice}
+	}
+	return nil
+}
+
+// checkNote validates a line note; MaxNoteLength is 0 when the format has no notes
+func (l Limits) checkNote(note string) error {
+	if note == "" {
+		return nil
+	}
+	if l.MaxNoteLength == 0 {
+		return ErrNotesUnsupported
+	}
+	if !utf8.ValidString(note) || strings.IndexFunc(note, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+		return ErrInvalidNote
+	}
+	if len(note) > l.MaxNoteLength {
+		return &LimitError{Limit: LimitNote, Max: float64(l.MaxNoteLength), Value: float64(len(note))}
+	}
+	return nil
+}
+
+// checkTotal validates the total receipt would reach with extra added
+func (l Limits) checkTotal(receipt *models.Receipt, extra float64) error {
+	total := extra
+	for _, item := range receipt.Items {
+		total += item.TotalPrice
+	}
+	if total > l.MaxReceiptTotal {
+		return &LimitError{Limit: LimitTotal, Max: l.MaxReceiptTotal, Value: total}
+	}
+	return nil
+}
+
+// checkReceipt validates every line plus the item count and total of receipt
+func (l Limits) checkReceipt(receipt *models.Receipt) error {
+	if len(receipt.Items) > l.MaxItems {
+		return &LimitError{Limit: LimitItems, Max: float64(l.MaxItems), Value: float64(len(receipt.Items))}
+	}
+
+	for _, item := range receipt.Items {
+		if err := l.checkLine(item.Quantity, item.UnitPrice, item.Weighed); err != nil {
+			return err
+		}
+		if err := l.checkNote(item.Note); err != nil {
+			return err
+		}
+	}
+	return l.checkTotal(receipt, 0)
+}
@@ -0,0 +1,278 @@
+package cashregister
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+
+	"fake-cash-register/internal/audit"
+	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/models"
+)
+
+var (
+	// ErrOriginalNotFound is returned when the sale to refund is not in the receipt history
+	ErrOriginalNotFound = errors.New("original receipt not found")
+	// ErrOriginalUnsigned is returned for a sale in history without its signed receipt,
+	// which has to be scanned instead
+	ErrOriginalUnsigned = errors.New("original receipt has no signed copy in history - scan the signed receipt")
+	// ErrForeignReceipt is returned for a receipt issued by another store
+	ErrForeignReceipt = errors.New("receipt was issued by another store")
+	// ErrNotRefundable is returned for a receipt that is itself a refund
+	ErrNotRefundable = errors.New("refund receipts cannot be refunded")
+	// ErrNothingToRefund is returned when every line of the sale has been refunded
+	ErrNothingToRefund = errors.New("sale has been refunded in full")
+	// ErrRefundExceeded is returned for a refund of more than is left on the original line
+	ErrRefundExceeded = errors.New("refund exceeds the original line")
+	// ErrRefundLinesOnly is returned for items added to a refund that are not on the original
+	ErrRefundLinesOnly = errors.New("refunds only take lines of the original receipt")
+	// ErrNoRefund is returned for refund operations without an open refund
+	ErrNoRefund = errors.New("no open refund - start one from the original receipt")
+	// ErrRefundsUntracked is returned for a scanned receipt when refunds are not kept in a
+	// history file, where a sale refunded before a restart could be refunded again
+	ErrRefundsUntracked = errors.New("refunds are not tracked across restarts - scanned receipts need a history file")
+	// ErrAuthorityKeyUnavailable is returned when the original can't be verified because
+	// the revenue authority's public key can't be had
+	ErrAuthorityKeyUnavailable = errors.New("revenue authority public key unavailable")
+)
+
+// RefundLine is a line of the refunded sale and how much of it is left to refund,
+// counting earlier refunds and the open one
+type RefundLine struct {
+	Line             int         `json:"line"` // Index on the original receipt
+	Item             models.Item `json:"item"`
+	Refundable       int         `json:"refundable_quantity"` // Pieces, or grams on weighed lines
+	RefundableAmount float64     `json:"refundable_amount"`
+}
+
+// Refund is an open refund: the verified original sale and its lines
+type Refund struct {
+	Original *models.Receipt `json:"original"`
+	Lines    []RefundLine    `json:"lines"`
+}
+
+// StartRefund opens a refund of the sale with serial, verifying the authority signature
+// over the signed receipt kept in history. It needs the receipt history.
+func (cr *CashRegister) StartRefund(serial string) (*Refund, error) {
+	if cr.history == nil {
+		return nil, fmt.Errorf("%w: receipt history is disabled - scan the signed receipt", ErrOriginalNotFound)
+	}
+	original, ok := cr.history.FindBySerial(serial)
+	if !ok || original.IsRefund() {
+		return nil, fmt.Errorf("%w: no sale with serial %s", ErrOriginalNotFound, serial)
+	}
+	signed, ok := cr.history.Signed(original.TransactionID)
+	if !ok {
+		return nil, ErrOriginalUnsigned
+	}
+	return cr.startRefund(signed)
+}
+
+// StartRefundFromSigned opens a refund of the sale in a signed binary receipt, as
+// scanned from the customer's wallet or received by email. The authority signature
+// must verify and the sale must be one of this store's. The refund is paid back with
+// the original payment method and names the original customer; only lines of the
+// original can be added, with AddRefundItem.
+//
+// Earlier refunds of the sale are counted from history, so a scanned receipt is refused
+// with ErrRefundsUntracked unless history is kept in a file.
+func (cr *CashRegister) StartRefundFromSigned(signedReceipt []byte) (*Refund, error) {
+	if cr.history == nil || !cr.history.Durable() {
+		return nil, ErrRefundsUntracked
+	}
+	return cr.startRefund(signedReceipt)
+}
+
+// startRefund verifies signedReceipt and opens a refund of its sale
+func (cr *CashRegister) startRefund(signedReceipt []byte) (*Refund, error) {
+	authorityKey, err := cr.revenueAuthority.GetPublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAuthorityKeyUnavailable, err)
+	}
+	_, original, err := binary.VerifySignedReceipt(signedReceipt, authorityKey)
+	if err != nil {
+		return nil, err
+	}
+	if original.StoreVKN != cr.storeInfo.VKN {
+		return nil, fmt.Errorf("%w: VKN %s", ErrForeignReceipt, original.StoreVKN)
+	}
+	if original.IsRefund() {
+		return nil, ErrNotRefundable
+	}
+	for i := range original.Items {
+		if kisim, ok := cr.kisimLookup.GetKisimInfo(original.Items[i].KisimID); ok {
+			original.Items[i].KisimName = kisim.Name
+		}
+	}
+
+	if err := cr.beginSale(); err != nil {
+		return nil, err
+	}
+	defer cr.endSale()
+
+	lines := cr.refundLines(original, nil)
+	if !anyRefundable(lines) {
+		return nil, ErrNothingToRefund
+	}
+	if err := cr.startReceipt(); err != nil {
+		return nil, err
+	}
+	cr.refundOriginal = original
+	cr.currentReceipt.RefundOf = &models.ReceiptRef{
+		TransactionID: original.TransactionID,
+		ReceiptSerial: original.ReceiptSerial,
+		Timestamp:     original.Timestamp,
+	}
+	cr.currentReceipt.PaymentMethod = original.PaymentMethod
+	cr.currentReceipt.Customer = original.Customer
+
+	if cr.verbose {
+		log.Printf("[CASH-REGISTER] Refund of %s (%s, ₺%.2f) started", original.ReceiptSerial, original.TransactionID, original.TotalAmount)
+	}
+	cr.record(audit.EventRefundStarted, "", map[string]string{
+		"original_transaction_id": original.TransactionID,
+		"original_serial":         original.ReceiptSerial,
+		"original_total":          formatAmount(original.TotalAmount),
+	})
+	return &Refund{Original: original, Lines: lines}, nil
+}
+
+// AddRefundItem refunds quantity (grams on weighed lines) of line (0-based) of the
+// original sale. It fails with ErrRefundExceeded beyond what earlier refunds and the
+// open one have left on the line. Refunding what is left of a line refunds exactly the
+// rest of its amount, so partial refunds of weighed lines never add up to more.
+func (cr *CashRegister) AddRefundItem(line, quantity int) (err error) {
+	defer func() { cr.itemFeedback(err) }()
+	if err := cr.beginSale(); err != nil {
+		return err
+	}
+	defer cr.endSale()
+
+	if cr.currentReceipt == nil || !cr.currentReceipt.IsRefund() {
+		return ErrNoRefund
+	}
+	original := cr.refundOriginal
+	if line < 0 || line >= len(original.Items) {
+		return fmt.Errorf("%w: no line %d on the original receipt", ErrNoSuchLine, line)
+	}
+	if quantity <= 0 {
+		return ErrInvalidQuantity
+	}
+
+	left := cr.refundLines(original, cr.currentReceipt.Items)[line]
+	if quantity > left.Refundable {
+		return fmt.Errorf("%w: %d requested, %d left on line %d", ErrRefundExceeded, quantity, left.Refundable, line)
+	}
+
+	item := original.Items[line]
+	item.Quantity = quantity
+	item.TotalPrice = left.RefundableAmount
+	if quantity < left.Refundable {
+		item.TotalPrice = math.Min(models.LineTotal(quantity, item.UnitPrice, item.Weighed), left.RefundableAmount)
+	}
+	if err := cr.Limits().checkTotal(cr.currentReceipt, item.TotalPrice); err != nil {
+		return err
+	}
+
+	// Join a line refunded earlier in this refund, like sales do; weighed lines stay apart
+	index := -1
+	for i, refunded := range cr.currentReceipt.Items {
+		if !item.Weighed && sameLine(refunded, item) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		cr.currentReceipt.Items = append(cr.currentReceipt.Items, item)
+		index = len(cr.currentReceipt.Items) - 1
+	} else {
+		cr.currentReceipt.Items[index].Quantity += item.Quantity
+		cr.currentReceipt.Items[index].TotalPrice = roundKurus(cr.currentReceipt.Items[index].TotalPrice + item.TotalPrice)
+	}
+
+	if cr.verbose {
+		log.Printf("[CASH-REGISTER] Refunding %s x%d (₺%.2f) from line %d of %s",
+			item.KisimName, quantity, item.TotalPrice, line, original.ReceiptSerial)
+	}
+	details := itemDetails(index, item)
+	details["original_line"] = strconv.Itoa(line)
+	cr.record(audit.EventItemAdded, "", details)
+	cr.hooks.ItemAdded(cr.currentReceipt, cr.currentReceipt.Items[index])
+	cr.publishItem(cr.currentReceipt, cr.currentReceipt.Items[index])
+	return nil
+}
+
+// CurrentRefund returns the open refund with what is left on each original line, or
+// nil when the current receipt is not a refund
+func (cr *CashRegister) CurrentRefund() *Refund {
+	cr.saleMu.Lock()
+	defer cr.saleMu.Unlock()
+
+	if cr.currentReceipt == nil || !cr.currentReceipt.IsRefund() {
+		return nil
+	}
+	return &Refund{
+		Original: cr.refundOriginal,
+		Lines:    cr.refundLines(cr.refundOriginal, cr.currentReceipt.Items),
+	}
+}
+
+// refundLines works out what is left to refund on each line of original after the
+// refunds in history and the pending items. Refunded items name no original line, so
+// each is taken from the first matching line with quantity left. Callers hold the sale.
+func (cr *CashRegister) refundLines(original *models.Receipt, pending []models.Item) []RefundLine {
+	lines := make([]RefundLine, len(original.Items))
+	for i, item := range original.Items {
+		lines[i] = RefundLine{Line: i, Item: item, Refundable: item.Quantity, RefundableAmount: item.TotalPrice}
+	}
+
+	var refunded []models.Item
+	if cr.history != nil {
+		for _, refund := range cr.history.Refunds(original.TransactionID) {
+			refunded = append(refunded, refund.Items...)
+		}
+	}
+	refunded = append(refunded, pending...)
+
+	for _, item := range refunded {
+		quantity, amount := item.Quantity, item.TotalPrice
+		for i := range lines {
+			if quantity == 0 {
+				break
+			}
+			if lines[i].Refundable == 0 || !sameLine(lines[i].Item, item) {
+				continue
+			}
+			taken, takenAmount := quantity, amount
+			if quantity > lines[i].Refundable {
+				taken, takenAmount = lines[i].Refundable, lines[i].RefundableAmount
+			}
+			lines[i].Refundable -= taken
+			lines[i].RefundableAmount = math.Max(roundKurus(lines[i].RefundableAmount-takenAmount), 0)
+			quantity -= taken
+			amount = math.Max(roundKurus(amount-takenAmount), 0)
+		}
+	}
+	return lines
+}
+
+// sameLine reports whether a refunded item was taken from line
+func sameLine(line, item models.Item) bool {
+	return line.KisimID == item.KisimID && line.UnitPrice == item.UnitPrice &&
+		line.TaxRate == item.TaxRate && line.Weighed == item.Weighed && line.Note == item.Note
+}
+
+func anyRefundable(lines []RefundLine) bool {
+	for _, line := range lines {
+		if line.Refundable > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func roundKurus(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,138 @@
+package cashregister
+
+import (
+	"errors"
+	"slices"
+
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/stock"
+)
+
+var (
+	// ErrBusy is returned when a request tries to change the sale while another request is
+	// still changing it, e.g. a second add-item while a receipt is being issued
+	ErrBusy = errors.New("cash register is busy with another request")
+	// ErrNoActiveReceipt is returned by PreviewReceipt without an open sale
+	ErrNoActiveReceipt = errors.New("no active receipt - call StartNewReceipt first")
+	// ErrEmptyReceipt is returned by PreviewReceipt for a sale without items
+	ErrEmptyReceipt = errors.New("receipt has no items")
+)
+
+// beginSale takes the sale for an operation that changes the current receipt or the
+// receipt counter, until endSale. Operations don't queue: the second of two arriving at
+// once fails with ErrBusy, so the operator retries against the sale the first one left
+// rather than having it changed behind their back. Reads wait for the operation's
+// changes in memory, but not for its network calls (see withoutSaleMu).
+func (cr *CashRegister) beginSale() error {
+	if !cr.saleOp.TryLock() {
+		return ErrBusy
+	}
+	cr.saleMu.Lock()
+	return nil
+}
+
+func (cr *CashRegister) endSale() {
+	cr.saleMu.Unlock()
+	cr.saleOp.Unlock()
+}
+
+// withoutSaleMu runs fn, typically a call to the authority or the bank, with saleMu
+// released while the caller keeps the operation (saleOp): reads answer from the sale as
+// it was, and other operations still fail with ErrBusy. fn must not touch the sale.
+// Callers hold the sale.
+func (cr *CashRegister) withoutSaleMu(fn func()) {
+	cr.saleMu.Unlock()
+	defer cr.saleMu.Lock()
+	fn()
+}
+
+// copyReceipt copies a receipt deep enough that finalizing the copy leaves it untouched
+func copyReceipt(receipt *models.Receipt) *models.Receipt {
+	c := *receipt
+	c.Items = slices.Clone(receipt.Items)
+	c.Surcharges = slices.Clone(receipt.Surcharges)
+	return &c
+}
+
+// HasActiveReceipt returns true if there's an active receipt
+func (cr *CashRegister) HasActiveReceipt() bool {
+	cr.saleMu.Lock()
+	defer cr.saleMu.Unlock()
+
+	return cr.currentReceipt != nil
+}
+
+// GetCurrentReceipt returns the current receipt itself (for testing/debugging); it
+// changes under the caller while requests are served, so handlers use CurrentReceipt
+func (cr *CashRegister) GetCurrentReceipt() *models.Receipt {
+	cr.saleMu.Lock()
+	defer cr.saleMu.Unlock()
+
+	return cr.currentReceipt
+}
+
+// CurrentReceipt returns a copy of the current receipt, or nil without an active sale
+func (cr *CashRegister) CurrentReceipt() *models.Receipt {
+	cr.saleMu.Lock()
+	defer cr.saleMu.Unlock()
+
+	if cr.currentReceipt == nil {
+		return nil
+	}
+	return copyReceipt(cr.currentReceipt)
+}
+
+// PreviewReceipt returns the receipt issuing would produce now: serial, transaction ID,
+// tax breakdown, totals, exchange rate and amount due, worked out by the same steps as
+// issuing, on a copy. Nothing is consumed, so the serial is only the one the next issued
+// receipt gets. Like issuing, it fails when the sale breaks the limits or the stock.
+func (cr *CashRegister) PreviewReceipt() (*models.Receipt, error) {
+	cr.saleMu.Lock()
+	defer cr.saleMu.Unlock()
+
+	if cr.currentReceipt == nil {
+		return nil, ErrNoActiveReceipt
+	}
+	if len(cr.currentReceipt.Items) == 0 {
+		return nil, ErrEmptyReceipt
+	}
+	if err := cr.Limits().checkReceipt(cr.currentReceipt); err != nil {
+		return nil, err
+	}
+	if !cr.currentReceipt.IsRefund() {
+		if err := cr.checkStock(cr.currentReceipt.Items); err != nil {
+			return nil, err
+		}
+	}
+
+	preview := copyReceipt(cr.currentReceipt)
+	if err := cr.finalize(preview); err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+// EnsureReceipt starts a receipt unless one is open, in one step so that two requests
+// starting a sale can't both start one and discard the other's items
+func (cr *CashRegister) EnsureReceipt() error {
+	if err := cr.beginSale(); err != nil {
+		return err
+	}
+	defer cr.endSale()
+
+	if cr.currentReceipt != nil {
+		return nil
+	}
+	return cr.startReceipt()
+}
+
+// StockWarnings lists tracked KISIMs the current sale would leave low on stock
+func (cr *CashRegister) StockWarnings() []stock.Level {
+	cr.saleMu.Lock()
+	defer cr.saleMu.Unlock()
+
+	if cr.stock == nil || cr.currentReceipt == nil {
+		return nil
+	}
+	return cr.stock.LowAfter(cr.currentReceipt.Items)
+}
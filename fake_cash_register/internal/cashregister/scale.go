@@ -0,0 +1,38 @@
+package cashregister
+
+import (
+	"errors"
+	"fmt"
+
+	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/scale"
+)
+
+// ErrWeighingUnsupported is returned when selling a weighed KISIM on a format v1 register
+var ErrWeighingUnsupported = errors.New("weighed items need binary receipt format v2")
+
+// SetScale connects the checkout scale that weighs items of weighed KISIMs
+func (cr *CashRegister) SetScale(s *scale.Scale) {
+	cr.scale = s
+}
+
+// Scale returns the checkout scale (nil if none is connected)
+func (cr *CashRegister) Scale() *scale.Scale {
+	return cr.scale
+}
+
+// weigh returns the weight to sell of a weighed KISIM: grams entered by the cashier,
+// or the scale's reading when none are given
+func (cr *CashRegister) weigh(grams int) (int, error) {
+	format, err := binary.VersionLimits(cr.formatVersion)
+	if err != nil || !format.Weights {
+		return 0, fmt.Errorf("%w (register writes v%d)", ErrWeighingUnsupported, cr.formatVersion)
+	}
+	if grams != 0 {
+		return grams, nil
+	}
+	if cr.scale == nil {
+		return 0, fmt.Errorf("%w: no scale connected", scale.ErrNoReading)
+	}
+	return cr.scale.Weight()
+}
@@ -0,0 +1,58 @@
+package cashregister
+
+import (
+	"strconv"
+
+	"fake-cash-register/internal/audit"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/stock"
+)
+
+// SetStock enables stock tracking: issued receipts are taken out of stock and, when the
+// store blocks sales, items the stock can't cover are refused
+func (cr *CashRegister) SetStock(store *stock.Store) {
+	cr.stock = store
+}
+
+// Stock returns the stock store (nil if stock tracking is disabled)
+func (cr *CashRegister) Stock() *stock.Store {
+	return cr.stock
+}
+
+// checkStock refuses items the stock can't cover, when sales are blocked
+func (cr *CashRegister) checkStock(items []models.Item) error {
+	if cr.stock == nil || !cr.stock.BlocksSales() {
+		return nil
+	}
+	return cr.stock.Check(items)
+}
+
+// AdjustStock books a manual stock change (refund, delivery, damage or correction)
+func (cr *CashRegister) AdjustStock(kisimID, delta int, reason string) (stock.Level, error) {
+	level, err := cr.stock.Adjust(kisimID, delta, reason)
+	if err != nil {
+		return level, err
+	}
+	cr.recordStock(level, delta, reason)
+	return level, nil
+}
+
+// CountStock sets a level to the quantity counted at a stocktake
+func (cr *CashRegister) CountStock(kisimID, counted int) (stock.Level, error) {
+	before, _ := cr.stock.Level(kisimID)
+	level, err := cr.stock.Count(kisimID, counted)
+	if err != nil {
+		return level, err
+	}
+	cr.recordStock(level, level.Quantity-before.Quantity, stock.ReasonCount)
+	return level, nil
+}
+
+func (cr *CashRegister) recordStock(level stock.Level, delta int, reason string) {
+	cr.record(audit.EventStockAdjusted, "", map[string]string{
+		"kisim_id": strconv.Itoa(level.KisimID),
+		"delta":    strconv.Itoa(delta),
+		"quantity": strconv.Itoa(level.Quantity),
+		"reason":   reason,
+	})
+}
@@ -0,0 +1,78 @@
+package cashregister
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/audit"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/transaction"
+)
+
+// SetTransactionTimeout sets how long an issued receipt waits for the wallet to collect it
+func (cr *CashRegister) SetTransactionTimeout(timeout time.Duration) {
+	cr.txManager.SetTimeout(timeout)
+}
+
+// StartTransactionSweeper expires uncollected receipts in the background every interval
+func (cr *CashRegister) StartTransactionSweeper(interval time.Duration) {
+	cr.txManager.StartSweeper(interval)
+}
+
+// SetExpiryWebhook posts an event for every receipt that expires uncollected
+func (cr *CashRegister) SetExpiryWebhook(webhook *transaction.ExpiryWebhook) {
+	cr.expiryWebhook = webhook
+}
+
+// TransactionStats reports the receipts waiting for collection
+func (cr *CashRegister) TransactionStats() transaction.Stats {
+	return cr.txManager.Stats()
+}
+
+// ExpireTransactions expires the receipts that waited longer than the timeout now,
+// without waiting for the sweeper
+func (cr *CashRegister) ExpireTransactions() []*transaction.PendingTransaction {
+	return cr.txManager.CleanupExpiredTransactions()
+}
+
+// AwaitsCollection reports whether receiptID was issued by this register and is still
+// waiting for the wallet to collect it
+func (cr *CashRegister) AwaitsCollection(receiptID string) bool {
+	return cr.txManager.IsPending(receiptID)
+}
+
+var _ interfaces.WebhookHandler = (*CashRegister)(nil)
+
+// HandleDownloadConfirmation confirms a collection reported by the receipt bank's
+// webhook, or in-process by the mock receipt bank in standalone mode
+func (cr *CashRegister) HandleDownloadConfirmation(payload api.WebhookPayload) error {
+	if !cr.ConfirmTransaction(payload.ReceiptID) {
+		return fmt.Errorf("unknown receipt %s", payload.ReceiptID)
+	}
+	cr.publishConfirmed(payload.ReceiptID)
+	if cr.verbose && payload.Version() >= api.WebhookSchemaV2 {
+		log.Printf("[CASH-REGISTER] Receipt %s collected %dms after submission (webhook attempt %d)",
+			payload.ReceiptID, payload.CollectionLatencyMs, payload.Attempt)
+	}
+	return nil
+}
+
+// transactionExpired records a receipt the wallet never collected
+func (cr *CashRegister) transactionExpired(tx *transaction.PendingTransaction) {
+	transactionID, serial := "", ""
+	if tx.Receipt != nil {
+		transactionID, serial = tx.Receipt.TransactionID, tx.Receipt.ReceiptSerial
+	}
+	log.Printf("[CASH-REGISTER] Receipt %s was not collected within the timeout", tx.ReceiptID)
+
+	cr.record(audit.EventReceiptExpired, transactionID, map[string]string{
+		"receipt_id":     tx.ReceiptID,
+		"receipt_serial": serial,
+		"submitted_at":   tx.SubmittedAt.UTC().Format(time.RFC3339),
+	})
+	if cr.expiryWebhook != nil {
+		cr.expiryWebhook.Notify(tx)
+	}
+}
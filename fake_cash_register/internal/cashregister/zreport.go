@@ -0,0 +1,184 @@
+package cashregister
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"fake-cash-register/internal/audit"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/zreport"
+)
+
+// SetZReports persists closed Z-reports to store and continues numbering after its last report
+func (cr *CashRegister) SetZReports(store *zreport.Store) {
+	cr.zMu.Lock()
+	defer cr.zMu.Unlock()
+
+	cr.zReports = store
+	if last, ok := store.Last(); ok {
+		var number int
+		if _, err := fmt.Sscanf(last.Number, "Z%d", &number); err == nil {
+			cr.zReportCounter = number + 1
+			cr.openZReport()
+		}
+	}
+}
+
+// SetZReportSubmission sends each closed Z-report summary to the revenue authority;
+// the authority service must implement interfaces.ZReportSubmitter
+func (cr *CashRegister) SetZReportSubmission(enabled bool) {
+	cr.zSubmit = enabled
+}
+
+// ZReportClosing reports whether a Z-report close is pending, blocking new sales
+func (cr *CashRegister) ZReportClosing() bool {
+	cr.zMu.Lock()
+	defer cr.zMu.Unlock()
+
+	return cr.zClosing
+}
+
+// CurrentZReport returns a snapshot of the open Z-report's running totals
+func (cr *CashRegister) CurrentZReport() models.ZReport {
+	cr.zMu.Lock()
+	defer cr.zMu.Unlock()
+
+	snapshot := *cr.zOpen
+	snapshot.PaymentTotals = make(map[string]float64, len(cr.zOpen.PaymentTotals))
+	for method, total := range cr.zOpen.PaymentTotals {
+		snapshot.PaymentTotals[method] = total
+	}
+	if cr.zOpen.RoundingTotals != nil {
+		snapshot.RoundingTotals = make(map[string]float64, len(cr.zOpen.RoundingTotals))
+		for method, total := range cr.zOpen.RoundingTotals {
+			snapshot.RoundingTotals[method] = total
+		}
+	}
+	if cr.zOpen.SurchargeTotals != nil {
+		snapshot.SurchargeTotals = make(map[string]float64, len(cr.zOpen.SurchargeTotals))
+		for name, total := range cr.zOpen.SurchargeTotals {
+			snapshot.SurchargeTotals[name] = total
+		}
+	}
+	return snapshot
+}
+
+// LastZReport returns the most recently closed Z-report, if a store is configured
+func (cr *CashRegister) LastZReport() (*models.ZReport, bool) {
+	if cr.zReports == nil {
+		return nil, false
+	}
+	return cr.zReports.Last()
+}
+
+// CloseZReport ends the current Z-report period. New sales are blocked from the first
+// call; while a sale is open it returns zreport.ErrSaleInProgress and must be retried.
+// A failed authority submission is logged and leaves the report unsubmitted; the close
+// itself only fails when the report cannot be persisted.
+func (cr *CashRegister) CloseZReport() (*models.ZReport, error) {
+	cr.zMu.Lock()
+	cr.zClosing = true
+	cr.zMu.Unlock()
+
+	// Sale operations take zMu while holding the sale, so the sale is taken first
+	if err := cr.beginSale(); err != nil {
+		return nil, zreport.ErrSaleInProgress
+	}
+	defer cr.endSale()
+	if cr.currentReceipt != nil {
+		return nil, zreport.ErrSaleInProgress
+	}
+
+	cr.zMu.Lock()
+	report := cr.zOpen
+	closedAt := time.Now()
+	report.ClosedAt = &closedAt
+	cr.zMu.Unlock()
+
+	// The authority call runs without zMu and saleMu so Z-report and sale reads aren't
+	// held up by it; the operation is held, so no receipt joins the report meanwhile
+	var submitted bool
+	cr.withoutSaleMu(func() { submitted = cr.submitZReport(report) })
+
+	cr.zMu.Lock()
+	defer cr.zMu.Unlock()
+
+	report.Submitted = submitted
+	if cr.zReports != nil {
+		if err := cr.zReports.Add(report); err != nil {
+			report.ClosedAt = nil
+			report.Submitted = false
+			cr.zClosing = false
+			return nil, fmt.Errorf("failed to persist Z-report: %v", err)
+		}
+	}
+
+	if cr.verbose {
+		log.Printf("[CASH-REGISTER] Closed %s with %d receipts (₺%.2f)", report.Number, report.ReceiptCount, report.TotalAmount)
+	}
+	cr.record(audit.EventZReportClosed, "", map[string]string{
+		"z_report_number": report.Number,
+		"receipts":        strconv.Itoa(report.ReceiptCount),
+		"total":           formatAmount(report.TotalAmount),
+		"submitted":       strconv.FormatBool(report.Submitted),
+	})
+
+	// The next period opens when this one closes
+	cr.zReportCounter++
+	cr.openZReport()
+	cr.zClosing = false
+
+	return report, nil
+}
+
+// submitZReport sends a closed report to the revenue authority when submission is
+// enabled, and reports whether it was accepted. Failures are logged and audited.
+func (cr *CashRegister) submitZReport(report *models.ZReport) bool {
+	if !cr.zSubmit {
+		return false
+	}
+	submitter, ok := cr.revenueAuthority.(interfaces.ZReportSubmitter)
+	if !ok {
+		log.Printf("[CASH-REGISTER] Revenue authority does not accept Z-reports; %s kept locally", report.Number)
+		return false
+	}
+	if err := submitter.SubmitZReport(report); err != nil {
+		log.Printf("[CASH-REGISTER] Failed to submit %s to revenue authority: %v", report.Number, err)
+		cr.record(audit.EventExternalCallFailed, "", map[string]string{
+			"service":         "revenue_authority",
+			"z_report_number": report.Number,
+			"error":           err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// currentZReportNumber returns the number receipts are issued under
+func (cr *CashRegister) currentZReportNumber() string {
+	cr.zMu.Lock()
+	defer cr.zMu.Unlock()
+
+	return cr.zOpen.Number
+}
+
+// recordInZReport adds an issued receipt to the open Z-report's totals
+func (cr *CashRegister) recordInZReport(receipt *models.Receipt) {
+	cr.zMu.Lock()
+	defer cr.zMu.Unlock()
+
+	cr.zOpen.Add(receipt)
+}
+
+// openZReport starts the Z-report period for the current counter. Callers hold zMu.
+func (cr *CashRegister) openZReport() {
+	cr.zOpen = &models.ZReport{
+		Number:        fmt.Sprintf("Z%04d", cr.zReportCounter),
+		StoreVKN:      cr.storeInfo.VKN,
+		OpenedAt:      time.Now(),
+		PaymentTotals: make(map[string]float64),
+	}
+}
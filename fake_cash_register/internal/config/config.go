@@ -3,42 +3,303 @@ package config
 import (
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	Server struct {
-		Port        int    `yaml:"port"`
-		Verbose     bool   `yaml:"verbose"`
-		WebhookHost string `yaml:"webhook_host"`
-		WebhookPort int    `yaml:"webhook_port"`
+		Port          int    `yaml:"port"`
+		Verbose       bool   `yaml:"verbose"`
+		WebhookHost   string `yaml:"webhook_host"`
+		WebhookPort   int    `yaml:"webhook_port"`
+		WebhookBind   string `yaml:"webhook_bind"`
+		WebhookSecret string `yaml:"webhook_secret"`
 	} `yaml:"server"`
 
 	StandaloneMode bool `yaml:"standalone_mode"`
 
-	Store struct {
-		VKN     string `yaml:"vkn"`
-		Name    string `yaml:"name"`
-		Address string `yaml:"address"`
-	} `yaml:"store"`
+	Auth struct {
+		Enabled bool     `yaml:"enabled"`
+		UIRole  string   `yaml:"ui_role"`
+		Keys    []APIKey `yaml:"keys"`
+	} `yaml:"auth"`
+
+	Demo struct {
+		VirtualCustomer bool `yaml:"virtual_customer"`
+	} `yaml:"demo"`
+
+	Faults struct {
+		Enabled          bool      `yaml:"enabled"`
+		Seed             uint64    `yaml:"seed"`
+		RevenueAuthority FaultRule `yaml:"revenue_authority"`
+		ReceiptBank      FaultRule `yaml:"receipt_bank"`
+	} `yaml:"faults"`
+
+	Store Store `yaml:"store"`
+
+	// Several registers served from one process, each with its own store, serial
+	// sequence and files (empty = the single register described by store)
+	Registers []Register `yaml:"registers"`
 
 	RevenueAuthority struct {
-		URL string `yaml:"url"`
+		URL             string `yaml:"url"`
+		APIKey          string `yaml:"api_key"`
+		TimestampTokens bool   `yaml:"timestamp_tokens"`
+		StrictSigning   bool   `yaml:"strict_signing"`
+		RegisterKeyFile string `yaml:"register_key_file"`
+		ResponseKeyFile string `yaml:"response_key_file"`
+		// Re-fetch the authority public key this often (0 = until fetched once)
+		KeyRefreshInterval time.Duration `yaml:"key_refresh_interval"`
 	} `yaml:"revenue_authority"`
 
 	ReceiptBank struct {
-		URL string `yaml:"url"`
+		URL               string `yaml:"url"`
+		APIKey            string `yaml:"api_key"`
+		AttestSubmissions bool   `yaml:"attest_submissions"`
+		// Re-run the GET /version handshake this often (0 = at startup only)
+		VersionCheckInterval time.Duration `yaml:"version_check_interval"`
+		Discovery            struct {
+			MDNS           bool          `yaml:"mdns"`
+			Timeout        time.Duration `yaml:"timeout"`
+			HealthInterval time.Duration `yaml:"health_interval"`
+		} `yaml:"discovery"`
 	} `yaml:"receipt_bank"`
 
+	Resilience struct {
+		MaxAttempts      int           `yaml:"max_attempts"`
+		BaseDelay        time.Duration `yaml:"base_delay"`
+		MaxDelay         time.Duration `yaml:"max_delay"`
+		FailureThreshold int           `yaml:"failure_threshold"`
+		OpenTimeout      time.Duration `yaml:"open_timeout"`
+	} `yaml:"resilience"`
+
+	History struct {
+		File           string `yaml:"file"`
+		ExportPageSize int    `yaml:"export_page_size"`
+	} `yaml:"history"`
+
+	Holds struct {
+		File string `yaml:"file"`
+		Max  int    `yaml:"max"`
+	} `yaml:"holds"`
+
+	Delivery struct {
+		Enabled bool          `yaml:"enabled"`
+		Locale  string        `yaml:"locale"`
+		Timeout time.Duration `yaml:"timeout"`
+		Email   struct {
+			SMTPHost    string `yaml:"smtp_host"`
+			SMTPPort    int    `yaml:"smtp_port"`
+			ImplicitTLS bool   `yaml:"implicit_tls"`
+			Username    string `yaml:"username"`
+			Password    string `yaml:"password"`
+			From        string `yaml:"from"`
+		} `yaml:"email"`
+		SMS struct {
+			GatewayURL string `yaml:"gateway_url"`
+			APIKey     string `yaml:"api_key"`
+			Sender     string `yaml:"sender"`
+		} `yaml:"sms"`
+	} `yaml:"delivery"`
+
+	Transactions struct {
+		Timeout             time.Duration `yaml:"timeout"`
+		SweepInterval       time.Duration `yaml:"sweep_interval"`
+		ExpiryWebhookURL    string        `yaml:"expiry_webhook_url"`
+		ExpiryWebhookSecret string        `yaml:"expiry_webhook_secret"`
+	} `yaml:"transactions"`
+
+	Audit struct {
+		File string `yaml:"file"`
+	} `yaml:"audit"`
+
+	ZReport struct {
+		AutoClose         string `yaml:"auto_close"`
+		File              string `yaml:"file"`
+		SubmitToAuthority bool   `yaml:"submit_to_authority"`
+	} `yaml:"z_report"`
+
+	Receipt struct {
+		FormatVersion uint8  `yaml:"format_version"`
+		Compress      bool   `yaml:"compress"`
+		DeviceKeyFile string `yaml:"device_key_file"` // PEM P-256 key co-signing receipts; "" = authority signature only
+	} `yaml:"receipt"`
+
+	Limits struct {
+		MaxQuantity     int     `yaml:"max_quantity"`
+		MaxUnitPrice    float64 `yaml:"max_unit_price"`
+		MaxReceiptTotal float64 `yaml:"max_receipt_total"`
+		MaxItems        int     `yaml:"max_items"`
+		MaxWeight       int     `yaml:"max_weight"`      // Grams per weighed line
+		MaxNoteLength   int     `yaml:"max_note_length"` // Bytes per line note
+	} `yaml:"limits"`
+
+	PipelineStats struct {
+		Smoothing  float64 `yaml:"smoothing"`  // Weight of the newest sample in the moving averages; 0 = timing.DefaultSmoothing
+		Prometheus bool    `yaml:"prometheus"` // Also serve them at GET /metrics
+	} `yaml:"pipeline_stats"`
+
+	Idempotency struct {
+		Enabled bool          `yaml:"enabled"`
+		Window  time.Duration `yaml:"window"`
+		MaxKeys int           `yaml:"max_keys"`
+	} `yaml:"idempotency"`
+
+	Scale struct {
+		Enabled bool `yaml:"enabled"`
+		// Serial port of a scale sending continuous output (empty = readings posted to /api/scale)
+		Device string        `yaml:"device"`
+		MaxAge time.Duration `yaml:"max_age"`
+	} `yaml:"scale"`
+
+	Devices struct {
+		// escpos (drawer and beeper on the receipt printer), gpio or mock; empty = mock in
+		// standalone mode, none online
+		Driver        string        `yaml:"driver"`
+		PrinterDevice string        `yaml:"printer_device"`
+		DrawerPin     int           `yaml:"drawer_pin"`
+		BeeperPin     int           `yaml:"beeper_pin"`
+		Pulse         time.Duration `yaml:"pulse"`
+		DrawerPayment []string      `yaml:"drawer_payment_methods"`
+		BeepOnItem    bool          `yaml:"beep_on_item"`
+		BeepOnError   bool          `yaml:"beep_on_error"`
+	} `yaml:"devices"`
+
+	Stock struct {
+		Enabled    bool         `yaml:"enabled"`
+		File       string       `yaml:"file"`
+		LowStock   int          `yaml:"low_stock"`
+		BlockSales bool         `yaml:"block_sales"`
+		Initial    []StockLevel `yaml:"initial"`
+	} `yaml:"stock"`
+
+	Currency struct {
+		Base            string             `yaml:"base"`
+		Rounding        string             `yaml:"rounding"`
+		Accepted        []AcceptedCurrency `yaml:"accepted"`
+		RatesURL        string             `yaml:"rates_url"`
+		RefreshInterval time.Duration      `yaml:"refresh_interval"`
+	} `yaml:"currency"`
+
+	Rounding struct {
+		Rules []RoundingRule `yaml:"rules"`
+	} `yaml:"rounding"`
+
+	Surcharges []SurchargeRule `yaml:"surcharges"`
+
+	I18n struct {
+		DefaultLocale string                       `yaml:"default_locale"`
+		Messages      map[string]map[string]string `yaml:"messages"`
+	} `yaml:"i18n"`
+
+	Hooks struct {
+		Enabled []string `yaml:"enabled"`
+	} `yaml:"hooks"`
+
+	KisimLayout struct {
+		PageSize int          `yaml:"page_size"` // Department keys per page (0 = 12)
+		Groups   []KisimGroup `yaml:"groups"`
+	} `yaml:"kisim_layout"`
+
 	Kisim []Kisim `yaml:"kisim"`
+
+	// Head-office KISIM catalog replacing the kisim list while the registers run
+	CatalogSync struct {
+		URL      string        `yaml:"url"` // Empty sells from the kisim list only
+		Interval time.Duration `yaml:"interval"`
+	} `yaml:"catalog_sync"`
+}
+
+type Store struct {
+	VKN     string `yaml:"vkn"`
+	Name    string `yaml:"name"`
+	Address string `yaml:"address"`
+	// Go text/template file customizing printed receipts (empty = default layout)
+	ReceiptTemplate string `yaml:"receipt_template"`
+}
+
+type Register struct {
+	ID          string `yaml:"id"` // Selects the register: /r/<id>/... or X-Register-ID
+	Store       Store  `yaml:"store"`
+	SerialStart int    `yaml:"serial_start"` // First receipt serial (0 = 1)
 }
 
 type Kisim struct {
 	ID          int     `yaml:"id"`
 	Name        string  `yaml:"name"`
 	TaxRate     int     `yaml:"tax_rate"`
-	PresetPrice float64 `yaml:"preset_price"`
+	PresetPrice float64 `yaml:"preset_price"` // Per kilogram when weighed
+	Weighed     bool    `yaml:"weighed"`
+	Group       string  `yaml:"group"` // KisimGroup.ID; "" puts it under "other"
+	Order       int     `yaml:"order"` // Position within the group
+	// Rates taking over from TaxRate on set dates, e.g. a rise announced by law
+	TaxRates []KisimTaxRate `yaml:"tax_rates"`
+}
+
+// KisimTaxRate is a tax rate in force from ValidFrom, a date (midnight, register
+// time) or an RFC 3339 time
+type KisimTaxRate struct {
+	Rate      int    `yaml:"rate"`
+	ValidFrom string `yaml:"valid_from"`
+}
+
+// ValidFromTime parses ValidFrom
+func (r KisimTaxRate) ValidFromTime() (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", r.ValidFrom, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, r.ValidFrom)
+}
+
+type KisimGroup struct {
+	ID    string `yaml:"id"`
+	Name  string `yaml:"name"`
+	Color string `yaml:"color"` // "#rrggbb"
+	Order int    `yaml:"order"`
+}
+
+type APIKey struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+	Role string `yaml:"role"` // readonly, sales, supervisor or admin
+}
+
+type FaultRule struct {
+	FailureRate float64       `yaml:"failure_rate"` // 0 to 1
+	Failure     string        `yaml:"failure"`      // timeout, unavailable, rejected or conflict
+	Latency     time.Duration `yaml:"latency"`
+	Jitter      time.Duration `yaml:"jitter"`
+	Timeout     time.Duration `yaml:"timeout"` // How long an injected timeout hangs
+}
+
+type StockLevel struct {
+	KisimID  int `yaml:"kisim_id"`
+	Quantity int `yaml:"quantity"`
+	LowStock int `yaml:"low_stock"` // 0 uses stock.low_stock
+}
+
+type AcceptedCurrency struct {
+	Code   string  `yaml:"code"`
+	Symbol string  `yaml:"symbol"`
+	Rate   float64 `yaml:"rate"` // Base currency units per one unit of this currency
+}
+
+type RoundingRule struct {
+	PaymentMethod string  `yaml:"payment_method"`
+	Increment     float64 `yaml:"increment"` // Lira, e.g. 0.05
+	Mode          string  `yaml:"mode"`      // half_up, down or up
+}
+
+type SurchargeRule struct {
+	PaymentMethod string  `yaml:"payment_method"`
+	Name          string  `yaml:"name"`    // Printed on the receipt line
+	Percent       float64 `yaml:"percent"` // Of the items total, e.g. 2
+	Amount        float64 `yaml:"amount"`  // Fixed fee in lira, instead of percent
+	TaxRate       int     `yaml:"tax_rate"`
 }
 
 func Load() *Config {
@@ -54,3 +315,31 @@ func Load() *Config {
 
 	return &config
 }
+
+// ForRegister returns the configuration of one of several registers: its own store, and
+// history, held sale, audit, Z-report and stock files named after it
+// (receipt_history.jsonl becomes receipt_history.<id>.jsonl). Everything else is shared.
+func (c *Config) ForRegister(register Register) *Config {
+	cfg := *c
+	cfg.Store = register.Store
+	if cfg.Store.ReceiptTemplate == "" {
+		cfg.Store.ReceiptTemplate = c.Store.ReceiptTemplate
+	}
+	cfg.History.File = registerFile(c.History.File, register.ID)
+	cfg.Holds.File = registerFile(c.Holds.File, register.ID)
+	cfg.Audit.File = registerFile(c.Audit.File, register.ID)
+	cfg.ZReport.File = registerFile(c.ZReport.File, register.ID)
+	cfg.Stock.File = registerFile(c.Stock.File, register.ID)
+	cfg.Receipt.DeviceKeyFile = registerFile(c.Receipt.DeviceKeyFile, register.ID)
+	return &cfg
+}
+
+// registerFile inserts the register ID before the extension of path; empty paths
+// (in-memory stores) stay empty
+func registerFile(path, id string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + id + ext
+}
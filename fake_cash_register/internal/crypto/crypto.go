@@ -1,25 +1,30 @@
 package crypto
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
-	"io"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 
-	"golang.org/x/crypto/hkdf"
+	rwcrypto "receiptwallet/crypto"
 
 	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/interfaces"
 )
 
 type CryptoService struct {
 	verbose bool
 }
 
+var _ interfaces.CryptoService = (*CryptoService)(nil)
+
 func NewCryptoService(verbose bool) *CryptoService {
 	return &CryptoService{
 		verbose: verbose,
@@ -52,13 +57,14 @@ func (c *CryptoService) EncryptWithUserEphemeralKey(binaryData []byte, userEphem
 	}
 
 	// Parse the user's ephemeral public key (strict contract - no fallbacks)
-	userPublicKey, err := binary.RawCompressedToPublicKey(userEphemeralKeyCompressed)
+	userPublicKey, err := rwcrypto.DecompressKey(userEphemeralKeyCompressed)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse user ephemeral key: %v", err)
 	}
 
 	// Perform privacy-preserving encryption (no cash register keys involved)
-	binaryEncrypted, err := c.encryptWithPublicKey(binaryData, userPublicKey)
+	// Result: temp_public_key(65) || nonce(12) || ciphertext || tag(16)
+	binaryEncrypted, err := rwcrypto.Encrypt(binaryData, userPublicKey)
 	if err != nil {
 		return nil, fmt.Errorf("encryption failed: %v", err)
 	}
@@ -78,7 +84,7 @@ func (c *CryptoService) ValidateUserEphemeralKey(userEphemeralKeyCompressed []by
 	}
 
 	// Use strict parsing - no fallbacks
-	_, err := binary.RawCompressedToPublicKey(userEphemeralKeyCompressed)
+	_, err := rwcrypto.DecompressKey(userEphemeralKeyCompressed)
 	if err != nil {
 		return fmt.Errorf("invalid user ephemeral key: %v", err)
 	}
@@ -90,146 +96,68 @@ func (c *CryptoService) ValidateUserEphemeralKey(userEphemeralKeyCompressed []by
 	return nil
 }
 
-// encryptWithPublicKey implements privacy-preserving encryption using user's ephemeral public key
-// Privacy model: Cash register generates temporary private key, uses ECDH with user's public key
-// Returns: nonce || encrypted_data || auth_tag (no keys in output - user already has the ephemeral private key)
-func (c *CryptoService) encryptWithPublicKey(binaryData []byte, userEphemeralPublicKey *ecdsa.PublicKey) ([]byte, error) {
-	// Privacy-preserving ECDH: Cash register generates random private key for this encryption
-	// User can decrypt because they have the corresponding ephemeral private key
-
-	// Step 1: Generate a temporary private key for ECDH (not stored or transmitted)
-	tempPrivateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate temporary key: %v", err)
+// LoadOrCreateRegisterKey loads the register's P-256 signing key from a PEM file. A missing
+// file is created with a new key, and its public half written next to it as <name>_public.pem
+// for registering with the revenue authority.
+func LoadOrCreateRegisterKey(path string) (*ecdsa.PrivateKey, error) {
+	keyData, err := os.ReadFile(path)
+	if err == nil {
+		return rwcrypto.ParsePrivateKeyPEM(keyData)
 	}
-
-	// Step 2: Perform ECDH using user's ephemeral public key and our temporary private key
-	sharedX, _ := userEphemeralPublicKey.Curve.ScalarMult(
-		userEphemeralPublicKey.X, userEphemeralPublicKey.Y,
-		tempPrivateKey.D.Bytes())
-	sharedSecret := sharedX.Bytes()
-
-	// Step 3: Derive encryption key from shared secret
-	hkdf := hkdf.New(sha256.New, sharedSecret, nil, []byte("Privacy-preserving-ECDH"))
-	encryptionKey := make([]byte, 32) // AES-256 key
-	if _, err := io.ReadFull(hkdf, encryptionKey); err != nil {
-		return nil, fmt.Errorf("failed to derive encryption key: %v", err)
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read register key: %v", err)
 	}
 
-	// Step 4: Encrypt with AES-GCM
-	block, err := aes.NewCipher(encryptionKey)
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create AES cipher: %v", err)
+		return nil, fmt.Errorf("failed to generate register key: %v", err)
 	}
-
-	aesGCM, err := cipher.NewGCM(block)
+	privateDER, err := x509.MarshalECPrivateKey(privateKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %v", err)
-	}
-
-	// Step 5: Generate random nonce
-	nonce := make([]byte, aesGCM.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+		return nil, fmt.Errorf("failed to marshal register key: %v", err)
 	}
-
-	// Step 6: Encrypt data
-	ciphertext := aesGCM.Seal(nil, nonce, binaryData, nil)
-
-	// Step 7: Include temporary public key in result for user to perform ECDH
-	tempPublicKeyBytes := elliptic.Marshal(elliptic.P256(), tempPrivateKey.PublicKey.X, tempPrivateKey.PublicKey.Y)
-
-	// Step 8: Construct result: temp_public_key || nonce || ciphertext
-	result := make([]byte, 0, len(tempPublicKeyBytes)+len(nonce)+len(ciphertext))
-	result = append(result, tempPublicKeyBytes...)
-	result = append(result, nonce...)
-	result = append(result, ciphertext...)
-
-	if c.verbose {
-		log.Printf("[CRYPTO] Privacy-preserving ECDH: temp key %d bytes, nonce %d bytes, ciphertext %d bytes",
-			len(tempPublicKeyBytes), len(nonce), len(ciphertext))
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal register public key: %v", err)
 	}
 
-	// Clear sensitive data
-	for i := range encryptionKey {
-		encryptionKey[i] = 0
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateDER}), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write register key: %v", err)
 	}
-	for i := range sharedSecret {
-		sharedSecret[i] = 0
+	publicPath := strings.TrimSuffix(path, filepath.Ext(path)) + "_public.pem"
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write register public key: %v", err)
 	}
 
-	return result, nil
+	log.Printf("[CRYPTO] Generated register key %s; register %s with the revenue authority", path, publicPath)
+	return privateKey, nil
 }
 
-// eciesDecrypt implements proper ECIES decryption (for completeness/testing)
-// This would be used by the recipient to decrypt the data
-func (c *CryptoService) eciesDecrypt(encryptedData []byte, recipientPrivateKey *ecdsa.PrivateKey) ([]byte, error) {
-	curve := elliptic.P256()
-	keySize := (curve.Params().BitSize + 7) / 8
-
-	// Parse components: ephemeral_public_key || nonce || ciphertext
-	if len(encryptedData) < 2*keySize+1+12 { // min size: uncompressed point + 12-byte nonce + some ciphertext
-		return nil, fmt.Errorf("encrypted data too short")
-	}
-
-	// Extract ephemeral public key (uncompressed point: 0x04 + 32 + 32 bytes)
-	ephemeralPubKeyBytes := encryptedData[:2*keySize+1]
-	x, y := elliptic.Unmarshal(curve, ephemeralPubKeyBytes)
-	if x == nil {
-		return nil, fmt.Errorf("invalid ephemeral public key")
-	}
-
-	ephemeralPublicKey := &ecdsa.PublicKey{
-		Curve: curve,
-		X:     x,
-		Y:     y,
-	}
-
-	// Compute shared secret
-	sharedX, _ := curve.ScalarMult(ephemeralPublicKey.X, ephemeralPublicKey.Y, recipientPrivateKey.D.Bytes())
-	sharedSecret := sharedX.Bytes()
-
-	// Derive keys
-	hkdf := hkdf.New(sha256.New, sharedSecret, nil, []byte("ECIES-encryption"))
-	keyMaterial := make([]byte, 64)
-	if _, err := io.ReadFull(hkdf, keyMaterial); err != nil {
-		return nil, fmt.Errorf("failed to derive keys: %v", err)
-	}
-
-	encryptionKey := keyMaterial[:32]
-
-	// Extract nonce and ciphertext
-	remaining := encryptedData[2*keySize+1:]
-	if len(remaining) < 12 {
-		return nil, fmt.Errorf("missing nonce")
-	}
-
-	nonce := remaining[:12]
-	ciphertext := remaining[12:]
-
-	// Decrypt
-	block, err := aes.NewCipher(encryptionKey)
+// LoadAuthorityKey reads the revenue authority's PEM public key, pinned to verify its
+// signed responses
+func LoadAuthorityKey(path string) (*ecdsa.PublicKey, error) {
+	keyData, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create AES cipher: %v", err)
+		return nil, fmt.Errorf("failed to read authority key: %v", err)
 	}
-
-	aesGCM, err := cipher.NewGCM(block)
+	publicKey, err := rwcrypto.ParsePublicKeyPEM(keyData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %v", err)
+		return nil, fmt.Errorf("failed to parse authority key: %v", err)
 	}
+	return publicKey, nil
+}
 
-	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
+// LoadDeviceKey reads the register's provisioned P-256 device key from a PEM file. Unlike
+// the register key it is never generated here: the device key identifies the register on
+// every receipt it signs.
+func LoadDeviceKey(path string) (*ecdsa.PrivateKey, error) {
+	keyData, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt: %v", err)
+		return nil, fmt.Errorf("failed to read device key: %v", err)
 	}
-
-	// Clear sensitive data
-	for i := range encryptionKey {
-		encryptionKey[i] = 0
-	}
-	for i := range sharedSecret {
-		sharedSecret[i] = 0
+	privateKey, err := rwcrypto.ParsePrivateKeyPEM(keyData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse device key: %v", err)
 	}
-
-	return plaintext, nil
+	return privateKey, nil
 }
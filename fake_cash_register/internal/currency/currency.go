@@ -0,0 +1,298 @@
+package currency
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rounding modes applied when converting to a currency's minor units
+const (
+	RoundHalfUp   = "half_up"
+	RoundHalfEven = "half_even"
+	RoundDown     = "down"
+)
+
+// minorUnitExponents lists ISO 4217 currencies whose minor unit is not 1/100
+var minorUnitExponents = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"BHD": 3,
+}
+
+// Currency describes an accepted foreign currency
+type Currency struct {
+	Code   string  `json:"code"`
+	Symbol string  `json:"symbol"`
+	Rate   float64 `json:"rate"` // Units of base currency per one unit of this currency
+}
+
+// Quote is a conversion locked in at sale time
+type Quote struct {
+	Code   string  `json:"code"`
+	Rate   float64 `json:"rate"`
+	Amount float64 `json:"amount"`
+}
+
+// Converter converts base-currency totals into accepted foreign currencies
+type Converter struct {
+	mu        sync.RWMutex
+	base      string
+	rounding  string
+	accepted  map[string]Currency
+	updatedAt time.Time
+	verbose   bool
+}
+
+// NewConverter creates a converter for the base currency and accepted foreign currencies
+func NewConverter(base string, rounding string, accepted []Currency, verbose bool) (*Converter, error) {
+	if !validCode(base) {
+		return nil, fmt.Errorf("invalid base currency code %q", base)
+	}
+	switch rounding {
+	case "":
+		rounding = RoundHalfUp
+	case RoundHalfUp, RoundHalfEven, RoundDown:
+	default:
+		return nil, fmt.Errorf("unknown rounding mode %q", rounding)
+	}
+
+	c := &Converter{
+		base:      strings.ToUpper(base),
+		rounding:  rounding,
+		accepted:  make(map[string]Currency),
+		updatedAt: time.Now(),
+		verbose:   verbose,
+	}
+
+	for _, cur := range accepted {
+		if err := c.add(cur); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Base returns the ISO 4217 code of the base currency
+func (c *Converter) Base() string {
+	return c.base
+}
+
+// Currencies returns accepted foreign currencies sorted by code
+func (c *Converter) Currencies() []Currency {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	list := make([]Currency, 0, len(c.accepted))
+	for _, cur := range c.accepted {
+		list = append(list, cur)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// UpdatedAt returns when rates were last changed
+func (c *Converter) UpdatedAt() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.updatedAt
+}
+
+// Accepts reports whether code is the base currency or an accepted foreign currency
+func (c *Converter) Accepts(code string) bool {
+	code = strings.ToUpper(code)
+	if code == c.base {
+		return true
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.accepted[code]
+	return ok
+}
+
+// SetRates updates exchange rates of already accepted currencies
+func (c *Converter) SetRates(rates map[string]float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Validate every rate before applying any, so a bad entry leaves all rates as they were
+	validated := make(map[string]float64, len(rates))
+	for code, rate := range rates {
+		code = strings.ToUpper(code)
+		if _, ok := c.accepted[code]; !ok {
+			return fmt.Errorf("currency %s is not accepted", code)
+		}
+		if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+			return fmt.Errorf("invalid rate for %s: %v", code, rate)
+		}
+		validated[code] = rate
+	}
+	for code, rate := range validated {
+		cur := c.accepted[code]
+		cur.Rate = rate
+		c.accepted[code] = cur
+	}
+	c.updatedAt = time.Now()
+
+	if c.verbose {
+		log.Printf("[CURRENCY] Updated %d exchange rate(s)", len(rates))
+	}
+
+	return nil
+}
+
+// Quote converts a base-currency amount into code using the current rate, rounded to minor units
+func (c *Converter) Quote(baseAmount float64, code string) (Quote, error) {
+	code = strings.ToUpper(code)
+
+	c.mu.RLock()
+	cur, ok := c.accepted[code]
+	c.mu.RUnlock()
+	if !ok {
+		return Quote{}, fmt.Errorf("currency %s is not accepted", code)
+	}
+
+	return Quote{
+		Code:   code,
+		Rate:   cur.Rate,
+		Amount: c.Round(baseAmount/cur.Rate, code),
+	}, nil
+}
+
+// Round rounds amount to the minor unit of code using the configured rounding mode
+func (c *Converter) Round(amount float64, code string) float64 {
+	scale := math.Pow10(MinorUnitExponent(code))
+	// Strip float noise first so 1.005*100 = 100.49999999999999 counts as a half
+	scaled := math.Round(amount*scale*1e6) / 1e6
+
+	switch c.rounding {
+	case RoundDown:
+		scaled = math.Floor(scaled)
+	case RoundHalfEven:
+		scaled = math.RoundToEven(scaled)
+	default:
+		scaled = math.Round(scaled)
+	}
+
+	return scaled / scale
+}
+
+// Format renders amount with the currency symbol, e.g. "€12.50", "₺12,50" or "12.50 CHF" without a symbol
+func (c *Converter) Format(amount float64, code string) string {
+	code = strings.ToUpper(code)
+	exponent := MinorUnitExponent(code)
+	text := fmt.Sprintf("%.*f", exponent, amount)
+
+	if code == "TRY" {
+		return "₺" + strings.Replace(text, ".", ",", 1)
+	}
+
+	c.mu.RLock()
+	cur, ok := c.accepted[code]
+	c.mu.RUnlock()
+	if ok && cur.Symbol != "" {
+		return cur.Symbol + text
+	}
+	return text + " " + code
+}
+
+// StartRefresh periodically fetches rates from url; the response must be
+// {"base": "<base code>", "rates": {"EUR": 35.5, ...}} in base units per foreign unit.
+func (c *Converter) StartRefresh(url string, interval time.Duration) {
+	if url == "" || interval <= 0 {
+		return
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := c.refresh(client, url); err != nil {
+				log.Printf("[CURRENCY] Rate refresh failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+
+	if c.verbose {
+		log.Printf("[CURRENCY] Refreshing rates from %s every %v", url, interval)
+	}
+}
+
+func (c *Converter) refresh(client *http.Client, url string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rate source returned status %d", resp.StatusCode)
+	}
+
+	var payload struct {
+		Base  string             `json:"base"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return fmt.Errorf("failed to parse rates: %v", err)
+	}
+	if !strings.EqualFold(payload.Base, c.base) {
+		return fmt.Errorf("rate source base %s does not match %s", payload.Base, c.base)
+	}
+
+	// Only refresh currencies we accept; the source may list many more
+	accepted := make(map[string]float64)
+	for code, rate := range payload.Rates {
+		if c.Accepts(code) && !strings.EqualFold(code, c.base) {
+			accepted[code] = rate
+		}
+	}
+
+	return c.SetRates(accepted)
+}
+
+func (c *Converter) add(cur Currency) error {
+	cur.Code = strings.ToUpper(cur.Code)
+	if !validCode(cur.Code) {
+		return fmt.Errorf("invalid currency code %q", cur.Code)
+	}
+	if cur.Code == c.base {
+		return fmt.Errorf("currency %s is the base currency", cur.Code)
+	}
+	if cur.Rate <= 0 {
+		return fmt.Errorf("currency %s needs a positive rate", cur.Code)
+	}
+	c.accepted[cur.Code] = cur
+	return nil
+}
+
+// MinorUnitExponent returns the number of decimal places of the currency's minor unit
+func MinorUnitExponent(code string) int {
+	if exponent, ok := minorUnitExponents[strings.ToUpper(code)]; ok {
+		return exponent
+	}
+	return 2
+}
+
+func validCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range strings.ToUpper(code) {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
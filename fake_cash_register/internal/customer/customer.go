@@ -0,0 +1,118 @@
+package customer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"log"
+
+	rwcrypto "receiptwallet/crypto"
+	"receiptwallet/qrpayload"
+
+	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/models"
+)
+
+// ErrInvalidSignature is returned when the collected receipt does not verify
+// against the revenue authority's public key
+var ErrInvalidSignature = binary.ErrInvalidSignature
+
+// VirtualCustomer plays the customer's wallet for standalone demos: it generates the
+// ephemeral key the QR code would carry, then collects, decrypts and verifies the receipt
+type VirtualCustomer struct {
+	bank      interfaces.ReceiptCollector
+	authority interfaces.RevenueAuthorityService
+	verbose   bool
+}
+
+// Wallet is one sale's ephemeral keypair
+type Wallet struct {
+	privateKey *ecdsa.PrivateKey
+	// PublicKey is the 33-byte compressed key handed to the register
+	PublicKey []byte
+	// QRCode is the text of the QR code the wallet would show (see qrpayload)
+	QRCode string
+}
+
+// Result describes a collected receipt whose signature verified
+type Result struct {
+	Receipt        *models.Receipt
+	EncryptedSize  int
+	SignedSize     int
+	TimestampToken bool
+	DeviceSigned   bool // The register's device signature verified too
+}
+
+// NewVirtualCustomer creates a virtual customer collecting from bank and verifying with authority
+func NewVirtualCustomer(bank interfaces.ReceiptCollector, authority interfaces.RevenueAuthorityService, verbose bool) *VirtualCustomer {
+	return &VirtualCustomer{
+		bank:      bank,
+		authority: authority,
+		verbose:   verbose,
+	}
+}
+
+// NewWallet generates a fresh ephemeral keypair, as a wallet app does for each QR code
+func (v *VirtualCustomer) NewWallet() (*Wallet, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %v", err)
+	}
+
+	compressed, err := rwcrypto.CompressKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress ephemeral key: %v", err)
+	}
+
+	qrCode, err := (&qrpayload.Payload{EphemeralKey: compressed}).Encode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR payload: %v", err)
+	}
+
+	if v.verbose {
+		log.Printf("[CUSTOMER] Generated ephemeral key (%d bytes compressed)", len(compressed))
+	}
+
+	return &Wallet{privateKey: privateKey, PublicKey: compressed, QRCode: qrCode}, nil
+}
+
+// Collect fetches the receipt issued to wallet from the bank, decrypts it, verifies the
+// authority signature over the binary receipt and decodes it
+func (v *VirtualCustomer) Collect(wallet *Wallet) (*Result, error) {
+	encrypted, err := v.bank.CollectReceipt(wallet.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect receipt: %w", err)
+	}
+
+	signedReceipt, err := rwcrypto.Decrypt(encrypted, wallet.privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt receipt: %w", err)
+	}
+
+	if v.verbose {
+		log.Printf("[CUSTOMER] Decrypted %d byte envelope into %d byte signed receipt", len(encrypted), len(signedReceipt))
+	}
+
+	publicKeyDER, err := v.authority.GetPublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revenue authority public key: %w", err)
+	}
+	signed, receipt, err := binary.VerifySignedReceipt(signedReceipt, publicKeyDER)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.verbose {
+		log.Printf("[CUSTOMER] Verified receipt %s (total ₺%.2f)", receipt.ReceiptSerial, receipt.TotalAmount)
+	}
+
+	return &Result{
+		Receipt:        receipt,
+		EncryptedSize:  len(encrypted),
+		SignedSize:     len(signedReceipt),
+		TimestampToken: signed.TimestampToken != nil,
+		DeviceSigned:   signed.DeviceSignature != nil,
+	}, nil
+}
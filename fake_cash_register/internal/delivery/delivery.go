@@ -0,0 +1,185 @@
+package delivery
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"fake-cash-register/internal/i18n"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/receiptpdf"
+)
+
+// ErrUnsupportedChannel is returned for a channel that is not configured
+var ErrUnsupportedChannel = errors.New("delivery channel is not configured")
+
+// Options configures the delivery channels; a channel without a server or gateway is off
+type Options struct {
+	Email EmailOptions
+	SMS   SMSOptions
+	// Timeout bounds each SMTP session or gateway request
+	Timeout time.Duration
+	// Template is the store's receipt template (nil for the default layout)
+	Template *models.ReceiptTemplate
+}
+
+// Service renders signed receipts as text and sends them by email or SMS
+type Service struct {
+	email    *emailSender
+	sms      *smsSender
+	loc      *i18n.Localizer
+	template *models.ReceiptTemplate
+	verbose  bool
+}
+
+var _ interfaces.ReceiptDeliverer = (*Service)(nil)
+
+// NewService creates a delivery service writing receipts in loc's language
+func NewService(opts Options, loc *i18n.Localizer, verbose bool) (*Service, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	s := &Service{loc: loc, template: opts.Template, verbose: verbose}
+	if opts.Email.Host != "" {
+		if _, err := mail.ParseAddress(opts.Email.From); err != nil {
+			return nil, fmt.Errorf("invalid email from address %q: %v", opts.Email.From, err)
+		}
+		s.email = newEmailSender(opts.Email, opts.Timeout)
+	}
+	if opts.SMS.GatewayURL != "" {
+		s.sms = newSMSSender(opts.SMS, opts.Timeout)
+	}
+	if s.email == nil && s.sms == nil {
+		return nil, fmt.Errorf("no delivery channel configured (set email.smtp_host or sms.gateway_url)")
+	}
+	return s, nil
+}
+
+// Channels lists the configured channels
+func (s *Service) Channels() []string {
+	var channels []string
+	if s.email != nil {
+		channels = append(channels, models.DeliveryEmail)
+	}
+	if s.sms != nil {
+		channels = append(channels, models.DeliverySMS)
+	}
+	return channels
+}
+
+// Supports reports whether channel is configured
+func (s *Service) Supports(channel string) bool {
+	switch channel {
+	case models.DeliveryEmail:
+		return s.email != nil
+	case models.DeliverySMS:
+		return s.sms != nil
+	}
+	return false
+}
+
+// Deliver sends the receipt. Email carries the printed receipt text, the receipt as a
+// PDF, and the signed binary receipt as an attachment a wallet can import; SMS carries
+// a short summary.
+func (s *Service) Deliver(receipt *models.Receipt, signedReceipt []byte, recipient models.Recipient) error {
+	var err error
+	switch {
+	case recipient.Channel == models.DeliveryEmail && s.email != nil:
+		err = s.email.send(recipient.Address,
+			s.loc.T("delivery.subject", receipt.ReceiptSerial, receipt.StoreName),
+			s.loc.T("delivery.body", receipt.StoreName, AttachmentName(receipt))+"\n\n"+receipt.FormatForDisplay(s.loc, s.template),
+			[]attachment{
+				{name: receiptpdf.FileName(receipt), contentType: "application/pdf", data: receiptpdf.Render(receipt, s.loc, s.template)},
+				{name: AttachmentName(receipt), contentType: "application/octet-stream", data: signedReceipt},
+			})
+	case recipient.Channel == models.DeliverySMS && s.sms != nil:
+		err = s.sms.send(recipient.Address, SMSText(receipt, s.loc))
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedChannel, recipient.Channel)
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.verbose {
+		log.Printf("[DELIVERY] Sent receipt %s by %s to %s", receipt.ReceiptSerial, recipient.Channel, Mask(recipient))
+	}
+	return nil
+}
+
+// AttachmentName is the file name of the signed receipt attached to emails
+func AttachmentName(receipt *models.Receipt) string {
+	return receipt.TransactionID + ".receipt"
+}
+
+// SMSText is the one-message summary sent by SMS
+func SMSText(receipt *models.Receipt, loc *i18n.Localizer) string {
+	payment := receipt.PaymentMethod
+	if key := "payment." + payment; loc.Has(key) {
+		payment = loc.T(key)
+	}
+	return loc.T("delivery.sms", receipt.StoreName, receipt.ReceiptSerial,
+		loc.Amount(receipt.TotalAmount), payment, receipt.TransactionID)
+}
+
+// ParseRecipient validates the contact given at the register; exactly one of
+// email and phone must be set. Phone numbers keep their digits and a leading +.
+func ParseRecipient(email, phone string) (*models.Recipient, error) {
+	email, phone = strings.TrimSpace(email), strings.TrimSpace(phone)
+	switch {
+	case email != "" && phone != "":
+		return nil, fmt.Errorf("give either an email address or a phone number, not both")
+	case email != "":
+		address, err := mail.ParseAddress(email)
+		if err != nil || address.Name != "" {
+			return nil, fmt.Errorf("invalid email address %q", email)
+		}
+		return &models.Recipient{Channel: models.DeliveryEmail, Address: address.Address}, nil
+	case phone != "":
+		var digits strings.Builder
+		for i, r := range phone {
+			switch {
+			case r >= '0' && r <= '9':
+				digits.WriteRune(r)
+			case r == '+' && i == 0:
+				digits.WriteRune(r)
+			case r == ' ' || r == '-' || r == '(' || r == ')':
+			default:
+				return nil, fmt.Errorf("invalid phone number %q", phone)
+			}
+		}
+		number := digits.String()
+		if n := len(strings.TrimPrefix(number, "+")); n < 7 || n > 15 {
+			return nil, fmt.Errorf("invalid phone number %q", phone)
+		}
+		return &models.Recipient{Channel: models.DeliverySMS, Address: number}, nil
+	}
+	return nil, nil
+}
+
+// Mask hides most of a recipient's address for logs and history:
+// "a***@example.com", "+90*******67"
+func Mask(recipient models.Recipient) string {
+	address := recipient.Address
+	if recipient.Channel == models.DeliveryEmail {
+		at := strings.LastIndex(address, "@")
+		if at < 1 {
+			return "***"
+		}
+		return address[:1] + "***" + address[at:]
+	}
+
+	prefix := ""
+	if strings.HasPrefix(address, "+") && len(address) > 5 {
+		prefix, address = address[:3], address[3:]
+	}
+	if len(address) <= 2 {
+		return prefix + strings.Repeat("*", len(address))
+	}
+	return prefix + strings.Repeat("*", len(address)-2) + address[len(address)-2:]
+}
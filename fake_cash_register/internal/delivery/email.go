@@ -0,0 +1,160 @@
+package delivery
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// EmailOptions configures the SMTP server receipts are sent through
+type EmailOptions struct {
+	Host        string
+	Port        int // Default 587, or 465 with ImplicitTLS
+	Username    string
+	Password    string
+	From        string
+	ImplicitTLS bool // TLS from the first byte (port 465) instead of STARTTLS
+}
+
+// attachment is a file attached to a receipt email
+type attachment struct {
+	name        string
+	contentType string
+	data        []byte
+}
+
+type emailSender struct {
+	opts    EmailOptions
+	timeout time.Duration
+}
+
+func newEmailSender(opts EmailOptions, timeout time.Duration) *emailSender {
+	if opts.Port == 0 {
+		opts.Port = 587
+		if opts.ImplicitTLS {
+			opts.Port = 465
+		}
+	}
+	return &emailSender{opts: opts, timeout: timeout}
+}
+
+// send delivers a text message with its attachments. STARTTLS is used whenever
+// the server offers it; credentials are only sent over TLS.
+func (e *emailSender) send(to, subject, body string, attachments []attachment) error {
+	message, err := buildMessage(e.opts.From, to, subject, body, attachments)
+	if err != nil {
+		return err
+	}
+
+	address := net.JoinHostPort(e.opts.Host, strconv.Itoa(e.opts.Port))
+	tlsConfig := &tls.Config{ServerName: e.opts.Host}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: e.timeout}
+	if e.opts.ImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server %s: %v", address, err)
+	}
+	conn.SetDeadline(time.Now().Add(e.timeout))
+
+	client, err := smtp.NewClient(conn, e.opts.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake with %s failed: %v", address, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !e.opts.ImplicitTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("SMTP STARTTLS failed: %v", err)
+		}
+	}
+	if e.opts.Username != "" {
+		// PlainAuth refuses to send credentials over an unencrypted connection
+		// except to localhost
+		if err := client.Auth(smtp.PlainAuth("", e.opts.Username, e.opts.Password, e.opts.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %v", err)
+		}
+	}
+
+	if err := client.Mail(e.opts.From); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM rejected: %v", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("SMTP RCPT TO rejected: %v", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA rejected: %v", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("failed to send message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server did not accept the message: %v", err)
+	}
+	return client.Quit()
+}
+
+// buildMessage writes a multipart/mixed message: the UTF-8 text body and the attachments
+func buildMessage(from, to, subject, body string, attachments []attachment) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+
+	text, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(text)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range attachments {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(attachment.data)
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", encoded)
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
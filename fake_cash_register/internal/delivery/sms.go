@@ -0,0 +1,63 @@
+package delivery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SMSOptions configures the HTTP SMS gateway. Messages are posted as JSON
+// {"to", "from", "text"}; any 2xx response counts as accepted.
+type SMSOptions struct {
+	GatewayURL string
+	APIKey     string // Sent as "Authorization: Bearer <key>" when set
+	Sender     string // Sender ID shown to the customer
+}
+
+// SMSMessage is the JSON body posted to the gateway
+type SMSMessage struct {
+	To   string `json:"to"`
+	From string `json:"from,omitempty"`
+	Text string `json:"text"`
+}
+
+type smsSender struct {
+	opts       SMSOptions
+	httpClient *http.Client
+}
+
+func newSMSSender(opts SMSOptions, timeout time.Duration) *smsSender {
+	return &smsSender{opts: opts, httpClient: &http.Client{Timeout: timeout}}
+}
+
+func (s *smsSender) send(to, text string) error {
+	body, err := json.Marshal(SMSMessage{To: to, From: s.opts.Sender, Text: text})
+	if err != nil {
+		return fmt.Errorf("failed to encode SMS: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.opts.GatewayURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create SMS request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.opts.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.opts.APIKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call SMS gateway: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("SMS gateway returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
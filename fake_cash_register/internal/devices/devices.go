@@ -0,0 +1,145 @@
+// Package devices drives the checkout hardware around the register: the cash drawer,
+// opened by a pulse from the receipt printer's drawer port (ESCPOS) or from a GPIO
+// line wired to the drawer's solenoid (GPIO), and the beeper confirming scanned items
+// and refused entries.
+package devices
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"fake-cash-register/internal/interfaces"
+)
+
+// Beep signals
+const (
+	BeepItem  = "item"  // An item was added to the sale
+	BeepError = "error" // An item was refused or issuing failed
+)
+
+// Drivers
+const (
+	DriverMock   = "mock"
+	DriverESCPOS = "escpos"
+	DriverGPIO   = "gpio"
+)
+
+// DefaultPulse is how long the drawer solenoid is energized
+const DefaultPulse = 100 * time.Millisecond
+
+// gpioRoot is the sysfs GPIO directory
+const gpioRoot = "/sys/class/gpio"
+
+// beepCount is the number of beeps per signal; errors are hard to miss
+var beepCount = map[string]int{BeepItem: 1, BeepError: 3}
+
+// ESCPOS drives a drawer and beeper connected to an ESC/POS receipt printer
+type ESCPOS struct {
+	device string // Printer port, e.g. /dev/usb/lp0
+	pulse  time.Duration
+	mu     sync.Mutex // One command at a time on the port
+}
+
+var (
+	_ interfaces.DeviceController = (*ESCPOS)(nil)
+	_ interfaces.DeviceController = (*GPIO)(nil)
+)
+
+// NewESCPOS creates a controller sending commands to the printer at device
+func NewESCPOS(device string, pulse time.Duration) *ESCPOS {
+	if pulse <= 0 {
+		pulse = DefaultPulse
+	}
+	return &ESCPOS{device: device, pulse: pulse}
+}
+
+// OpenDrawer pulses drawer kick-out connector pin 2 (ESC p 0 t1 t2; times in 2 ms units)
+func (e *ESCPOS) OpenDrawer() error {
+	on := min(int(e.pulse/(2*time.Millisecond)), 255)
+	return e.write([]byte{0x1b, 0x70, 0, byte(on), byte(on)})
+}
+
+// Beep sounds the printer's buzzer (ESC B n t: n beeps of t x 50 ms)
+func (e *ESCPOS) Beep(signal string) error {
+	count, ok := beepCount[signal]
+	if !ok {
+		return fmt.Errorf("unknown beep signal %q", signal)
+	}
+	return e.write([]byte{0x1b, 0x42, byte(count), 1})
+}
+
+func (e *ESCPOS) write(command []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	port, err := os.OpenFile(e.device, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := port.Write(command); err != nil {
+		port.Close()
+		return err
+	}
+	return port.Close()
+}
+
+// GPIO drives a drawer solenoid and a buzzer on sysfs GPIO lines
+type GPIO struct {
+	drawerPin int // 0 = no drawer
+	beeperPin int // 0 = no beeper
+	pulse     time.Duration
+	mu        sync.Mutex
+}
+
+// NewGPIO creates a controller for the drawer and beeper on the given GPIO numbers
+// (0 for a device that isn't wired). The lines must be exported as outputs beforehand,
+// e.g. echo 17 > /sys/class/gpio/export; echo out > /sys/class/gpio/gpio17/direction.
+func NewGPIO(drawerPin, beeperPin int, pulse time.Duration) *GPIO {
+	if pulse <= 0 {
+		pulse = DefaultPulse
+	}
+	return &GPIO{drawerPin: drawerPin, beeperPin: beeperPin, pulse: pulse}
+}
+
+// OpenDrawer energizes the drawer solenoid for one pulse
+func (g *GPIO) OpenDrawer() error {
+	if g.drawerPin == 0 {
+		return fmt.Errorf("no drawer GPIO configured")
+	}
+	return g.pulses(g.drawerPin, 1)
+}
+
+// Beep sounds the buzzer once per beep of the signal
+func (g *GPIO) Beep(signal string) error {
+	count, ok := beepCount[signal]
+	if !ok {
+		return fmt.Errorf("unknown beep signal %q", signal)
+	}
+	if g.beeperPin == 0 {
+		return nil
+	}
+	return g.pulses(g.beeperPin, count)
+}
+
+func (g *GPIO) pulses(pin, count int) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	value := gpioRoot + "/gpio" + strconv.Itoa(pin) + "/value"
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(g.pulse)
+		}
+		if err := os.WriteFile(value, []byte("1"), 0); err != nil {
+			return err
+		}
+		time.Sleep(g.pulse)
+		if err := os.WriteFile(value, []byte("0"), 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
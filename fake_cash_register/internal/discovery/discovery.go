@@ -0,0 +1,163 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"receiptwallet/receiptbank"
+
+	"github.com/hashicorp/mdns"
+)
+
+// ServiceName is the DNS-SD service type advertised by the receipt bank
+const ServiceName = "_receipt-bank._tcp"
+
+// Resolver locates a receipt bank on the LAN via mDNS and falls back to a static URL
+type Resolver struct {
+	mu          sync.RWMutex
+	current     string
+	fallbackURL string
+	timeout     time.Duration
+	httpClient  *http.Client
+	stop        chan struct{}
+	verbose     bool
+}
+
+// NewResolver creates a resolver that uses fallbackURL until a receipt bank is discovered
+func NewResolver(fallbackURL string, timeout time.Duration, verbose bool) *Resolver {
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	return &Resolver{
+		current:     fallbackURL,
+		fallbackURL: fallbackURL,
+		timeout:     timeout,
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+		verbose: verbose,
+	}
+}
+
+// URL returns the currently selected receipt bank endpoint
+func (r *Resolver) URL() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// Resolve browses for receipt banks and selects the first healthy one.
+// If none answers, the configured fallback URL is used.
+func (r *Resolver) Resolve() string {
+	selected := r.fallbackURL
+	source := "fallback"
+
+	for _, candidate := range r.browse() {
+		if r.healthy(candidate) {
+			selected = candidate
+			source = "mDNS"
+			break
+		}
+		if r.verbose {
+			log.Printf("[DISCOVERY] Skipping unhealthy receipt bank at %s", candidate)
+		}
+	}
+
+	r.mu.Lock()
+	changed := r.current != selected
+	r.current = selected
+	r.mu.Unlock()
+
+	if changed || r.verbose {
+		log.Printf("[DISCOVERY] Using receipt bank %s (%s)", selected, source)
+	}
+
+	return selected
+}
+
+// StartHealthCheck periodically checks the selected endpoint and re-resolves when it is unhealthy
+func (r *Resolver) StartHealthCheck(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	r.stop = make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				current := r.URL()
+				if !r.healthy(current) {
+					log.Printf("[DISCOVERY] Receipt bank %s failed health check, re-resolving", current)
+					r.Resolve()
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the background health check
+func (r *Resolver) Stop() {
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// browse returns base URLs of receipt banks answering the mDNS query
+func (r *Resolver) browse() []string {
+	entries := make(chan *mdns.ServiceEntry, 8)
+	var urls []string
+
+	done := make(chan struct{})
+	go func() {
+		for entry := range entries {
+			addr := entry.AddrV4
+			if addr == nil {
+				addr = entry.AddrV6
+			}
+			if addr == nil {
+				continue
+			}
+			urls = append(urls, fmt.Sprintf("http://%s", net.JoinHostPort(addr.String(), strconv.Itoa(entry.Port))))
+		}
+		close(done)
+	}()
+
+	params := mdns.DefaultParams(ServiceName)
+	params.Entries = entries
+	params.Timeout = r.timeout
+	params.DisableIPv6 = true
+
+	if err := mdns.Query(params); err != nil && r.verbose {
+		log.Printf("[DISCOVERY] mDNS query failed: %v", err)
+	}
+	close(entries)
+	<-done
+
+	if r.verbose {
+		log.Printf("[DISCOVERY] mDNS found %d receipt bank(s)", len(urls))
+	}
+
+	return urls
+}
+
+// healthy reports whether the receipt bank at baseURL answers its health endpoint
+func (r *Resolver) healthy(baseURL string) bool {
+	if baseURL == "" {
+		return false
+	}
+	_, err := receiptbank.NewClient(baseURL, r.httpClient).Health(context.Background())
+	return err == nil
+}
@@ -0,0 +1,227 @@
+package display
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"fake-cash-register/internal/currency"
+	"fake-cash-register/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// Display events streamed to customer-facing screens
+const (
+	EventIdle           = "idle"
+	EventStarted        = "started"
+	EventItemAdded      = "item_added"
+	EventItemRemoved    = "item_removed"
+	EventPaymentPrompt  = "payment_prompt"
+	EventProcessing     = "processing"
+	EventIssued         = "issued"
+	EventIssueFailed    = "issue_failed"
+	EventCancelled      = "cancelled"
+	EventReceiptCollect = "receipt_collected"
+)
+
+const (
+	clientBufferSize = 16
+	writeTimeout     = 5 * time.Second
+	pingInterval     = 30 * time.Second
+)
+
+// State is the snapshot of the sale sent to display clients
+type State struct {
+	Event         string             `json:"event"`
+	Items         []models.Item      `json:"items"`
+	Surcharges    []models.Surcharge `json:"surcharges,omitempty"`
+	ItemCount     int                `json:"item_count"`
+	Total         float64            `json:"total"`
+	TotalTax      float64            `json:"total_tax,omitempty"`
+	PaymentMethod string             `json:"payment_method,omitempty"`
+	ReceiptSerial string             `json:"receipt_serial,omitempty"`
+	Currency      string             `json:"currency,omitempty"`
+	ExchangeRate  float64            `json:"exchange_rate,omitempty"`
+	ForeignTotal  float64            `json:"foreign_total,omitempty"`
+	MessageKey    string             `json:"message_key,omitempty"` // Catalog key so displays can show Message in their own language
+	Message       string             `json:"message,omitempty"`
+	Timestamp     time.Time          `json:"timestamp"`
+}
+
+// Hub fans transaction state out to connected customer displays
+type Hub struct {
+	mu       sync.Mutex
+	clients  map[chan State]struct{}
+	last     State
+	upgrader websocket.Upgrader
+	verbose  bool
+}
+
+// NewHub creates a display hub in the idle state
+func NewHub(verbose bool) *Hub {
+	return &Hub{
+		clients: make(map[chan State]struct{}),
+		last:    State{Event: EventIdle, Items: []models.Item{}, Timestamp: time.Now()},
+		verbose: verbose,
+	}
+}
+
+// Publish broadcasts a new state built from the receipt (nil for an empty sale).
+// message is the text for messageKey in the register's default locale.
+func (h *Hub) Publish(event string, receipt *models.Receipt, messageKey, message string) {
+	state := snapshot(event, receipt, messageKey, message)
+
+	h.mu.Lock()
+	h.last = state
+	for ch := range h.clients {
+		select {
+		case ch <- state:
+		default:
+			// Slow display: drop it rather than block the register
+			delete(h.clients, ch)
+			close(ch)
+			if h.verbose {
+				log.Printf("[DISPLAY] Dropped slow display client")
+			}
+		}
+	}
+	clientCount := len(h.clients)
+	h.mu.Unlock()
+
+	if h.verbose {
+		log.Printf("[DISPLAY] %s -> %d client(s)", event, clientCount)
+	}
+}
+
+// Last returns the most recently published state
+func (h *Hub) Last() State {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.last
+}
+
+// ServeWS upgrades the request to a WebSocket and streams states until the client disconnects
+func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("[DISPLAY] WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	updates := h.subscribe()
+	defer h.unsubscribe(updates)
+
+	if h.verbose {
+		log.Printf("[DISPLAY] Display connected from %s", r.RemoteAddr)
+	}
+
+	// Reader goroutine only detects disconnects; displays never send commands
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case state, ok := <-updates:
+			if !ok {
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteJSON(state); err != nil {
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			if h.verbose {
+				log.Printf("[DISPLAY] Display disconnected from %s", r.RemoteAddr)
+			}
+			return
+		}
+	}
+}
+
+// subscribe registers a client channel primed with the current state
+func (h *Hub) subscribe() chan State {
+	ch := make(chan State, clientBufferSize)
+
+	h.mu.Lock()
+	ch <- h.last
+	h.clients[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch
+}
+
+func (h *Hub) unsubscribe(ch chan State) {
+	h.mu.Lock()
+	if _, ok := h.clients[ch]; ok {
+		delete(h.clients, ch)
+		close(ch)
+	}
+	h.mu.Unlock()
+}
+
+// snapshot copies the receipt so later edits by the register don't race with encoding
+func snapshot(event string, receipt *models.Receipt, messageKey, message string) State {
+	state := State{
+		Event:      event,
+		Items:      []models.Item{},
+		MessageKey: messageKey,
+		Message:    message,
+		Timestamp:  time.Now(),
+	}
+	if receipt == nil {
+		return state
+	}
+
+	state.Items = append(state.Items, receipt.Items...)
+	for _, item := range receipt.Items {
+		if item.Weighed {
+			state.ItemCount++ // A weighed line is one item, whatever it weighs
+		} else {
+			state.ItemCount += item.Quantity
+		}
+		state.Total += item.TotalPrice
+	}
+	state.Surcharges = append(state.Surcharges, receipt.Surcharges...)
+	for _, surcharge := range receipt.Surcharges {
+		state.Total += surcharge.Amount
+	}
+	if receipt.TotalAmount > 0 {
+		state.Total = receipt.TotalAmount
+	}
+	state.TotalTax = receipt.TaxBreakdown.TotalTax
+	state.PaymentMethod = receipt.PaymentMethod
+	state.ReceiptSerial = receipt.ReceiptSerial
+
+	// Foreign currency sales show the converted total; before finalizing it is
+	// an estimate at the rate quoted when the currency was selected
+	if receipt.Currency != "" && receipt.ExchangeRate > 0 {
+		state.Currency = receipt.Currency
+		state.ExchangeRate = receipt.ExchangeRate
+		state.ForeignTotal = receipt.ForeignTotal
+		if state.ForeignTotal == 0 {
+			scale := math.Pow10(currency.MinorUnitExponent(receipt.Currency))
+			state.ForeignTotal = math.Round(state.Total/receipt.ExchangeRate*scale) / scale
+		}
+	}
+
+	return state
+}
@@ -0,0 +1,84 @@
+// Package escpos encodes receipts as ESC/POS commands for thermal receipt printers. It
+// prints the printer-style text layout (models.PrintLines) in code page PC857, so
+// Turkish letters print correctly, with the totals emphasized, the store's stored
+// logo in place of the template's logo placeholder, and a paper cut at the end.
+package escpos
+
+import (
+	"bytes"
+
+	"fake-cash-register/internal/i18n"
+	"fake-cash-register/internal/models"
+)
+
+var (
+	cmdInit        = []byte{0x1b, 0x40}             // ESC @: reset the printer
+	cmdCodePage    = []byte{0x1b, 0x74, 13}         // ESC t 13: PC857 Turkish
+	cmdBoldOn      = []byte{0x1b, 0x45, 1}          // ESC E 1
+	cmdBoldOff     = []byte{0x1b, 0x45, 0}          // ESC E 0
+	cmdAlignCenter = []byte{0x1b, 0x61, 1}          // ESC a 1
+	cmdAlignLeft   = []byte{0x1b, 0x61, 0}          // ESC a 0
+	cmdPrintLogo   = []byte{0x1c, 0x70, 1, 0}       // FS p 1 0: NV logo 1 at normal size
+	cmdFeed        = []byte{0x1b, 0x64, 4}          // ESC d 4: feed past the cutter
+	cmdCut         = []byte{0x1d, 0x56, 0x42, 0x00} // GS V B 0: partial cut
+)
+
+// pc857 maps the non-ASCII letters of Turkish receipts to code page 857
+var pc857 = map[rune]byte{
+	'Ç': 0x80, 'ü': 0x81, 'é': 0x82, 'â': 0x83, 'ç': 0x87, 'î': 0x8c, 'ı': 0x8d,
+	'ö': 0x94, 'û': 0x96, 'İ': 0x98, 'Ö': 0x99, 'Ü': 0x9a, 'Ş': 0x9e, 'ş': 0x9f,
+	'Ğ': 0xa6, 'ğ': 0xa7,
+}
+
+// Render encodes the receipt for a printer with models.ReceiptWidth columns, in loc's
+// language and with the store's template (nil for the default layout)
+func Render(receipt *models.Receipt, loc *i18n.Localizer, tmpl *models.ReceiptTemplate) []byte {
+	var b bytes.Buffer
+	b.Write(cmdInit)
+	b.Write(cmdCodePage)
+
+	logoPrinted := false
+	for _, line := range receipt.PrintLines(loc, tmpl) {
+		switch {
+		case line.Logo:
+			// One stored logo stands in for however many placeholder lines there are
+			if !logoPrinted {
+				b.Write(cmdAlignCenter)
+				b.Write(cmdPrintLogo)
+				b.Write(cmdAlignLeft)
+				logoPrinted = true
+			}
+		case line.Bold:
+			b.Write(cmdBoldOn)
+			b.Write(encode(line.Format()))
+			b.Write(cmdBoldOff)
+		default:
+			b.Write(encode(line.Format()))
+		}
+	}
+
+	b.Write(cmdFeed)
+	b.Write(cmdCut)
+	return b.Bytes()
+}
+
+// FileName is the download name of a receipt's ESC/POS print job
+func FileName(receipt *models.Receipt) string {
+	return receipt.TransactionID + ".escpos"
+}
+
+// encode converts text to PC857, replacing characters the code page lacks with '?'
+func encode(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r < 0x80:
+			encoded = append(encoded, byte(r))
+		case pc857[r] != 0:
+			encoded = append(encoded, pc857[r])
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
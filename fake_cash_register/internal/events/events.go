@@ -0,0 +1,221 @@
+// Package events streams the register's transaction lifecycle to any client as
+// Server-Sent Events, so the web UI, external displays and scripts can follow a sale
+// without polling /api/transaction/current.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"fake-cash-register/internal/models"
+)
+
+// Event types
+const (
+	TypeStarted          = "started"
+	TypeItemAdded        = "item_added"
+	TypePaymentSet       = "payment_set"
+	TypeIssued           = "issued"
+	TypeFailed           = "failed"
+	TypeVetoed           = "vetoed" // A lifecycle hook rejected the receipt
+	TypeWebhookConfirmed = "webhook_confirmed"
+	TypeHeld             = "held"     // Sale parked; the register is free
+	TypeRecalled         = "recalled" // Held sale resumed, with its items
+)
+
+const (
+	clientBufferSize  = 32
+	historySize       = 100 // Recent events replayed to clients reconnecting with Last-Event-ID
+	keepAliveInterval = 30 * time.Second
+)
+
+// Event is one step of a transaction. Fields that don't apply to the type are omitted.
+type Event struct {
+	ID            uint64       `json:"id"`
+	Type          string       `json:"type"`
+	TransactionID string       `json:"transaction_id,omitempty"`
+	ReceiptSerial string       `json:"receipt_serial,omitempty"`
+	ReceiptID     string       `json:"receipt_id,omitempty"` // ID submitted to the receipt bank (webhook_confirmed)
+	RefundOf      string       `json:"refund_of,omitempty"`  // Transaction ID of the sale a refund pays back
+	Item          *models.Item `json:"item,omitempty"`
+	ItemCount     int          `json:"item_count"`
+	Total         float64      `json:"total"`
+	PaymentMethod string       `json:"payment_method,omitempty"`
+	Error         string       `json:"error,omitempty"`
+	Timestamp     time.Time    `json:"timestamp"`
+}
+
+// FromReceipt fills an event of the given type from the sale (nil for none)
+func FromReceipt(eventType string, receipt *models.Receipt) Event {
+	event := Event{Type: eventType}
+	if receipt == nil {
+		return event
+	}
+
+	event.TransactionID = receipt.TransactionID
+	event.ReceiptSerial = receipt.ReceiptSerial
+	event.PaymentMethod = receipt.PaymentMethod
+	event.ItemCount = len(receipt.Items)
+	if receipt.RefundOf != nil {
+		event.RefundOf = receipt.RefundOf.TransactionID
+	}
+	if receipt.TotalAmount > 0 {
+		event.Total = receipt.TotalAmount
+	} else {
+		for _, item := range receipt.Items {
+			event.Total += item.TotalPrice
+		}
+	}
+	return event
+}
+
+// Broker numbers events and fans them out to connected clients
+type Broker struct {
+	mu      sync.Mutex
+	clients map[chan Event]struct{}
+	history []Event // newest last
+	nextID  uint64
+	verbose bool
+}
+
+// NewBroker creates a broker without clients
+func NewBroker(verbose bool) *Broker {
+	return &Broker{
+		clients: make(map[chan Event]struct{}),
+		nextID:  1,
+		verbose: verbose,
+	}
+}
+
+// Publish stamps event with the next ID and the current time and sends it to every
+// client. It never blocks: slow clients are disconnected and catch up on reconnect.
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	event.ID = b.nextID
+	b.nextID++
+	event.Timestamp = time.Now()
+
+	b.history = append(b.history, event)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+
+	for ch := range b.clients {
+		select {
+		case ch <- event:
+		default:
+			delete(b.clients, ch)
+			close(ch)
+			if b.verbose {
+				log.Printf("[EVENTS] Dropped slow event stream client")
+			}
+		}
+	}
+	clientCount := len(b.clients)
+	b.mu.Unlock()
+
+	if b.verbose {
+		log.Printf("[EVENTS] %s (#%d) -> %d client(s)", event.Type, event.ID, clientCount)
+	}
+}
+
+// ServeSSE streams events as text/event-stream until the client disconnects. A client
+// reconnecting with Last-Event-ID first gets the recent events it missed.
+func (b *Broker) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	missed, updates := b.subscribe(lastID)
+	defer b.unsubscribe(updates)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Keep reverse proxies from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", 3000)
+
+	for _, event := range missed {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	if b.verbose {
+		log.Printf("[EVENTS] Client connected from %s (replayed %d)", r.RemoteAddr, len(missed))
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-updates:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			if b.verbose {
+				log.Printf("[EVENTS] Client disconnected from %s", r.RemoteAddr)
+			}
+			return
+		}
+	}
+}
+
+// writeEvent writes one SSE frame; the event type names it so clients can listen per type
+func writeEvent(w http.ResponseWriter, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// subscribe registers a client channel and returns the retained events after lastID
+func (b *Broker) subscribe(lastID uint64) ([]Event, chan Event) {
+	ch := make(chan Event, clientBufferSize)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var missed []Event
+	if lastID > 0 {
+		for _, event := range b.history {
+			if event.ID > lastID {
+				missed = append(missed, event)
+			}
+		}
+	}
+	b.clients[ch] = struct{}{}
+	return missed, ch
+}
+
+func (b *Broker) unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	if _, ok := b.clients[ch]; ok {
+		delete(b.clients, ch)
+		close(ch)
+	}
+	b.mu.Unlock()
+}
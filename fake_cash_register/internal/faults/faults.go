@@ -0,0 +1,324 @@
+package faults
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/resilience"
+)
+
+// Services faults can be injected into
+const (
+	ServiceRevenueAuthority = "revenue_authority"
+	ServiceReceiptBank      = "receipt_bank"
+)
+
+// Failures a rule or trigger can inject
+const (
+	FailureTimeout     = "timeout"     // Hangs for Rule.Timeout, then fails; retried
+	FailureUnavailable = "unavailable" // 503 Service Unavailable; retried
+	FailureRejected    = "rejected"    // 400 Bad Request; not retried
+	FailureConflict    = "conflict"    // Receipt bank 409 DUPLICATE_RECEIPT; not retried
+)
+
+// DefaultTimeout is how long an injected timeout hangs when the rule sets none
+const DefaultTimeout = 5 * time.Second
+
+// ErrInjected is wrapped by every injected failure
+var ErrInjected = errors.New("injected fault")
+
+// Rule configures the faults injected into one service
+type Rule struct {
+	FailureRate float64       // Fraction of calls that fail, 0 to 1
+	Failure     string        // What a failing call does (default unavailable)
+	Latency     time.Duration // Added to every call
+	Jitter      time.Duration // Up to this much more latency, drawn per call
+	Timeout     time.Duration // How long an injected timeout hangs (default DefaultTimeout)
+}
+
+// ruleJSON is Rule with durations as strings ("250ms"), as the admin API uses them
+type ruleJSON struct {
+	FailureRate float64 `json:"failure_rate"`
+	Failure     string  `json:"failure,omitempty"`
+	Latency     string  `json:"latency,omitempty"`
+	Jitter      string  `json:"jitter,omitempty"`
+	Timeout     string  `json:"timeout,omitempty"`
+}
+
+func (r Rule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ruleJSON{
+		FailureRate: r.FailureRate,
+		Failure:     r.Failure,
+		Latency:     formatDuration(r.Latency),
+		Jitter:      formatDuration(r.Jitter),
+		Timeout:     formatDuration(r.Timeout),
+	})
+}
+
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	var raw ruleJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	rule := Rule{FailureRate: raw.FailureRate, Failure: raw.Failure}
+	for _, field := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"latency", raw.Latency, &rule.Latency},
+		{"jitter", raw.Jitter, &rule.Jitter},
+		{"timeout", raw.Timeout, &rule.Timeout},
+	} {
+		if field.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", field.name, err)
+		}
+		*field.dst = d
+	}
+	*r = rule
+	return nil
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// Stats counts the calls to one service and the failures injected into them
+type Stats struct {
+	Calls     int64            `json:"calls"`
+	Injected  int64            `json:"injected"`
+	ByFailure map[string]int64 `json:"by_failure"`
+	Queued    []string         `json:"queued"` // Triggered failures still to come, in order
+}
+
+// Injector makes the mock services slow or failing, so the UI and the retry logic
+// can be exercised in standalone mode. With a fixed seed the same calls fail on
+// every run.
+type Injector struct {
+	mu      sync.Mutex
+	rules   map[string]Rule
+	queued  map[string][]string
+	stats   map[string]*Stats
+	rng     *rand.Rand
+	seed    uint64
+	sleep   func(time.Duration)
+	verbose bool
+}
+
+// NewInjector creates an injector without rules. Seed 0 picks a random seed.
+func NewInjector(seed uint64, verbose bool) *Injector {
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return &Injector{
+		rules:   make(map[string]Rule),
+		queued:  make(map[string][]string),
+		stats:   make(map[string]*Stats),
+		rng:     rand.New(rand.NewPCG(seed, seed)),
+		seed:    seed,
+		sleep:   time.Sleep,
+		verbose: verbose,
+	}
+}
+
+// Seed returns the seed the failures are drawn with
+func (i *Injector) Seed() uint64 {
+	return i.seed
+}
+
+// SetRule replaces a service's rule; a zero Rule turns its faults off
+func (i *Injector) SetRule(service string, rule Rule) error {
+	if err := validService(service); err != nil {
+		return err
+	}
+	if rule.FailureRate < 0 || rule.FailureRate > 1 {
+		return fmt.Errorf("failure_rate must be between 0 and 1")
+	}
+	if rule.Latency < 0 || rule.Jitter < 0 || rule.Timeout < 0 {
+		return fmt.Errorf("latency, jitter and timeout must not be negative")
+	}
+	if rule.Failure == "" {
+		rule.Failure = FailureUnavailable
+	}
+	if err := validFailure(service, rule.Failure); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	i.rules[service] = rule
+	i.mu.Unlock()
+
+	if i.verbose {
+		log.Printf("[FAULTS] %s: %.0f%% %s, latency %v (+%v jitter)", service, rule.FailureRate*100, rule.Failure, rule.Latency, rule.Jitter)
+	}
+	return nil
+}
+
+// Rules returns the rule of every service
+func (i *Injector) Rules() map[string]Rule {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	rules := make(map[string]Rule, len(i.rules))
+	for service, rule := range i.rules {
+		rules[service] = rule
+	}
+	return rules
+}
+
+// Trigger makes the next count calls to service fail with failure, whatever its rule
+func (i *Injector) Trigger(service, failure string, count int) error {
+	if err := validService(service); err != nil {
+		return err
+	}
+	if err := validFailure(service, failure); err != nil {
+		return err
+	}
+	if count < 1 {
+		return fmt.Errorf("count must be at least 1")
+	}
+
+	i.mu.Lock()
+	i.statsFor(service)
+	for n := 0; n < count; n++ {
+		i.queued[service] = append(i.queued[service], failure)
+	}
+	i.mu.Unlock()
+
+	if i.verbose {
+		log.Printf("[FAULTS] %s: next %d call(s) fail with %s", service, count, failure)
+	}
+	return nil
+}
+
+// Reset removes all rules and triggered failures; the statistics are kept
+func (i *Injector) Reset() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.rules = make(map[string]Rule)
+	i.queued = make(map[string][]string)
+}
+
+// Stats returns the statistics of every service called or triggered so far
+func (i *Injector) Stats() map[string]Stats {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	stats := make(map[string]Stats, len(i.stats))
+	for service, s := range i.stats {
+		byFailure := make(map[string]int64, len(s.ByFailure))
+		for failure, n := range s.ByFailure {
+			byFailure[failure] = n
+		}
+		stats[service] = Stats{
+			Calls:     s.Calls,
+			Injected:  s.Injected,
+			ByFailure: byFailure,
+			Queued:    append([]string{}, i.queued[service]...),
+		}
+	}
+	return stats
+}
+
+// Inject is called by a mock service before doing its work: it waits out the
+// injected latency and returns the injected failure, if any. A nil injector does nothing.
+func (i *Injector) Inject(service string) error {
+	if i == nil {
+		return nil
+	}
+
+	i.mu.Lock()
+	rule := i.rules[service]
+	s := i.statsFor(service)
+	s.Calls++
+
+	failure := ""
+	if queued := i.queued[service]; len(queued) > 0 {
+		failure, i.queued[service] = queued[0], queued[1:]
+	} else if rule.FailureRate > 0 && i.rng.Float64() < rule.FailureRate {
+		failure = rule.Failure
+	}
+	delay := rule.Latency
+	if rule.Jitter > 0 {
+		delay += time.Duration(i.rng.Int64N(int64(rule.Jitter)))
+	}
+	if failure != "" {
+		s.Injected++
+		s.ByFailure[failure]++
+	}
+	i.mu.Unlock()
+
+	if delay > 0 {
+		i.sleep(delay)
+	}
+	if failure == "" {
+		return nil
+	}
+
+	if i.verbose {
+		log.Printf("[FAULTS] Injecting %s into %s", failure, service)
+	}
+	return failureError(service, failure, rule.Timeout, i.sleep)
+}
+
+// statsFor returns a service's statistics; the caller must hold the lock
+func (i *Injector) statsFor(service string) *Stats {
+	s, exists := i.stats[service]
+	if !exists {
+		s = &Stats{ByFailure: make(map[string]int64)}
+		i.stats[service] = s
+	}
+	return s
+}
+
+// failureError acts out a failure the way the real service's client reports it
+func failureError(service, failure string, timeout time.Duration, sleep func(time.Duration)) error {
+	switch failure {
+	case FailureTimeout:
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+		sleep(timeout)
+		return fmt.Errorf("%w: %s did not answer within %v", ErrInjected, service, timeout)
+	case FailureRejected:
+		return resilience.Permanent(fmt.Errorf("%w: %s rejected the request (400)", ErrInjected, service))
+	case FailureConflict:
+		return resilience.Permanent(fmt.Errorf("%w: %w (409)", ErrInjected, interfaces.ErrDuplicateReceipt))
+	default:
+		return fmt.Errorf("%w: %s unavailable (503)", ErrInjected, service)
+	}
+}
+
+func validService(service string) error {
+	if service != ServiceRevenueAuthority && service != ServiceReceiptBank {
+		return fmt.Errorf("unknown service %q (valid: %s, %s)", service, ServiceRevenueAuthority, ServiceReceiptBank)
+	}
+	return nil
+}
+
+func validFailure(service, failure string) error {
+	switch failure {
+	case FailureTimeout, FailureUnavailable, FailureRejected:
+		return nil
+	case FailureConflict:
+		if service == ServiceReceiptBank {
+			return nil
+		}
+		return fmt.Errorf("failure %q only applies to %s", failure, ServiceReceiptBank)
+	}
+	return fmt.Errorf("unknown failure %q (valid: timeout, unavailable, rejected, conflict)", failure)
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// GET /api/audit - Query the audit trail, oldest first
+// Query: type, transaction_id, after (sequence number), from/to (RFC 3339 or YYYY-MM-DD), limit
+func (h *CashRegisterHandler) GetAuditLog(c *gin.Context) {
+	auditLog := h.cashRegister.Audit()
+	if auditLog == nil {
+		c.JSON(http.StatusNotFound, api.APIError{
+			Error: "Audit trail is not enabled",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	query := audit.Query{
+		Type:          c.Query("type"),
+		TransactionID: c.Query("transaction_id"),
+		Limit:         defaultAuditLimit,
+	}
+
+	var err error
+	if v := c.Query("after"); v != "" {
+		if query.AfterSequence, err = strconv.ParseUint(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, api.APIError{
+				Error: "after must be a sequence number",
+				Code:  api.ErrorCodeInvalidRequest,
+			})
+			return
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxAuditLimit {
+			c.JSON(http.StatusBadRequest, api.APIError{
+				Error: "limit must be between 1 and " + strconv.Itoa(maxAuditLimit),
+				Code:  api.ErrorCodeInvalidRequest,
+			})
+			return
+		}
+		query.Limit = n
+	}
+	if query.From, err = parseExportTime(c.Query("from"), false); err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error:   "Invalid from parameter",
+			Code:    api.ErrorCodeInvalidRequest,
+			Details: err.Error(),
+		})
+		return
+	}
+	if query.To, err = parseExportTime(c.Query("to"), true); err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error:   "Invalid to parameter",
+			Code:    api.ErrorCodeInvalidRequest,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	events := auditLog.Query(query)
+	headSequence, headHash := auditLog.Head()
+
+	c.JSON(http.StatusOK, gin.H{
+		"events":        events,
+		"count":         len(events),
+		"head_sequence": headSequence,
+		"head_hash":     headHash,
+	})
+}
+
+// GET /api/audit/verify - Check the audit trail's hash chain
+func (h *CashRegisterHandler) VerifyAuditLog(c *gin.Context) {
+	auditLog := h.cashRegister.Audit()
+	if auditLog == nil {
+		c.JSON(http.StatusNotFound, api.APIError{
+			Error: "Audit trail is not enabled",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	checked, err := auditLog.Verify()
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"valid":  false,
+			"events": checked,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	headSequence, headHash := auditLog.Head()
+	c.JSON(http.StatusOK, gin.H{
+		"valid":         true,
+		"events":        checked,
+		"head_sequence": headSequence,
+		"head_hash":     headHash,
+	})
+}
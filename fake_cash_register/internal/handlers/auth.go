@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API key roles
+const (
+	RoleReadonly   = "readonly"   // GET requests only
+	RoleSales      = "sales"      // Readonly, plus running transactions and reporting scale readings
+	RoleSupervisor = "supervisor" // Sales, plus refunds
+	RoleAdmin      = "admin"      // Everything: Z-report close, rates, stock, ...
+)
+
+// refundPath prefixes the endpoints that start and fill a refund, which pay money out
+const refundPath = "/api/transaction/refund"
+
+// APIKeyHeader carries an API key for clients that don't send Authorization: Bearer
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyContextKey holds the name of the key that authenticated a request
+const apiKeyContextKey = "api_key"
+
+// NewAPIKeyAuth protects the API with the configured keys. Requests from the bundled
+// UI (same origin as the register) get uiRole without a key; "" requires a key from
+// the UI too.
+func NewAPIKeyAuth(keys []config.APIKey, uiRole string, verbose bool) (gin.HandlerFunc, error) {
+	if len(keys) == 0 && uiRole == "" {
+		return nil, fmt.Errorf("no API keys configured and the UI is not exempt")
+	}
+	if uiRole != "" && !validRole(uiRole) {
+		return nil, fmt.Errorf("unknown UI role %q (valid: readonly, sales, supervisor, admin)", uiRole)
+	}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if key.Key == "" {
+			return nil, fmt.Errorf("API key %q has no key", key.Name)
+		}
+		if !validRole(key.Role) {
+			return nil, fmt.Errorf("API key %q has unknown role %q (valid: readonly, sales, supervisor, admin)", key.Name, key.Role)
+		}
+		if seen[key.Key] {
+			return nil, fmt.Errorf("API key %q is listed twice", key.Name)
+		}
+		seen[key.Key] = true
+	}
+
+	return func(c *gin.Context) {
+		name, role, ok := "", "", false
+		if presented := presentedKey(c); presented != "" {
+			name, role, ok = matchKey(keys, presented)
+		} else if uiRole != "" && sameOrigin(c.Request) {
+			name, role, ok = "ui", uiRole, true
+		}
+
+		if !ok {
+			if verbose {
+				log.Printf("[AUTH] Rejected %s %s from %s: missing or unknown API key", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+			}
+			c.Header("WWW-Authenticate", `Bearer realm="cash-register"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, api.APIError{
+				Error: "Missing or invalid API key",
+				Code:  api.ErrorCodeUnauthorized,
+			})
+			return
+		}
+
+		if !roleAllows(role, c.Request.Method, c.Request.URL.Path) {
+			if verbose {
+				log.Printf("[AUTH] Refused %s %s for %s (role %s)", c.Request.Method, c.Request.URL.Path, name, role)
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, api.APIError{
+				Error: fmt.Sprintf("Role %s may not %s %s", role, c.Request.Method, c.Request.URL.Path),
+				Code:  api.ErrorCodeForbidden,
+			})
+			return
+		}
+
+		c.Set(apiKeyContextKey, name)
+		c.Next()
+	}, nil
+}
+
+func validRole(role string) bool {
+	return role == RoleReadonly || role == RoleSales || role == RoleSupervisor || role == RoleAdmin
+}
+
+// roleAllows reports whether a role may make a request
+func roleAllows(role, method, path string) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return true
+	}
+	if strings.HasPrefix(path, refundPath) {
+		return role == RoleSupervisor
+	}
+	return (role == RoleSales || role == RoleSupervisor) && (strings.HasPrefix(path, "/api/transaction/") || path == "/api/scale")
+}
+
+// presentedKey reads the key from Authorization: Bearer or X-API-Key
+func presentedKey(c *gin.Context) string {
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return c.GetHeader(APIKeyHeader)
+}
+
+// matchKey finds a presented key, comparing every configured key in constant time
+func matchKey(keys []config.APIKey, presented string) (name, role string, ok bool) {
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare([]byte(key.Key), []byte(presented)) == 1 {
+			name, role, ok = key.Name, key.Role, true
+		}
+	}
+	return name, role, ok
+}
+
+// sameOrigin reports whether a browser sent the request from a page this register
+// served. Browsers set Sec-Fetch-Site, and Origin or Referer on older ones; other
+// clients can forge these, so the UI role should be no more than the UI needs.
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin"
+	}
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return false
+	}
+	u, err := url.Parse(source)
+	return err == nil && u.Host == r.Host
+}
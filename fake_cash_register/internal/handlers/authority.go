@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"strings"
+	"time"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/interfaces"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /api/authority-key - Revenue authority public key, served from the register's cache
+// so wallets can verify receipts from this store while the authority is unreachable
+func (h *CashRegisterHandler) GetAuthorityKey(c *gin.Context) {
+	authority := h.cashRegister.RevenueAuthority()
+	der, err := authority.GetPublicKey()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, api.APIError{
+			Error:   "Revenue authority public key not available yet",
+			Code:    api.ErrorCodeServiceUnavailable,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	sum := sha256.Sum256(der)
+	response := api.AuthorityKeyResponse{
+		PublicKey:    base64.StdEncoding.EncodeToString(der),
+		PublicKeyPEM: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		Fingerprint:  hex.EncodeToString(sum[:]),
+	}
+	if cache, ok := authority.(interfaces.AuthorityKeyCache); ok {
+		fetchedAt, lastErr := cache.PublicKeyStatus()
+		if !fetchedAt.IsZero() {
+			response.FetchedAt = fetchedAt.UTC().Format(time.RFC3339)
+		}
+		if lastErr != nil {
+			response.Stale = true
+			response.Error = lastErr.Error()
+		}
+	}
+
+	// Same entity tag as the authority's /public-key, so wallets can poll cheaply
+	etag := `"` + response.Fingerprint + `"`
+	c.Header("ETag", etag)
+	if etagListed(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// etagListed reports whether an If-None-Match header lists etag, weakly compared, or is "*"
+func etagListed(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/currency"
+	"fake-cash-register/internal/display"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currencyResponse lists the base currency and accepted foreign currencies with current rates
+type currencyResponse struct {
+	Base       string              `json:"base"`
+	Currencies []currency.Currency `json:"currencies"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+}
+
+// GET /api/currency - Base currency and accepted foreign currencies
+func (h *CashRegisterHandler) GetCurrencies(c *gin.Context) {
+	converter := h.cashRegister.CurrencyConverter()
+	if converter == nil {
+		c.JSON(http.StatusServiceUnavailable, api.APIError{
+			Error: "Foreign currencies are not enabled",
+			Code:  api.ErrorCodeServiceUnavailable,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, newCurrencyResponse(converter))
+}
+
+// PUT /api/currency/rates - Update exchange rates of accepted currencies
+func (h *CashRegisterHandler) UpdateRates(c *gin.Context) {
+	converter := h.cashRegister.CurrencyConverter()
+	if converter == nil {
+		c.JSON(http.StatusServiceUnavailable, api.APIError{
+			Error: "Foreign currencies are not enabled",
+			Code:  api.ErrorCodeServiceUnavailable,
+		})
+		return
+	}
+
+	var req struct {
+		Rates map[string]float64 `json:"rates" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "Invalid request format",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	if err := converter.SetRates(req.Rates); err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeValidationFailed,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, newCurrencyResponse(converter))
+}
+
+// POST /api/transaction/currency - Select the currency the customer pays in
+func (h *CashRegisterHandler) SetCurrency(c *gin.Context) {
+	var req struct {
+		Currency string `json:"currency"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "Invalid request format",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	if !h.cashRegister.HasActiveReceipt() {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "No active transaction",
+			Code:  api.ErrorCodeNoActiveReceipt,
+		})
+		return
+	}
+
+	if err := h.cashRegister.SetCurrency(req.Currency); err != nil {
+		if h.writeBusyError(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeValidationFailed,
+		})
+		return
+	}
+
+	receipt := h.cashRegister.CurrentReceipt()
+	if receipt == nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "No active transaction",
+			Code:  api.ErrorCodeNoActiveReceipt,
+		})
+		return
+	}
+	h.publishDisplay(display.EventItemAdded, receipt, "")
+
+	c.JSON(http.StatusOK, gin.H{
+		"currency":      receipt.Currency,
+		"exchange_rate": receipt.ExchangeRate,
+	})
+}
+
+func newCurrencyResponse(converter *currency.Converter) currencyResponse {
+	return currencyResponse{
+		Base:       converter.Base(),
+		Currencies: converter.Currencies(),
+		UpdatedAt:  converter.UpdatedAt(),
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"receiptwallet/qrpayload"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/display"
+	"fake-cash-register/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /api/transaction/virtual_customer - Issue the active receipt to a simulated wallet,
+// then collect, decrypt and verify it to demonstrate the whole pipeline
+// Query: lang for the receipt text (defaults to Accept-Language, then the configured locale)
+func (h *CashRegisterHandler) IssueToVirtualCustomer(c *gin.Context) {
+	if h.customer == nil {
+		c.JSON(http.StatusServiceUnavailable, api.APIError{
+			Error: "Virtual customer is not enabled",
+			Code:  api.ErrorCodeServiceUnavailable,
+		})
+		return
+	}
+
+	if !h.cashRegister.HasActiveReceipt() {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "No active transaction",
+			Code:  api.ErrorCodeNoActiveReceipt,
+		})
+		return
+	}
+
+	wallet, err := h.customer.NewWallet()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeInternalError,
+		})
+		return
+	}
+
+	// Scanned as the register scans a real wallet's QR code
+	scanned, err := qrpayload.Decode(wallet.QRCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeInternalError,
+		})
+		return
+	}
+
+	issued, ok := h.issueCurrentReceipt(c, scanned.EphemeralKey, nil)
+	if !ok {
+		return
+	}
+
+	result, err := h.customer.Collect(wallet)
+	if err != nil {
+		if h.config.Server.Verbose {
+			log.Printf("[HANDLER] Virtual customer could not verify receipt %s: %v", issued.ReceiptSerial, err)
+		}
+		c.JSON(http.StatusInternalServerError, api.APIError{
+			Error:   "Receipt was issued but could not be verified: " + err.Error(),
+			Code:    api.ErrorCodeValidationFailed,
+			Details: issued.ReceiptSerial,
+		})
+		return
+	}
+
+	h.publishDisplay(display.EventReceiptCollect, nil, "display.collected")
+
+	c.JSON(http.StatusOK, models.VirtualCustomerResponse{
+		Issued:         issued,
+		Collected:      result.Receipt,
+		Text:           result.Receipt.FormatForDisplay(h.localizer(c), nil), // The wallet's copy, without the store template
+		EncryptedBytes: result.EncryptedSize,
+		SignedBytes:    result.SignedSize,
+		TimestampToken: result.TimestampToken,
+		DeviceSigned:   result.DeviceSigned,
+		Verified:       true,
+	})
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// csvHeader lists the columns of the sales line export
+var csvHeader = []string{
+	"receipt_serial", "transaction_id", "z_report_number", "timestamp", "store_vkn", "payment_method",
+	"kisim_id", "kisim_name", "quantity", "unit_price", "total_price", "tax_rate",
+	"taxable_amount", "tax_amount", "receipt_total", "note", "customer_tax_number", "customer_name",
+	"refund_of", // Transaction ID of the sale a refund pays back; its amounts are paid out
+}
+
+// GET /api/receipts/export - Export receipt history for bookkeeping
+// Query: format=csv|json, from/to (RFC 3339 or YYYY-MM-DD), page, page_size, archive=zip
+func (h *CashRegisterHandler) ExportReceipts(c *gin.Context) {
+	store := h.cashRegister.History()
+	if store == nil {
+		c.JSON(http.StatusNotFound, api.APIError{
+			Error: "Receipt history is not enabled",
+			Code:  api.ErrorCodeReceiptNotFound,
+		})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "csv" && format != "json" {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "format must be csv or json",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	from, err := parseExportTime(c.Query("from"), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error:   "Invalid from parameter",
+			Code:    api.ErrorCodeInvalidRequest,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	to, err := parseExportTime(c.Query("to"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error:   "Invalid to parameter",
+			Code:    api.ErrorCodeInvalidRequest,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	pageSize := h.config.History.ExportPageSize
+	if pageSize <= 0 {
+		pageSize = 500
+	}
+	if v := c.Query("page_size"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= pageSize {
+			pageSize = n
+		}
+	}
+
+	page := 1
+	if v := c.Query("page"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			page = n
+		}
+	}
+
+	receipts := store.Range(from, to)
+	total := len(receipts)
+
+	// ZIP archives contain the whole range; plain exports are paginated
+	archive := c.Query("archive") == "zip"
+	if !archive {
+		start := (page - 1) * pageSize
+		if start > total {
+			start = total
+		}
+		end := start + pageSize
+		if end > total {
+			end = total
+		}
+		receipts = receipts[start:end]
+
+		c.Header("X-Total-Count", strconv.Itoa(total))
+		c.Header("X-Page", strconv.Itoa(page))
+		c.Header("X-Page-Size", strconv.Itoa(pageSize))
+	}
+
+	filename := "receipts." + format
+	if archive {
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", `attachment; filename="receipts.zip"`)
+		c.Status(http.StatusOK)
+
+		zw := zip.NewWriter(c.Writer)
+		entry, err := zw.Create(filename)
+		if err == nil {
+			err = writeExport(entry, format, receipts)
+		}
+		if err == nil {
+			err = zw.Close()
+		}
+		if err != nil {
+			c.Error(err)
+		}
+		return
+	}
+
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/json")
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	if err := writeExport(c.Writer, format, receipts); err != nil {
+		c.Error(err)
+	}
+}
+
+// writeExport streams receipts as CSV sales lines or a JSON array of receipts
+func writeExport(w io.Writer, format string, receipts []*models.Receipt) error {
+	if format == "csv" {
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+		for _, receipt := range receipts {
+			var customer models.Customer
+			if receipt.Customer != nil {
+				customer = *receipt.Customer
+			}
+			refundOf := ""
+			if receipt.RefundOf != nil {
+				refundOf = receipt.RefundOf.TransactionID
+			}
+			for _, item := range receipt.Items {
+				taxable := item.TotalPrice / (1 + float64(item.TaxRate)/100)
+				if err := cw.Write([]string{
+					receipt.ReceiptSerial,
+					receipt.TransactionID,
+					receipt.ZReportNumber,
+					receipt.Timestamp.Format(time.RFC3339),
+					receipt.StoreVKN,
+					receipt.PaymentMethod,
+					strconv.Itoa(item.KisimID),
+					item.KisimName,
+					exportQuantity(item),
+					formatAmount(item.UnitPrice),
+					formatAmount(item.TotalPrice),
+					strconv.Itoa(item.TaxRate),
+					formatAmount(taxable),
+					formatAmount(item.TotalPrice - taxable),
+					formatAmount(receipt.TotalAmount),
+					item.Note,
+					customer.TaxNumber,
+					customer.Name,
+					refundOf,
+				}); err != nil {
+					return err
+				}
+			}
+			cw.Flush()
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	for i, receipt := range receipts {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err := encoder.Encode(receipt); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
+
+// parseExportTime accepts RFC 3339 timestamps or YYYY-MM-DD dates.
+// Dates used as an upper bound include the whole day.
+func parseExportTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC 3339 or YYYY-MM-DD, got %q", value)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+// exportQuantity is the quantity column: a count, or kilograms on weighed lines
+func exportQuantity(item models.Item) string {
+	if item.Weighed {
+		return strconv.FormatFloat(item.Kilograms(), 'f', 3, 64)
+	}
+	return strconv.Itoa(item.Quantity)
+}
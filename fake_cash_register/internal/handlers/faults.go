@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/faults"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /api/faults - Fault injection rules, failures still queued and what was injected so far
+func (h *CashRegisterHandler) GetFaults(c *gin.Context) {
+	injector, ok := h.faultInjector(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"seed":  injector.Seed(),
+		"rules": injector.Rules(),
+		"stats": injector.Stats(),
+	})
+}
+
+// PUT /api/faults/:service - Replace a mock service's rule:
+// {"failure_rate": 0.3, "failure": "unavailable", "latency": "200ms", "jitter": "100ms"}
+func (h *CashRegisterHandler) SetFaultRule(c *gin.Context) {
+	injector, ok := h.faultInjector(c)
+	if !ok {
+		return
+	}
+
+	var rule faults.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "Invalid request format: " + err.Error(),
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+	if err := injector.SetRule(c.Param("service"), rule); err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": injector.Rules()})
+}
+
+// POST /api/faults/trigger - Fail the next calls to a service whatever its rule:
+// {"service": "receipt_bank", "failure": "conflict", "count": 1}
+func (h *CashRegisterHandler) TriggerFault(c *gin.Context) {
+	injector, ok := h.faultInjector(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Service string `json:"service" binding:"required"`
+		Failure string `json:"failure" binding:"required"`
+		Count   int    `json:"count"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "Invalid request format",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	if err := injector.Trigger(req.Service, req.Failure, req.Count); err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"stats": injector.Stats()})
+}
+
+// DELETE /api/faults - Remove all rules and queued failures
+func (h *CashRegisterHandler) ResetFaults(c *gin.Context) {
+	injector, ok := h.faultInjector(c)
+	if !ok {
+		return
+	}
+
+	injector.Reset()
+	c.Status(http.StatusNoContent)
+}
+
+// faultInjector writes 404 FAULTS_DISABLED unless fault injection is enabled
+func (h *CashRegisterHandler) faultInjector(c *gin.Context) (*faults.Injector, bool) {
+	if h.faults == nil {
+		c.JSON(http.StatusNotFound, api.APIError{
+			Error: "Fault injection is not enabled (standalone mode with faults.enabled only)",
+			Code:  api.ErrorCodeFaultsDisabled,
+		})
+		return nil, false
+	}
+	return h.faults, true
+}
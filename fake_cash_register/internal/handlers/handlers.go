@@ -1,14 +1,32 @@
 package handlers
 
 import (
-	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
 	"log"
 	"net/http"
+	"strings"
+
+	"receiptwallet/qrpayload"
 
 	"fake-cash-register/internal/api"
 	"fake-cash-register/internal/cashregister"
 	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/customer"
+	"fake-cash-register/internal/delivery"
+	"fake-cash-register/internal/display"
+	"fake-cash-register/internal/faults"
+	"fake-cash-register/internal/hooks"
+	"fake-cash-register/internal/i18n"
+	"fake-cash-register/internal/idempotency"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/kisim"
 	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/resilience"
+	"fake-cash-register/internal/stock"
+	"fake-cash-register/internal/taxid"
+	"fake-cash-register/internal/timing"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,31 +34,108 @@ import (
 type CashRegisterHandler struct {
 	cashRegister *cashregister.CashRegister
 	config       *config.Config
+	display      *display.Hub
+	breakers     *resilience.Registry
+	messages     *i18n.Bundle
+	customer     *customer.VirtualCustomer
+	faults       *faults.Injector
+	template     *models.ReceiptTemplate
+	idempotency  *idempotency.Store
+	catalog      *kisim.Catalog
 }
 
 func NewCashRegisterHandler(
 	cashReg *cashregister.CashRegister,
 	cfg *config.Config,
+	messages *i18n.Bundle,
 ) *CashRegisterHandler {
 	return &CashRegisterHandler{
 		cashRegister: cashReg,
 		config:       cfg,
+		messages:     messages,
 	}
 }
 
+// SetDisplay attaches the customer display hub that mirrors the sale
+func (h *CashRegisterHandler) SetDisplay(hub *display.Hub) {
+	h.display = hub
+}
+
+// SetBreakers attaches the external service circuit breakers reported by /api/status
+func (h *CashRegisterHandler) SetBreakers(breakers *resilience.Registry) {
+	h.breakers = breakers
+}
+
+// SetVirtualCustomer lets the register play the customer's wallet in standalone demos
+func (h *CashRegisterHandler) SetVirtualCustomer(vc *customer.VirtualCustomer) {
+	h.customer = vc
+}
+
+// SetFaults exposes the mock services' fault injection under /api/faults
+func (h *CashRegisterHandler) SetFaults(injector *faults.Injector) {
+	h.faults = injector
+}
+
+// SetReceiptTemplate customizes the receipt text, PDF and ESC/POS output for the store
+func (h *CashRegisterHandler) SetReceiptTemplate(tmpl *models.ReceiptTemplate) {
+	h.template = tmpl
+}
+
+// SetCatalog serves the catalog's department keys, grouped and paged, at /api/kisim
+func (h *CashRegisterHandler) SetCatalog(catalog *kisim.Catalog) {
+	h.catalog = catalog
+}
+
 // GET / - Main cash register UI
 func (h *CashRegisterHandler) HomePage(c *gin.Context) {
-	c.HTML(http.StatusOK, "index.html", gin.H{
-		"StoreName":  h.config.Store.Name,
-		"StoreVKN":   h.config.Store.VKN,
-		"Kisim":      h.config.Kisim,
-		"Verbose":    h.config.Server.Verbose,
-		"Standalone": h.config.StandaloneMode,
-	})
+	data := h.pageData(c)
+	data["StoreVKN"] = h.config.Store.VKN
+	data["Kisim"] = h.kisim()
+	data["Verbose"] = h.config.Server.Verbose
+	data["Standalone"] = h.config.StandaloneMode
+	data["VirtualCustomer"] = h.customer != nil
+	c.HTML(http.StatusOK, "index.html", data)
 }
 
-// GET /api/kisim - Get kisim list
+// GET /api/kisim - Get kisim list, grouped and paged for the keypad; ?group=id returns one group
 func (h *CashRegisterHandler) GetKisim(c *gin.Context) {
+	response := models.KisimResponse{
+		Kisim: h.kisim(),
+	}
+	var layout *kisim.Layout
+	if h.catalog != nil {
+		layout = h.catalog.Layout()
+		response.PageSize = layout.PageSize
+		response.Groups = layout.Groups
+		response.Version = h.catalog.Version()
+	}
+	if id := c.Query("group"); id != "" {
+		group, ok := models.KisimGroup{}, false
+		if layout != nil {
+			group, ok = layout.Group(id)
+		}
+		if !ok {
+			c.JSON(http.StatusNotFound, api.APIError{
+				Error: "Unknown KISIM group: " + id,
+				Code:  api.ErrorCodeInvalidRequest,
+			})
+			return
+		}
+		response.Kisim = nil
+		for _, page := range group.Pages {
+			response.Kisim = append(response.Kisim, page.Kisim...)
+		}
+		response.Groups = []models.KisimGroup{group}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// kisim lists the KISIMs of the current catalog, or the configured ones without a catalog
+func (h *CashRegisterHandler) kisim() []models.KisimInfo {
+	if h.catalog != nil {
+		return h.catalog.Kisim()
+	}
 	kisim := make([]models.KisimInfo, len(h.config.Kisim))
 	for i, k := range h.config.Kisim {
 		kisim[i] = models.KisimInfo{
@@ -48,12 +143,10 @@ func (h *CashRegisterHandler) GetKisim(c *gin.Context) {
 			Name:        k.Name,
 			TaxRate:     k.TaxRate,
 			PresetPrice: k.PresetPrice,
+			Weighed:     k.Weighed,
 		}
 	}
-
-	c.JSON(http.StatusOK, models.KisimResponse{
-		Kisim: kisim,
-	})
+	return kisim
 }
 
 // POST /api/transaction/start - Start new transaction
@@ -62,7 +155,17 @@ func (h *CashRegisterHandler) StartTransaction(c *gin.Context) {
 		log.Printf("[HANDLER] Starting new transaction")
 	}
 
-	h.cashRegister.StartNewReceipt()
+	if err := h.cashRegister.StartNewReceipt(); err != nil {
+		if h.writeBusyError(c, err) {
+			return
+		}
+		c.JSON(http.StatusConflict, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeZReportPending,
+		})
+		return
+	}
+	h.publishDisplay(display.EventStarted, h.cashRegister.CurrentReceipt(), "")
 
 	c.Status(http.StatusCreated) // 201 - Receipt created
 }
@@ -71,8 +174,9 @@ func (h *CashRegisterHandler) StartTransaction(c *gin.Context) {
 func (h *CashRegisterHandler) AddItem(c *gin.Context) {
 	var req struct {
 		KisimID   int     `json:"kisim_id" binding:"required"`
-		Quantity  int     `json:"quantity" binding:"required"`
+		Quantity  int     `json:"quantity"`             // Grams for weighed KISIMs; omit to read the scale
 		UnitPrice float64 `json:"unit_price,omitempty"` // Optional custom price
+		Note      string  `json:"note,omitempty"`       // Printed under the line (format v2)
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -83,12 +187,22 @@ func (h *CashRegisterHandler) AddItem(c *gin.Context) {
 		return
 	}
 
-	if !h.cashRegister.HasActiveReceipt() {
-		h.cashRegister.StartNewReceipt()
+	if err := h.cashRegister.EnsureReceipt(); err != nil {
+		if h.writeBusyError(c, err) {
+			return
+		}
+		c.JSON(http.StatusConflict, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeZReportPending,
+		})
+		return
 	}
 
-	err := h.cashRegister.AddItem(req.KisimID, req.Quantity, req.UnitPrice)
+	err := h.cashRegister.AddItemWithNote(req.KisimID, req.Quantity, req.UnitPrice, req.Note)
 	if err != nil {
+		if h.writeBusyError(c, err) || h.writeValidationError(c, err) || h.writeScaleError(c, err) || h.writeRefundError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, api.APIError{
 			Error: err.Error(),
 			Code:  api.ErrorCodeInternalError,
@@ -96,9 +210,62 @@ func (h *CashRegisterHandler) AddItem(c *gin.Context) {
 		return
 	}
 
-	// Return current items after adding
+	current := h.cashRegister.CurrentReceipt()
+	h.publishDisplay(display.EventItemAdded, current, "")
+
+	// Return current items after adding, with the KISIMs the sale would leave low on stock
+	response := gin.H{
+		"items": receiptItems(current),
+	}
+	if warnings := h.cashRegister.StockWarnings(); len(warnings) > 0 {
+		response["stock_warnings"] = warnings
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// POST /api/transaction/remove-item - Void a line of the current transaction
+func (h *CashRegisterHandler) RemoveItem(c *gin.Context) {
+	var req struct {
+		Index *int `json:"index" binding:"required"` // 0-based line in items
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "Invalid request format",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	if !h.cashRegister.HasActiveReceipt() {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "No active transaction",
+			Code:  api.ErrorCodeNoActiveReceipt,
+		})
+		return
+	}
+
+	if err := h.cashRegister.RemoveItem(*req.Index); err != nil {
+		if h.writeBusyError(c, err) {
+			return
+		}
+		status := http.StatusInternalServerError
+		code := api.ErrorCodeInternalError
+		if errors.Is(err, cashregister.ErrNoSuchLine) {
+			status, code = http.StatusNotFound, api.ErrorCodeInvalidRequest
+		}
+		c.JSON(status, api.APIError{
+			Error: err.Error(),
+			Code:  code,
+		})
+		return
+	}
+
+	current := h.cashRegister.CurrentReceipt()
+	h.publishDisplay(display.EventItemRemoved, current, "")
+
 	c.JSON(http.StatusOK, gin.H{
-		"items": h.cashRegister.GetCurrentReceipt().Items,
+		"items": receiptItems(current),
 	})
 }
 
@@ -126,6 +293,9 @@ func (h *CashRegisterHandler) SetPaymentMethod(c *gin.Context) {
 
 	err := h.cashRegister.SetPaymentMethod(req.PaymentMethod)
 	if err != nil {
+		if h.writeBusyError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, api.APIError{
 			Error: err.Error(),
 			Code:  api.ErrorCodeInternalError,
@@ -133,15 +303,20 @@ func (h *CashRegisterHandler) SetPaymentMethod(c *gin.Context) {
 		return
 	}
 
+	h.publishDisplay(display.EventPaymentPrompt, h.cashRegister.CurrentReceipt(), "display.scan_wallet")
+
 	c.JSON(http.StatusOK, gin.H{
 		"payment_method": req.PaymentMethod,
 	})
 }
 
-// POST /api/transaction/issue_receipt - Issue receipt with ephemeral key
+// POST /api/transaction/issue_receipt - Issue receipt with ephemeral key, or send it by
+// email or SMS to customers without the wallet app (email/phone, when delivery is enabled)
 func (h *CashRegisterHandler) IssueReceipt(c *gin.Context) {
 	var req struct {
-		EphemeralKey string `json:"ephemeral_key" binding:"required"`
+		EphemeralKey string `json:"ephemeral_key"`
+		Email        string `json:"email"`
+		Phone        string `json:"phone"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -152,33 +327,43 @@ func (h *CashRegisterHandler) IssueReceipt(c *gin.Context) {
 		return
 	}
 
-	if !h.cashRegister.HasActiveReceipt() {
+	recipient, err := delivery.ParseRecipient(req.Email, req.Phone)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, api.APIError{
-			Error: "No active transaction",
-			Code:  api.ErrorCodeNoActiveReceipt,
+			Error: err.Error(),
+			Code:  api.ErrorCodeInvalidRequest,
 		})
 		return
 	}
 
-	// Parse ephemeral key from base64
-	ephemeralKeyCompressed, err := base64.StdEncoding.DecodeString(req.EphemeralKey)
-	if err != nil {
-		h.cancelTransaction()
+	if !h.cashRegister.HasActiveReceipt() {
 		c.JSON(http.StatusBadRequest, api.APIError{
-			Error: "Invalid ephemeral key format: " + err.Error(),
-			Code:  api.ErrorCodeInvalidKey,
+			Error: "No active transaction",
+			Code:  api.ErrorCodeNoActiveReceipt,
 		})
 		return
 	}
 
-	// Issue receipt (finalize + issue in one atomic operation)
-	receipt, err := h.cashRegister.IssueCurrentReceipt(ephemeralKeyCompressed)
-	if err != nil {
-		h.cancelTransaction()
-		c.JSON(http.StatusInternalServerError, api.APIError{
-			Error: "Receipt issuing failed: " + err.Error(),
-			Code:  api.ErrorCodeInternalError,
-		})
+	// The scanned QR payload, or a bare base64 key from older wallets
+	var ephemeralKeyCompressed []byte
+	if req.EphemeralKey != "" {
+		payload, err := qrpayload.Decode(req.EphemeralKey)
+		if err != nil {
+			h.cancelTransaction()
+			c.JSON(http.StatusBadRequest, api.APIError{
+				Error: "Invalid ephemeral key format: " + err.Error(),
+				Code:  api.ErrorCodeInvalidKey,
+			})
+			return
+		}
+		ephemeralKeyCompressed = payload.EphemeralKey
+		if payload.BankURL != "" && h.config.Server.Verbose {
+			log.Printf("[HANDLER] Wallet collects from %s (receipt goes to the configured bank)", payload.BankURL)
+		}
+	}
+
+	receipt, ok := h.issueCurrentReceipt(c, ephemeralKeyCompressed, recipient)
+	if !ok {
 		return
 	}
 
@@ -188,7 +373,11 @@ func (h *CashRegisterHandler) IssueReceipt(c *gin.Context) {
 
 // POST /api/transaction/cancel - Cancel current transaction
 func (h *CashRegisterHandler) CancelTransaction(c *gin.Context) {
-	h.cancelTransaction()
+	if err := h.cashRegister.CancelCurrentReceipt(); err != nil {
+		h.writeBusyError(c, err)
+		return
+	}
+	h.publishDisplay(display.EventCancelled, nil, "display.cancelled")
 
 	c.Status(http.StatusNoContent) // 204 - No content, operation successful
 }
@@ -203,8 +392,43 @@ func (h *CashRegisterHandler) GetCurrentTransaction(c *gin.Context) {
 		return
 	}
 
+	receipt := h.cashRegister.CurrentReceipt()
+	if receipt == nil {
+		c.JSON(http.StatusNotFound, api.APIError{
+			Error: "No active transaction",
+			Code:  api.ErrorCodeNoActiveReceipt,
+		})
+		return
+	}
+
 	// Return receipt directly
-	c.JSON(http.StatusOK, h.cashRegister.GetCurrentReceipt())
+	c.JSON(http.StatusOK, receipt)
+}
+
+// GET /api/transaction/preview - The receipt issuing would produce now (tax breakdown,
+// totals, amount due, next serial), without issuing it or consuming the serial
+func (h *CashRegisterHandler) PreviewReceipt(c *gin.Context) {
+	preview, err := h.cashRegister.PreviewReceipt()
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, preview)
+	case errors.Is(err, cashregister.ErrNoActiveReceipt):
+		c.JSON(http.StatusNotFound, api.APIError{
+			Error: "No active transaction",
+			Code:  api.ErrorCodeNoActiveReceipt,
+		})
+	case errors.Is(err, cashregister.ErrEmptyReceipt):
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "Add items before previewing the receipt",
+			Code:  api.ErrorCodeValidationFailed,
+		})
+	case h.writeValidationError(c, err):
+	default:
+		c.JSON(http.StatusInternalServerError, api.APIError{
+			Error: "Receipt preview failed: " + err.Error(),
+			Code:  api.ErrorCodeInternalError,
+		})
+	}
 }
 
 // POST /webhook - Receipt bank webhook endpoint
@@ -222,15 +446,25 @@ func (h *CashRegisterHandler) WebhookHandler(c *gin.Context) {
 		return
 	}
 
+	// The bank checks the webhook URL is ours before sending confirmations to it
+	if payload.Type == api.WebhookTypeVerification {
+		if h.config.Server.Verbose {
+			log.Printf("[WEBHOOK] Answered receipt bank verification challenge")
+		}
+		c.JSON(http.StatusOK, api.WebhookChallengeResponse{Challenge: payload.Challenge})
+		return
+	}
+
 	if h.config.Server.Verbose {
-		log.Printf("[WEBHOOK] Received confirmation for receipt %s: %s",
-			payload.ReceiptID, payload.Status)
+		log.Printf("[WEBHOOK] Received confirmation for receipt %s: %s (schema v%d)",
+			payload.ReceiptID, payload.Status, payload.Version())
 	}
 
 	// Confirm the transaction when wallet downloads the receipt
 	if payload.Status == "downloaded" {
-		confirmed := h.cashRegister.ConfirmTransaction(payload.ReceiptID)
+		confirmed := h.cashRegister.HandleDownloadConfirmation(payload) == nil
 		if confirmed {
+			h.publishDisplay(display.EventReceiptCollect, nil, "display.collected")
 			if h.config.Server.Verbose {
 				log.Printf("[WEBHOOK] Transaction %s confirmed successfully", payload.ReceiptID)
 			}
@@ -244,6 +478,70 @@ func (h *CashRegisterHandler) WebhookHandler(c *gin.Context) {
 	c.Status(http.StatusOK) // 200 - Webhook processed successfully
 }
 
+// GET /display - Customer-facing display page
+func (h *CashRegisterHandler) DisplayPage(c *gin.Context) {
+	c.HTML(http.StatusOK, "display.html", h.pageData(c))
+}
+
+// GET /ws/display - WebSocket feed of the current transaction state
+func (h *CashRegisterHandler) DisplayFeed(c *gin.Context) {
+	if h.display == nil {
+		c.JSON(http.StatusServiceUnavailable, api.APIError{
+			Error: "Customer display is not enabled",
+			Code:  api.ErrorCodeServiceUnavailable,
+		})
+		return
+	}
+	h.display.ServeWS(c.Writer, c.Request)
+}
+
+// GET /api/events - Server-Sent Events stream of the transaction lifecycle
+func (h *CashRegisterHandler) EventsFeed(c *gin.Context) {
+	broker := h.cashRegister.Events()
+	if broker == nil {
+		c.JSON(http.StatusServiceUnavailable, api.APIError{
+			Error: "Event stream is not enabled",
+			Code:  api.ErrorCodeServiceUnavailable,
+		})
+		return
+	}
+	broker.ServeSSE(c.Writer, c.Request)
+}
+
+// GET /api/status - External service availability and retry/circuit breaker metrics
+func (h *CashRegisterHandler) GetStatus(c *gin.Context) {
+	services := []resilience.Stats{}
+	if h.breakers != nil {
+		services = h.breakers.Stats()
+	}
+
+	status := "ok"
+	for _, service := range services {
+		if service.State != resilience.StateClosed {
+			status = "degraded"
+		}
+	}
+
+	response := gin.H{
+		"status":          status,
+		"standalone_mode": h.config.StandaloneMode,
+		"services":        services,
+		"transactions":    h.cashRegister.TransactionStats(),
+		"pipeline":        h.cashRegister.Timings().Stats(),
+	}
+	if h.idempotency != nil {
+		response["idempotency"] = h.idempotency.Stats()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GET /metrics - Issuance step timings in the Prometheus text format
+func (h *CashRegisterHandler) Metrics(c *gin.Context) {
+	var b strings.Builder
+	h.cashRegister.Timings().WritePrometheus(&b)
+	c.Data(http.StatusOK, timing.ContentType, []byte(b.String()))
+}
+
 // GET /health - Health check
 func (h *CashRegisterHandler) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -254,10 +552,199 @@ func (h *CashRegisterHandler) HealthCheck(c *gin.Context) {
 }
 
 // Helper methods
+// issueCurrentReceipt issues the active receipt to an ephemeral key, mirroring progress on
+// the customer display. On failure the transaction is cancelled and the error response written.
+func (h *CashRegisterHandler) issueCurrentReceipt(c *gin.Context, ephemeralKeyCompressed []byte, recipient *models.Recipient) (*models.Receipt, bool) {
+	current := h.cashRegister.CurrentReceipt()
+	h.publishDisplay(display.EventProcessing, current, "display.processing")
+
+	// Issue receipt (finalize + issue in one atomic operation)
+	receipt, err := h.cashRegister.IssueCurrentReceiptTo(ephemeralKeyCompressed, recipient)
+	if err != nil {
+		// Another request holds the sale: leave it to that request
+		if h.writeBusyError(c, err) {
+			return nil, false
+		}
+		// The receipt stays open so the operator can void it or start over, and the
+		// display goes back to waiting for the wallet
+		if h.writeValidationError(c, err) {
+			h.publishDisplay(display.EventPaymentPrompt, current, "display.scan_wallet")
+			return nil, false
+		}
+		h.publishDisplay(display.EventIssueFailed, current, "display.issue_failed")
+		h.cancelTransaction()
+		var veto *hooks.VetoError
+		if errors.As(err, &veto) {
+			c.JSON(http.StatusUnprocessableEntity, api.APIError{
+				Error:   "Receipt rejected: " + veto.Err.Error(),
+				Code:    api.ErrorCodeReceiptVetoed,
+				Details: err.Error(),
+			})
+			return nil, false
+		}
+		if errors.Is(err, interfaces.ErrBankInvalidKey) {
+			c.JSON(http.StatusBadRequest, api.APIError{
+				Error: "Receipt issuing failed: " + err.Error(),
+				Code:  api.ErrorCodeInvalidKey,
+			})
+			return nil, false
+		}
+		if errors.Is(err, resilience.ErrCircuitOpen) || errors.Is(err, interfaces.ErrBankRateLimited) || errors.Is(err, interfaces.ErrBankStorageFull) {
+			c.JSON(http.StatusServiceUnavailable, api.APIError{
+				Error: "Receipt issuing failed: " + err.Error(),
+				Code:  api.ErrorCodeServiceUnavailable,
+			})
+			return nil, false
+		}
+		if errors.Is(err, interfaces.ErrBankWebhookUnverified) {
+			c.JSON(http.StatusServiceUnavailable, api.APIError{
+				Error: "Receipt issuing failed: the receipt bank could not reach this register's webhook (check server.webhook_host): " + err.Error(),
+				Code:  api.ErrorCodeWebhookUnverified,
+			})
+			return nil, false
+		}
+		if errors.Is(err, interfaces.ErrIncompatibleBank) {
+			c.JSON(http.StatusServiceUnavailable, api.APIError{
+				Error: "Receipt issuing failed: " + err.Error(),
+				Code:  api.ErrorCodeIncompatibleBank,
+			})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, api.APIError{
+			Error: "Receipt issuing failed: " + err.Error(),
+			Code:  api.ErrorCodeInternalError,
+		})
+		return nil, false
+	}
+
+	messageKey := "display.issued"
+	if recipient != nil {
+		messageKey += "_" + recipient.Channel
+	}
+	h.publishDisplay(display.EventIssued, receipt, messageKey)
+	return receipt, true
+}
+
+// writeValidationError writes an operator-facing response for sales rejected by the
+// validation policy, or without a destination it can reach, and reports whether err was one
+func (h *CashRegisterHandler) writeValidationError(c *gin.Context, err error) bool {
+	var limitErr *cashregister.LimitError
+	var shortage *stock.ShortageError
+	switch {
+	case errors.As(err, &limitErr):
+		l := h.localizer(c)
+		max, value := l.Number(limitErr.Max, 0), l.Number(limitErr.Value, 0)
+		if limitErr.Limit == cashregister.LimitUnitPrice || limitErr.Limit == cashregister.LimitTotal {
+			max, value = l.Amount(limitErr.Max), l.Amount(limitErr.Value)
+		}
+		c.JSON(http.StatusUnprocessableEntity, api.APIError{
+			Error:   l.T("limit."+limitErr.Limit, value, max),
+			Code:    api.ErrorCodeLimitExceeded,
+			Details: err.Error(),
+			Limit:   &api.Limit{Name: limitErr.Limit, Max: limitErr.Max, Value: limitErr.Value},
+		})
+		return true
+	case errors.As(err, &shortage):
+		l := h.localizer(c)
+		c.JSON(http.StatusConflict, api.APIError{
+			Error:   l.T("stock.out_of_stock", shortage.Name, l.Number(float64(shortage.Available), 0), l.Number(float64(shortage.Requested), 0)),
+			Code:    api.ErrorCodeOutOfStock,
+			Details: err.Error(),
+		})
+		return true
+	case errors.Is(err, cashregister.ErrNoDestination):
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "Give the wallet's ephemeral_key, or an email or phone for delivery",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return true
+	case errors.Is(err, cashregister.ErrDeliveryUnavailable):
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeDeliveryUnavailable,
+		})
+		return true
+	case errors.Is(err, cashregister.ErrInvalidQuantity):
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error:   h.localizer(c).T("limit.invalid_quantity"),
+			Code:    api.ErrorCodeValidationFailed,
+			Details: err.Error(),
+		})
+		return true
+	case errors.Is(err, cashregister.ErrInvalidNote), errors.Is(err, cashregister.ErrNotesUnsupported):
+		key := "limit.invalid_note"
+		if errors.Is(err, cashregister.ErrNotesUnsupported) {
+			key = "limit.notes_unsupported"
+		}
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error:   h.localizer(c).T(key),
+			Code:    api.ErrorCodeValidationFailed,
+			Details: err.Error(),
+		})
+		return true
+	case errors.Is(err, taxid.ErrInvalid), errors.Is(err, cashregister.ErrInvalidCustomerName):
+		key := "customer.invalid_tax_number"
+		if errors.Is(err, cashregister.ErrInvalidCustomerName) {
+			key = "customer.invalid_name"
+		}
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error:   h.localizer(c).T(key),
+			Code:    api.ErrorCodeValidationFailed,
+			Details: err.Error(),
+		})
+		return true
+	}
+	return false
+}
+
+// writeBusyError answers 409 CONFLICT when another request was changing the sale,
+// and reports whether err was that
+func (h *CashRegisterHandler) writeBusyError(c *gin.Context, err error) bool {
+	if !errors.Is(err, cashregister.ErrBusy) {
+		return false
+	}
+	c.JSON(http.StatusConflict, api.APIError{
+		Error: err.Error(),
+		Code:  api.ErrorCodeConflict,
+	})
+	return true
+}
+
 func (h *CashRegisterHandler) cancelTransaction() {
 	h.cashRegister.CancelCurrentReceipt()
 }
 
+// receiptItems lists the items of a sale snapshot; the sale may have ended since
+func receiptItems(receipt *models.Receipt) []models.Item {
+	if receipt == nil {
+		return []models.Item{}
+	}
+	return receipt.Items
+}
+
+// publishDisplay sends the sale state with a catalog message, rendered in the default locale
+func (h *CashRegisterHandler) publishDisplay(event string, receipt *models.Receipt, messageKey string) {
+	if h.display != nil {
+		h.display.Publish(event, receipt, messageKey, h.messages.Localizer("").T(messageKey))
+	}
+}
+
+// localizer picks the request's locale: ?lang=, then Accept-Language, then the configured default
+func (h *CashRegisterHandler) localizer(c *gin.Context) *i18n.Localizer {
+	return h.messages.Negotiate(c.Query("lang"), c.GetHeader("Accept-Language"))
+}
+
+// pageData is the template data shared by the HTML pages
+func (h *CashRegisterHandler) pageData(c *gin.Context) gin.H {
+	loc := h.localizer(c)
+	messages, _ := json.Marshal(loc.Messages())
+	return gin.H{
+		"StoreName": h.config.Store.Name,
+		"L":         loc,
+		"Messages":  template.JS(messages),
+	}
+}
+
 // WebhookHandler implementation for services
 type WebhookHandlerImpl struct {
 	verbose bool
@@ -267,9 +754,9 @@ func NewWebhookHandler(verbose bool) *WebhookHandlerImpl {
 	return &WebhookHandlerImpl{verbose: verbose}
 }
 
-func (w *WebhookHandlerImpl) HandleDownloadConfirmation(receiptID string) error {
+func (w *WebhookHandlerImpl) HandleDownloadConfirmation(payload api.WebhookPayload) error {
 	if w.verbose {
-		log.Printf("[WEBHOOK] Download confirmed for receipt: %s", receiptID)
+		log.Printf("[WEBHOOK] Download confirmed for receipt: %s", payload.ReceiptID)
 	}
 	return nil
 }
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/display"
+	"fake-cash-register/internal/hold"
+	"fake-cash-register/internal/zreport"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxHoldLabel bounds the operator's note on a held sale
+const maxHoldLabel = 64
+
+// POST /api/transaction/hold - Park the open sale under a hold ID and free the register
+func (h *CashRegisterHandler) HoldTransaction(c *gin.Context) {
+	var req struct {
+		Label string `json:"label"` // Optional, e.g. the customer's name
+	}
+
+	// The body is optional
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, api.APIError{
+				Error: "Invalid request format",
+				Code:  api.ErrorCodeInvalidRequest,
+			})
+			return
+		}
+	}
+	label := strings.TrimSpace(req.Label)
+	if len(label) > maxHoldLabel || strings.ContainsAny(label, "\r\n") {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "label must be a single line of up to 64 bytes",
+			Code:  api.ErrorCodeValidationFailed,
+		})
+		return
+	}
+
+	held, err := h.cashRegister.HoldCurrentReceipt(label)
+	if err != nil {
+		if h.writeBusyError(c, err) || h.writeHoldError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeInternalError,
+		})
+		return
+	}
+	h.publishDisplay(display.EventCancelled, nil, "display.held")
+
+	c.JSON(http.StatusCreated, held)
+}
+
+// GET /api/transaction/held - Held sales, oldest first
+func (h *CashRegisterHandler) ListHeld(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"held": h.cashRegister.Holds().List(),
+	})
+}
+
+// POST /api/transaction/held/:id/recall - Resume a held sale as the open sale
+func (h *CashRegisterHandler) RecallHeld(c *gin.Context) {
+	receipt, err := h.cashRegister.RecallReceipt(strings.ToUpper(c.Param("id")))
+	if err != nil {
+		if h.writeBusyError(c, err) || h.writeHoldError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeInternalError,
+		})
+		return
+	}
+	h.publishDisplay(display.EventItemAdded, receipt, "")
+
+	c.JSON(http.StatusOK, receipt)
+}
+
+// DELETE /api/transaction/held/:id - Drop a held sale without recalling it
+func (h *CashRegisterHandler) DiscardHeld(c *gin.Context) {
+	if _, err := h.cashRegister.DiscardHeld(strings.ToUpper(c.Param("id"))); err != nil {
+		if h.writeHoldError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeInternalError,
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// writeHoldError writes the response for a sale that can't be held or recalled, and
+// reports whether err was one
+func (h *CashRegisterHandler) writeHoldError(c *gin.Context, err error) bool {
+	l := h.localizer(c)
+	switch {
+	case errors.Is(err, cashregister.ErrNoActiveReceipt):
+		c.JSON(http.StatusNotFound, api.APIError{
+			Error: "No active transaction",
+			Code:  api.ErrorCodeNoActiveReceipt,
+		})
+	case errors.Is(err, cashregister.ErrEmptyReceipt), errors.Is(err, cashregister.ErrHoldRefund):
+		key := "hold.empty"
+		if errors.Is(err, cashregister.ErrHoldRefund) {
+			key = "hold.refund"
+		}
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: l.T(key),
+			Code:  api.ErrorCodeValidationFailed,
+		})
+	case errors.Is(err, hold.ErrNotFound):
+		c.JSON(http.StatusNotFound, api.APIError{
+			Error: l.T("hold.not_found"),
+			Code:  api.ErrorCodeHoldNotFound,
+		})
+	case errors.Is(err, hold.ErrLimit), errors.Is(err, cashregister.ErrSaleOpen):
+		key := "hold.limit"
+		if errors.Is(err, cashregister.ErrSaleOpen) {
+			key = "hold.sale_open"
+		}
+		c.JSON(http.StatusConflict, api.APIError{
+			Error:   l.T(key),
+			Code:    api.ErrorCodeConflict,
+			Details: err.Error(),
+		})
+	case errors.Is(err, zreport.ErrClosePending):
+		c.JSON(http.StatusConflict, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeZReportPending,
+		})
+	default:
+		return false
+	}
+	return true
+}
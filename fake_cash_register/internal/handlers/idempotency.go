@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/idempotency"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyKeyHeader lets a client retry add-item, payment and issue requests safely
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayHeader is set to "true" on responses replayed for a retry
+const IdempotentReplayHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength bounds the keys clients may send (UUIDs need 36)
+const maxIdempotencyKeyLength = 255
+
+// SetIdempotency enables replaying responses to requests carrying an Idempotency-Key
+func (h *CashRegisterHandler) SetIdempotency(store *idempotency.Store) {
+	h.idempotency = store
+}
+
+// Idempotent runs a request carrying an Idempotency-Key once: retries with the same
+// key and body get the stored response (with Idempotent-Replayed: true), retries
+// while it still runs get 409 and a key reused for a different request gets 422.
+// Server errors are not stored, so those requests can be retried. Keys are scoped
+// to the API key that sent them.
+func (h *CashRegisterHandler) Idempotent(c *gin.Context) {
+	key := c.GetHeader(IdempotencyKeyHeader)
+	if h.idempotency == nil || key == "" {
+		c.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.APIError{
+			Error: "Idempotency-Key is too long",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.APIError{
+			Error: "Failed to read request body",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	scoped := c.GetString(apiKeyContextKey) + "\x00" + key
+	stored, err := h.idempotency.Begin(scoped, idempotency.Fingerprint(c.Request.Method, c.Request.URL.Path, body))
+	switch {
+	case errors.Is(err, idempotency.ErrInProgress):
+		c.AbortWithStatusJSON(http.StatusConflict, api.APIError{
+			Error: "A request with this Idempotency-Key is still being processed",
+			Code:  api.ErrorCodeIdempotencyInProgress,
+		})
+		return
+	case errors.Is(err, idempotency.ErrMismatch):
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, api.APIError{
+			Error: "Idempotency-Key was already used for a different request",
+			Code:  api.ErrorCodeIdempotencyKeyReused,
+		})
+		return
+	case stored != nil:
+		if h.config.Server.Verbose {
+			log.Printf("[IDEMPOTENCY] Replaying %s %s for key %q", c.Request.Method, c.Request.URL.Path, key)
+		}
+		c.Header(IdempotentReplayHeader, "true")
+		c.Data(stored.Status, stored.ContentType, stored.Body)
+		c.Abort()
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	finished := false
+	defer func() {
+		// A panicking handler leaves nothing to replay
+		if !finished {
+			h.idempotency.Abandon(scoped)
+		}
+	}()
+
+	c.Next()
+
+	if status := recorder.Status(); status < http.StatusInternalServerError {
+		h.idempotency.Finish(scoped, idempotency.Response{
+			Status:      status,
+			ContentType: recorder.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+		})
+		finished = true
+	}
+}
+
+// responseRecorder keeps a copy of the response body for replays
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/display"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /api/transaction/customer - Make the active receipt an invoiced sale to a business
+// customer, entered before the receipt is issued. An empty tax_number clears the customer.
+func (h *CashRegisterHandler) SetCustomer(c *gin.Context) {
+	var req struct {
+		TaxNumber string `json:"tax_number"` // VKN or TCKN
+		Name      string `json:"name"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "Invalid request format",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	if !h.cashRegister.HasActiveReceipt() {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "No active transaction",
+			Code:  api.ErrorCodeNoActiveReceipt,
+		})
+		return
+	}
+
+	if err := h.cashRegister.SetCustomer(req.TaxNumber, req.Name); err != nil {
+		if h.writeBusyError(c, err) || h.writeValidationError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeInternalError,
+		})
+		return
+	}
+
+	receipt := h.cashRegister.CurrentReceipt()
+	if receipt == nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "No active transaction",
+			Code:  api.ErrorCodeNoActiveReceipt,
+		})
+		return
+	}
+	h.publishDisplay(display.EventItemAdded, receipt, "")
+
+	c.JSON(http.StatusOK, gin.H{
+		"customer": receipt.Customer,
+	})
+}
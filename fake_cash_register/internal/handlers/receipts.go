@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/escpos"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/receiptpdf"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /api/receipts/:serial/text - Printer-style receipt text from history
+// Query: lang (defaults to Accept-Language, then the configured locale)
+func (h *CashRegisterHandler) GetReceiptText(c *gin.Context) {
+	receipt, ok := h.historyReceipt(c)
+	if !ok {
+		return
+	}
+
+	loc := h.localizer(c)
+	c.Header("Content-Language", loc.Locale())
+	c.String(http.StatusOK, receipt.FormatForDisplay(loc, h.template))
+}
+
+// GET /api/receipts/:serial/pdf - Receipt from history as a PDF in fiscal receipt layout
+// Query: lang (defaults to Accept-Language, then the configured locale), download=true
+// to save instead of opening inline
+func (h *CashRegisterHandler) GetReceiptPDF(c *gin.Context) {
+	receipt, ok := h.historyReceipt(c)
+	if !ok {
+		return
+	}
+
+	disposition := "inline"
+	if c.Query("download") == "true" {
+		disposition = "attachment"
+	}
+
+	loc := h.localizer(c)
+	c.Header("Content-Language", loc.Locale())
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": receiptpdf.FileName(receipt)}))
+	c.Data(http.StatusOK, "application/pdf", receiptpdf.Render(receipt, loc, h.template))
+}
+
+// GET /api/receipts/:serial/escpos - Receipt from history as an ESC/POS print job
+// (PC857 code page) to send to a thermal printer as is
+// Query: lang (defaults to Accept-Language, then the configured locale)
+func (h *CashRegisterHandler) GetReceiptESCPOS(c *gin.Context) {
+	receipt, ok := h.historyReceipt(c)
+	if !ok {
+		return
+	}
+
+	loc := h.localizer(c)
+	c.Header("Content-Language", loc.Locale())
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": escpos.FileName(receipt)}))
+	c.Data(http.StatusOK, "application/octet-stream", escpos.Render(receipt, loc, h.template))
+}
+
+// historyReceipt looks up the :serial receipt, writing a 404 when there is none
+func (h *CashRegisterHandler) historyReceipt(c *gin.Context) (*models.Receipt, bool) {
+	store := h.cashRegister.History()
+	if store == nil {
+		c.JSON(http.StatusNotFound, api.APIError{
+			Error: "Receipt history is not enabled",
+			Code:  api.ErrorCodeReceiptNotFound,
+		})
+		return nil, false
+	}
+
+	receipt, found := store.FindBySerial(c.Param("serial"))
+	if !found {
+		c.JSON(http.StatusNotFound, api.APIError{
+			Error: "Receipt not found",
+			Code:  api.ErrorCodeReceiptNotFound,
+		})
+		return nil, false
+	}
+	return receipt, true
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/display"
+	"fake-cash-register/internal/zreport"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /api/transaction/refund - Start a refund of an earlier sale, given its serial (looked up
+// in history) or its signed binary receipt in base64 (scanned from the customer). The sale's
+// authority signature is verified either way; the open sale, if any, is discarded.
+func (h *CashRegisterHandler) StartRefund(c *gin.Context) {
+	var req struct {
+		Serial        string `json:"serial"`
+		SignedReceipt string `json:"signed_receipt"` // Base64
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Serial == "") == (req.SignedReceipt == "") {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "Give the original receipt's serial or signed_receipt",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	var refund *cashregister.Refund
+	var err error
+	if req.Serial != "" {
+		refund, err = h.cashRegister.StartRefund(strings.ToUpper(strings.TrimSpace(req.Serial)))
+	} else {
+		signed, decodeErr := binary.FromBase64(strings.TrimSpace(req.SignedReceipt))
+		if decodeErr != nil {
+			c.JSON(http.StatusBadRequest, api.APIError{
+				Error: "Invalid base64 encoding for signed_receipt",
+				Code:  api.ErrorCodeInvalidRequest,
+			})
+			return
+		}
+		refund, err = h.cashRegister.StartRefundFromSigned(signed)
+	}
+	if err != nil {
+		if h.writeBusyError(c, err) || h.writeRefundError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeInternalError,
+		})
+		return
+	}
+	h.publishDisplay(display.EventStarted, h.cashRegister.CurrentReceipt(), "")
+
+	c.JSON(http.StatusCreated, refund)
+}
+
+// GET /api/transaction/refund - The open refund: the original sale and what is left to refund per line
+func (h *CashRegisterHandler) GetRefund(c *gin.Context) {
+	refund := h.cashRegister.CurrentRefund()
+	if refund == nil {
+		c.JSON(http.StatusNotFound, api.APIError{
+			Error: "No open refund",
+			Code:  api.ErrorCodeNoActiveReceipt,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, refund)
+}
+
+// POST /api/transaction/refund/add-item - Refund a quantity of a line of the original sale
+func (h *CashRegisterHandler) AddRefundItem(c *gin.Context) {
+	var req struct {
+		Line     *int `json:"line" binding:"required"` // Index on the original receipt
+		Quantity int  `json:"quantity"`                // Grams on weighed lines
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "Invalid request format",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	if err := h.cashRegister.AddRefundItem(*req.Line, req.Quantity); err != nil {
+		if h.writeBusyError(c, err) || h.writeValidationError(c, err) || h.writeRefundError(c, err) {
+			return
+		}
+		status, code := http.StatusInternalServerError, api.ErrorCodeInternalError
+		if errors.Is(err, cashregister.ErrNoSuchLine) {
+			status, code = http.StatusNotFound, api.ErrorCodeInvalidRequest
+		}
+		c.JSON(status, api.APIError{
+			Error: err.Error(),
+			Code:  code,
+		})
+		return
+	}
+
+	current := h.cashRegister.CurrentReceipt()
+	h.publishDisplay(display.EventItemAdded, current, "")
+
+	response := gin.H{
+		"items": receiptItems(current),
+	}
+	if refund := h.cashRegister.CurrentRefund(); refund != nil {
+		response["lines"] = refund.Lines
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// writeRefundError writes the response for a refund the original receipt doesn't allow,
+// and reports whether err was one
+func (h *CashRegisterHandler) writeRefundError(c *gin.Context, err error) bool {
+	l := h.localizer(c)
+	switch {
+	case errors.Is(err, cashregister.ErrNoRefund):
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: l.T("refund.none"),
+			Code:  api.ErrorCodeNoActiveReceipt,
+		})
+	case errors.Is(err, cashregister.ErrOriginalNotFound), errors.Is(err, cashregister.ErrOriginalUnsigned):
+		key := "refund.not_found"
+		if errors.Is(err, cashregister.ErrOriginalUnsigned) {
+			key = "refund.unsigned"
+		}
+		c.JSON(http.StatusNotFound, api.APIError{
+			Error:   l.T(key),
+			Code:    api.ErrorCodeReceiptNotFound,
+			Details: err.Error(),
+		})
+	case errors.Is(err, binary.ErrInvalidSignature):
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: l.T("refund.invalid_signature"),
+			Code:  api.ErrorCodeInvalidSignature,
+		})
+	case errors.Is(err, binary.ErrInvalidFormat), errors.Is(err, binary.ErrCorrupted):
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error:   l.T("refund.unreadable"),
+			Code:    api.ErrorCodeInvalidRequest,
+			Details: err.Error(),
+		})
+	case errors.Is(err, cashregister.ErrForeignReceipt), errors.Is(err, cashregister.ErrNotRefundable),
+		errors.Is(err, cashregister.ErrNothingToRefund), errors.Is(err, cashregister.ErrRefundExceeded),
+		errors.Is(err, cashregister.ErrRefundLinesOnly):
+		key := "refund.exceeded"
+		switch {
+		case errors.Is(err, cashregister.ErrForeignReceipt):
+			key = "refund.foreign_receipt"
+		case errors.Is(err, cashregister.ErrNotRefundable):
+			key = "refund.not_refundable"
+		case errors.Is(err, cashregister.ErrNothingToRefund):
+			key = "refund.fully_refunded"
+		case errors.Is(err, cashregister.ErrRefundLinesOnly):
+			key = "refund.lines_only"
+		}
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error:   l.T(key),
+			Code:    api.ErrorCodeValidationFailed,
+			Details: err.Error(),
+		})
+	case errors.Is(err, zreport.ErrClosePending):
+		c.JSON(http.StatusConflict, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeZReportPending,
+		})
+	case errors.Is(err, cashregister.ErrRefundsUntracked):
+		c.JSON(http.StatusConflict, api.APIError{
+			Error:   l.T("refund.untracked"),
+			Code:    api.ErrorCodeValidationFailed,
+			Details: err.Error(),
+		})
+	case errors.Is(err, cashregister.ErrAuthorityKeyUnavailable):
+		c.JSON(http.StatusServiceUnavailable, api.APIError{
+			Error:   l.T("refund.key_unavailable"),
+			Code:    api.ErrorCodeServiceUnavailable,
+			Details: err.Error(),
+		})
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/scale"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /api/scale - Latest scale reading and whether a weighed item can be sold with it
+func (h *CashRegisterHandler) GetScale(c *gin.Context) {
+	s, ok := h.checkoutScale(c)
+	if !ok {
+		return
+	}
+
+	response := gin.H{"ready": true}
+	if reading, ok := s.Last(); ok {
+		response["reading"] = reading
+	}
+	if _, err := s.Weight(); err != nil {
+		response["ready"] = false
+		response["error"] = h.scaleMessage(c, err)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// POST /api/scale - Report a reading from a scale bridge: {"grams": 1234, "stable": true}
+func (h *CashRegisterHandler) SetScale(c *gin.Context) {
+	s, ok := h.checkoutScale(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Grams  *int `json:"grams" binding:"required"`
+		Stable bool `json:"stable"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || *req.Grams < 0 {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "Invalid request format",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	s.Set(scale.Reading{Grams: *req.Grams, Stable: req.Stable, Source: scale.SourceAPI})
+	reading, _ := s.Last()
+	c.JSON(http.StatusOK, gin.H{"reading": reading})
+}
+
+func (h *CashRegisterHandler) checkoutScale(c *gin.Context) (*scale.Scale, bool) {
+	s := h.cashRegister.Scale()
+	if s == nil {
+		c.JSON(http.StatusNotFound, api.APIError{
+			Error: "No scale is connected",
+			Code:  api.ErrorCodeScaleDisabled,
+		})
+		return nil, false
+	}
+	return s, true
+}
+
+// writeScaleError reports a weighed item the scale or receipt format can't sell yet
+func (h *CashRegisterHandler) writeScaleError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, scale.ErrNoReading), errors.Is(err, scale.ErrUnstable), errors.Is(err, scale.ErrStale):
+		c.JSON(http.StatusConflict, api.APIError{
+			Error:   h.scaleMessage(c, err),
+			Code:    api.ErrorCodeScaleNotReady,
+			Details: err.Error(),
+		})
+		return true
+	case errors.Is(err, cashregister.ErrWeighingUnsupported):
+		c.JSON(http.StatusUnprocessableEntity, api.APIError{
+			Error:   h.localizer(c).T("scale.unsupported"),
+			Code:    api.ErrorCodeValidationFailed,
+			Details: err.Error(),
+		})
+		return true
+	}
+	return false
+}
+
+func (h *CashRegisterHandler) scaleMessage(c *gin.Context, err error) string {
+	l := h.localizer(c)
+	switch {
+	case errors.Is(err, scale.ErrUnstable):
+		return l.T("scale.unstable")
+	case errors.Is(err, scale.ErrStale):
+		return l.T("scale.stale")
+	}
+	return l.T("scale.no_reading")
+}
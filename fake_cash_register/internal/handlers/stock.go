@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/stock"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stockCSVHeader lists the columns of the stocktake export
+var stockCSVHeader = []string{"kisim_id", "name", "quantity", "low_stock", "low", "updated_at"}
+
+// GET /api/stock - Stock levels per KISIM and the ones at or below their warning level
+func (h *CashRegisterHandler) GetStock(c *gin.Context) {
+	store, ok := h.stockStore(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"levels":      store.Levels(),
+		"low_stock":   nonNil(store.Low()),
+		"block_sales": store.BlocksSales(),
+	})
+}
+
+// POST /api/stock/adjust - Book a stock change: {"kisim_id": 1, "delta": 24, "reason": "delivery"}
+// Reasons: refund, delivery, damage, correction
+func (h *CashRegisterHandler) AdjustStock(c *gin.Context) {
+	if _, ok := h.stockStore(c); !ok {
+		return
+	}
+
+	var req struct {
+		KisimID int    `json:"kisim_id" binding:"required"`
+		Delta   int    `json:"delta" binding:"required"`
+		Reason  string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "Invalid request format",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	level, err := h.cashRegister.AdjustStock(req.KisimID, req.Delta, req.Reason)
+	h.writeStockLevel(c, level, err)
+}
+
+// POST /api/stock/count - Stocktake: set a level to the counted quantity
+// {"kisim_id": 1, "quantity": 40}
+func (h *CashRegisterHandler) CountStock(c *gin.Context) {
+	if _, ok := h.stockStore(c); !ok {
+		return
+	}
+
+	var req struct {
+		KisimID  int  `json:"kisim_id" binding:"required"`
+		Quantity *int `json:"quantity" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "Invalid request format",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	level, err := h.cashRegister.CountStock(req.KisimID, *req.Quantity)
+	h.writeStockLevel(c, level, err)
+}
+
+// GET /api/stock/export - Stocktake sheet of the current levels (format=csv|json)
+func (h *CashRegisterHandler) ExportStock(c *gin.Context) {
+	store, ok := h.stockStore(c)
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: "format must be csv or json",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+
+	levels := store.Levels()
+	filename := fmt.Sprintf("stocktake-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if format == "json" {
+		c.JSON(http.StatusOK, gin.H{
+			"generated_at": time.Now().UTC(),
+			"levels":       levels,
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	w := csv.NewWriter(c.Writer)
+	w.Write(stockCSVHeader)
+	for _, level := range levels {
+		w.Write([]string{
+			strconv.Itoa(level.KisimID),
+			level.Name,
+			strconv.Itoa(level.Quantity),
+			strconv.Itoa(level.LowStock),
+			strconv.FormatBool(level.Low()),
+			level.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+	w.Flush()
+}
+
+// stockStore returns the stock store, writing a 404 when stock tracking is disabled
+func (h *CashRegisterHandler) stockStore(c *gin.Context) (*stock.Store, bool) {
+	store := h.cashRegister.Stock()
+	if store == nil {
+		c.JSON(http.StatusNotFound, api.APIError{
+			Error: "Stock tracking is not enabled",
+			Code:  api.ErrorCodeStockDisabled,
+		})
+		return nil, false
+	}
+	return store, true
+}
+
+func (h *CashRegisterHandler) writeStockLevel(c *gin.Context, level stock.Level, err error) {
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"level": level, "low": level.Low()})
+	case errors.Is(err, stock.ErrUnknownKisim), errors.Is(err, stock.ErrInvalidAdjustment):
+		c.JSON(http.StatusBadRequest, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, api.APIError{
+			Error: err.Error(),
+			Code:  api.ErrorCodeInternalError,
+		})
+	}
+}
+
+// nonNil keeps empty lists as [] rather than null in JSON
+func nonNil(levels []stock.Level) []stock.Level {
+	if levels == nil {
+		return []stock.Level{}
+	}
+	return levels
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"fake-cash-register/internal/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Signed receipt bank webhooks carry WebhookTimestampHeader, the Unix time they were
+// signed at, and WebhookSignatureHeader, "sha256=<hex HMAC-SHA256 of "<timestamp>.<body>">"
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+)
+
+// WebhookTolerance is how far a webhook's timestamp may be from the register's clock.
+// A captured request replayed after that is refused even though its signature is valid.
+const WebhookTolerance = 5 * time.Minute
+
+// maxWebhookBody bounds how much of a webhook request is read for verification
+const maxWebhookBody = 64 * 1024
+
+// VerifyWebhookSignature rejects webhook requests whose timestamp and body are not signed
+// with secret, or were signed more than WebhookTolerance away from now. The body is
+// restored so the webhook handler can bind it as usual.
+func VerifyWebhookSignature(secret string, verbose bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, api.APIError{
+				Error: "Failed to read payload",
+				Code:  api.ErrorCodeInvalidRequest,
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		timestamp := c.GetHeader(WebhookTimestampHeader)
+		signature, ok := strings.CutPrefix(c.GetHeader(WebhookSignatureHeader), "sha256=")
+		received, err := hex.DecodeString(signature)
+		if !ok || err != nil || !hmac.Equal(received, WebhookSignature(secret, timestamp, body)) {
+			if verbose {
+				log.Printf("[WEBHOOK] Rejected request from %s: missing or invalid signature", c.ClientIP())
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, api.APIError{
+				Error: "Invalid webhook signature",
+				Code:  api.ErrorCodeInvalidSignature,
+			})
+			return
+		}
+
+		signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || time.Since(time.Unix(signedAt, 0)).Abs() > WebhookTolerance {
+			if verbose {
+				log.Printf("[WEBHOOK] Rejected request from %s: timestamp %q outside %v", c.ClientIP(), timestamp, WebhookTolerance)
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, api.APIError{
+				Error: "Stale webhook timestamp",
+				Code:  api.ErrorCodeInvalidSignature,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// WebhookSignature computes the HMAC-SHA256 of a webhook's timestamp and body
+func WebhookSignature(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/zreport"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /api/zreport - Running totals of the open Z-report and the last closed one
+func (h *CashRegisterHandler) GetZReport(c *gin.Context) {
+	status := models.ZReportStatus{
+		Current: h.cashRegister.CurrentZReport(),
+		Closing: h.cashRegister.ZReportClosing(),
+	}
+	if last, ok := h.cashRegister.LastZReport(); ok {
+		status.Last = last
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// POST /api/zreport/close - Close the Z-report now. While a sale is open the close is
+// left pending (new sales blocked) and 409 is returned; repeat once the sale completes.
+func (h *CashRegisterHandler) CloseZReport(c *gin.Context) {
+	report, err := h.cashRegister.CloseZReport()
+	if err != nil {
+		if errors.Is(err, zreport.ErrSaleInProgress) {
+			c.JSON(http.StatusConflict, api.APIError{
+				Error: err.Error(),
+				Code:  api.ErrorCodeZReportPending,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, api.APIError{
+			Error:   "Failed to close Z-report",
+			Code:    api.ErrorCodeInternalError,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	if h.config.Server.Verbose {
+		log.Printf("[HANDLER] Z-report %s closed manually", report.Number)
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,275 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"fake-cash-register/internal/models"
+)
+
+// Store keeps issued receipts for lookup and export.
+// When a file path is configured, receipts are appended as JSON lines and reloaded at startup.
+// Later changes to a receipt (delivery status) are appended as update lines, so the file
+// is never rewritten.
+type Store struct {
+	mu       sync.RWMutex
+	receipts []*models.Receipt
+	signed   map[string][]byte // Signed binary receipts by transaction ID
+	filePath string
+	verbose  bool
+}
+
+// NewStore creates a receipt history store, loading existing entries from filePath if set
+func NewStore(filePath string, verbose bool) (*Store, error) {
+	s := &Store{
+		receipts: make([]*models.Receipt, 0),
+		signed:   make(map[string][]byte),
+		filePath: filePath,
+		verbose:  verbose,
+	}
+
+	if filePath != "" {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Add records an issued receipt
+func (s *Store) Add(receipt *models.Receipt) error {
+	return s.AddSigned(receipt, nil)
+}
+
+// AddSigned records an issued receipt together with the signed binary receipt, so the
+// sale can be verified again later, e.g. when it is refunded by serial
+func (s *Store) AddSigned(receipt *models.Receipt, signed []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.filePath != "" {
+		if err := s.appendLine(historyLine{Receipt: *receipt, SignedReceipt: signed}); err != nil {
+			return err
+		}
+	}
+
+	s.receipts = append(s.receipts, receipt)
+	if signed != nil {
+		s.signed[receipt.TransactionID] = signed
+	}
+
+	if s.verbose {
+		log.Printf("[HISTORY] Recorded receipt %s (%d receipts in history)", receipt.ReceiptSerial, len(s.receipts))
+	}
+
+	return nil
+}
+
+// UpdateDelivery records the delivery status of the receipt with transactionID.
+// The stored receipt is replaced by an updated copy, so receipts already handed
+// out are not modified.
+func (s *Store) UpdateDelivery(transactionID string, delivery models.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.indexOf(transactionID)
+	if index < 0 {
+		return fmt.Errorf("no receipt with transaction ID %s in history", transactionID)
+	}
+
+	if s.filePath != "" {
+		if err := s.appendLine(deliveryUpdate{TransactionID: transactionID, Delivery: delivery}); err != nil {
+			return err
+		}
+	}
+	s.applyDelivery(index, delivery)
+
+	if s.verbose {
+		log.Printf("[HISTORY] Delivery of %s by %s: %s", s.receipts[index].ReceiptSerial, delivery.Channel, delivery.Status)
+	}
+
+	return nil
+}
+
+// Range returns receipts with timestamps in [from, to], ordered by timestamp.
+// Zero values leave the corresponding bound open.
+func (s *Store) Range(from, to time.Time) []*models.Receipt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*models.Receipt, 0)
+	for _, receipt := range s.receipts {
+		if !from.IsZero() && receipt.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && receipt.Timestamp.After(to) {
+			continue
+		}
+		result = append(result, receipt)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Timestamp.Before(result[j].Timestamp)
+	})
+
+	return result
+}
+
+// FindBySerial returns the most recent receipt with the given serial
+func (s *Store) FindBySerial(serial string) (*models.Receipt, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := len(s.receipts) - 1; i >= 0; i-- {
+		if s.receipts[i].ReceiptSerial == serial {
+			return s.receipts[i], true
+		}
+	}
+	return nil, false
+}
+
+// FindByTransactionID returns the receipt with the given transaction ID
+func (s *Store) FindByTransactionID(transactionID string) (*models.Receipt, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if index := s.indexOf(transactionID); index >= 0 {
+		return s.receipts[index], true
+	}
+	return nil, false
+}
+
+// Signed returns the signed binary receipt of the sale with transactionID, for receipts
+// recorded with AddSigned
+func (s *Store) Signed(transactionID string) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	signed, ok := s.signed[transactionID]
+	return signed, ok
+}
+
+// Refunds returns the refunds issued against the sale with transactionID, oldest first
+func (s *Store) Refunds(transactionID string) []*models.Receipt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var refunds []*models.Receipt
+	for _, receipt := range s.receipts {
+		if receipt.RefundOf != nil && receipt.RefundOf.TransactionID == transactionID {
+			refunds = append(refunds, receipt)
+		}
+	}
+	return refunds
+}
+
+// Durable reports whether history is kept in a file, so the refunds it counts are still
+// counted after a restart
+func (s *Store) Durable() bool {
+	return s.filePath != ""
+}
+
+// Count returns the number of receipts in history
+func (s *Store) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.receipts)
+}
+
+// historyLine is one line of the history file: an issued receipt, or a
+// deliveryUpdate for the receipt with the same transaction ID
+type historyLine struct {
+	models.Receipt
+	SignedReceipt  []byte           `json:"signed_receipt,omitempty"` // Base64 in the file
+	DeliveryUpdate *models.Delivery `json:"delivery_update,omitempty"`
+}
+
+type deliveryUpdate struct {
+	TransactionID string          `json:"transaction_id"`
+	Delivery      models.Delivery `json:"delivery_update"`
+}
+
+func (s *Store) indexOf(transactionID string) int {
+	for i := len(s.receipts) - 1; i >= 0; i-- {
+		if s.receipts[i].TransactionID == transactionID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Store) applyDelivery(index int, delivery models.Delivery) {
+	updated := *s.receipts[index]
+	updated.Delivery = &delivery
+	s.receipts[index] = &updated
+}
+
+func (s *Store) load() error {
+	file, err := os.Open(s.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var line historyLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return fmt.Errorf("failed to parse history entry %d: %v", len(s.receipts)+1, err)
+		}
+		if line.DeliveryUpdate != nil {
+			if index := s.indexOf(line.TransactionID); index >= 0 {
+				s.applyDelivery(index, *line.DeliveryUpdate)
+			}
+			continue
+		}
+		receipt := line.Receipt
+		s.receipts = append(s.receipts, &receipt)
+		if line.SignedReceipt != nil {
+			s.signed[receipt.TransactionID] = line.SignedReceipt
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read history file: %v", err)
+	}
+
+	if s.verbose {
+		log.Printf("[HISTORY] Loaded %d receipts from %s", len(s.receipts), s.filePath)
+	}
+
+	return nil
+}
+
+func (s *Store) appendLine(entry interface{}) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history entry: %v", err)
+	}
+
+	file, err := os.OpenFile(s.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write history entry: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,265 @@
+// Package hold parks open sales so the register can serve the next customer and
+// resume them later, e.g. when a customer goes back for a forgotten wallet.
+package hold
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"fake-cash-register/internal/models"
+)
+
+// Journal operations
+const (
+	OpHold    = "hold"    // Sale parked
+	OpRecall  = "recall"  // Sale taken back to the register
+	OpDiscard = "discard" // Sale dropped without being recalled
+)
+
+// DefaultMax is how many sales may be held at once when no limit is configured
+const DefaultMax = 20
+
+var (
+	// ErrNotFound is returned for a hold ID that isn't held
+	ErrNotFound = errors.New("held transaction not found")
+	// ErrLimit is returned when the store already holds its maximum number of sales
+	ErrLimit = errors.New("too many held transactions")
+)
+
+// Held is a parked sale
+type Held struct {
+	ID      string          `json:"id"`
+	Label   string          `json:"label,omitempty"` // Operator's note, e.g. the customer's name
+	HeldAt  time.Time       `json:"held_at"`
+	Items   int             `json:"items"`
+	Total   float64         `json:"total"` // Sum of the line totals, before rounding
+	Receipt *models.Receipt `json:"receipt"`
+}
+
+// entry is one line of the hold journal
+type entry struct {
+	Op   string    `json:"op"`
+	ID   string    `json:"id"`
+	Held *Held     `json:"held,omitempty"` // Set for OpHold
+	Time time.Time `json:"time"`
+}
+
+// Store keeps held sales. When a file path is configured, holds, recalls and discards
+// are appended as JSON lines and replayed at startup, so held sales survive a restart.
+type Store struct {
+	mu       sync.Mutex
+	held     []*Held // Oldest first
+	next     int     // Number of the next hold ID
+	max      int
+	filePath string
+	verbose  bool
+}
+
+// NewStore creates a hold store of at most max sales (0 = DefaultMax), replaying the
+// journal at filePath if set
+func NewStore(filePath string, max int, verbose bool) (*Store, error) {
+	if max <= 0 {
+		max = DefaultMax
+	}
+	s := &Store{
+		held:     make([]*Held, 0),
+		next:     1,
+		max:      max,
+		filePath: filePath,
+		verbose:  verbose,
+	}
+
+	if filePath != "" {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Hold parks a copy of receipt under a new hold ID
+func (s *Store) Hold(receipt *models.Receipt, label string) (*Held, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.held) >= s.max {
+		return nil, fmt.Errorf("%w (max %d)", ErrLimit, s.max)
+	}
+
+	parked := *receipt
+	parked.Items = slices.Clone(receipt.Items)
+	held := &Held{
+		ID:      fmt.Sprintf("H%04d", s.next),
+		Label:   label,
+		HeldAt:  time.Now(),
+		Items:   len(parked.Items),
+		Receipt: &parked,
+	}
+	for _, item := range parked.Items {
+		held.Total += item.TotalPrice
+	}
+
+	if err := s.append(entry{Op: OpHold, ID: held.ID, Held: held, Time: held.HeldAt}); err != nil {
+		return nil, err
+	}
+	s.next++
+	s.held = append(s.held, held)
+
+	if s.verbose {
+		log.Printf("[HOLD] Held %s (%d items, ₺%.2f)", held.ID, held.Items, held.Total)
+	}
+	return held, nil
+}
+
+// Get returns a held sale without taking it
+func (s *Store) Get(id string) (*Held, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.index(id)
+	if index < 0 {
+		return nil, false
+	}
+	return s.held[index], true
+}
+
+// Take removes a held sale to resume it at the register
+func (s *Store) Take(id string) (*Held, error) {
+	return s.remove(id, OpRecall)
+}
+
+// Discard drops a held sale
+func (s *Store) Discard(id string) (*Held, error) {
+	return s.remove(id, OpDiscard)
+}
+
+// List returns the held sales, oldest first
+func (s *Store) List() []*Held {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.held)
+}
+
+// Count returns how many sales are held
+func (s *Store) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.held)
+}
+
+func (s *Store) remove(id, op string) (*Held, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.index(id)
+	if index < 0 {
+		return nil, ErrNotFound
+	}
+	held := s.held[index]
+
+	if err := s.append(entry{Op: op, ID: id, Time: time.Now()}); err != nil {
+		return nil, err
+	}
+	s.held = slices.Delete(s.held, index, index+1)
+
+	if s.verbose {
+		log.Printf("[HOLD] %s %s", op, id)
+	}
+	return held, nil
+}
+
+// index returns the position of id in the held sales, or -1. Callers hold mu.
+func (s *Store) index(id string) int {
+	return slices.IndexFunc(s.held, func(held *Held) bool { return held.ID == id })
+}
+
+// apply replays a journal entry
+func (s *Store) apply(e entry) error {
+	switch e.Op {
+	case OpHold:
+		if e.Held == nil || e.Held.Receipt == nil {
+			return fmt.Errorf("hold %s has no receipt", e.ID)
+		}
+		s.held = append(s.held, e.Held)
+		var number int
+		if _, err := fmt.Sscanf(e.ID, "H%d", &number); err == nil && number >= s.next {
+			s.next = number + 1
+		}
+	case OpRecall, OpDiscard:
+		if index := s.index(e.ID); index >= 0 {
+			s.held = slices.Delete(s.held, index, index+1)
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", e.Op)
+	}
+	return nil
+}
+
+func (s *Store) load() error {
+	file, err := os.Open(s.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open hold file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024) // A held sale can run to many lines
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("invalid hold entry on line %d: %v", lineNumber, err)
+		}
+		if err := s.apply(e); err != nil {
+			return fmt.Errorf("invalid hold entry on line %d: %v", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read hold file: %v", err)
+	}
+
+	if s.verbose {
+		log.Printf("[HOLD] Loaded %d held transactions from %s", len(s.held), s.filePath)
+	}
+	return nil
+}
+
+// append writes a journal entry to the hold file, if one is configured
+func (s *Store) append(e entry) error {
+	if s.filePath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode hold entry: %v", err)
+	}
+
+	file, err := os.OpenFile(s.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open hold file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write hold file: %v", err)
+	}
+	return nil
+}
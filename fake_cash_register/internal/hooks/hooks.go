@@ -0,0 +1,137 @@
+package hooks
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"fake-cash-register/internal/models"
+)
+
+// Hook observes the receipt lifecycle. Embed NoopHook to implement only the
+// callbacks a plugin needs.
+type Hook interface {
+	Name() string
+	// OnItemAdded is called after a line is added or its quantity incremented
+	OnItemAdded(receipt *models.Receipt, item models.Item)
+	// OnFinalize is called after totals are calculated; returning an error aborts issuing
+	OnFinalize(receipt *models.Receipt) error
+	// OnIssued is called after the receipt was submitted to the receipt bank
+	OnIssued(receipt *models.Receipt)
+	// OnIssueFailed is called when any issuing step fails after finalization. A receipt
+	// rejected by OnFinalize is vetoed, not failed, and is not reported here.
+	OnIssueFailed(receipt *models.Receipt, err error)
+}
+
+// VetoError is returned when a hook's OnFinalize rejects a receipt
+type VetoError struct {
+	Hook string
+	Err  error
+}
+
+func (e *VetoError) Error() string {
+	return fmt.Sprintf("hook %s rejected receipt: %v", e.Hook, e.Err)
+}
+
+func (e *VetoError) Unwrap() error {
+	return e.Err
+}
+
+// NoopHook provides empty implementations of all callbacks
+type NoopHook struct{}
+
+func (NoopHook) OnItemAdded(receipt *models.Receipt, item models.Item) {}
+func (NoopHook) OnFinalize(receipt *models.Receipt) error              { return nil }
+func (NoopHook) OnIssued(receipt *models.Receipt)                      {}
+func (NoopHook) OnIssueFailed(receipt *models.Receipt, err error)      {}
+
+// Registry dispatches lifecycle events to registered hooks in registration order
+type Registry struct {
+	hooks   []Hook
+	verbose bool
+}
+
+// NewRegistry creates an empty hook registry
+func NewRegistry(verbose bool) *Registry {
+	return &Registry{verbose: verbose}
+}
+
+// Register adds a hook to the registry
+func (r *Registry) Register(hook Hook) {
+	r.hooks = append(r.hooks, hook)
+	if r.verbose {
+		log.Printf("[HOOKS] Registered hook: %s", hook.Name())
+	}
+}
+
+// Names returns the names of registered hooks
+func (r *Registry) Names() []string {
+	names := make([]string, len(r.hooks))
+	for i, hook := range r.hooks {
+		names[i] = hook.Name()
+	}
+	return names
+}
+
+func (r *Registry) ItemAdded(receipt *models.Receipt, item models.Item) {
+	for _, hook := range r.hooks {
+		hook.OnItemAdded(receipt, item)
+	}
+}
+
+func (r *Registry) Finalize(receipt *models.Receipt) error {
+	for _, hook := range r.hooks {
+		if err := hook.OnFinalize(receipt); err != nil {
+			return &VetoError{Hook: hook.Name(), Err: err}
+		}
+	}
+	return nil
+}
+
+func (r *Registry) Issued(receipt *models.Receipt) {
+	for _, hook := range r.hooks {
+		hook.OnIssued(receipt)
+	}
+}
+
+func (r *Registry) IssueFailed(receipt *models.Receipt, err error) {
+	for _, hook := range r.hooks {
+		hook.OnIssueFailed(receipt, err)
+	}
+}
+
+// Factory creates a hook instance
+type Factory func(verbose bool) Hook
+
+// builtin contains hooks that can be enabled by name from config
+var builtin = map[string]Factory{
+	"logging": NewLoggingHook,
+}
+
+// RegisterBuiltin makes a hook available for config-driven enablement
+func RegisterBuiltin(name string, factory Factory) {
+	builtin[name] = factory
+}
+
+// Available returns the names of hooks that can be enabled from config
+func Available() []string {
+	names := make([]string, 0, len(builtin))
+	for name := range builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FromConfig builds a registry containing the named built-in hooks
+func FromConfig(enabled []string, verbose bool) (*Registry, error) {
+	registry := NewRegistry(verbose)
+	for _, name := range enabled {
+		factory, exists := builtin[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown hook %q (available: %v)", name, Available())
+		}
+		registry.Register(factory(verbose))
+	}
+	return registry, nil
+}
@@ -0,0 +1,38 @@
+package hooks
+
+import (
+	"log"
+
+	"fake-cash-register/internal/models"
+)
+
+// LoggingHook is an example hook that logs every lifecycle event
+type LoggingHook struct {
+	NoopHook
+}
+
+func NewLoggingHook(verbose bool) Hook {
+	return &LoggingHook{}
+}
+
+func (h *LoggingHook) Name() string {
+	return "logging"
+}
+
+func (h *LoggingHook) OnItemAdded(receipt *models.Receipt, item models.Item) {
+	log.Printf("[HOOK:logging] Item added: KISIM %d x%d @ ₺%.2f", item.KisimID, item.Quantity, item.UnitPrice)
+}
+
+func (h *LoggingHook) OnFinalize(receipt *models.Receipt) error {
+	log.Printf("[HOOK:logging] Finalizing %s: %d items, total ₺%.2f",
+		receipt.TransactionID, len(receipt.Items), receipt.TotalAmount)
+	return nil
+}
+
+func (h *LoggingHook) OnIssued(receipt *models.Receipt) {
+	log.Printf("[HOOK:logging] Issued %s (serial %s)", receipt.TransactionID, receipt.ReceiptSerial)
+}
+
+func (h *LoggingHook) OnIssueFailed(receipt *models.Receipt, err error) {
+	log.Printf("[HOOK:logging] Issue failed for %s: %v", receipt.TransactionID, err)
+}
@@ -0,0 +1,221 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is used when configuration doesn't name one
+const DefaultLocale = "tr"
+
+//go:embed locales/*.json
+var catalogFS embed.FS
+
+// Bundle holds the message catalogs of every supported locale
+type Bundle struct {
+	defaultLocale string
+	catalogs      map[string]map[string]string
+}
+
+// NewBundle loads the built-in catalogs and applies per-locale overrides from configuration.
+// Overrides may also add a locale that has no built-in catalog; missing keys fall back to
+// the default locale.
+func NewBundle(defaultLocale string, overrides map[string]map[string]string) (*Bundle, error) {
+	if defaultLocale == "" {
+		defaultLocale = DefaultLocale
+	}
+
+	bundle := &Bundle{
+		defaultLocale: defaultLocale,
+		catalogs:      make(map[string]map[string]string),
+	}
+
+	files, err := catalogFS.ReadDir("locales")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message catalogs: %v", err)
+	}
+	for _, file := range files {
+		data, err := catalogFS.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read catalog %s: %v", file.Name(), err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("invalid catalog %s: %v", file.Name(), err)
+		}
+		bundle.catalogs[strings.TrimSuffix(file.Name(), ".json")] = messages
+	}
+
+	for locale, messages := range overrides {
+		catalog, exists := bundle.catalogs[locale]
+		if !exists {
+			catalog = make(map[string]string)
+			bundle.catalogs[locale] = catalog
+		}
+		for key, message := range messages {
+			catalog[key] = message
+		}
+	}
+
+	if _, exists := bundle.catalogs[defaultLocale]; !exists {
+		return nil, fmt.Errorf("unsupported default locale %q (available: %s)", defaultLocale, strings.Join(bundle.Locales(), ", "))
+	}
+
+	return bundle, nil
+}
+
+// Locales returns the supported locale codes, sorted
+func (b *Bundle) Locales() []string {
+	locales := make([]string, 0, len(b.catalogs))
+	for locale := range b.catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Localizer returns the localizer for locale, or for the default locale if it isn't supported
+func (b *Bundle) Localizer(locale string) *Localizer {
+	messages, exists := b.catalogs[locale]
+	if !exists {
+		locale = b.defaultLocale
+		messages = b.catalogs[locale]
+	}
+	return &Localizer{
+		locale:   locale,
+		messages: messages,
+		fallback: b.catalogs[b.defaultLocale],
+	}
+}
+
+// Negotiate picks the locale for a request: an explicit lang (e.g. ?lang=en) wins,
+// then the best supported Accept-Language entry, then the default locale
+func (b *Bundle) Negotiate(lang, acceptLanguage string) *Localizer {
+	if _, exists := b.catalogs[lang]; exists {
+		return b.Localizer(lang)
+	}
+
+	type candidate struct {
+		locale string
+		q      float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		// Match on the primary subtag: en-US -> en
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if _, exists := b.catalogs[primary]; exists && q > 0 {
+			candidates = append(candidates, candidate{primary, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	if len(candidates) > 0 {
+		return b.Localizer(candidates[0].locale)
+	}
+	return b.Localizer(b.defaultLocale)
+}
+
+// Localizer translates messages and formats numbers and dates for one locale
+type Localizer struct {
+	locale   string
+	messages map[string]string
+	fallback map[string]string
+}
+
+// Locale returns the locale code
+func (l *Localizer) Locale() string {
+	return l.locale
+}
+
+// T returns the message for key with {0}, {1}... replaced by args.
+// Missing keys fall back to the default locale, then to the key itself.
+func (l *Localizer) T(key string, args ...interface{}) string {
+	message := l.lookup(key)
+	for i, arg := range args {
+		message = strings.ReplaceAll(message, "{"+strconv.Itoa(i)+"}", fmt.Sprint(arg))
+	}
+	return message
+}
+
+// Has reports whether key has a message in this locale or the default locale
+func (l *Localizer) Has(key string) bool {
+	if _, exists := l.messages[key]; exists {
+		return true
+	}
+	_, exists := l.fallback[key]
+	return exists
+}
+
+// Messages returns every message of the locale (with default locale fallbacks) for browser scripts
+func (l *Localizer) Messages() map[string]string {
+	messages := make(map[string]string, len(l.fallback))
+	for key, message := range l.fallback {
+		messages[key] = message
+	}
+	for key, message := range l.messages {
+		messages[key] = message
+	}
+	return messages
+}
+
+// Amount formats a monetary amount with two decimals and the locale's separators (1.234,56 in tr)
+func (l *Localizer) Amount(amount float64) string {
+	return l.Number(amount, 2)
+}
+
+// Number formats value with the given decimals and the locale's separators
+func (l *Localizer) Number(value float64, decimals int) string {
+	formatted := strconv.FormatFloat(math.Abs(value), 'f', decimals, 64)
+	whole, fraction, _ := strings.Cut(formatted, ".")
+
+	var b strings.Builder
+	if value < 0 && strings.Trim(formatted, "0.") != "" {
+		b.WriteByte('-')
+	}
+	separator := l.lookup("format.thousands_separator")
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(separator)
+		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteString(l.lookup("format.decimal_separator"))
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
+
+// Date formats the calendar date in the locale's layout
+func (l *Localizer) Date(t time.Time) string {
+	return t.Format(l.lookup("format.date"))
+}
+
+// Time formats the time of day in the locale's layout
+func (l *Localizer) Time(t time.Time) string {
+	return t.Format(l.lookup("format.time"))
+}
+
+func (l *Localizer) lookup(key string) string {
+	if message, exists := l.messages[key]; exists {
+		return message
+	}
+	if message, exists := l.fallback[key]; exists {
+		return message
+	}
+	return key
+}
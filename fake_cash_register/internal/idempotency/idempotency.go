@@ -0,0 +1,134 @@
+// Package idempotency remembers the responses to mutating API requests by their
+// Idempotency-Key, so a client retrying after a network error gets the original
+// result instead of adding the item or processing the sale twice.
+package idempotency
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInProgress is returned while the first request with a key is still running
+	ErrInProgress = errors.New("a request with this idempotency key is still in progress")
+	// ErrMismatch is returned when a key is reused for a different request
+	ErrMismatch = errors.New("idempotency key was used for a different request")
+)
+
+// Response is a stored response, replayed for retries
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+type entry struct {
+	fingerprint [sha256.Size]byte
+	response    *Response // nil while the first request runs
+	expires     time.Time
+}
+
+// Stats counts stored keys and replayed responses
+type Stats struct {
+	Keys     int `json:"keys"`
+	Replayed int `json:"replayed"`
+}
+
+// Store keeps responses for a window after the request. It is bounded: when full,
+// the entries closest to expiry make room.
+type Store struct {
+	window     time.Duration
+	maxEntries int
+
+	mu       sync.Mutex
+	entries  map[string]*entry
+	replayed int
+}
+
+// NewStore creates a store keeping responses for window, at most maxEntries at a time
+func NewStore(window time.Duration, maxEntries int) *Store {
+	return &Store{
+		window:     window,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*entry),
+	}
+}
+
+// Fingerprint identifies a request, so a key can't be replayed for a different one
+func Fingerprint(method, path string, body []byte) [sha256.Size]byte {
+	return sha256.Sum256(append([]byte(method+" "+path+"\n"), body...))
+}
+
+// Begin claims key for the request with fingerprint. It returns the stored response
+// when the request was made before, ErrInProgress while that first request still runs
+// and ErrMismatch when the key belongs to a different request. Otherwise it returns
+// nil, nil: the caller runs the request and then calls Finish or Abandon.
+func (s *Store) Begin(key string, fingerprint [sha256.Size]byte) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := s.entries[key]; ok && now.Before(existing.expires) {
+		switch {
+		case existing.fingerprint != fingerprint:
+			return nil, ErrMismatch
+		case existing.response == nil:
+			return nil, ErrInProgress
+		}
+		s.replayed++
+		return existing.response, nil
+	}
+
+	s.prune(now)
+	s.entries[key] = &entry{fingerprint: fingerprint, expires: now.Add(s.window)}
+	return nil, nil
+}
+
+// Finish stores the response to the request that claimed key
+func (s *Store) Finish(key string, response Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.entries[key]; ok && existing.response == nil {
+		existing.response = &response
+		existing.expires = time.Now().Add(s.window)
+	}
+}
+
+// Abandon releases key without a response, so a retry runs the request again
+func (s *Store) Abandon(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.entries[key]; ok && existing.response == nil {
+		delete(s.entries, key)
+	}
+}
+
+// Stats returns the number of stored keys and of replayed responses
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{Keys: len(s.entries), Replayed: s.replayed}
+}
+
+// prune drops expired entries and, when still full, those closest to expiry;
+// the caller must hold the lock
+func (s *Store) prune(now time.Time) {
+	for key, existing := range s.entries {
+		if !now.Before(existing.expires) {
+			delete(s.entries, key)
+		}
+	}
+	for s.maxEntries > 0 && len(s.entries) >= s.maxEntries {
+		var oldest string
+		for key, existing := range s.entries {
+			if oldest == "" || existing.expires.Before(s.entries[oldest].expires) {
+				oldest = key
+			}
+		}
+		delete(s.entries, oldest)
+	}
+}
@@ -1,17 +1,104 @@
 package interfaces
 
+import (
+	"errors"
+	"time"
+
+	"receiptwallet/receiptbank"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/models"
+)
+
 // RevenueAuthorityService handles receipt hash signing with binary data
 type RevenueAuthorityService interface {
 	SignHash(hash []byte) ([]byte, error)
+	// SignHashWithTimestamp also returns an authority-attested timestamp token
+	SignHashWithTimestamp(hash []byte) (signature []byte, timestampToken []byte, err error)
 	GetPublicKey() ([]byte, error)
 }
 
+// ReceiptSigner is implemented by authorities that check receipt contents before
+// signing (strict signing); the signature still covers the SHA-256 of binaryReceipt
+type ReceiptSigner interface {
+	SignReceipt(binaryReceipt []byte, withTimestamp bool) (signature []byte, timestampToken []byte, err error)
+}
+
+// AuthorityKeyCache is implemented by authorities whose public key the register caches,
+// so GetPublicKey keeps answering while the authority is unreachable
+type AuthorityKeyCache interface {
+	// PublicKeyStatus reports when the key was last fetched or confirmed unchanged,
+	// and why the latest refresh failed (nil after a successful one)
+	PublicKeyStatus() (fetchedAt time.Time, lastErr error)
+}
+
+// ZReportSubmitter is implemented by authorities that accept end-of-day Z-report summaries
+type ZReportSubmitter interface {
+	SubmitZReport(report *models.ZReport) error
+}
+
 // ReceiptBankService handles encrypted receipt submission with privacy-preserving indexing
 type ReceiptBankService interface {
 	SubmitReceipt(userEphemeralKeyCompressed []byte, encryptedData []byte) error
 	SetWebhookHandler(handler WebhookHandler)
 }
 
+// AttestedSubmitter is implemented by receipt banks that accept the receipt hash and the
+// revenue authority's signature with a submission, so a strict bank can reject unsigned data
+type AttestedSubmitter interface {
+	SubmitAttestedReceipt(userEphemeralKeyCompressed []byte, encryptedData []byte, receiptHash []byte, signature []byte) error
+}
+
+// TrackedSubmitter is implemented by receipt banks that submit under a receipt ID chosen
+// by the register, which the bank's collection webhook reports back
+type TrackedSubmitter interface {
+	SubmitTrackedReceipt(receiptID string, userEphemeralKeyCompressed []byte, encryptedData []byte, receiptHash []byte, signature []byte) error
+}
+
+// ErrIncompatibleBank is returned by FormatChecker when the receipt bank, or the wallets
+// collecting from it, cannot handle the register's protocol version or receipt format
+var ErrIncompatibleBank = errors.New("receipt bank is incompatible")
+
+// Receipt bank refusals, reported by the bank's error codes; match them with errors.Is.
+// They are the bank client's sentinels, so the mock bank and the real one agree.
+var (
+	ErrBankInvalidKey   = receiptbank.ErrInvalidKey
+	ErrDuplicateReceipt = receiptbank.ErrDuplicateReceipt
+	ErrReceiptNotFound  = receiptbank.ErrNotFound
+	ErrBankRateLimited  = receiptbank.ErrRateLimited
+	ErrBankStorageFull  = receiptbank.ErrStorageFull
+	// ErrBankWebhookUnverified is returned when the bank's challenge to our webhook URL
+	// went unanswered, so it won't take receipts that would notify it
+	ErrBankWebhookUnverified = receiptbank.ErrWebhookUnverified
+)
+
+// FormatChecker is implemented by receipt banks that advertise their protocol and
+// binary receipt format versions, so receipts are refused before they are signed
+type FormatChecker interface {
+	CheckFormat(version uint8) error
+}
+
+// ReceiptCollector retrieves an encrypted receipt by the wallet's ephemeral key,
+// letting the register act as its own customer in standalone demos
+type ReceiptCollector interface {
+	CollectReceipt(userEphemeralKeyCompressed []byte) ([]byte, error)
+}
+
+// ReceiptDeliverer sends signed receipts by email or SMS to customers without the
+// wallet app. Deliver blocks until the message is handed to the mail server or gateway.
+type ReceiptDeliverer interface {
+	Supports(channel string) bool
+	Deliver(receipt *models.Receipt, signedReceipt []byte, recipient models.Recipient) error
+}
+
+// DeviceController drives the checkout hardware: the cash drawer and the beeper.
+// Calls may block for as long as the hardware takes to respond.
+type DeviceController interface {
+	OpenDrawer() error
+	// Beep sounds a feedback signal (devices.BeepItem or devices.BeepError)
+	Beep(signal string) error
+}
+
 // CryptoService handles cryptographic operations with binary data (privacy-preserving)
 // Key validation is handled internally by the encryption method
 type CryptoService interface {
@@ -27,7 +114,7 @@ type CryptoService interface {
 
 // WebhookHandler handles receipt bank confirmations
 type WebhookHandler interface {
-	HandleDownloadConfirmation(receiptID string) error
+	HandleDownloadConfirmation(payload api.WebhookPayload) error
 }
 
 // StoreInfo contains store configuration data
@@ -0,0 +1,231 @@
+package kisim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"fake-cash-register/internal/models"
+)
+
+// ErrInvalidCatalog is wrapped by every error for a pulled catalog the registers cannot sell from
+var ErrInvalidCatalog = errors.New("invalid KISIM catalog")
+
+// Catalog is the set of KISIMs the registers sell from. It starts as the configured list
+// and can be replaced as a whole by a newer version from head office; sales look
+// KISIMs up in whichever version is current when the item is added.
+type Catalog struct {
+	groups   []GroupDef // Configured groups, kept when a pulled catalog brings none
+	pageSize int
+	verbose  bool
+
+	mu      sync.RWMutex
+	version string // "" for the configured catalog
+	kisim   []models.KisimInfo
+	lookup  models.KisimLookup
+	layout  *Layout
+}
+
+// NewCatalog arranges the configured KISIMs. The groups and page size also lay out
+// every catalog pulled later.
+func NewCatalog(groups []GroupDef, kisim []KisimDef, pageSize int, verbose bool) (*Catalog, error) {
+	c := &Catalog{groups: groups, pageSize: pageSize, verbose: verbose}
+	if err := c.replace("", groups, kisim); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetKisimInfo returns KISIM information by ID from the current catalog
+func (c *Catalog) GetKisimInfo(kisimID int) (models.KisimInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lookup.GetKisimInfo(kisimID)
+}
+
+// Version returns the version of the current catalog, "" while it is the configured one
+func (c *Catalog) Version() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.version
+}
+
+// Kisim returns every KISIM in catalog order
+func (c *Catalog) Kisim() []models.KisimInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.kisim
+}
+
+// Layout returns the keypad arrangement of the current catalog
+func (c *Catalog) Layout() *Layout {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.layout
+}
+
+// Replace checks a catalog version and swaps it in. Without groups the configured
+// groups are kept. An invalid catalog leaves the current one in place.
+func (c *Catalog) Replace(version string, groups []GroupDef, kisim []KisimDef) error {
+	if version == "" {
+		return fmt.Errorf("%w: no version", ErrInvalidCatalog)
+	}
+	if len(kisim) == 0 {
+		return fmt.Errorf("%w: version %s has no KISIMs", ErrInvalidCatalog, version)
+	}
+	for _, k := range kisim {
+		switch {
+		case k.Info.Name == "":
+			return fmt.Errorf("%w: KISIM %d has no name", ErrInvalidCatalog, k.Info.ID)
+		case !models.CarriesTaxRate(k.Info.TaxRate):
+			return fmt.Errorf("%w: KISIM %d has tax rate %d", ErrInvalidCatalog, k.Info.ID, k.Info.TaxRate)
+		case k.Info.PresetPrice < 0:
+			return fmt.Errorf("%w: KISIM %d has a negative price", ErrInvalidCatalog, k.Info.ID)
+		}
+	}
+	if groups == nil {
+		groups = c.groups
+	}
+	if err := c.replace(version, groups, kisim); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCatalog, err)
+	}
+
+	if c.verbose {
+		log.Printf("[KISIM] Catalog %s in use: %d KISIMs", version, len(kisim))
+	}
+	return nil
+}
+
+func (c *Catalog) replace(version string, groups []GroupDef, kisim []KisimDef) error {
+	for _, k := range kisim {
+		if err := checkTaxRates(k.Info); err != nil {
+			return err
+		}
+	}
+	layout, err := NewLayout(groups, kisim, c.pageSize)
+	if err != nil {
+		return err
+	}
+	list := make([]models.KisimInfo, len(kisim))
+	lookup := make(models.KisimLookup, len(kisim))
+	for i, k := range kisim {
+		list[i] = k.Info
+		lookup[k.Info.ID] = k.Info
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version, c.kisim, c.lookup, c.layout = version, list, lookup, layout
+	return nil
+}
+
+// checkTaxRates requires the rate and scheduled rate changes to be rates a receipt can
+// carry, the changes in date order
+func checkTaxRates(info models.KisimInfo) error {
+	if !models.CarriesTaxRate(info.TaxRate) {
+		return fmt.Errorf("KISIM %d has tax rate %d; receipts carry 0%%, 10%% and 20%% only", info.ID, info.TaxRate)
+	}
+	for i, change := range info.TaxRates {
+		if !models.CarriesTaxRate(change.Rate) {
+			return fmt.Errorf("KISIM %d has tax rate %d from %s", info.ID, change.Rate, change.ValidFrom.Format(time.RFC3339))
+		}
+		if i > 0 && !change.ValidFrom.After(info.TaxRates[i-1].ValidFrom) {
+			return fmt.Errorf("KISIM %d has tax rate changes out of date order", info.ID)
+		}
+	}
+	return nil
+}
+
+// StartSync periodically pulls the catalog from url, a head-office endpoint answering
+// {"version": "...", "kisim": [{"id": 1, "name": "...", "tax_rate": 10, "preset_price": 0,
+// "weighed": false, "group": "...", "order": 1, "tax_rates": [{"rate": 20, "valid_from":
+// "RFC 3339"}]}], "groups": [...]}. A version already in
+// use is not replaced again; failures keep the current catalog and are retried next time.
+func (c *Catalog) StartSync(url string, interval time.Duration) {
+	if url == "" || interval <= 0 {
+		return
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := c.sync(client, url); err != nil {
+				log.Printf("[KISIM] Catalog sync failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+
+	if c.verbose {
+		log.Printf("[KISIM] Syncing the catalog from %s every %v", url, interval)
+	}
+}
+
+// catalogPayload is the catalog as head office publishes it
+type catalogPayload struct {
+	Version string `json:"version"`
+	Kisim   []struct {
+		ID          int                    `json:"id"`
+		Name        string                 `json:"name"`
+		TaxRate     int                    `json:"tax_rate"`
+		PresetPrice float64                `json:"preset_price"`
+		Weighed     bool                   `json:"weighed"`
+		Group       string                 `json:"group"`
+		Order       int                    `json:"order"`
+		TaxRates    []models.TaxRateChange `json:"tax_rates"`
+	} `json:"kisim"`
+	Groups []struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		Color string `json:"color"`
+		Order int    `json:"order"`
+	} `json:"groups"` // Omitted to keep the configured groups
+}
+
+func (c *Catalog) sync(client *http.Client, url string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("catalog source returned status %d", resp.StatusCode)
+	}
+
+	var payload catalogPayload
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return fmt.Errorf("failed to parse catalog: %v", err)
+	}
+	if payload.Version != "" && payload.Version == c.Version() {
+		return nil
+	}
+	return c.replacePayload(payload)
+}
+
+// replacePayload swaps in a catalog as head office publishes it
+func (c *Catalog) replacePayload(payload catalogPayload) error {
+	var groups []GroupDef
+	if payload.Groups != nil {
+		groups = make([]GroupDef, len(payload.Groups))
+		for i, g := range payload.Groups {
+			groups[i] = GroupDef{ID: g.ID, Name: g.Name, Color: g.Color, Order: g.Order}
+		}
+	}
+	kisim := make([]KisimDef, len(payload.Kisim))
+	for i, k := range payload.Kisim {
+		kisim[i] = KisimDef{
+			Info:  models.KisimInfo{ID: k.ID, Name: k.Name, TaxRate: k.TaxRate, PresetPrice: k.PresetPrice, Weighed: k.Weighed, TaxRates: k.TaxRates},
+			Group: k.Group,
+			Order: k.Order,
+		}
+	}
+	return c.Replace(payload.Version, groups, kisim)
+}
@@ -0,0 +1,134 @@
+package kisim
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+
+	"fake-cash-register/internal/models"
+)
+
+// DefaultPageSize fills the 4 × 3 department grid of the UI
+const DefaultPageSize = 12
+
+// OtherGroup collects KISIMs that name no group; the UI shows it under a localized name
+const OtherGroup = "other"
+
+// ErrInvalidLayout is wrapped by every layout configuration error
+var ErrInvalidLayout = errors.New("invalid KISIM layout")
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// GroupDef is a configured KISIM group
+type GroupDef struct {
+	ID    string
+	Name  string
+	Color string // "#rrggbb", "" leaves the default key color
+	Order int    // Lower first; ties keep the configured order
+}
+
+// KisimDef is a configured KISIM with its place on the keypad
+type KisimDef struct {
+	Info  models.KisimInfo
+	Group string // GroupDef.ID, "" for OtherGroup
+	Order int    // Position within the group; ties keep the configured order
+}
+
+// Layout arranges the department keys of the register into groups and pages
+type Layout struct {
+	PageSize int
+	Groups   []models.KisimGroup
+}
+
+// NewLayout checks the configured groups and KISIMs and arranges them. Without groups
+// every KISIM lands in OtherGroup; groups that end up empty are left out.
+func NewLayout(groups []GroupDef, kisim []KisimDef, pageSize int) (*Layout, error) {
+	if pageSize < 0 {
+		return nil, fmt.Errorf("%w: page size %d", ErrInvalidLayout, pageSize)
+	}
+	if pageSize == 0 {
+		pageSize = DefaultPageSize
+	}
+
+	members := make(map[string][]KisimDef, len(groups)+1)
+	for i, g := range groups {
+		switch {
+		case g.ID == "" || g.ID == OtherGroup:
+			return nil, fmt.Errorf("%w: group %d needs an id other than %q", ErrInvalidLayout, i+1, OtherGroup)
+		case g.Name == "":
+			return nil, fmt.Errorf("%w: group %q has no name", ErrInvalidLayout, g.ID)
+		case g.Color != "" && !colorPattern.MatchString(g.Color):
+			return nil, fmt.Errorf("%w: group %q color %q is not #rrggbb", ErrInvalidLayout, g.ID, g.Color)
+		}
+		if _, dup := members[g.ID]; dup {
+			return nil, fmt.Errorf("%w: duplicate group %q", ErrInvalidLayout, g.ID)
+		}
+		members[g.ID] = nil
+	}
+
+	seen := make(map[int]bool, len(kisim))
+	for _, k := range kisim {
+		if k.Info.ID < 1 || k.Info.ID > math.MaxUint16 {
+			return nil, fmt.Errorf("%w: KISIM id %d out of range 1-%d", ErrInvalidLayout, k.Info.ID, math.MaxUint16)
+		}
+		if seen[k.Info.ID] {
+			return nil, fmt.Errorf("%w: duplicate KISIM id %d", ErrInvalidLayout, k.Info.ID)
+		}
+		seen[k.Info.ID] = true
+
+		group := k.Group
+		if group == "" {
+			group = OtherGroup
+		} else if _, ok := members[group]; !ok {
+			return nil, fmt.Errorf("%w: KISIM %d is in unknown group %q", ErrInvalidLayout, k.Info.ID, k.Group)
+		}
+		members[group] = append(members[group], k)
+	}
+
+	ordered := append([]GroupDef{}, groups...)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Order < ordered[j].Order })
+	ordered = append(ordered, GroupDef{ID: OtherGroup}) // Always last
+
+	layout := &Layout{PageSize: pageSize}
+	for _, def := range ordered {
+		keys := members[def.ID]
+		if len(keys) == 0 {
+			continue
+		}
+		sort.SliceStable(keys, func(i, j int) bool { return keys[i].Order < keys[j].Order })
+
+		group := models.KisimGroup{ID: def.ID, Name: def.Name, Color: def.Color, Order: def.Order, Size: len(keys)}
+		for start := 0; start < len(keys); start += pageSize {
+			page := models.KisimPage{Number: len(group.Pages) + 1}
+			for _, k := range keys[start:min(start+pageSize, len(keys))] {
+				page.Kisim = append(page.Kisim, k.Info)
+			}
+			group.Pages = append(group.Pages, page)
+		}
+		layout.Groups = append(layout.Groups, group)
+	}
+	return layout, nil
+}
+
+// Group returns the group with the given ID
+func (l *Layout) Group(id string) (models.KisimGroup, bool) {
+	for _, g := range l.Groups {
+		if g.ID == id {
+			return g, true
+		}
+	}
+	return models.KisimGroup{}, false
+}
+
+// Kisim returns every KISIM in keypad order
+func (l *Layout) Kisim() []models.KisimInfo {
+	var all []models.KisimInfo
+	for _, g := range l.Groups {
+		for _, p := range g.Pages {
+			all = append(all, p.Kisim...)
+		}
+	}
+	return all
+}
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"fake-cash-register/internal/i18n"
+	"fake-cash-register/internal/taxid"
+)
+
+// ReceiptWidth is the character width of rendered receipt text (80 mm thermal paper)
+const ReceiptWidth = 32
+
+// PrintLine is one line of the printer-style receipt layout
+type PrintLine struct {
+	Left     string
+	Right    string // Aligned to the right edge
+	Centered bool   // Left is centered
+	Bold     bool   // Totals, for printers that can emphasize them
+	Rule     bool   // Separator
+	Logo     bool   // Logo placeholder; ESC/POS prints the printer's stored logo instead
+}
+
+// FormatForDisplay renders the receipt as printer-style text in the localizer's language.
+// Fiscal labels (KDV, TOPKDV, VKN) come from the catalog, so they can be kept in Turkish
+// for any locale through configuration overrides. tmpl is the store's receipt template,
+// nil for the default layout.
+func (r *Receipt) FormatForDisplay(loc *i18n.Localizer, tmpl *ReceiptTemplate) string {
+	var b strings.Builder
+	for _, line := range r.PrintLines(loc, tmpl) {
+		b.WriteString(line.Format())
+	}
+	return b.String()
+}
+
+// PrintLines lays the receipt out for a ReceiptWidth-column printer
+func (r *Receipt) PrintLines(loc *i18n.Localizer, tmpl *ReceiptTemplate) []PrintLine {
+	var lines []PrintLine
+	add := func(left, right string) {
+		lines = append(lines, PrintLine{Left: left, Right: right})
+	}
+	center := func(texts ...string) {
+		for _, text := range texts {
+			for _, wrapped := range WrapText(text, ReceiptWidth) {
+				lines = append(lines, PrintLine{Left: wrapped, Centered: true})
+			}
+		}
+	}
+	rule := func() {
+		lines = append(lines, PrintLine{Rule: true})
+	}
+
+	for _, text := range tmpl.Section(SectionLogo, r, loc) {
+		lines = append(lines, PrintLine{Left: text, Centered: true, Logo: true})
+	}
+	center(tmpl.Section(SectionHeader, r, loc, r.StoreName, r.StoreAddress, loc.T("receipt.vkn")+": "+r.StoreVKN)...)
+	rule()
+
+	add(loc.T("receipt.date")+": "+loc.Date(r.Timestamp), loc.T("receipt.time")+": "+loc.Time(r.Timestamp))
+	add(loc.T("receipt.serial")+": "+r.ReceiptSerial, "")
+	rule()
+
+	if r.RefundOf != nil {
+		center(loc.T("receipt.refund"))
+		add(loc.T("receipt.refund_of")+": "+r.RefundOf.ReceiptSerial, loc.Date(r.RefundOf.Timestamp))
+		rule()
+	}
+
+	if r.Customer != nil {
+		for _, wrapped := range WrapText(loc.T("receipt.customer")+": "+r.Customer.Name, ReceiptWidth) {
+			add(wrapped, "")
+		}
+		add(r.Customer.TaxLabel(loc)+": "+r.Customer.TaxNumber, "")
+		rule()
+	}
+
+	for _, item := range r.Items {
+		// Receipts decoded from the binary format only carry the kisim ID
+		name := item.KisimName
+		if name == "" {
+			name = loc.T("receipt.kisim", item.KisimID)
+		}
+		add(name, "%"+loc.Number(float64(item.TaxRate), 0))
+		add("  "+item.QuantityLine(loc), "*"+loc.Amount(item.TotalPrice))
+		for _, wrapped := range WrapText(item.Note, ReceiptWidth-2) {
+			add("  "+wrapped, "")
+		}
+	}
+	for _, surcharge := range r.Surcharges {
+		add(surcharge.Name, "%"+loc.Number(float64(surcharge.TaxRate), 0))
+		add("", "*"+loc.Amount(surcharge.Amount))
+	}
+	rule()
+
+	for _, tax := range r.TaxBreakdown.RateDetails() {
+		if tax.TaxAmount > 0 {
+			add(tmpl.Label(SectionTaxLabel, r, loc, tax.Rate, loc.T("receipt.tax_rate", tax.Rate)), "*"+loc.Amount(tax.TaxAmount))
+		}
+	}
+	lines = append(lines,
+		PrintLine{Left: tmpl.Label(SectionTotalTaxLabel, r, loc, 0, loc.T("receipt.total_tax")), Right: "*" + loc.Amount(r.TaxBreakdown.TotalTax), Bold: true},
+		PrintLine{Left: loc.T("receipt.total"), Right: "*" + loc.Amount(r.TotalAmount), Bold: true},
+	)
+
+	// Cash rounding is shown apart from the fiscal total, which it doesn't change
+	if r.Rounding != 0 {
+		add(loc.T("receipt.rounding"), "*"+loc.Amount(r.Rounding))
+		lines = append(lines, PrintLine{Left: loc.T("receipt.amount_due"), Right: "*" + loc.Amount(r.AmountDue), Bold: true})
+	}
+
+	if r.Currency != "" {
+		add(r.Currency, "*"+loc.Amount(r.ForeignTotal))
+		add("  "+loc.T("receipt.exchange_rate"), loc.Number(r.ExchangeRate, 4))
+	}
+
+	if r.PaymentMethod != "" {
+		payment := r.PaymentMethod
+		if key := "payment." + r.PaymentMethod; loc.Has(key) {
+			payment = loc.T(key)
+		}
+		add(loc.T("receipt.payment"), payment)
+	}
+	for _, text := range tmpl.Section(SectionLegal, r, loc) {
+		for _, wrapped := range WrapText(text, ReceiptWidth) {
+			add(wrapped, "")
+		}
+	}
+	rule()
+
+	add(loc.T("receipt.z_report")+": "+r.ZReportNumber, "")
+	add(loc.T("receipt.transaction")+": "+r.TransactionID, "")
+	center(tmpl.Section(SectionFooter, r, loc, loc.T("receipt.footer"))...)
+
+	return lines
+}
+
+// Format renders the line as text, wrapped over more lines when it doesn't fit
+func (l PrintLine) Format() string {
+	var b strings.Builder
+	switch {
+	case l.Rule:
+		b.WriteString(strings.Repeat("-", ReceiptWidth) + "\n")
+	case l.Centered:
+		writeCentered(&b, l.Left)
+	default:
+		writeColumns(&b, l.Left, l.Right)
+	}
+	return b.String()
+}
+
+// WrapText breaks text into lines of at most width characters, at spaces where possible
+func WrapText(text string, width int) []string {
+	if text == "" {
+		return nil
+	}
+	var lines []string
+	current := ""
+	for _, word := range strings.Fields(text) {
+		for utf8.RuneCountInString(word) > width {
+			if current != "" {
+				lines = append(lines, current)
+				current = ""
+			}
+			runes := []rune(word)
+			lines = append(lines, string(runes[:width]))
+			word = string(runes[width:])
+		}
+		switch {
+		case current == "":
+			current = word
+		case utf8.RuneCountInString(current)+1+utf8.RuneCountInString(word) <= width:
+			current += " " + word
+		default:
+			lines = append(lines, current)
+			current = word
+		}
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// writeColumns writes left and right aligned text on one line, wrapping if they don't fit
+func writeColumns(b *strings.Builder, left, right string) {
+	if right == "" {
+		b.WriteString(left + "\n")
+		return
+	}
+	padding := ReceiptWidth - utf8.RuneCountInString(left) - utf8.RuneCountInString(right)
+	if padding < 1 {
+		b.WriteString(left + "\n")
+		left, padding = "", ReceiptWidth-utf8.RuneCountInString(right)
+	}
+	b.WriteString(left + strings.Repeat(" ", max(padding, 0)) + right)
+	b.WriteString("\n")
+}
+
+func writeCentered(b *strings.Builder, text string) {
+	if text == "" {
+		return
+	}
+	padding := (ReceiptWidth - utf8.RuneCountInString(text)) / 2
+	b.WriteString(strings.Repeat(" ", max(padding, 0)) + text + "\n")
+}
+
+// TaxLabel is VKN or TCKN, whichever the customer's tax number is, in the localizer's language
+func (c *Customer) TaxLabel(loc *i18n.Localizer) string {
+	if taxid.Kind(c.TaxNumber) == taxid.KindTCKN {
+		return loc.T("receipt.tckn")
+	}
+	return loc.T("receipt.vkn")
+}
+
+// QuantityLine is the "2 x 5,50" part of an item's receipt line; weighed lines
+// show the weight in kilograms, "1,234 kg x 50,00"
+func (i Item) QuantityLine(loc *i18n.Localizer) string {
+	if i.Weighed {
+		return loc.Number(i.Kilograms(), 3) + " kg x " + loc.Amount(i.UnitPrice)
+	}
+	return loc.Number(float64(i.Quantity), 0) + " x " + loc.Amount(i.UnitPrice)
+}
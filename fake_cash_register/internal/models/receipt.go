@@ -1,6 +1,8 @@
 package models
 
 import (
+	"math"
+	"slices"
 	"time"
 )
 
@@ -12,12 +14,93 @@ type Receipt struct {
 	StoreName     string       `json:"store_name"`
 	StoreAddress  string       `json:"store_address"`
 	Items         []Item       `json:"items"`
+	Surcharges    []Surcharge  `json:"surcharges,omitempty"` // Payment method fees, counted in the total and tax
 	TaxBreakdown  TaxBreakdown `json:"tax_breakdown"`
 	TotalAmount   float64      `json:"total_amount"`
 	PaymentMethod string       `json:"payment_method"`
 	ReceiptSerial string       `json:"receipt_serial"`
+
+	// Foreign currency sale (empty when paid in the base currency).
+	// The rate is locked in when the receipt is finalized.
+	Currency     string  `json:"currency,omitempty"`      // ISO 4217 code
+	ExchangeRate float64 `json:"exchange_rate,omitempty"` // Base units per one foreign unit
+	ForeignTotal float64 `json:"foreign_total,omitempty"` // TotalAmount in Currency, rounded to its minor unit
+
+	// Cash rounding by payment method, set when the method has a rounding rule. The customer
+	// pays AmountDue; Rounding = AmountDue - TotalAmount is not part of the signed receipt,
+	// so the fiscal total and KDV are unchanged.
+	Rounding  float64 `json:"rounding,omitempty"`
+	AmountDue float64 `json:"amount_due,omitempty"`
+
+	// Business customer of an invoiced sale, who can claim the receipt as an expense
+	// (nil for anonymous sales)
+	Customer *Customer `json:"customer,omitempty"`
+
+	// Email/SMS delivery for customers without the wallet app (nil when not requested)
+	Delivery *Delivery `json:"delivery,omitempty"`
+
+	// Sale this receipt refunds (nil for sales). A refund lists the returned lines with
+	// positive amounts, like a sale; the reference is what makes it money paid back.
+	RefundOf *ReceiptRef `json:"refund_of,omitempty"`
+
+	// Version of the head-office KISIM catalog in use when the receipt was issued
+	// (empty with the configured KISIMs). Not part of the signed receipt.
+	CatalogVersion string `json:"catalog_version,omitempty"`
+
+	// Compressed public key of the register's device key, which signs the receipt next
+	// to the authority (nil when the register has no device key)
+	DeviceKey []byte `json:"device_key,omitempty"`
+}
+
+// ReceiptRef identifies an issued receipt
+type ReceiptRef struct {
+	TransactionID string    `json:"transaction_id"`
+	ReceiptSerial string    `json:"receipt_serial"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// IsRefund reports whether the receipt pays back an earlier sale
+func (r *Receipt) IsRefund() bool {
+	return r.RefundOf != nil
+}
+
+// Customer identifies the buyer on a corporate receipt
+type Customer struct {
+	TaxNumber string `json:"tax_number"` // 10-digit VKN or 11-digit TCKN
+	Name      string `json:"name"`       // Company title or the person's full name
+}
+
+// Delivery channels
+const (
+	DeliveryEmail = "email"
+	DeliverySMS   = "sms"
+)
+
+// Delivery statuses
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+)
+
+// Recipient is where a receipt is delivered when the customer has no wallet app
+type Recipient struct {
+	Channel string // DeliveryEmail or DeliverySMS
+	Address string // Email address or phone number
+}
+
+// Delivery records the outcome of sending a receipt by email or SMS.
+// The recipient is kept masked, so history doesn't hold customer contact details.
+type Delivery struct {
+	Channel   string    `json:"channel"`
+	Recipient string    `json:"recipient"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// Item is one receipt line. On a weighed line Quantity is the weight in grams
+// and UnitPrice the price per kilogram.
 type Item struct {
 	KisimID    int     `json:"kisim_id"`
 	KisimName  string  `json:"kisim_name"`
@@ -25,12 +108,49 @@ type Item struct {
 	UnitPrice  float64 `json:"unit_price"`
 	TotalPrice float64 `json:"total_price"`
 	TaxRate    int     `json:"tax_rate"`
+	Weighed    bool    `json:"weighed,omitempty"`
+	Note       string  `json:"note,omitempty"` // Printed under the line, e.g. "no sugar" or a serial number
+}
+
+// Surcharge is a fee charged for the payment method, e.g. 2% for a card scheme or a
+// fixed delivery fee. Amount includes KDV at TaxRate, like an item's total.
+type Surcharge struct {
+	Name    string  `json:"name"`
+	Amount  float64 `json:"amount"`
+	TaxRate int     `json:"tax_rate"`
+}
+
+// GramsPerKilogram converts weighed quantities to the unit their price is given in
+const GramsPerKilogram = 1000
+
+// LineTotal is the price of quantity at unitPrice, rounded to the kuruş for
+// weighed lines whose weight doesn't come to a whole kuruş
+func LineTotal(quantity int, unitPrice float64, weighed bool) float64 {
+	if weighed {
+		return math.Round(unitPrice*float64(quantity)/GramsPerKilogram*100) / 100
+	}
+	return unitPrice * float64(quantity)
+}
+
+// Kilograms is the weight of a weighed line
+func (i Item) Kilograms() float64 {
+	return float64(i.Quantity) / GramsPerKilogram
+}
+
+// CarriesTaxRate reports whether a receipt can hold lines at rate: the binary tax
+// breakdown, and so the total tax, only has 10% and 20%, and 0% lines carry no tax to
+// leave out. KISIMs and surcharges at other rates are refused.
+func CarriesTaxRate(rate int) bool {
+	return rate == 0 || rate == 10 || rate == 20
 }
 
 type TaxBreakdown struct {
 	Tax10Percent TaxDetail `json:"tax_10_percent"`
 	Tax20Percent TaxDetail `json:"tax_20_percent"`
 	TotalTax     float64   `json:"total_tax"`
+	// Every rate applied, by rate. The binary receipt only carries 10% and 20%, so
+	// receipts decoded from it have none; see RateDetails.
+	Rates []RateTaxDetail `json:"rates,omitempty"`
 }
 
 type TaxDetail struct {
@@ -38,19 +158,99 @@ type TaxDetail struct {
 	TaxAmount     float64 `json:"tax_amount"`
 }
 
+// RateTaxDetail is the taxable amount and tax at one rate
+type RateTaxDetail struct {
+	Rate int `json:"rate"`
+	TaxDetail
+}
+
+// RateDetails returns the tax per rate applied, falling back to the 10% and 20%
+// totals for receipts without Rates
+func (b TaxBreakdown) RateDetails() []RateTaxDetail {
+	if len(b.Rates) > 0 {
+		return b.Rates
+	}
+	var rates []RateTaxDetail
+	for _, rate := range []RateTaxDetail{{10, b.Tax10Percent}, {20, b.Tax20Percent}} {
+		if rate.TaxAmount != 0 || rate.TaxableAmount != 0 {
+			rates = append(rates, rate)
+		}
+	}
+	return rates
+}
+
+// AddRate adds amounts at a rate to Rates, keeping them ordered by rate
+func (b *TaxBreakdown) AddRate(rate int, taxable, tax float64) {
+	i := 0
+	for i < len(b.Rates) && b.Rates[i].Rate < rate {
+		i++
+	}
+	if i == len(b.Rates) || b.Rates[i].Rate != rate {
+		b.Rates = slices.Insert(b.Rates, i, RateTaxDetail{Rate: rate})
+	}
+	b.Rates[i].TaxableAmount += taxable
+	b.Rates[i].TaxAmount += tax
+}
+
 // NOTE: ProcessTransactionResponse removed - RESTful APIs return Receipt directly
 // (renamed from /process to /issue_receipt for clarity)
 // with appropriate HTTP status codes (200 for success, 400/500 for errors)
 
 type KisimResponse struct {
-	Kisim []KisimInfo `json:"kisim"`
+	Kisim    []KisimInfo  `json:"kisim"`
+	PageSize int          `json:"page_size,omitempty"`
+	Groups   []KisimGroup `json:"groups,omitempty"`
+	Version  string       `json:"version,omitempty"` // Head-office catalog version, empty when configured
+}
+
+// KisimGroup is a group of department keys split into pages
+type KisimGroup struct {
+	ID    string      `json:"id"`
+	Name  string      `json:"name"` // Empty for the "other" group, named by the UI
+	Color string      `json:"color,omitempty"`
+	Order int         `json:"order"`
+	Size  int         `json:"size"` // KISIMs in the group
+	Pages []KisimPage `json:"pages"`
+}
+
+// KisimPage is one screen of department keys
+type KisimPage struct {
+	Number int         `json:"number"` // From 1
+	Kisim  []KisimInfo `json:"kisim"`
 }
 
 type KisimInfo struct {
 	ID          int     `json:"id"`
 	Name        string  `json:"name"`
 	TaxRate     int     `json:"tax_rate"`
-	PresetPrice float64 `json:"preset_price"`
+	PresetPrice float64 `json:"preset_price"`      // Per kilogram when Weighed
+	Weighed     bool    `json:"weighed,omitempty"` // Sold by weight from the scale
+	// Rates taking over from TaxRate by law on set dates, in ValidFrom order
+	TaxRates []TaxRateChange `json:"tax_rates,omitempty"`
+}
+
+// TaxRateChange is a tax rate in force from ValidFrom until the next change
+type TaxRateChange struct {
+	Rate      int       `json:"rate"`
+	ValidFrom time.Time `json:"valid_from"`
+}
+
+// TaxRateAt returns the rate in force at t: that of the last change from before t,
+// or TaxRate before the first change
+func (k KisimInfo) TaxRateAt(t time.Time) int {
+	rate := k.TaxRate
+	for _, change := range k.TaxRates {
+		if change.ValidFrom.After(t) {
+			break
+		}
+		rate = change.Rate
+	}
+	return rate
+}
+
+// KisimSource finds KISIMs by ID: a fixed KisimLookup, or a catalog head office updates
+type KisimSource interface {
+	GetKisimInfo(kisimID int) (KisimInfo, bool)
 }
 
 // KisimLookup provides KISIM information lookup
@@ -61,3 +261,15 @@ func (kl KisimLookup) GetKisimInfo(kisimID int) (KisimInfo, bool) {
 	kisim, exists := kl[kisimID]
 	return kisim, exists
 }
+
+// VirtualCustomerResponse reports a receipt issued to and collected by the simulated wallet
+type VirtualCustomerResponse struct {
+	Issued         *Receipt `json:"issued"`
+	Collected      *Receipt `json:"collected"` // Decoded from the decrypted, signature-checked binary
+	Text           string   `json:"text"`
+	EncryptedBytes int      `json:"encrypted_bytes"`
+	SignedBytes    int      `json:"signed_bytes"`
+	TimestampToken bool     `json:"timestamp_token"`
+	DeviceSigned   bool     `json:"device_signed"`
+	Verified       bool     `json:"verified"`
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+
+	"fake-cash-register/internal/i18n"
+)
+
+// Receipt template sections. A template file defines any of them with
+// {{define "header"}}...{{end}}; undefined sections keep the default layout.
+const (
+	SectionLogo          = "logo"            // Placeholder above the header; printers print their stored logo (default none)
+	SectionHeader        = "header"          // Lines above the date (default store name, address and VKN)
+	SectionTaxLabel      = "tax_label"       // Label of a KDV amount line, with .Rate (default receipt.tax_rate)
+	SectionTaxableLabel  = "taxable_label"   // Label of a KDV base line in the PDF, with .Rate (default receipt.taxable)
+	SectionTotalTaxLabel = "total_tax_label" // Label of the KDV total (default receipt.total_tax)
+	SectionLegal         = "legal"           // Lines below the payment, e.g. a return policy (default none)
+	SectionFooter        = "footer"          // Closing lines (default receipt.footer)
+)
+
+var templateSections = []string{
+	SectionLogo, SectionHeader, SectionTaxLabel, SectionTaxableLabel,
+	SectionTotalTaxLabel, SectionLegal, SectionFooter,
+}
+
+// ReceiptTemplate customizes the store-specific parts of rendered receipts: the printed
+// text, the PDF and the ESC/POS output. Sections execute with TemplateData. A nil
+// template renders the default layout.
+type ReceiptTemplate struct {
+	tmpl *template.Template
+}
+
+// TemplateData is what template sections execute with: the receipt's fields, the KDV
+// rate of the line being labelled, and formatting in the rendering language
+type TemplateData struct {
+	*Receipt
+	Rate int
+	loc  *i18n.Localizer
+}
+
+// T returns the catalog message for key, like the default labels use
+func (d TemplateData) T(key string, args ...interface{}) string {
+	return d.loc.T(key, args...)
+}
+
+// Amount formats an amount with the locale's separators
+func (d TemplateData) Amount(amount float64) string {
+	return d.loc.Amount(amount)
+}
+
+// Date is the receipt date in the locale's format
+func (d TemplateData) Date() string {
+	return d.loc.Date(d.Timestamp)
+}
+
+// Time is the receipt time in the locale's format
+func (d TemplateData) Time() string {
+	return d.loc.Time(d.Timestamp)
+}
+
+// LoadReceiptTemplate reads a receipt template file
+func LoadReceiptTemplate(path string) (*ReceiptTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read receipt template: %v", err)
+	}
+	return ParseReceiptTemplate(string(data))
+}
+
+// ParseReceiptTemplate parses a receipt template and checks that its sections execute
+func ParseReceiptTemplate(text string) (*ReceiptTemplate, error) {
+	tmpl, err := template.New("receipt").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid receipt template: %v", err)
+	}
+
+	// An empty receipt and catalog catch references to fields and methods that don't exist
+	defined := 0
+	sample := TemplateData{Receipt: &Receipt{}, Rate: 10, loc: &i18n.Localizer{}}
+	for _, section := range templateSections {
+		if tmpl.Lookup(section) == nil {
+			continue
+		}
+		defined++
+		if err := tmpl.ExecuteTemplate(new(strings.Builder), section, sample); err != nil {
+			return nil, fmt.Errorf("invalid receipt template section %q: %v", section, err)
+		}
+	}
+	if defined == 0 {
+		return nil, fmt.Errorf("receipt template defines none of the sections %s", strings.Join(templateSections, ", "))
+	}
+
+	return &ReceiptTemplate{tmpl: tmpl}, nil
+}
+
+// lines executes section, returning its non-blank-edged lines; ok is false when the
+// section is not defined or fails, so the caller renders its default
+func (t *ReceiptTemplate) lines(section string, r *Receipt, loc *i18n.Localizer, rate int) ([]string, bool) {
+	if t == nil || t.tmpl.Lookup(section) == nil {
+		return nil, false
+	}
+
+	var b strings.Builder
+	if err := t.tmpl.ExecuteTemplate(&b, section, TemplateData{Receipt: r, Rate: rate, loc: loc}); err != nil {
+		log.Printf("[TEMPLATE] Section %s failed for receipt %s, using the default: %v", section, r.ReceiptSerial, err)
+		return nil, false
+	}
+
+	text := strings.Trim(b.String(), "\n")
+	if strings.TrimSpace(text) == "" {
+		return nil, true
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return lines, true
+}
+
+// Section returns the lines of a section, or def when the template doesn't define it
+func (t *ReceiptTemplate) Section(section string, r *Receipt, loc *i18n.Localizer, def ...string) []string {
+	if lines, ok := t.lines(section, r, loc, 0); ok {
+		return lines
+	}
+	return def
+}
+
+// Label returns a one-line section for a KDV rate, or def when the template doesn't define it
+func (t *ReceiptTemplate) Label(section string, r *Receipt, loc *i18n.Localizer, rate int, def string) string {
+	if lines, ok := t.lines(section, r, loc, rate); ok {
+		return strings.Join(lines, " ")
+	}
+	return def
+}
@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// ZReport is the end-of-day summary of every receipt issued under one Z-report number
+type ZReport struct {
+	Number        string             `json:"z_report_number"`
+	StoreVKN      string             `json:"store_vkn"`
+	OpenedAt      time.Time          `json:"opened_at"`
+	ClosedAt      *time.Time         `json:"closed_at,omitempty"`
+	ReceiptCount  int                `json:"receipt_count"`
+	FirstSerial   string             `json:"first_serial,omitempty"`
+	LastSerial    string             `json:"last_serial,omitempty"`
+	TotalAmount   float64            `json:"total_amount"`
+	TaxBreakdown  TaxBreakdown       `json:"tax_breakdown"`
+	PaymentTotals map[string]float64 `json:"payment_totals"`
+	// Net cash rounding, in total and per payment method: the drawer holds
+	// PaymentTotals + RoundingTotals for each method
+	Rounding       float64            `json:"rounding"`
+	RoundingTotals map[string]float64 `json:"rounding_totals,omitempty"`
+	// Surcharges charged, in total and per surcharge name; unlike rounding they are
+	// already part of TotalAmount, the tax breakdown and PaymentTotals
+	Surcharges      float64            `json:"surcharges,omitempty"`
+	SurchargeTotals map[string]float64 `json:"surcharge_totals,omitempty"`
+	// Refund receipts among ReceiptCount and the amount they paid back. Totals, tax
+	// and payment totals are net of refunds.
+	RefundCount int     `json:"refund_count,omitempty"`
+	RefundTotal float64 `json:"refund_total,omitempty"`
+	// Submitted is set once the revenue authority acknowledged the summary
+	Submitted bool `json:"submitted"`
+}
+
+// Add accumulates an issued receipt into the report; refunds are subtracted
+func (z *ZReport) Add(receipt *Receipt) {
+	if z.ReceiptCount == 0 {
+		z.FirstSerial = receipt.ReceiptSerial
+	}
+	z.LastSerial = receipt.ReceiptSerial
+	z.ReceiptCount++
+
+	sign := 1.0
+	if receipt.IsRefund() {
+		sign = -1
+		z.RefundCount++
+		z.RefundTotal += receipt.TotalAmount
+	}
+	z.TotalAmount += sign * receipt.TotalAmount
+
+	z.TaxBreakdown.Tax10Percent.TaxableAmount += sign * receipt.TaxBreakdown.Tax10Percent.TaxableAmount
+	z.TaxBreakdown.Tax10Percent.TaxAmount += sign * receipt.TaxBreakdown.Tax10Percent.TaxAmount
+	z.TaxBreakdown.Tax20Percent.TaxableAmount += sign * receipt.TaxBreakdown.Tax20Percent.TaxableAmount
+	z.TaxBreakdown.Tax20Percent.TaxAmount += sign * receipt.TaxBreakdown.Tax20Percent.TaxAmount
+	z.TaxBreakdown.TotalTax += sign * receipt.TaxBreakdown.TotalTax
+	// Grouped by the rate each receipt actually applied, so a day spanning a rate change
+	// reports both rates
+	for _, rate := range receipt.TaxBreakdown.RateDetails() {
+		z.TaxBreakdown.AddRate(rate.Rate, sign*rate.TaxableAmount, sign*rate.TaxAmount)
+	}
+
+	if z.PaymentTotals == nil {
+		z.PaymentTotals = make(map[string]float64)
+	}
+	z.PaymentTotals[receipt.PaymentMethod] += sign * receipt.TotalAmount
+
+	if receipt.Rounding != 0 {
+		if z.RoundingTotals == nil {
+			z.RoundingTotals = make(map[string]float64)
+		}
+		z.Rounding += sign * receipt.Rounding
+		z.RoundingTotals[receipt.PaymentMethod] += sign * receipt.Rounding
+	}
+
+	for _, surcharge := range receipt.Surcharges {
+		if z.SurchargeTotals == nil {
+			z.SurchargeTotals = make(map[string]float64)
+		}
+		z.Surcharges += sign * surcharge.Amount
+		z.SurchargeTotals[surcharge.Name] += sign * surcharge.Amount
+	}
+}
+
+// ZReportStatus is the response of GET /api/zreport
+type ZReportStatus struct {
+	Current ZReport  `json:"current"`
+	Last    *ZReport `json:"last,omitempty"`
+	Closing bool     `json:"closing"` // A close is pending and new sales are blocked
+}
@@ -0,0 +1,117 @@
+package receiptpdf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Fonts are the standard Courier faces, which every PDF reader provides, re-encoded so
+// the Turkish letters missing from WinAnsiEncoding take the places of Icelandic ones
+// (the same positions they have in Windows-1254).
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+
+	// Courier glyphs are all 600/1000 em wide
+	charWidth = 0.6
+)
+
+const turkishEncoding = "<< /Type /Encoding /BaseEncoding /WinAnsiEncoding " +
+	"/Differences [208 /Gbreve 221 /Idotaccent /Scedilla 240 /gbreve 253 /dotlessi /scedilla] >>"
+
+// turkishCodes maps the letters placed by turkishEncoding's Differences
+var turkishCodes = map[rune]byte{
+	'Ğ': 0xD0, 'İ': 0xDD, 'Ş': 0xDE,
+	'ğ': 0xF0, 'ı': 0xFD, 'ş': 0xFE,
+}
+
+// encodeText converts s to the fonts' single-byte encoding and escapes it for a PDF
+// string literal. Characters the encoding can't show are replaced with '?'.
+func encodeText(s string) []byte {
+	var b bytes.Buffer
+	for _, r := range s {
+		var code byte
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			code = byte(r)
+		case r >= 0x20 && r < 0x7F:
+			code = byte(r)
+		case turkishCodes[r] != 0:
+			code = turkishCodes[r]
+		case r == '€':
+			code = 0x80
+		case r == '₺':
+			b.WriteString("TL")
+			continue
+		case r >= 0xA0 && r <= 0xFF:
+			code = byte(r)
+			// These positions hold the Turkish letters
+			if r == 'Ð' || r == 'Ý' || r == 'Þ' || r == 'ð' || r == 'ý' || r == 'þ' {
+				code = '?'
+			}
+		default:
+			code = '?'
+		}
+		b.WriteByte(code)
+	}
+	return b.Bytes()
+}
+
+// page is a single PDF page built from text and rule drawing operations
+type page struct {
+	width, height float64
+	content       bytes.Buffer
+}
+
+// text draws s with its baseline starting at (x, y), measured from the bottom left
+func (p *page) text(font string, size, x, y float64, s string) {
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s %s Td (", font, number(size), number(x), number(y))
+	p.content.Write(encodeText(s))
+	p.content.WriteString(") Tj ET\n")
+}
+
+// rule draws a dashed horizontal line
+func (p *page) rule(x1, x2, y float64) {
+	fmt.Fprintf(&p.content, "[2 2] 0 d 0.5 w %s %s m %s %s l S\n", number(x1), number(y), number(x2), number(y))
+}
+
+// bytes writes the page out as a complete PDF document
+func (p *page) bytes(title string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] "+
+			"/Resources << /Font << /%s 4 0 R /%s 5 0 R >> >> /Contents 6 0 R >>",
+			number(p.width), number(p.height), fontRegular, fontBold),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding 7 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding 7 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", p.content.Len(), p.content.String()),
+		turkishEncoding,
+		"<< /Title (" + string(encodeText(title)) + ") /Producer (fake-cash-register) >>",
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(objects)+1, len(objects), xref)
+	return out.Bytes()
+}
+
+// number formats a coordinate with at most two decimals
+func number(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,203 @@
+// Package receiptpdf renders receipts as PDF documents laid out like a Turkish fiscal
+// receipt printed on 80 mm paper: store header, date and serial, items with their KDV
+// rate, the KDV breakdown per rate, totals, payment and the Z report and transaction
+// numbers. It has no dependencies beyond the receipt model and the message catalogs.
+package receiptpdf
+
+import (
+	"unicode/utf8"
+
+	"fake-cash-register/internal/i18n"
+	"fake-cash-register/internal/models"
+)
+
+const (
+	pageWidth = 226.77 // 80 mm
+	margin    = 14.0
+
+	bodySize   = 8.0
+	headerSize = 10.0
+	totalSize  = 11.0
+	leading    = 1.4 // Line height as a multiple of the font size
+)
+
+// line is one row of the receipt: left and right aligned text, or centered text
+type line struct {
+	font     string
+	size     float64
+	left     string
+	right    string
+	centered bool
+	rule     bool
+}
+
+// Render lays the receipt out in loc's language. Fiscal labels come from the same catalog
+// keys and store template (nil for the default) as the printer-style text, so both
+// renderings read the same.
+func Render(receipt *models.Receipt, loc *i18n.Localizer, tmpl *models.ReceiptTemplate) []byte {
+	lines := layout(receipt, loc, tmpl)
+
+	height := 2 * margin
+	for _, l := range lines {
+		height += l.height()
+	}
+
+	p := &page{width: pageWidth, height: height}
+	y := height - margin
+	for _, l := range lines {
+		y -= l.height()
+		l.draw(p, y)
+	}
+	return p.bytes(loc.T("receipt.serial") + " " + receipt.ReceiptSerial + " - " + receipt.StoreName)
+}
+
+// FileName is the download name of a receipt's PDF
+func FileName(receipt *models.Receipt) string {
+	return receipt.TransactionID + ".pdf"
+}
+
+func layout(r *models.Receipt, loc *i18n.Localizer, tmpl *models.ReceiptTemplate) []line {
+	var lines []line
+	add := func(font string, size float64, left, right string) {
+		lines = append(lines, columns(font, size, left, right)...)
+	}
+	center := func(font string, size float64, text string) {
+		for _, wrapped := range models.WrapText(text, columnCount(size)) {
+			lines = append(lines, line{font: font, size: size, left: wrapped, centered: true})
+		}
+	}
+	rule := func() {
+		lines = append(lines, line{size: bodySize, rule: true})
+	}
+
+	for _, text := range tmpl.Section(models.SectionLogo, r, loc) {
+		center(fontBold, headerSize, text)
+	}
+	// The first header line is the store name's, in the large font
+	for i, text := range tmpl.Section(models.SectionHeader, r, loc, r.StoreName, r.StoreAddress, loc.T("receipt.vkn")+": "+r.StoreVKN) {
+		if i == 0 {
+			center(fontBold, headerSize, text)
+		} else {
+			center(fontRegular, bodySize, text)
+		}
+	}
+	rule()
+
+	add(fontRegular, bodySize, loc.T("receipt.date")+": "+loc.Date(r.Timestamp), loc.T("receipt.time")+": "+loc.Time(r.Timestamp))
+	add(fontRegular, bodySize, loc.T("receipt.serial")+": "+r.ReceiptSerial, "")
+	rule()
+
+	if r.RefundOf != nil {
+		center(fontBold, bodySize, loc.T("receipt.refund"))
+		add(fontRegular, bodySize, loc.T("receipt.refund_of")+": "+r.RefundOf.ReceiptSerial, loc.Date(r.RefundOf.Timestamp))
+		rule()
+	}
+
+	if r.Customer != nil {
+		add(fontRegular, bodySize, loc.T("receipt.customer")+": "+r.Customer.Name, "")
+		add(fontRegular, bodySize, r.Customer.TaxLabel(loc)+": "+r.Customer.TaxNumber, "")
+		rule()
+	}
+
+	for _, item := range r.Items {
+		// Receipts decoded from the binary format only carry the kisim ID
+		name := item.KisimName
+		if name == "" {
+			name = loc.T("receipt.kisim", item.KisimID)
+		}
+		add(fontRegular, bodySize, name, "%"+loc.Number(float64(item.TaxRate), 0))
+		add(fontRegular, bodySize, "  "+item.QuantityLine(loc), "*"+loc.Amount(item.TotalPrice))
+		if item.Note != "" {
+			add(fontRegular, bodySize, "  "+item.Note, "")
+		}
+	}
+	for _, surcharge := range r.Surcharges {
+		add(fontRegular, bodySize, surcharge.Name, "%"+loc.Number(float64(surcharge.TaxRate), 0))
+		add(fontRegular, bodySize, "", "*"+loc.Amount(surcharge.Amount))
+	}
+	rule()
+
+	for _, rate := range r.TaxBreakdown.RateDetails() {
+		if rate.TaxAmount == 0 && rate.TaxableAmount == 0 {
+			continue
+		}
+		add(fontRegular, bodySize, tmpl.Label(models.SectionTaxableLabel, r, loc, rate.Rate, loc.T("receipt.taxable", rate.Rate)), "*"+loc.Amount(rate.TaxableAmount))
+		add(fontRegular, bodySize, tmpl.Label(models.SectionTaxLabel, r, loc, rate.Rate, loc.T("receipt.tax_rate", rate.Rate)), "*"+loc.Amount(rate.TaxAmount))
+	}
+	add(fontBold, bodySize, tmpl.Label(models.SectionTotalTaxLabel, r, loc, 0, loc.T("receipt.total_tax")), "*"+loc.Amount(r.TaxBreakdown.TotalTax))
+	add(fontBold, totalSize, loc.T("receipt.total"), "*"+loc.Amount(r.TotalAmount))
+	if r.Rounding != 0 {
+		add(fontRegular, bodySize, loc.T("receipt.rounding"), "*"+loc.Amount(r.Rounding))
+		add(fontBold, bodySize, loc.T("receipt.amount_due"), "*"+loc.Amount(r.AmountDue))
+	}
+
+	if r.Currency != "" {
+		add(fontRegular, bodySize, r.Currency, "*"+loc.Amount(r.ForeignTotal))
+		add(fontRegular, bodySize, "  "+loc.T("receipt.exchange_rate"), loc.Number(r.ExchangeRate, 4))
+	}
+	if r.PaymentMethod != "" {
+		payment := r.PaymentMethod
+		if key := "payment." + r.PaymentMethod; loc.Has(key) {
+			payment = loc.T(key)
+		}
+		add(fontRegular, bodySize, loc.T("receipt.payment"), payment)
+	}
+	for _, text := range tmpl.Section(models.SectionLegal, r, loc) {
+		add(fontRegular, bodySize, text, "")
+	}
+	rule()
+
+	add(fontRegular, bodySize, loc.T("receipt.z_report")+": "+r.ZReportNumber, "")
+	add(fontRegular, bodySize, loc.T("receipt.transaction")+": "+r.TransactionID, "")
+	for _, text := range tmpl.Section(models.SectionFooter, r, loc, loc.T("receipt.footer")) {
+		center(fontBold, bodySize, text)
+	}
+	return lines
+}
+
+// columns places left and right on one line, or the right text on its own line
+// when both don't fit, like the printer does
+func columns(font string, size float64, left, right string) []line {
+	width := columnCount(size)
+	if utf8.RuneCountInString(left)+utf8.RuneCountInString(right)+1 <= width {
+		return []line{{font: font, size: size, left: left, right: right}}
+	}
+
+	var lines []line
+	for _, wrapped := range models.WrapText(left, width) {
+		lines = append(lines, line{font: font, size: size, left: wrapped})
+	}
+	if right != "" {
+		lines = append(lines, line{font: font, size: size, right: right})
+	}
+	return lines
+}
+
+// columnCount is how many characters fit between the margins at size
+func columnCount(size float64) int {
+	return int((pageWidth - 2*margin) / (size * charWidth))
+}
+
+func (l line) height() float64 {
+	return l.size * leading
+}
+
+// draw renders the line with its baseline at y
+func (l line) draw(p *page, y float64) {
+	advance := l.size * charWidth
+	switch {
+	case l.rule:
+		p.rule(margin, pageWidth-margin, y+l.size/2)
+	case l.centered:
+		x := (pageWidth - float64(utf8.RuneCountInString(l.left))*advance) / 2
+		p.text(l.font, l.size, x, y, l.left)
+	default:
+		if l.left != "" {
+			p.text(l.font, l.size, margin, y, l.left)
+		}
+		if l.right != "" {
+			x := pageWidth - margin - float64(utf8.RuneCountInString(l.right))*advance
+			p.text(l.font, l.size, x, y, l.right)
+		}
+	}
+}
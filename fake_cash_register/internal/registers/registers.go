@@ -0,0 +1,210 @@
+// Package registers serves several configured registers from one process, so a small
+// chain can be simulated without running a binary per till. Each register keeps its
+// own sale, counters and Z-reports; the authority and bank clients are shared.
+package registers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/transaction"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header selects a register for requests without a /r/<id> prefix
+const Header = "X-Register-ID"
+
+// prefix starts the paths of a named register: /r/<id>/api/...
+const prefix = "/r/"
+
+// maxWebhookBody bounds how much of a webhook request is read to find its register
+const maxWebhookBody = 64 * 1024
+
+// Register is one of the registers served
+type Register struct {
+	ID           string
+	CashRegister *cashregister.CashRegister
+	Handler      http.Handler    // UI and API of this register, paths without the prefix
+	Webhook      gin.HandlerFunc // Handles the bank's webhook for receipts this register issued
+}
+
+// Summary describes a register for GET /registers
+type Summary struct {
+	ID         string            `json:"id"`
+	Path       string            `json:"path"`
+	Default    bool              `json:"default,omitempty"` // Answers requests that name no register
+	VKN        string            `json:"vkn"`
+	StoreName  string            `json:"store_name"`
+	NextSerial string            `json:"next_serial"`
+	ZReport    string            `json:"z_report"` // Open Z-report number
+	Receipts   int               `json:"receipts"` // Issued in the open Z-report
+	Pending    transaction.Stats `json:"pending"`
+}
+
+// Set routes requests and webhooks to its registers. The first register added is the
+// default for requests that name none.
+type Set struct {
+	registers []*Register
+	byID      map[string]*Register
+	verbose   bool
+}
+
+// NewSet creates an empty set of registers
+func NewSet(verbose bool) *Set {
+	return &Set{byID: make(map[string]*Register), verbose: verbose}
+}
+
+// Add adds a register; IDs must be unique and usable as a path segment
+func (s *Set) Add(register *Register) error {
+	if register.ID == "" || strings.ContainsAny(register.ID, "/?#%") {
+		return fmt.Errorf("invalid register ID %q", register.ID)
+	}
+	if _, exists := s.byID[register.ID]; exists {
+		return fmt.Errorf("duplicate register ID %q", register.ID)
+	}
+	s.registers = append(s.registers, register)
+	s.byID[register.ID] = register
+	return nil
+}
+
+// Get returns the register with id
+func (s *Set) Get(id string) (*Register, bool) {
+	register, ok := s.byID[id]
+	return register, ok
+}
+
+// Registers returns the registers in the order they were added
+func (s *Set) Registers() []*Register {
+	return s.registers
+}
+
+// Summaries describes every register
+func (s *Set) Summaries() []Summary {
+	summaries := make([]Summary, len(s.registers))
+	for i, register := range s.registers {
+		cr := register.CashRegister
+		store := cr.StoreInfo()
+		zReport := cr.CurrentZReport()
+		summaries[i] = Summary{
+			ID:         register.ID,
+			Path:       prefix + register.ID + "/",
+			Default:    i == 0,
+			VKN:        store.VKN,
+			StoreName:  store.Name,
+			NextSerial: cr.NextSerial(),
+			ZReport:    zReport.Number,
+			Receipts:   zReport.ReceiptCount,
+			Pending:    cr.TransactionStats(),
+		}
+	}
+	return summaries
+}
+
+// ServeHTTP passes a request to the register named by its /r/<id> prefix, which is
+// stripped, or by the X-Register-ID header, and otherwise to the default register.
+// GET /registers lists the registers.
+func (s *Set) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/registers" && r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, s.Summaries())
+		return
+	}
+
+	if rest, ok := strings.CutPrefix(r.URL.Path, prefix); ok {
+		id, path, found := strings.Cut(rest, "/")
+		register, ok := s.byID[id]
+		if !ok {
+			s.notFound(w, id)
+			return
+		}
+		if !found {
+			// Relative links in the UI resolve against the trailing slash
+			http.Redirect(w, r, prefix+id+"/", http.StatusMovedPermanently)
+			return
+		}
+		stripped := new(http.Request)
+		*stripped = *r
+		stripped.URL = new(url.URL)
+		*stripped.URL = *r.URL
+		stripped.URL.Path = "/" + path
+		stripped.URL.RawPath = ""
+		register.Handler.ServeHTTP(w, stripped)
+		return
+	}
+
+	if id := r.Header.Get(Header); id != "" {
+		register, ok := s.byID[id]
+		if !ok {
+			s.notFound(w, id)
+			return
+		}
+		register.Handler.ServeHTTP(w, r)
+		return
+	}
+
+	s.registers[0].Handler.ServeHTTP(w, r)
+}
+
+func (s *Set) notFound(w http.ResponseWriter, id string) {
+	writeJSON(w, http.StatusNotFound, api.APIError{
+		Error: fmt.Sprintf("No register %q", id),
+		Code:  api.ErrorCodeRegisterNotFound,
+	})
+}
+
+// owner returns the register that issued receiptID, or the default register when none
+// is waiting for it (it answers verification challenges and unknown receipts)
+func (s *Set) owner(receiptID string) *Register {
+	for _, register := range s.registers {
+		if register.CashRegister.AwaitsCollection(receiptID) {
+			return register
+		}
+	}
+	return s.registers[0]
+}
+
+// Webhook passes the receipt bank's webhook to the register that issued the receipt.
+// The bank is given one webhook URL for all registers, so the receipt ID decides.
+func (s *Set) Webhook(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, api.APIError{
+			Error: "Failed to read payload",
+			Code:  api.ErrorCodeInvalidRequest,
+		})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	// A payload that doesn't decode is refused by the default register's handler
+	var payload api.WebhookPayload
+	json.Unmarshal(body, &payload)
+	register := s.owner(payload.ReceiptID)
+	if s.verbose && payload.ReceiptID != "" {
+		log.Printf("[REGISTERS] Webhook for receipt %s goes to register %s", payload.ReceiptID, register.ID)
+	}
+	register.Webhook(c)
+}
+
+var _ interfaces.WebhookHandler = (*Set)(nil)
+
+// HandleDownloadConfirmation passes a collection reported in-process by the mock
+// receipt bank to the register that issued the receipt
+func (s *Set) HandleDownloadConfirmation(payload api.WebhookPayload) error {
+	return s.owner(payload.ReceiptID).CashRegister.HandleDownloadConfirmation(payload)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,334 @@
+package resilience
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+// ErrCircuitOpen is returned without calling the service while the breaker is open
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Policy configures retries and the circuit breaker for one external service
+type Policy struct {
+	MaxAttempts      int           // Attempts per call including the first (1 disables retries)
+	BaseDelay        time.Duration // Backoff before the first retry, doubled per attempt
+	MaxDelay         time.Duration // Backoff cap
+	FailureThreshold int           // Consecutive failures that open the circuit
+	OpenTimeout      time.Duration // Time the circuit stays open before a trial call
+}
+
+// DefaultPolicy is used for fields left zero in configuration
+var DefaultPolicy = Policy{
+	MaxAttempts:      3,
+	BaseDelay:        200 * time.Millisecond,
+	MaxDelay:         2 * time.Second,
+	FailureThreshold: 5,
+	OpenTimeout:      30 * time.Second,
+}
+
+// Stats is a snapshot of a breaker for /api/status
+type Stats struct {
+	Name                string     `json:"name"`
+	State               string     `json:"state"`
+	Calls               int64      `json:"calls"`
+	Successes           int64      `json:"successes"`
+	Failures            int64      `json:"failures"`
+	Retries             int64      `json:"retries"`
+	ShortCircuits       int64      `json:"short_circuits"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+}
+
+// permanentError marks failures that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (p *permanentError) Error() string { return p.err.Error() }
+func (p *permanentError) Unwrap() error { return p.err }
+
+// Permanent marks err as not retryable. The service answered, so it does not
+// count against the circuit breaker either (e.g. a 4xx validation error).
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// delayedError marks a transient failure the service asked not to retry before after
+type delayedError struct {
+	err   error
+	after time.Duration
+}
+
+func (d *delayedError) Error() string { return d.err.Error() }
+func (d *delayedError) Unwrap() error { return d.err }
+
+// RetryAfter marks err as transient but not to be retried sooner than after, as a
+// Retry-After header asks. A breaker whose backoff can't wait that long gives up
+// instead of retrying early.
+func RetryAfter(err error, after time.Duration) error {
+	if err == nil || after <= 0 {
+		return err
+	}
+	return &delayedError{err: err, after: after}
+}
+
+// retryDelay returns the wait err asked for with RetryAfter, or 0
+func retryDelay(err error) time.Duration {
+	var d *delayedError
+	if errors.As(err, &d) {
+		return d.after
+	}
+	return 0
+}
+
+// Breaker retries transient failures with jittered backoff and stops calling
+// a service that keeps failing until OpenTimeout has passed
+type Breaker struct {
+	name    string
+	policy  Policy
+	verbose bool
+
+	mu            sync.Mutex
+	state         string
+	consecutive   int
+	openedAt      time.Time
+	probing       bool
+	lastError     string
+	lastFailureAt time.Time
+	calls         int64
+	successes     int64
+	failures      int64
+	retries       int64
+	shortCircuits int64
+}
+
+// NewBreaker creates a closed breaker; zero policy fields take DefaultPolicy values
+func NewBreaker(name string, policy Policy, verbose bool) *Breaker {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultPolicy.MaxAttempts
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = DefaultPolicy.BaseDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = DefaultPolicy.MaxDelay
+	}
+	if policy.FailureThreshold <= 0 {
+		policy.FailureThreshold = DefaultPolicy.FailureThreshold
+	}
+	if policy.OpenTimeout <= 0 {
+		policy.OpenTimeout = DefaultPolicy.OpenTimeout
+	}
+
+	return &Breaker{
+		name:    name,
+		policy:  policy,
+		verbose: verbose,
+		state:   StateClosed,
+	}
+}
+
+// Name returns the service name the breaker protects
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// Do calls fn, retrying transient errors. While the circuit is open it fails
+// fast with an error wrapping ErrCircuitOpen.
+func (b *Breaker) Do(fn func() error) error {
+	var err error
+
+	for attempt := 1; attempt <= b.policy.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			wait := b.backoff(attempt - 1)
+			if after := retryDelay(err); after > b.policy.MaxDelay {
+				// Retrying within MaxDelay would be sooner than the service asked
+				return err
+			} else if after > wait {
+				wait = after
+			}
+			b.mu.Lock()
+			b.retries++
+			b.mu.Unlock()
+			time.Sleep(wait)
+		}
+
+		if openErr := b.allow(); openErr != nil {
+			if err != nil {
+				// Tripped while retrying: report the underlying failure too
+				return fmt.Errorf("%w (last error: %v)", openErr, err)
+			}
+			return openErr
+		}
+
+		err = fn()
+		b.record(err)
+
+		if err == nil || IsPermanent(err) {
+			return err
+		}
+
+		if b.verbose {
+			log.Printf("[RESILIENCE] %s attempt %d/%d failed: %v", b.name, attempt, b.policy.MaxAttempts, err)
+		}
+	}
+
+	return err
+}
+
+// Stats returns a snapshot of the breaker state and counters
+func (b *Breaker) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := Stats{
+		Name:                b.name,
+		State:               b.currentState(time.Now()),
+		Calls:               b.calls,
+		Successes:           b.successes,
+		Failures:            b.failures,
+		Retries:             b.retries,
+		ShortCircuits:       b.shortCircuits,
+		ConsecutiveFailures: b.consecutive,
+		LastError:           b.lastError,
+	}
+	if !b.lastFailureAt.IsZero() {
+		lastFailure := b.lastFailureAt
+		stats.LastFailureAt = &lastFailure
+	}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		stats.OpenedAt = &openedAt
+	}
+	return stats
+}
+
+// allow admits a call, moving an expired open circuit to half-open for a single trial call
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.currentState(now) {
+	case StateOpen:
+		b.shortCircuits++
+		retryIn := b.policy.OpenTimeout - now.Sub(b.openedAt)
+		return fmt.Errorf("%s unavailable: %w after %d consecutive failures, retrying in %v",
+			b.name, ErrCircuitOpen, b.consecutive, retryIn.Round(time.Second))
+	case StateHalfOpen:
+		if b.probing {
+			b.shortCircuits++
+			return fmt.Errorf("%s unavailable: %w, trial call in progress", b.name, ErrCircuitOpen)
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+	}
+
+	b.calls++
+	return nil
+}
+
+// record updates counters and the circuit state after a call
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasProbing := b.probing
+	b.probing = false
+
+	if err == nil || IsPermanent(err) {
+		b.successes++
+		b.consecutive = 0
+		if b.state != StateClosed {
+			b.state = StateClosed
+			if b.verbose {
+				log.Printf("[RESILIENCE] %s recovered, circuit closed", b.name)
+			}
+		}
+		return
+	}
+
+	now := time.Now()
+	b.failures++
+	b.consecutive++
+	b.lastError = err.Error()
+	b.lastFailureAt = now
+
+	if wasProbing || b.consecutive >= b.policy.FailureThreshold {
+		if b.state != StateOpen || wasProbing {
+			log.Printf("[RESILIENCE] %s circuit opened after %d consecutive failures", b.name, b.consecutive)
+		}
+		b.state = StateOpen
+		b.openedAt = now
+	}
+}
+
+// currentState reports half-open once the open timeout has passed (caller holds mu)
+func (b *Breaker) currentState(now time.Time) string {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.policy.OpenTimeout {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// backoff returns a full-jitter delay for the given retry: random in [0, min(MaxDelay, BaseDelay*2^(retry-1))]
+func (b *Breaker) backoff(retry int) time.Duration {
+	delay := b.policy.BaseDelay << (retry - 1)
+	if delay <= 0 || delay > b.policy.MaxDelay {
+		delay = b.policy.MaxDelay
+	}
+	return time.Duration(rand.Int64N(int64(delay) + 1))
+}
+
+// Registry collects the breakers of all external services for status reporting
+type Registry struct {
+	mu       sync.Mutex
+	breakers []*Breaker
+}
+
+// NewRegistry creates an empty breaker registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Add registers a breaker and returns it
+func (r *Registry) Add(b *Breaker) *Breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.breakers = append(r.breakers, b)
+	return b
+}
+
+// Stats returns snapshots of all registered breakers in registration order
+func (r *Registry) Stats() []Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make([]Stats, len(r.breakers))
+	for i, b := range r.breakers {
+		stats[i] = b.Stats()
+	}
+	return stats
+}
@@ -0,0 +1,78 @@
+// Package rounding rounds the amount a customer pays by payment method: Turkish cash
+// payments settle to the nearest 5 kuruş, while card payments are charged exactly.
+// Rounding only changes what is collected; the fiscal total and KDV stay as calculated.
+package rounding
+
+import (
+	"fmt"
+	"math"
+)
+
+// Rounding modes
+const (
+	ModeHalfUp = "half_up" // Nearest increment, halves up
+	ModeDown   = "down"    // Never charge more than the total
+	ModeUp     = "up"      // Never charge less than the total
+)
+
+// Rule rounds amounts paid with one payment method to a multiple of Increment kuruş
+type Rule struct {
+	PaymentMethod string
+	Increment     int // Kuruş, e.g. 5
+	Mode          string
+}
+
+// Policy holds the rounding rule of each payment method; methods without one are not rounded
+type Policy struct {
+	rules map[string]Rule
+}
+
+// NewPolicy checks the rules, defaulting the mode to half_up
+func NewPolicy(rules []Rule) (*Policy, error) {
+	p := &Policy{rules: make(map[string]Rule, len(rules))}
+	for _, rule := range rules {
+		if rule.PaymentMethod == "" {
+			return nil, fmt.Errorf("rounding rule without payment_method")
+		}
+		if _, exists := p.rules[rule.PaymentMethod]; exists {
+			return nil, fmt.Errorf("more than one rounding rule for %s", rule.PaymentMethod)
+		}
+		if rule.Increment < 1 {
+			return nil, fmt.Errorf("rounding increment for %s must be at least 1 kuruş", rule.PaymentMethod)
+		}
+		switch rule.Mode {
+		case "":
+			rule.Mode = ModeHalfUp
+		case ModeHalfUp, ModeDown, ModeUp:
+		default:
+			return nil, fmt.Errorf("unknown rounding mode %q for %s", rule.Mode, rule.PaymentMethod)
+		}
+		p.rules[rule.PaymentMethod] = rule
+	}
+	return p, nil
+}
+
+// Round returns the amount due for total paid with method, and false when the
+// method has no rule
+func (p *Policy) Round(total float64, method string) (float64, bool) {
+	rule, ok := p.rules[method]
+	if !ok {
+		return total, false
+	}
+	return rule.Apply(total), true
+}
+
+// Apply rounds amount (lira) to the rule's increment
+func (r Rule) Apply(amount float64) float64 {
+	kurus := math.Round(amount * 100)
+	steps := kurus / float64(r.Increment)
+	switch r.Mode {
+	case ModeDown:
+		steps = math.Floor(steps)
+	case ModeUp:
+		steps = math.Ceil(steps)
+	default:
+		steps = math.Floor(steps + 0.5)
+	}
+	return steps * float64(r.Increment) / 100
+}
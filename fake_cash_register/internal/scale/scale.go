@@ -0,0 +1,195 @@
+// Package scale keeps the latest reading of the checkout scale for weighed KISIMs.
+// Readings come from a scale on a serial port (ReadSerial) or are posted to the
+// register's API by a scale bridge or test harness.
+package scale
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reading sources
+const (
+	SourceSerial = "serial"
+	SourceAPI    = "api"
+)
+
+var (
+	// ErrNoReading is returned when the scale has sent nothing, or nothing lies on it
+	ErrNoReading = errors.New("no weight on the scale")
+	// ErrUnstable is returned while the scale is still settling
+	ErrUnstable = errors.New("scale reading is not stable")
+	// ErrStale is returned when the last reading is older than the configured maximum age
+	ErrStale = errors.New("scale reading is out of date")
+)
+
+// Reading is one weight reported by the scale
+type Reading struct {
+	Grams  int       `json:"grams"`
+	Stable bool      `json:"stable"`
+	At     time.Time `json:"at"`
+	Source string    `json:"source"`
+}
+
+// Scale holds the latest reading
+type Scale struct {
+	maxAge  time.Duration
+	verbose bool
+
+	mu   sync.Mutex
+	last *Reading
+}
+
+// New creates a scale whose readings are used for at most maxAge (0 = no limit)
+func New(maxAge time.Duration, verbose bool) *Scale {
+	return &Scale{maxAge: maxAge, verbose: verbose}
+}
+
+// Set records a reading, stamping it with the current time when At is zero
+func (s *Scale) Set(reading Reading) {
+	if reading.At.IsZero() {
+		reading.At = time.Now()
+	}
+	s.mu.Lock()
+	s.last = &reading
+	s.mu.Unlock()
+}
+
+// Last returns the latest reading, if any
+func (s *Scale) Last() (Reading, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last == nil {
+		return Reading{}, false
+	}
+	return *s.last, true
+}
+
+// Weight returns the grams on the scale for a weighed sale: the latest reading must
+// be stable, positive and no older than the maximum age
+func (s *Scale) Weight() (int, error) {
+	reading, ok := s.Last()
+	switch {
+	case !ok || reading.Grams <= 0:
+		return 0, ErrNoReading
+	case !reading.Stable:
+		return 0, ErrUnstable
+	case s.maxAge > 0 && time.Since(reading.At) > s.maxAge:
+		return 0, ErrStale
+	}
+	return reading.Grams, nil
+}
+
+// ParseLine reads one line of scale output. It understands the continuous output of
+// most retail scales, "ST,GS,+  1.234kg" (ST stable, US unstable; GS gross, NT net),
+// and bare weights such as "1.234 kg" or "1234 g", which are taken as stable.
+// Commas are accepted as decimal separators in bare weights.
+func ParseLine(line string) (Reading, error) {
+	text := strings.TrimSpace(line)
+	reading := Reading{Stable: true, Source: SourceSerial}
+
+	if fields := strings.Split(text, ","); len(fields) >= 3 {
+		switch strings.TrimSpace(fields[0]) {
+		case "ST":
+		case "US", "OL":
+			reading.Stable = false
+		default:
+			return Reading{}, fmt.Errorf("unknown scale status %q", fields[0])
+		}
+		text = strings.TrimSpace(fields[len(fields)-1])
+	}
+
+	var multiplier float64
+	lower := strings.ToLower(text)
+	switch {
+	case strings.HasSuffix(lower, "kg"):
+		multiplier, text = 1000, text[:len(text)-2]
+	case strings.HasSuffix(lower, "g"):
+		multiplier, text = 1, text[:len(text)-1]
+	default:
+		return Reading{}, fmt.Errorf("scale output %q has no kg or g unit", line)
+	}
+
+	text = strings.ReplaceAll(strings.TrimSpace(text), " ", "")
+	text = strings.Replace(text, ",", ".", 1)
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return Reading{}, fmt.Errorf("invalid weight in scale output %q", line)
+	}
+	grams := math.Round(value * multiplier)
+	if grams > math.MaxInt32 || grams < math.MinInt32 {
+		return Reading{}, fmt.Errorf("weight out of range in scale output %q", line)
+	}
+	reading.Grams = int(grams)
+	return reading, nil
+}
+
+// ReadSerial reads the continuous output of a scale on device (e.g. /dev/ttyUSB0) in the
+// background, reopening the port after errors. The port's speed is set outside the
+// register, e.g. stty -F /dev/ttyUSB0 9600 raw.
+func (s *Scale) ReadSerial(device string) {
+	go func() {
+		for {
+			if err := s.readPort(device); err != nil {
+				log.Printf("[SCALE] %s: %v; retrying in 5s", device, err)
+			}
+			time.Sleep(5 * time.Second)
+		}
+	}()
+}
+
+func (s *Scale) readPort(device string) error {
+	port, err := os.Open(device)
+	if err != nil {
+		return err
+	}
+	defer port.Close()
+	if s.verbose {
+		log.Printf("[SCALE] Reading %s", device)
+	}
+
+	scanner := bufio.NewScanner(port)
+	scanner.Split(scanLines)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		reading, err := ParseLine(line)
+		if err != nil {
+			if s.verbose {
+				log.Printf("[SCALE] Ignoring output: %v", err)
+			}
+			continue
+		}
+		s.Set(reading)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("port closed")
+}
+
+// scanLines splits scale output on CR, LF or CRLF; many scales end lines with CR only
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		next := i + 1
+		if data[i] == '\r' && next < len(data) && data[next] == '\n' {
+			next++
+		}
+		return next, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -1,26 +1,110 @@
 package services
 
 import (
+	"fmt"
+
 	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/devices"
+	"fake-cash-register/internal/discovery"
+	"fake-cash-register/internal/faults"
 	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/resilience"
 	"fake-cash-register/internal/services/mock"
 	"fake-cash-register/internal/services/real"
 )
 
 // CreateServices creates the appropriate service implementations based on configuration
+// Real services get a circuit breaker each, registered in breakers for status reporting
+// Mock services get the injector's faults (nil = none), and breakers too so retries can be exercised
 // Returns RevenueAuthorityService, ReceiptBankService, error
-func CreateServices(cfg *config.Config) (interfaces.RevenueAuthorityService, interfaces.ReceiptBankService, error) {
+func CreateServices(cfg *config.Config, breakers *resilience.Registry, injector *faults.Injector) (interfaces.RevenueAuthorityService, interfaces.ReceiptBankService, error) {
+	// Retries and circuit breakers so an unreachable service fails fast
+	policy := resilience.Policy{
+		MaxAttempts:      cfg.Resilience.MaxAttempts,
+		BaseDelay:        cfg.Resilience.BaseDelay,
+		MaxDelay:         cfg.Resilience.MaxDelay,
+		FailureThreshold: cfg.Resilience.FailureThreshold,
+		OpenTimeout:      cfg.Resilience.OpenTimeout,
+	}
+
 	if cfg.StandaloneMode {
 		// Standalone mode: use mock services for testing
 		revenueAuth := mock.NewMockRevenueAuthority(cfg.Server.Verbose)
 		receiptBank := mock.NewMockReceiptBank(cfg.Server.Verbose)
+		if injector != nil {
+			revenueAuth.SetFaults(injector)
+			receiptBank.SetFaults(injector)
+			revenueAuth.SetBreaker(breakers.Add(resilience.NewBreaker("revenue authority", policy, cfg.Server.Verbose)))
+			receiptBank.SetBreaker(breakers.Add(resilience.NewBreaker("receipt bank", policy, cfg.Server.Verbose)))
+		}
 
 		return revenueAuth, receiptBank, nil
 	} else {
 		// Online mode: use real HTTP client services
-		revenueAuth := real.NewRealRevenueAuthority(cfg.RevenueAuthority.URL, cfg.Server.Verbose)
+		revenueAuth := real.NewRealRevenueAuthority(cfg.RevenueAuthority.URL, cfg.RevenueAuthority.APIKey, cfg.Server.Verbose)
 		receiptBank := real.NewRealReceiptBank(cfg.ReceiptBank.URL, cfg, cfg.Server.Verbose)
+		if cfg.RevenueAuthority.RegisterKeyFile != "" {
+			key, err := crypto.LoadOrCreateRegisterKey(cfg.RevenueAuthority.RegisterKeyFile)
+			if err != nil {
+				return nil, nil, err
+			}
+			revenueAuth.SetSigningKey(key)
+		}
+		if cfg.RevenueAuthority.ResponseKeyFile != "" {
+			key, err := crypto.LoadAuthorityKey(cfg.RevenueAuthority.ResponseKeyFile)
+			if err != nil {
+				return nil, nil, err
+			}
+			revenueAuth.SetResponseKey(key)
+		}
+
+		revenueAuth.SetBreaker(breakers.Add(resilience.NewBreaker("revenue authority", policy, cfg.Server.Verbose)))
+		receiptBank.SetBreaker(breakers.Add(resilience.NewBreaker("receipt bank", policy, cfg.Server.Verbose)))
+
+		// Optional LAN discovery; the configured URL stays as fallback
+		if cfg.ReceiptBank.Discovery.MDNS {
+			resolver := discovery.NewResolver(cfg.ReceiptBank.URL, cfg.ReceiptBank.Discovery.Timeout, cfg.Server.Verbose)
+			resolver.Resolve()
+			resolver.StartHealthCheck(cfg.ReceiptBank.Discovery.HealthInterval)
+			receiptBank.SetURLResolver(resolver.URL)
+		}
+
+		// Authority public key for /api/authority-key and receipt checks, cached through downtime
+		revenueAuth.StartKeyRefresh(cfg.RevenueAuthority.KeyRefreshInterval)
+
+		// Protocol and receipt format handshake, repeated in case the bank is upgraded
+		receiptBank.StartVersionCheck(cfg.ReceiptBank.VersionCheckInterval)
 
 		return revenueAuth, receiptBank, nil
 	}
 }
+
+// CreateDevices creates the cash drawer and beeper controller for the configured driver.
+// Without one, standalone mode gets the mock devices and online mode none (nil).
+func CreateDevices(cfg *config.Config) (interfaces.DeviceController, error) {
+	driver := cfg.Devices.Driver
+	if driver == "" {
+		if !cfg.StandaloneMode {
+			return nil, nil
+		}
+		driver = devices.DriverMock
+	}
+
+	switch driver {
+	case devices.DriverMock:
+		return mock.NewMockDevices(cfg.Server.Verbose), nil
+	case devices.DriverESCPOS:
+		if cfg.Devices.PrinterDevice == "" {
+			return nil, fmt.Errorf("devices printer_device is required for the escpos driver")
+		}
+		return devices.NewESCPOS(cfg.Devices.PrinterDevice, cfg.Devices.Pulse), nil
+	case devices.DriverGPIO:
+		if cfg.Devices.DrawerPin < 0 || cfg.Devices.BeeperPin < 0 || cfg.Devices.DrawerPin+cfg.Devices.BeeperPin == 0 {
+			return nil, fmt.Errorf("devices drawer_pin or beeper_pin is required for the gpio driver")
+		}
+		return devices.NewGPIO(cfg.Devices.DrawerPin, cfg.Devices.BeeperPin, cfg.Devices.Pulse), nil
+	default:
+		return nil, fmt.Errorf("unknown devices driver %q (valid: escpos, gpio, mock)", driver)
+	}
+}
@@ -0,0 +1,60 @@
+package mock
+
+import (
+	"log"
+	"sync"
+
+	"fake-cash-register/internal/interfaces"
+)
+
+// MockDevices stands in for the cash drawer and beeper in standalone mode, logging
+// each command and counting them so tests and demos can see what the register did
+type MockDevices struct {
+	verbose bool
+
+	mu          sync.Mutex
+	drawerOpens int
+	beeps       []string
+}
+
+var _ interfaces.DeviceController = (*MockDevices)(nil)
+
+func NewMockDevices(verbose bool) *MockDevices {
+	return &MockDevices{verbose: verbose}
+}
+
+func (m *MockDevices) OpenDrawer() error {
+	m.mu.Lock()
+	m.drawerOpens++
+	m.mu.Unlock()
+
+	if m.verbose {
+		log.Printf("[MOCK-DEVICES] Cash drawer opened")
+	}
+	return nil
+}
+
+func (m *MockDevices) Beep(signal string) error {
+	m.mu.Lock()
+	m.beeps = append(m.beeps, signal)
+	m.mu.Unlock()
+
+	if m.verbose {
+		log.Printf("[MOCK-DEVICES] Beep: %s", signal)
+	}
+	return nil
+}
+
+// DrawerOpens returns how many times the drawer was opened
+func (m *MockDevices) DrawerOpens() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.drawerOpens
+}
+
+// Beeps returns the signals sounded so far, oldest first
+func (m *MockDevices) Beeps() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.beeps...)
+}
@@ -0,0 +1,17 @@
+package mock
+
+import (
+	"fake-cash-register/internal/faults"
+	"fake-cash-register/internal/resilience"
+)
+
+// injectFaults runs a service's injected faults through its breaker, as the real
+// clients run their calls, so retries and the circuit breaker see them
+func injectFaults(injector *faults.Injector, breaker *resilience.Breaker, service string) error {
+	if breaker == nil {
+		return injector.Inject(service)
+	}
+	return breaker.Do(func() error {
+		return injector.Inject(service)
+	})
+}
@@ -3,62 +3,154 @@ package mock
 import (
 	"encoding/base64"
 	"log"
+	"sync"
 	"time"
 
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/faults"
 	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/resilience"
 )
 
+// webhookTimestampFormat is the real bank's millisecond RFC 3339 layout for collection times
+const webhookTimestampFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// ErrReceiptNotFound is returned when no receipt is stored under an ephemeral key
+var ErrReceiptNotFound = interfaces.ErrReceiptNotFound
+
 type MockReceiptBank struct {
 	verbose        bool
 	webhookHandler interfaces.WebhookHandler
+	mu             sync.Mutex
 	storage        map[string]string // ephemeral key -> encrypted receipt storage
+	delay          time.Duration     // Simulated network time per submission
+	faults         *faults.Injector
+	breaker        *resilience.Breaker
 }
 
+// The register finds the optional submission paths by type assertion; these keep them in step
+var (
+	_ interfaces.ReceiptBankService = (*MockReceiptBank)(nil)
+	_ interfaces.AttestedSubmitter  = (*MockReceiptBank)(nil)
+	_ interfaces.TrackedSubmitter   = (*MockReceiptBank)(nil)
+	_ interfaces.ReceiptCollector   = (*MockReceiptBank)(nil)
+)
+
 func NewMockReceiptBank(verbose bool) *MockReceiptBank {
 	return &MockReceiptBank{
 		verbose: verbose,
 		storage: make(map[string]string),
+		delay:   200 * time.Millisecond,
 	}
 }
 
+// SetDelay replaces the simulated network time per submission (0 = none)
+func (m *MockReceiptBank) SetDelay(delay time.Duration) {
+	m.delay = delay
+}
+
+// SetFaults makes submissions slow or fail as the injector's rules say
+func (m *MockReceiptBank) SetFaults(injector *faults.Injector) {
+	m.faults = injector
+}
+
+// SetBreaker retries injected failures and opens the circuit, as for the real bank
+func (m *MockReceiptBank) SetBreaker(breaker *resilience.Breaker) {
+	m.breaker = breaker
+}
+
 func (m *MockReceiptBank) SubmitReceipt(userEphemeralKeyCompressed []byte, encryptedData []byte) error {
+	return m.SubmitTrackedReceipt(generateMockReceiptID(), userEphemeralKeyCompressed, encryptedData, nil, nil)
+}
+
+// SubmitTrackedReceipt stores a receipt under the register's receipt ID, which the simulated
+// collection webhook reports back
+func (m *MockReceiptBank) SubmitTrackedReceipt(receiptID string, userEphemeralKeyCompressed []byte, encryptedData []byte, receiptHash []byte, signature []byte) error {
+	if err := injectFaults(m.faults, m.breaker, faults.ServiceReceiptBank); err != nil {
+		return err
+	}
+
+	submittedAt := time.Now().UTC()
+
 	// Convert compressed key to base64 for internal indexing
 	keyBase64 := base64.StdEncoding.EncodeToString(userEphemeralKeyCompressed)
 	// Convert encrypted data to base64 for internal storage
 	encryptedDataBase64 := base64.StdEncoding.EncodeToString(encryptedData)
 
 	if m.verbose {
-		log.Printf("[MOCK] Receipt Bank: Submitting receipt (privacy-preserving)")
+		log.Printf("[MOCK] Receipt Bank: Submitting receipt %s (privacy-preserving)", receiptID)
 		log.Printf("[MOCK] User Ephemeral Key: %s... (%d bytes compressed)", keyBase64[:16], len(userEphemeralKeyCompressed))
 		log.Printf("[MOCK] Encrypted Data: %d bytes", len(encryptedData))
+		if receiptHash != nil {
+			// The mock bank has no strict mode, so the attestation is only logged
+			log.Printf("[MOCK] Receipt Bank: Submission attested (%d byte hash, %d byte signature)", len(receiptHash), len(signature))
+		}
 	}
 
 	// Store encrypted receipt indexed by user's ephemeral key (privacy-preserving)
+	m.mu.Lock()
 	m.storage[keyBase64] = encryptedDataBase64
+	stored := len(m.storage)
+	m.mu.Unlock()
 
 	// Simulate network delay
-	time.Sleep(200 * time.Millisecond)
+	time.Sleep(m.delay)
 
 	if m.verbose {
 		log.Printf("[MOCK] Receipt Bank: Receipt submitted successfully (user anonymous)")
-		log.Printf("[MOCK] Storage contains %d receipts", len(m.storage))
+		log.Printf("[MOCK] Storage contains %d receipts", stored)
 	}
 
 	// Simulate webhook callback after a short delay
 	if m.webhookHandler != nil {
 		go func() {
 			time.Sleep(500 * time.Millisecond)
-			receiptID := generateMockReceiptID()
 			if m.verbose {
 				log.Printf("[MOCK] Receipt Bank: Sending webhook confirmation for %s", receiptID)
 			}
-			m.webhookHandler.HandleDownloadConfirmation(receiptID)
+			now := time.Now().UTC()
+			m.webhookHandler.HandleDownloadConfirmation(api.WebhookPayload{
+				SchemaVersion:       api.WebhookSchemaV2,
+				ReceiptID:           receiptID,
+				Status:              "downloaded",
+				Timestamp:           now.Format(time.RFC3339),
+				SubmittedAt:         submittedAt.Format(webhookTimestampFormat),
+				CollectedAt:         now.Format(webhookTimestampFormat),
+				CollectionLatencyMs: now.Sub(submittedAt).Milliseconds(),
+				Attempt:             1,
+			})
 		}()
 	}
 
 	return nil
 }
 
+// SubmitAttestedReceipt stores a receipt submitted with its hash and authority signature
+func (m *MockReceiptBank) SubmitAttestedReceipt(userEphemeralKeyCompressed []byte, encryptedData []byte, receiptHash []byte, signature []byte) error {
+	return m.SubmitTrackedReceipt(generateMockReceiptID(), userEphemeralKeyCompressed, encryptedData, receiptHash, signature)
+}
+
+// CollectReceipt returns and removes the encrypted receipt stored under an ephemeral key,
+// as a wallet collecting from the bank would
+func (m *MockReceiptBank) CollectReceipt(userEphemeralKeyCompressed []byte) ([]byte, error) {
+	keyBase64 := base64.StdEncoding.EncodeToString(userEphemeralKeyCompressed)
+
+	m.mu.Lock()
+	encryptedDataBase64, found := m.storage[keyBase64]
+	delete(m.storage, keyBase64)
+	m.mu.Unlock()
+
+	if !found {
+		return nil, ErrReceiptNotFound
+	}
+
+	if m.verbose {
+		log.Printf("[MOCK] Receipt Bank: Receipt collected for key %s...", keyBase64[:16])
+	}
+
+	return base64.StdEncoding.DecodeString(encryptedDataBase64)
+}
+
 func (m *MockReceiptBank) SetWebhookHandler(handler interfaces.WebhookHandler) {
 	m.webhookHandler = handler
 	if m.verbose {
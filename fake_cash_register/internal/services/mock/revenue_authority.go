@@ -1,22 +1,70 @@
 package mock
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/binary"
 	"fmt"
 	"log"
 	"time"
+
+	rwcrypto "receiptwallet/crypto"
+
+	receiptbinary "fake-cash-register/internal/binary"
+	"fake-cash-register/internal/faults"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/resilience"
 )
 
 type MockRevenueAuthority struct {
 	verbose bool
+	// Throwaway signing key, so mock signatures verify against GetPublicKey
+	privateKey *ecdsa.PrivateKey
+	delay      time.Duration // Simulated processing time per signature
+	faults     *faults.Injector
+	breaker    *resilience.Breaker
 }
 
+// The register finds strict signing and Z-report submission by type assertion; these keep them in step
+var (
+	_ interfaces.RevenueAuthorityService = (*MockRevenueAuthority)(nil)
+	_ interfaces.ReceiptSigner           = (*MockRevenueAuthority)(nil)
+	_ interfaces.ZReportSubmitter        = (*MockRevenueAuthority)(nil)
+)
+
 func NewMockRevenueAuthority(verbose bool) *MockRevenueAuthority {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatalf("Failed to generate mock revenue authority key: %v", err)
+	}
+
 	return &MockRevenueAuthority{
-		verbose: verbose,
+		verbose:    verbose,
+		privateKey: privateKey,
+		delay:      100 * time.Millisecond,
 	}
 }
 
+// SetDelay replaces the simulated processing time per signature (0 = none)
+func (m *MockRevenueAuthority) SetDelay(delay time.Duration) {
+	m.delay = delay
+}
+
+// SetFaults makes signing and Z-report submission slow or fail as the injector's rules say
+func (m *MockRevenueAuthority) SetFaults(injector *faults.Injector) {
+	m.faults = injector
+}
+
+// SetBreaker retries injected failures and opens the circuit, as for the real authority
+func (m *MockRevenueAuthority) SetBreaker(breaker *resilience.Breaker) {
+	m.breaker = breaker
+}
+
 func (m *MockRevenueAuthority) SignHash(binaryHash []byte) ([]byte, error) {
 	if m.verbose {
 		hashBase64 := base64.StdEncoding.EncodeToString(binaryHash)
@@ -28,16 +76,18 @@ func (m *MockRevenueAuthority) SignHash(binaryHash []byte) ([]byte, error) {
 		return nil, fmt.Errorf("invalid hash length: expected 32 bytes, got %d", len(binaryHash))
 	}
 
-	// Simulate processing delay
-	time.Sleep(100 * time.Millisecond)
+	if err := injectFaults(m.faults, m.breaker, faults.ServiceRevenueAuthority); err != nil {
+		return nil, err
+	}
 
-	// Generate a mock 64-byte ECDSA signature (r||s format)
-	binarySignature := make([]byte, 64)
+	// Simulate processing delay
+	time.Sleep(m.delay)
 
-	// Fill with deterministic mock data based on hash
-	mockSigString := fmt.Sprintf("mock_signature_%d", time.Now().Unix())
-	copy(binarySignature[:32], binaryHash)                                       // Use hash as r component
-	copy(binarySignature[32:], []byte(fmt.Sprintf("%-32s", mockSigString))[:32]) // Mock s component
+	// 64-byte ECDSA signature (r||s format) with the mock key
+	binarySignature, err := rwcrypto.Sign(m.privateKey, binaryHash)
+	if err != nil {
+		return nil, err
+	}
 
 	if m.verbose {
 		signatureBase64 := base64.StdEncoding.EncodeToString(binarySignature)
@@ -47,12 +97,63 @@ func (m *MockRevenueAuthority) SignHash(binaryHash []byte) ([]byte, error) {
 	return binarySignature, nil
 }
 
+func (m *MockRevenueAuthority) SignHashWithTimestamp(binaryHash []byte) ([]byte, []byte, error) {
+	binarySignature, err := m.SignHash(binaryHash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Mock token: version || unix seconds || mock signature
+	token := make([]byte, 73)
+	token[0] = 0x01
+	binary.BigEndian.PutUint64(token[1:9], uint64(time.Now().UTC().Unix()))
+	copy(token[9:], binarySignature)
+
+	if m.verbose {
+		log.Printf("[MOCK] Revenue Authority: Issued mock timestamp token")
+	}
+
+	return binarySignature, token, nil
+}
+
+// SignReceipt decodes the receipt and refuses implausible totals before signing its hash
+func (m *MockRevenueAuthority) SignReceipt(binaryReceipt []byte, withTimestamp bool) ([]byte, []byte, error) {
+	receipt, err := receiptbinary.DeserializeReceipt(binaryReceipt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("receipt rejected: %v", err)
+	}
+	if receipt.TotalAmount <= 0 {
+		return nil, nil, fmt.Errorf("receipt rejected: total must be positive")
+	}
+
+	if m.verbose {
+		log.Printf("[MOCK] Revenue Authority: Checked receipt %s (VKN %s, total ₺%.2f)", receipt.ReceiptSerial, receipt.StoreVKN, receipt.TotalAmount)
+	}
+
+	hash := sha256.Sum256(binaryReceipt)
+	if withTimestamp {
+		return m.SignHashWithTimestamp(hash[:])
+	}
+	binarySignature, err := m.SignHash(hash[:])
+	return binarySignature, nil, err
+}
+
+// SubmitZReport accepts any Z-report summary
+func (m *MockRevenueAuthority) SubmitZReport(report *models.ZReport) error {
+	if err := injectFaults(m.faults, m.breaker, faults.ServiceRevenueAuthority); err != nil {
+		return err
+	}
+	if m.verbose {
+		log.Printf("[MOCK] Revenue Authority: Received %s (%d receipts, ₺%.2f)", report.Number, report.ReceiptCount, report.TotalAmount)
+	}
+	return nil
+}
+
+// GetPublicKey returns the mock key in PKIX DER form, as the real authority does
 func (m *MockRevenueAuthority) GetPublicKey() ([]byte, error) {
 	if m.verbose {
 		log.Printf("[MOCK] Revenue Authority: Returning mock public key")
 	}
 
-	// Return raw mock public key bytes
-	mockKey := "mock_public_key_for_verification_purposes_12345"
-	return []byte(mockKey), nil
+	return x509.MarshalPKIXPublicKey(&m.privateKey.PublicKey)
 }
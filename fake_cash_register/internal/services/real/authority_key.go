@@ -0,0 +1,126 @@
+package real
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+)
+
+// keyRetryInterval is how soon a failed key refresh is retried, when that is sooner
+// than the refresh interval, so the register reconnects once the authority is back
+const keyRetryInterval = 30 * time.Second
+
+// GetPublicKey returns the revenue authority's public key (DER). Once fetched the key is
+// served from cache, also while the authority is unreachable; StartKeyRefresh keeps it current.
+func (r *RealRevenueAuthority) GetPublicKey() ([]byte, error) {
+	r.keyMu.RLock()
+	publicKey := r.publicKey
+	r.keyMu.RUnlock()
+	if publicKey != nil {
+		return publicKey, nil
+	}
+
+	if err := r.RefreshPublicKey(); err != nil {
+		return nil, err
+	}
+	r.keyMu.RLock()
+	defer r.keyMu.RUnlock()
+	return r.publicKey, nil
+}
+
+// PublicKeyStatus reports when the cached key was last fetched or confirmed unchanged,
+// and why the latest refresh failed (nil after a successful one)
+func (r *RealRevenueAuthority) PublicKeyStatus() (time.Time, error) {
+	r.keyMu.RLock()
+	defer r.keyMu.RUnlock()
+	return r.keyFetchedAt, r.keyErr
+}
+
+// RefreshPublicKey fetches the public key again, sending the cached key's ETag so an
+// unchanged key costs a 304. On failure the cached key stays in use.
+func (r *RealRevenueAuthority) RefreshPublicKey() error {
+	r.keyMu.RLock()
+	etag := r.keyETag
+	previous := r.publicKey
+	r.keyMu.RUnlock()
+
+	var publicKey []byte
+	var newETag string
+	err := callWithBreaker(r.breaker, func() error {
+		var err error
+		publicKey, newETag, err = r.getPublicKeyOnce(etag)
+		return err
+	})
+
+	r.keyMu.Lock()
+	defer r.keyMu.Unlock()
+	r.keyErr = err
+	if err != nil {
+		return err
+	}
+	r.keyFetchedAt = time.Now()
+	if publicKey == nil {
+		// 304 Not Modified
+		return nil
+	}
+	if previous != nil && !bytes.Equal(previous, publicKey) {
+		log.Printf("[REAL] Revenue Authority: Public key changed from %s to %s", fingerprint(previous), fingerprint(publicKey))
+	}
+	r.publicKey = publicKey
+	r.keyETag = newETag
+	return nil
+}
+
+// StartKeyRefresh fetches the public key in the background now and then every interval
+// (0 = until the first success only). While the authority is unreachable it is retried
+// every keyRetryInterval, and the cached key, if any, keeps being served.
+func (r *RealRevenueAuthority) StartKeyRefresh(interval time.Duration) {
+	go func() {
+		for {
+			err := r.RefreshPublicKey()
+			if err != nil {
+				log.Printf("[REAL] Revenue Authority: Failed to refresh public key: %v", err)
+			} else if r.verbose {
+				fetchedAt, _ := r.PublicKeyStatus()
+				log.Printf("[REAL] Revenue Authority: Public key current as of %s", fetchedAt.Format(time.RFC3339))
+			}
+
+			delay := interval
+			if err != nil && (delay <= 0 || delay > keyRetryInterval) {
+				delay = keyRetryInterval
+			}
+			if delay <= 0 {
+				return
+			}
+			time.Sleep(delay)
+		}
+	}()
+}
+
+// getPublicKeyOnce performs a single /public-key request. With etag it is conditional:
+// a nil key and no error mean the authority still serves the cached key.
+func (r *RealRevenueAuthority) getPublicKeyOnce(etag string) ([]byte, string, error) {
+	if r.verbose {
+		log.Printf("[REAL] Revenue Authority: Fetching public key")
+	}
+
+	binaryPublicKey, newETag, err := r.client.PublicKey(context.Background(), etag)
+	if err != nil {
+		return nil, "", r.authorityError(err)
+	}
+
+	if r.verbose && binaryPublicKey != nil {
+		log.Printf("[REAL] Revenue Authority: Received public key (%d bytes)", len(binaryPublicKey))
+	}
+
+	return binaryPublicKey, newETag, nil
+}
+
+// fingerprint is the SHA-256 of a DER public key, shortened for logs
+func fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
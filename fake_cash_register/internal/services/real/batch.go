@@ -0,0 +1,52 @@
+package real
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"receiptwallet/receiptbank"
+
+	"fake-cash-register/internal/api"
+)
+
+// MaxBatchSize is the most receipts the bank takes in one /submit/batch request
+const MaxBatchSize = receiptbank.MaxBatchSize
+
+// BatchResult is the outcome of one receipt in SubmitBatch: Err is nil once the bank holds
+// the receipt, and Duplicate is set when it already held it, e.g. from an earlier attempt
+type BatchResult = receiptbank.BatchResult
+
+// SubmitBatch submits several receipts (built with Submission) in one request, e.g. when
+// flushing receipts queued while the bank was unreachable. Each receipt is stored or refused
+// on its own; the returned error covers only the request as a whole, which goes through the
+// same retries and circuit breaker as single submissions.
+func (r *RealReceiptBank) SubmitBatch(submissions []api.ReceiptSubmission) ([]BatchResult, error) {
+	if len(submissions) == 0 {
+		return nil, nil
+	}
+	if len(submissions) > MaxBatchSize {
+		return nil, fmt.Errorf("batch of %d receipts exceeds the receipt bank's limit of %d", len(submissions), MaxBatchSize)
+	}
+
+	if r.verbose {
+		log.Printf("[REAL] Receipt Bank: Submitting batch of %d receipts", len(submissions))
+	}
+
+	var results []BatchResult
+	var summary api.ReceiptBatchSummary
+	err := callWithBreaker(r.breaker, func() error {
+		var err error
+		results, summary, err = r.client.SubmitBatch(context.Background(), submissions)
+		return bankError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if r.verbose {
+		log.Printf("[REAL] Receipt Bank: Batch submitted: %d stored, %d duplicate, %d failed",
+			summary.Stored, summary.Duplicate, summary.Failed)
+	}
+	return results, nil
+}
@@ -1,97 +1,124 @@
 package real
 
 import (
-	"bytes"
+	"context"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
+	"receiptwallet/receiptbank"
+
 	"fake-cash-register/internal/api"
 	"fake-cash-register/internal/config"
 	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/resilience"
 )
 
 type RealReceiptBank struct {
-	baseURL        string
-	httpClient     *http.Client
+	client         *receiptbank.Client
 	webhookHandler interfaces.WebhookHandler
+	breaker        *resilience.Breaker
 	cfg            *config.Config
 	verbose        bool
+
+	mu      sync.RWMutex
+	version *api.ReceiptBankVersion // Last successful handshake (nil = unknown)
 }
 
+// The register finds the optional submission paths by type assertion; these keep them in step
+var (
+	_ interfaces.ReceiptBankService = (*RealReceiptBank)(nil)
+	_ interfaces.AttestedSubmitter  = (*RealReceiptBank)(nil)
+	_ interfaces.TrackedSubmitter   = (*RealReceiptBank)(nil)
+	_ interfaces.FormatChecker      = (*RealReceiptBank)(nil)
+)
+
 func NewRealReceiptBank(baseURL string, cfg *config.Config, verbose bool) *RealReceiptBank {
+	client := receiptbank.NewClient(baseURL, &http.Client{
+		Timeout: 15 * time.Second,
+	})
+	client.SetAPIKey(cfg.ReceiptBank.APIKey)
 	return &RealReceiptBank{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 15 * time.Second,
-		},
+		client:  client,
 		cfg:     cfg,
 		verbose: verbose,
 	}
 }
 
+// SetURLResolver makes the client ask resolve for the endpoint on every request instead of using baseURL
+func (r *RealReceiptBank) SetURLResolver(resolve func() string) {
+	r.client.SetURLResolver(resolve)
+}
+
+// SetBreaker routes submissions through retries and a circuit breaker
+func (r *RealReceiptBank) SetBreaker(breaker *resilience.Breaker) {
+	r.breaker = breaker
+}
+
 // SubmitReceipt sends encrypted receipt to external receipt bank
 func (r *RealReceiptBank) SubmitReceipt(userEphemeralKeyCompressed []byte, encryptedData []byte) error {
-	// Convert binary data to base64 for API transmission
-	keyBase64 := base64.StdEncoding.EncodeToString(userEphemeralKeyCompressed)
-	encryptedDataBase64 := base64.StdEncoding.EncodeToString(encryptedData)
+	return r.SubmitAttestedReceipt(userEphemeralKeyCompressed, encryptedData, nil, nil)
+}
+
+// SubmitAttestedReceipt sends an encrypted receipt together with the receipt hash and the
+// revenue authority's signature, for banks running in strict mode. Nil hash submits without them.
+func (r *RealReceiptBank) SubmitAttestedReceipt(userEphemeralKeyCompressed []byte, encryptedData []byte, receiptHash []byte, signature []byte) error {
+	return r.SubmitTrackedReceipt(fmt.Sprintf("%d", time.Now().UnixNano()), userEphemeralKeyCompressed, encryptedData, receiptHash, signature)
+}
+
+// SubmitTrackedReceipt submits under receiptID, which the bank's collection webhook reports back
+func (r *RealReceiptBank) SubmitTrackedReceipt(receiptID string, userEphemeralKeyCompressed []byte, encryptedData []byte, receiptHash []byte, signature []byte) error {
+	submission := r.Submission(receiptID, userEphemeralKeyCompressed, encryptedData, receiptHash, signature)
 
 	if r.verbose {
-		log.Printf("[REAL] Receipt Bank: Submitting receipt (privacy-preserving)")
-		log.Printf("[REAL] User Ephemeral Key: %s... (%d bytes compressed)", keyBase64[:16], len(userEphemeralKeyCompressed))
+		log.Printf("[REAL] Receipt Bank: Submitting receipt %s (privacy-preserving)", receiptID)
+		log.Printf("[REAL] User Ephemeral Key: %s... (%d bytes compressed)", submission.EphemeralKey[:16], len(userEphemeralKeyCompressed))
 		log.Printf("[REAL] Encrypted Data: %d bytes", len(encryptedData))
 	}
 
-	// Generate receipt ID for submission tracking
-	receiptID := fmt.Sprintf("%d", time.Now().Unix())
+	attempt := 0
+	return callWithBreaker(r.breaker, func() error {
+		attempt++
+		return r.submitOnce(submission, attempt > 1)
+	})
+}
 
-	// Construct webhook URL for receipt bank callbacks
+// Submission builds the /submit entry for a receipt, with the register's webhook URL
+// and receipt format; nil receiptHash leaves out the attestation
+func (r *RealReceiptBank) Submission(receiptID string, userEphemeralKeyCompressed []byte, encryptedData []byte, receiptHash []byte, signature []byte) api.ReceiptSubmission {
+	// Construct webhook URL for receipt bank callbacks; binary data travels as base64
 	webhookURL := fmt.Sprintf("http://%s:%d/webhook", r.cfg.Server.WebhookHost, r.cfg.Server.WebhookPort)
 
-	// Prepare request
 	submission := api.ReceiptSubmission{
-		EphemeralKey:  keyBase64,
-		EncryptedData: encryptedDataBase64,
+		EphemeralKey:  base64.StdEncoding.EncodeToString(userEphemeralKeyCompressed),
+		EncryptedData: base64.StdEncoding.EncodeToString(encryptedData),
 		ReceiptID:     receiptID,
 		WebhookURL:    webhookURL,
+		ReceiptFormat: int(r.receiptFormat()),
 	}
-
-	requestBody, err := json.Marshal(submission)
-	if err != nil {
-		return fmt.Errorf("failed to marshal receipt submission: %v", err)
-	}
-
-	// Make HTTP request
-	url := r.baseURL + "/submit"
-	resp, err := r.httpClient.Post(url, "application/json", bytes.NewBuffer(requestBody))
-	if err != nil {
-		return fmt.Errorf("failed to call receipt bank at %s: %v", url, err)
-	}
-	defer resp.Body.Close()
-
-	// Read response
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %v", err)
+	if receiptHash != nil {
+		submission.ReceiptHash = base64.StdEncoding.EncodeToString(receiptHash)
+		submission.AuthoritySignature = base64.StdEncoding.EncodeToString(signature)
 	}
+	return submission
+}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		// Try to parse error response
-		var errorResp api.ErrorResponse
-		if json.Unmarshal(responseBody, &errorResp) == nil {
-			return fmt.Errorf("receipt bank error (%d): %s", resp.StatusCode, errorResp.Error)
+// submitOnce posts a submission once. On a retry, 409 Conflict means an earlier
+// attempt reached the bank before its response was lost, so it counts as success.
+func (r *RealReceiptBank) submitOnce(submission api.ReceiptSubmission, retry bool) error {
+	bankResp, err := r.client.Submit(context.Background(), submission)
+	if retry && errors.Is(err, interfaces.ErrDuplicateReceipt) {
+		if r.verbose {
+			log.Printf("[REAL] Receipt Bank: Receipt already stored by an earlier attempt")
 		}
-		return fmt.Errorf("receipt bank returned status %d: %s", resp.StatusCode, string(responseBody))
+		return nil
 	}
-
-	// Parse successful response
-	var bankResp api.ReceiptBankResponse
-	if err := json.Unmarshal(responseBody, &bankResp); err != nil {
-		return fmt.Errorf("failed to parse receipt bank response: %v", err)
+	if err != nil {
+		return bankError(err)
 	}
 
 	if r.verbose {
@@ -0,0 +1,47 @@
+package real
+
+import (
+	"errors"
+	"net/http"
+
+	"receiptwallet/receiptbank"
+
+	"fake-cash-register/internal/resilience"
+)
+
+// callWithBreaker runs fn through the breaker, or once when no breaker is configured
+func callWithBreaker(breaker *resilience.Breaker, fn func() error) error {
+	if breaker == nil {
+		return fn()
+	}
+	return breaker.Do(fn)
+}
+
+// statusError classifies an error response: 5xx may succeed on retry, other statuses will not
+func statusError(status int, err error) error {
+	if status >= http.StatusInternalServerError {
+		return err
+	}
+	return resilience.Permanent(err)
+}
+
+// BankError is an error response from the receipt bank. It unwraps to the matching
+// interfaces.ErrBank... / ErrDuplicateReceipt / ErrReceiptNotFound sentinel, if any.
+type BankError = receiptbank.Error
+
+// bankError classifies a receipt bank client error. Transport failures, rate limiting
+// (429), a full store, an unavailable backend and other 5xx responses are retried, no
+// sooner than the bank's Retry-After; other refusals are final.
+func bankError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if !receiptbank.Temporary(err) {
+		return resilience.Permanent(err)
+	}
+	var bankErr *BankError
+	if errors.As(err, &bankErr) {
+		return resilience.RetryAfter(err, bankErr.RetryAfter)
+	}
+	return err
+}
@@ -1,144 +1,238 @@
 package real
 
 import (
-	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
+	"receiptwallet/authority"
+	rwcrypto "receiptwallet/crypto"
+
 	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/resilience"
 )
 
 type RealRevenueAuthority struct {
-	baseURL    string
-	httpClient *http.Client
+	client     *authority.Client
+	signingKey *ecdsa.PrivateKey
+	breaker    *resilience.Breaker
 	verbose    bool
+
+	// Public key cache, refreshed by StartKeyRefresh (see authority_key.go)
+	keyMu        sync.RWMutex
+	publicKey    []byte // DER, nil until first fetched
+	keyETag      string
+	keyFetchedAt time.Time
+	keyErr       error // Why the latest refresh failed
 }
 
-func NewRealRevenueAuthority(baseURL string, verbose bool) *RealRevenueAuthority {
+// The register finds strict signing, the key cache and Z-report submission by type assertion; these keep them in step
+var (
+	_ interfaces.RevenueAuthorityService = (*RealRevenueAuthority)(nil)
+	_ interfaces.ReceiptSigner           = (*RealRevenueAuthority)(nil)
+	_ interfaces.AuthorityKeyCache       = (*RealRevenueAuthority)(nil)
+	_ interfaces.ZReportSubmitter        = (*RealRevenueAuthority)(nil)
+)
+
+func NewRealRevenueAuthority(baseURL string, apiKey string, verbose bool) *RealRevenueAuthority {
+	client := authority.NewClient(baseURL, &http.Client{
+		Timeout: 10 * time.Second,
+	})
+	client.SetAPIKey(apiKey)
 	return &RealRevenueAuthority{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		client:  client,
 		verbose: verbose,
 	}
 }
 
+// SetSigningKey signs Z-report summaries with the register's key so the authority
+// can check they came from this register
+func (r *RealRevenueAuthority) SetSigningKey(key *ecdsa.PrivateKey) {
+	r.signingKey = key
+}
+
+// SetResponseKey requires /sign, /sign-receipt and /public-key responses to carry a
+// signature by key over a fresh nonce, so a man in the middle can't substitute the
+// signatures or public key on plain HTTP
+func (r *RealRevenueAuthority) SetResponseKey(key *ecdsa.PublicKey) {
+	r.client.SetResponseKey(key)
+}
+
+// SetBreaker routes calls through retries and a circuit breaker
+func (r *RealRevenueAuthority) SetBreaker(breaker *resilience.Breaker) {
+	r.breaker = breaker
+}
+
 // SignHash sends binary hash to external revenue authority for signing
 func (r *RealRevenueAuthority) SignHash(binaryHash []byte) ([]byte, error) {
-	if r.verbose {
-		hashBase64 := base64.StdEncoding.EncodeToString(binaryHash)
-		log.Printf("[REAL] Revenue Authority: Signing hash %s", hashBase64[:8]+"...")
+	binarySignature, _, err := r.sign(binaryHash, false)
+	return binarySignature, err
+}
+
+// SignHashWithTimestamp requests a signature plus an authority timestamp token
+func (r *RealRevenueAuthority) SignHashWithTimestamp(binaryHash []byte) ([]byte, []byte, error) {
+	binarySignature, token, err := r.sign(binaryHash, true)
+	if err != nil {
+		return nil, nil, err
 	}
+	if len(token) == 0 {
+		return nil, nil, fmt.Errorf("revenue authority did not return a timestamp token")
+	}
+	return binarySignature, token, nil
+}
 
+func (r *RealRevenueAuthority) sign(binaryHash []byte, withTimestamp bool) ([]byte, []byte, error) {
 	// Validate hash format (should be 32 bytes for SHA-256)
 	if len(binaryHash) != 32 {
-		return nil, fmt.Errorf("invalid hash length: expected 32 bytes, got %d", len(binaryHash))
+		return nil, nil, fmt.Errorf("invalid hash length: expected 32 bytes, got %d", len(binaryHash))
 	}
 
-	// Prepare request
-	hashBase64 := base64.StdEncoding.EncodeToString(binaryHash)
-	signReq := api.SignRequest{
-		Hash: hashBase64,
-	}
-
-	requestBody, err := json.Marshal(signReq)
+	var signature *authority.Signature
+	err := callWithBreaker(r.breaker, func() error {
+		if r.verbose {
+			hashBase64 := base64.StdEncoding.EncodeToString(binaryHash)
+			log.Printf("[REAL] Revenue Authority: Signing hash %s", hashBase64[:8]+"...")
+		}
+		var err error
+		signature, err = r.client.Sign(context.Background(), binaryHash, withTimestamp)
+		return r.authorityError(err)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal sign request: %v", err)
+		return nil, nil, err
 	}
+	r.logSignature(signature)
+	return signature.Signature, signature.TimestampToken, nil
+}
 
-	// Make HTTP request
-	url := r.baseURL + "/sign"
-	resp, err := r.httpClient.Post(url, "application/json", bytes.NewBuffer(requestBody))
+// SignReceipt sends the binary receipt to /sign-receipt, so the authority checks its
+// VKN, total, timestamp and serial before signing instead of signing a bare hash
+func (r *RealRevenueAuthority) SignReceipt(binaryReceipt []byte, withTimestamp bool) ([]byte, []byte, error) {
+	var signature *authority.Signature
+	err := callWithBreaker(r.breaker, func() error {
+		if r.verbose {
+			log.Printf("[REAL] Revenue Authority: Requesting signature for %d byte receipt", len(binaryReceipt))
+		}
+		var err error
+		signature, err = r.client.SignReceipt(context.Background(), binaryReceipt, withTimestamp)
+		return r.authorityError(err)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to call revenue authority at %s: %v", url, err)
+		return nil, nil, err
 	}
-	defer resp.Body.Close()
-
-	// Read response
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
+	if withTimestamp && len(signature.TimestampToken) == 0 {
+		return nil, nil, fmt.Errorf("revenue authority did not return a timestamp token")
 	}
+	r.logSignature(signature)
+	return signature.Signature, signature.TimestampToken, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		// Try to parse error response
-		var errorResp api.ErrorResponse
-		if json.Unmarshal(responseBody, &errorResp) == nil {
-			return nil, fmt.Errorf("revenue authority error (%d): %s", resp.StatusCode, errorResp.Error)
-		}
-		return nil, fmt.Errorf("revenue authority returned status %d: %s", resp.StatusCode, string(responseBody))
+func (r *RealRevenueAuthority) logSignature(signature *authority.Signature) {
+	if !r.verbose {
+		return
 	}
-
-	// Parse successful response
-	var signResp api.SignResponse
-	if err := json.Unmarshal(responseBody, &signResp); err != nil {
-		return nil, fmt.Errorf("failed to parse sign response: %v", err)
+	log.Printf("[REAL] Revenue Authority: Received signature %s (%d bytes)",
+		base64.StdEncoding.EncodeToString(signature.Signature)[:16]+"...", len(signature.Signature))
+	if signature.TimestampToken != nil {
+		log.Printf("[REAL] Revenue Authority: Received timestamp token (signed at %s)", signature.SignedAt)
 	}
+}
 
-	// Decode base64 signature to binary
-	binarySignature, err := base64.StdEncoding.DecodeString(signResp.Signature)
+// SubmitZReport posts a closed Z-report summary to /zreport, signed when a key is set
+func (r *RealRevenueAuthority) SubmitZReport(report *models.ZReport) error {
+	summary := api.ZReportSummary{
+		VKN:           report.StoreVKN,
+		Date:          report.ClosedAt.Format("2006-01-02"),
+		ZReportNumber: report.Number,
+		OpenedAt:      report.OpenedAt.UTC().Format(time.RFC3339),
+		ClosedAt:      report.ClosedAt.UTC().Format(time.RFC3339),
+		ReceiptCount:  report.ReceiptCount,
+		FirstSerial:   report.FirstSerial,
+		LastSerial:    report.LastSerial,
+		TotalAmount:   report.TotalAmount,
+		TotalTax:      report.TaxBreakdown.TotalTax,
+		PaymentTotals: report.PaymentTotals,
+	}
+	for _, rate := range report.TaxBreakdown.RateDetails() {
+		summary.TaxTotals = append(summary.TaxTotals, api.ZReportTaxTotal{Rate: rate.Rate, TaxableAmount: rate.TaxableAmount, TaxAmount: rate.TaxAmount})
+	}
+
+	summaryBytes, err := json.Marshal(summary)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode signature from base64: %v", err)
+		return fmt.Errorf("failed to marshal Z-report: %v", err)
 	}
 
-	if r.verbose {
-		log.Printf("[REAL] Revenue Authority: Received signature %s (%d bytes)",
-			signResp.Signature[:16]+"...", len(binarySignature))
+	submission := api.ZReportSubmission{Summary: summaryBytes}
+	if r.signingKey != nil {
+		digest := sha256.Sum256(summaryBytes)
+		signature, err := rwcrypto.Sign(r.signingKey, digest[:])
+		if err != nil {
+			return fmt.Errorf("failed to sign Z-report: %v", err)
+		}
+		submission.Signature = base64.StdEncoding.EncodeToString(signature)
 	}
 
-	return binarySignature, nil
+	attempt := 0
+	return callWithBreaker(r.breaker, func() error {
+		attempt++
+		return r.submitZReportOnce(submission, attempt > 1)
+	})
 }
 
-// GetPublicKey fetches the revenue authority's public key
-func (r *RealRevenueAuthority) GetPublicKey() ([]byte, error) {
+// submitZReportOnce posts a Z-report once. On a retry, 409 Conflict means an earlier
+// attempt was recorded before its response was lost, so it counts as success.
+func (r *RealRevenueAuthority) submitZReportOnce(submission api.ZReportSubmission, retry bool) error {
 	if r.verbose {
-		log.Printf("[REAL] Revenue Authority: Fetching public key")
+		log.Printf("[REAL] Revenue Authority: Submitting Z-report")
 	}
 
-	// Make HTTP request
-	url := r.baseURL + "/public-key"
-	resp, err := r.httpClient.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to call revenue authority at %s: %v", url, err)
-	}
-	defer resp.Body.Close()
-
-	// Read response
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		// Try to parse error response
-		var errorResp api.ErrorResponse
-		if json.Unmarshal(responseBody, &errorResp) == nil {
-			return nil, fmt.Errorf("revenue authority error (%d): %s", resp.StatusCode, errorResp.Error)
+	_, err := r.client.SubmitZReport(context.Background(), submission)
+	var statusErr *authority.StatusError
+	if retry && errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict {
+		if r.verbose {
+			log.Printf("[REAL] Revenue Authority: Z-report already recorded by an earlier attempt")
 		}
-		return nil, fmt.Errorf("revenue authority returned status %d: %s", resp.StatusCode, string(responseBody))
+		return nil
 	}
-
-	// Parse successful response
-	var pubKeyResp api.PublicKeyResponse
-	if err := json.Unmarshal(responseBody, &pubKeyResp); err != nil {
-		return nil, fmt.Errorf("failed to parse public key response: %v", err)
-	}
-
-	// Decode base64 public key to binary
-	binaryPublicKey, err := base64.StdEncoding.DecodeString(pubKeyResp.PublicKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode public key from base64: %v", err)
+	// The recorded report echoed back is not needed; a 200 is acceptance even without it
+	if err != nil && !errors.Is(err, authority.ErrInvalidResponse) {
+		return r.authorityError(err)
 	}
 
 	if r.verbose {
-		log.Printf("[REAL] Revenue Authority: Received public key (%d bytes)", len(binaryPublicKey))
+		log.Printf("[REAL] Revenue Authority: Z-report accepted")
 	}
 
-	return binaryPublicKey, nil
+	return nil
+}
+
+// authorityError classifies a client error for retrying: transport failures and 5xx
+// responses may succeed on retry; refusals, exhausted quotas and responses that
+// don't verify will not.
+func (r *RealRevenueAuthority) authorityError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var statusErr *authority.StatusError
+	switch {
+	case errors.As(err, &statusErr):
+		if statusErr.StatusCode == http.StatusTooManyRequests {
+			return resilience.Permanent(fmt.Errorf("revenue authority quota exceeded (retry after %ss)", statusErr.RetryAfter))
+		}
+		return statusError(statusErr.StatusCode, err)
+	case errors.Is(err, authority.ErrUnreachable):
+		return err
+	case errors.Is(err, rwcrypto.ErrInvalidResponseSignature):
+		log.Printf("[REAL] Revenue Authority: Refusing response: %v", err)
+	}
+	return resilience.Permanent(err)
 }
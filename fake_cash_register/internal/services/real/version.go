@@ -0,0 +1,126 @@
+package real
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/interfaces"
+)
+
+// BankAPIVersion is the receipt bank protocol version this register speaks (/v1/submit)
+const BankAPIVersion = "1"
+
+// legacyBankVersion describes banks that predate GET /version: they only serve v1,
+// and their wallets are assumed to decode nothing newer than binary receipt v1
+var legacyBankVersion = api.ReceiptBankVersion{
+	APIVersion:           "1",
+	SupportedAPIVersions: []string{"1"},
+	ReceiptFormats:       []int{binary.FormatVersion1},
+}
+
+// CheckVersion fetches the bank's GET /version and keeps it for CheckFormat
+func (r *RealReceiptBank) CheckVersion() (*api.ReceiptBankVersion, error) {
+	version, err := r.client.Version(context.Background())
+	var bankErr *BankError
+	if errors.As(err, &bankErr) && bankErr.Status == http.StatusNotFound {
+		legacy := legacyBankVersion
+		version, err = &legacy, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("receipt bank version check failed: %w", err)
+	}
+
+	r.mu.Lock()
+	r.version = version
+	r.mu.Unlock()
+
+	return version, nil
+}
+
+// StartVersionCheck runs the handshake now and then every interval (0 = startup only),
+// logging when the bank stops accepting what this register sends
+func (r *RealReceiptBank) StartVersionCheck(interval time.Duration) {
+	r.logVersionCheck()
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			r.logVersionCheck()
+		}
+	}()
+}
+
+func (r *RealReceiptBank) logVersionCheck() {
+	version, err := r.CheckVersion()
+	if err != nil {
+		log.Printf("[REAL] Receipt Bank: Version check failed: %v", err)
+		return
+	}
+	if err := r.CheckFormat(r.receiptFormat()); err != nil {
+		log.Printf("[REAL] Receipt Bank: %v - receipts will be refused", err)
+		return
+	}
+	if r.verbose {
+		log.Printf("[REAL] Receipt Bank: API v%s, receipt formats %v", version.APIVersion, version.ReceiptFormats)
+	}
+}
+
+// CheckFormat reports whether the bank, as of the last handshake, accepts this register's
+// protocol version and receipt format version. Before any handshake succeeds it allows
+// every format and leaves the decision to the bank.
+func (r *RealReceiptBank) CheckFormat(version uint8) error {
+	r.mu.RLock()
+	bank := r.version
+	r.mu.RUnlock()
+
+	if bank == nil {
+		return nil
+	}
+
+	if !containsString(bank.SupportedAPIVersions, BankAPIVersion) {
+		return fmt.Errorf("%w: bank serves API versions %v, register needs v%s",
+			interfaces.ErrIncompatibleBank, bank.SupportedAPIVersions, BankAPIVersion)
+	}
+	if !containsInt(bank.ReceiptFormats, int(version)) {
+		return fmt.Errorf("%w: receipt format v%d is not supported by the bank or its wallets (supported: %v)",
+			interfaces.ErrIncompatibleBank, version, bank.ReceiptFormats)
+	}
+	return nil
+}
+
+// receiptFormat returns the binary receipt version this register is configured to write
+func (r *RealReceiptBank) receiptFormat() uint8 {
+	if r.cfg.Receipt.FormatVersion != 0 {
+		return r.cfg.Receipt.FormatVersion
+	}
+	return binary.FormatVersion
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
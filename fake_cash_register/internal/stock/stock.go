@@ -0,0 +1,400 @@
+package stock
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"fake-cash-register/internal/models"
+)
+
+// Movement reasons
+const (
+	ReasonInitial    = "initial"    // Opening level from config
+	ReasonSale       = "sale"       // Issued receipt
+	ReasonRefund     = "refund"     // Goods returned by a customer
+	ReasonDelivery   = "delivery"   // Goods received from a supplier
+	ReasonDamage     = "damage"     // Written off
+	ReasonCorrection = "correction" // Manual correction
+	ReasonCount      = "count"      // Stocktake: level set to the counted quantity
+)
+
+// adjustReasons are the reasons an operator may give for a manual adjustment
+var adjustReasons = map[string]bool{
+	ReasonRefund:     true,
+	ReasonDelivery:   true,
+	ReasonDamage:     true,
+	ReasonCorrection: true,
+}
+
+var (
+	// ErrOutOfStock is wrapped by every ShortageError
+	ErrOutOfStock = errors.New("not enough stock")
+	// ErrUnknownKisim is returned for a KISIM that doesn't exist
+	ErrUnknownKisim = errors.New("unknown KISIM")
+	// ErrInvalidAdjustment is returned for a zero change, a negative count or an unknown reason
+	ErrInvalidAdjustment = errors.New("invalid stock adjustment")
+)
+
+// ShortageError reports a sale the stock can't cover
+type ShortageError struct {
+	KisimID   int
+	Name      string
+	Available int
+	Requested int
+}
+
+func (e *ShortageError) Error() string {
+	return fmt.Sprintf("%s: %d in stock, %d requested", e.Name, e.Available, e.Requested)
+}
+
+func (e *ShortageError) Unwrap() error {
+	return ErrOutOfStock
+}
+
+// Level is the stock of one KISIM
+type Level struct {
+	KisimID   int       `json:"kisim_id"`
+	Name      string    `json:"name"`
+	Quantity  int       `json:"quantity"`
+	LowStock  int       `json:"low_stock"` // Warn at or below this quantity
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Low reports whether the level is at or below its warning threshold
+func (l Level) Low() bool {
+	return l.Quantity <= l.LowStock
+}
+
+// Movement is one change to a level, as appended to the stock file
+type Movement struct {
+	KisimID       int       `json:"kisim_id"`
+	Delta         int       `json:"delta"`
+	Quantity      int       `json:"quantity"` // Level after the change
+	Reason        string    `json:"reason"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	Time          time.Time `json:"time"`
+}
+
+// Initial is the opening level of a KISIM, used when the stock file has none for it
+type Initial struct {
+	KisimID  int
+	Quantity int
+	LowStock int // 0 uses Options.LowStock
+}
+
+// Options configures stock tracking
+type Options struct {
+	File       string // Movement ledger (JSON lines); "" keeps stock in memory only
+	LowStock   int    // Default warning threshold
+	BlockSales bool   // Refuse sales the stock can't cover
+	Initial    []Initial
+}
+
+// Store tracks stock per KISIM. Only KISIMs with a level are tracked: sales of others
+// (services, open-price departments) leave the stock alone. Every change is appended
+// to the ledger file, and levels are rebuilt from it at startup.
+type Store struct {
+	mu       sync.RWMutex
+	levels   map[int]*Level
+	kisim    models.KisimSource
+	opts     Options
+	verbose  bool
+	lowStock map[int]int
+}
+
+// NewStore creates a stock store, replaying the ledger file if one is configured
+func NewStore(opts Options, kisim models.KisimSource, verbose bool) (*Store, error) {
+	s := &Store{
+		levels:   make(map[int]*Level),
+		kisim:    kisim,
+		opts:     opts,
+		verbose:  verbose,
+		lowStock: make(map[int]int),
+	}
+
+	for _, initial := range opts.Initial {
+		if _, exists := kisim.GetKisimInfo(initial.KisimID); !exists {
+			return nil, fmt.Errorf("stock for %w %d", ErrUnknownKisim, initial.KisimID)
+		}
+		if initial.LowStock > 0 {
+			s.lowStock[initial.KisimID] = initial.LowStock
+		}
+	}
+
+	if opts.File != "" {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Opening levels for KISIMs the ledger doesn't know yet
+	for _, initial := range opts.Initial {
+		if _, exists := s.levels[initial.KisimID]; exists {
+			continue
+		}
+		if _, err := s.apply(initial.KisimID, initial.Quantity, ReasonInitial, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// BlocksSales reports whether sales the stock can't cover are refused
+func (s *Store) BlocksSales() bool {
+	return s.opts.BlockSales
+}
+
+// Levels returns every tracked level, by KISIM ID
+func (s *Store) Levels() []Level {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	levels := make([]Level, 0, len(s.levels))
+	for _, level := range s.levels {
+		levels = append(levels, *level)
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i].KisimID < levels[j].KisimID })
+	return levels
+}
+
+// Low returns the levels at or below their warning threshold
+func (s *Store) Low() []Level {
+	var low []Level
+	for _, level := range s.Levels() {
+		if level.Low() {
+			low = append(low, level)
+		}
+	}
+	return low
+}
+
+// Level returns the stock of a KISIM, if it is tracked
+func (s *Store) Level(kisimID int) (Level, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	level, exists := s.levels[kisimID]
+	if !exists {
+		return Level{}, false
+	}
+	return *level, true
+}
+
+// Check reports a ShortageError when the items need more of a tracked KISIM than is
+// in stock. Quantities of lines with the same KISIM are added up.
+func (s *Store) Check(items []models.Item) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for kisimID, quantity := range quantities(items) {
+		level, tracked := s.levels[kisimID]
+		if tracked && quantity > level.Quantity {
+			return &ShortageError{KisimID: kisimID, Name: level.Name, Available: max(level.Quantity, 0), Requested: quantity}
+		}
+	}
+	return nil
+}
+
+// LowAfter returns the tracked levels the items would leave at or below their warning
+// threshold, with Quantity set to what would remain
+func (s *Store) LowAfter(items []models.Item) []Level {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var low []Level
+	for kisimID, quantity := range quantities(items) {
+		level, tracked := s.levels[kisimID]
+		if !tracked {
+			continue
+		}
+		remaining := *level
+		remaining.Quantity -= quantity
+		if remaining.Low() {
+			low = append(low, remaining)
+		}
+	}
+	sort.Slice(low, func(i, j int) bool { return low[i].KisimID < low[j].KisimID })
+	return low
+}
+
+// Sell takes an issued receipt's items out of stock. Levels may go negative when sales
+// aren't blocked, which shows up as a discrepancy at the next stocktake.
+func (s *Store) Sell(receipt *models.Receipt) {
+	for kisimID, quantity := range quantities(receipt.Items) {
+		if _, tracked := s.Level(kisimID); !tracked {
+			continue
+		}
+		level, err := s.apply(kisimID, -quantity, ReasonSale, receipt.TransactionID)
+		if err != nil {
+			log.Printf("[STOCK] Failed to record sale of %d x KISIM %d: %v", quantity, kisimID, err)
+			continue
+		}
+		if level.Low() {
+			log.Printf("[STOCK] Low stock: %s has %d left (warning at %d)", level.Name, level.Quantity, level.LowStock)
+		}
+	}
+}
+
+// Return puts the items of an issued refund back into stock
+func (s *Store) Return(receipt *models.Receipt) {
+	for kisimID, quantity := range quantities(receipt.Items) {
+		if _, tracked := s.Level(kisimID); !tracked {
+			continue
+		}
+		if _, err := s.apply(kisimID, quantity, ReasonRefund, receipt.TransactionID); err != nil {
+			log.Printf("[STOCK] Failed to record return of %d x KISIM %d: %v", quantity, kisimID, err)
+		}
+	}
+}
+
+// Adjust changes a level by delta for one of the manual reasons: refund, delivery,
+// damage or correction. An untracked KISIM starts being tracked from zero.
+func (s *Store) Adjust(kisimID, delta int, reason string) (Level, error) {
+	if delta == 0 || !adjustReasons[reason] {
+		return Level{}, fmt.Errorf("%w: change must be non-zero and reason one of refund, delivery, damage, correction", ErrInvalidAdjustment)
+	}
+	if _, exists := s.kisim.GetKisimInfo(kisimID); !exists {
+		return Level{}, fmt.Errorf("%w %d", ErrUnknownKisim, kisimID)
+	}
+	return s.apply(kisimID, delta, reason, "")
+}
+
+// Count sets a level to the quantity counted at a stocktake
+func (s *Store) Count(kisimID, counted int) (Level, error) {
+	if counted < 0 {
+		return Level{}, fmt.Errorf("%w: counted quantity can't be negative", ErrInvalidAdjustment)
+	}
+	if _, exists := s.kisim.GetKisimInfo(kisimID); !exists {
+		return Level{}, fmt.Errorf("%w %d", ErrUnknownKisim, kisimID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := 0
+	if level, exists := s.levels[kisimID]; exists {
+		current = level.Quantity
+	}
+	return s.applyLocked(kisimID, counted-current, ReasonCount, "")
+}
+
+// apply records a movement and returns the new level
+func (s *Store) apply(kisimID, delta int, reason, transactionID string) (Level, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.applyLocked(kisimID, delta, reason, transactionID)
+}
+
+func (s *Store) applyLocked(kisimID, delta int, reason, transactionID string) (Level, error) {
+	current := 0
+	if level, exists := s.levels[kisimID]; exists {
+		current = level.Quantity
+	}
+
+	movement := Movement{
+		KisimID:       kisimID,
+		Delta:         delta,
+		Quantity:      current + delta,
+		Reason:        reason,
+		TransactionID: transactionID,
+		Time:          time.Now().UTC(),
+	}
+	if s.opts.File != "" {
+		if err := s.appendToFile(movement); err != nil {
+			return Level{}, err
+		}
+	}
+
+	level := s.record(movement)
+	if s.verbose {
+		log.Printf("[STOCK] %s %+d (%s): %d in stock", level.Name, delta, reason, level.Quantity)
+	}
+	return *level, nil
+}
+
+// record applies a movement to the in-memory levels
+func (s *Store) record(movement Movement) *Level {
+	level, exists := s.levels[movement.KisimID]
+	if !exists {
+		level = &Level{KisimID: movement.KisimID, LowStock: s.opts.LowStock}
+		if threshold, set := s.lowStock[movement.KisimID]; set {
+			level.LowStock = threshold
+		}
+		if info, known := s.kisim.GetKisimInfo(movement.KisimID); known {
+			level.Name = info.Name
+		}
+		s.levels[movement.KisimID] = level
+	}
+	level.Quantity = movement.Quantity
+	level.UpdatedAt = movement.Time
+	return level
+}
+
+func (s *Store) load() error {
+	file, err := os.Open(s.opts.File)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open stock file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var movement Movement
+		if err := json.Unmarshal(scanner.Bytes(), &movement); err != nil {
+			return fmt.Errorf("invalid stock movement on line %d: %v", lineNumber, err)
+		}
+		s.record(movement)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stock file: %v", err)
+	}
+
+	if s.verbose {
+		log.Printf("[STOCK] Loaded %d levels from %s", len(s.levels), s.opts.File)
+	}
+	return nil
+}
+
+func (s *Store) appendToFile(movement Movement) error {
+	data, err := json.Marshal(movement)
+	if err != nil {
+		return fmt.Errorf("failed to encode stock movement: %v", err)
+	}
+
+	file, err := os.OpenFile(s.opts.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open stock file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write stock file: %v", err)
+	}
+	return nil
+}
+
+// quantities adds up the quantity per KISIM
+func quantities(items []models.Item) map[int]int {
+	totals := make(map[int]int)
+	for _, item := range items {
+		totals[item.KisimID] += item.Quantity
+	}
+	return totals
+}
@@ -0,0 +1,73 @@
+// Package surcharge adds fees by payment method: a percentage for a card scheme whose
+// commission the store passes on, or a fixed fee for delivery. Unlike cash rounding,
+// a surcharge is something sold: it is a receipt line of its own with KDV, part of
+// the fiscal total.
+package surcharge
+
+import (
+	"fmt"
+	"math"
+
+	"fake-cash-register/internal/models"
+)
+
+// Rule charges a fee on sales paid with PaymentMethod: Percent of the items total or a
+// fixed Amount, KDV included at TaxRate either way
+type Rule struct {
+	PaymentMethod string
+	Name          string  // Printed on the receipt line
+	Percent       float64 // e.g. 2 for 2%
+	Amount        float64 // Lira
+	TaxRate       int
+}
+
+// Policy holds the surcharge rules of each payment method; methods without rules pay none
+type Policy struct {
+	rules map[string][]Rule
+}
+
+// NewPolicy checks the rules. A payment method may have several, each giving a line.
+func NewPolicy(rules []Rule) (*Policy, error) {
+	p := &Policy{rules: make(map[string][]Rule)}
+	for _, rule := range rules {
+		if rule.PaymentMethod == "" {
+			return nil, fmt.Errorf("surcharge rule without payment_method")
+		}
+		if rule.Name == "" {
+			return nil, fmt.Errorf("surcharge for %s without name", rule.PaymentMethod)
+		}
+		if (rule.Percent > 0) == (rule.Amount > 0) || rule.Percent < 0 || rule.Amount < 0 {
+			return nil, fmt.Errorf("surcharge %q for %s needs either a positive percent or amount", rule.Name, rule.PaymentMethod)
+		}
+		if !models.CarriesTaxRate(rule.TaxRate) {
+			return nil, fmt.Errorf("surcharge %q for %s has tax rate %d", rule.Name, rule.PaymentMethod, rule.TaxRate)
+		}
+		for _, other := range p.rules[rule.PaymentMethod] {
+			if other.Name == rule.Name {
+				return nil, fmt.Errorf("more than one surcharge %q for %s", rule.Name, rule.PaymentMethod)
+			}
+		}
+		p.rules[rule.PaymentMethod] = append(p.rules[rule.PaymentMethod], rule)
+	}
+	return p, nil
+}
+
+// Apply returns the surcharge lines of a sale of itemsTotal paid with method, in rule
+// order, and nil when the method has no rules. Fees that round to zero are left out.
+func (p *Policy) Apply(itemsTotal float64, method string) []models.Surcharge {
+	var surcharges []models.Surcharge
+	for _, rule := range p.rules[method] {
+		if amount := rule.Apply(itemsTotal); amount > 0 {
+			surcharges = append(surcharges, models.Surcharge{Name: rule.Name, Amount: amount, TaxRate: rule.TaxRate})
+		}
+	}
+	return surcharges
+}
+
+// Apply returns the rule's fee (lira) for a sale of itemsTotal, rounded to the kuruş
+func (r Rule) Apply(itemsTotal float64) float64 {
+	if r.Amount > 0 {
+		return math.Round(r.Amount*100) / 100
+	}
+	return math.Round(itemsTotal*r.Percent) / 100
+}
@@ -0,0 +1,110 @@
+// Package taxid validates Turkish tax numbers: the 10-digit VKN (vergi kimlik numarası)
+// of companies and the 11-digit TCKN (T.C. kimlik numarası) that sole proprietors and
+// individuals use as their tax number. Both end in check digits, so most typing
+// mistakes are caught at the till rather than by the tax office.
+package taxid
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Tax number kinds
+const (
+	KindVKN  = "VKN"
+	KindTCKN = "TCKN"
+)
+
+// Digit counts of each kind
+const (
+	VKNLength  = 10
+	TCKNLength = 11
+)
+
+var (
+	// ErrInvalid is wrapped by every validation error
+	ErrInvalid = errors.New("invalid tax number")
+	// ErrChecksum is returned for a number whose check digits don't match
+	ErrChecksum = fmt.Errorf("%w: check digits don't match", ErrInvalid)
+)
+
+// Normalize removes the spaces, dashes and dots people type between digit groups
+func Normalize(number string) string {
+	return strings.NewReplacer(" ", "", "-", "", ".", "").Replace(number)
+}
+
+// Validate returns the kind of a normalized tax number, or an error wrapping
+// ErrInvalid when it is neither a valid VKN nor a valid TCKN
+func Validate(number string) (string, error) {
+	for i := 0; i < len(number); i++ {
+		if number[i] < '0' || number[i] > '9' {
+			return "", fmt.Errorf("%w: %q has characters other than digits", ErrInvalid, number)
+		}
+	}
+	switch len(number) {
+	case VKNLength:
+		if !validVKN(number) {
+			return "", ErrChecksum
+		}
+		return KindVKN, nil
+	case TCKNLength:
+		if !validTCKN(number) {
+			return "", ErrChecksum
+		}
+		return KindTCKN, nil
+	default:
+		return "", fmt.Errorf("%w: %d digits, a VKN has %d and a TCKN %d", ErrInvalid, len(number), VKNLength, TCKNLength)
+	}
+}
+
+// Kind returns the kind a number of its length would be, without validating it
+func Kind(number string) string {
+	if len(number) == TCKNLength {
+		return KindTCKN
+	}
+	return KindVKN
+}
+
+// Mask hides all but the last three digits, for logs and the audit trail: "*******123"
+func Mask(number string) string {
+	if len(number) <= 3 {
+		return strings.Repeat("*", len(number))
+	}
+	return strings.Repeat("*", len(number)-3) + number[len(number)-3:]
+}
+
+// validVKN checks the last digit of a 10-digit VKN against the first nine
+func validVKN(number string) bool {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		shifted := (int(number[i]-'0') + 9 - i) % 10
+		if shifted == 9 {
+			sum += 9
+			continue
+		}
+		sum += shifted * (1 << (9 - i)) % 9
+	}
+	return int(number[9]-'0') == (10-sum%10)%10
+}
+
+// validTCKN checks the two check digits of an 11-digit TCKN, which never starts with 0
+func validTCKN(number string) bool {
+	var d [TCKNLength]int
+	for i := range d {
+		d[i] = int(number[i] - '0')
+	}
+	if d[0] == 0 {
+		return false
+	}
+	odd := d[0] + d[2] + d[4] + d[6] + d[8]
+	even := d[1] + d[3] + d[5] + d[7]
+	if ((odd*7-even)%10+10)%10 != d[9] {
+		return false
+	}
+	sum := 0
+	for _, digit := range d[:10] {
+		sum += digit
+	}
+	return sum%10 == d[10]
+}
@@ -0,0 +1,201 @@
+package timing
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Steps of the issuance pipeline, in the order they run
+const (
+	StepSerialize = "serialize"
+	StepHash      = "hash"
+	StepSign      = "sign"    // Revenue authority round trip
+	StepEncrypt   = "encrypt" // For the wallet's ephemeral key
+	StepSubmit    = "submit"  // Receipt bank round trip, retries included
+)
+
+// Steps lists the pipeline steps in order
+var Steps = []string{StepSerialize, StepHash, StepSign, StepEncrypt, StepSubmit}
+
+// DefaultSmoothing is the weight of the newest sample in the moving averages: about the
+// last ten receipts dominate them
+const DefaultSmoothing = 0.2
+
+// ContentType is the Prometheus text exposition format written by WritePrometheus
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// StepStats is a snapshot of one step for /api/status. Durations are milliseconds.
+type StepStats struct {
+	Step      string     `json:"step"`
+	Count     int64      `json:"count"`
+	Failures  int64      `json:"failures"`
+	AverageMs float64    `json:"average_ms"` // Exponential moving average
+	JitterMs  float64    `json:"jitter_ms"`  // Exponential moving average of the deviation from it
+	LastMs    float64    `json:"last_ms"`
+	MinMs     float64    `json:"min_ms"`
+	MaxMs     float64    `json:"max_ms"`
+	LastAt    *time.Time `json:"last_at,omitempty"`
+}
+
+type step struct {
+	count    int64
+	failures int64
+	sum      time.Duration
+	average  float64 // Seconds
+	jitter   float64 // Seconds
+	last     time.Duration
+	min      time.Duration
+	max      time.Duration
+	lastAt   time.Time
+}
+
+// Recorder keeps rolling statistics of how long each pipeline step takes, so a slow
+// authority or bank shows without verbose logs. A nil Recorder records nothing.
+type Recorder struct {
+	mu        sync.Mutex
+	smoothing float64
+	steps     map[string]*step
+}
+
+// NewRecorder creates a recorder; smoothing outside (0, 1] uses DefaultSmoothing
+func NewRecorder(smoothing float64) *Recorder {
+	if smoothing <= 0 || smoothing > 1 {
+		smoothing = DefaultSmoothing
+	}
+	return &Recorder{
+		smoothing: smoothing,
+		steps:     make(map[string]*step),
+	}
+}
+
+// Start begins timing a step; call the returned function with the step's error when
+// it is done
+func (r *Recorder) Start(name string) func(err error) {
+	started := time.Now()
+	return func(err error) {
+		r.Observe(name, time.Since(started), err)
+	}
+}
+
+// Observe records one run of a step. Failed runs count, but only their number: a
+// timeout would otherwise pull the average toward the client's deadline.
+func (r *Recorder) Observe(name string, elapsed time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.steps[name]
+	if s == nil {
+		s = &step{}
+		r.steps[name] = s
+	}
+	if err != nil {
+		s.failures++
+		return
+	}
+
+	seconds := elapsed.Seconds()
+	if s.count == 0 {
+		s.average = seconds
+		s.min, s.max = elapsed, elapsed
+	} else {
+		deviation := seconds - s.average
+		if deviation < 0 {
+			deviation = -deviation
+		}
+		s.jitter += r.smoothing * (deviation - s.jitter)
+		s.average += r.smoothing * (seconds - s.average)
+		s.min = min(s.min, elapsed)
+		s.max = max(s.max, elapsed)
+	}
+	s.count++
+	s.sum += elapsed
+	s.last = elapsed
+	s.lastAt = time.Now().UTC()
+}
+
+// Stats returns every pipeline step in order, zero for steps that never ran
+func (r *Recorder) Stats() []StepStats {
+	stats := make([]StepStats, 0, len(Steps))
+	if r == nil {
+		return stats
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, name := range Steps {
+		entry := StepStats{Step: name}
+		if s := r.steps[name]; s != nil {
+			entry.Count = s.count
+			entry.Failures = s.failures
+			entry.AverageMs = milliseconds(s.average)
+			entry.JitterMs = milliseconds(s.jitter)
+			entry.LastMs = milliseconds(s.last.Seconds())
+			entry.MinMs = milliseconds(s.min.Seconds())
+			entry.MaxMs = milliseconds(s.max.Seconds())
+			if !s.lastAt.IsZero() {
+				lastAt := s.lastAt
+				entry.LastAt = &lastAt
+			}
+		}
+		stats = append(stats, entry)
+	}
+	return stats
+}
+
+// WritePrometheus writes the step statistics in the Prometheus text exposition format
+func (r *Recorder) WritePrometheus(w io.Writer) {
+	stats := r.Stats()
+	sums := make(map[string]float64, len(Steps))
+	if r != nil {
+		r.mu.Lock()
+		for name, s := range r.steps {
+			sums[name] = s.sum.Seconds()
+		}
+		r.mu.Unlock()
+	}
+
+	fmt.Fprintln(w, "# HELP cash_register_pipeline_step_duration_seconds Time spent in successful runs of each issuance step.")
+	fmt.Fprintln(w, "# TYPE cash_register_pipeline_step_duration_seconds summary")
+	for _, s := range stats {
+		fmt.Fprintf(w, "cash_register_pipeline_step_duration_seconds_sum{step=%q} %s\n", s.Step, formatFloat(sums[s.Step]))
+		fmt.Fprintf(w, "cash_register_pipeline_step_duration_seconds_count{step=%q} %d\n", s.Step, s.Count)
+	}
+
+	fmt.Fprintln(w, "# HELP cash_register_pipeline_step_failures_total Failed runs of each issuance step.")
+	fmt.Fprintln(w, "# TYPE cash_register_pipeline_step_failures_total counter")
+	for _, s := range stats {
+		fmt.Fprintf(w, "cash_register_pipeline_step_failures_total{step=%q} %d\n", s.Step, s.Failures)
+	}
+
+	gauges := []struct {
+		name, help string
+		value      func(StepStats) float64
+	}{
+		{"cash_register_pipeline_step_average_seconds", "Exponential moving average of each issuance step.", func(s StepStats) float64 { return s.AverageMs }},
+		{"cash_register_pipeline_step_jitter_seconds", "Exponential moving average of each issuance step's deviation from its average.", func(s StepStats) float64 { return s.JitterMs }},
+		{"cash_register_pipeline_step_last_seconds", "Duration of the latest successful run of each issuance step.", func(s StepStats) float64 { return s.LastMs }},
+		{"cash_register_pipeline_step_max_seconds", "Slowest successful run of each issuance step since startup.", func(s StepStats) float64 { return s.MaxMs }},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n", g.name, g.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", g.name)
+		for _, s := range stats {
+			fmt.Fprintf(w, "%s{step=%q} %s\n", g.name, s.Step, formatFloat(g.value(s)/1000))
+		}
+	}
+}
+
+// milliseconds converts seconds to milliseconds rounded to the microsecond
+func milliseconds(seconds float64) float64 {
+	return float64(int64(seconds*1e6+0.5)) / 1000
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -18,6 +18,9 @@ const (
 	StatusError     TransactionStatus = "error"
 )
 
+// DefaultTimeout is how long an issued receipt waits for collection before it expires
+const DefaultTimeout = 5 * time.Minute
+
 // PendingTransaction tracks transactions waiting for wallet confirmation
 type PendingTransaction struct {
 	ReceiptID    string
@@ -28,21 +31,109 @@ type PendingTransaction struct {
 	ErrorMessage string
 }
 
+// Stats summarizes the receipts waiting for collection, for status reporting
+type Stats struct {
+	Pending       int        `json:"pending"`
+	OldestPending *time.Time `json:"oldest_pending,omitempty"`
+	Confirmed     int        `json:"confirmed"` // Since startup
+	Expired       int        `json:"expired"`   // Since startup
+	Timeout       string     `json:"timeout"`
+}
+
 // Manager handles pending transactions and webhook confirmations
 type Manager struct {
-	pending map[string]*PendingTransaction
-	mutex   sync.RWMutex
-	verbose bool
+	pending   map[string]*PendingTransaction
+	mutex     sync.RWMutex
+	timeout   time.Duration
+	onExpired func(*PendingTransaction)
+	confirmed int
+	expired   int
+	stop      chan struct{}
+	verbose   bool
 }
 
 // NewManager creates a new transaction manager
 func NewManager(verbose bool) *Manager {
 	return &Manager{
 		pending: make(map[string]*PendingTransaction),
+		timeout: DefaultTimeout,
 		verbose: verbose,
 	}
 }
 
+// SetTimeout sets how long a receipt may wait for collection (0 restores DefaultTimeout)
+func (m *Manager) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	m.mutex.Lock()
+	m.timeout = timeout
+	m.mutex.Unlock()
+}
+
+// SetExpiryHandler is called, outside the manager's lock, for every transaction that expires
+func (m *Manager) SetExpiryHandler(handler func(*PendingTransaction)) {
+	m.mutex.Lock()
+	m.onExpired = handler
+	m.mutex.Unlock()
+}
+
+// StartSweeper expires timed-out transactions every interval until Stop is called
+func (m *Manager) StartSweeper(interval time.Duration) {
+	m.mutex.Lock()
+	if m.stop != nil {
+		m.mutex.Unlock()
+		return
+	}
+	m.stop = make(chan struct{})
+	stop := m.stop
+	m.mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.CleanupExpiredTransactions()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the background sweeper
+func (m *Manager) Stop() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// Stats reports the pending transactions and confirmation/expiry counts
+func (m *Manager) Stats() Stats {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	stats := Stats{
+		Pending:   len(m.pending),
+		Confirmed: m.confirmed,
+		Expired:   m.expired,
+		Timeout:   m.timeout.String(),
+	}
+	for _, tx := range m.pending {
+		if stats.OldestPending == nil || tx.SubmittedAt.Before(*stats.OldestPending) {
+			submitted := tx.SubmittedAt
+			stats.OldestPending = &submitted
+		}
+	}
+	return stats
+}
+
 // AddPendingTransaction adds a transaction waiting for confirmation
 func (m *Manager) AddPendingTransaction(receiptID string, receipt *models.Receipt) {
 	m.mutex.Lock()
@@ -51,6 +142,7 @@ func (m *Manager) AddPendingTransaction(receiptID string, receipt *models.Receip
 	m.pending[receiptID] = &PendingTransaction{
 		ReceiptID:   receiptID,
 		Receipt:     receipt,
+		Status:      StatusPending,
 		SubmittedAt: time.Now(),
 	}
 
@@ -59,6 +151,14 @@ func (m *Manager) AddPendingTransaction(receiptID string, receipt *models.Receip
 	}
 }
 
+// IsPending reports whether receiptID is waiting for confirmation
+func (m *Manager) IsPending(receiptID string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	_, exists := m.pending[receiptID]
+	return exists
+}
+
 // ConfirmTransaction processes webhook confirmation and removes transaction
 func (m *Manager) ConfirmTransaction(receiptID string) bool {
 	m.mutex.Lock()
@@ -67,6 +167,7 @@ func (m *Manager) ConfirmTransaction(receiptID string) bool {
 	if _, exists := m.pending[receiptID]; exists {
 		// Remove transaction immediately after confirmation - no need to track
 		delete(m.pending, receiptID)
+		m.confirmed++
 
 		if m.verbose {
 			log.Printf("[TRANSACTION] Transaction confirmed and completed: %s", receiptID)
@@ -80,19 +181,31 @@ func (m *Manager) ConfirmTransaction(receiptID string) bool {
 	return false
 }
 
-// CleanupExpiredTransactions removes transactions that timed out (after 5 minutes)
-func (m *Manager) CleanupExpiredTransactions() {
+// CleanupExpiredTransactions removes transactions that waited longer than the timeout
+// and returns them, after passing each to the expiry handler
+func (m *Manager) CleanupExpiredTransactions() []*PendingTransaction {
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
-	cutoff := time.Now().Add(-5 * time.Minute)
+	cutoff := time.Now().Add(-m.timeout)
 
+	var expired []*PendingTransaction
 	for receiptID, tx := range m.pending {
 		if tx.SubmittedAt.Before(cutoff) {
 			delete(m.pending, receiptID)
+			tx.Status = StatusExpired
+			expired = append(expired, tx)
 			if m.verbose {
 				log.Printf("[TRANSACTION] Transaction timed out and removed: %s", receiptID)
 			}
 		}
 	}
+	m.expired += len(expired)
+	onExpired := m.onExpired
+	m.mutex.Unlock()
+
+	if onExpired != nil {
+		for _, tx := range expired {
+			onExpired(tx)
+		}
+	}
+	return expired
 }
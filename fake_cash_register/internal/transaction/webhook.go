@@ -0,0 +1,99 @@
+package transaction
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ExpiryEvent is posted to the expiry webhook when an issued receipt was not collected in time
+type ExpiryEvent struct {
+	Event         string    `json:"event"` // Always "receipt_expired"
+	ReceiptID     string    `json:"receipt_id"`
+	TransactionID string    `json:"transaction_id"`
+	ReceiptSerial string    `json:"receipt_serial"`
+	TotalAmount   float64   `json:"total_amount"`
+	SubmittedAt   time.Time `json:"submitted_at"`
+	ExpiredAt     time.Time `json:"expired_at"`
+}
+
+// ExpiryWebhook posts an ExpiryEvent for each expired transaction. With a secret, the
+// request is signed like receipt bank webhooks: X-Webhook-Timestamp carries the Unix time
+// and X-Webhook-Signature "sha256=<hex HMAC of "<timestamp>.<body>">".
+type ExpiryWebhook struct {
+	url     string
+	secret  string
+	client  *http.Client
+	verbose bool
+}
+
+// NewExpiryWebhook creates a notifier posting to url
+func NewExpiryWebhook(url, secret string, timeout time.Duration, verbose bool) *ExpiryWebhook {
+	return &ExpiryWebhook{
+		url:     url,
+		secret:  secret,
+		client:  &http.Client{Timeout: timeout},
+		verbose: verbose,
+	}
+}
+
+// Notify posts the event in the background; failures are logged
+func (w *ExpiryWebhook) Notify(tx *PendingTransaction) {
+	event := ExpiryEvent{
+		Event:       "receipt_expired",
+		ReceiptID:   tx.ReceiptID,
+		SubmittedAt: tx.SubmittedAt,
+		ExpiredAt:   time.Now(),
+	}
+	if tx.Receipt != nil {
+		event.TransactionID = tx.Receipt.TransactionID
+		event.ReceiptSerial = tx.Receipt.ReceiptSerial
+		event.TotalAmount = tx.Receipt.TotalAmount
+	}
+
+	go func() {
+		if err := w.post(event); err != nil {
+			log.Printf("[TRANSACTION] Expiry webhook for %s failed: %v", tx.ReceiptID, err)
+		} else if w.verbose {
+			log.Printf("[TRANSACTION] Expiry webhook sent for %s", tx.ReceiptID)
+		}
+	}()
+}
+
+func (w *ExpiryWebhook) post(event ExpiryEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(w.secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package zreport
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"fake-cash-register/internal/models"
+)
+
+var (
+	// ErrSaleInProgress is returned when a close is requested while a receipt is open.
+	// New sales stay blocked; the close completes once the sale is issued or canceled.
+	ErrSaleInProgress = errors.New("sale in progress - Z-report will close when it completes")
+	// ErrClosePending is returned when a sale is started while a Z-report close is pending
+	ErrClosePending = errors.New("Z-report close in progress - new sales are blocked")
+)
+
+// retryInterval is how often a pending close re-checks for an open sale
+const retryInterval = 5 * time.Second
+
+// Closer closes the open Z-report
+type Closer interface {
+	CloseZReport() (*models.ZReport, error)
+}
+
+// Scheduler closes the Z-report every day at a fixed local time
+type Scheduler struct {
+	hour, minute int
+	closer       Closer
+	stop         chan struct{}
+	verbose      bool
+}
+
+// NewScheduler creates a scheduler closing at "HH:MM" local time
+func NewScheduler(at string, closer Closer, verbose bool) (*Scheduler, error) {
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Z-report close time %q (want HH:MM): %v", at, err)
+	}
+
+	return &Scheduler{
+		hour:    t.Hour(),
+		minute:  t.Minute(),
+		closer:  closer,
+		stop:    make(chan struct{}),
+		verbose: verbose,
+	}, nil
+}
+
+// Next returns the first close time strictly after now, in now's location
+func (s *Scheduler) Next(now time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), s.hour, s.minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Start runs the schedule in the background until Stop is called
+func (s *Scheduler) Start() {
+	go func() {
+		for {
+			next := s.Next(time.Now())
+			if s.verbose {
+				log.Printf("[Z-REPORT] Next automatic close at %s", next.Format("2006-01-02 15:04"))
+			}
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-timer.C:
+				s.close()
+			case <-s.stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the schedule
+func (s *Scheduler) Stop() {
+	close(s.stop)
+}
+
+// close keeps trying while a sale is open; any other failure waits for the next day
+func (s *Scheduler) close() {
+	for {
+		report, err := s.closer.CloseZReport()
+		if err == nil {
+			log.Printf("[Z-REPORT] Automatic close of %s: %d receipts, ₺%.2f", report.Number, report.ReceiptCount, report.TotalAmount)
+			return
+		}
+		if !errors.Is(err, ErrSaleInProgress) {
+			log.Printf("[Z-REPORT] Automatic close failed: %v", err)
+			return
+		}
+
+		if s.verbose {
+			log.Printf("[Z-REPORT] Waiting for the open sale before closing")
+		}
+		select {
+		case <-time.After(retryInterval):
+		case <-s.stop:
+			return
+		}
+	}
+}
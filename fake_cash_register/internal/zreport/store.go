@@ -0,0 +1,130 @@
+package zreport
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"fake-cash-register/internal/models"
+)
+
+// Store keeps closed Z-reports. When a file path is configured, reports are appended
+// as JSON lines and reloaded at startup so Z numbering continues across restarts.
+type Store struct {
+	mu       sync.RWMutex
+	reports  []*models.ZReport
+	filePath string
+	verbose  bool
+}
+
+// NewStore creates a Z-report store, loading existing reports from filePath if set
+func NewStore(filePath string, verbose bool) (*Store, error) {
+	s := &Store{
+		reports:  make([]*models.ZReport, 0),
+		filePath: filePath,
+		verbose:  verbose,
+	}
+
+	if filePath != "" {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Add records a closed Z-report
+func (s *Store) Add(report *models.ZReport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.filePath != "" {
+		if err := s.appendToFile(report); err != nil {
+			return err
+		}
+	}
+
+	s.reports = append(s.reports, report)
+
+	if s.verbose {
+		log.Printf("[Z-REPORT] Stored %s (%d receipts, ₺%.2f)", report.Number, report.ReceiptCount, report.TotalAmount)
+	}
+
+	return nil
+}
+
+// Last returns the most recently closed Z-report
+func (s *Store) Last() (*models.ZReport, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.reports) == 0 {
+		return nil, false
+	}
+	return s.reports[len(s.reports)-1], true
+}
+
+// All returns every closed Z-report, oldest first
+func (s *Store) All() []*models.ZReport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*models.ZReport, len(s.reports))
+	copy(result, s.reports)
+	return result
+}
+
+func (s *Store) load() error {
+	file, err := os.Open(s.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open Z-report file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var report models.ZReport
+		if err := json.Unmarshal(scanner.Bytes(), &report); err != nil {
+			return fmt.Errorf("failed to parse Z-report entry %d: %v", len(s.reports)+1, err)
+		}
+		s.reports = append(s.reports, &report)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read Z-report file: %v", err)
+	}
+
+	if s.verbose {
+		log.Printf("[Z-REPORT] Loaded %d reports from %s", len(s.reports), s.filePath)
+	}
+
+	return nil
+}
+
+func (s *Store) appendToFile(report *models.ZReport) error {
+	line, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Z-report: %v", err)
+	}
+
+	file, err := os.OpenFile(s.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open Z-report file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write Z-report entry: %v", err)
+	}
+
+	return nil
+}
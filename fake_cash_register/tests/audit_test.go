@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"fake-cash-register/internal/audit"
+	"fake-cash-register/internal/cashregister"
+)
+
+func TestAuditRecordsSaleLifecycle(t *testing.T) {
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	auditLog, err := audit.NewLog(auditFile, false)
+	if err != nil {
+		t.Fatalf("Failed to create audit log: %v", err)
+	}
+
+	cashReg := createTestCashRegister(false)
+	cashReg.SetAudit(auditLog)
+
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItem(1, 2, 0); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if err := cashReg.AddItem(2, 1, 12.00); err != nil {
+		t.Fatalf("Failed to add item with custom price: %v", err)
+	}
+	if err := cashReg.RemoveItem(0); err != nil {
+		t.Fatalf("Failed to remove item: %v", err)
+	}
+	if err := cashReg.RemoveItem(5); !errors.Is(err, cashregister.ErrNoSuchLine) {
+		t.Errorf("Expected ErrNoSuchLine for a missing line, got %v", err)
+	}
+	if err := cashReg.SetPaymentMethod("Nakit"); err != nil {
+		t.Fatalf("Failed to set payment method: %v", err)
+	}
+
+	issued, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+
+	cashReg.StartNewReceipt()
+	cashReg.CancelCurrentReceipt()
+
+	expected := []string{
+		audit.EventTransactionStarted,
+		audit.EventItemAdded,
+		audit.EventPriceOverridden,
+		audit.EventItemAdded,
+		audit.EventItemRemoved,
+		audit.EventPaymentSet,
+		audit.EventReceiptIssued,
+		audit.EventTransactionStarted,
+		audit.EventReceiptCancelled,
+	}
+	events := auditLog.Query(audit.Query{})
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d audit events, got %d: %+v", len(expected), len(events), events)
+	}
+	for i, eventType := range expected {
+		if events[i].Type != eventType {
+			t.Errorf("Event %d: expected %s, got %s", i+1, eventType, events[i].Type)
+		}
+	}
+
+	if got := events[2].Details["preset_price"]; got != "15.00" {
+		t.Errorf("Expected preset price 15.00 on the override, got %q", got)
+	}
+	if events[6].TransactionID != issued.TransactionID {
+		t.Errorf("Expected issued event for %s, got %s", issued.TransactionID, events[6].TransactionID)
+	}
+
+	// Filters
+	if n := len(auditLog.Query(audit.Query{Type: audit.EventItemAdded})); n != 2 {
+		t.Errorf("Expected 2 item_added events, got %d", n)
+	}
+	if n := len(auditLog.Query(audit.Query{TransactionID: issued.TransactionID})); n != 1 {
+		t.Errorf("Expected 1 event for the issued transaction, got %d", n)
+	}
+	if page := auditLog.Query(audit.Query{AfterSequence: 3, Limit: 2}); len(page) != 2 || page[0].Sequence != 4 {
+		t.Errorf("Expected events 4-5 after sequence 3, got %+v", page)
+	}
+
+	// Reload from disk: the chain must verify and continue where it left off
+	headSeq, headHash := auditLog.Head()
+	reloaded, err := audit.NewLog(auditFile, false)
+	if err != nil {
+		t.Fatalf("Failed to reload audit log: %v", err)
+	}
+	if seq, hash := reloaded.Head(); seq != headSeq || hash != headHash {
+		t.Errorf("Expected head %d/%s after reload, got %d/%s", headSeq, headHash, seq, hash)
+	}
+	if n, err := reloaded.Verify(); err != nil || n != len(expected) {
+		t.Errorf("Expected %d verified events, got %d (%v)", len(expected), n, err)
+	}
+}
+
+func TestAuditDetectsTampering(t *testing.T) {
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	auditLog, err := audit.NewLog(auditFile, false)
+	if err != nil {
+		t.Fatalf("Failed to create audit log: %v", err)
+	}
+	auditLog.Record(audit.EventTransactionStarted, "", nil)
+	auditLog.Record(audit.EventItemAdded, "", map[string]string{"unit_price": "10.50"})
+	auditLog.Record(audit.EventReceiptIssued, "TX-1", nil)
+
+	data, err := os.ReadFile(auditFile)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+
+	tampered := strings.Replace(string(data), `"unit_price":"10.50"`, `"unit_price":"1.50"`, 1)
+	if err := os.WriteFile(auditFile, []byte(tampered), 0644); err != nil {
+		t.Fatalf("Failed to write audit log: %v", err)
+	}
+	if _, err := auditLog.Verify(); err == nil {
+		t.Error("Expected verification to fail for an edited event")
+	}
+	if _, err := audit.NewLog(auditFile, false); err == nil {
+		t.Error("Expected loading an edited audit log to fail")
+	}
+
+	// Dropping an event breaks the chain as well
+	lines := strings.SplitAfter(string(data), "\n")
+	if err := os.WriteFile(auditFile, []byte(lines[0]+lines[2]), 0644); err != nil {
+		t.Fatalf("Failed to write audit log: %v", err)
+	}
+	if _, err := auditLog.Verify(); err == nil {
+		t.Error("Expected verification to fail for a removed event")
+	}
+}
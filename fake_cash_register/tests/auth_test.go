@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/handlers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	keys := []config.APIKey{
+		{Name: "dashboard", Key: "read-key", Role: handlers.RoleReadonly},
+		{Name: "pos", Key: "sales-key", Role: handlers.RoleSales},
+		{Name: "shift", Key: "supervisor-key", Role: handlers.RoleSupervisor},
+		{Name: "office", Key: "admin-key", Role: handlers.RoleAdmin},
+	}
+	auth, err := handlers.NewAPIKeyAuth(keys, handlers.RoleSales, false)
+	if err != nil {
+		t.Fatalf("Failed to create API key auth: %v", err)
+	}
+
+	router := gin.New()
+	api := router.Group("/api", auth)
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api.GET("/zreport", ok)
+	api.POST("/zreport/close", ok)
+	api.POST("/transaction/add-item", ok)
+	api.POST("/transaction/refund", ok)
+	api.POST("/transaction/refund/add-item", ok)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		headers  map[string]string
+		expected int
+	}{
+		{"no key", "GET", "/api/zreport", nil, http.StatusUnauthorized},
+		{"unknown key", "GET", "/api/zreport", map[string]string{"X-API-Key": "guess"}, http.StatusUnauthorized},
+		{"readonly reads", "GET", "/api/zreport", map[string]string{"X-API-Key": "read-key"}, http.StatusOK},
+		{"readonly sells", "POST", "/api/transaction/add-item", map[string]string{"X-API-Key": "read-key"}, http.StatusForbidden},
+		{"sales sells", "POST", "/api/transaction/add-item", map[string]string{"Authorization": "Bearer sales-key"}, http.StatusOK},
+		{"sales closes day", "POST", "/api/zreport/close", map[string]string{"Authorization": "Bearer sales-key"}, http.StatusForbidden},
+		{"admin closes day", "POST", "/api/zreport/close", map[string]string{"Authorization": "Bearer admin-key"}, http.StatusOK},
+		{"sales refunds", "POST", "/api/transaction/refund", map[string]string{"Authorization": "Bearer sales-key"}, http.StatusForbidden},
+		{"sales adds refund line", "POST", "/api/transaction/refund/add-item", map[string]string{"Authorization": "Bearer sales-key"}, http.StatusForbidden},
+		{"supervisor refunds", "POST", "/api/transaction/refund", map[string]string{"Authorization": "Bearer supervisor-key"}, http.StatusOK},
+		{"supervisor adds refund line", "POST", "/api/transaction/refund/add-item", map[string]string{"Authorization": "Bearer supervisor-key"}, http.StatusOK},
+		{"supervisor sells", "POST", "/api/transaction/add-item", map[string]string{"Authorization": "Bearer supervisor-key"}, http.StatusOK},
+		{"supervisor closes day", "POST", "/api/zreport/close", map[string]string{"Authorization": "Bearer supervisor-key"}, http.StatusForbidden},
+		{"admin refunds", "POST", "/api/transaction/refund", map[string]string{"Authorization": "Bearer admin-key"}, http.StatusOK},
+		{"bundled UI refunds", "POST", "/api/transaction/refund", map[string]string{"Sec-Fetch-Site": "same-origin"}, http.StatusForbidden},
+		{"bundled UI", "POST", "/api/transaction/add-item", map[string]string{"Sec-Fetch-Site": "same-origin"}, http.StatusOK},
+		{"bundled UI, admin endpoint", "POST", "/api/zreport/close", map[string]string{"Sec-Fetch-Site": "same-origin"}, http.StatusForbidden},
+		{"older browser, same origin", "POST", "/api/transaction/add-item", map[string]string{"Origin": "http://register.local:8080"}, http.StatusOK},
+		{"other site", "POST", "/api/transaction/add-item", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "http://register.local:8080"}, http.StatusUnauthorized},
+		{"other origin", "POST", "/api/transaction/add-item", map[string]string{"Origin": "http://evil.example"}, http.StatusUnauthorized},
+		{"wrong key from UI", "GET", "/api/zreport", map[string]string{"Sec-Fetch-Site": "same-origin", "X-API-Key": "guess"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "http://register.local:8080"+tt.path, nil)
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+
+	// Without a UI role the UI needs a key too, and a bad configuration is refused
+	strict, _ := handlers.NewAPIKeyAuth(keys, "", false)
+	router = gin.New()
+	router.GET("/api/zreport", strict, ok)
+	req := httptest.NewRequest("GET", "/api/zreport", nil)
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the UI to need a key without ui_role, got %d", w.Code)
+	}
+
+	for _, bad := range [][]config.APIKey{
+		{{Name: "x", Key: "k", Role: "root"}},
+		{{Name: "x", Role: handlers.RoleAdmin}},
+		{{Name: "x", Key: "k", Role: handlers.RoleAdmin}, {Name: "y", Key: "k", Role: handlers.RoleSales}},
+	} {
+		if _, err := handlers.NewAPIKeyAuth(bad, "", false); err == nil {
+			t.Errorf("Expected %+v to be refused", bad)
+		}
+	}
+}
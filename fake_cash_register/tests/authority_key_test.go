@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/handlers"
+	"fake-cash-register/internal/services/mock"
+	"fake-cash-register/internal/services/real"
+
+	"github.com/gin-gonic/gin"
+)
+
+// keyAuthority serves /public-key with the fingerprint as ETag, like the revenue authority
+type keyAuthority struct {
+	mu          sync.Mutex
+	der         []byte
+	down        bool
+	fetches     int
+	notModified int
+}
+
+func (a *keyAuthority) setKey(t *testing.T) []byte {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+	a.mu.Lock()
+	a.der = der
+	a.mu.Unlock()
+	return der
+}
+
+func (a *keyAuthority) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	a.fetches++
+	sum := sha256.Sum256(a.der)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		a.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	json.NewEncoder(w).Encode(api.PublicKeyResponse{PublicKey: base64.StdEncoding.EncodeToString(a.der)})
+}
+
+func TestAuthorityKeyCache(t *testing.T) {
+	authority := &keyAuthority{}
+	first := authority.setKey(t)
+	server := httptest.NewServer(authority)
+	defer server.Close()
+
+	revenueAuth := real.NewRealRevenueAuthority(server.URL, "", false)
+	key, err := revenueAuth.GetPublicKey()
+	if err != nil || !bytes.Equal(key, first) {
+		t.Fatalf("Expected the authority key, got %v", err)
+	}
+	if _, err := revenueAuth.GetPublicKey(); err != nil || authority.fetches != 1 {
+		t.Errorf("Expected the cached key without another fetch, fetched %d times (%v)", authority.fetches, err)
+	}
+
+	// An unchanged key is confirmed with a conditional request
+	if err := revenueAuth.RefreshPublicKey(); err != nil || authority.notModified != 1 {
+		t.Errorf("Expected a 304 refresh, got %d (%v)", authority.notModified, err)
+	}
+
+	// While the authority is down the cached key is still served
+	authority.mu.Lock()
+	authority.down = true
+	authority.mu.Unlock()
+	if err := revenueAuth.RefreshPublicKey(); err == nil {
+		t.Error("Expected the refresh to fail while the authority is down")
+	}
+	if key, err := revenueAuth.GetPublicKey(); err != nil || !bytes.Equal(key, first) {
+		t.Errorf("Expected the cached key during downtime, got %v", err)
+	}
+	if _, lastErr := revenueAuth.PublicKeyStatus(); lastErr == nil {
+		t.Error("Expected the failed refresh to be reported")
+	}
+
+	// Back with a rotated key
+	authority.mu.Lock()
+	authority.down = false
+	authority.mu.Unlock()
+	rotated := authority.setKey(t)
+	if err := revenueAuth.RefreshPublicKey(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if key, _ := revenueAuth.GetPublicKey(); !bytes.Equal(key, rotated) {
+		t.Error("Expected the rotated key after the refresh")
+	}
+	if fetchedAt, lastErr := revenueAuth.PublicKeyStatus(); lastErr != nil || fetchedAt.IsZero() {
+		t.Errorf("Expected a healthy status, got %v at %v", lastErr, fetchedAt)
+	}
+}
+
+func TestAuthorityKeyEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	get := func(router *gin.Engine, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/authority-key", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	newRouter := func(cashReg *cashregister.CashRegister) *gin.Engine {
+		router := gin.New()
+		router.GET("/api/authority-key", handlers.NewCashRegisterHandler(cashReg, &config.Config{}, nil).GetAuthorityKey)
+		return router
+	}
+
+	// Standalone: the mock authority's key
+	router := newRouter(createTestCashRegister(false))
+	w := get(router, "")
+	var response api.AuthorityKeyResponse
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &response) != nil {
+		t.Fatalf("Expected the key, got %d %s", w.Code, w.Body)
+	}
+	der, _ := base64.StdEncoding.DecodeString(response.PublicKey)
+	if _, err := x509.ParsePKIXPublicKey(der); err != nil || response.PublicKeyPEM == "" {
+		t.Errorf("Expected a usable public key, got %v", err)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"`+response.Fingerprint+`"` {
+		t.Errorf("Expected the fingerprint as ETag, got %s", etag)
+	}
+	if w := get(router, w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for a known key, got %d", w.Code)
+	}
+
+	// Online, with the authority unreachable since startup
+	authority := &keyAuthority{down: true}
+	authority.setKey(t)
+	server := httptest.NewServer(authority)
+	defer server.Close()
+	revenueAuth := real.NewRealRevenueAuthority(server.URL, "", false)
+	cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup, revenueAuth, mock.NewMockReceiptBank(false), crypto.NewCryptoService(false), false)
+	router = newRouter(cashReg)
+	if w := get(router, ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before the key was ever fetched, got %d", w.Code)
+	}
+
+	// Fetched once, then the authority goes down: the cached key is served as stale
+	authority.mu.Lock()
+	authority.down = false
+	authority.mu.Unlock()
+	if w := get(router, ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected the key once the authority is back, got %d", w.Code)
+	}
+	authority.mu.Lock()
+	authority.down = true
+	authority.mu.Unlock()
+	revenueAuth.RefreshPublicKey()
+	w = get(router, "")
+	response = api.AuthorityKeyResponse{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusOK || !response.Stale || response.Error == "" || response.FetchedAt == "" {
+		t.Errorf("Expected the cached key marked stale, got %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/resilience"
+	"fake-cash-register/internal/services/real"
+)
+
+// newFailingBank answers every /v1/submit with status and body, counting the attempts
+func newFailingBank(t *testing.T, status int, body any) (*real.RealReceiptBank, *int) {
+	t.Helper()
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+
+	bank := real.NewRealReceiptBank(server.URL, &config.Config{}, false)
+	bank.SetBreaker(resilience.NewBreaker("receipt bank", resilience.Policy{
+		MaxAttempts:      3,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         2 * time.Millisecond,
+		FailureThreshold: 10,
+		OpenTimeout:      time.Minute,
+	}, false))
+	return bank, &attempts
+}
+
+func TestReceiptBankErrorCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     api.ErrorResponse
+		sentinel error
+		attempts int
+	}{
+		{"invalid key", http.StatusBadRequest, api.ErrorResponse{Error: "ephemeral_key must be valid base64", Code: "INVALID_KEY"}, interfaces.ErrBankInvalidKey, 1},
+		{"rate limited", http.StatusTooManyRequests, api.ErrorResponse{Error: "Rate limit exceeded", Code: "RATE_LIMITED"}, interfaces.ErrBankRateLimited, 3},
+		{"storage full", http.StatusInsufficientStorage, api.ErrorResponse{Error: "Receipt storage is full", Code: "STORAGE_FULL"}, interfaces.ErrBankStorageFull, 3},
+		{"webhook unverified", http.StatusUnprocessableEntity, api.ErrorResponse{Error: "webhook receiver did not answer the verification challenge", Code: "WEBHOOK_UNVERIFIED"}, interfaces.ErrBankWebhookUnverified, 1},
+		{"duplicate on first attempt", http.StatusConflict, api.ErrorResponse{Error: "Receipt ID already exists", Code: "DUPLICATE_RECEIPT"}, interfaces.ErrDuplicateReceipt, 1},
+		{"no code, client error", http.StatusBadRequest, api.ErrorResponse{Error: "webhook_url is required"}, nil, 1},
+		{"no code, server error", http.StatusInternalServerError, api.ErrorResponse{Error: "Failed to store receipt"}, nil, 3},
+	}
+
+	for _, tt := range tests {
+		bank, attempts := newFailingBank(t, tt.status, tt.body)
+		err := bank.SubmitReceipt(newTestEphemeralKey(t), []byte("encrypted"))
+
+		var bankErr *real.BankError
+		if !errors.As(err, &bankErr) || bankErr.Status != tt.status || bankErr.Code != tt.body.Code || bankErr.Message != tt.body.Error {
+			t.Errorf("%s: expected a BankError for %d %q, got %v", tt.name, tt.status, tt.body.Code, err)
+		}
+		if tt.sentinel != nil && !errors.Is(err, tt.sentinel) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.sentinel, err)
+		}
+		if *attempts != tt.attempts {
+			t.Errorf("%s: expected %d attempts, got %d", tt.name, tt.attempts, *attempts)
+		}
+	}
+}
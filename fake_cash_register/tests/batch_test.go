@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/resilience"
+	"fake-cash-register/internal/services/real"
+)
+
+// newBatchBank stores batch entries by receipt ID like the receipt bank; the first
+// loseResponses requests are stored but answered with 503, as if the response was lost
+func newBatchBank(t *testing.T, loseResponses int) (*real.RealReceiptBank, *int) {
+	t.Helper()
+
+	stored := map[string]bool{}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/submit/batch" {
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+		requests++
+
+		var req api.ReceiptBatchSubmission
+		json.NewDecoder(r.Body).Decode(&req)
+		resp := api.ReceiptBatchResponse{Summary: api.ReceiptBatchSummary{Total: len(req.Receipts)}}
+		for _, submission := range req.Receipts {
+			result := api.ReceiptBatchResult{ReceiptID: submission.ReceiptID, Status: http.StatusOK}
+			switch {
+			case submission.EphemeralKey == "":
+				result.Status, result.Code, result.Error = http.StatusBadRequest, "INVALID_KEY", "ephemeral_key is required"
+				resp.Summary.Failed++
+			case stored[submission.ReceiptID]:
+				result.Status, result.Code, result.Error = http.StatusConflict, "DUPLICATE_RECEIPT", "Receipt ID already exists"
+				resp.Summary.Duplicate++
+			default:
+				stored[submission.ReceiptID] = true
+				resp.Summary.Stored++
+			}
+			resp.Results = append(resp.Results, result)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if requests <= loseResponses {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(api.ErrorResponse{Error: "Receipt storage temporarily unavailable", Code: "UNAVAILABLE"})
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	bank := real.NewRealReceiptBank(server.URL, &config.Config{}, false)
+	bank.SetBreaker(resilience.NewBreaker("receipt bank", resilience.Policy{
+		MaxAttempts:      3,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         2 * time.Millisecond,
+		FailureThreshold: 10,
+		OpenTimeout:      time.Minute,
+	}, false))
+	return bank, &requests
+}
+
+func TestSubmitBatch(t *testing.T) {
+	bank, _ := newBatchBank(t, 0)
+	key := newTestEphemeralKey(t)
+	submissions := []api.ReceiptSubmission{
+		bank.Submission("r-1", key, []byte("encrypted 1"), nil, nil),
+		bank.Submission("r-2", key, []byte("encrypted 2"), nil, nil),
+		bank.Submission("r-1", key, []byte("encrypted 1"), nil, nil),
+		{ReceiptID: "r-3", EncryptedData: "ZW5jcnlwdGVk"},
+	}
+
+	results, err := bank.SubmitBatch(submissions)
+	if err != nil {
+		t.Fatalf("SubmitBatch: %v", err)
+	}
+	if len(results) != 4 || results[0].Err != nil || results[1].Err != nil {
+		t.Fatalf("Expected the first two receipts to be stored, got %+v", results)
+	}
+	if results[2].Err != nil || !results[2].Duplicate {
+		t.Errorf("Expected a duplicate to count as held by the bank, got %+v", results[2])
+	}
+	if !errors.Is(results[3].Err, interfaces.ErrBankInvalidKey) {
+		t.Errorf("Expected the receipt without a key to be refused, got %v", results[3].Err)
+	}
+
+	if _, err := bank.SubmitBatch(make([]api.ReceiptSubmission, real.MaxBatchSize+1)); err == nil {
+		t.Error("Expected a batch over the bank's limit to be refused")
+	}
+}
+
+func TestSubmitBatchRetry(t *testing.T) {
+	bank, requests := newBatchBank(t, 1)
+	key := newTestEphemeralKey(t)
+	submissions := []api.ReceiptSubmission{
+		bank.Submission("r-1", key, []byte("encrypted 1"), nil, nil),
+		bank.Submission("r-2", key, []byte("encrypted 2"), nil, nil),
+	}
+
+	results, err := bank.SubmitBatch(submissions)
+	if err != nil {
+		t.Fatalf("SubmitBatch: %v", err)
+	}
+	if *requests != 2 {
+		t.Errorf("Expected the batch to be retried once, sent %d times", *requests)
+	}
+	for _, result := range results {
+		if result.Err != nil || !result.Duplicate {
+			t.Errorf("Expected %s, stored by the lost attempt, to count as stored: %+v", result.ReceiptID, result)
+		}
+	}
+
+	// A receipt whose single submission was stored before its answer was lost is a
+	// duplicate on the batch's first attempt, and still held by the bank
+	bank, requests = newBatchBank(t, 0)
+	results, err = bank.SubmitBatch(submissions[:1])
+	if err != nil || results[0].Err != nil || results[0].Duplicate {
+		t.Fatalf("First flush: %+v, %v", results, err)
+	}
+	results, err = bank.SubmitBatch(submissions[:1])
+	if err != nil || *requests != 2 || results[0].Err != nil || !results[0].Duplicate {
+		t.Errorf("Expected the resent receipt to count as held on the first attempt, got %+v, %v", results, err)
+	}
+}
@@ -0,0 +1,725 @@
+package tests
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/models"
+)
+
+// newRandomReceipt builds a receipt whose fields all fit the binary format
+func newRandomReceipt(rng *rand.Rand) *models.Receipt {
+	timestamp := time.Unix(rng.Int63n(4102444800), 0) // 1970..2100
+	receipt := &models.Receipt{
+		ZReportNumber: fmt.Sprintf("Z%04d", rng.Intn(10000)),
+		TransactionID: fmt.Sprintf("TX%s%04d", timestamp.Format("20060102"), rng.Intn(100000)),
+		Timestamp:     timestamp,
+		StoreVKN:      fmt.Sprintf("%010d", rng.Int63n(4294967296)),
+		StoreName:     randomText(rng, 40),
+		StoreAddress:  randomText(rng, 120),
+		TotalAmount:   float64(rng.Intn(10000000)) / 100,
+		PaymentMethod: []string{"Nakit", "Kart", "Kredi Kartı"}[rng.Intn(3)],
+		ReceiptSerial: fmt.Sprintf("F%04d", rng.Intn(100000)),
+	}
+	for i := rng.Intn(20); i > 0; i-- {
+		receipt.Items = append(receipt.Items, models.Item{
+			KisimID:    rng.Intn(65536),
+			Quantity:   rng.Intn(65536),
+			UnitPrice:  float64(rng.Intn(1000000)) / 100,
+			TotalPrice: float64(rng.Intn(10000000)) / 100,
+			TaxRate:    []int{10, 20}[rng.Intn(2)],
+		})
+	}
+	receipt.TaxBreakdown.Tax10Percent.TaxableAmount = float64(rng.Intn(1000000)) / 100
+	receipt.TaxBreakdown.Tax10Percent.TaxAmount = float64(rng.Intn(100000)) / 100
+	receipt.TaxBreakdown.Tax20Percent.TaxableAmount = float64(rng.Intn(1000000)) / 100
+	receipt.TaxBreakdown.Tax20Percent.TaxAmount = float64(rng.Intn(100000)) / 100
+	receipt.TaxBreakdown.TotalTax = float64(rng.Intn(200000)) / 100
+	return receipt
+}
+
+func randomText(rng *rand.Rand, maxRunes int) string {
+	alphabet := []rune("abcçdefgğhıijklmnoöprsştuüvyzABCÇDEFGĞHIİJKLMNOÖPRSŞTUÜVYZ0123456789 /.,-")
+	runes := make([]rune, rng.Intn(maxRunes+1))
+	for i := range runes {
+		runes[i] = alphabet[rng.Intn(len(alphabet))]
+	}
+	return string(runes)
+}
+
+func TestSerializeRoundTripProperty(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 500; i++ {
+		receipt := newRandomReceipt(rng)
+
+		encoded, err := binary.SerializeReceipt(receipt)
+		if err != nil {
+			t.Fatalf("case %d: serialize failed: %v", i, err)
+		}
+
+		decoded, err := binary.DeserializeReceipt(encoded)
+		if err != nil {
+			t.Fatalf("case %d: deserialize failed: %v", i, err)
+		}
+
+		reencoded, err := binary.SerializeReceipt(decoded)
+		if err != nil {
+			t.Fatalf("case %d: re-serialize failed: %v", i, err)
+		}
+		if !bytes.Equal(encoded, reencoded) {
+			t.Fatalf("case %d: round trip changed bytes", i)
+		}
+
+		if decoded.StoreName != receipt.StoreName || decoded.TotalAmount != receipt.TotalAmount || len(decoded.Items) != len(receipt.Items) {
+			t.Fatalf("case %d: decoded receipt differs from original", i)
+		}
+	}
+}
+
+func TestSerializeRoundsKurus(t *testing.T) {
+	receipt := newRandomReceipt(rand.New(rand.NewSource(2)))
+	receipt.TotalAmount = 0.29 // 0.29 * 100 is 28.999999999999996 in float64
+
+	encoded, err := binary.SerializeReceipt(receipt)
+	if err != nil {
+		t.Fatalf("serialize failed: %v", err)
+	}
+	decoded, err := binary.DeserializeReceipt(encoded)
+	if err != nil {
+		t.Fatalf("deserialize failed: %v", err)
+	}
+	if decoded.TotalAmount != 0.29 {
+		t.Errorf("expected total 0.29, got %v", decoded.TotalAmount)
+	}
+}
+
+func TestSerializeRejectsOversizedFields(t *testing.T) {
+	receipt := newRandomReceipt(rand.New(rand.NewSource(3)))
+	receipt.StoreName = string(bytes.Repeat([]byte("a"), binary.MaxStringFieldLength+1))
+
+	if _, err := binary.SerializeReceipt(receipt); err == nil {
+		t.Error("expected error for oversized store name")
+	}
+}
+
+func TestDeserializeRejectsTruncatedData(t *testing.T) {
+	encoded, err := binary.SerializeReceipt(newRandomReceipt(rand.New(rand.NewSource(4))))
+	if err != nil {
+		t.Fatalf("serialize failed: %v", err)
+	}
+
+	for n := 0; n < len(encoded); n++ {
+		if _, err := binary.DeserializeReceipt(encoded[:n]); err == nil {
+			t.Fatalf("expected error for receipt truncated to %d bytes", n)
+		}
+	}
+
+	if _, err := binary.DeserializeReceipt(append(encoded, 0)); !errors.Is(err, binary.ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted for trailing data, got %v", err)
+	}
+}
+
+func TestDeserializeRejectsHugeLengthPrefix(t *testing.T) {
+	// Header + timestamp + z-report + tx + vkn, then a 4 GiB store name length
+	data := []byte{0x54, 0x52, 0x01, 0x00}
+	data = append(data, make([]byte, 20)...)
+	data = append(data, 0xFF, 0xFF, 0xFF, 0xFF)
+
+	_, err := binary.DeserializeReceipt(data)
+	if !errors.Is(err, binary.ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted, got %v", err)
+	}
+}
+
+func TestDeserializeRejectsBadHeader(t *testing.T) {
+	encoded, err := binary.SerializeReceipt(newRandomReceipt(rand.New(rand.NewSource(5))))
+	if err != nil {
+		t.Fatalf("serialize failed: %v", err)
+	}
+
+	badMagic := append([]byte{}, encoded...)
+	badMagic[0] = 0x00
+	if _, err := binary.DeserializeReceipt(badMagic); !errors.Is(err, binary.ErrInvalidFormat) {
+		t.Errorf("expected ErrInvalidFormat for bad magic, got %v", err)
+	}
+
+	badVersion := append([]byte{}, encoded...)
+	badVersion[2] = 0x02
+	if _, err := binary.DeserializeReceipt(badVersion); err == nil {
+		t.Error("expected error for unsupported version")
+	}
+
+	// Every flag bit is taken, so newer additions arrive as extension tags
+	unknownExtension := append(append([]byte{}, encoded...), 0x7f, 0, 0, 0, 0)
+	unknownExtension[3] |= binary.FlagExtensions
+	if _, err := binary.DeserializeReceipt(unknownExtension); !errors.Is(err, binary.ErrInvalidFormat) {
+		t.Errorf("expected ErrInvalidFormat for an unknown extension, got %v", err)
+	}
+}
+
+func TestParseSignedReceiptWithTimestampToken(t *testing.T) {
+	receipt := newRandomReceipt(rand.New(rand.NewSource(6)))
+	encoded, err := binary.SerializeReceiptWithFlags(receipt, binary.FlagTimestampToken)
+	if err != nil {
+		t.Fatalf("serialize failed: %v", err)
+	}
+
+	signature := bytes.Repeat([]byte{0xAA}, binary.SignatureSize)
+	token := bytes.Repeat([]byte{0xBB}, binary.TimestampTokenSize)
+
+	signed, err := binary.CreateSignedReceipt(encoded, signature)
+	if err != nil {
+		t.Fatalf("create signed receipt failed: %v", err)
+	}
+	signed, err = binary.AppendTimestampToken(signed, token)
+	if err != nil {
+		t.Fatalf("append token failed: %v", err)
+	}
+
+	parsed, err := binary.ParseSignedReceipt(signed)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if !bytes.Equal(parsed.Receipt, encoded) || !bytes.Equal(parsed.Signature, signature) || !bytes.Equal(parsed.TimestampToken, token) {
+		t.Error("parsed signed receipt parts do not match")
+	}
+}
+
+func TestSerializeCurrencyExtension(t *testing.T) {
+	receipt := newRandomReceipt(rand.New(rand.NewSource(9)))
+	receipt.Currency = "JPY"
+	receipt.ExchangeRate = 0.225431
+	receipt.ForeignTotal = 1234
+
+	encoded, err := binary.SerializeReceipt(receipt)
+	if err != nil {
+		t.Fatalf("serialize failed: %v", err)
+	}
+	if encoded[3]&binary.FlagCurrency == 0 {
+		t.Fatal("expected currency flag to be set")
+	}
+
+	decoded, err := binary.DeserializeReceipt(encoded)
+	if err != nil {
+		t.Fatalf("deserialize failed: %v", err)
+	}
+	if decoded.Currency != "JPY" || decoded.ExchangeRate != 0.225431 || decoded.ForeignTotal != 1234 {
+		t.Errorf("currency fields differ: %s %v %v", decoded.Currency, decoded.ExchangeRate, decoded.ForeignTotal)
+	}
+
+	withoutCurrency := newRandomReceipt(rand.New(rand.NewSource(9)))
+	if _, err := binary.SerializeReceiptWithFlags(withoutCurrency, binary.FlagCurrency); err == nil {
+		t.Error("expected error for currency flag without currency")
+	}
+
+	receipt.Currency = "eur"
+	if _, err := binary.SerializeReceipt(receipt); err == nil {
+		t.Error("expected error for lower-case currency code")
+	}
+}
+
+func TestSerializeCompressed(t *testing.T) {
+	receipt := newRandomReceipt(rand.New(rand.NewSource(10)))
+	receipt.Items = nil
+	for i := 0; i < 300; i++ {
+		receipt.Items = append(receipt.Items, models.Item{KisimID: 1 + i%8, Quantity: 1, UnitPrice: 12.50, TotalPrice: 12.50, TaxRate: 10})
+	}
+
+	plain, err := binary.SerializeReceipt(receipt)
+	if err != nil {
+		t.Fatalf("serialize failed: %v", err)
+	}
+	compressed, err := binary.SerializeReceiptWithFlags(receipt, binary.FlagCompressed)
+	if err != nil {
+		t.Fatalf("serialize compressed failed: %v", err)
+	}
+	if compressed[3]&binary.FlagCompressed == 0 || len(compressed) >= len(plain)/2 {
+		t.Fatalf("expected a compressed receipt well under %d bytes, got %d bytes with flags 0x%02x", len(plain), len(compressed), compressed[3])
+	}
+
+	decoded, err := binary.DeserializeReceipt(compressed)
+	if err != nil {
+		t.Fatalf("deserialize compressed failed: %v", err)
+	}
+	reencoded, err := binary.SerializeReceipt(decoded)
+	if err != nil {
+		t.Fatalf("re-serialize failed: %v", err)
+	}
+	if !bytes.Equal(reencoded, plain) {
+		t.Error("compressed receipt does not decode to the uncompressed receipt")
+	}
+
+	signed, err := binary.CreateSignedReceipt(compressed, make([]byte, binary.SignatureSize))
+	if err != nil {
+		t.Fatalf("create signed receipt failed: %v", err)
+	}
+	if parsed, err := binary.ParseSignedReceipt(signed); err != nil || !bytes.Equal(parsed.Receipt, compressed) {
+		t.Errorf("expected the signed receipt to keep the compressed bytes, got %v", err)
+	}
+
+	// A receipt that would not shrink is left uncompressed
+	short := newRandomReceipt(rand.New(rand.NewSource(11)))
+	short.StoreName, short.StoreAddress, short.Items = "A", "B", nil
+	encoded, err := binary.SerializeReceiptWithFlags(short, binary.FlagCompressed)
+	if err != nil {
+		t.Fatalf("serialize short receipt failed: %v", err)
+	}
+	if encoded[3]&binary.FlagCompressed != 0 {
+		t.Error("expected the compressed flag to be cleared for a receipt that does not shrink")
+	}
+
+	if _, err := binary.DeserializeReceipt(append(append([]byte{}, compressed...), 0)); !errors.Is(err, binary.ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted for data after the compressed body, got %v", err)
+	}
+	if _, err := binary.DeserializeReceipt(compressed[:len(compressed)-1]); !errors.Is(err, binary.ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted for a truncated compressed body, got %v", err)
+	}
+}
+
+func TestSerializeLeavesOversizedBodyUncompressed(t *testing.T) {
+	receipt := newRandomReceipt(rand.New(rand.NewSource(12)))
+	receipt.Items = nil
+	note := strings.Repeat("n", binary.MaxItemNoteLength)
+	for len(receipt.Items)*(23+1+len(note)) <= binary.MaxDecompressedSize {
+		receipt.Items = append(receipt.Items, models.Item{KisimID: 1, Quantity: 1, UnitPrice: 1, TotalPrice: 1, TaxRate: 10, Note: note})
+	}
+
+	encoded, err := binary.SerializeReceiptVersion(receipt, binary.FormatVersion2, binary.FlagCompressed)
+	if err != nil {
+		t.Fatalf("serialize failed: %v", err)
+	}
+	if encoded[3]&binary.FlagCompressed != 0 {
+		t.Fatal("expected a body above MaxDecompressedSize to stay uncompressed")
+	}
+	if _, err := binary.DeserializeReceipt(encoded); err != nil {
+		t.Errorf("deserialize failed: %v", err)
+	}
+}
+
+func TestDeserializeRejectsCompressionBomb(t *testing.T) {
+	var bomb bytes.Buffer
+	bomb.Write([]byte{0x54, 0x52, binary.FormatVersion1, binary.FlagCompressed})
+	w := zlib.NewWriter(&bomb)
+	w.Write(make([]byte, binary.MaxDecompressedSize+1))
+	w.Close()
+
+	if _, err := binary.DeserializeReceipt(bomb.Bytes()); !errors.Is(err, binary.ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted for a body inflating past the limit, got %v", err)
+	}
+}
+
+func TestSerializeV1FieldLimits(t *testing.T) {
+	receipt := newRandomReceipt(rand.New(rand.NewSource(10)))
+	receipt.Items = []models.Item{{KisimID: 1, Quantity: 65535, UnitPrice: 42949672.95, TotalPrice: 42949672.95, TaxRate: 20}}
+	receipt.TotalAmount = 42949672.95
+
+	encoded, err := binary.SerializeReceipt(receipt)
+	if err != nil {
+		t.Fatalf("serialize at the v1 limits failed: %v", err)
+	}
+	decoded, err := binary.DeserializeReceipt(encoded)
+	if err != nil {
+		t.Fatalf("deserialize failed: %v", err)
+	}
+	if decoded.Items[0].Quantity != 65535 || decoded.TotalAmount != 42949672.95 {
+		t.Errorf("boundary values changed: quantity %d, total %v", decoded.Items[0].Quantity, decoded.TotalAmount)
+	}
+
+	overflows := map[string]func(r *models.Receipt){
+		"quantity":       func(r *models.Receipt) { r.Items[0].Quantity = 65536 },
+		"unit price":     func(r *models.Receipt) { r.Items[0].UnitPrice = 42949672.96 },
+		"total":          func(r *models.Receipt) { r.TotalAmount = 42949672.96 },
+		"total tax":      func(r *models.Receipt) { r.TaxBreakdown.TotalTax = 1e9 },
+		"negative price": func(r *models.Receipt) { r.Items[0].TotalPrice = -1 },
+	}
+	for name, overflow := range overflows {
+		over := *receipt
+		over.Items = append([]models.Item(nil), receipt.Items...)
+		overflow(&over)
+		if _, err := binary.SerializeReceipt(&over); !errors.Is(err, binary.ErrOutOfRange) {
+			t.Errorf("%s: expected ErrOutOfRange, got %v", name, err)
+		}
+		// Every v1 overflow except a negative value fits v2
+		if _, err := binary.SerializeReceiptVersion(&over, binary.FormatVersion2, binary.Reserved); (err == nil) == (name == "negative price") {
+			t.Errorf("%s: unexpected v2 result %v", name, err)
+		}
+	}
+}
+
+func TestSerializeV2WideFields(t *testing.T) {
+	maxAmount := float64(binary.MaxAmountV2Kurus) / 100
+	receipt := newRandomReceipt(rand.New(rand.NewSource(11)))
+	receipt.Items = []models.Item{
+		{KisimID: 1, Quantity: 10_000_000, UnitPrice: 1.25, TotalPrice: 12_500_000, TaxRate: 10},
+		{KisimID: 2, Quantity: 4294967295, UnitPrice: 0.01, TotalPrice: 42949672.95, TaxRate: 20},
+	}
+	receipt.TotalAmount = maxAmount
+	receipt.Currency, receipt.ExchangeRate, receipt.ForeignTotal = "EUR", 36.5, 5_000_000_000
+
+	if _, err := binary.SerializeReceipt(receipt); !errors.Is(err, binary.ErrOutOfRange) {
+		t.Errorf("expected v1 to reject wide fields, got %v", err)
+	}
+	encoded, err := binary.SerializeReceiptVersion(receipt, binary.FormatVersion2, binary.Reserved)
+	if err != nil {
+		t.Fatalf("serialize v2 failed: %v", err)
+	}
+	if encoded[2] != binary.FormatVersion2 {
+		t.Fatalf("expected version byte 2, got %d", encoded[2])
+	}
+
+	decoded, err := binary.DeserializeReceipt(encoded)
+	if err != nil {
+		t.Fatalf("deserialize v2 failed: %v", err)
+	}
+	if decoded.TotalAmount != maxAmount || decoded.Items[1].Quantity != 4294967295 || decoded.ForeignTotal != 5_000_000_000 {
+		t.Errorf("wide values changed: total %v, quantity %d, foreign %v", decoded.TotalAmount, decoded.Items[1].Quantity, decoded.ForeignTotal)
+	}
+	reencoded, err := binary.SerializeReceiptVersion(decoded, binary.FormatVersion2, encoded[3])
+	if err != nil || !bytes.Equal(encoded, reencoded) {
+		t.Errorf("v2 round trip changed bytes (err %v)", err)
+	}
+
+	receipt.TotalAmount = maxAmount + 0.01
+	if _, err := binary.SerializeReceiptVersion(receipt, binary.FormatVersion2, binary.Reserved); !errors.Is(err, binary.ErrOutOfRange) {
+		t.Errorf("expected ErrOutOfRange above 2^53 kuruş, got %v", err)
+	}
+	if _, err := binary.SerializeReceiptVersion(receipt, 3, binary.Reserved); err == nil {
+		t.Error("expected error for unsupported version 3")
+	}
+}
+
+func TestSerializeWeighedItems(t *testing.T) {
+	receipt := newRandomReceipt(rand.New(rand.NewSource(13)))
+	receipt.Items = []models.Item{
+		{KisimID: 4, Quantity: 1234, UnitPrice: 50, TotalPrice: 61.70, TaxRate: 10, Weighed: true},
+		{KisimID: 1, Quantity: 2, UnitPrice: 5.5, TotalPrice: 11, TaxRate: 20},
+	}
+
+	if _, err := binary.SerializeReceipt(receipt); !errors.Is(err, binary.ErrOutOfRange) {
+		t.Errorf("expected v1 to reject weighed items, got %v", err)
+	}
+	encoded, err := binary.SerializeReceiptVersion(receipt, binary.FormatVersion2, binary.Reserved)
+	if err != nil {
+		t.Fatalf("serialize failed: %v", err)
+	}
+	if encoded[3]&binary.FlagWeighedItems == 0 {
+		t.Fatal("expected weighed items flag to be set")
+	}
+
+	decoded, err := binary.DeserializeReceipt(encoded)
+	if err != nil {
+		t.Fatalf("deserialize failed: %v", err)
+	}
+	if !decoded.Items[0].Weighed || decoded.Items[0].Quantity != 1234 || decoded.Items[1].Weighed {
+		t.Errorf("item units changed: %+v", decoded.Items)
+	}
+	reencoded, err := binary.SerializeReceiptVersion(decoded, binary.FormatVersion2, encoded[3])
+	if err != nil || !bytes.Equal(encoded, reencoded) {
+		t.Errorf("weighed round trip changed bytes (err %v)", err)
+	}
+
+	// Flipping the flag on a v1 receipt must not shift the item layout unnoticed
+	v1 := newRandomReceipt(rand.New(rand.NewSource(13)))
+	if _, err := binary.SerializeReceiptWithFlags(v1, binary.FlagWeighedItems); err == nil {
+		t.Error("expected error for weighed items flag without weighed items")
+	}
+	plain, err := binary.SerializeReceipt(v1)
+	if err != nil {
+		t.Fatalf("serialize v1 failed: %v", err)
+	}
+	plain[3] |= binary.FlagWeighedItems
+	if _, err := binary.DeserializeReceipt(plain); !errors.Is(err, binary.ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted for weighed items flag on v1, got %v", err)
+	}
+}
+
+func TestSerializeItemNotes(t *testing.T) {
+	receipt := newRandomReceipt(rand.New(rand.NewSource(17)))
+	receipt.Items = []models.Item{
+		{KisimID: 1, Quantity: 2, UnitPrice: 45, TotalPrice: 90, TaxRate: 10, Note: "şekersiz"},
+		{KisimID: 4, Quantity: 1234, UnitPrice: 50, TotalPrice: 61.70, TaxRate: 10, Weighed: true},
+		{KisimID: 5, Quantity: 1, UnitPrice: 8999, TotalPrice: 8999, TaxRate: 20, Note: "SN 4C1-88213"},
+	}
+
+	if _, err := binary.SerializeReceipt(receipt); !errors.Is(err, binary.ErrOutOfRange) {
+		t.Errorf("expected v1 to reject item notes, got %v", err)
+	}
+	encoded, err := binary.SerializeReceiptVersion(receipt, binary.FormatVersion2, binary.Reserved)
+	if err != nil {
+		t.Fatalf("serialize failed: %v", err)
+	}
+	if encoded[3]&binary.FlagItemNotes == 0 || encoded[3]&binary.FlagWeighedItems == 0 {
+		t.Fatalf("expected item notes and weighed items flags, got 0x%02x", encoded[3])
+	}
+
+	decoded, err := binary.DeserializeReceipt(encoded)
+	if err != nil {
+		t.Fatalf("deserialize failed: %v", err)
+	}
+	for i, item := range decoded.Items {
+		if item.Note != receipt.Items[i].Note || item.Weighed != receipt.Items[i].Weighed {
+			t.Errorf("item %d changed: %+v", i, item)
+		}
+	}
+	reencoded, err := binary.SerializeReceiptVersion(decoded, binary.FormatVersion2, encoded[3])
+	if err != nil || !bytes.Equal(encoded, reencoded) {
+		t.Errorf("item notes round trip changed bytes (err %v)", err)
+	}
+
+	receipt.Items[0].Note = string(bytes.Repeat([]byte("x"), binary.MaxItemNoteLength+1))
+	if _, err := binary.SerializeReceiptVersion(receipt, binary.FormatVersion2, binary.Reserved); !errors.Is(err, binary.ErrOutOfRange) {
+		t.Errorf("expected ErrOutOfRange for an oversized note, got %v", err)
+	}
+
+	// The flag needs a note, and no note may run past the data
+	plain := newRandomReceipt(rand.New(rand.NewSource(17)))
+	if _, err := binary.SerializeReceiptVersion(plain, binary.FormatVersion2, binary.FlagItemNotes); err == nil {
+		t.Error("expected error for item notes flag without notes")
+	}
+	for _, cut := range []int{1, 50} {
+		if _, err := binary.DeserializeReceipt(encoded[:len(encoded)-cut]); err == nil {
+			t.Errorf("expected error for a receipt cut %d bytes short", cut)
+		}
+	}
+}
+
+func TestSerializeCustomer(t *testing.T) {
+	receipt := newRandomReceipt(rand.New(rand.NewSource(23)))
+	receipt.Currency, receipt.ExchangeRate, receipt.ForeignTotal = "EUR", 35.5, 12.34
+	receipt.Customer = &models.Customer{TaxNumber: "0010000004", Name: "ACME BİLİŞİM LTD. ŞTİ."}
+	if _, err := binary.SerializeReceipt(receipt); err == nil {
+		t.Fatal("expected an error for a tax number failing its check digit")
+	}
+
+	// Both versions carry the extension; a leading zero survives the round trip
+	receipt.Customer.TaxNumber = "0010000009"
+	for _, version := range []uint8{binary.FormatVersion1, binary.FormatVersion2} {
+		encoded, err := binary.SerializeReceiptVersion(receipt, version, binary.Reserved)
+		if err != nil {
+			t.Fatalf("v%d: serialize failed: %v", version, err)
+		}
+		if encoded[3]&binary.FlagCustomer == 0 || encoded[3]&binary.FlagCurrency == 0 {
+			t.Fatalf("v%d: expected customer and currency flags, got 0x%02x", version, encoded[3])
+		}
+		decoded, err := binary.DeserializeReceipt(encoded)
+		if err != nil {
+			t.Fatalf("v%d: deserialize failed: %v", version, err)
+		}
+		if decoded.Customer == nil || *decoded.Customer != *receipt.Customer || decoded.Currency != "EUR" {
+			t.Errorf("v%d: customer changed: %+v", version, decoded.Customer)
+		}
+		reencoded, err := binary.SerializeReceiptVersion(decoded, version, encoded[3])
+		if err != nil || !bytes.Equal(encoded, reencoded) {
+			t.Errorf("v%d: customer round trip changed bytes (err %v)", version, err)
+		}
+
+		// A flipped digit breaks the check digit and the receipt is corrupted
+		tampered := append([]byte{}, encoded...)
+		at := bytes.Index(tampered, []byte(receipt.Customer.TaxNumber))
+		tampered[at+9] = '8'
+		if _, err := binary.DeserializeReceipt(tampered); !errors.Is(err, binary.ErrCorrupted) {
+			t.Errorf("v%d: expected ErrCorrupted for a bad tax number, got %v", version, err)
+		}
+	}
+
+	plain := newRandomReceipt(rand.New(rand.NewSource(23)))
+	if _, err := binary.SerializeReceiptWithFlags(plain, binary.FlagCustomer); err == nil {
+		t.Error("expected error for customer flag without customer")
+	}
+}
+
+func TestSerializeRefund(t *testing.T) {
+	receipt := newRandomReceipt(rand.New(rand.NewSource(29)))
+	receipt.Customer = &models.Customer{TaxNumber: "0010000009", Name: "ACME BİLİŞİM LTD. ŞTİ."}
+	receipt.RefundOf = &models.ReceiptRef{
+		TransactionID: "TX202610150042",
+		ReceiptSerial: "F0041",
+		Timestamp:     time.Date(2026, 10, 15, 9, 30, 0, 0, time.Local),
+	}
+
+	for _, version := range []uint8{binary.FormatVersion1, binary.FormatVersion2} {
+		encoded, err := binary.SerializeReceiptVersion(receipt, version, binary.Reserved)
+		if err != nil {
+			t.Fatalf("v%d: serialize failed: %v", version, err)
+		}
+		if encoded[3]&binary.FlagRefund == 0 || encoded[3]&binary.FlagCustomer == 0 {
+			t.Fatalf("v%d: expected refund and customer flags, got 0x%02x", version, encoded[3])
+		}
+		decoded, err := binary.DeserializeReceipt(encoded)
+		if err != nil {
+			t.Fatalf("v%d: deserialize failed: %v", version, err)
+		}
+		if !decoded.IsRefund() || decoded.RefundOf.TransactionID != receipt.RefundOf.TransactionID ||
+			decoded.RefundOf.ReceiptSerial != "F0041" || !decoded.RefundOf.Timestamp.Equal(receipt.RefundOf.Timestamp) {
+			t.Errorf("v%d: refunded sale changed: %+v", version, decoded.RefundOf)
+		}
+		reencoded, err := binary.SerializeReceiptVersion(decoded, version, encoded[3])
+		if err != nil || !bytes.Equal(encoded, reencoded) {
+			t.Errorf("v%d: refund round trip changed bytes (err %v)", version, err)
+		}
+	}
+
+	receipt.RefundOf.ReceiptSerial = "41"
+	if _, err := binary.SerializeReceipt(receipt); err == nil {
+		t.Error("expected an error for an unparseable original serial")
+	}
+	plain := newRandomReceipt(rand.New(rand.NewSource(29)))
+	if _, err := binary.SerializeReceiptWithFlags(plain, binary.FlagRefund); err == nil {
+		t.Error("expected error for refund flag without a refunded sale")
+	}
+}
+
+func TestSerializeSurcharges(t *testing.T) {
+	receipt := newRandomReceipt(rand.New(rand.NewSource(31)))
+	receipt.Surcharges = []models.Surcharge{
+		{Name: "Kart komisyonu", Amount: 0.41, TaxRate: 20},
+		{Name: "Teslimat", Amount: 15, TaxRate: 20},
+	}
+
+	for _, version := range []uint8{binary.FormatVersion1, binary.FormatVersion2} {
+		encoded, err := binary.SerializeReceiptVersion(receipt, version, binary.Reserved)
+		if err != nil {
+			t.Fatalf("v%d: serialize failed: %v", version, err)
+		}
+		if encoded[3]&binary.FlagExtensions == 0 {
+			t.Fatalf("v%d: expected the extensions flag, got 0x%02x", version, encoded[3])
+		}
+		decoded, err := binary.DeserializeReceipt(encoded)
+		if err != nil {
+			t.Fatalf("v%d: deserialize failed: %v", version, err)
+		}
+		if len(decoded.Surcharges) != 2 || decoded.Surcharges[0] != receipt.Surcharges[0] || decoded.Surcharges[1] != receipt.Surcharges[1] {
+			t.Errorf("v%d: surcharges changed: %+v", version, decoded.Surcharges)
+		}
+		reencoded, err := binary.SerializeReceiptVersion(decoded, version, encoded[3])
+		if err != nil || !bytes.Equal(encoded, reencoded) {
+			t.Errorf("v%d: surcharge round trip changed bytes (err %v)", version, err)
+		}
+	}
+
+	receipt.Surcharges[0].Name = ""
+	if _, err := binary.SerializeReceipt(receipt); err == nil {
+		t.Error("expected an error for a surcharge without a name")
+	}
+	plain := newRandomReceipt(rand.New(rand.NewSource(31)))
+	if _, err := binary.SerializeReceiptWithFlags(plain, binary.FlagExtensions); err == nil {
+		t.Error("expected error for extensions flag without surcharges")
+	}
+}
+
+func TestDeserializeV2RejectsInexactAmount(t *testing.T) {
+	receipt := newRandomReceipt(rand.New(rand.NewSource(12)))
+	receipt.StoreName, receipt.StoreAddress = "", ""
+	encoded, err := binary.SerializeReceiptVersion(receipt, binary.FormatVersion2, binary.Reserved)
+	if err != nil {
+		t.Fatalf("serialize v2 failed: %v", err)
+	}
+
+	// With empty store strings the uint64 total starts at offset 32
+	copy(encoded[32:40], []byte{0x00, 0x20, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}) // 2^53 + 1
+	if _, err := binary.DeserializeReceipt(encoded); !errors.Is(err, binary.ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted for a total above 2^53 kuruş, got %v", err)
+	}
+}
+
+func FuzzDeserializeReceipt(f *testing.F) {
+	rng := rand.New(rand.NewSource(7))
+	for i := 0; i < 5; i++ {
+		encoded, err := binary.SerializeReceipt(newRandomReceipt(rng))
+		if err != nil {
+			f.Fatalf("serialize seed failed: %v", err)
+		}
+		f.Add(encoded)
+	}
+	withCurrency := newRandomReceipt(rng)
+	withCurrency.Currency, withCurrency.ExchangeRate, withCurrency.ForeignTotal = "EUR", 36.5, 12.34
+	encoded, err := binary.SerializeReceipt(withCurrency)
+	if err != nil {
+		f.Fatalf("serialize seed failed: %v", err)
+	}
+	f.Add(encoded)
+	encoded, err = binary.SerializeReceiptVersion(withCurrency, binary.FormatVersion2, binary.Reserved)
+	if err != nil {
+		f.Fatalf("serialize v2 seed failed: %v", err)
+	}
+	f.Add(encoded)
+	withItems := newRandomReceipt(rng)
+	for i := 0; i < 50; i++ {
+		withItems.Items = append(withItems.Items, models.Item{KisimID: 1, Quantity: 1, UnitPrice: 5, TotalPrice: 5, TaxRate: 10})
+	}
+	encoded, err = binary.SerializeReceiptWithFlags(withItems, binary.FlagCompressed)
+	if err != nil {
+		f.Fatalf("serialize compressed seed failed: %v", err)
+	}
+	f.Add(encoded)
+	withWeighed := newRandomReceipt(rng)
+	withWeighed.Items = append(withWeighed.Items, models.Item{KisimID: 4, Quantity: 750, UnitPrice: 120, TotalPrice: 90, TaxRate: 10, Weighed: true})
+	encoded, err = binary.SerializeReceiptVersion(withWeighed, binary.FormatVersion2, binary.Reserved)
+	if err != nil {
+		f.Fatalf("serialize weighed seed failed: %v", err)
+	}
+	f.Add(encoded)
+	withSurcharges := newRandomReceipt(rng)
+	withSurcharges.Surcharges = []models.Surcharge{{Name: "Kart komisyonu", Amount: 1.25, TaxRate: 20}}
+	encoded, err = binary.SerializeReceipt(withSurcharges)
+	if err != nil {
+		f.Fatalf("serialize surcharge seed failed: %v", err)
+	}
+	f.Add(encoded)
+	f.Add([]byte{0x54, 0x52, 0x01, 0x00})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		receipt, err := binary.DeserializeReceipt(data)
+		if err != nil {
+			return
+		}
+
+		// Anything that decodes must re-encode to the exact same bytes
+		reencoded, err := binary.SerializeReceiptVersion(receipt, data[2], data[3]&^binary.FlagCompressed)
+		if err != nil {
+			t.Fatalf("decoded receipt failed to serialize: %v", err)
+		}
+		if data[3]&binary.FlagCompressed != 0 {
+			// Other compressors write other valid streams, so only the content must survive
+			again, err := binary.DeserializeReceipt(reencoded)
+			if err != nil || !reflect.DeepEqual(again, receipt) {
+				t.Fatalf("compressed receipt changed when re-encoded uncompressed: %v", err)
+			}
+			return
+		}
+		if !bytes.Equal(data, reencoded) {
+			t.Fatalf("round trip mismatch:\n in: %x\nout: %x", data, reencoded)
+		}
+	})
+}
+
+func FuzzParseSignedReceipt(f *testing.F) {
+	encoded, err := binary.SerializeReceipt(newRandomReceipt(rand.New(rand.NewSource(8))))
+	if err != nil {
+		f.Fatalf("serialize seed failed: %v", err)
+	}
+	signed, err := binary.CreateSignedReceipt(encoded, make([]byte, binary.SignatureSize))
+	if err != nil {
+		f.Fatalf("sign seed failed: %v", err)
+	}
+	f.Add(signed)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parsed, err := binary.ParseSignedReceipt(data)
+		if err != nil {
+			return
+		}
+		if len(parsed.Signature) != binary.SignatureSize {
+			t.Fatalf("signature has %d bytes", len(parsed.Signature))
+		}
+	})
+}
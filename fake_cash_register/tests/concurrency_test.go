@@ -0,0 +1,247 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/faults"
+	"fake-cash-register/internal/handlers"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/services/mock"
+	"fake-cash-register/internal/zreport"
+
+	"github.com/gin-gonic/gin"
+)
+
+// blockingAuthority holds every signing request until release is closed
+type blockingAuthority struct {
+	*mock.MockRevenueAuthority
+	signing chan struct{}
+	release chan struct{}
+}
+
+func (a *blockingAuthority) SignHash(hash []byte) ([]byte, error) {
+	a.signing <- struct{}{}
+	<-a.release
+	return a.MockRevenueAuthority.SignHash(hash)
+}
+
+func newBlockingCashRegister() (*cashregister.CashRegister, *blockingAuthority) {
+	authority := &blockingAuthority{
+		MockRevenueAuthority: mock.NewMockRevenueAuthority(false),
+		signing:              make(chan struct{}, 1),
+		release:              make(chan struct{}),
+	}
+	cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup, authority,
+		mock.NewMockReceiptBank(false), crypto.NewCryptoService(false), false)
+	return cashReg, authority
+}
+
+// Run with -race: concurrent requests must neither corrupt the sale nor race on it
+func TestConcurrentSaleOperations(t *testing.T) {
+	cashReg := createTestCashRegister(false)
+	if err := cashReg.StartNewReceipt(); err != nil {
+		t.Fatalf("Failed to start receipt: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	added, busy := 0, 0
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			err := cashReg.AddItem(1, 1, 0)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				added++
+			case errors.Is(err, cashregister.ErrBusy):
+				busy++
+			default:
+				t.Errorf("Unexpected AddItem error: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if receipt := cashReg.CurrentReceipt(); receipt != nil {
+				_ = len(receipt.Items)
+			}
+			cashReg.StockWarnings()
+		}()
+	}
+	wg.Wait()
+
+	items := cashReg.CurrentReceipt().Items
+	if added+busy != 50 || len(items) != 1 || items[0].Quantity != added {
+		t.Errorf("Expected %d added units on one line (%d refused as busy), got %+v", added, busy, items)
+	}
+}
+
+func TestBusyWhileIssuing(t *testing.T) {
+	cashReg, authority := newBlockingCashRegister()
+	if err := cashReg.StartNewReceipt(); err != nil {
+		t.Fatalf("Failed to start receipt: %v", err)
+	}
+	cashReg.AddItem(1, 1, 0)
+	cashReg.SetPaymentMethod("Nakit")
+
+	issued := make(chan error)
+	go func() {
+		_, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+		issued <- err
+	}()
+	<-authority.signing
+
+	if err := cashReg.AddItem(2, 1, 0); !errors.Is(err, cashregister.ErrBusy) {
+		t.Errorf("Expected AddItem during issuing to fail with ErrBusy, got %v", err)
+	}
+	if err := cashReg.CancelCurrentReceipt(); !errors.Is(err, cashregister.ErrBusy) {
+		t.Errorf("Expected cancelling during issuing to fail with ErrBusy, got %v", err)
+	}
+	if _, err := cashReg.CloseZReport(); !errors.Is(err, zreport.ErrSaleInProgress) {
+		t.Errorf("Expected a Z-report close during issuing to wait for the sale, got %v", err)
+	}
+
+	close(authority.release)
+	if err := <-issued; err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+	if cashReg.HasActiveReceipt() {
+		t.Error("Expected the issued sale to be closed")
+	}
+	if _, err := cashReg.CloseZReport(); err != nil {
+		t.Errorf("Expected the Z-report to close once the sale completed: %v", err)
+	}
+}
+
+func TestSaleReadableWhileIssuing(t *testing.T) {
+	cashReg, authority := newBlockingCashRegister()
+	if err := cashReg.StartNewReceipt(); err != nil {
+		t.Fatalf("Failed to start receipt: %v", err)
+	}
+	cashReg.AddItem(1, 1, 0)
+	cashReg.SetPaymentMethod("Nakit")
+
+	issued := make(chan error)
+	go func() {
+		_, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+		issued <- err
+	}()
+	<-authority.signing
+
+	// The open sale can be read while the authority answers
+	read := make(chan struct{}, 1)
+	go func() {
+		if !cashReg.HasActiveReceipt() {
+			t.Error("Expected the sale to stay open while issuing")
+		}
+		if receipt := cashReg.CurrentReceipt(); receipt == nil || receipt.ReceiptSerial != "" {
+			t.Errorf("Expected the open, unfinalized sale while issuing, got %+v", receipt)
+		}
+		if _, err := cashReg.PreviewReceipt(); err != nil {
+			t.Errorf("Failed to preview while issuing: %v", err)
+		}
+		if serial := cashReg.NextSerial(); serial != "F0001" {
+			t.Errorf("Expected F0001 while issuing, got %s", serial)
+		}
+		read <- struct{}{}
+	}()
+	select {
+	case <-read:
+	case <-time.After(time.Second):
+		t.Fatal("Sale reads blocked by the authority call")
+	}
+
+	close(authority.release)
+	if err := <-issued; err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+	if serial := cashReg.NextSerial(); serial != "F0002" {
+		t.Errorf("Expected F0002 after issuing, got %s", serial)
+	}
+}
+
+func TestFailedIssuanceKeepsSerial(t *testing.T) {
+	bank := mock.NewMockReceiptBank(false)
+	injector := faults.NewInjector(1, false)
+	bank.SetFaults(injector)
+	cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup, mock.NewMockRevenueAuthority(false),
+		bank, crypto.NewCryptoService(false), false)
+
+	sell := func() (*models.Receipt, error) {
+		if err := cashReg.StartNewReceipt(); err != nil {
+			t.Fatalf("Failed to start receipt: %v", err)
+		}
+		cashReg.AddItem(1, 1, 0)
+		cashReg.SetPaymentMethod("Nakit")
+		return cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	}
+
+	injector.Trigger(faults.ServiceReceiptBank, faults.FailureConflict, 1)
+	if _, err := sell(); err == nil {
+		t.Fatal("Expected the submission to fail")
+	}
+	if serial := cashReg.NextSerial(); serial != "F0001" {
+		t.Errorf("Expected a failed issuance to leave F0001, got %s", serial)
+	}
+
+	receipt, err := sell()
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+	if receipt.ReceiptSerial != "F0001" {
+		t.Errorf("Expected the issued receipt to get F0001, got %s", receipt.ReceiptSerial)
+	}
+}
+
+func TestConflictResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cashReg, authority := newBlockingCashRegister()
+	handler := handlers.NewCashRegisterHandler(cashReg, &config.Config{}, nil)
+	router := gin.New()
+	router.POST("/api/transaction/add-item", handler.AddItem)
+	router.POST("/api/transaction/payment", handler.SetPaymentMethod)
+	router.POST("/api/transaction/issue_receipt", handler.IssueReceipt)
+
+	send := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		return w
+	}
+
+	send("/api/transaction/add-item", `{"kisim_id":1,"quantity":1}`)
+	send("/api/transaction/payment", `{"payment_method":"Nakit"}`)
+
+	key := newTestEphemeralKey(t)
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		body, _ := json.Marshal(map[string][]byte{"ephemeral_key": key})
+		done <- send("/api/transaction/issue_receipt", string(body))
+	}()
+	<-authority.signing
+
+	w := send("/api/transaction/add-item", `{"kisim_id":2,"quantity":1}`)
+	var apiErr api.APIError
+	json.Unmarshal(w.Body.Bytes(), &apiErr)
+	if w.Code != http.StatusConflict || apiErr.Code != api.ErrorCodeConflict {
+		t.Errorf("Expected 409 %s while issuing, got %d %s", api.ErrorCodeConflict, w.Code, w.Body)
+	}
+
+	close(authority.release)
+	if w := <-done; w.Code != http.StatusOK {
+		t.Errorf("Expected the first request to issue the receipt, got %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	rwcrypto "receiptwallet/crypto"
+
+	"fake-cash-register/internal/crypto"
+)
+
+// TestEncryptionDecryptsWithSharedLibrary checks the register's envelopes open with the wallet-side Decrypt
+func TestEncryptionDecryptsWithSharedLibrary(t *testing.T) {
+	walletKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate wallet key: %v", err)
+	}
+	compressed, err := rwcrypto.CompressKey(&walletKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to compress wallet key: %v", err)
+	}
+
+	cryptoService := crypto.NewCryptoService(false)
+	signedReceipt := []byte("binary receipt || signature")
+
+	envelope, err := cryptoService.EncryptWithUserEphemeralKey(signedReceipt, compressed)
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+
+	decrypted, err := rwcrypto.Decrypt(envelope, walletKey)
+	if err != nil {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+	if !bytes.Equal(decrypted, signedReceipt) {
+		t.Error("Decrypted receipt differs from original")
+	}
+
+	if err := cryptoService.ValidateUserEphemeralKey(compressed[:32]); err == nil {
+		t.Error("Expected error for truncated ephemeral key")
+	}
+}
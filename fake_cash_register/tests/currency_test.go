@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"testing"
+
+	"fake-cash-register/internal/currency"
+)
+
+func newTestConverter(t *testing.T, rounding string) *currency.Converter {
+	t.Helper()
+
+	converter, err := currency.NewConverter("TRY", rounding, []currency.Currency{
+		{Code: "EUR", Symbol: "€", Rate: 36.50},
+		{Code: "JPY", Symbol: "¥", Rate: 0.2254},
+	}, false)
+	if err != nil {
+		t.Fatalf("Failed to create converter: %v", err)
+	}
+	return converter
+}
+
+func TestCurrencyRounding(t *testing.T) {
+	tests := []struct {
+		rounding string
+		amount   float64
+		code     string
+		expected float64
+	}{
+		{currency.RoundHalfUp, 1.005, "EUR", 1.01},
+		{currency.RoundHalfUp, 1.125, "EUR", 1.13},
+		{currency.RoundHalfEven, 1.125, "EUR", 1.12},
+		{currency.RoundDown, 1.159, "EUR", 1.15},
+		{currency.RoundDown, 1.15, "EUR", 1.15},
+		{currency.RoundHalfUp, 120.5, "JPY", 121},
+	}
+
+	for _, tt := range tests {
+		converter := newTestConverter(t, tt.rounding)
+		if got := converter.Round(tt.amount, tt.code); got != tt.expected {
+			t.Errorf("%s %v %s: expected %v, got %v", tt.rounding, tt.amount, tt.code, tt.expected, got)
+		}
+	}
+}
+
+func TestCurrencyQuoteAndRates(t *testing.T) {
+	converter := newTestConverter(t, "")
+
+	quote, err := converter.Quote(100, "eur")
+	if err != nil {
+		t.Fatalf("Quote failed: %v", err)
+	}
+	if quote.Code != "EUR" || quote.Rate != 36.50 || quote.Amount != 2.74 {
+		t.Errorf("Unexpected quote: %+v", quote)
+	}
+
+	if err := converter.SetRates(map[string]float64{"EUR": 40}); err != nil {
+		t.Fatalf("SetRates failed: %v", err)
+	}
+	if quote, _ := converter.Quote(100, "EUR"); quote.Amount != 2.5 {
+		t.Errorf("Expected 2.5 EUR after rate update, got %v", quote.Amount)
+	}
+
+	if err := converter.SetRates(map[string]float64{"GBP": 42}); err == nil {
+		t.Error("Expected error for currency that is not accepted")
+	}
+	if err := converter.SetRates(map[string]float64{"EUR": -1}); err == nil {
+		t.Error("Expected error for negative rate")
+	}
+	// A bad entry leaves every rate as it was, including the valid ones next to it
+	if err := converter.SetRates(map[string]float64{"EUR": 50, "JPY": 0}); err == nil {
+		t.Error("Expected error for a zero rate")
+	}
+	if quote, _ := converter.Quote(100, "EUR"); quote.Amount != 2.5 {
+		t.Errorf("Expected the EUR rate unchanged after a rejected update, got %v EUR", quote.Amount)
+	}
+	if _, err := converter.Quote(100, "GBP"); err == nil {
+		t.Error("Expected error quoting a currency that is not accepted")
+	}
+
+	if got := converter.Format(2.5, "EUR"); got != "€2.50" {
+		t.Errorf("Expected €2.50, got %s", got)
+	}
+	if got := converter.Format(12.5, "TRY"); got != "₺12,50" {
+		t.Errorf("Expected ₺12,50, got %s", got)
+	}
+}
+
+func TestForeignCurrencySale(t *testing.T) {
+	cashReg := createTestCashRegister(false)
+	converter := newTestConverter(t, "")
+	cashReg.SetCurrencyConverter(converter)
+
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItem(1, 2, 0); err != nil { // 2 x 10.50
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if err := cashReg.SetCurrency("USD"); err == nil {
+		t.Error("Expected error for currency that is not accepted")
+	}
+	if err := cashReg.SetCurrency("EUR"); err != nil {
+		t.Fatalf("Failed to set currency: %v", err)
+	}
+	if err := cashReg.SetPaymentMethod("Nakit"); err != nil {
+		t.Fatalf("Failed to set payment method: %v", err)
+	}
+
+	// Rate changes before issuing apply to the sale
+	if err := converter.SetRates(map[string]float64{"EUR": 35}); err != nil {
+		t.Fatalf("SetRates failed: %v", err)
+	}
+
+	receipt, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+	if receipt.Currency != "EUR" || receipt.ExchangeRate != 35 || receipt.ForeignTotal != 0.6 {
+		t.Errorf("Unexpected currency fields: %s %v %v", receipt.Currency, receipt.ExchangeRate, receipt.ForeignTotal)
+	}
+	if receipt.TotalAmount != 21 {
+		t.Errorf("Expected lira total 21, got %v", receipt.TotalAmount)
+	}
+}
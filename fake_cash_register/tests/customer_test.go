@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+
+	rwcrypto "receiptwallet/crypto"
+
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/customer"
+	"fake-cash-register/internal/services/mock"
+)
+
+func TestVirtualCustomerEndToEnd(t *testing.T) {
+	revenueAuth := mock.NewMockRevenueAuthority(false)
+	receiptBank := mock.NewMockReceiptBank(false)
+	cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup, revenueAuth, receiptBank, crypto.NewCryptoService(false), false)
+	vc := customer.NewVirtualCustomer(receiptBank, revenueAuth, false)
+
+	wallet, err := vc.NewWallet()
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	if len(wallet.PublicKey) != 33 {
+		t.Fatalf("Expected 33-byte compressed key, got %d bytes", len(wallet.PublicKey))
+	}
+
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItem(1, 2, 0); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if err := cashReg.SetPaymentMethod("Nakit"); err != nil {
+		t.Fatalf("Failed to set payment method: %v", err)
+	}
+	issued, err := cashReg.IssueCurrentReceipt(wallet.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+
+	result, err := vc.Collect(wallet)
+	if err != nil {
+		t.Fatalf("Virtual customer failed to collect: %v", err)
+	}
+	if result.Receipt.ReceiptSerial != issued.ReceiptSerial {
+		t.Errorf("Expected serial %s, got %s", issued.ReceiptSerial, result.Receipt.ReceiptSerial)
+	}
+	if result.Receipt.TotalAmount != issued.TotalAmount {
+		t.Errorf("Expected total %.2f, got %.2f", issued.TotalAmount, result.Receipt.TotalAmount)
+	}
+	if result.EncryptedSize <= result.SignedSize {
+		t.Errorf("Expected envelope (%d bytes) larger than signed receipt (%d bytes)", result.EncryptedSize, result.SignedSize)
+	}
+
+	// Item names are not in the binary format, so the text falls back to the kisim number
+	if text := result.Receipt.FormatForDisplay(newTestBundle(t, nil).Localizer("tr"), nil); !strings.Contains(text, "KISIM 1") {
+		t.Errorf("Expected kisim fallback in receipt text:\n%s", text)
+	}
+
+	// The bank hands a receipt out once
+	if _, err := vc.Collect(wallet); !errors.Is(err, mock.ErrReceiptNotFound) {
+		t.Errorf("Expected ErrReceiptNotFound on second collection, got %v", err)
+	}
+}
+
+func TestVirtualCustomerRejectsForeignSignature(t *testing.T) {
+	receiptBank := mock.NewMockReceiptBank(false)
+	cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup, mock.NewMockRevenueAuthority(false), receiptBank, crypto.NewCryptoService(false), false)
+
+	// Verifying against a different authority key must fail
+	vc := customer.NewVirtualCustomer(receiptBank, mock.NewMockRevenueAuthority(false), false)
+	wallet, err := vc.NewWallet()
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItem(2, 1, 0); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if err := cashReg.SetPaymentMethod("Kart"); err != nil {
+		t.Fatalf("Failed to set payment method: %v", err)
+	}
+	if _, err := cashReg.IssueCurrentReceipt(wallet.PublicKey); err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+
+	if _, err := vc.Collect(wallet); !errors.Is(err, customer.ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestVirtualCustomerVerifiesDeviceSignature(t *testing.T) {
+	revenueAuth := mock.NewMockRevenueAuthority(false)
+	receiptBank := mock.NewMockReceiptBank(false)
+	cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup, revenueAuth, receiptBank, crypto.NewCryptoService(false), false)
+	deviceKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cashReg.SetDeviceKey(deviceKey)
+	vc := customer.NewVirtualCustomer(receiptBank, revenueAuth, false)
+
+	wallet, err := vc.NewWallet()
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItem(1, 1, 0); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if err := cashReg.SetPaymentMethod("Nakit"); err != nil {
+		t.Fatalf("Failed to set payment method: %v", err)
+	}
+	if _, err := cashReg.IssueCurrentReceipt(wallet.PublicKey); err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+
+	result, err := vc.Collect(wallet)
+	if err != nil {
+		t.Fatalf("Virtual customer failed to collect: %v", err)
+	}
+	if !result.DeviceSigned {
+		t.Error("Expected the receipt to carry a verified device signature")
+	}
+	compressed, _ := rwcrypto.CompressKey(&deviceKey.PublicKey)
+	if !bytes.Equal(result.Receipt.DeviceKey, compressed) {
+		t.Errorf("Expected the receipt to declare the register's device key, got %x", result.Receipt.DeviceKey)
+	}
+}
@@ -0,0 +1,338 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/delivery"
+	"fake-cash-register/internal/history"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/receiptpdf"
+)
+
+func TestParseRecipient(t *testing.T) {
+	tests := []struct {
+		email, phone string
+		channel      string
+		address      string
+		masked       string
+	}{
+		{"musteri@example.com", "", models.DeliveryEmail, "musteri@example.com", "m***@example.com"},
+		{"", "+90 (532) 123-45-67", models.DeliverySMS, "+905321234567", "+90********67"},
+		{"", "05321234567", models.DeliverySMS, "05321234567", "*********67"},
+	}
+	for _, tt := range tests {
+		recipient, err := delivery.ParseRecipient(tt.email, tt.phone)
+		if err != nil {
+			t.Fatalf("ParseRecipient(%q, %q): %v", tt.email, tt.phone, err)
+		}
+		if recipient.Channel != tt.channel || recipient.Address != tt.address {
+			t.Errorf("Expected %s %s, got %+v", tt.channel, tt.address, recipient)
+		}
+		if masked := delivery.Mask(*recipient); masked != tt.masked {
+			t.Errorf("Expected %s masked as %s, got %s", tt.address, tt.masked, masked)
+		}
+	}
+
+	for _, invalid := range [][2]string{
+		{"not an address", ""},
+		{"Musteri <musteri@example.com>", ""},
+		{"", "12345"},
+		{"", "0532 123 45 67 ext"},
+		{"musteri@example.com", "05321234567"},
+	} {
+		if _, err := delivery.ParseRecipient(invalid[0], invalid[1]); err == nil {
+			t.Errorf("Expected ParseRecipient(%q, %q) to fail", invalid[0], invalid[1])
+		}
+	}
+
+	if recipient, err := delivery.ParseRecipient("", ""); recipient != nil || err != nil {
+		t.Errorf("Expected no recipient without contact details, got %+v, %v", recipient, err)
+	}
+}
+
+// newDeliveryCashRegister creates a register with a file-backed history and a sale ready to issue
+func newDeliveryCashRegister(t *testing.T, service *delivery.Service) (*cashregister.CashRegister, string) {
+	t.Helper()
+
+	historyFile := filepath.Join(t.TempDir(), "history.jsonl")
+	store, err := history.NewStore(historyFile, false)
+	if err != nil {
+		t.Fatalf("Failed to create history: %v", err)
+	}
+
+	cashReg := createTestCashRegister(false)
+	cashReg.SetHistory(store)
+	if service != nil {
+		cashReg.SetDelivery(service)
+	}
+
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItem(1, 2, 0); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	cashReg.SetPaymentMethod("Nakit")
+	return cashReg, historyFile
+}
+
+// deliveryStatus reloads the history file and returns the receipt's recorded delivery
+func deliveryStatus(t *testing.T, historyFile, transactionID string) *models.Delivery {
+	t.Helper()
+
+	store, err := history.NewStore(historyFile, false)
+	if err != nil {
+		t.Fatalf("Failed to reload history: %v", err)
+	}
+	if store.Count() != 1 {
+		t.Errorf("Expected delivery updates not to add receipts, got %d", store.Count())
+	}
+	receipt, ok := store.FindByTransactionID(transactionID)
+	if !ok {
+		t.Fatalf("Receipt %s not in history", transactionID)
+	}
+	return receipt.Delivery
+}
+
+func TestReceiptDeliveredBySMS(t *testing.T) {
+	var messages []delivery.SMSMessage
+	fail := false
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sms-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if fail {
+			http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+			return
+		}
+		var message delivery.SMSMessage
+		json.NewDecoder(r.Body).Decode(&message)
+		messages = append(messages, message)
+	}))
+	defer gateway.Close()
+
+	service, err := delivery.NewService(delivery.Options{
+		SMS: delivery.SMSOptions{GatewayURL: gateway.URL, APIKey: "sms-key", Sender: "DEMO"},
+	}, newTestBundle(t, nil).Localizer("en"), false)
+	if err != nil {
+		t.Fatalf("Failed to create delivery service: %v", err)
+	}
+
+	// Email is not configured
+	cashReg, _ := newDeliveryCashRegister(t, service)
+	_, err = cashReg.IssueCurrentReceiptTo(nil, &models.Recipient{Channel: models.DeliveryEmail, Address: "musteri@example.com"})
+	if !errors.Is(err, cashregister.ErrDeliveryUnavailable) {
+		t.Errorf("Expected ErrDeliveryUnavailable for email, got %v", err)
+	}
+	if _, err := cashReg.IssueCurrentReceiptTo(nil, nil); !errors.Is(err, cashregister.ErrNoDestination) {
+		t.Errorf("Expected ErrNoDestination without key or recipient, got %v", err)
+	}
+
+	recipient := &models.Recipient{Channel: models.DeliverySMS, Address: "+905321234567"}
+	issued, err := cashReg.IssueCurrentReceiptTo(nil, recipient)
+	if err != nil {
+		t.Fatalf("Failed to issue receipt for SMS delivery: %v", err)
+	}
+	if issued.Delivery == nil || issued.Delivery.Status != models.DeliveryPending {
+		t.Errorf("Expected the issued receipt to be pending delivery, got %+v", issued.Delivery)
+	}
+	cashReg.WaitForDeliveries()
+
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 SMS, got %d", len(messages))
+	}
+	if messages[0].To != recipient.Address || messages[0].From != "DEMO" {
+		t.Errorf("Unexpected SMS addressing: %+v", messages[0])
+	}
+	if !strings.Contains(messages[0].Text, issued.ReceiptSerial) || !strings.Contains(messages[0].Text, "21.00") {
+		t.Errorf("Expected serial and total in SMS, got %q", messages[0].Text)
+	}
+
+	status, ok := cashReg.History().FindByTransactionID(issued.TransactionID)
+	if !ok || status.Delivery.Status != models.DeliverySent {
+		t.Errorf("Expected history to record the SMS as sent, got %+v", status.Delivery)
+	}
+	if issued.Delivery.Status != models.DeliveryPending {
+		t.Error("Recording the delivery modified the receipt returned to the caller")
+	}
+
+	// A gateway failure is recorded, not returned: the receipt is already issued
+	fail = true
+	cashReg, historyFile := newDeliveryCashRegister(t, service)
+	issued, err = cashReg.IssueCurrentReceiptTo(nil, recipient)
+	if err != nil {
+		t.Fatalf("Expected issuing to succeed when delivery fails, got %v", err)
+	}
+	cashReg.WaitForDeliveries()
+
+	failed := deliveryStatus(t, historyFile, issued.TransactionID)
+	if failed == nil || failed.Status != models.DeliveryFailed || !strings.Contains(failed.Error, "429") {
+		t.Errorf("Expected a failed delivery with the gateway status, got %+v", failed)
+	}
+	if failed != nil && failed.Recipient != "+90********67" {
+		t.Errorf("Expected a masked recipient in history, got %s", failed.Recipient)
+	}
+}
+
+// smtpServer accepts one message per session and hands it to received
+func smtpServer(t *testing.T, received chan<- []byte) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+				reply("220 test ESMTP")
+				var data strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					command := strings.ToUpper(strings.TrimSpace(line))
+					switch {
+					case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+						reply("250 test")
+					case command == "DATA":
+						reply("354 go ahead")
+						for {
+							line, err := reader.ReadString('\n')
+							if err != nil || line == ".\r\n" {
+								break
+							}
+							data.WriteString(strings.TrimPrefix(line, "."))
+						}
+						received <- []byte(data.String())
+						reply("250 queued")
+					case command == "QUIT":
+						reply("221 bye")
+						return
+					default:
+						reply("250 ok")
+					}
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestReceiptDeliveredByEmail(t *testing.T) {
+	received := make(chan []byte, 1)
+	host, port, _ := net.SplitHostPort(smtpServer(t, received))
+	smtpPort, _ := strconv.Atoi(port)
+
+	service, err := delivery.NewService(delivery.Options{
+		Email: delivery.EmailOptions{Host: host, Port: smtpPort, From: "fis@example.com"},
+	}, newTestBundle(t, nil).Localizer("tr"), false)
+	if err != nil {
+		t.Fatalf("Failed to create delivery service: %v", err)
+	}
+
+	// Wallet customers can get an email copy as well
+	cashReg, historyFile := newDeliveryCashRegister(t, service)
+	issued, err := cashReg.IssueCurrentReceiptTo(newTestEphemeralKey(t), &models.Recipient{Channel: models.DeliveryEmail, Address: "musteri@example.com"})
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+	cashReg.WaitForDeliveries()
+
+	var raw []byte
+	select {
+	case raw = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("No email received")
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("Failed to parse email: %v", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if !strings.Contains(subject, issued.ReceiptSerial) {
+		t.Errorf("Expected the serial in the subject, got %q", subject)
+	}
+
+	_, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Invalid Content-Type: %v", err)
+	}
+	parts := multipart.NewReader(message.Body, params["boundary"])
+
+	text, err := parts.NextPart()
+	if err != nil {
+		t.Fatalf("Missing text part: %v", err)
+	}
+	body, _ := io.ReadAll(text)
+	if !strings.Contains(string(body), "TOPLAM") || !strings.Contains(string(body), issued.TransactionID) {
+		t.Errorf("Expected the printed receipt in the body, got:\n%s", body)
+	}
+
+	pdf, err := parts.NextPart()
+	if err != nil {
+		t.Fatalf("Missing PDF attachment: %v", err)
+	}
+	if pdf.FileName() != receiptpdf.FileName(issued) || pdf.Header.Get("Content-Type") != "application/pdf" {
+		t.Errorf("Expected PDF attachment %s, got %s (%s)", receiptpdf.FileName(issued), pdf.FileName(), pdf.Header.Get("Content-Type"))
+	}
+	encodedPDF, _ := io.ReadAll(pdf)
+	if document, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encodedPDF), "\r\n", "")); err != nil || !bytes.HasPrefix(document, []byte("%PDF-")) {
+		t.Errorf("PDF attachment is not a PDF document (%v)", err)
+	}
+
+	attachment, err := parts.NextPart()
+	if err != nil {
+		t.Fatalf("Missing signed receipt attachment: %v", err)
+	}
+	if attachment.FileName() != delivery.AttachmentName(issued) {
+		t.Errorf("Expected attachment %s, got %s", delivery.AttachmentName(issued), attachment.FileName())
+	}
+	encoded, _ := io.ReadAll(attachment)
+	signedReceipt, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	if err != nil {
+		t.Fatalf("Attachment is not base64: %v", err)
+	}
+	signed, err := binary.ParseSignedReceipt(signedReceipt)
+	if err != nil {
+		t.Fatalf("Attachment is not a signed receipt: %v", err)
+	}
+	decoded, err := binary.DeserializeReceipt(signed.Receipt)
+	if err != nil || decoded.ReceiptSerial != issued.ReceiptSerial {
+		t.Errorf("Expected signed receipt %s, got %+v (%v)", issued.ReceiptSerial, decoded, err)
+	}
+
+	if status := deliveryStatus(t, historyFile, issued.TransactionID); status == nil || status.Status != models.DeliverySent {
+		t.Errorf("Expected the email to be recorded as sent, got %+v", status)
+	}
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/devices"
+	"fake-cash-register/internal/services/mock"
+)
+
+func TestDrawerAndBeeper(t *testing.T) {
+	cashReg := createTestCashRegister(false)
+	mockDevices := mock.NewMockDevices(false)
+	cashReg.SetDevices(mockDevices, cashregister.DevicePolicy{
+		DrawerPaymentMethods: []string{"Nakit"},
+		BeepOnItem:           true,
+		BeepOnError:          true,
+	})
+
+	sell := func(paymentMethod string) {
+		t.Helper()
+		cashReg.StartNewReceipt()
+		if err := cashReg.AddItem(1, 2, 0); err != nil {
+			t.Fatalf("AddItem failed: %v", err)
+		}
+		if err := cashReg.AddItem(99, 1, 0); err == nil {
+			t.Fatal("Expected an unknown KISIM to be refused")
+		}
+		cashReg.SetPaymentMethod(paymentMethod)
+		if _, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t)); err != nil {
+			t.Fatalf("Issue failed: %v", err)
+		}
+		cashReg.WaitForDevices()
+	}
+
+	sell("Kart")
+	if opens := mockDevices.DrawerOpens(); opens != 0 {
+		t.Errorf("Expected a card sale to leave the drawer shut, opened %d times", opens)
+	}
+	// Commands run in the background, so the beeps may come in either order
+	want := []string{devices.BeepError, devices.BeepItem}
+	beeps := mockDevices.Beeps()
+	slices.Sort(beeps)
+	if !slices.Equal(beeps, want) {
+		t.Errorf("Expected beeps %v, got %v", want, beeps)
+	}
+
+	sell("Nakit")
+	if opens := mockDevices.DrawerOpens(); opens != 1 {
+		t.Errorf("Expected a cash sale to open the drawer once, opened %d times", opens)
+	}
+}
+
+func TestESCPOSDevices(t *testing.T) {
+	port := filepath.Join(t.TempDir(), "lp0")
+	if err := os.WriteFile(port, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	printer := devices.NewESCPOS(port, 100*time.Millisecond)
+
+	if err := printer.OpenDrawer(); err != nil {
+		t.Fatalf("OpenDrawer failed: %v", err)
+	}
+	if err := printer.Beep(devices.BeepError); err != nil {
+		t.Fatalf("Beep failed: %v", err)
+	}
+	if err := printer.Beep("fanfare"); err == nil {
+		t.Error("Expected an unknown signal to be refused")
+	}
+
+	written, _ := os.ReadFile(port)
+	want := []byte{0x1b, 0x70, 0, 50, 50, 0x1b, 0x42, 3, 1}
+	if !bytes.Equal(written, want) {
+		t.Errorf("Expected drawer kick and buzzer commands % x, got % x", want, written)
+	}
+}
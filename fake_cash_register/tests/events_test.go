@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/events"
+	"fake-cash-register/internal/services/mock"
+)
+
+// readEvents parses the SSE stream and sends every event it carries
+func readEvents(t *testing.T, url, lastEventID string) <-chan events.Event {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", ct)
+	}
+
+	received := make(chan events.Event, 32)
+	go func() {
+		defer close(received)
+		scanner := bufio.NewScanner(resp.Body)
+		eventType := ""
+		for scanner.Scan() {
+			line := scanner.Text()
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				eventType = name
+			}
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				var event events.Event
+				if err := json.Unmarshal([]byte(data), &event); err != nil || event.Type != eventType {
+					t.Errorf("Malformed event %q (event: %s): %v", data, eventType, err)
+					return
+				}
+				received <- event
+			}
+		}
+	}()
+	return received
+}
+
+func nextEvent(t *testing.T, received <-chan events.Event) events.Event {
+	t.Helper()
+	select {
+	case event, ok := <-received:
+		if !ok {
+			t.Fatal("Event stream closed")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for an event")
+	}
+	return events.Event{}
+}
+
+func TestLifecycleEventStream(t *testing.T) {
+	bank := &trackingBank{MockReceiptBank: mock.NewMockReceiptBank(false)}
+	cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup, mock.NewMockRevenueAuthority(false), bank, crypto.NewCryptoService(false), false)
+	broker := events.NewBroker(false)
+	cashReg.SetEvents(broker)
+
+	// Cleanups run in reverse: the streams are closed before the server waits for them
+	server := httptest.NewServer(http.HandlerFunc(broker.ServeSSE))
+	t.Cleanup(server.Close)
+	received := readEvents(t, server.URL, "")
+
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItem(1, 2, 0); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	cashReg.SetPaymentMethod("Nakit")
+	receipt, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+	if err := cashReg.HandleDownloadConfirmation(api.WebhookPayload{ReceiptID: bank.submitted[0]}); err != nil {
+		t.Fatalf("Failed to confirm collection: %v", err)
+	}
+
+	// A receipt without a payment method fails to issue
+	cashReg.StartNewReceipt()
+	cashReg.AddItem(1, 1, 0)
+	if _, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t)); err == nil {
+		t.Fatal("Expected a receipt without a payment method to fail")
+	}
+
+	want := []string{
+		events.TypeStarted, events.TypeItemAdded, events.TypePaymentSet, events.TypeIssued,
+		events.TypeWebhookConfirmed, events.TypeStarted, events.TypeItemAdded, events.TypeFailed,
+	}
+	var got []events.Event
+	for i, eventType := range want {
+		event := nextEvent(t, received)
+		if event.Type != eventType || event.ID != uint64(i+1) {
+			t.Fatalf("Expected event #%d %s, got #%d %s", i+1, eventType, event.ID, event.Type)
+		}
+		got = append(got, event)
+	}
+
+	if item := got[1].Item; item == nil || item.KisimID != 1 || item.Quantity != 2 {
+		t.Errorf("Expected item_added to carry the line, got %+v", item)
+	}
+	if got[2].PaymentMethod != "Nakit" {
+		t.Errorf("Expected payment_set for Nakit, got %q", got[2].PaymentMethod)
+	}
+	if issued := got[3]; issued.TransactionID != receipt.TransactionID || issued.ReceiptSerial != receipt.ReceiptSerial || issued.Total != receipt.TotalAmount {
+		t.Errorf("Expected issued to describe the receipt, got %+v", issued)
+	}
+	if got[4].ReceiptID != bank.submitted[0] {
+		t.Errorf("Expected webhook_confirmed for %s, got %q", bank.submitted[0], got[4].ReceiptID)
+	}
+	if got[7].Error == "" {
+		t.Error("Expected failed to carry the error")
+	}
+
+	// A reconnecting client gets what it missed after its last event
+	replayed := readEvents(t, server.URL, "5")
+	for _, eventType := range want[5:] {
+		if event := nextEvent(t, replayed); event.Type != eventType {
+			t.Fatalf("Expected replayed %s, got %s", eventType, event.Type)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/audit"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/handlers"
+	"fake-cash-register/internal/services/mock"
+	"fake-cash-register/internal/transaction"
+)
+
+// trackingBank records the receipt IDs the register submits under
+type trackingBank struct {
+	*mock.MockReceiptBank
+	submitted []string
+}
+
+func (b *trackingBank) SubmitTrackedReceipt(receiptID string, key, encrypted, hash, signature []byte) error {
+	b.submitted = append(b.submitted, receiptID)
+	return b.MockReceiptBank.SubmitTrackedReceipt(receiptID, key, encrypted, hash, signature)
+}
+
+func TestUncollectedReceiptsExpire(t *testing.T) {
+	events := make(chan transaction.ExpiryEvent, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if want := "sha256=" + hex.EncodeToString(handlers.WebhookSignature("expiry-secret", r.Header.Get("X-Webhook-Timestamp"), body)); r.Header.Get("X-Webhook-Signature") != want {
+			t.Errorf("Expiry webhook not signed with the secret")
+		}
+		var event transaction.ExpiryEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("Invalid expiry event: %v", err)
+		}
+		events <- event
+	}))
+	defer webhook.Close()
+
+	auditLog, err := audit.NewLog(filepath.Join(t.TempDir(), "audit.jsonl"), false)
+	if err != nil {
+		t.Fatalf("Failed to create audit log: %v", err)
+	}
+
+	bank := &trackingBank{MockReceiptBank: mock.NewMockReceiptBank(false)}
+	cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup, mock.NewMockRevenueAuthority(false), bank, crypto.NewCryptoService(false), false)
+	cashReg.SetAudit(auditLog)
+	cashReg.SetTransactionTimeout(time.Second)
+	cashReg.SetExpiryWebhook(transaction.NewExpiryWebhook(webhook.URL, "expiry-secret", time.Second, false))
+
+	issue := func() string {
+		t.Helper()
+		cashReg.StartNewReceipt()
+		if err := cashReg.AddItem(1, 1, 0); err != nil {
+			t.Fatalf("Failed to add item: %v", err)
+		}
+		cashReg.SetPaymentMethod("Nakit")
+		receipt, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+		if err != nil {
+			t.Fatalf("Failed to issue receipt: %v", err)
+		}
+		return receipt.TransactionID
+	}
+
+	collected := issue()
+	uncollected := issue()
+	if stats := cashReg.TransactionStats(); stats.Pending != 2 || stats.OldestPending == nil {
+		t.Fatalf("Expected 2 pending receipts, got %+v", stats)
+	}
+
+	if expired := cashReg.ExpireTransactions(); len(expired) != 0 {
+		t.Fatalf("Nothing should expire before the timeout, got %d", len(expired))
+	}
+
+	// The bank reports a collection under the ID the receipt was submitted with
+	if len(bank.submitted) != 2 || !strings.HasPrefix(bank.submitted[0], collected+"-") {
+		t.Fatalf("Expected receipts submitted under their transaction IDs, got %v", bank.submitted)
+	}
+	collectedID := bank.submitted[0]
+	if err := cashReg.HandleDownloadConfirmation(api.WebhookPayload{ReceiptID: collectedID}); err != nil {
+		t.Fatalf("Failed to confirm collection: %v", err)
+	}
+	if err := cashReg.HandleDownloadConfirmation(api.WebhookPayload{ReceiptID: collectedID}); err == nil {
+		t.Error("Expected a second confirmation to be unknown")
+	}
+
+	cashReg.StartTransactionSweeper(20 * time.Millisecond)
+	select {
+	case event := <-events:
+		if event.Event != "receipt_expired" || event.TransactionID != uncollected || event.ReceiptID != bank.submitted[1] {
+			t.Errorf("Unexpected expiry event %+v", event)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("No expiry webhook for the uncollected receipt")
+	}
+
+	stats := cashReg.TransactionStats()
+	if stats.Pending != 0 || stats.Confirmed != 1 || stats.Expired != 1 || stats.Timeout != "1s" {
+		t.Errorf("Unexpected stats after expiry: %+v", stats)
+	}
+	expired := auditLog.Query(audit.Query{Type: audit.EventReceiptExpired})
+	if len(expired) != 1 || expired[0].TransactionID != uncollected {
+		t.Errorf("Expected one receipt_expired audit event for %s, got %+v", uncollected, expired)
+	}
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/faults"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/resilience"
+	"fake-cash-register/internal/services/mock"
+)
+
+func TestFaultInjectionIsReproducible(t *testing.T) {
+	failures := func() []bool {
+		injector := faults.NewInjector(42, false)
+		if err := injector.SetRule(faults.ServiceRevenueAuthority, faults.Rule{FailureRate: 0.5}); err != nil {
+			t.Fatalf("Failed to set rule: %v", err)
+		}
+		var failed []bool
+		for n := 0; n < 20; n++ {
+			failed = append(failed, injector.Inject(faults.ServiceRevenueAuthority) != nil)
+		}
+		return failed
+	}
+
+	first, second := failures(), failures()
+	injected := 0
+	for n := range first {
+		if first[n] != second[n] {
+			t.Fatalf("Call %d failed in one run only", n)
+		}
+		if first[n] {
+			injected++
+		}
+	}
+	if injected == 0 || injected == len(first) {
+		t.Errorf("Expected a 50%% rule to fail some calls, failed %d of %d", injected, len(first))
+	}
+}
+
+func TestFaultInjectionRetries(t *testing.T) {
+	injector := faults.NewInjector(1, false)
+	bank := mock.NewMockReceiptBank(false)
+	bank.SetFaults(injector)
+	bank.SetBreaker(resilience.NewBreaker("receipt bank", resilience.Policy{
+		MaxAttempts:      3,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         2 * time.Millisecond,
+		FailureThreshold: 10,
+		OpenTimeout:      time.Minute,
+	}, false))
+
+	// Transient failures are retried until the submission goes through
+	if err := injector.Trigger(faults.ServiceReceiptBank, faults.FailureUnavailable, 2); err != nil {
+		t.Fatalf("Failed to trigger faults: %v", err)
+	}
+	if err := bank.SubmitReceipt(newTestEphemeralKey(t), []byte("encrypted")); err != nil {
+		t.Errorf("Expected the third attempt to succeed, got %v", err)
+	}
+
+	// A conflict is final and reported like the real bank's
+	injector.Trigger(faults.ServiceReceiptBank, faults.FailureConflict, 1)
+	err := bank.SubmitReceipt(newTestEphemeralKey(t), []byte("encrypted"))
+	if !errors.Is(err, interfaces.ErrDuplicateReceipt) || !errors.Is(err, faults.ErrInjected) {
+		t.Errorf("Expected an injected duplicate receipt error, got %v", err)
+	}
+
+	stats := injector.Stats()[faults.ServiceReceiptBank]
+	if stats.Calls != 4 || stats.Injected != 3 || stats.ByFailure[faults.FailureUnavailable] != 2 || len(stats.Queued) != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// Conflicts only exist at the bank, and rates are fractions
+	if err := injector.SetRule(faults.ServiceRevenueAuthority, faults.Rule{FailureRate: 1, Failure: faults.FailureConflict}); err == nil {
+		t.Error("Expected a conflict rule for the revenue authority to be refused")
+	}
+	if err := injector.SetRule(faults.ServiceReceiptBank, faults.Rule{FailureRate: 2}); err == nil {
+		t.Error("Expected a failure rate above 1 to be refused")
+	}
+}
+
+func TestFaultRuleJSON(t *testing.T) {
+	var rule faults.Rule
+	if err := json.Unmarshal([]byte(`{"failure_rate": 0.25, "failure": "timeout", "latency": "200ms", "timeout": "2s"}`), &rule); err != nil {
+		t.Fatalf("Failed to decode rule: %v", err)
+	}
+	if rule.FailureRate != 0.25 || rule.Failure != faults.FailureTimeout || rule.Latency != 200*time.Millisecond || rule.Timeout != 2*time.Second {
+		t.Errorf("Unexpected rule: %+v", rule)
+	}
+
+	data, _ := json.Marshal(rule)
+	if string(data) != `{"failure_rate":0.25,"failure":"timeout","latency":"200ms","timeout":"2s"}` {
+		t.Errorf("Unexpected encoding: %s", data)
+	}
+	if err := json.Unmarshal([]byte(`{"latency": "soon"}`), &rule); err == nil {
+		t.Error("Expected an invalid duration to be refused")
+	}
+}
@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/history"
+)
+
+func TestHistoryRecordsIssuedReceipts(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "history.jsonl")
+
+	store, err := history.NewStore(historyFile, false)
+	if err != nil {
+		t.Fatalf("Failed to create history store: %v", err)
+	}
+
+	cashReg := createTestCashRegister(false)
+	cashReg.SetHistory(store)
+
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItem(1, 2, 0); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if err := cashReg.SetPaymentMethod("Kart"); err != nil {
+		t.Fatalf("Failed to set payment method: %v", err)
+	}
+
+	issued, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+
+	if store.Count() != 1 {
+		t.Fatalf("Expected 1 receipt in history, got %d", store.Count())
+	}
+
+	// Reload from disk and look the receipt up again
+	reloaded, err := history.NewStore(historyFile, false)
+	if err != nil {
+		t.Fatalf("Failed to reload history store: %v", err)
+	}
+
+	found, ok := reloaded.FindBySerial(issued.ReceiptSerial)
+	if !ok {
+		t.Fatalf("Receipt %s not found after reload", issued.ReceiptSerial)
+	}
+	if found.TotalAmount != issued.TotalAmount {
+		t.Errorf("Expected total %.2f after reload, got %.2f", issued.TotalAmount, found.TotalAmount)
+	}
+
+	if n := len(reloaded.Range(time.Now().Add(time.Hour), time.Time{})); n != 0 {
+		t.Errorf("Expected no receipts after a future from bound, got %d", n)
+	}
+	if n := len(reloaded.Range(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))); n != 1 {
+		t.Errorf("Expected 1 receipt in range, got %d", n)
+	}
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/hold"
+)
+
+func TestHoldAndRecallAcrossRestart(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "held.jsonl")
+	store, err := hold.NewStore(file, 0, false)
+	if err != nil {
+		t.Fatalf("Failed to create hold store: %v", err)
+	}
+
+	cashReg := createTestCashRegister(false)
+	cashReg.SetHolds(store)
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItem(1, 2, 0); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if err := cashReg.AddItem(3, 1, 12.75); err != nil {
+		t.Fatalf("Failed to add custom priced item: %v", err)
+	}
+	cashReg.SetPaymentMethod("Kredi Kartı")
+
+	held, err := cashReg.HoldCurrentReceipt("Ayşe")
+	if err != nil {
+		t.Fatalf("Failed to hold sale: %v", err)
+	}
+	if held.ID != "H0001" || held.Items != 2 || held.Label != "Ayşe" {
+		t.Errorf("Unexpected hold %+v", held)
+	}
+	if cashReg.HasActiveReceipt() {
+		t.Error("Holding left the sale open")
+	}
+
+	// The next customer is served while the sale is held
+	cashReg.StartNewReceipt()
+	cashReg.AddItem(2, 1, 0)
+	cashReg.SetPaymentMethod("Nakit")
+	if _, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t)); err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+
+	// A restarted register finds the held sale in the file
+	reloaded, err := hold.NewStore(file, 0, false)
+	if err != nil {
+		t.Fatalf("Failed to reload hold store: %v", err)
+	}
+	restarted := createTestCashRegister(false)
+	restarted.SetHolds(reloaded)
+	if list := reloaded.List(); len(list) != 1 || list[0].ID != "H0001" {
+		t.Fatalf("Expected H0001 after restart, got %+v", list)
+	}
+
+	receipt, err := restarted.RecallReceipt("H0001")
+	if err != nil {
+		t.Fatalf("Failed to recall sale: %v", err)
+	}
+	if len(receipt.Items) != 2 || receipt.Items[1].UnitPrice != 12.75 || receipt.PaymentMethod != "Kredi Kartı" {
+		t.Errorf("Recalled sale lost its lines or payment: %+v", receipt)
+	}
+	if reloaded.Count() != 0 {
+		t.Error("Recalled sale is still held")
+	}
+
+	// Recalled sales stay recalled after another restart, and IDs aren't reused
+	again, err := hold.NewStore(file, 0, false)
+	if err != nil {
+		t.Fatalf("Failed to reload hold store: %v", err)
+	}
+	if again.Count() != 0 {
+		t.Errorf("Expected no held sales, got %d", again.Count())
+	}
+	next, err := again.Hold(receipt, "")
+	if err != nil || next.ID != "H0002" {
+		t.Errorf("Expected H0002, got %+v (%v)", next, err)
+	}
+}
+
+func TestHoldRules(t *testing.T) {
+	store, _ := hold.NewStore("", 1, false)
+	cashReg := createTestCashRegister(false)
+	cashReg.SetHolds(store)
+
+	cashReg.StartNewReceipt()
+	if _, err := cashReg.HoldCurrentReceipt(""); !errors.Is(err, cashregister.ErrEmptyReceipt) {
+		t.Errorf("Expected ErrEmptyReceipt for an empty sale, got %v", err)
+	}
+
+	cashReg.AddItem(1, 1, 0)
+	if _, err := cashReg.HoldCurrentReceipt(""); err != nil {
+		t.Fatalf("Failed to hold sale: %v", err)
+	}
+	cashReg.StartNewReceipt()
+	cashReg.AddItem(2, 1, 0)
+	if _, err := cashReg.HoldCurrentReceipt(""); !errors.Is(err, hold.ErrLimit) {
+		t.Errorf("Expected ErrLimit beyond max, got %v", err)
+	}
+
+	// A sale with items isn't replaced by a recall
+	if _, err := cashReg.RecallReceipt("H0001"); !errors.Is(err, cashregister.ErrSaleOpen) {
+		t.Errorf("Expected ErrSaleOpen, got %v", err)
+	}
+	cashReg.CancelCurrentReceipt()
+	if _, err := cashReg.RecallReceipt("H0009"); !errors.Is(err, hold.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	if _, err := cashReg.DiscardHeld("H0001"); err != nil {
+		t.Fatalf("Failed to discard held sale: %v", err)
+	}
+	if _, err := cashReg.RecallReceipt("H0001"); !errors.Is(err, hold.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after discarding, got %v", err)
+	}
+}
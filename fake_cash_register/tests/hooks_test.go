@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"fake-cash-register/internal/audit"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/display"
+	"fake-cash-register/internal/faults"
+	"fake-cash-register/internal/handlers"
+	"fake-cash-register/internal/hooks"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/services/mock"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordingHook records the callbacks it gets and vetoes receipts while veto is set
+type recordingHook struct {
+	hooks.NoopHook
+	name  string
+	veto  error
+	calls []string
+}
+
+func (h *recordingHook) Name() string { return h.name }
+
+func (h *recordingHook) OnItemAdded(receipt *models.Receipt, item models.Item) {
+	h.calls = append(h.calls, "item_added")
+}
+
+func (h *recordingHook) OnFinalize(receipt *models.Receipt) error {
+	h.calls = append(h.calls, "finalize")
+	return h.veto
+}
+
+func (h *recordingHook) OnIssued(receipt *models.Receipt) {
+	h.calls = append(h.calls, "issued")
+}
+
+func (h *recordingHook) OnIssueFailed(receipt *models.Receipt, err error) {
+	h.calls = append(h.calls, "issue_failed")
+}
+
+func TestHooksFromConfig(t *testing.T) {
+	registry, err := hooks.FromConfig([]string{"logging"}, false)
+	if err != nil {
+		t.Fatalf("Failed to build registry: %v", err)
+	}
+	if names := registry.Names(); !reflect.DeepEqual(names, []string{"logging"}) {
+		t.Errorf("Expected [logging], got %v", names)
+	}
+	if _, err := hooks.FromConfig([]string{"missing"}, false); err == nil {
+		t.Error("Expected an unknown hook to be refused")
+	}
+}
+
+func TestHooksSeeTheSaleLifecycle(t *testing.T) {
+	revenueAuth := mock.NewMockRevenueAuthority(false)
+	bank := mock.NewMockReceiptBank(false)
+	injector := faults.NewInjector(1, false)
+	bank.SetFaults(injector)
+	cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup, revenueAuth, bank, crypto.NewCryptoService(false), false)
+	hook := &recordingHook{name: "recorder"}
+	cashReg.Hooks().Register(hook)
+
+	sell := func() error {
+		cashReg.StartNewReceipt()
+		if err := cashReg.AddItem(1, 1, 0); err != nil {
+			t.Fatalf("Failed to add item: %v", err)
+		}
+		if err := cashReg.SetPaymentMethod("Nakit"); err != nil {
+			t.Fatalf("Failed to set payment method: %v", err)
+		}
+		_, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+		return err
+	}
+
+	if err := sell(); err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+	if want := []string{"item_added", "finalize", "issued"}; !reflect.DeepEqual(hook.calls, want) {
+		t.Errorf("Issued sale: expected %v, got %v", want, hook.calls)
+	}
+
+	hook.calls = nil
+	injector.Trigger(faults.ServiceReceiptBank, faults.FailureConflict, 1)
+	if err := sell(); err == nil {
+		t.Fatal("Expected the submission to fail")
+	}
+	if want := []string{"item_added", "finalize", "issue_failed"}; !reflect.DeepEqual(hook.calls, want) {
+		t.Errorf("Failed sale: expected %v, got %v", want, hook.calls)
+	}
+}
+
+func TestHookVetoIsNotAnIssueFailure(t *testing.T) {
+	auditLog, err := audit.NewLog(filepath.Join(t.TempDir(), "audit.jsonl"), false)
+	if err != nil {
+		t.Fatalf("Failed to create audit log: %v", err)
+	}
+	cashReg := createTestCashRegister(false)
+	cashReg.SetAudit(auditLog)
+	reason := errors.New("loyalty card required")
+	vetoing := &recordingHook{name: "loyalty", veto: reason}
+	later := &recordingHook{name: "later"}
+	cashReg.Hooks().Register(vetoing)
+	cashReg.Hooks().Register(later)
+
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItem(1, 1, 0); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if err := cashReg.SetPaymentMethod("Nakit"); err != nil {
+		t.Fatalf("Failed to set payment method: %v", err)
+	}
+	_, err = cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	var veto *hooks.VetoError
+	if !errors.As(err, &veto) || veto.Hook != "loyalty" || !errors.Is(err, reason) {
+		t.Fatalf("Expected a veto by loyalty, got %v", err)
+	}
+
+	// The veto stops the hooks after it, and no hook hears of a failure
+	if want := []string{"item_added", "finalize"}; !reflect.DeepEqual(vetoing.calls, want) {
+		t.Errorf("Vetoing hook: expected %v, got %v", want, vetoing.calls)
+	}
+	if want := []string{"item_added"}; !reflect.DeepEqual(later.calls, want) {
+		t.Errorf("Later hook: expected %v, got %v", want, later.calls)
+	}
+
+	if n := len(auditLog.Query(audit.Query{Type: audit.EventIssueFailed})); n != 0 {
+		t.Errorf("Expected no issue_failed event, got %d", n)
+	}
+	vetoed := auditLog.Query(audit.Query{Type: audit.EventIssueVetoed})
+	if len(vetoed) != 1 || vetoed[0].Details["hook"] != "loyalty" || vetoed[0].Details["reason"] != reason.Error() {
+		t.Errorf("Expected one issue_vetoed event naming the hook, got %+v", vetoed)
+	}
+}
+
+func TestDisplayOnlyShowsFailuresThatEndTheSale(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cashReg := createTestCashRegister(false)
+	vetoing := &recordingHook{name: "loyalty"}
+	cashReg.Hooks().Register(vetoing)
+	hub := display.NewHub(false)
+	handler := handlers.NewCashRegisterHandler(cashReg, &config.Config{}, newTestBundle(t, nil))
+	handler.SetDisplay(hub)
+	router := gin.New()
+	router.POST("/api/transaction/add-item", handler.AddItem)
+	router.POST("/api/transaction/payment", handler.SetPaymentMethod)
+	router.POST("/api/transaction/issue_receipt", handler.IssueReceipt)
+
+	send := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		return w
+	}
+
+	send("/api/transaction/add-item", `{"kisim_id":1,"quantity":1}`)
+	send("/api/transaction/payment", `{"payment_method":"Nakit"}`)
+
+	// A rejected request leaves the sale open, so the display must not say it failed
+	if w := send("/api/transaction/issue_receipt", `{}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 without a destination, got %d %s", w.Code, w.Body)
+	}
+	if !cashReg.HasActiveReceipt() {
+		t.Fatal("Expected the receipt to stay open")
+	}
+	if event := hub.Last().Event; event != display.EventPaymentPrompt {
+		t.Errorf("Expected %s after a rejected request, got %s", display.EventPaymentPrompt, event)
+	}
+
+	// A veto ends the sale
+	vetoing.veto = errors.New("loyalty card required")
+	body, _ := json.Marshal(map[string][]byte{"ephemeral_key": newTestEphemeralKey(t)})
+	if w := send("/api/transaction/issue_receipt", string(body)); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected 422 for a veto, got %d %s", w.Code, w.Body)
+	}
+	if cashReg.HasActiveReceipt() {
+		t.Error("Expected the vetoed receipt to be cancelled")
+	}
+	if event := hub.Last().Event; event != display.EventIssueFailed {
+		t.Errorf("Expected %s after a veto, got %s", display.EventIssueFailed, event)
+	}
+}
@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/i18n"
+	"fake-cash-register/internal/models"
+)
+
+func newTestBundle(t *testing.T, overrides map[string]map[string]string) *i18n.Bundle {
+	t.Helper()
+
+	bundle, err := i18n.NewBundle("tr", overrides)
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	return bundle
+}
+
+func TestLocalizerMessages(t *testing.T) {
+	bundle := newTestBundle(t, map[string]map[string]string{
+		"de": {"display.welcome": "Willkommen"},
+	})
+
+	tr := bundle.Localizer("tr")
+	if got := tr.T("ui.kisim_loaded", 2); got != "2 kısım yüklendi" {
+		t.Errorf("Unexpected tr message: %q", got)
+	}
+
+	en := bundle.Localizer("en")
+	if got := en.T("ui.item_added", "Food", "₺5.50", 3); got != "Item added: Food - ₺5.50 x3" {
+		t.Errorf("Unexpected en message: %q", got)
+	}
+
+	// Config-added locale falls back to the default locale for missing keys
+	de := bundle.Localizer("de")
+	if got := de.T("display.welcome"); got != "Willkommen" {
+		t.Errorf("Expected override, got %q", got)
+	}
+	if got := de.T("display.total"); got != "TOPLAM" {
+		t.Errorf("Expected default locale fallback, got %q", got)
+	}
+	if got := de.T("no.such.key"); got != "no.such.key" {
+		t.Errorf("Expected key for missing message, got %q", got)
+	}
+
+	if got := bundle.Localizer("xx").Locale(); got != "tr" {
+		t.Errorf("Expected unknown locale to use default, got %s", got)
+	}
+
+	if _, err := i18n.NewBundle("xx", nil); err == nil {
+		t.Error("Expected error for unsupported default locale")
+	}
+}
+
+func TestLocalizerFormatting(t *testing.T) {
+	bundle := newTestBundle(t, nil)
+	tr, en := bundle.Localizer("tr"), bundle.Localizer("en")
+
+	tests := []struct {
+		amount float64
+		tr, en string
+	}{
+		{0, "0,00", "0.00"},
+		{5.5, "5,50", "5.50"},
+		{1234.567, "1.234,57", "1,234.57"},
+		{-1234567.8, "-1.234.567,80", "-1,234,567.80"},
+	}
+	for _, tt := range tests {
+		if got := tr.Amount(tt.amount); got != tt.tr {
+			t.Errorf("tr %v: expected %s, got %s", tt.amount, tt.tr, got)
+		}
+		if got := en.Amount(tt.amount); got != tt.en {
+			t.Errorf("en %v: expected %s, got %s", tt.amount, tt.en, got)
+		}
+	}
+
+	date := time.Date(2025, 3, 29, 13, 21, 45, 0, time.UTC)
+	if got := tr.Date(date); got != "29.03.2025" {
+		t.Errorf("Unexpected tr date: %s", got)
+	}
+	if got := en.Date(date); got != "29/03/2025" {
+		t.Errorf("Unexpected en date: %s", got)
+	}
+}
+
+func TestNegotiateLocale(t *testing.T) {
+	bundle := newTestBundle(t, nil)
+
+	tests := []struct {
+		lang, acceptLanguage, expected string
+	}{
+		{"en", "tr-TR", "en"},
+		{"", "en-US,en;q=0.9", "en"},
+		{"", "de-DE,tr;q=0.5,en;q=0.8", "en"},
+		{"", "fr-FR", "tr"},
+		{"xx", "", "tr"},
+	}
+	for _, tt := range tests {
+		if got := bundle.Negotiate(tt.lang, tt.acceptLanguage).Locale(); got != tt.expected {
+			t.Errorf("lang=%q Accept-Language=%q: expected %s, got %s", tt.lang, tt.acceptLanguage, tt.expected, got)
+		}
+	}
+}
+
+func TestFormatForDisplay(t *testing.T) {
+	receipt := &models.Receipt{
+		ZReportNumber: "Z0001",
+		TransactionID: "TX202503290001",
+		Timestamp:     time.Date(2025, 3, 29, 13, 21, 0, 0, time.Local),
+		StoreVKN:      "1234567890",
+		StoreName:     "Demo Mağazası",
+		Items: []models.Item{
+			{KisimID: 1, KisimName: "Temel Gıda", Quantity: 2, UnitPrice: 550, TotalPrice: 1100, TaxRate: 10},
+		},
+		TaxBreakdown: models.TaxBreakdown{
+			Tax10Percent: models.TaxDetail{TaxableAmount: 1000, TaxAmount: 100},
+			TotalTax:     100,
+		},
+		TotalAmount:   1100,
+		PaymentMethod: "Nakit",
+		ReceiptSerial: "F0001",
+	}
+
+	bundle := newTestBundle(t, map[string]map[string]string{
+		"en": {"receipt.total_tax": "TOPKDV"},
+	})
+
+	trText := receipt.FormatForDisplay(bundle.Localizer("tr"), nil)
+	for _, want := range []string{"VKN: 1234567890", "TARİH: 29.03.2025", "KDV %10", "*1.100,00", "NAKİT", "FİŞ NO: F0001"} {
+		if !strings.Contains(trText, want) {
+			t.Errorf("Turkish receipt missing %q:\n%s", want, trText)
+		}
+	}
+
+	enText := receipt.FormatForDisplay(bundle.Localizer("en"), nil)
+	for _, want := range []string{"DATE: 29/03/2025", "VAT (KDV) 10%", "*1,100.00", "CASH", "TOPKDV"} {
+		if !strings.Contains(enText, want) {
+			t.Errorf("English receipt missing %q:\n%s", want, enText)
+		}
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(trText, "\n"), "\n") {
+		if n := len([]rune(line)); n > models.ReceiptWidth {
+			t.Errorf("Line wider than %d characters (%d): %q", models.ReceiptWidth, n, line)
+		}
+	}
+}
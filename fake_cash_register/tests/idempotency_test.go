@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/handlers"
+	"fake-cash-register/internal/idempotency"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := handlers.NewCashRegisterHandler(nil, &config.Config{}, nil)
+	handler.SetIdempotency(idempotency.NewStore(time.Minute, 100))
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	router := gin.New()
+	router.POST("/api/transaction/add-item", handler.Idempotent, func(c *gin.Context) {
+		n := calls.Add(1)
+		c.JSON(http.StatusCreated, gin.H{"call": n})
+	})
+	router.POST("/api/transaction/issue_receipt", handler.Idempotent, func(c *gin.Context) {
+		calls.Add(1)
+		if c.Query("wait") != "" {
+			<-release
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "bank unreachable"})
+	})
+
+	send := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(handlers.IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := send("/api/transaction/add-item", "k1", `{"kisim_id":1}`)
+	replay := send("/api/transaction/add-item", "k1", `{"kisim_id":1}`)
+	if calls.Load() != 1 {
+		t.Fatalf("Expected the retry to be answered without running the handler, ran %d times", calls.Load())
+	}
+	if replay.Code != first.Code || replay.Body.String() != first.Body.String() {
+		t.Errorf("Expected the original response %d %s, got %d %s", first.Code, first.Body, replay.Code, replay.Body)
+	}
+	if replay.Header().Get(handlers.IdempotentReplayHeader) != "true" || first.Header().Get(handlers.IdempotentReplayHeader) != "" {
+		t.Errorf("Expected only the replay to carry %s", handlers.IdempotentReplayHeader)
+	}
+
+	if w := send("/api/transaction/add-item", "k1", `{"kisim_id":2}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for a key reused with another body, got %d", w.Code)
+	}
+	send("/api/transaction/add-item", "", `{"kisim_id":1}`)
+	send("/api/transaction/add-item", "", `{"kisim_id":1}`)
+	if calls.Load() != 3 {
+		t.Errorf("Expected requests without a key to run every time, ran %d times", calls.Load())
+	}
+
+	// Server errors are not stored, so the sale can be retried
+	calls.Store(0)
+	send("/api/transaction/issue_receipt", "k2", "")
+	send("/api/transaction/issue_receipt", "k2", "")
+	if calls.Load() != 2 {
+		t.Errorf("Expected a failed issue to run again on retry, ran %d times", calls.Load())
+	}
+
+	// A retry while the first request still runs is refused
+	done := make(chan struct{})
+	go func() {
+		send("/api/transaction/issue_receipt?wait=1", "k3", "")
+		close(done)
+	}()
+	for calls.Load() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+	if w := send("/api/transaction/issue_receipt?wait=1", "k3", ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 while the first request runs, got %d", w.Code)
+	}
+	close(release)
+	<-done
+}
+
+func TestIdempotencyStoreBounds(t *testing.T) {
+	store := idempotency.NewStore(50*time.Millisecond, 2)
+	fingerprint := idempotency.Fingerprint("POST", "/api/transaction/add-item", nil)
+
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if _, err := store.Begin(key, fingerprint); err != nil {
+			t.Fatalf("Begin %s: %v", key, err)
+		}
+		store.Finish(key, idempotency.Response{Status: http.StatusOK})
+	}
+	if stats := store.Stats(); stats.Keys != 2 {
+		t.Errorf("Expected the store to keep 2 keys, kept %d", stats.Keys)
+	}
+	if stored, _ := store.Begin("k0", fingerprint); stored != nil {
+		t.Error("Expected the oldest key to make room")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if stored, _ := store.Begin("k2", fingerprint); stored != nil {
+		t.Error("Expected responses to expire after the window")
+	}
+}
@@ -0,0 +1,258 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/handlers"
+	"fake-cash-register/internal/kisim"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/services/mock"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestKisimLayoutPages(t *testing.T) {
+	groups := []kisim.GroupDef{
+		{ID: "drinks", Name: "İçecek", Color: "#10b981", Order: 2},
+		{ID: "food", Name: "Gıda", Order: 1},
+		{ID: "empty", Name: "Boş", Order: 3},
+	}
+
+	// 50 food departments listed backwards, 3 drinks and 2 without a group
+	var defs []kisim.KisimDef
+	for id := 50; id >= 1; id-- {
+		defs = append(defs, kisim.KisimDef{Info: models.KisimInfo{ID: id, Name: fmt.Sprintf("Gıda %d", id), TaxRate: 10}, Group: "food", Order: id})
+	}
+	for id := 51; id <= 55; id++ {
+		def := kisim.KisimDef{Info: models.KisimInfo{ID: id, Name: fmt.Sprintf("Kısım %d", id), TaxRate: 20}}
+		if id <= 53 {
+			def.Group = "drinks"
+		}
+		defs = append(defs, def)
+	}
+
+	layout, err := kisim.NewLayout(groups, defs, 0)
+	if err != nil {
+		t.Fatalf("Failed to arrange KISIMs: %v", err)
+	}
+	if layout.PageSize != kisim.DefaultPageSize {
+		t.Errorf("Expected the default page size %d, got %d", kisim.DefaultPageSize, layout.PageSize)
+	}
+
+	// By group order, the empty group left out and the other group last
+	var ids []string
+	for _, g := range layout.Groups {
+		ids = append(ids, g.ID)
+	}
+	if fmt.Sprint(ids) != fmt.Sprint([]string{"food", "drinks", kisim.OtherGroup}) {
+		t.Fatalf("Unexpected groups %v", ids)
+	}
+
+	food := layout.Groups[0]
+	if food.Size != 50 || len(food.Pages) != 5 || len(food.Pages[4].Kisim) != 2 {
+		t.Fatalf("Expected 50 KISIMs on 5 pages of 12, got %d on %d", food.Size, len(food.Pages))
+	}
+	if first, last := food.Pages[0].Kisim[0].ID, food.Pages[4].Kisim[1].ID; first != 1 || last != 50 || food.Pages[4].Number != 5 {
+		t.Errorf("Expected KISIMs in their configured order 1..50, got %d..%d", first, last)
+	}
+	if drinks, _ := layout.Group("drinks"); drinks.Color != "#10b981" || drinks.Size != 3 {
+		t.Errorf("Unexpected drinks group %+v", drinks)
+	}
+	if other := layout.Groups[2]; other.Name != "" || other.Size != 2 {
+		t.Errorf("Unexpected other group %+v", other)
+	}
+	if all := layout.Kisim(); len(all) != 55 {
+		t.Errorf("Expected all 55 KISIMs, got %d", len(all))
+	}
+
+	// Without groups everything is on the other tab
+	flat, err := kisim.NewLayout(nil, defs[53:], 1)
+	if err != nil || len(flat.Groups) != 1 || len(flat.Groups[0].Pages) != 2 {
+		t.Errorf("Expected one group of 2 pages, got %+v (%v)", flat, err)
+	}
+}
+
+func TestKisimLayoutRejectsBadConfig(t *testing.T) {
+	info := func(id int) models.KisimInfo { return models.KisimInfo{ID: id, Name: "K", TaxRate: 10} }
+	food := []kisim.GroupDef{{ID: "food", Name: "Gıda"}}
+
+	for name, tc := range map[string]struct {
+		groups   []kisim.GroupDef
+		kisim    []kisim.KisimDef
+		pageSize int
+	}{
+		"unknown group":   {food, []kisim.KisimDef{{Info: info(1), Group: "drinks"}}, 0},
+		"duplicate kisim": {nil, []kisim.KisimDef{{Info: info(1)}, {Info: info(1)}}, 0},
+		"kisim id zero":   {nil, []kisim.KisimDef{{Info: info(0)}}, 0},
+		"kisim id range":  {nil, []kisim.KisimDef{{Info: info(70000)}}, 0},
+		"duplicate group": {append(food, food...), nil, 0},
+		"reserved group":  {[]kisim.GroupDef{{ID: kisim.OtherGroup, Name: "Diğer"}}, nil, 0},
+		"unnamed group":   {[]kisim.GroupDef{{ID: "food"}}, nil, 0},
+		"bad color":       {[]kisim.GroupDef{{ID: "food", Name: "Gıda", Color: "orange"}}, nil, 0},
+		"page size":       {nil, nil, -1},
+	} {
+		if _, err := kisim.NewLayout(tc.groups, tc.kisim, tc.pageSize); !errors.Is(err, kisim.ErrInvalidLayout) {
+			t.Errorf("%s: expected ErrInvalidLayout, got %v", name, err)
+		}
+	}
+}
+
+func TestKisimEndpointGroups(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Kisim = []config.Kisim{{ID: 1, Name: "Temel Gıda", TaxRate: 10}, {ID: 2, Name: "Yemek", TaxRate: 20}}
+	catalog, err := kisim.NewCatalog([]kisim.GroupDef{{ID: "food", Name: "Gıda"}}, []kisim.KisimDef{
+		{Info: models.KisimInfo{ID: 1, Name: "Temel Gıda", TaxRate: 10}, Group: "food"},
+		{Info: models.KisimInfo{ID: 2, Name: "Yemek", TaxRate: 20}},
+	}, 0, false)
+	if err != nil {
+		t.Fatalf("Failed to arrange KISIMs: %v", err)
+	}
+	handler := handlers.NewCashRegisterHandler(nil, cfg, nil)
+	handler.SetCatalog(catalog)
+	router := gin.New()
+	router.GET("/api/kisim", handler.GetKisim)
+
+	get := func(path string) (int, models.KisimResponse) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var response models.KisimResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	code, all := get("/api/kisim")
+	if code != http.StatusOK || len(all.Kisim) != 2 || len(all.Groups) != 2 || all.PageSize != kisim.DefaultPageSize {
+		t.Fatalf("Unexpected response %d %+v", code, all)
+	}
+
+	code, one := get("/api/kisim?group=food")
+	if code != http.StatusOK || len(one.Groups) != 1 || len(one.Kisim) != 1 || one.Kisim[0].ID != 1 {
+		t.Errorf("Expected only the food group, got %d %+v", code, one)
+	}
+	if code, _ := get("/api/kisim?group=drinks"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown group, got %d", code)
+	}
+}
+
+func TestKisimCatalogSync(t *testing.T) {
+	// Head office publishes v1, then a broken v2, then v3 without groups
+	versions := []string{
+		`{"version": "v1", "kisim": [{"id": 1, "name": "Temel Gıda", "tax_rate": 10, "preset_price": 6.00, "group": "food"},
+			{"id": 7, "name": "Kahve", "tax_rate": 20, "preset_price": 40.00, "group": "drinks"}],
+			"groups": [{"id": "food", "name": "Gıda"}, {"id": "drinks", "name": "İçecek"}]}`,
+		`{"version": "v2", "kisim": [{"id": 1, "name": "", "tax_rate": 10}]}`,
+		`{"version": "v3", "kisim": [{"id": 1, "name": "Temel Gıda", "tax_rate": 10, "preset_price": 6.50, "group": "food"}]}`,
+	}
+	var current atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(versions[current.Load()]))
+	}))
+	defer server.Close()
+
+	catalog, err := kisim.NewCatalog([]kisim.GroupDef{{ID: "food", Name: "Gıda"}}, []kisim.KisimDef{
+		{Info: models.KisimInfo{ID: 1, Name: "Temel Gıda", TaxRate: 10, PresetPrice: 5.50}, Group: "food"},
+	}, 0, false)
+	if err != nil {
+		t.Fatalf("Failed to create catalog: %v", err)
+	}
+	if catalog.Version() != "" {
+		t.Errorf("Expected the configured catalog to have no version, got %q", catalog.Version())
+	}
+
+	waitFor := func(version string) {
+		t.Helper()
+		for deadline := time.Now().Add(2 * time.Second); catalog.Version() != version; time.Sleep(5 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Catalog still at %q, expected %q", catalog.Version(), version)
+			}
+		}
+	}
+
+	catalog.StartSync(server.URL, 10*time.Millisecond)
+	waitFor("v1")
+	if info, ok := catalog.GetKisimInfo(7); !ok || info.Name != "Kahve" || len(catalog.Layout().Groups) != 2 {
+		t.Errorf("Expected KISIM 7 in the drinks group of v1, got %+v (%v)", info, ok)
+	}
+
+	// Issued receipts record the catalog they were sold from
+	cashReg := cashregister.NewCashRegister(storeInfo, catalog, mock.NewMockRevenueAuthority(false),
+		mock.NewMockReceiptBank(false), crypto.NewCryptoService(false), false)
+	if err := cashReg.StartNewReceipt(); err != nil {
+		t.Fatalf("Failed to start receipt: %v", err)
+	}
+	if err := cashReg.AddItem(7, 1, 0); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if err := cashReg.SetPaymentMethod("Nakit"); err != nil {
+		t.Fatalf("Failed to set payment method: %v", err)
+	}
+	receipt, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+	if receipt.CatalogVersion != "v1" || receipt.TotalAmount != 40 {
+		t.Errorf("Expected a 40.00 sale from catalog v1, got %.2f from %q", receipt.TotalAmount, receipt.CatalogVersion)
+	}
+
+	// The invalid v2 is refused and v1 stays in use until v3
+	current.Store(1)
+	time.Sleep(50 * time.Millisecond)
+	if catalog.Version() != "v1" {
+		t.Fatalf("Expected the invalid catalog to be refused, got %q", catalog.Version())
+	}
+	current.Store(2)
+	waitFor("v3")
+	if _, ok := catalog.GetKisimInfo(7); ok {
+		t.Error("Expected KISIM 7 to be gone in v3")
+	}
+	if info, _ := catalog.GetKisimInfo(1); info.PresetPrice != 6.50 || len(catalog.Layout().Groups) != 1 {
+		t.Errorf("Expected v3 prices with the configured groups, got %+v %+v", info, catalog.Layout().Groups)
+	}
+}
+
+func TestKisimCatalogRejectsBadVersions(t *testing.T) {
+	catalog, err := kisim.NewCatalog(nil, []kisim.KisimDef{{Info: models.KisimInfo{ID: 1, Name: "K", TaxRate: 10}}}, 0, false)
+	if err != nil {
+		t.Fatalf("Failed to create catalog: %v", err)
+	}
+	info := func(id int) models.KisimInfo { return models.KisimInfo{ID: id, Name: "K", TaxRate: 10} }
+
+	for name, tc := range map[string]struct {
+		version string
+		kisim   []kisim.KisimDef
+	}{
+		"no version":                   {"", []kisim.KisimDef{{Info: info(1)}}},
+		"empty":                        {"v2", nil},
+		"unnamed":                      {"v2", []kisim.KisimDef{{Info: models.KisimInfo{ID: 1, TaxRate: 10}}}},
+		"tax rate":                     {"v2", []kisim.KisimDef{{Info: models.KisimInfo{ID: 1, Name: "K", TaxRate: 120}}}},
+		"negative price":               {"v2", []kisim.KisimDef{{Info: models.KisimInfo{ID: 1, Name: "K", PresetPrice: -1}}}},
+		"duplicate kisim":              {"v2", []kisim.KisimDef{{Info: info(1)}, {Info: info(1)}}},
+		"unknown group":                {"v2", []kisim.KisimDef{{Info: info(1), Group: "food"}}},
+		"rate the receipt can't carry": {"v2", []kisim.KisimDef{{Info: models.KisimInfo{ID: 1, Name: "K", TaxRate: 8}}}},
+		"rate change the receipt can't carry": {"v2", []kisim.KisimDef{{Info: models.KisimInfo{ID: 1, Name: "K", TaxRate: 10, TaxRates: []models.TaxRateChange{
+			{Rate: 12, ValidFrom: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		}}}}},
+		"rate changes out of order": {"v2", []kisim.KisimDef{{Info: models.KisimInfo{ID: 1, Name: "K", TaxRate: 10, TaxRates: []models.TaxRateChange{
+			{Rate: 20, ValidFrom: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)}, {Rate: 10, ValidFrom: time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)},
+		}}}}},
+	} {
+		if err := catalog.Replace(tc.version, nil, tc.kisim); !errors.Is(err, kisim.ErrInvalidCatalog) {
+			t.Errorf("%s: expected ErrInvalidCatalog, got %v", name, err)
+		}
+	}
+	if catalog.Version() != "" || len(catalog.Kisim()) != 1 {
+		t.Errorf("Expected the configured catalog to stay in use, got %q", catalog.Version())
+	}
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"receiptwallet/authority"
+	rwcrypto "receiptwallet/crypto"
+	"receiptwallet/qrpayload"
+	"receiptwallet/receiptbank"
+
+	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/services/real"
+)
+
+// TestIssuancePipelineOverHTTP runs the one issuance pipeline against an authority and a
+// bank speaking their HTTP APIs: the wallet's QR code in, a receipt the wallet can
+// decrypt and verify out
+func TestIssuancePipelineOverHTTP(t *testing.T) {
+	authorityKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorityDER, _ := x509.MarshalPKIXPublicKey(&authorityKey.PublicKey)
+	authorityServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sign":
+			var req authority.SignRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			hash, _ := base64.StdEncoding.DecodeString(req.Hash)
+			signature, err := rwcrypto.Sign(authorityKey, hash)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(authority.SignResponse{Signature: base64.StdEncoding.EncodeToString(signature)})
+		case "/public-key":
+			json.NewEncoder(w).Encode(authority.PublicKeyResponse{PublicKey: base64.StdEncoding.EncodeToString(authorityDER)})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer authorityServer.Close()
+
+	var mu sync.Mutex
+	deposits := map[string]receiptbank.SubmitRequest{}
+	bankServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/submit" {
+			http.NotFound(w, r)
+			return
+		}
+		var req receiptbank.SubmitRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		deposits[req.EphemeralKey] = req
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(receiptbank.SubmitResponse{ReceiptID: req.ReceiptID})
+	}))
+	defer bankServer.Close()
+
+	cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup,
+		real.NewRealRevenueAuthority(authorityServer.URL, "", false),
+		real.NewRealReceiptBank(bankServer.URL, &config.Config{}, false),
+		crypto.NewCryptoService(false), false)
+
+	// The wallet's side: a key pair and the QR code the register scans
+	walletKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, _ := rwcrypto.CompressKey(&walletKey.PublicKey)
+	qrCode, err := (&qrpayload.Payload{EphemeralKey: compressed, BankURL: bankServer.URL}).Encode()
+	if err != nil {
+		t.Fatalf("Failed to encode QR payload: %v", err)
+	}
+	scanned, err := qrpayload.Decode(qrCode)
+	if err != nil {
+		t.Fatalf("Failed to decode QR payload: %v", err)
+	}
+
+	if err := cashReg.StartNewReceipt(); err != nil {
+		t.Fatalf("Failed to start receipt: %v", err)
+	}
+	if err := cashReg.AddItem(1, 2, 0); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if err := cashReg.SetPaymentMethod("Nakit"); err != nil {
+		t.Fatalf("Failed to set payment method: %v", err)
+	}
+	issued, err := cashReg.IssueCurrentReceipt(scanned.EphemeralKey)
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+
+	mu.Lock()
+	deposit, ok := deposits[base64.StdEncoding.EncodeToString(compressed)]
+	mu.Unlock()
+	if !ok {
+		t.Fatalf("Expected a deposit under the wallet's key, got %d other(s)", len(deposits))
+	}
+	envelope, err := base64.StdEncoding.DecodeString(deposit.EncryptedData)
+	if err != nil {
+		t.Fatalf("Deposit is not base64: %v", err)
+	}
+	signedReceipt, err := rwcrypto.Decrypt(envelope, walletKey)
+	if err != nil {
+		t.Fatalf("Wallet failed to decrypt the deposit: %v", err)
+	}
+	_, receipt, err := binary.VerifySignedReceipt(signedReceipt, authorityDER)
+	if err != nil {
+		t.Fatalf("Receipt did not verify against the authority key: %v", err)
+	}
+	if receipt.ReceiptSerial != issued.ReceiptSerial || receipt.TotalAmount != issued.TotalAmount {
+		t.Errorf("Expected receipt %s for %.2f, got %s for %.2f",
+			issued.ReceiptSerial, issued.TotalAmount, receipt.ReceiptSerial, receipt.TotalAmount)
+	}
+}
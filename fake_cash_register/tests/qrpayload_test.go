@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"receiptwallet/qrpayload"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/handlers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIssueReceiptToScannedQRCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := handlers.NewCashRegisterHandler(createTestCashRegister(false), &config.Config{}, nil)
+	router := gin.New()
+	router.POST("/api/transaction/add-item", handler.AddItem)
+	router.POST("/api/transaction/payment", handler.SetPaymentMethod)
+	router.POST("/api/transaction/issue_receipt", handler.IssueReceipt)
+
+	send := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		return w
+	}
+	issue := func(qrCode string) *httptest.ResponseRecorder {
+		t.Helper()
+		send("/api/transaction/add-item", `{"kisim_id":1,"quantity":1}`)
+		send("/api/transaction/payment", `{"payment_method":"Nakit"}`)
+		body, _ := json.Marshal(map[string]string{"ephemeral_key": qrCode})
+		return send("/api/transaction/issue_receipt", string(body))
+	}
+
+	key := newTestEphemeralKey(t)
+	withHint, err := (&qrpayload.Payload{EphemeralKey: key, BankURL: "http://192.168.1.20:4403"}).Encode()
+	if err != nil {
+		t.Fatalf("Failed to encode QR payload: %v", err)
+	}
+
+	// A version 1 payload and the bare key of older wallets
+	for _, qrCode := range []string{withHint, base64.StdEncoding.EncodeToString(key)} {
+		if w := issue(qrCode); w.Code != http.StatusOK {
+			t.Errorf("Expected %s issued, got %d %s", qrCode, w.Code, w.Body)
+		}
+	}
+
+	// A misread QR code fails its checksum
+	corrupt := []byte(withHint)
+	corrupt[10] ^= 0x01
+	w := issue(string(corrupt))
+	var apiErr api.APIError
+	json.Unmarshal(w.Body.Bytes(), &apiErr)
+	if w.Code != http.StatusBadRequest || apiErr.Code != api.ErrorCodeInvalidKey {
+		t.Errorf("Expected 400 %s for a corrupt QR code, got %d %s", api.ErrorCodeInvalidKey, w.Code, w.Body)
+	}
+}
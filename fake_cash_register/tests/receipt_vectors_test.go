@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"math/big"
+	"os"
+	"testing"
+
+	rwcrypto "receiptwallet/crypto"
+
+	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/models"
+)
+
+const receiptVectorsFile = "testdata/receipt_vectors.json"
+
+var updateVectors = flag.Bool("update", false, "regenerate the derived fields of "+receiptVectorsFile)
+
+// receiptVectors mirrors testdata/receipt_vectors.json, the reference corpus for wallet
+// implementations (see verify_receipt_vectors.mjs). Keys are hex P-256 scalars and
+// compressed points; byte fields are hex.
+type receiptVectors struct {
+	Description         string          `json:"description"`
+	AuthorityPrivateKey string          `json:"authority_private_key"`
+	AuthorityPublicKey  string          `json:"authority_public_key"`
+	WalletPrivateKey    string          `json:"wallet_private_key"`
+	WalletPublicKey     string          `json:"wallet_public_key"`
+	Receipts            []receiptVector `json:"receipts"`
+}
+
+type receiptVector struct {
+	Name      string          `json:"name"`
+	Version   uint8           `json:"version"`
+	Flags     uint8           `json:"flags"` // Header flags of Binary
+	Receipt   *models.Receipt `json:"receipt"`
+	Binary    string          `json:"binary"`    // Signed bytes
+	Hash      string          `json:"hash"`      // SHA-256 of Binary
+	Signature string          `json:"signature"` // Authority signature over Hash, r || s
+	Envelope  string          `json:"envelope"`  // Binary || Signature encrypted to the wallet key
+}
+
+// vectorKey builds the P-256 key pair of a published hex scalar
+func vectorKey(t *testing.T, scalarHex string) *ecdsa.PrivateKey {
+	t.Helper()
+
+	scalar, err := hex.DecodeString(scalarHex)
+	if err != nil || len(scalar) != 32 {
+		t.Fatalf("bad vector key %q: %v", scalarHex, err)
+	}
+	key := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(scalar)}
+	key.Curve = elliptic.P256()
+	key.X, key.Y = elliptic.P256().ScalarBaseMult(scalar)
+	return key
+}
+
+func compressedHex(t *testing.T, key *ecdsa.PrivateKey) string {
+	t.Helper()
+
+	compressed, err := rwcrypto.CompressKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to compress key: %v", err)
+	}
+	return hex.EncodeToString(compressed)
+}
+
+// TestReceiptVectors checks the register against the published receipt corpus: each JSON
+// receipt serializes to the recorded bytes and hash, decodes back to the same bytes, and
+// its signature and envelope open with the published keys. Signatures and envelopes are
+// randomized, so they are checked rather than reproduced.
+//
+// After a deliberate format change, go test ./tests -run TestReceiptVectors -update
+// rewrites the bytes and hashes and re-signs and re-encrypts only the receipts that changed.
+func TestReceiptVectors(t *testing.T) {
+	data, err := os.ReadFile(receiptVectorsFile)
+	if err != nil {
+		t.Fatalf("Failed to read vectors: %v", err)
+	}
+	var vectors receiptVectors
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("Failed to parse vectors: %v", err)
+	}
+
+	authorityKey := vectorKey(t, vectors.AuthorityPrivateKey)
+	walletKey := vectorKey(t, vectors.WalletPrivateKey)
+	if compressedHex(t, authorityKey) != vectors.AuthorityPublicKey || compressedHex(t, walletKey) != vectors.WalletPublicKey {
+		t.Fatal("Published public keys don't match the private keys")
+	}
+	walletPublicKey, _ := hex.DecodeString(vectors.WalletPublicKey)
+	cryptoService := crypto.NewCryptoService(false)
+
+	for i := range vectors.Receipts {
+		v := &vectors.Receipts[i]
+		t.Run(v.Name, func(t *testing.T) {
+			encoded, err := binary.SerializeReceiptVersion(v.Receipt, v.Version, v.Flags)
+			if err != nil {
+				t.Fatalf("Serialize failed: %v", err)
+			}
+			hash := cryptoService.GenerateReceiptHash(encoded)
+
+			if *updateVectors {
+				updateReceiptVector(t, v, encoded, hash, authorityKey, walletKey, walletPublicKey, cryptoService)
+			}
+
+			if got := hex.EncodeToString(encoded); got != v.Binary {
+				t.Fatalf("Binary mismatch:\n got %s\nwant %s", got, v.Binary)
+			}
+			if encoded[3] != v.Flags {
+				t.Errorf("Header flags 0x%02x, want 0x%02x", encoded[3], v.Flags)
+			}
+			if got := hex.EncodeToString(hash); got != v.Hash {
+				t.Errorf("Hash mismatch: got %s, want %s", got, v.Hash)
+			}
+
+			decoded, err := binary.DeserializeReceipt(encoded)
+			if err != nil {
+				t.Fatalf("Deserialize failed: %v", err)
+			}
+			reencoded, err := binary.SerializeReceiptVersion(decoded, v.Version, v.Flags)
+			if err != nil || !bytes.Equal(reencoded, encoded) {
+				t.Errorf("Decoded receipt re-serializes differently (%v)", err)
+			}
+
+			signature := mustDecodeHex(t, v.Signature)
+			if !rwcrypto.Verify(&authorityKey.PublicKey, hash, signature) {
+				t.Error("Signature does not verify with the authority key")
+			}
+
+			plaintext, err := rwcrypto.Decrypt(mustDecodeHex(t, v.Envelope), walletKey)
+			if err != nil {
+				t.Fatalf("Envelope does not open with the wallet key: %v", err)
+			}
+			signed, err := binary.ParseSignedReceipt(plaintext)
+			if err != nil {
+				t.Fatalf("Envelope does not hold a signed receipt: %v", err)
+			}
+			if !bytes.Equal(signed.Receipt, encoded) || !bytes.Equal(signed.Signature, signature) {
+				t.Error("Envelope holds a different receipt or signature")
+			}
+		})
+	}
+
+	if *updateVectors && !t.Failed() {
+		out, err := json.MarshalIndent(vectors, "", "  ")
+		if err != nil {
+			t.Fatalf("Failed to encode vectors: %v", err)
+		}
+		if err := os.WriteFile(receiptVectorsFile, append(out, '\n'), 0644); err != nil {
+			t.Fatalf("Failed to write vectors: %v", err)
+		}
+	}
+}
+
+// updateReceiptVector records encoded and its hash, signing and encrypting it again
+// when the recorded signature or envelope no longer match
+func updateReceiptVector(t *testing.T, v *receiptVector, encoded, hash []byte, authorityKey, walletKey *ecdsa.PrivateKey, walletPublicKey []byte, cryptoService *crypto.CryptoService) {
+	t.Helper()
+
+	v.Binary = hex.EncodeToString(encoded)
+	v.Hash = hex.EncodeToString(hash)
+
+	signature, _ := hex.DecodeString(v.Signature)
+	if !rwcrypto.Verify(&authorityKey.PublicKey, hash, signature) {
+		var err error
+		if signature, err = rwcrypto.Sign(authorityKey, hash); err != nil {
+			t.Fatalf("Sign failed: %v", err)
+		}
+		v.Signature = hex.EncodeToString(signature)
+	}
+
+	signed, err := binary.CreateSignedReceipt(encoded, signature)
+	if err != nil {
+		t.Fatalf("Failed to build signed receipt: %v", err)
+	}
+	envelope, _ := hex.DecodeString(v.Envelope)
+	if plaintext, err := rwcrypto.Decrypt(envelope, walletKey); err != nil || !bytes.Equal(plaintext, signed) {
+		if envelope, err = cryptoService.EncryptWithUserEphemeralKey(signed, walletPublicKey); err != nil {
+			t.Fatalf("Encryption failed: %v", err)
+		}
+		v.Envelope = hex.EncodeToString(envelope)
+	}
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
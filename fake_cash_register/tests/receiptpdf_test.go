@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/receiptpdf"
+)
+
+func TestRenderReceiptPDF(t *testing.T) {
+	receipt := &models.Receipt{
+		ZReportNumber: "Z0001",
+		TransactionID: "TX202503290001",
+		Timestamp:     time.Date(2025, 3, 29, 13, 21, 0, 0, time.Local),
+		StoreVKN:      "1234567890",
+		StoreName:     "Demo Mağazası Şişli Şubesi Gıda ve İhtiyaç Maddeleri",
+		StoreAddress:  "Büyükdere Cad. No: 1 (Zemin Kat)",
+		Items: []models.Item{
+			{KisimID: 1, KisimName: "Temel Gıda", Quantity: 2, UnitPrice: 550, TotalPrice: 1100, TaxRate: 10},
+			{KisimID: 2, KisimName: "Genel", Quantity: 1, UnitPrice: 120, TotalPrice: 120, TaxRate: 20},
+		},
+		TaxBreakdown: models.TaxBreakdown{
+			Tax10Percent: models.TaxDetail{TaxableAmount: 1000, TaxAmount: 100},
+			Tax20Percent: models.TaxDetail{TaxableAmount: 100, TaxAmount: 20},
+			TotalTax:     120,
+		},
+		TotalAmount:   1220,
+		PaymentMethod: "Nakit",
+		ReceiptSerial: "F0001",
+	}
+
+	document := receiptpdf.Render(receipt, newTestBundle(t, nil).Localizer("tr"), nil)
+
+	if !bytes.HasPrefix(document, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(document, []byte("%%EOF\n")) {
+		t.Fatal("Missing PDF header or trailer")
+	}
+
+	// Every cross-reference entry must point at its object
+	xrefAt := bytes.LastIndex(document, []byte("startxref\n"))
+	start, err := strconv.Atoi(string(bytes.Fields(document[xrefAt+len("startxref\n"):])[0]))
+	if err != nil || !bytes.HasPrefix(document[start:], []byte("xref\n")) {
+		t.Fatalf("startxref does not point at the xref table")
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(document[start:], -1)
+	if len(entries) == 0 {
+		t.Fatal("Empty xref table")
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(document[offset:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q", i+1, document[offset:offset+10])
+		}
+	}
+
+	// Text is drawn in the re-encoded Courier: İ is 0xDD, Ş 0xDE, ğ 0xF0, ı 0xFD, ş 0xFE
+	for _, want := range []string{
+		"(TAR\xddH: 29.03.2025)",
+		"(F\xdd\xde NO: F0001)",
+		"(KDV MATRAHI %10)", "(*1.000,00)", "(KDV %20)", "(*20,00)",
+		"(TOPKDV)", "(TOPLAM)", "(*1.220,00)",
+		"(NAK\xddT)",
+		"(Temel G\xfdda)",
+		"(B\xfcy\xfckdere Cad. No: 1 \\(Zemin Kat\\))",
+		"(MAL\xdd DE\xd0ER\xdd YOKTUR)",
+		"/BaseFont /Courier-Bold",
+	} {
+		if !bytes.Contains(document, []byte(want)) {
+			t.Errorf("PDF missing %q", want)
+		}
+	}
+
+	// The store name is wider than the paper, so it wraps onto two centered lines
+	if !bytes.Contains(document, []byte("(Demo Ma\xf0azas\xfd \xdei\xfeli \xdeubesi G\xfdda)")) {
+		t.Error("Expected the store name to wrap")
+	}
+}
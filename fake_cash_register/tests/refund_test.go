@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/history"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/services/mock"
+	"fake-cash-register/internal/stock"
+)
+
+// issueRefundableSale issues a sale of 3 × KISIM 1 and 1 × KISIM 2 on cashReg, keeping history
+func issueRefundableSale(t *testing.T, cashReg *cashregister.CashRegister) (*history.Store, *models.Receipt) {
+	t.Helper()
+
+	store, err := history.NewStore(filepath.Join(t.TempDir(), "history.jsonl"), false)
+	if err != nil {
+		t.Fatalf("Failed to create history store: %v", err)
+	}
+	cashReg.SetHistory(store)
+
+	cashReg.StartNewReceipt()
+	for _, item := range []struct{ kisim, quantity int }{{1, 3}, {2, 1}} {
+		if err := cashReg.AddItem(item.kisim, item.quantity, 0); err != nil {
+			t.Fatalf("Failed to add item: %v", err)
+		}
+	}
+	if err := cashReg.SetPaymentMethod("Kart"); err != nil {
+		t.Fatalf("Failed to set payment method: %v", err)
+	}
+	sale, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue sale: %v", err)
+	}
+	return store, sale
+}
+
+func TestRefundBySerial(t *testing.T) {
+	cashReg := createTestCashRegister(false)
+	store, sale := issueRefundableSale(t, cashReg)
+	levels, err := stock.NewStore(stock.Options{Initial: []stock.Initial{{KisimID: 1, Quantity: 10}}}, kisimLookup, false)
+	if err != nil {
+		t.Fatalf("Failed to create stock store: %v", err)
+	}
+	cashReg.SetStock(levels)
+
+	refund, err := cashReg.StartRefund(sale.ReceiptSerial)
+	if err != nil {
+		t.Fatalf("Failed to start refund: %v", err)
+	}
+	if refund.Original.TransactionID != sale.TransactionID || len(refund.Lines) != 2 || refund.Lines[0].Refundable != 3 {
+		t.Fatalf("Unexpected refund: %+v", refund)
+	}
+
+	// Only lines of the original, and no more than was sold
+	if err := cashReg.AddItem(1, 1, 0); !errors.Is(err, cashregister.ErrRefundLinesOnly) {
+		t.Errorf("Expected ErrRefundLinesOnly, got %v", err)
+	}
+	if err := cashReg.AddRefundItem(0, 4); !errors.Is(err, cashregister.ErrRefundExceeded) {
+		t.Errorf("Expected ErrRefundExceeded, got %v", err)
+	}
+	if err := cashReg.AddRefundItem(5, 1); !errors.Is(err, cashregister.ErrNoSuchLine) {
+		t.Errorf("Expected ErrNoSuchLine, got %v", err)
+	}
+	for range 2 {
+		if err := cashReg.AddRefundItem(0, 1); err != nil {
+			t.Fatalf("Failed to refund line 0: %v", err)
+		}
+	}
+	if err := cashReg.AddRefundItem(0, 2); !errors.Is(err, cashregister.ErrRefundExceeded) {
+		t.Errorf("Expected ErrRefundExceeded with 1 left on the line, got %v", err)
+	}
+
+	issued, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue refund: %v", err)
+	}
+	if !issued.IsRefund() || issued.RefundOf.ReceiptSerial != sale.ReceiptSerial || issued.PaymentMethod != "Kart" {
+		t.Errorf("Unexpected refund receipt: %+v", issued)
+	}
+	if len(issued.Items) != 1 || issued.Items[0].Quantity != 2 {
+		t.Errorf("Expected the two refunded pieces on one line, got %+v", issued.Items)
+	}
+	if level, _ := levels.Level(1); level.Quantity != 12 {
+		t.Errorf("Expected the refunded pieces back in stock at 12, got %d", level.Quantity)
+	}
+
+	// The Z-report nets the refund off the sale
+	report := cashReg.CurrentZReport()
+	if report.RefundCount != 1 || report.RefundTotal != issued.TotalAmount {
+		t.Errorf("Expected 1 refund of %.2f, got %d of %.2f", issued.TotalAmount, report.RefundCount, report.RefundTotal)
+	}
+	if want := sale.TotalAmount - issued.TotalAmount; report.TotalAmount != want {
+		t.Errorf("Expected net total %.2f, got %.2f", want, report.TotalAmount)
+	}
+
+	// The next refund starts from what is left
+	refund, err = cashReg.StartRefund(sale.ReceiptSerial)
+	if err != nil {
+		t.Fatalf("Failed to start second refund: %v", err)
+	}
+	if refund.Lines[0].Refundable != 1 || refund.Lines[1].Refundable != 1 {
+		t.Fatalf("Expected 1 left on each line, got %+v", refund.Lines)
+	}
+	if err := cashReg.AddRefundItem(0, 1); err != nil {
+		t.Fatalf("Failed to refund line 0: %v", err)
+	}
+	if err := cashReg.AddRefundItem(1, 1); err != nil {
+		t.Fatalf("Failed to refund line 1: %v", err)
+	}
+	second, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue second refund: %v", err)
+	}
+	if got := issued.TotalAmount + second.TotalAmount; got != sale.TotalAmount {
+		t.Errorf("Expected refunds to add up to the sale's %.2f, got %.2f", sale.TotalAmount, got)
+	}
+
+	if _, err := cashReg.StartRefund(sale.ReceiptSerial); !errors.Is(err, cashregister.ErrNothingToRefund) {
+		t.Errorf("Expected ErrNothingToRefund, got %v", err)
+	}
+	if _, err := cashReg.StartRefund(second.ReceiptSerial); !errors.Is(err, cashregister.ErrOriginalNotFound) {
+		t.Errorf("Expected ErrOriginalNotFound for a refund's serial, got %v", err)
+	}
+	signed, _ := store.Signed(second.TransactionID)
+	if _, err := cashReg.StartRefundFromSigned(signed); !errors.Is(err, cashregister.ErrNotRefundable) {
+		t.Errorf("Expected ErrNotRefundable for a scanned refund, got %v", err)
+	}
+}
+
+func TestRefundFromSignedReceipt(t *testing.T) {
+	revenueAuth := mock.NewMockRevenueAuthority(false)
+	receiptBank := mock.NewMockReceiptBank(false)
+	cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup, revenueAuth, receiptBank, crypto.NewCryptoService(false), false)
+	store, sale := issueRefundableSale(t, cashReg)
+	signed, ok := store.Signed(sale.TransactionID)
+	if !ok {
+		t.Fatal("Signed receipt not kept in history")
+	}
+
+	// A register without the sale in history takes the signed receipt the customer
+	// shows, but only when the refunds it issues are kept in a history file
+	other := cashregister.NewCashRegister(storeInfo, kisimLookup, revenueAuth, receiptBank, crypto.NewCryptoService(false), false)
+	if _, err := other.StartRefund(sale.ReceiptSerial); !errors.Is(err, cashregister.ErrOriginalNotFound) {
+		t.Errorf("Expected ErrOriginalNotFound without history, got %v", err)
+	}
+	if _, err := other.StartRefundFromSigned(signed); !errors.Is(err, cashregister.ErrRefundsUntracked) {
+		t.Errorf("Expected ErrRefundsUntracked without history, got %v", err)
+	}
+	memory, _ := history.NewStore("", false)
+	other.SetHistory(memory)
+	if _, err := other.StartRefundFromSigned(signed); !errors.Is(err, cashregister.ErrRefundsUntracked) {
+		t.Errorf("Expected ErrRefundsUntracked with history in memory, got %v", err)
+	}
+	otherHistory, err := history.NewStore(filepath.Join(t.TempDir(), "other.jsonl"), false)
+	if err != nil {
+		t.Fatalf("Failed to create history store: %v", err)
+	}
+	other.SetHistory(otherHistory)
+	tampered := append([]byte{}, signed...)
+	tampered[11] ^= 0x01 // Low byte of the timestamp
+	if _, err := cashReg.StartRefundFromSigned(tampered); !errors.Is(err, binary.ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a tampered receipt, got %v", err)
+	}
+	if cashReg.HasActiveReceipt() {
+		t.Error("A rejected refund left a receipt open")
+	}
+
+	refund, err := other.StartRefundFromSigned(signed)
+	if err != nil {
+		t.Fatalf("Failed to start refund from the signed receipt: %v", err)
+	}
+	if refund.Original.ReceiptSerial != sale.ReceiptSerial || refund.Original.Items[0].KisimName == "" {
+		t.Errorf("Unexpected original: %+v", refund.Original)
+	}
+	if err := other.AddRefundItem(1, 1); err != nil {
+		t.Fatalf("Failed to refund line 1: %v", err)
+	}
+	if current := other.CurrentRefund(); current == nil || current.Lines[1].Refundable != 0 || current.Lines[1].RefundableAmount != 0 {
+		t.Errorf("Expected nothing left on line 1, got %+v", current)
+	}
+}
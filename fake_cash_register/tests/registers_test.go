@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/history"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/registers"
+	"fake-cash-register/internal/services/mock"
+)
+
+// pathRecorder answers with the register ID and the path it was given
+func pathRecorder(id string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, id+" "+r.URL.Path)
+	})
+}
+
+func TestRegistersRouting(t *testing.T) {
+	set := registers.NewSet(false)
+	for _, id := range []string{"kadikoy", "besiktas"} {
+		if err := set.Add(&registers.Register{ID: id, CashRegister: createTestCashRegister(false), Handler: pathRecorder(id)}); err != nil {
+			t.Fatalf("Failed to add register %s: %v", id, err)
+		}
+	}
+	if err := set.Add(&registers.Register{ID: "besiktas", CashRegister: createTestCashRegister(false)}); err == nil {
+		t.Error("Expected an error for a duplicate register ID")
+	}
+	if err := set.Add(&registers.Register{ID: "a/b", CashRegister: createTestCashRegister(false)}); err == nil {
+		t.Error("Expected an error for a register ID with a slash")
+	}
+
+	tests := []struct {
+		path, header string
+		status       int
+		body         string
+	}{
+		{"/api/kisim", "", http.StatusOK, "kadikoy /api/kisim"},
+		{"/r/besiktas/api/kisim", "", http.StatusOK, "besiktas /api/kisim"},
+		{"/r/besiktas/", "", http.StatusOK, "besiktas /"},
+		{"/api/kisim", "besiktas", http.StatusOK, "besiktas /api/kisim"},
+		{"/r/kadikoy/api/kisim", "besiktas", http.StatusOK, "kadikoy /api/kisim"}, // The prefix wins
+		{"/r/besiktas", "", http.StatusMovedPermanently, ""},
+		{"/r/sisli/api/kisim", "", http.StatusNotFound, ""},
+		{"/api/kisim", "sisli", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set(registers.Header, tt.header)
+		}
+		w := httptest.NewRecorder()
+		set.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s (%q): expected status %d, got %d", tt.path, tt.header, tt.status, w.Code)
+			continue
+		}
+		switch {
+		case tt.status == http.StatusNotFound:
+			var apiErr api.APIError
+			if json.Unmarshal(w.Body.Bytes(), &apiErr) != nil || apiErr.Code != api.ErrorCodeRegisterNotFound {
+				t.Errorf("%s: expected REGISTER_NOT_FOUND, got %s", tt.path, w.Body.String())
+			}
+		case tt.body != "" && w.Body.String() != tt.body:
+			t.Errorf("%s (%q): expected %q, got %q", tt.path, tt.header, tt.body, w.Body.String())
+		}
+	}
+}
+
+func TestRegistersKeepTheirOwnCounters(t *testing.T) {
+	// Shared downstream services, as cmd/main.go sets them up
+	revenueAuth := mock.NewMockRevenueAuthority(false)
+	receiptBank := mock.NewMockReceiptBank(false)
+	cryptoService := crypto.NewCryptoService(false)
+	newRegister := func(vkn, name string) *cashregister.CashRegister {
+		store := interfaces.StoreInfo{VKN: vkn, Name: name, Address: "İstanbul"}
+		cashReg := cashregister.NewCashRegister(store, kisimLookup, revenueAuth, receiptBank, cryptoService, false)
+		receipts, _ := history.NewStore("", false)
+		cashReg.SetHistory(receipts)
+		return cashReg
+	}
+
+	set := registers.NewSet(false)
+	kadikoy, besiktas := newRegister("1234567890", "Kadıköy"), newRegister("2345678901", "Beşiktaş")
+	besiktas.SetSerialStart(5001)
+	set.Add(&registers.Register{ID: "kadikoy", CashRegister: kadikoy})
+	set.Add(&registers.Register{ID: "besiktas", CashRegister: besiktas})
+	receiptBank.SetWebhookHandler(set)
+
+	besiktas.StartNewReceipt()
+	besiktas.AddItem(1, 1, 0)
+	besiktas.SetPaymentMethod("Nakit")
+	if _, err := besiktas.IssueCurrentReceipt(newTestEphemeralKey(t)); err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+
+	// The mock bank's collection reaches the register that issued the receipt
+	deadline := time.Now().Add(3 * time.Second)
+	for besiktas.TransactionStats().Confirmed == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if besiktas.TransactionStats().Confirmed != 1 {
+		t.Error("Collection was not confirmed at the issuing register")
+	}
+
+	summaries := set.Summaries()
+	if len(summaries) != 2 {
+		t.Fatalf("Expected two summaries, got %d", len(summaries))
+	}
+	k, b := summaries[0], summaries[1]
+	if !k.Default || k.NextSerial != "F0001" || k.Receipts != 0 || k.VKN != "1234567890" {
+		t.Errorf("Unexpected summary for kadikoy: %+v", k)
+	}
+	if b.Default || b.NextSerial != "F5002" || b.Receipts != 1 || b.VKN != "2345678901" || b.Path != "/r/besiktas/" {
+		t.Errorf("Unexpected summary for besiktas: %+v", b)
+	}
+	if receipt, ok := besiktas.History().FindBySerial("F5001"); !ok || receipt.StoreVKN != "2345678901" {
+		t.Errorf("Receipt not issued under besiktas' serial and VKN: %+v", receipt)
+	}
+	if kadikoy.History().Count() != 0 {
+		t.Error("The receipt was recorded at the other register")
+	}
+}
+
+func TestConfigForRegister(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Store.ReceiptTemplate = "receipt.tmpl"
+	cfg.History.File = "receipt_history.jsonl"
+	cfg.ZReport.File = "data/z_reports.jsonl"
+	cfg.Audit.File = "audit_log"
+	cfg.Kisim = []config.Kisim{{ID: 1, Name: "Gıda"}}
+
+	registerCfg := cfg.ForRegister(config.Register{ID: "besiktas", Store: config.Store{VKN: "2345678901"}})
+	if registerCfg.History.File != "receipt_history.besiktas.jsonl" ||
+		registerCfg.ZReport.File != "data/z_reports.besiktas.jsonl" ||
+		registerCfg.Audit.File != "audit_log.besiktas" ||
+		registerCfg.Holds.File != "" {
+		t.Errorf("Unexpected register files: history %q, Z-reports %q, audit %q, holds %q",
+			registerCfg.History.File, registerCfg.ZReport.File, registerCfg.Audit.File, registerCfg.Holds.File)
+	}
+	if registerCfg.Store.VKN != "2345678901" || registerCfg.Store.ReceiptTemplate != "receipt.tmpl" {
+		t.Errorf("Unexpected register store: %+v", registerCfg.Store)
+	}
+	if len(registerCfg.Kisim) != 1 || cfg.History.File != "receipt_history.jsonl" {
+		t.Error("Register configuration changed the shared configuration")
+	}
+}
@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/resilience"
+)
+
+var errTransient = errors.New("connection refused")
+
+func newTestBreaker(maxAttempts, threshold int, openTimeout time.Duration) *resilience.Breaker {
+	return resilience.NewBreaker("revenue authority", resilience.Policy{
+		MaxAttempts:      maxAttempts,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         2 * time.Millisecond,
+		FailureThreshold: threshold,
+		OpenTimeout:      openTimeout,
+	}, false)
+}
+
+func TestBreakerRetriesTransientErrors(t *testing.T) {
+	breaker := newTestBreaker(3, 10, time.Minute)
+
+	attempts := 0
+	err := breaker.Do(func() error {
+		attempts++
+		if attempts < 3 {
+			return errTransient
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected success on third attempt, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+
+	stats := breaker.Stats()
+	if stats.Retries != 2 || stats.Failures != 2 || stats.Successes != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if stats.ConsecutiveFailures != 0 || stats.State != resilience.StateClosed {
+		t.Errorf("Expected closed circuit with no consecutive failures, got %+v", stats)
+	}
+}
+
+func TestBreakerDoesNotRetryPermanentErrors(t *testing.T) {
+	breaker := newTestBreaker(3, 1, time.Minute)
+
+	attempts := 0
+	err := breaker.Do(func() error {
+		attempts++
+		return resilience.Permanent(errors.New("invalid hash"))
+	})
+	if err == nil || !resilience.IsPermanent(err) {
+		t.Fatalf("Expected permanent error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+	if state := breaker.Stats().State; state != resilience.StateClosed {
+		t.Errorf("Permanent errors must not open the circuit, got %s", state)
+	}
+}
+
+func TestBreakerHonoursRetryAfter(t *testing.T) {
+	breaker := resilience.NewBreaker("receipt bank", resilience.Policy{
+		MaxAttempts:      2,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         time.Second,
+		FailureThreshold: 10,
+		OpenTimeout:      time.Minute,
+	}, false)
+
+	// A Retry-After within the backoff cap is waited out
+	var calls []time.Time
+	err := breaker.Do(func() error {
+		calls = append(calls, time.Now())
+		if len(calls) == 1 {
+			return resilience.RetryAfter(errTransient, 50*time.Millisecond)
+		}
+		return nil
+	})
+	if err != nil || len(calls) != 2 {
+		t.Fatalf("Expected success on the second attempt, got %v after %d", err, len(calls))
+	}
+	if waited := calls[1].Sub(calls[0]); waited < 50*time.Millisecond {
+		t.Errorf("Retried after %v, before the 50ms Retry-After", waited)
+	}
+
+	// One beyond it is not retried early
+	attempts := 0
+	err = breaker.Do(func() error {
+		attempts++
+		return resilience.RetryAfter(errTransient, time.Minute)
+	})
+	if !errors.Is(err, errTransient) || attempts != 1 {
+		t.Errorf("Expected one attempt for a Retry-After above MaxDelay, got %d (%v)", attempts, err)
+	}
+}
+
+func TestBreakerOpensAndShortCircuits(t *testing.T) {
+	breaker := newTestBreaker(1, 3, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if err := breaker.Do(func() error { return errTransient }); !errors.Is(err, errTransient) {
+			t.Fatalf("Call %d: expected transient error, got %v", i, err)
+		}
+	}
+
+	called := false
+	err := breaker.Do(func() error {
+		called = true
+		return nil
+	})
+	if called {
+		t.Error("Open circuit should not call the service")
+	}
+	if !errors.Is(err, resilience.ErrCircuitOpen) {
+		t.Fatalf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "revenue authority unavailable") {
+		t.Errorf("Expected service name in error, got %q", err.Error())
+	}
+
+	stats := breaker.Stats()
+	if stats.State != resilience.StateOpen || stats.ShortCircuits != 1 || stats.OpenedAt == nil {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestBreakerHalfOpenRecovery(t *testing.T) {
+	breaker := newTestBreaker(1, 1, 20*time.Millisecond)
+
+	breaker.Do(func() error { return errTransient })
+	if state := breaker.Stats().State; state != resilience.StateOpen {
+		t.Fatalf("Expected open circuit, got %s", state)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if state := breaker.Stats().State; state != resilience.StateHalfOpen {
+		t.Fatalf("Expected half-open circuit after timeout, got %s", state)
+	}
+
+	// Failed trial call reopens the circuit
+	breaker.Do(func() error { return errTransient })
+	if state := breaker.Stats().State; state != resilience.StateOpen {
+		t.Fatalf("Expected circuit to reopen after failed trial, got %s", state)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err := breaker.Do(func() error { return nil }); err != nil {
+		t.Fatalf("Expected trial call to succeed, got %v", err)
+	}
+	if state := breaker.Stats().State; state != resilience.StateClosed {
+		t.Errorf("Expected closed circuit after successful trial, got %s", state)
+	}
+}
+
+func TestRegistryStats(t *testing.T) {
+	registry := resilience.NewRegistry()
+	registry.Add(resilience.NewBreaker("revenue authority", resilience.Policy{}, false))
+	registry.Add(resilience.NewBreaker("receipt bank", resilience.Policy{}, false))
+
+	stats := registry.Stats()
+	if len(stats) != 2 || stats[0].Name != "revenue authority" || stats[1].Name != "receipt bank" {
+		t.Errorf("Unexpected registry stats: %+v", stats)
+	}
+}
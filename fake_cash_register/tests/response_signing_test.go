@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	rwcrypto "receiptwallet/crypto"
+
+	"fake-cash-register/internal/services/real"
+)
+
+// signingAuthority answers /sign and /public-key like the revenue authority with
+// signing.sign_responses, signing responses with responseKey and serving servedKey
+func signingAuthority(t *testing.T, responseKey *ecdsa.PrivateKey, servedKey *ecdsa.PublicKey) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		switch r.URL.Path {
+		case "/sign":
+			body, _ = json.Marshal(map[string]string{"signature": base64.StdEncoding.EncodeToString(make([]byte, 64))})
+		case "/public-key":
+			der, _ := x509.MarshalPKIXPublicKey(servedKey)
+			body, _ = json.Marshal(map[string]string{"public_key": base64.StdEncoding.EncodeToString(der)})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		signature, err := rwcrypto.SignResponse(responseKey, r.Header.Get(rwcrypto.ResponseNonceHeader), r.URL.Path, http.StatusOK, body)
+		if err != nil {
+			t.Errorf("Failed to sign response: %v", err)
+		}
+		w.Header().Set(rwcrypto.ResponseSignatureHeader, signature)
+		w.Write(body)
+	}))
+}
+
+func TestRevenueAuthorityResponseSigning(t *testing.T) {
+	authorityKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	mitmKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	hash := sha256.Sum256([]byte("receipt"))
+
+	authority := signingAuthority(t, authorityKey, &authorityKey.PublicKey)
+	defer authority.Close()
+
+	revenueAuth := real.NewRealRevenueAuthority(authority.URL, "", false)
+	revenueAuth.SetResponseKey(&authorityKey.PublicKey)
+	if _, err := revenueAuth.SignHash(hash[:]); err != nil {
+		t.Errorf("Signed /sign response rejected: %v", err)
+	}
+	if _, err := revenueAuth.GetPublicKey(); err != nil {
+		t.Errorf("Signed /public-key response rejected: %v", err)
+	}
+
+	// A man in the middle re-signs with its own key and serves its own public key
+	mitm := signingAuthority(t, mitmKey, &mitmKey.PublicKey)
+	defer mitm.Close()
+
+	revenueAuth = real.NewRealRevenueAuthority(mitm.URL, "", false)
+	revenueAuth.SetResponseKey(&authorityKey.PublicKey)
+	if _, err := revenueAuth.SignHash(hash[:]); !errors.Is(err, rwcrypto.ErrInvalidResponseSignature) {
+		t.Errorf("Expected a substituted signature to be refused, got %v", err)
+	}
+	if _, err := revenueAuth.GetPublicKey(); !errors.Is(err, rwcrypto.ErrInvalidResponseSignature) {
+		t.Errorf("Expected a substituted public key to be refused, got %v", err)
+	}
+
+	// Signed by the right key, but serving another public key
+	rotated := signingAuthority(t, authorityKey, &mitmKey.PublicKey)
+	defer rotated.Close()
+
+	revenueAuth = real.NewRealRevenueAuthority(rotated.URL, "", false)
+	revenueAuth.SetResponseKey(&authorityKey.PublicKey)
+	if _, err := revenueAuth.GetPublicKey(); err == nil {
+		t.Error("Expected a public key other than the pinned one to be refused")
+	}
+
+	// Without a pinned key, responses are not checked
+	revenueAuth = real.NewRealRevenueAuthority(mitm.URL, "", false)
+	if _, err := revenueAuth.SignHash(hash[:]); err != nil {
+		t.Errorf("Expected unpinned client to accept the response, got %v", err)
+	}
+}
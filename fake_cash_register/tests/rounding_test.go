@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"testing"
+
+	"fake-cash-register/internal/rounding"
+)
+
+func TestRoundingPolicy(t *testing.T) {
+	policy, err := rounding.NewPolicy([]rounding.Rule{
+		{PaymentMethod: "Nakit", Increment: 5},
+		{PaymentMethod: "Yemek Kartı", Increment: 10, Mode: rounding.ModeDown},
+		{PaymentMethod: "Çek", Increment: 25, Mode: rounding.ModeUp},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	cases := []struct {
+		total  float64
+		method string
+		want   float64
+		ok     bool
+	}{
+		{12.37, "Nakit", 12.35, true},
+		{12.38, "Nakit", 12.40, true},
+		{12.375, "Nakit", 12.40, true}, // 1237.5 kuruş rounds to 1238 first
+		{12.35, "Nakit", 12.35, true},
+		{12.39, "Yemek Kartı", 12.30, true},
+		{12.01, "Çek", 12.25, true},
+		{12.37, "Kart", 12.37, false},
+	}
+	for _, tc := range cases {
+		got, ok := policy.Round(tc.total, tc.method)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("Round(%.3f, %s) = %.2f, %v; want %.2f, %v", tc.total, tc.method, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestRoundingPolicyValidation(t *testing.T) {
+	invalid := map[string][]rounding.Rule{
+		"missing method": {{Increment: 5}},
+		"zero increment": {{PaymentMethod: "Nakit"}},
+		"unknown mode":   {{PaymentMethod: "Nakit", Increment: 5, Mode: "half_even"}},
+		"duplicate":      {{PaymentMethod: "Nakit", Increment: 5}, {PaymentMethod: "Nakit", Increment: 10}},
+	}
+	for name, rules := range invalid {
+		if _, err := rounding.NewPolicy(rules); err == nil {
+			t.Errorf("Expected %s to be refused", name)
+		}
+	}
+}
+
+func TestReceiptRounding(t *testing.T) {
+	policy, err := rounding.NewPolicy([]rounding.Rule{{PaymentMethod: "Nakit", Increment: 5}})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	cashReg := createTestCashRegister(false)
+	cashReg.SetRounding(policy)
+
+	sell := func(price float64, method string) {
+		t.Helper()
+		if err := cashReg.StartNewReceipt(); err != nil {
+			t.Fatalf("Failed to start receipt: %v", err)
+		}
+		if err := cashReg.AddItem(3, 1, price); err != nil {
+			t.Fatalf("Failed to add item: %v", err)
+		}
+		if err := cashReg.SetPaymentMethod(method); err != nil {
+			t.Fatalf("Failed to set payment method: %v", err)
+		}
+	}
+
+	sell(12.37, "Nakit")
+	cash, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+	if cash.TotalAmount != 12.37 || cash.AmountDue != 12.35 || cash.Rounding != -0.02 {
+		t.Errorf("Expected 12.37 rounded to 12.35 (-0.02), got total %.2f due %.2f rounding %.2f",
+			cash.TotalAmount, cash.AmountDue, cash.Rounding)
+	}
+
+	sell(12.38, "Kart")
+	card, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+	if card.Rounding != 0 || card.AmountDue != 0 {
+		t.Errorf("Expected card payments to be charged exactly, got due %.2f rounding %.2f", card.AmountDue, card.Rounding)
+	}
+
+	report := cashReg.CurrentZReport()
+	if report.Rounding != -0.02 || report.RoundingTotals["Nakit"] != -0.02 {
+		t.Errorf("Expected -0.02 cash rounding in the Z-report, got %.2f %v", report.Rounding, report.RoundingTotals)
+	}
+	if report.TotalAmount != 24.75 {
+		t.Errorf("Expected the fiscal total to stay unrounded, got %.2f", report.TotalAmount)
+	}
+}
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/scale"
+)
+
+func TestParseScaleLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		grams  int
+		stable bool
+	}{
+		{"ST,GS,+  1.234kg", 1234, true},
+		{"US,NT,+  0.455kg\r", 455, false},
+		{"ST,GS,-  0.010kg", -10, true},
+		{"1,250 kg", 1250, true},
+		{" 875 g", 875, true},
+	}
+	for _, tt := range tests {
+		reading, err := scale.ParseLine(tt.line)
+		if err != nil {
+			t.Errorf("%q: %v", tt.line, err)
+			continue
+		}
+		if reading.Grams != tt.grams || reading.Stable != tt.stable {
+			t.Errorf("%q: got %d g stable=%v, want %d g stable=%v", tt.line, reading.Grams, reading.Stable, tt.grams, tt.stable)
+		}
+	}
+
+	for _, line := range []string{"", "1.234", "XX,GS,+ 1.234kg", "ST,GS,+ abc kg", "NaN kg"} {
+		if _, err := scale.ParseLine(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
+
+func TestScaleWeight(t *testing.T) {
+	s := scale.New(time.Second, false)
+	if _, err := s.Weight(); !errors.Is(err, scale.ErrNoReading) {
+		t.Errorf("Expected ErrNoReading before any reading, got %v", err)
+	}
+
+	s.Set(scale.Reading{Grams: 0, Stable: true})
+	if _, err := s.Weight(); !errors.Is(err, scale.ErrNoReading) {
+		t.Errorf("Expected ErrNoReading for an empty scale, got %v", err)
+	}
+
+	s.Set(scale.Reading{Grams: 640, Stable: true, At: time.Now().Add(-2 * time.Second)})
+	if _, err := s.Weight(); !errors.Is(err, scale.ErrStale) {
+		t.Errorf("Expected ErrStale for an old reading, got %v", err)
+	}
+
+	s.Set(scale.Reading{Grams: 640, Stable: true})
+	if grams, err := s.Weight(); err != nil || grams != 640 {
+		t.Errorf("Expected 640 g, got %d (%v)", grams, err)
+	}
+}
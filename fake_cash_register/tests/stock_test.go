@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"fake-cash-register/internal/stock"
+)
+
+func TestStockTakenDownBySales(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "stock.jsonl")
+	store, err := stock.NewStore(stock.Options{
+		File:     file,
+		LowStock: 2,
+		Initial:  []stock.Initial{{KisimID: 1, Quantity: 5}, {KisimID: 2, Quantity: 20, LowStock: 15}},
+	}, kisimLookup, false)
+	if err != nil {
+		t.Fatalf("Failed to create stock store: %v", err)
+	}
+
+	cashReg := createTestCashRegister(false)
+	cashReg.SetStock(store)
+	cashReg.StartNewReceipt()
+
+	// KISIM 3 isn't tracked, so it never runs out
+	for _, item := range []struct{ kisim, quantity int }{{1, 2}, {1, 1}, {2, 3}, {3, 50}} {
+		if err := cashReg.AddItem(item.kisim, item.quantity, 0); err != nil {
+			t.Fatalf("Failed to add item: %v", err)
+		}
+	}
+
+	// 5 - 3 leaves KISIM 1 at its threshold of 2; KISIM 2 would keep 17 of 15
+	warnings := cashReg.StockWarnings()
+	if len(warnings) != 1 || warnings[0].KisimID != 1 || warnings[0].Quantity != 2 {
+		t.Errorf("Expected a low stock warning for KISIM 1 at 2, got %+v", warnings)
+	}
+	if level, _ := store.Level(1); level.Quantity != 5 {
+		t.Errorf("Stock changed before the receipt was issued: %d", level.Quantity)
+	}
+
+	cashReg.SetPaymentMethod("Nakit")
+	if _, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t)); err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+
+	for kisimID, want := range map[int]int{1: 2, 2: 17} {
+		if level, _ := store.Level(kisimID); level.Quantity != want {
+			t.Errorf("Expected KISIM %d at %d, got %d", kisimID, want, level.Quantity)
+		}
+	}
+	if _, tracked := store.Level(3); tracked {
+		t.Error("Selling an untracked KISIM started tracking it")
+	}
+	if low := store.Low(); len(low) != 1 || low[0].KisimID != 1 {
+		t.Errorf("Expected KISIM 1 to be low, got %+v", low)
+	}
+
+	// Levels are rebuilt from the ledger, ignoring the opening levels
+	reloaded, err := stock.NewStore(stock.Options{
+		File:    file,
+		Initial: []stock.Initial{{KisimID: 1, Quantity: 100}},
+	}, kisimLookup, false)
+	if err != nil {
+		t.Fatalf("Failed to reload stock: %v", err)
+	}
+	if level, _ := reloaded.Level(1); level.Quantity != 2 {
+		t.Errorf("Expected reloaded KISIM 1 at 2, got %d", level.Quantity)
+	}
+}
+
+func TestStockBlocksSales(t *testing.T) {
+	store, err := stock.NewStore(stock.Options{
+		BlockSales: true,
+		Initial:    []stock.Initial{{KisimID: 1, Quantity: 3}},
+	}, kisimLookup, false)
+	if err != nil {
+		t.Fatalf("Failed to create stock store: %v", err)
+	}
+
+	cashReg := createTestCashRegister(false)
+	cashReg.SetStock(store)
+	cashReg.StartNewReceipt()
+
+	if err := cashReg.AddItem(1, 2, 0); err != nil {
+		t.Fatalf("Failed to add item in stock: %v", err)
+	}
+
+	// Merging into the existing line needs 4 of the 3 in stock
+	err = cashReg.AddItem(1, 2, 0)
+	var shortage *stock.ShortageError
+	if !errors.As(err, &shortage) || !errors.Is(err, stock.ErrOutOfStock) {
+		t.Fatalf("Expected a shortage error, got %v", err)
+	}
+	if shortage.Available != 3 || shortage.Requested != 4 {
+		t.Errorf("Expected 3 available and 4 requested, got %+v", shortage)
+	}
+	if cashReg.GetCurrentReceipt().Items[0].Quantity != 2 {
+		t.Error("Refused item changed the receipt")
+	}
+
+	// Stock sold elsewhere in the meantime is caught when issuing
+	if _, err := cashReg.AdjustStock(1, -2, stock.ReasonDamage); err != nil {
+		t.Fatalf("Failed to adjust stock: %v", err)
+	}
+	cashReg.SetPaymentMethod("Nakit")
+	if _, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t)); !errors.Is(err, stock.ErrOutOfStock) {
+		t.Errorf("Expected issuing to be refused, got %v", err)
+	}
+	if !cashReg.HasActiveReceipt() {
+		t.Error("Receipt refused for stock should stay open")
+	}
+}
+
+func TestStockAdjustAndCount(t *testing.T) {
+	store, err := stock.NewStore(stock.Options{LowStock: 5}, kisimLookup, false)
+	if err != nil {
+		t.Fatalf("Failed to create stock store: %v", err)
+	}
+	cashReg := createTestCashRegister(false)
+	cashReg.SetStock(store)
+
+	level, err := cashReg.AdjustStock(2, 24, stock.ReasonDelivery)
+	if err != nil || level.Quantity != 24 || level.Name != "Test Kisim 2" || level.LowStock != 5 {
+		t.Fatalf("Expected a delivery to start tracking at 24, got %+v, %v", level, err)
+	}
+	if level, _ := cashReg.AdjustStock(2, 1, stock.ReasonRefund); level.Quantity != 25 {
+		t.Errorf("Expected a refund to bring the level to 25, got %d", level.Quantity)
+	}
+
+	level, err = cashReg.CountStock(2, 21)
+	if err != nil || level.Quantity != 21 {
+		t.Errorf("Expected the count to set the level to 21, got %+v, %v", level, err)
+	}
+
+	for _, bad := range []struct {
+		kisim, delta int
+		reason       string
+		want         error
+	}{
+		{2, 0, stock.ReasonDelivery, stock.ErrInvalidAdjustment},
+		{2, 5, stock.ReasonSale, stock.ErrInvalidAdjustment},
+		{2, 5, "gift", stock.ErrInvalidAdjustment},
+		{99, 5, stock.ReasonDelivery, stock.ErrUnknownKisim},
+	} {
+		if _, err := cashReg.AdjustStock(bad.kisim, bad.delta, bad.reason); !errors.Is(err, bad.want) {
+			t.Errorf("AdjustStock(%d, %d, %q): expected %v, got %v", bad.kisim, bad.delta, bad.reason, bad.want, err)
+		}
+	}
+	if _, err := cashReg.CountStock(2, -1); !errors.Is(err, stock.ErrInvalidAdjustment) {
+		t.Errorf("Expected a negative count to be refused, got %v", err)
+	}
+
+	if _, err := stock.NewStore(stock.Options{Initial: []stock.Initial{{KisimID: 99}}}, kisimLookup, false); !errors.Is(err, stock.ErrUnknownKisim) {
+		t.Errorf("Expected an opening level for an unknown KISIM to be refused, got %v", err)
+	}
+}
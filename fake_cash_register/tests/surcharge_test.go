@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"math"
+	"testing"
+
+	"fake-cash-register/internal/surcharge"
+)
+
+func TestSurchargePolicy(t *testing.T) {
+	policy, err := surcharge.NewPolicy([]surcharge.Rule{
+		{PaymentMethod: "Kart", Name: "Kart komisyonu", Percent: 2, TaxRate: 20},
+		{PaymentMethod: "Kart", Name: "Teslimat", Amount: 15, TaxRate: 20},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	lines := policy.Apply(20.37, "Kart")
+	if len(lines) != 2 || lines[0].Amount != 0.41 || lines[1].Amount != 15 || lines[0].Name != "Kart komisyonu" {
+		t.Errorf("Unexpected surcharges for 20.37 by card: %+v", lines)
+	}
+	if lines := policy.Apply(0.20, "Kart"); len(lines) != 1 || lines[0].Name != "Teslimat" {
+		t.Errorf("Expected a fee that rounds to zero to be left out, got %+v", lines)
+	}
+	if lines := policy.Apply(20.37, "Nakit"); lines != nil {
+		t.Errorf("Expected no surcharges for cash, got %+v", lines)
+	}
+}
+
+func TestSurchargePolicyValidation(t *testing.T) {
+	invalid := map[string][]surcharge.Rule{
+		"missing method":     {{Name: "Komisyon", Percent: 2}},
+		"missing name":       {{PaymentMethod: "Kart", Percent: 2}},
+		"no fee":             {{PaymentMethod: "Kart", Name: "Komisyon"}},
+		"percent and amount": {{PaymentMethod: "Kart", Name: "Komisyon", Percent: 2, Amount: 1}},
+		"negative":           {{PaymentMethod: "Kart", Name: "Komisyon", Percent: -2}},
+		"tax rate":           {{PaymentMethod: "Kart", Name: "Komisyon", Percent: 2, TaxRate: 120}},
+		"uncarried tax rate": {{PaymentMethod: "Kart", Name: "Komisyon", Percent: 2, TaxRate: 8}},
+		"duplicate":          {{PaymentMethod: "Kart", Name: "Komisyon", Percent: 2}, {PaymentMethod: "Kart", Name: "Komisyon", Amount: 1}},
+	}
+	for name, rules := range invalid {
+		if _, err := surcharge.NewPolicy(rules); err == nil {
+			t.Errorf("Expected %s to be refused", name)
+		}
+	}
+}
+
+func TestReceiptSurcharges(t *testing.T) {
+	policy, err := surcharge.NewPolicy([]surcharge.Rule{{PaymentMethod: "Kart", Name: "Kart komisyonu", Percent: 2, TaxRate: 20}})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	cashReg := createTestCashRegister(false)
+	cashReg.SetSurcharges(policy)
+
+	sell := func(price float64, method string) {
+		t.Helper()
+		if err := cashReg.StartNewReceipt(); err != nil {
+			t.Fatalf("Failed to start receipt: %v", err)
+		}
+		if err := cashReg.AddItem(3, 1, price); err != nil {
+			t.Fatalf("Failed to add item: %v", err)
+		}
+		if err := cashReg.SetPaymentMethod(method); err != nil {
+			t.Fatalf("Failed to set payment method: %v", err)
+		}
+	}
+
+	// 120.00 at 10% and a 2.40 fee at 20%: 10.91 + 0.40 KDV
+	sell(120, "Kart")
+	card, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+	if len(card.Surcharges) != 1 || card.Surcharges[0].Amount != 2.40 {
+		t.Fatalf("Expected a 2.40 card surcharge, got %+v", card.Surcharges)
+	}
+	if math.Abs(card.TotalAmount-122.40) > 0.001 || math.Abs(card.TaxBreakdown.TotalTax-11.31) > 0.001 {
+		t.Errorf("Expected the surcharge in the total and KDV, got total %.2f tax %.2f", card.TotalAmount, card.TaxBreakdown.TotalTax)
+	}
+
+	sell(120, "Nakit")
+	cash, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+	if len(cash.Surcharges) != 0 || cash.TotalAmount != 120 {
+		t.Errorf("Expected cash to pay no surcharge, got %+v total %.2f", cash.Surcharges, cash.TotalAmount)
+	}
+
+	report := cashReg.CurrentZReport()
+	if report.Surcharges != 2.40 || report.SurchargeTotals["Kart komisyonu"] != 2.40 {
+		t.Errorf("Expected 2.40 card surcharges in the Z-report, got %.2f %v", report.Surcharges, report.SurchargeTotals)
+	}
+	if math.Abs(report.TotalAmount-242.40) > 0.001 {
+		t.Errorf("Expected the surcharge in the fiscal total, got %.2f", report.TotalAmount)
+	}
+}
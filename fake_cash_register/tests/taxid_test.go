@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"fake-cash-register/internal/taxid"
+)
+
+func TestValidateTaxNumber(t *testing.T) {
+	tests := []struct {
+		number string
+		kind   string // Empty when invalid
+	}{
+		{"1234567890", taxid.KindVKN},
+		{"4840847211", taxid.KindVKN},
+		{"1234567891", ""}, // Wrong check digit
+		{"10000000146", taxid.KindTCKN},
+		{"10000000147", ""}, // Wrong 11th digit
+		{"10000000156", ""}, // Wrong 10th digit
+		{"00000000146", ""}, // TCKNs never start with 0
+		{"123456789", ""},   // Too short
+		{"12345678901", ""}, // Fails the TCKN check
+		{"12345A7890", ""},  // Not a number
+		{"", ""},
+	}
+	for _, tt := range tests {
+		kind, err := taxid.Validate(tt.number)
+		if kind != tt.kind {
+			t.Errorf("Validate(%q) = %q, want %q", tt.number, kind, tt.kind)
+		}
+		if (tt.kind == "") != errors.Is(err, taxid.ErrInvalid) {
+			t.Errorf("Validate(%q) error = %v", tt.number, err)
+		}
+	}
+
+	if got := taxid.Normalize("123 456-78.90"); got != "1234567890" {
+		t.Errorf("Normalize kept separators: %q", got)
+	}
+	if got := taxid.Mask("10000000146"); got != "********146" {
+		t.Errorf("Mask = %q", got)
+	}
+}
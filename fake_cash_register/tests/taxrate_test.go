@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/history"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/services/mock"
+)
+
+func TestTaxRateAt(t *testing.T) {
+	july := time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)
+	january := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	info := models.KisimInfo{ID: 1, Name: "Temel Gıda", TaxRate: 8, TaxRates: []models.TaxRateChange{
+		{Rate: 10, ValidFrom: july},
+		{Rate: 12, ValidFrom: january},
+	}}
+
+	for _, tc := range []struct {
+		at   time.Time
+		want int
+	}{
+		{july.Add(-time.Second), 8},
+		{july, 10}, // In force from the first instant
+		{january.Add(-time.Nanosecond), 10},
+		{january, 12},
+		{january.AddDate(5, 0, 0), 12},
+	} {
+		if got := info.TaxRateAt(tc.at); got != tc.want {
+			t.Errorf("TaxRateAt(%s) = %d, want %d", tc.at.Format(time.RFC3339Nano), got, tc.want)
+		}
+	}
+	if rate := (models.KisimInfo{TaxRate: 20}).TaxRateAt(july); rate != 20 {
+		t.Errorf("Expected a KISIM without changes to keep its rate, got %d", rate)
+	}
+}
+
+func TestTaxRateChangeAtReceiptTime(t *testing.T) {
+	// KISIM 1 rises from 10% to 20% shortly; KISIM 2 fell from 20% to 10% an hour ago
+	boundary := time.Now().Add(500 * time.Millisecond)
+	lookup := models.KisimLookup{
+		1: {ID: 1, Name: "Temel Gıda", TaxRate: 10, PresetPrice: 110, TaxRates: []models.TaxRateChange{{Rate: 20, ValidFrom: boundary}}},
+		2: {ID: 2, Name: "Ekmek", TaxRate: 20, PresetPrice: 55, TaxRates: []models.TaxRateChange{{Rate: 10, ValidFrom: time.Now().Add(-time.Hour)}}},
+	}
+	cashReg := cashregister.NewCashRegister(storeInfo, lookup, mock.NewMockRevenueAuthority(false),
+		mock.NewMockReceiptBank(false), crypto.NewCryptoService(false), false)
+	store, err := history.NewStore(filepath.Join(t.TempDir(), "history.jsonl"), false)
+	if err != nil {
+		t.Fatalf("Failed to create history store: %v", err)
+	}
+	cashReg.SetHistory(store)
+
+	sell := func(wait time.Duration, kisimIDs ...int) *models.Receipt {
+		t.Helper()
+		if err := cashReg.StartNewReceipt(); err != nil {
+			t.Fatalf("Failed to start receipt: %v", err)
+		}
+		for _, id := range kisimIDs {
+			if err := cashReg.AddItem(id, 1, 0); err != nil {
+				t.Fatalf("Failed to add KISIM %d: %v", id, err)
+			}
+		}
+		time.Sleep(wait)
+		if err := cashReg.SetPaymentMethod("Nakit"); err != nil {
+			t.Fatalf("Failed to set payment method: %v", err)
+		}
+		receipt, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+		if err != nil {
+			t.Fatalf("Failed to issue receipt: %v", err)
+		}
+		return receipt
+	}
+
+	before := sell(0, 1, 2)
+	if time.Now().After(boundary) {
+		t.Skip("Sale before the rate change took too long")
+	}
+	if before.Items[0].TaxRate != 10 || before.Items[1].TaxRate != 10 {
+		t.Fatalf("Expected both lines at 10%% before the change, got %+v", before.Items)
+	}
+	if rates := before.TaxBreakdown.Rates; len(rates) != 1 || rates[0].Rate != 10 || math.Abs(rates[0].TaxAmount-15) > 0.001 {
+		t.Errorf("Expected 15.00 of 10%% tax, got %+v", rates)
+	}
+
+	// Rung up before the change, issued after it: the receipt time decides
+	after := sell(time.Until(boundary)+50*time.Millisecond, 1)
+	if after.Items[0].TaxRate != 20 {
+		t.Fatalf("Expected the line issued after the change at 20%%, got %d", after.Items[0].TaxRate)
+	}
+	if tax := after.TaxBreakdown.Tax20Percent; math.Abs(tax.TaxableAmount-91.67) > 0.005 || math.Abs(tax.TaxAmount-18.33) > 0.005 {
+		t.Errorf("Expected 91.67 taxed 18.33 at 20%%, got %+v", tax)
+	}
+
+	// The refund pays back the 10% the sale charged, after the change too
+	if _, err := cashReg.StartRefund(before.ReceiptSerial); err != nil {
+		t.Fatalf("Failed to start refund: %v", err)
+	}
+	if err := cashReg.AddRefundItem(0, 1); err != nil {
+		t.Fatalf("Failed to refund line 0: %v", err)
+	}
+	refund, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue refund: %v", err)
+	}
+	if refund.Items[0].TaxRate != 10 {
+		t.Errorf("Expected the refund at the sale's 10%%, got %d", refund.Items[0].TaxRate)
+	}
+
+	// The Z-report groups by the rate each receipt applied
+	report := cashReg.CurrentZReport()
+	want := []models.RateTaxDetail{
+		{Rate: 10, TaxDetail: models.TaxDetail{TaxableAmount: 50, TaxAmount: 5}},
+		{Rate: 20, TaxDetail: models.TaxDetail{TaxableAmount: 91.67, TaxAmount: 18.33}},
+	}
+	if len(report.TaxBreakdown.Rates) != len(want) {
+		t.Fatalf("Expected rates %+v, got %+v", want, report.TaxBreakdown.Rates)
+	}
+	for i, rate := range report.TaxBreakdown.Rates {
+		if rate.Rate != want[i].Rate || math.Abs(rate.TaxableAmount-want[i].TaxableAmount) > 0.005 || math.Abs(rate.TaxAmount-want[i].TaxAmount) > 0.005 {
+			t.Errorf("Expected %+v, got %+v", want[i], rate)
+		}
+	}
+}
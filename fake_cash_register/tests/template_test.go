@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/escpos"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/receiptpdf"
+)
+
+func newTemplateTestReceipt() *models.Receipt {
+	return &models.Receipt{
+		ZReportNumber: "Z0001",
+		TransactionID: "TX202503290001",
+		Timestamp:     time.Date(2025, 3, 29, 13, 21, 0, 0, time.Local),
+		StoreVKN:      "1234567890",
+		StoreName:     "Demo Mağazası",
+		StoreAddress:  "Kadıköy/İstanbul",
+		Items: []models.Item{
+			{KisimID: 1, KisimName: "Temel Gıda", Quantity: 2, UnitPrice: 550, TotalPrice: 1100, TaxRate: 10},
+		},
+		TaxBreakdown: models.TaxBreakdown{
+			Tax10Percent: models.TaxDetail{TaxableAmount: 1000, TaxAmount: 100},
+			TotalTax:     100,
+		},
+		TotalAmount:   1100,
+		PaymentMethod: "Nakit",
+		ReceiptSerial: "F0001",
+	}
+}
+
+func TestReceiptTemplate(t *testing.T) {
+	tmpl, err := models.LoadReceiptTemplate("../receipt.tmpl.example")
+	if err != nil {
+		t.Fatalf("Failed to load the example template: %v", err)
+	}
+	receipt := newTemplateTestReceipt()
+	loc := newTestBundle(t, nil).Localizer("tr")
+
+	text := receipt.FormatForDisplay(loc, tmpl)
+	for _, want := range []string{"[ LOGO ]", "Tel: 0216 000 00 00", "VKN: 1234567890", "KDV %10", "TOPLAM KDV", "iadeler fiş ile 14", "MALİ DEĞERİ YOKTUR", "teşekkürler"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Templated receipt missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "TOPKDV") {
+		t.Errorf("Expected the template's KDV total label to replace the catalog's:\n%s", text)
+	}
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if n := len([]rune(line)); n > models.ReceiptWidth {
+			t.Errorf("Line wider than %d characters (%d): %q", models.ReceiptWidth, n, line)
+		}
+	}
+
+	// The PDF takes the same labels, and sections the template leaves out keep their default
+	document := receiptpdf.Render(receipt, loc, tmpl)
+	for _, want := range []string{"(TOPLAM KDV)", "(KDV MATRAHI %10)", "(Tel: 0216 000 00 00)"} {
+		if !bytes.Contains(document, []byte(want)) {
+			t.Errorf("Templated PDF missing %q", want)
+		}
+	}
+
+	// Without a template the layout is unchanged
+	if text := receipt.FormatForDisplay(loc, nil); strings.Contains(text, "LOGO") || !strings.Contains(text, "TOPKDV") {
+		t.Errorf("Expected the default layout without a template:\n%s", text)
+	}
+}
+
+func TestReceiptTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"syntax error", `{{define "header"}}{{.StoreName}{{end}}`},
+		{"unknown field", `{{define "footer"}}{{.Owner}}{{end}}`},
+		{"no sections", `{{define "signature"}}x{{end}}`},
+	}
+	for _, tt := range tests {
+		if _, err := models.ParseReceiptTemplate(tt.text); err == nil {
+			t.Errorf("%s: expected the template to be refused", tt.name)
+		}
+	}
+}
+
+func TestRenderESCPOS(t *testing.T) {
+	tmpl, err := models.ParseReceiptTemplate(`{{define "logo"}}[LOGO]{{end}}`)
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	job := escpos.Render(newTemplateTestReceipt(), newTestBundle(t, nil).Localizer("tr"), tmpl)
+
+	if !bytes.HasPrefix(job, []byte{0x1b, 0x40, 0x1b, 0x74, 13}) {
+		t.Errorf("Expected the job to reset the printer and select PC857, got % x", job[:5])
+	}
+	if !bytes.HasSuffix(job, []byte{0x1d, 0x56, 0x42, 0x00}) {
+		t.Error("Expected the job to end with a cut")
+	}
+	for name, want := range map[string][]byte{
+		"stored logo":      {0x1c, 0x70, 1, 0},
+		"PC857 store name": []byte("Demo Ma\xa7azas\x8d"),
+		"PC857 footer":     []byte("MAL\x98 DE\xa6ER\x98 YOKTUR"),
+		"bold total":       []byte("\x1b\x45\x01TOPLAM"),
+	} {
+		if !bytes.Contains(job, want) {
+			t.Errorf("ESC/POS job missing %s (% x)", name, want)
+		}
+	}
+	if bytes.Contains(job, []byte("[LOGO]")) {
+		t.Error("Expected the stored logo instead of the placeholder text")
+	}
+}
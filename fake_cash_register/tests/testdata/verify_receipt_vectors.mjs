@@ -0,0 +1,65 @@
+// Checks receipt_vectors.json with WebCrypto the way a browser wallet collects a receipt:
+// open the envelope with the wallet key, split off the signature, hash and verify.
+// Decoding the binary receipt itself is left to the wallet under test.
+// Usage: node verify_receipt_vectors.mjs
+import { readFileSync } from 'node:fs';
+import { ECDH, webcrypto } from 'node:crypto';
+
+const { subtle } = webcrypto;
+const vectors = JSON.parse(readFileSync(new URL('./receipt_vectors.json', import.meta.url)));
+const hex = s => Uint8Array.from(Buffer.from(s, 'hex'));
+const toHex = bytes => Buffer.from(bytes).toString('hex');
+const b64url = bytes => Buffer.from(bytes).toString('base64url');
+const uncompress = compressed => hex(ECDH.convertKey(compressed, 'prime256v1', 'hex', 'hex', 'uncompressed'));
+
+const SIGNATURE_SIZE = 64;
+const TIMESTAMP_TOKEN_SIZE = 73;
+const FLAG_TIMESTAMP_TOKEN = 0x01;
+
+async function decrypt(privateKeyHex, publicKeyCompressedHex, envelope) {
+    const publicKey = uncompress(publicKeyCompressedHex);
+    const jwk = {
+        kty: 'EC', crv: 'P-256', d: b64url(hex(privateKeyHex)),
+        x: b64url(publicKey.slice(1, 33)), y: b64url(publicKey.slice(33)),
+    };
+    const privateKey = await subtle.importKey('jwk', jwk, { name: 'ECDH', namedCurve: 'P-256' }, false, ['deriveBits']);
+    const tempPublicKey = await subtle.importKey('raw', envelope.slice(0, 65), { name: 'ECDH', namedCurve: 'P-256' }, false, []);
+
+    const sharedX = new Uint8Array(await subtle.deriveBits({ name: 'ECDH', public: tempPublicKey }, privateKey, 256));
+    let start = 0;
+    while (start < sharedX.length - 1 && sharedX[start] === 0) {
+        start++;
+    }
+
+    const hkdfKey = await subtle.importKey('raw', sharedX.slice(start), 'HKDF', false, ['deriveKey']);
+    const aesKey = await subtle.deriveKey(
+        { name: 'HKDF', hash: 'SHA-256', salt: new Uint8Array(0), info: new TextEncoder().encode('Privacy-preserving-ECDH') },
+        hkdfKey, { name: 'AES-GCM', length: 256 }, false, ['decrypt']
+    );
+    return new Uint8Array(await subtle.decrypt({ name: 'AES-GCM', iv: envelope.slice(65, 77) }, aesKey, envelope.slice(77)));
+}
+
+let failures = 0;
+const check = (ok, name) => {
+    console.log(`${ok ? 'ok  ' : 'FAIL'} ${name}`);
+    if (!ok) failures++;
+};
+
+const authorityKey = await subtle.importKey('raw', uncompress(vectors.authority_public_key), { name: 'ECDSA', namedCurve: 'P-256' }, false, ['verify']);
+
+for (const v of vectors.receipts) {
+    const signed = await decrypt(vectors.wallet_private_key, vectors.wallet_public_key, hex(v.envelope));
+    const trailer = SIGNATURE_SIZE + (signed[3] & FLAG_TIMESTAMP_TOKEN ? TIMESTAMP_TOKEN_SIZE : 0);
+    const body = signed.slice(0, signed.length - trailer);
+    const signature = signed.slice(body.length, body.length + SIGNATURE_SIZE);
+
+    check(toHex(body) === v.binary && toHex(signature) === v.signature, 'envelope: ' + v.name);
+    check(body[0] === 0x54 && body[1] === 0x52 && body[2] === v.version && body[3] === v.flags, 'header: ' + v.name);
+
+    // The signed digest is SHA-256(binary); WebCrypto hashes the message itself
+    const digest = new Uint8Array(await subtle.digest('SHA-256', body));
+    const valid = await subtle.verify({ name: 'ECDSA', hash: 'SHA-256' }, authorityKey, signature, body);
+    check(toHex(digest) === v.hash && valid, 'signature: ' + v.name);
+}
+
+process.exit(failures ? 1 : 0);
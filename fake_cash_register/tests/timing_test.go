@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/services/mock"
+	"fake-cash-register/internal/timing"
+)
+
+func TestTimingMovingAverage(t *testing.T) {
+	recorder := timing.NewRecorder(0.5)
+	recorder.Observe(timing.StepSign, 100*time.Millisecond, nil)
+	recorder.Observe(timing.StepSign, 300*time.Millisecond, nil)
+	recorder.Observe(timing.StepSign, 5*time.Second, errors.New("timeout"))
+
+	var sign timing.StepStats
+	for _, s := range recorder.Stats() {
+		if s.Step == timing.StepSign {
+			sign = s
+		}
+	}
+	// 100 + 0.5 × (300 - 100); the failed run is counted but not averaged
+	if sign.Count != 2 || sign.Failures != 1 || sign.AverageMs != 200 || sign.JitterMs != 100 {
+		t.Errorf("Expected 2 runs averaging 200 ms with 100 ms jitter and 1 failure, got %+v", sign)
+	}
+	if sign.MinMs != 100 || sign.MaxMs != 300 || sign.LastMs != 300 || sign.LastAt == nil {
+		t.Errorf("Unexpected min, max or last run: %+v", sign)
+	}
+
+	var b strings.Builder
+	recorder.WritePrometheus(&b)
+	for _, line := range []string{
+		`cash_register_pipeline_step_duration_seconds_sum{step="sign"} 0.4`,
+		`cash_register_pipeline_step_duration_seconds_count{step="sign"} 2`,
+		`cash_register_pipeline_step_failures_total{step="sign"} 1`,
+		`cash_register_pipeline_step_average_seconds{step="sign"} 0.2`,
+		`cash_register_pipeline_step_max_seconds{step="submit"} 0`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("Expected %q in metrics:\n%s", line, b.String())
+		}
+	}
+}
+
+func TestIssueRecordsStepTimings(t *testing.T) {
+	cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup, mock.NewMockRevenueAuthority(false),
+		mock.NewMockReceiptBank(false), crypto.NewCryptoService(false), false)
+
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItem(1, 1, 0); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if err := cashReg.SetPaymentMethod("Nakit"); err != nil {
+		t.Fatalf("Failed to set payment method: %v", err)
+	}
+	if _, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t)); err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+
+	stats := cashReg.Timings().Stats()
+	if len(stats) != len(timing.Steps) {
+		t.Fatalf("Expected %d steps, got %+v", len(timing.Steps), stats)
+	}
+	for i, s := range stats {
+		if s.Step != timing.Steps[i] || s.Count != 1 || s.Failures != 0 {
+			t.Errorf("Expected one successful %s run, got %+v", timing.Steps[i], s)
+		}
+	}
+}
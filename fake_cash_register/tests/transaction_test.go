@@ -1,13 +1,26 @@
 package tests
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	rwcrypto "receiptwallet/crypto"
+
+	"fake-cash-register/internal/binary"
 	"fake-cash-register/internal/cashregister"
 	"fake-cash-register/internal/crypto"
 	"fake-cash-register/internal/interfaces"
 	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/scale"
 	"fake-cash-register/internal/services/mock"
+	"fake-cash-register/internal/taxid"
 )
 
 // Setup shared data for all tests
@@ -41,6 +54,22 @@ func createTestCashRegister(verbose bool) *cashregister.CashRegister {
 	)
 }
 
+// newTestEphemeralKey generates a 33-byte compressed P-256 key as a wallet QR code would carry
+func newTestEphemeralKey(t *testing.T) []byte {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ephemeral key: %v", err)
+	}
+
+	compressed, err := binary.PublicKeyToRawCompressed(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to compress ephemeral key: %v", err)
+	}
+	return compressed
+}
+
 func TestTransactionWorkflow(t *testing.T) {
 	// Create a new cash register for this test
 	cashReg := createTestCashRegister(true)
@@ -93,11 +122,7 @@ func TestTransactionWorkflow(t *testing.T) {
 	// Test 7: Issue receipt (privacy-preserving) - Use the new unified workflow
 	// Use QR scanner to generate a proper test ephemeral key
 	// Generate test ephemeral key directly (simulating frontend QR scan)
-	userEphemeralKeyCompressed := []byte("test_ephemeral_key_32_bytes_long")
-	if len(userEphemeralKeyCompressed) != 32 {
-		// Pad to 32 bytes for consistency
-		userEphemeralKeyCompressed = append(userEphemeralKeyCompressed, make([]byte, 32-len(userEphemeralKeyCompressed))...)
-	}
+	userEphemeralKeyCompressed := newTestEphemeralKey(t)
 
 	// Start a new receipt for issuing test
 	cashReg.StartNewReceipt()
@@ -276,11 +301,7 @@ func TestSpecificationCompliantWorkflow(t *testing.T) {
 
 	// Issue receipt (privacy-preserving) using unified workflow - generate proper ephemeral key
 	// Generate test ephemeral key directly (simulating frontend QR scan)
-	userEphemeralKeyCompressed := []byte("test_ephemeral_key_32_bytes_long")
-	if len(userEphemeralKeyCompressed) != 32 {
-		// Pad to 32 bytes for consistency
-		userEphemeralKeyCompressed = append(userEphemeralKeyCompressed, make([]byte, 32-len(userEphemeralKeyCompressed))...)
-	}
+	userEphemeralKeyCompressed := newTestEphemeralKey(t)
 
 	receipt, err := cashReg.IssueCurrentReceipt(userEphemeralKeyCompressed)
 	if err != nil {
@@ -290,3 +311,353 @@ func TestSpecificationCompliantWorkflow(t *testing.T) {
 	t.Log("Specification compliant workflow test completed successfully")
 	t.Logf("Final transaction had 3 item types with total ₺%.2f", receipt.TotalAmount)
 }
+
+// hashOnlyAuthority only offers blind hash signing
+type hashOnlyAuthority struct {
+	interfaces.RevenueAuthorityService
+}
+
+func TestStrictSigning(t *testing.T) {
+	newSale := func(authority interfaces.RevenueAuthorityService) *cashregister.CashRegister {
+		cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup, authority, mock.NewMockReceiptBank(false), crypto.NewCryptoService(false), false)
+		cashReg.SetStrictSigning(true)
+		cashReg.StartNewReceipt()
+		if err := cashReg.AddItem(1, 1, 0); err != nil {
+			t.Fatalf("Failed to add item: %v", err)
+		}
+		if err := cashReg.SetPaymentMethod("Nakit"); err != nil {
+			t.Fatalf("Failed to set payment method: %v", err)
+		}
+		return cashReg
+	}
+
+	if _, err := newSale(mock.NewMockRevenueAuthority(false)).IssueCurrentReceipt(newTestEphemeralKey(t)); err != nil {
+		t.Fatalf("Strict signing with a receipt signer failed: %v", err)
+	}
+
+	authority := hashOnlyAuthority{mock.NewMockRevenueAuthority(false)}
+	if _, err := newSale(authority).IssueCurrentReceipt(newTestEphemeralKey(t)); err == nil {
+		t.Error("Expected strict signing to fail without a receipt signer")
+	}
+}
+
+// attestingBank records the attestation sent with a submission
+type attestingBank struct {
+	*mock.MockReceiptBank
+	hash, signature []byte
+}
+
+func (b *attestingBank) SubmitTrackedReceipt(receiptID string, key, encrypted, hash, signature []byte) error {
+	b.hash, b.signature = hash, signature
+	return b.SubmitReceipt(key, encrypted)
+}
+
+func TestAttestedSubmissions(t *testing.T) {
+	authority := mock.NewMockRevenueAuthority(false)
+	bank := &attestingBank{MockReceiptBank: mock.NewMockReceiptBank(false)}
+	cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup, authority, bank, crypto.NewCryptoService(false), false)
+	cashReg.SetAttestedSubmissions(true)
+
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItem(2, 1, 0); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if err := cashReg.SetPaymentMethod("Kart"); err != nil {
+		t.Fatalf("Failed to set payment method: %v", err)
+	}
+	if _, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t)); err != nil {
+		t.Fatalf("Failed to issue attested receipt: %v", err)
+	}
+
+	// The bank must be able to verify the pair against the authority key alone
+	der, err := authority.GetPublicKey()
+	if err != nil {
+		t.Fatalf("Failed to get authority key: %v", err)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		t.Fatalf("Failed to parse authority key: %v", err)
+	}
+	if len(bank.hash) != 32 || !rwcrypto.Verify(publicKey.(*ecdsa.PublicKey), bank.hash, bank.signature) {
+		t.Errorf("Attestation does not verify (hash %d bytes, signature %d bytes)", len(bank.hash), len(bank.signature))
+	}
+}
+
+func TestSaleLimits(t *testing.T) {
+	cashReg := createTestCashRegister(false)
+	cashReg.SetLimits(cashregister.Limits{MaxQuantity: 10, MaxUnitPrice: 100, MaxReceiptTotal: 200, MaxItems: 2})
+	cashReg.StartNewReceipt()
+
+	expectLimit := func(err error, limit string) {
+		t.Helper()
+		var limitErr *cashregister.LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != limit || !errors.Is(err, cashregister.ErrLimitExceeded) {
+			t.Errorf("Expected %s limit error, got %v", limit, err)
+		}
+	}
+
+	if err := cashReg.AddItem(1, 0, 0); !errors.Is(err, cashregister.ErrInvalidQuantity) {
+		t.Errorf("Expected ErrInvalidQuantity for quantity 0, got %v", err)
+	}
+	expectLimit(cashReg.AddItem(1, 10_000_000, 0), cashregister.LimitQuantity)
+	expectLimit(cashReg.AddItem(3, 1, 150), cashregister.LimitUnitPrice)
+
+	if err := cashReg.AddItem(1, 6, 0); err != nil {
+		t.Fatalf("Failed to add item within limits: %v", err)
+	}
+	// Merging into the existing line counts the combined quantity
+	expectLimit(cashReg.AddItem(1, 5, 0), cashregister.LimitQuantity)
+
+	if err := cashReg.AddItem(2, 1, 0); err != nil {
+		t.Fatalf("Failed to add second line: %v", err)
+	}
+	expectLimit(cashReg.AddItem(3, 1, 0), cashregister.LimitItems)
+	expectLimit(cashReg.AddItem(2, 9, 0), cashregister.LimitTotal) // 63 + 150
+
+	if n := len(cashReg.GetCurrentReceipt().Items); n != 2 || cashReg.GetCurrentReceipt().Items[0].Quantity != 6 {
+		t.Fatalf("Rejected items changed the receipt: %+v", cashReg.GetCurrentReceipt().Items)
+	}
+
+	// A tightened policy is enforced again when issuing
+	cashReg.SetLimits(cashregister.Limits{MaxReceiptTotal: 50})
+	cashReg.SetPaymentMethod("Nakit")
+	_, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	expectLimit(err, cashregister.LimitTotal)
+	if !cashReg.HasActiveReceipt() {
+		t.Error("Receipt over a limit should stay open")
+	}
+
+	// Without a policy the binary format's ceilings still apply
+	cashReg.SetLimits(cashregister.Limits{})
+	if max := cashReg.Limits().MaxQuantity; max != 65535 {
+		t.Errorf("Expected format ceiling 65535 for quantity, got %d", max)
+	}
+	expectLimit(cashReg.AddItem(1, 70_000, 0), cashregister.LimitQuantity)
+	if _, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t)); err != nil {
+		t.Fatalf("Failed to issue receipt within limits: %v", err)
+	}
+}
+
+func TestFormatVersion2Sale(t *testing.T) {
+	cashReg := createTestCashRegister(false)
+	if err := cashReg.SetFormatVersion(3); err == nil {
+		t.Error("Expected error for unsupported format version 3")
+	}
+	if err := cashReg.SetFormatVersion(binary.FormatVersion2); err != nil {
+		t.Fatalf("Failed to select format v2: %v", err)
+	}
+	if max := cashReg.Limits().MaxQuantity; max != 4294967295 {
+		t.Errorf("Expected v2 quantity ceiling 4294967295, got %d", max)
+	}
+
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItem(2, 10_000_000, 0); err != nil {
+		t.Fatalf("Failed to add quantity beyond v1 range: %v", err)
+	}
+	cashReg.SetPaymentMethod("Kart")
+	receipt, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue v2 receipt: %v", err)
+	}
+	if receipt.TotalAmount != 150_000_000 {
+		t.Errorf("Expected total 150000000, got %v", receipt.TotalAmount)
+	}
+}
+
+func TestCompressedSale(t *testing.T) {
+	cashReg := createTestCashRegister(false)
+	cashReg.SetCompression(true)
+
+	cashReg.StartNewReceipt()
+	for i := 0; i < 40; i++ {
+		if err := cashReg.AddItem(1+i%2, 1, float64(100+i)); err != nil {
+			t.Fatalf("Failed to add item %d: %v", i, err)
+		}
+	}
+	cashReg.SetPaymentMethod("Nakit")
+	if _, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t)); err != nil {
+		t.Fatalf("Failed to issue compressed receipt: %v", err)
+	}
+}
+
+func TestWeighedSale(t *testing.T) {
+	lookup := models.KisimLookup{
+		1: kisimLookup[1],
+		4: {ID: 4, Name: "Domates", TaxRate: 10, PresetPrice: 50, Weighed: true},
+	}
+	cashReg := cashregister.NewCashRegister(storeInfo, lookup, mock.NewMockRevenueAuthority(false),
+		mock.NewMockReceiptBank(false), crypto.NewCryptoService(false), false)
+
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItem(4, 0, 0); !errors.Is(err, cashregister.ErrWeighingUnsupported) {
+		t.Errorf("Expected weighed items to need format v2, got %v", err)
+	}
+	if err := cashReg.SetFormatVersion(binary.FormatVersion2); err != nil {
+		t.Fatalf("Failed to select format v2: %v", err)
+	}
+	if err := cashReg.AddItem(4, 0, 0); !errors.Is(err, scale.ErrNoReading) {
+		t.Errorf("Expected ErrNoReading without a scale, got %v", err)
+	}
+
+	checkoutScale := scale.New(time.Minute, false)
+	cashReg.SetScale(checkoutScale)
+	checkoutScale.Set(scale.Reading{Grams: 1234, Stable: false})
+	if err := cashReg.AddItem(4, 0, 0); !errors.Is(err, scale.ErrUnstable) {
+		t.Errorf("Expected ErrUnstable, got %v", err)
+	}
+	checkoutScale.Set(scale.Reading{Grams: 1234, Stable: true})
+	if err := cashReg.AddItem(4, 0, 0); err != nil {
+		t.Fatalf("Failed to add weighed item: %v", err)
+	}
+	// A second weighing of the same KISIM gets its own line
+	if err := cashReg.AddItem(4, 500, 0); err != nil {
+		t.Fatalf("Failed to add entered weight: %v", err)
+	}
+	if err := cashReg.AddItem(1, 2, 0); err != nil {
+		t.Fatalf("Failed to add counted item: %v", err)
+	}
+
+	items := cashReg.GetCurrentReceipt().Items
+	if len(items) != 3 || items[0].Quantity != 1234 || items[1].Quantity != 500 || !items[0].Weighed || items[2].Weighed {
+		t.Fatalf("Unexpected lines: %+v", items)
+	}
+	if items[0].TotalPrice != 61.70 || items[1].TotalPrice != 25 {
+		t.Errorf("Expected weighed totals 61.70 and 25, got %v and %v", items[0].TotalPrice, items[1].TotalPrice)
+	}
+
+	cashReg.SetLimits(cashregister.Limits{MaxWeight: 5000})
+	var limitErr *cashregister.LimitError
+	if err := cashReg.AddItem(4, 5001, 0); !errors.As(err, &limitErr) || limitErr.Limit != cashregister.LimitWeight {
+		t.Errorf("Expected weight limit, got %v", err)
+	}
+
+	cashReg.SetPaymentMethod("Nakit")
+	receipt, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue weighed receipt: %v", err)
+	}
+	if receipt.TotalAmount != 107.70 {
+		t.Errorf("Expected total 107.70, got %v", receipt.TotalAmount)
+	}
+}
+
+func TestItemNotes(t *testing.T) {
+	cashReg := createTestCashRegister(false)
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItemWithNote(1, 1, 0, "şekersiz"); !errors.Is(err, cashregister.ErrNotesUnsupported) {
+		t.Errorf("Expected item notes to need format v2, got %v", err)
+	}
+	if err := cashReg.SetFormatVersion(binary.FormatVersion2); err != nil {
+		t.Fatalf("Failed to select format v2: %v", err)
+	}
+
+	// Items join a line only when their notes match
+	for _, note := range []string{"şekersiz", " şekersiz ", "", "sütlü"} {
+		if err := cashReg.AddItemWithNote(1, 1, 0, note); err != nil {
+			t.Fatalf("Failed to add item with note %q: %v", note, err)
+		}
+	}
+	items := cashReg.GetCurrentReceipt().Items
+	if len(items) != 3 || items[0].Quantity != 2 || items[0].Note != "şekersiz" || items[1].Note != "" || items[2].Note != "sütlü" {
+		t.Fatalf("Unexpected lines: %+v", items)
+	}
+
+	if err := cashReg.AddItemWithNote(1, 1, 0, "two\nlines"); !errors.Is(err, cashregister.ErrInvalidNote) {
+		t.Errorf("Expected ErrInvalidNote, got %v", err)
+	}
+	cashReg.SetLimits(cashregister.Limits{MaxNoteLength: 10})
+	var limitErr *cashregister.LimitError
+	if err := cashReg.AddItemWithNote(1, 1, 0, "ılık süt"); !errors.As(err, &limitErr) || limitErr.Limit != cashregister.LimitNote {
+		t.Errorf("Expected note limit, got %v", err)
+	}
+
+	cashReg.SetPaymentMethod("Nakit")
+	receipt, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue receipt with notes: %v", err)
+	}
+	text := receipt.FormatForDisplay(newTestBundle(t, nil).Localizer("tr"), nil)
+	if !strings.Contains(text, "  şekersiz\n") {
+		t.Errorf("Expected the note under its line:\n%s", text)
+	}
+}
+
+func TestCorporateCustomer(t *testing.T) {
+	cashReg := createTestCashRegister(false)
+	cashReg.StartNewReceipt()
+	if err := cashReg.SetCustomer("123 456 7891", "ACME LTD"); !errors.Is(err, taxid.ErrInvalid) {
+		t.Errorf("Expected taxid.ErrInvalid for a bad check digit, got %v", err)
+	}
+	if err := cashReg.SetCustomer("1234567890", " \t "); !errors.Is(err, cashregister.ErrInvalidCustomerName) {
+		t.Errorf("Expected ErrInvalidCustomerName, got %v", err)
+	}
+	if err := cashReg.SetCustomer("123-456-78-90", "  ACME   LTD "); err != nil {
+		t.Fatalf("Failed to set customer: %v", err)
+	}
+	customer := cashReg.GetCurrentReceipt().Customer
+	if customer == nil || customer.TaxNumber != "1234567890" || customer.Name != "ACME LTD" {
+		t.Fatalf("Unexpected customer: %+v", customer)
+	}
+
+	cashReg.AddItem(1, 2, 0)
+	cashReg.SetPaymentMethod("Kart")
+	receipt, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue corporate receipt: %v", err)
+	}
+	text := receipt.FormatForDisplay(newTestBundle(t, nil).Localizer("tr"), nil)
+	if !strings.Contains(text, "SAYIN: ACME LTD\n") || !strings.Contains(text, "VKN: 1234567890\n") {
+		t.Errorf("Expected the customer on the receipt:\n%s", text)
+	}
+
+	// The next sale is anonymous again, and an empty number clears a customer
+	cashReg.StartNewReceipt()
+	if cashReg.GetCurrentReceipt().Customer != nil {
+		t.Error("Expected a new receipt without customer")
+	}
+	cashReg.SetCustomer("10000000146", "Ayşe Yılmaz")
+	cashReg.SetCustomer("", "")
+	if cashReg.GetCurrentReceipt().Customer != nil {
+		t.Error("Expected an empty tax number to clear the customer")
+	}
+}
+
+func TestReceiptPreview(t *testing.T) {
+	cashReg := createTestCashRegister(false)
+	if _, err := cashReg.PreviewReceipt(); !errors.Is(err, cashregister.ErrNoActiveReceipt) {
+		t.Errorf("Expected ErrNoActiveReceipt without a sale, got %v", err)
+	}
+	if err := cashReg.StartNewReceipt(); err != nil {
+		t.Fatalf("Failed to start receipt: %v", err)
+	}
+	if _, err := cashReg.PreviewReceipt(); !errors.Is(err, cashregister.ErrEmptyReceipt) {
+		t.Errorf("Expected ErrEmptyReceipt without items, got %v", err)
+	}
+
+	cashReg.AddItem(1, 2, 0)
+	cashReg.AddItem(2, 1, 0)
+	cashReg.SetPaymentMethod("Kart")
+
+	preview, err := cashReg.PreviewReceipt()
+	if err != nil {
+		t.Fatalf("Failed to preview receipt: %v", err)
+	}
+	if preview.ReceiptSerial != "F0001" || preview.TotalAmount != 36 || preview.TaxBreakdown.Tax20Percent.TaxAmount == 0 {
+		t.Errorf("Unexpected preview: serial %s total %.2f breakdown %+v", preview.ReceiptSerial, preview.TotalAmount, preview.TaxBreakdown)
+	}
+	if current := cashReg.CurrentReceipt(); current.ReceiptSerial != "" || current.TotalAmount != 0 {
+		t.Errorf("Expected the preview to leave the open sale alone, got %+v", current)
+	}
+
+	// Previewing twice consumes nothing: the issued receipt matches the preview
+	if _, err := cashReg.PreviewReceipt(); err != nil {
+		t.Fatalf("Failed to preview receipt again: %v", err)
+	}
+	issued, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+	if issued.ReceiptSerial != preview.ReceiptSerial || issued.TotalAmount != preview.TotalAmount || !reflect.DeepEqual(issued.TaxBreakdown, preview.TaxBreakdown) {
+		t.Errorf("Expected the issued receipt to match its preview, got %+v and %+v", issued, preview)
+	}
+}
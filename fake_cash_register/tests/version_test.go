@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/binary"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/interfaces"
+	"fake-cash-register/internal/services/mock"
+	"fake-cash-register/internal/services/real"
+)
+
+// newVersionedBank serves GET /version with the given response, or 404 when nil
+func newVersionedBank(t *testing.T, version *api.ReceiptBankVersion) *real.RealReceiptBank {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" || version == nil {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(version)
+	}))
+	t.Cleanup(server.Close)
+
+	return real.NewRealReceiptBank(server.URL, &config.Config{}, false)
+}
+
+func TestReceiptBankVersionHandshake(t *testing.T) {
+	bank := newVersionedBank(t, &api.ReceiptBankVersion{
+		APIVersion:           "1",
+		SupportedAPIVersions: []string{"1"},
+		ReceiptFormats:       []int{1},
+	})
+
+	// Unknown until the first handshake: the bank decides
+	if err := bank.CheckFormat(binary.FormatVersion2); err != nil {
+		t.Errorf("Expected no refusal before the handshake, got %v", err)
+	}
+
+	if _, err := bank.CheckVersion(); err != nil {
+		t.Fatalf("Version check failed: %v", err)
+	}
+	if err := bank.CheckFormat(binary.FormatVersion1); err != nil {
+		t.Errorf("Expected v1 to be accepted, got %v", err)
+	}
+	if err := bank.CheckFormat(binary.FormatVersion2); !errors.Is(err, interfaces.ErrIncompatibleBank) {
+		t.Errorf("Expected ErrIncompatibleBank for v2, got %v", err)
+	}
+
+	newer := newVersionedBank(t, &api.ReceiptBankVersion{
+		APIVersion:           "2",
+		SupportedAPIVersions: []string{"2"},
+		ReceiptFormats:       []int{1, 2},
+	})
+	newer.CheckVersion()
+	if err := newer.CheckFormat(binary.FormatVersion1); !errors.Is(err, interfaces.ErrIncompatibleBank) {
+		t.Errorf("Expected ErrIncompatibleBank for a bank without API v1, got %v", err)
+	}
+
+	// Banks without /version only take binary receipt v1
+	legacy := newVersionedBank(t, nil)
+	if _, err := legacy.CheckVersion(); err != nil {
+		t.Fatalf("Version check against a legacy bank failed: %v", err)
+	}
+	if err := legacy.CheckFormat(binary.FormatVersion2); !errors.Is(err, interfaces.ErrIncompatibleBank) {
+		t.Errorf("Expected ErrIncompatibleBank for v2 on a legacy bank, got %v", err)
+	}
+}
+
+// formatCheckingBank is a mock bank that refuses every receipt format
+type formatCheckingBank struct {
+	*mock.MockReceiptBank
+	submitted bool
+}
+
+func (b *formatCheckingBank) CheckFormat(version uint8) error {
+	return interfaces.ErrIncompatibleBank
+}
+
+func (b *formatCheckingBank) SubmitReceipt(key []byte, data []byte) error {
+	b.submitted = true
+	return b.MockReceiptBank.SubmitReceipt(key, data)
+}
+
+func TestIssueRefusedForIncompatibleBank(t *testing.T) {
+	bank := &formatCheckingBank{MockReceiptBank: mock.NewMockReceiptBank(false)}
+	revenueAuth := mock.NewMockRevenueAuthority(false)
+	cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup, revenueAuth, bank, crypto.NewCryptoService(false), false)
+
+	cashReg.StartNewReceipt()
+	if err := cashReg.AddItem(1, 1, 0); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	cashReg.SetPaymentMethod("Nakit")
+
+	_, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if !errors.Is(err, interfaces.ErrIncompatibleBank) {
+		t.Fatalf("Expected ErrIncompatibleBank, got %v", err)
+	}
+	if bank.submitted {
+		t.Error("Receipt was submitted to an incompatible bank")
+	}
+}
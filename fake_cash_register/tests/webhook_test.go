@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/config"
+	"fake-cash-register/internal/handlers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const secret = "shared-secret"
+	body := `{"receipt_id":"abc","status":"downloaded","timestamp":"2025-03-29T13:21:00Z"}`
+
+	router := gin.New()
+	router.POST("/webhook", handlers.VerifyWebhookSignature(secret, false), func(c *gin.Context) {
+		var payload struct {
+			ReceiptID string `json:"receipt_id"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil || payload.ReceiptID != "abc" {
+			t.Errorf("Handler did not see the original body: %v", err)
+		}
+		c.Status(http.StatusOK)
+	})
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-handlers.WebhookTolerance-time.Minute).Unix(), 10)
+	sign := func(secret, timestamp string) string {
+		return "sha256=" + hex.EncodeToString(handlers.WebhookSignature(secret, timestamp, []byte(body)))
+	}
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		expected  int
+	}{
+		{"valid", now, sign(secret, now), http.StatusOK},
+		{"missing", now, "", http.StatusUnauthorized},
+		{"wrong secret", now, sign("other", now), http.StatusUnauthorized},
+		{"no scheme", now, strings.TrimPrefix(sign(secret, now), "sha256="), http.StatusUnauthorized},
+		{"not hex", now, "sha256=zz", http.StatusUnauthorized},
+		{"no timestamp", "", sign(secret, ""), http.StatusUnauthorized},
+		{"timestamp not signed", now, sign(secret, stale), http.StatusUnauthorized},
+		{"replayed after the window", stale, sign(secret, stale), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if tt.timestamp != "" {
+			req.Header.Set(handlers.WebhookTimestampHeader, tt.timestamp)
+		}
+		if tt.signature != "" {
+			req.Header.Set(handlers.WebhookSignatureHeader, tt.signature)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+}
+
+func TestWebhookPayloadVersion(t *testing.T) {
+	var v1 api.WebhookPayload
+	if err := json.Unmarshal([]byte(`{"receipt_id":"r1","status":"downloaded","timestamp":"2025-01-01T00:00:00Z"}`), &v1); err != nil {
+		t.Fatal(err)
+	}
+	if v1.Version() != api.WebhookSchemaV1 {
+		t.Fatalf("payload without schema_version: version %d, want %d", v1.Version(), api.WebhookSchemaV1)
+	}
+
+	var v2 api.WebhookPayload
+	body := `{"schema_version":2,"receipt_id":"r2","status":"downloaded","timestamp":"2025-01-01T00:00:02Z",` +
+		`"submitted_at":"2025-01-01T00:00:00.250Z","collected_at":"2025-01-01T00:00:01.750Z","collection_latency_ms":1500,"attempt":2}`
+	if err := json.Unmarshal([]byte(body), &v2); err != nil {
+		t.Fatal(err)
+	}
+	if v2.Version() != api.WebhookSchemaV2 || v2.CollectionLatencyMs != 1500 || v2.Attempt != 2 {
+		t.Fatalf("unexpected v2 payload: %+v", v2)
+	}
+}
+
+func TestWebhookVerificationChallenge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := handlers.NewCashRegisterHandler(createTestCashRegister(false), &config.Config{}, nil)
+	router := gin.New()
+	router.POST("/webhook", handler.WebhookHandler)
+
+	body := `{"type":"url_verification","challenge":"9f86d081884c7d659a2feaa0c55ad015","timestamp":"2025-09-28T10:29:55Z"}`
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var answer api.WebhookChallengeResponse
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &answer) != nil || answer.Challenge != "9f86d081884c7d659a2feaa0c55ad015" {
+		t.Fatalf("Expected the challenge echoed, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,264 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rwcrypto "receiptwallet/crypto"
+
+	"fake-cash-register/internal/api"
+	"fake-cash-register/internal/cashregister"
+	"fake-cash-register/internal/crypto"
+	"fake-cash-register/internal/models"
+	"fake-cash-register/internal/services/mock"
+	"fake-cash-register/internal/services/real"
+	"fake-cash-register/internal/zreport"
+)
+
+// issueTestSale issues a one-item receipt
+func issueTestSale(t *testing.T, cashReg *cashregister.CashRegister, kisimID int, method string) *models.Receipt {
+	t.Helper()
+
+	if err := cashReg.StartNewReceipt(); err != nil {
+		t.Fatalf("Failed to start receipt: %v", err)
+	}
+	if err := cashReg.AddItem(kisimID, 1, 0); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if err := cashReg.SetPaymentMethod(method); err != nil {
+		t.Fatalf("Failed to set payment method: %v", err)
+	}
+	receipt, err := cashReg.IssueCurrentReceipt(newTestEphemeralKey(t))
+	if err != nil {
+		t.Fatalf("Failed to issue receipt: %v", err)
+	}
+	return receipt
+}
+
+func TestZReportClose(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "z_reports.jsonl")
+	store, err := zreport.NewStore(file, false)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	cashReg := createTestCashRegister(false)
+	cashReg.SetZReports(store)
+
+	first := issueTestSale(t, cashReg, 1, "Nakit")
+	second := issueTestSale(t, cashReg, 2, "Kart")
+	if first.ZReportNumber != "Z0001" {
+		t.Errorf("Expected Z0001, got %s", first.ZReportNumber)
+	}
+
+	report, err := cashReg.CloseZReport()
+	if err != nil {
+		t.Fatalf("Failed to close Z-report: %v", err)
+	}
+	if report.ReceiptCount != 2 || report.FirstSerial != first.ReceiptSerial || report.LastSerial != second.ReceiptSerial {
+		t.Errorf("Unexpected report range: %d receipts, %s-%s", report.ReceiptCount, report.FirstSerial, report.LastSerial)
+	}
+	if total := first.TotalAmount + second.TotalAmount; report.TotalAmount != total {
+		t.Errorf("Expected total %.2f, got %.2f", total, report.TotalAmount)
+	}
+	if report.PaymentTotals["Kart"] != second.TotalAmount {
+		t.Errorf("Expected card total %.2f, got %.2f", second.TotalAmount, report.PaymentTotals["Kart"])
+	}
+
+	if next := issueTestSale(t, cashReg, 1, "Nakit"); next.ZReportNumber != "Z0002" {
+		t.Errorf("Expected Z0002 after close, got %s", next.ZReportNumber)
+	}
+
+	// A restarted register continues numbering from the persisted reports
+	reloaded, err := zreport.NewStore(file, false)
+	if err != nil {
+		t.Fatalf("Failed to reload store: %v", err)
+	}
+	restarted := createTestCashRegister(false)
+	restarted.SetZReports(reloaded)
+	if got := restarted.CurrentZReport().Number; got != "Z0002" {
+		t.Errorf("Expected Z0002 after restart, got %s", got)
+	}
+}
+
+func TestZReportBlocksSalesUntilClosed(t *testing.T) {
+	cashReg := createTestCashRegister(false)
+
+	if err := cashReg.StartNewReceipt(); err != nil {
+		t.Fatalf("Failed to start receipt: %v", err)
+	}
+	if _, err := cashReg.CloseZReport(); !errors.Is(err, zreport.ErrSaleInProgress) {
+		t.Fatalf("Expected ErrSaleInProgress, got %v", err)
+	}
+
+	// The open sale may finish, but no new one starts while the close is pending
+	cashReg.CancelCurrentReceipt()
+	if err := cashReg.StartNewReceipt(); !errors.Is(err, zreport.ErrClosePending) {
+		t.Fatalf("Expected ErrClosePending, got %v", err)
+	}
+
+	if _, err := cashReg.CloseZReport(); err != nil {
+		t.Fatalf("Failed to close Z-report: %v", err)
+	}
+	if err := cashReg.StartNewReceipt(); err != nil {
+		t.Errorf("Expected sales to resume after close, got %v", err)
+	}
+}
+
+// zReportBlockingAuthority holds Z-report submissions until release is closed
+type zReportBlockingAuthority struct {
+	*mock.MockRevenueAuthority
+	submitting chan struct{}
+	release    chan struct{}
+}
+
+func (a *zReportBlockingAuthority) SubmitZReport(report *models.ZReport) error {
+	close(a.submitting)
+	<-a.release
+	return nil
+}
+
+func TestZReportReadableWhileSubmitting(t *testing.T) {
+	authority := &zReportBlockingAuthority{
+		MockRevenueAuthority: mock.NewMockRevenueAuthority(false),
+		submitting:           make(chan struct{}),
+		release:              make(chan struct{}),
+	}
+	cashReg := cashregister.NewCashRegister(storeInfo, kisimLookup, authority, mock.NewMockReceiptBank(false), crypto.NewCryptoService(false), false)
+	cashReg.SetZReportSubmission(true)
+
+	closed := make(chan *models.ZReport)
+	go func() {
+		report, err := cashReg.CloseZReport()
+		if err != nil {
+			t.Errorf("Failed to close Z-report: %v", err)
+		}
+		closed <- report
+	}()
+	<-authority.submitting
+
+	// The report, the pending close and the sale can be read while the authority answers
+	read := make(chan string)
+	go func() {
+		cashReg.ZReportClosing()
+		cashReg.HasActiveReceipt()
+		cashReg.NextSerial()
+		read <- cashReg.CurrentZReport().Number
+	}()
+	select {
+	case number := <-read:
+		if number != "Z0001" {
+			t.Errorf("Expected Z0001 while closing, got %s", number)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Z-report reads blocked by the authority submission")
+	}
+
+	close(authority.release)
+	if report := <-closed; report == nil || !report.Submitted {
+		t.Errorf("Expected a submitted report, got %+v", report)
+	}
+	if got := cashReg.CurrentZReport().Number; got != "Z0002" {
+		t.Errorf("Expected Z0002 after close, got %s", got)
+	}
+}
+
+func TestZReportSchedulerNext(t *testing.T) {
+	scheduler, err := zreport.NewScheduler("23:59", nil, false)
+	if err != nil {
+		t.Fatalf("Failed to create scheduler: %v", err)
+	}
+
+	loc := time.FixedZone("TRT", 3*60*60)
+	tests := []struct {
+		now, expected time.Time
+	}{
+		{time.Date(2025, 3, 29, 13, 0, 0, 0, loc), time.Date(2025, 3, 29, 23, 59, 0, 0, loc)},
+		{time.Date(2025, 3, 29, 23, 59, 0, 0, loc), time.Date(2025, 3, 30, 23, 59, 0, 0, loc)},
+		{time.Date(2025, 12, 31, 23, 59, 30, 0, loc), time.Date(2026, 1, 1, 23, 59, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		if got := scheduler.Next(tt.now); !got.Equal(tt.expected) {
+			t.Errorf("Next(%s): expected %s, got %s", tt.now, tt.expected, got)
+		}
+	}
+
+	if _, err := zreport.NewScheduler("24:00", nil, false); err == nil {
+		t.Error("Expected error for invalid close time")
+	}
+}
+
+func TestZReportSubmissionSigned(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "register.pem")
+	key, err := crypto.LoadOrCreateRegisterKey(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to create register key: %v", err)
+	}
+	publicPEM, err := os.ReadFile(filepath.Join(filepath.Dir(keyPath), "register_public.pem"))
+	if err != nil {
+		t.Fatalf("Expected public key next to the register key: %v", err)
+	}
+	publicKey, err := rwcrypto.ParsePublicKeyPEM(publicPEM)
+	if err != nil || !publicKey.Equal(&key.PublicKey) {
+		t.Fatalf("Public key file does not match the register key: %v", err)
+	}
+
+	var received api.ZReportSubmission
+	authority := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/zreport" {
+			t.Errorf("Expected POST /zreport, got %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer authority.Close()
+
+	revenueAuth := real.NewRealRevenueAuthority(authority.URL, "", false)
+	revenueAuth.SetSigningKey(key)
+
+	closedAt := time.Date(2026, 10, 16, 23, 59, 0, 0, time.Local)
+	report := &models.ZReport{
+		Number:       "Z0003",
+		StoreVKN:     storeInfo.VKN,
+		OpenedAt:     closedAt.Add(-12 * time.Hour),
+		ClosedAt:     &closedAt,
+		ReceiptCount: 2,
+		TotalAmount:  33,
+		TaxBreakdown: models.TaxBreakdown{
+			Tax10Percent: models.TaxDetail{TaxableAmount: 10, TaxAmount: 1},
+			Tax20Percent: models.TaxDetail{TaxableAmount: 20, TaxAmount: 2},
+			TotalTax:     3,
+		},
+	}
+	if err := revenueAuth.SubmitZReport(report); err != nil {
+		t.Fatalf("Failed to submit Z-report: %v", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(received.Signature)
+	if err != nil {
+		t.Fatalf("Expected base64 signature, got %q", received.Signature)
+	}
+	digest := sha256.Sum256(received.Summary)
+	if !rwcrypto.Verify(&key.PublicKey, digest[:], signature) {
+		t.Fatalf("Signature does not verify over the summary bytes")
+	}
+
+	var summary api.ZReportSummary
+	if err := json.Unmarshal(received.Summary, &summary); err != nil {
+		t.Fatalf("Failed to decode summary: %v", err)
+	}
+	if summary.Date != "2026-10-16" || summary.ZReportNumber != "Z0003" || summary.ReceiptCount != 2 {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+	if len(summary.TaxTotals) != 2 || summary.TaxTotals[1].Rate != 20 || summary.TaxTotals[1].TaxAmount != 2 {
+		t.Errorf("Expected totals per tax rate, got %+v", summary.TaxTotals)
+	}
+}
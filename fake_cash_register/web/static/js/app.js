@@ -1,4 +1,19 @@
 // Cash Register JavaScript Application
+
+// Messages for the page locale, injected by the server as window.I18N
+const messages = (window.I18N && window.I18N.messages) || {};
+const locale = messages['format.bcp47'] || 'tr-TR';
+
+// t returns the catalog message for key with {0}, {1}... replaced by args
+function t(key, ...args) {
+    return (messages[key] ?? key).replace(/\{(\d+)\}/g, (match, i) => args[i] ?? match);
+}
+
+// escapeHTML makes cashier-entered text safe to place in markup
+function escapeHTML(text) {
+    return String(text).replace(/[&<>"']/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' })[c]);
+}
+
 class CashRegister {
     constructor() {
         this.currentTransaction = {
@@ -8,8 +23,12 @@ class CashRegister {
         };
         this.currentInput = ''; // Current digit input being entered
         this.nextItemQuantity = 1; // Quantity captured by MIKTAR button
+        this.nextItemNote = ''; // Note captured by NOT button, printed under the next item
         this.inputMode = 'ambiguous'; // 'ambiguous', 'quantity', or 'price' mode
         this.kisim = [];
+        this.kisimGroups = []; // Department keys per group, split into pages by the server
+        this.kisimGroup = 0;
+        this.kisimPage = 0;
         this.qrScanner = null;
         
         this.init();
@@ -20,35 +39,118 @@ class CashRegister {
         this.setupEventListeners();
         this.updateClock();
         this.startTransaction();
+        this.subscribeEvents();
         
         // Update clock every second
         setInterval(() => this.updateClock(), 1000);
         
-        this.log('Yazar kasa sistemi başlatıldı');
+        this.log(t('ui.started'));
+    }
+    
+    // subscribeEvents follows the register's lifecycle stream; the browser reconnects on its own
+    subscribeEvents() {
+        if (!window.EventSource) {
+            return;
+        }
+        const source = new EventSource('api/events');
+        source.addEventListener('webhook_confirmed', (e) => {
+            const event = JSON.parse(e.data);
+            this.showSuccess(t('ui.receipt_collected', event.receipt_id));
+            this.log(t('ui.receipt_collected', event.receipt_id));
+        });
     }
     
     async loadKisim() {
         try {
-            const response = await fetch('/api/kisim');
+            const response = await fetch('api/kisim');
             const data = await response.json();
             this.kisim = data.kisim;
-            this.log(`${this.kisim.length} kısım yüklendi`);
+            this.kisimGroups = data.groups || [];
+            this.renderKisimPanel();
+            this.log(t('ui.kisim_loaded', this.kisim.length));
         } catch (error) {
-            this.showError('Kısımlar yüklenemedi: ' + error.message);
+            this.showError(t('ui.kisim_load_failed', error.message));
         }
     }
     
+    // renderKisimPanel shows the group tabs and the current page of department keys;
+    // registers with a couple of KISIMs get by with the keypad's own keys
+    renderKisimPanel() {
+        const panel = document.getElementById('kisim-panel');
+        if (this.kisim.length <= 2 || this.kisimGroups.length === 0) {
+            panel.classList.add('hidden');
+            return;
+        }
+        panel.classList.remove('hidden');
+
+        const tabs = document.getElementById('kisim-groups');
+        tabs.innerHTML = '';
+        this.kisimGroups.forEach((group, i) => {
+            const tab = document.createElement('button');
+            tab.className = 'kisim-tab px-1 py-1 whitespace-nowrap' + (i === this.kisimGroup ? ' kisim-tab-active' : '');
+            tab.textContent = group.name || t('ui.kisim_other');
+            if (group.color) {
+                tab.style.color = group.color;
+            }
+            tab.addEventListener('click', () => {
+                this.kisimGroup = i;
+                this.kisimPage = 0;
+                this.renderKisimPanel();
+            });
+            tabs.appendChild(tab);
+        });
+
+        const group = this.kisimGroups[this.kisimGroup];
+        const grid = document.getElementById('kisim-page');
+        grid.innerHTML = '';
+        group.pages[this.kisimPage].kisim.forEach(kisim => {
+            const key = document.createElement('button');
+            key.className = 'kisim-btn cash-key key-orange px-1 py-3 text-xs font-semibold truncate';
+            key.textContent = kisim.name;
+            key.title = kisim.name;
+            if (group.color) {
+                key.style.setProperty('background', group.color, 'important');
+            }
+            key.addEventListener('click', () => {
+                this.addKisimItem(kisim.id, kisim.name, kisim.tax_rate, kisim.preset_price, kisim.weighed === true);
+            });
+            grid.appendChild(key);
+        });
+
+        const pages = group.pages.length;
+        document.getElementById('kisim-pager').classList.toggle('hidden', pages < 2);
+        document.getElementById('kisim-page-label').textContent = t('ui.kisim_page', this.kisimPage + 1, pages);
+        document.getElementById('kisim-prev').disabled = this.kisimPage === 0;
+        document.getElementById('kisim-next').disabled = this.kisimPage === pages - 1;
+    }
+    
     setupEventListeners() {
-        // Kisim buttons
-        document.querySelectorAll('.kisim-btn').forEach(btn => {
+        // Kisim buttons of the keypad; the department panel wires its own
+        document.querySelectorAll('.kisim-btn[data-kisim-id]').forEach(btn => {
             btn.addEventListener('click', (e) => {
                 const kisimId = parseInt(e.currentTarget.dataset.kisimId);
                 const kisimName = e.currentTarget.dataset.kisimName;
                 const taxRate = parseInt(e.currentTarget.dataset.taxRate);
                 const presetPrice = parseFloat(e.currentTarget.dataset.presetPrice);
-                this.addKisimItem(kisimId, kisimName, taxRate, presetPrice);
+                const weighed = e.currentTarget.dataset.weighed === 'true';
+                this.addKisimItem(kisimId, kisimName, taxRate, presetPrice, weighed);
             });
         });
+
+        // Department key pages
+        document.getElementById('kisim-prev').addEventListener('click', () => {
+            if (this.kisimPage > 0) {
+                this.kisimPage--;
+                this.renderKisimPanel();
+            }
+        });
+        document.getElementById('kisim-next').addEventListener('click', () => {
+            const pages = this.kisimGroups[this.kisimGroup]?.pages.length || 0;
+            if (this.kisimPage < pages - 1) {
+                this.kisimPage++;
+                this.renderKisimPanel();
+            }
+        });
         
         // Numeric keypad
         document.querySelectorAll('.num-btn').forEach(btn => {
@@ -66,6 +168,29 @@ class CashRegister {
         document.getElementById('miktar-btn').addEventListener('click', () => {
             this.captureMiktar();
         });
+
+        // NOT button
+        document.getElementById('note-btn').addEventListener('click', () => {
+            this.captureNote();
+        });
+
+        // FATURA button
+        document.getElementById('invoice-btn').addEventListener('click', () => {
+            this.captureCustomer();
+        });
+
+        // BEKLET and CAGIR buttons
+        document.getElementById('hold-btn').addEventListener('click', () => {
+            this.holdTransaction();
+        });
+        document.getElementById('recall-btn').addEventListener('click', () => {
+            this.recallTransaction();
+        });
+
+        // IADE button
+        document.getElementById('refund-btn').addEventListener('click', () => {
+            this.captureRefund();
+        });
         
         // Payment method buttons - immediately complete transaction
         document.querySelectorAll('.payment-btn').forEach(btn => {
@@ -85,9 +210,14 @@ class CashRegister {
         document.getElementById('qr-cancel').addEventListener('click', () => {
             this.hideQRModal();
         });
+        
+        // Virtual customer receipt
+        document.getElementById('receipt-close').addEventListener('click', () => {
+            document.getElementById('receipt-modal').classList.add('hidden');
+        });
     }
     
-    async addKisimItem(kisimId, kisimName, taxRate, presetPrice) {
+    async addKisimItem(kisimId, kisimName, taxRate, presetPrice, weighed = false) {
         let finalPrice = presetPrice;
         let finalQuantity = this.nextItemQuantity;
         
@@ -105,9 +235,17 @@ class CashRegister {
             }
         }
         
+        // Weighed KISIMs take their weight from the scale (quantity 0) and are priced per kg
+        if (weighed) {
+            await this.addNewItem(kisimId, 0, finalPrice);
+            this.log(t('ui.item_weighed', kisimName, '₺' + this.formatAmount(finalPrice)));
+            this.resetInputState();
+            return;
+        }
+
         // Add the item with custom price and quantity
         await this.addNewItem(kisimId, finalQuantity, finalPrice);
-        this.log(`Ürün eklendi: ${kisimName} - ₺${finalPrice.toFixed(2)} x${finalQuantity}`);
+        this.log(t('ui.item_added', kisimName, '₺' + this.formatAmount(finalPrice), finalQuantity));
         
         // Reset state after adding item
         this.resetInputState();
@@ -141,7 +279,7 @@ class CashRegister {
         this.inputMode = 'price';
         this.currentInput = '';
         
-        this.log(`MIKTAR: Sonraki ürün miktarı ${this.nextItemQuantity} olarak ayarlandı`);
+        this.log(t('ui.quantity_set', this.nextItemQuantity));
         
         // Visual feedback to show MIKTAR was pressed
         const miktarBtn = document.getElementById('miktar-btn');
@@ -153,9 +291,168 @@ class CashRegister {
         this.updateInputDisplay();
     }
     
+    captureNote() {
+        const note = prompt(t('ui.note_prompt'), this.nextItemNote);
+        if (note === null) {
+            return;
+        }
+        this.nextItemNote = note.trim();
+        this.log(this.nextItemNote ? t('ui.note_set', this.nextItemNote) : t('ui.note_cleared'));
+    }
+
+    async captureCustomer() {
+        const taxNumber = prompt(t('ui.customer_tax_prompt'), this.currentTransaction.customer?.tax_number || '');
+        if (taxNumber === null) {
+            return;
+        }
+        let name = '';
+        if (taxNumber.trim()) {
+            name = prompt(t('ui.customer_name_prompt'), this.currentTransaction.customer?.name || '');
+            if (name === null) {
+                return;
+            }
+        }
+
+        try {
+            const response = await fetch('api/transaction/customer', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ tax_number: taxNumber, name: name })
+            });
+            const data = await response.json();
+            if (!response.ok) {
+                this.showError(data.error || t('ui.customer_failed'));
+                return;
+            }
+            this.currentTransaction.customer = data.customer;
+            if (data.customer) {
+                const kind = data.customer.tax_number.length === 11 ? 'TCKN' : 'VKN';
+                this.log(t('ui.customer_set', kind, data.customer.tax_number, data.customer.name));
+            } else {
+                this.log(t('ui.customer_cleared'));
+            }
+        } catch (error) {
+            this.showError(t('ui.customer_failed') + ': ' + error.message);
+        }
+    }
+
+    // Refund: the original receipt's serial, or its signed receipt in base64 as scanned,
+    // then how much of each original line comes back
+    async captureRefund() {
+        const original = prompt(t('ui.refund_prompt'));
+        if (original === null || !original.trim()) {
+            return;
+        }
+        const value = original.trim();
+        const body = /^F\d+$/i.test(value) ? { serial: value } : { signed_receipt: value };
+
+        try {
+            const response = await fetch('api/transaction/refund', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(body)
+            });
+            const data = await response.json();
+            if (!response.ok) {
+                this.showError(data.error || t('ui.refund_failed'));
+                return;
+            }
+            this.currentTransaction.items = [];
+            this.currentTransaction.customer = data.original.customer;
+            this.log(t('ui.refund_started', data.original.receipt_serial, '₺' + this.formatAmount(data.original.total_amount)));
+
+            for (const line of data.lines) {
+                if (line.refundable_quantity === 0) {
+                    continue;
+                }
+                const name = line.item.kisim_name || ('KISIM ' + line.item.kisim_id);
+                const answer = prompt(t('ui.refund_line_prompt', name, line.refundable_quantity), String(line.refundable_quantity));
+                if (answer === null) {
+                    break;
+                }
+                const quantity = parseInt(answer, 10);
+                if (!quantity) {
+                    continue;
+                }
+                const added = await fetch('api/transaction/refund/add-item', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ line: line.line, quantity: quantity })
+                });
+                const addedData = await added.json();
+                if (!added.ok) {
+                    this.showError(addedData.error || t('ui.refund_failed'));
+                    continue;
+                }
+                this.currentTransaction.items = addedData.items;
+            }
+            this.updateTransactionDisplay();
+        } catch (error) {
+            this.showError(t('ui.refund_failed') + ': ' + error.message);
+        }
+    }
+
+    // Park the sale for a customer who stepped away; an optional label tells held sales apart
+    async holdTransaction() {
+        const label = prompt(t('ui.hold_prompt'));
+        if (label === null) {
+            return;
+        }
+
+        try {
+            const response = await fetch('api/transaction/hold', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ label: label.trim() })
+            });
+            const data = await response.json();
+            if (!response.ok) {
+                this.showError(data.error || t('ui.hold_failed'));
+                return;
+            }
+            this.log(t('ui.held', data.id, '₺' + this.formatAmount(data.total)));
+            this.resetTransaction();
+        } catch (error) {
+            this.showError(t('ui.hold_failed') + ': ' + error.message);
+        }
+    }
+
+    // Resume a held sale, picked by its hold ID from the list
+    async recallTransaction() {
+        try {
+            const listResponse = await fetch('api/transaction/held');
+            const list = await listResponse.json();
+            if (!list.held || list.held.length === 0) {
+                this.showError(t('ui.no_held'));
+                return;
+            }
+            const choices = list.held.map(held =>
+                `${held.id}  ${held.label || ''}  ₺${this.formatAmount(held.total)}`).join('\n');
+            const id = prompt(t('ui.recall_prompt') + '\n' + choices, list.held[list.held.length - 1].id);
+            if (id === null || !id.trim()) {
+                return;
+            }
+
+            const response = await fetch(`api/transaction/held/${encodeURIComponent(id.trim())}/recall`, { method: 'POST' });
+            const data = await response.json();
+            if (!response.ok) {
+                this.showError(data.error || t('ui.recall_failed'));
+                return;
+            }
+            this.currentTransaction.items = data.items;
+            this.currentTransaction.paymentMethod = data.payment_method;
+            this.currentTransaction.customer = data.customer;
+            this.updateTransactionDisplay();
+            this.log(t('ui.recalled', id.trim().toUpperCase()));
+        } catch (error) {
+            this.showError(t('ui.recall_failed') + ': ' + error.message);
+        }
+    }
+
     resetInputState() {
         this.currentInput = '';
         this.nextItemQuantity = 1;
+        this.nextItemNote = '';
         this.inputMode = 'ambiguous';
         this.updateInputDisplay();
     }
@@ -165,9 +462,9 @@ class CashRegister {
         if (this.currentInput) {
             let modeLabel = '';
             if (this.inputMode === 'price') {
-                modeLabel = 'FİYAT: ';
+                modeLabel = t('ui.price_mode');
             } else if (this.inputMode === 'quantity') {
-                modeLabel = 'MİKTAR: ';
+                modeLabel = t('ui.quantity_mode');
             } else {
                 // ambiguous mode - show the number without label
                 modeLabel = '';
@@ -180,15 +477,15 @@ class CashRegister {
     
     async startTransaction() {
         try {
-            const response = await fetch('/api/transaction/start', { method: 'POST' });
+            const response = await fetch('api/transaction/start', { method: 'POST' });
             if (response.ok) {
-                this.log('Yeni işlem başlatıldı');
+                this.log(t('ui.transaction_started'));
             } else {
                 const errorData = await response.json();
-                this.showError('İşlem başlatılamadı: ' + (errorData.error || 'Bilinmeyen hata'));
+                this.showError(t('ui.transaction_start_failed', errorData.error || t('ui.unknown_error')));
             }
         } catch (error) {
-            this.showError('İşlem başlatılamadı: ' + error.message);
+            this.showError(t('ui.transaction_start_failed', error.message));
         }
     }
     
@@ -203,8 +500,11 @@ class CashRegister {
             if (unitPrice !== null && unitPrice > 0) {
                 body.unit_price = unitPrice;
             }
+            if (this.nextItemNote) {
+                body.note = this.nextItemNote;
+            }
             
-            const response = await fetch('/api/transaction/add-item', {
+            const response = await fetch('api/transaction/add-item', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify(body)
@@ -214,12 +514,15 @@ class CashRegister {
                 const data = await response.json();
                 this.currentTransaction.items = data.items;
                 this.updateTransactionDisplay();
+                (data.stock_warnings || []).forEach(level => {
+                    this.log(t('ui.low_stock', level.name, level.quantity));
+                });
             } else {
                 const errorData = await response.json();
-                this.showError(errorData.error || 'Ürün eklenemedi');
+                this.showError(errorData.error || t('ui.item_add_failed'));
             }
         } catch (error) {
-            this.showError('Ürün eklenemedi: ' + error.message);
+            this.showError(t('ui.item_add_failed') + ': ' + error.message);
         }
     }
     
@@ -240,14 +543,14 @@ class CashRegister {
         try {
             // Ensure we have an active transaction
             if (!this.currentTransaction || this.currentTransaction.items.length === 0) {
-                this.showError('Önce ürün ekleyin!');
+                this.showError(t('ui.add_items_first'));
                 return;
             }
             
-            this.log(`Ödeme yöntemi: ${method} - İşlem tamamlanıyor...`);
+            this.log(t('ui.completing', method));
             
             // Set payment method
-            const paymentResponse = await fetch('/api/transaction/payment', {
+            const paymentResponse = await fetch('api/transaction/payment', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ payment_method: method })
@@ -255,14 +558,20 @@ class CashRegister {
             
             if (!paymentResponse.ok) {
                 const errorData = await paymentResponse.json();
-                this.showError(errorData.error || 'Ödeme yöntemi ayarlanamadı');
+                this.showError(errorData.error || t('ui.payment_failed'));
                 return;
             }
             
+            // Show what the customer pays before issuing (cash rounding, foreign currency)
+            await this.showPreview(method);
+            
             // Check if standalone mode or needs QR scan
             const isStandaloneMode = document.body.dataset.standalone === 'true';
             
-            if (isStandaloneMode) {
+            if (isStandaloneMode && document.body.dataset.virtualCustomer === 'true') {
+                // The register plays the customer's wallet and shows what it received
+                await this.issueToVirtualCustomer();
+            } else if (isStandaloneMode) {
                 // Process immediately without QR scan
                 await this.submitTransaction('mock_ephemeral_key');
             } else {
@@ -271,16 +580,37 @@ class CashRegister {
             }
             
         } catch (error) {
-            this.showError('İşlem tamamlanamadı: ' + error.message);
+            this.showError(t('ui.complete_failed', error.message));
             this.resetTransaction();
         }
     }
     
     
+    async showPreview(method) {
+        try {
+            const response = await fetch('api/transaction/preview');
+            if (!response.ok) {
+                return;
+            }
+            const preview = await response.json();
+            let due = '₺' + this.formatAmount(preview.amount_due || preview.total_amount);
+            if (preview.currency) {
+                due = preview.currency + ' ' + this.formatAmount(preview.foreign_total);
+            }
+            (preview.surcharges || []).forEach(surcharge => {
+                this.log(surcharge.name + ' ₺' + this.formatAmount(surcharge.amount));
+            });
+            document.getElementById('payment-display').textContent = t('ui.amount_due', method, due);
+            this.log(t('ui.amount_due', method, due) + ' - ' + preview.receipt_serial);
+        } catch (error) {
+            // The preview is informational; issuing reports any real problem
+        }
+    }
+    
     async submitTransaction(ephemeralKey) {
         try {
-            this.log('İşlem gönderiliyor...');
-            const response = await fetch('/api/transaction/issue_receipt', {
+            this.log(t('ui.submitting'));
+            const response = await fetch('api/transaction/issue_receipt', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ ephemeral_key: ephemeralKey })
@@ -288,32 +618,61 @@ class CashRegister {
             
             if (response.ok) {
                 const receipt = await response.json();
-                this.showSuccess('İşlem başarıyla tamamlandı!');
-                this.log(`İşlem tamamlandı - Fiş ID: ${receipt.receipt_id}`);
+                this.showSuccess(t('ui.completed'));
+                this.log(t('ui.completed_log', receipt.receipt_id));
                 this.resetTransaction();
             } else {
                 const errorData = await response.json();
-                this.showError('İşlem başarısız: ' + (errorData.error || 'Bilinmeyen hata'));
+                this.showError(t('ui.issue_failed', errorData.error || t('ui.unknown_error')));
                 this.resetTransaction(); // Cancel transaction on error
             }
         } catch (error) {
-            this.showError('İşlem hatası: ' + error.message);
+            this.showError(t('ui.issue_error', error.message));
             this.resetTransaction();
         }
     }
     
+    async issueToVirtualCustomer() {
+        try {
+            this.log(t('ui.virtual_submitting'));
+            const response = await fetch('api/transaction/virtual_customer?lang=' + document.documentElement.lang, {
+                method: 'POST'
+            });
+            
+            if (response.ok) {
+                const result = await response.json();
+                this.showSuccess(t('ui.completed'));
+                this.log(t('ui.virtual_verified', result.collected.receipt_serial, result.encrypted_bytes));
+                this.showVirtualReceipt(result);
+            } else {
+                const errorData = await response.json();
+                this.showError(t('ui.issue_failed', errorData.error || t('ui.unknown_error')));
+            }
+        } catch (error) {
+            this.showError(t('ui.issue_error', error.message));
+        }
+        this.resetTransaction();
+    }
+    
+    showVirtualReceipt(result) {
+        document.getElementById('receipt-text').textContent = result.text;
+        document.getElementById('receipt-verification').textContent =
+            t('ui.virtual_details', result.encrypted_bytes, result.signed_bytes);
+        document.getElementById('receipt-modal').classList.remove('hidden');
+    }
+    
     async cancelTransaction() {
         try {
-            const response = await fetch('/api/transaction/cancel', { method: 'POST' });
+            const response = await fetch('api/transaction/cancel', { method: 'POST' });
             if (response.ok || response.status === 204) {
                 this.resetTransaction();
-                this.log('İşlem iptal edildi');
+                this.log(t('ui.cancelled'));
             } else {
                 const errorData = await response.json();
-                this.showError('İptal edilemedi: ' + (errorData.error || 'Bilinmeyen hata'));
+                this.showError(t('ui.cancel_failed', errorData.error || t('ui.unknown_error')));
             }
         } catch (error) {
-            this.showError('İptal edilemedi: ' + error.message);
+            this.showError(t('ui.cancel_failed', error.message));
         }
     }
     
@@ -340,33 +699,37 @@ class CashRegister {
         const totalElement = document.getElementById('total-display');
         
         if (this.currentTransaction.items.length === 0) {
-            container.innerHTML = '<div class="text-center text-opacity-60 py-4 text-xs">0,00</div>';
-            totalElement.textContent = '0,00';
+            container.innerHTML = `<div class="text-center text-opacity-60 py-4 text-xs">${this.formatAmount(0)}</div>`;
+            totalElement.textContent = this.formatAmount(0);
             this.currentTransaction.total = 0;
         } else {
             let total = 0;
             const itemsHtml = this.currentTransaction.items.map((item, index) => {
-                const itemTotal = item.quantity * item.unit_price;
+                const itemTotal = item.total_price;
                 total += itemTotal;
+                const quantity = item.weighed
+                    ? (item.quantity / 1000).toLocaleString(locale, { minimumFractionDigits: 3, maximumFractionDigits: 3 }) + ' kg'
+                    : item.quantity;
                 
                 return `
                     <div class="flex justify-between text-xs py-1">
                         <span class="truncate">${item.kisim_name.substring(0, 8)}</span>
-                        <span>${item.quantity}</span>
-                        <span>${this.formatTurkishCurrency(itemTotal)}</span>
+                        <span>${quantity}</span>
+                        <span>${this.formatAmount(itemTotal)}</span>
                     </div>
+                    ${item.note ? `<div class="text-xs opacity-75 pl-2 pb-1 truncate">${escapeHTML(item.note)}</div>` : ''}
                 `;
             }).join('');
             
             container.innerHTML = itemsHtml;
-            totalElement.textContent = this.formatTurkishCurrency(total);
+            totalElement.textContent = this.formatAmount(total);
             this.currentTransaction.total = total;
         }
     }
     
-    formatTurkishCurrency(amount) {
-        // Format as Turkish currency with comma as decimal separator
-        return amount.toFixed(2).replace('.', ',');
+    formatAmount(amount) {
+        // Two decimals with the page locale's separators (1.234,56 in Turkish)
+        return amount.toLocaleString(locale, { minimumFractionDigits: 2, maximumFractionDigits: 2 });
     }
     
     
@@ -398,7 +761,7 @@ class CashRegister {
             
             this.qrScanner = new QrScanner(videoElement, 
                 (result) => {
-                    this.log(`QR kod tarandı: ${result.data.substring(0, 20)}...`);
+                    this.log(t('ui.qr_scanned', result.data.substring(0, 20)));
                     this.hideQRModal();
                     this.submitTransaction(result.data);
                 },
@@ -411,9 +774,9 @@ class CashRegister {
             );
             
             await this.qrScanner.start();
-            this.log('QR tarayıcı başlatıldı');
+            this.log(t('ui.scanner_started'));
         } catch (error) {
-            this.showError('QR tarayıcı başlatılamadı: ' + error.message);
+            this.showError(t('ui.scanner_failed', error.message));
             this.hideQRModal();
             // Fallback to mock key for demo
             await this.submitTransaction('mock_ephemeral_key_fallback');
@@ -423,8 +786,8 @@ class CashRegister {
     
     updateClock() {
         const now = new Date();
-        const timeString = now.toLocaleTimeString('tr-TR', {hour: '2-digit', minute: '2-digit', second: '2-digit'});
-        const dateString = now.toLocaleDateString('tr-TR', {day: '2-digit', month: '2-digit', year: 'numeric'});
+        const timeString = now.toLocaleTimeString(locale, {hour: '2-digit', minute: '2-digit', second: '2-digit'});
+        const dateString = now.toLocaleDateString(locale, {day: '2-digit', month: '2-digit', year: 'numeric'});
         
         const timeElement = document.getElementById('current-time');
         if (timeElement) {
@@ -443,7 +806,7 @@ class CashRegister {
     
     showError(message) {
         this.showMessage(message, 'error');
-        this.log(`HATA: ${message}`);
+        this.log(t('ui.error', message));
     }
     
     showMessage(message, type) {
@@ -472,7 +835,7 @@ class CashRegister {
     log(message) {
         const logContainer = document.getElementById('log-content');
         if (logContainer) {
-            const timestamp = new Date().toLocaleTimeString('tr-TR');
+            const timestamp = new Date().toLocaleTimeString(locale);
             const logEntry = `[${timestamp}] ${message}\n`;
             logContainer.textContent += logEntry;
             logContainer.scrollTop = logContainer.scrollHeight;
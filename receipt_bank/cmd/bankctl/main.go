@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"receipt-bank/internal/handlers"
+	"receipt-bank/internal/models"
+	"receipt-bank/internal/storage"
+)
+
+const usage = `Usage: bankctl <command> [flags]
+
+Commands:
+  stats      Storage, cleanup and webhook counts
+  history    Submissions, collections, expiries and webhooks per hour or day
+  receipts   List stored receipts (metadata only)
+  delete     Delete a receipt by receipt ID
+  cleanup    Run a cleanup pass now
+  compact    Rebuild the in-memory indexes after a burst of receipts has gone
+  snapshot   Write the bank's snapshot file now, or download a snapshot with -o
+  restore    Restore the bank's snapshot file, or upload a downloaded one
+  webhooks   Show webhook notifications that failed after every retry
+
+Every command takes:
+  -url    Receipt bank URL (default $BANKCTL_URL or http://127.0.0.1:4403)
+  -token  Admin token (default $BANKCTL_TOKEN)
+  -json   Print the API response as JSON instead of a table
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "stats":
+		err = statsCommand(args)
+	case "history":
+		err = historyCommand(args)
+	case "receipts":
+		err = receiptsCommand(args)
+	case "delete":
+		err = deleteCommand(args)
+	case "cleanup":
+		err = cleanupCommand(args)
+	case "compact":
+		err = compactCommand(args)
+	case "snapshot":
+		err = snapshotCommand(args)
+	case "restore":
+		err = restoreCommand(args)
+	case "webhooks":
+		err = webhooksCommand(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bankctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// client calls the admin API of one receipt bank
+type client struct {
+	baseURL string
+	token   string
+	json    bool
+	http    *http.Client
+}
+
+// newFlags returns a flag set with the flags every command takes
+func newFlags(name string) (*flag.FlagSet, *client) {
+	c := &client{http: &http.Client{Timeout: 30 * time.Second}}
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.StringVar(&c.baseURL, "url", envOr("BANKCTL_URL", "http://127.0.0.1:4403"), "Receipt bank URL")
+	flags.StringVar(&c.token, "token", os.Getenv("BANKCTL_TOKEN"), "Admin token")
+	flags.BoolVar(&c.json, "json", false, "Print JSON instead of a table")
+	return flags, c
+}
+
+func envOr(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// call sends an admin API request and decodes a JSON response into out (if not nil)
+func (c *client) call(method, path string, query url.Values, out interface{}) error {
+	body, err := c.send(method, path, query, nil, "application/json")
+	if err != nil {
+		return err
+	}
+
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	return nil
+}
+
+// send sends an admin API request, with payload as a raw body if not nil, and returns
+// the response body
+func (c *client) send(method, path string, query url.Values, payload []byte, accept string) ([]byte, error) {
+	if c.token == "" {
+		return nil, fmt.Errorf("no admin token (set -token or BANKCTL_TOKEN)")
+	}
+
+	target := strings.TrimRight(c.baseURL, "/") + "/v" + handlers.APIVersion + "/admin" + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(handlers.AdminTokenHeader, c.token)
+	req.Header.Set("Accept", accept)
+	if payload != nil {
+		req.Header.Set("Content-Type", handlers.StreamContentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach receipt bank: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr models.ErrorResponse
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("%s (%d %s)", apiErr.Error, resp.StatusCode, apiErr.Code)
+		}
+		return nil, fmt.Errorf("receipt bank returned status %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// printJSON prints v indented, for -json
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func statsCommand(args []string) error {
+	flags, c := newFlags("stats")
+	flags.Parse(args)
+
+	var stats handlers.AdminStatsResponse
+	if err := c.call("GET", "/stats", nil, &stats); err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(stats)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Receipts stored\t%d\n", stats.Storage.Total)
+	fmt.Fprintf(w, "  expired\t%d\n", stats.Storage.Expired)
+	fmt.Fprintf(w, "  collected, in grace period\t%d\n", stats.Storage.Collected)
+	fmt.Fprintf(w, "Recollections\t%d\n", stats.Storage.Recollections)
+	fmt.Fprintf(w, "Receipts purged\t%d\n", stats.Storage.Purged)
+	if d := stats.Deduplication; d != nil {
+		fmt.Fprintf(w, "Unique payloads\t%d (%d shared)\n", d.UniquePayloads, d.SharedPayloads)
+		fmt.Fprintf(w, "Duplicate submissions\t%d (%d bytes saved)\n", d.Duplicates, d.BytesSaved)
+	}
+	fmt.Fprintf(w, "Cleanup strategies\t%s\n", joinStrategies(stats.Cleanup.Strategies))
+	if stats.Cleanup.MaxCount > 0 {
+		fmt.Fprintf(w, "Receipt limit\t%d\n", stats.Cleanup.MaxCount)
+	}
+	fmt.Fprintf(w, "Cleanup runs\t%d (%d removed)\n", stats.Cleanup.Runs, stats.Cleanup.TotalRemoved)
+	if run := stats.Cleanup.LastRun; run != nil {
+		fmt.Fprintf(w, "Last cleanup\t%s, %s, %d removed\n", formatTime(run.StartedAt), run.Trigger, run.Removed)
+	}
+	fmt.Fprintf(w, "Webhooks delivered\t%d\n", stats.Webhooks.Delivered)
+	fmt.Fprintf(w, "Webhooks failed\t%d\n", stats.Webhooks.Failed)
+	fmt.Fprintf(w, "Webhook queue\t%d/%d (%d workers, %d dropped)\n", stats.Webhooks.Queued, stats.Webhooks.QueueCapacity,
+		stats.Webhooks.Workers, stats.Webhooks.Dropped)
+	fmt.Fprintf(w, "Webhook latency\t%.0fms avg, %dms max\n", stats.Webhooks.LatencyAvgMs, stats.Webhooks.LatencyMaxMs)
+	return w.Flush()
+}
+
+func historyCommand(args []string) error {
+	flags, c := newFlags("history")
+	bucket := flags.String("bucket", "hour", "Bucket size: hour or day")
+	from := flags.String("from", "", "Start, RFC 3339 (default 24 hours, or 7 days by day, before -to)")
+	to := flags.String("to", "", "End, RFC 3339 (default now)")
+	flags.Parse(args)
+
+	query := url.Values{"bucket": {*bucket}}
+	if *from != "" {
+		query.Set("from", *from)
+	}
+	if *to != "" {
+		query.Set("to", *to)
+	}
+
+	var history handlers.UsageHistoryResponse
+	if err := c.call("GET", "/stats/history", query, &history); err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(history)
+	}
+
+	layout := "2006-01-02 15:04"
+	if history.Bucket == handlers.UsageBucketDay {
+		layout = "2006-01-02"
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "START\tSUBMITTED\tCOLLECTED\tAVG WAIT\tEXPIRED\tEXPIRY RATE\tWEBHOOKS OK\t")
+	row := func(label string, summary handlers.UsageSummary) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\t%s\t%s\t\n", label,
+			summary.Submitted, summary.Collected, formatSeconds(summary.AvgCollectionSeconds),
+			summary.Expired, formatRate(summary.ExpiryRate), formatRate(summary.WebhookSuccessRate))
+	}
+	for _, summary := range history.Buckets {
+		row(summary.Start.Local().Format(layout), summary)
+	}
+	row("total", history.Totals)
+	return w.Flush()
+}
+
+func receiptsCommand(args []string) error {
+	flags, c := newFlags("receipts")
+	register := flags.String("register", "", "Only receipts from this cash register")
+	limit := flags.Int("limit", 0, "Only the newest N receipts")
+	flags.Parse(args)
+
+	query := url.Values{}
+	if *register != "" {
+		query.Set("register", *register)
+	}
+	if *limit > 0 {
+		query.Set("limit", strconv.Itoa(*limit))
+	}
+
+	var list handlers.ReceiptListResponse
+	if err := c.call("GET", "/receipts", query, &list); err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(list)
+	}
+
+	if len(list.Receipts) == 0 {
+		fmt.Println("No receipts")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RECEIPT ID\tREGISTER\tKEY\tSUBMITTED\tEXPIRES\tCOLLECTED\tSIZE")
+	for _, info := range list.Receipts {
+		collected := "-"
+		if info.CollectedAt != nil {
+			collected = fmt.Sprintf("%s (%dx)", formatTime(*info.CollectedAt), info.CollectionCount)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s…\t%s\t%s\t%s\t%d\n",
+			info.ReceiptID, orDash(info.RegisterID), info.KeyPrefix,
+			formatTime(info.SubmittedAt), formatTime(info.ExpiresAt), collected, info.Size)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(list.Receipts) < list.Total {
+		fmt.Printf("\n%d of %d receipts shown\n", len(list.Receipts), list.Total)
+	}
+	return nil
+}
+
+func deleteCommand(args []string) error {
+	flags, c := newFlags("delete")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: bankctl delete [flags] <receipt_id>")
+	}
+	receiptID := flags.Arg(0)
+
+	if err := c.call("DELETE", "/receipts/"+url.PathEscape(receiptID), nil, nil); err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(map[string]string{"deleted": receiptID})
+	}
+	fmt.Printf("Deleted receipt %s\n", receiptID)
+	return nil
+}
+
+func cleanupCommand(args []string) error {
+	flags, c := newFlags("cleanup")
+	flags.Parse(args)
+
+	var run storage.CleanupRun
+	if err := c.call("POST", "/cleanup", nil, &run); err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(run)
+	}
+
+	fmt.Printf("Scanned %d receipts, removed %d, %d remaining (%.1f ms)\n", run.Scanned, run.Removed, run.Remaining, run.DurationMs)
+	for strategy, removed := range run.RemovedBy {
+		fmt.Printf("  %s: %d\n", strategy, removed)
+	}
+	return nil
+}
+
+func compactCommand(args []string) error {
+	flags, c := newFlags("compact")
+	flags.Parse(args)
+
+	var result storage.CompactResult
+	if err := c.call("POST", "/compact", nil, &result); err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(result)
+	}
+	fmt.Printf("Compacted %d receipts in %d buckets (%d ms)\n", result.Receipts, result.Buckets, result.Ms)
+	return nil
+}
+
+func snapshotCommand(args []string) error {
+	flags, c := newFlags("snapshot")
+	output := flags.String("o", "", "Download a snapshot to this file instead of writing the bank's snapshot file")
+	flags.Parse(args)
+
+	if *output == "" {
+		var info storage.SnapshotInfo
+		if err := c.call("POST", "/snapshot", nil, &info); err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(info)
+		}
+		fmt.Printf("Wrote %d receipts to %s on the bank (%d bytes)\n", info.Receipts, info.File, info.Size)
+		return nil
+	}
+
+	// A long timeout: a large snapshot takes a while to encrypt and transfer
+	c.http.Timeout = 10 * time.Minute
+	data, err := c.send("GET", "/snapshot", nil, nil, handlers.StreamContentType)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*output, data, 0600); err != nil {
+		return fmt.Errorf("failed to write snapshot: %v", err)
+	}
+	if c.json {
+		return printJSON(map[string]interface{}{"file": *output, "size_bytes": len(data)})
+	}
+	fmt.Printf("Downloaded snapshot to %s (%d bytes)\n", *output, len(data))
+	return nil
+}
+
+func restoreCommand(args []string) error {
+	flags, c := newFlags("restore")
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		return fmt.Errorf("usage: bankctl restore [flags] [snapshot file]")
+	}
+
+	// Without a file the bank restores its own snapshot file
+	var data []byte
+	if flags.NArg() == 1 {
+		var err error
+		if data, err = os.ReadFile(flags.Arg(0)); err != nil {
+			return fmt.Errorf("failed to read snapshot: %v", err)
+		}
+		c.http.Timeout = 10 * time.Minute
+	}
+
+	body, err := c.send("POST", "/snapshot/restore", nil, data, "application/json")
+	if err != nil {
+		return err
+	}
+	var result storage.RestoreResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	if c.json {
+		return printJSON(result)
+	}
+	fmt.Printf("Restored %d receipts (%d expired since the snapshot, %d already stored)\n", result.Restored, result.Expired, result.Existing)
+	return nil
+}
+
+func webhooksCommand(args []string) error {
+	flags, c := newFlags("webhooks")
+	follow := flags.Bool("follow", false, "Keep polling for new failures")
+	interval := flags.Duration("interval", 5*time.Second, "Poll interval with -follow")
+	flags.Parse(args)
+
+	var after int64
+	var w *tabwriter.Writer
+	if !c.json {
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SEQ\tFAILED\tRECEIPT ID\tATTEMPTS\tWEBHOOK\tERROR")
+	}
+
+	for {
+		var page handlers.WebhookFailuresResponse
+		if err := c.call("GET", "/webhooks/failures", url.Values{"after": {strconv.FormatInt(after, 10)}}, &page); err != nil {
+			return err
+		}
+
+		if c.json {
+			// One failure per line when following, so the output can be piped
+			for _, failure := range page.Failures {
+				if err := json.NewEncoder(os.Stdout).Encode(failure); err != nil {
+					return err
+				}
+			}
+		} else {
+			for _, failure := range page.Failures {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\n",
+					failure.Seq, formatTime(failure.FailedAt), failure.ReceiptID, failure.Attempts, failure.WebhookURL, failure.Error)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+
+		// A restarted bank starts counting again
+		if page.LastSeq < after {
+			after = 0
+			continue
+		}
+		after = page.LastSeq
+		if !*follow {
+			return nil
+		}
+		time.Sleep(*interval)
+	}
+}
+
+func joinStrategies(strategies []storage.Strategy) string {
+	names := make([]string, len(strategies))
+	for i, strategy := range strategies {
+		names[i] = string(strategy)
+	}
+	return strings.Join(names, ", ")
+}
+
+func formatTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func formatSeconds(seconds *float64) string {
+	if seconds == nil {
+		return "-"
+	}
+	return time.Duration(*seconds * float64(time.Second)).Round(time.Second).String()
+}
+
+func formatRate(rate *float64) string {
+	if rate == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", *rate*100)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
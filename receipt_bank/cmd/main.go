@@ -1,13 +1,27 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"errors"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
+	"receipt-bank/internal/accesslog"
+	"receipt-bank/internal/analytics"
+	"receipt-bank/internal/attestation"
 	"receipt-bank/internal/config"
+	"receipt-bank/internal/discovery"
 	"receipt-bank/internal/handlers"
+	"receipt-bank/internal/models"
+	"receipt-bank/internal/registers"
 	"receipt-bank/internal/server"
 	"receipt-bank/internal/storage"
+	"receipt-bank/internal/wallet"
 	"receipt-bank/internal/webhook"
 )
 
@@ -21,40 +35,303 @@ func main() {
 	if cfg.Server.Verbose {
 		log.Printf("[MAIN] Receipt Bank starting...")
 		log.Printf("[MAIN] Configuration loaded from: config.yaml")
-		log.Printf("[MAIN] Server port: %d", cfg.Server.Port)
+		log.Printf("[MAIN] Listen address: %s", cfg.Listen)
 		log.Printf("[MAIN] Cleanup interval: %v", cfg.CleanupInterval)
-		log.Printf("[MAIN] Max receipt age: %v", cfg.MaxReceiptAge)
+		log.Printf("[MAIN] Max receipt age: %v (per-receipt ttl up to %v)", cfg.MaxReceiptAge, cfg.MaxReceiptTTL)
+		log.Printf("[MAIN] Collection grace period: %v", cfg.GracePeriod)
 		log.Printf("[MAIN] Webhook timeout: %v", cfg.WebhookTimeout)
 		log.Printf("[MAIN] Webhook max retries: %d", cfg.Webhooks.MaxRetries)
 	}
 
 	// Initialize storage
-	storage := storage.NewMemoryStorage(cfg.MaxReceiptAge, cfg.Server.Verbose)
-	storage.StartCleanupRoutine(cfg.CleanupInterval)
+	var store storage.Storage
+	var snapshots *storage.Snapshots
+	switch cfg.Storage.Backend {
+	case config.BackendRedis:
+		redisStore, err := storage.NewRedisStorage(cfg.Redis, cfg.MaxReceiptAge, cfg.GracePeriod, cfg.Server.Verbose)
+		if err != nil {
+			log.Fatalf("Failed to connect to Redis at %s: %v", cfg.Redis.Address, err)
+		}
+		defer redisStore.Close()
+		redisStore.SetCleanupPolicy(cfg.CleanupPolicy)
+		redisStore.SetUsageRetention(cfg.UsageRetention)
+		store = redisStore
+		log.Printf("[MAIN] Receipts are shared through Redis at %s (prefix %q)", cfg.Redis.Address, cfg.Redis.KeyPrefix)
+	default:
+		memoryStore := storage.NewMemoryStorage(cfg.MaxReceiptAge, cfg.GracePeriod, cfg.Server.Verbose)
+		memoryStore.SetCleanupPolicy(cfg.CleanupPolicy)
+		memoryStore.SetUsageRetention(cfg.UsageRetention)
+		if cfg.Storage.Deduplicate {
+			memoryStore.EnableDeduplication()
+			log.Printf("[MAIN] Identical receipt payloads are stored once")
+		}
+		store = memoryStore
+
+		if cfg.Storage.Snapshot.Enabled {
+			snapshots = storage.NewSnapshots(memoryStore, cfg.Storage.Snapshot.File, cfg.Storage.Snapshot.Passphrase, cfg.Server.Verbose)
+			if cfg.Storage.Snapshot.RestoreOnStart {
+				result, err := snapshots.Load()
+				switch {
+				case errors.Is(err, storage.ErrNoSnapshot):
+					log.Printf("[MAIN] No snapshot to restore at %s", cfg.Storage.Snapshot.File)
+				case err != nil:
+					log.Fatalf("Failed to restore snapshot %s: %v", cfg.Storage.Snapshot.File, err)
+				default:
+					log.Printf("[MAIN] Restored %d receipt(s) from %s (%d expired since)",
+						result.Restored, cfg.Storage.Snapshot.File, result.Expired)
+				}
+			}
+			if cfg.SnapshotEvery > 0 {
+				snapshots.StartSnapshotRoutine(cfg.SnapshotEvery)
+			}
+
+			// A last snapshot at shutdown keeps the receipts submitted since the scheduled one
+			go func() {
+				signals := make(chan os.Signal, 1)
+				signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+				<-signals
+				if info, err := snapshots.Save(); err != nil {
+					log.Printf("[MAIN] Shutdown snapshot failed: %v", err)
+				} else {
+					log.Printf("[MAIN] Wrote %d receipt(s) to %s before shutting down", info.Receipts, info.File)
+				}
+				os.Exit(0)
+			}()
+		}
+	}
+	store.StartCleanupRoutine(cfg.CleanupInterval)
 
 	// Initialize webhook client
 	webhookClient := webhook.NewClient(cfg.WebhookTimeout, cfg.Webhooks.MaxRetries, cfg.Server.Verbose)
+	if cfg.Webhooks.Secret != "" {
+		webhookClient.SetSigningSecret(cfg.Webhooks.Secret)
+	}
+	webhookClient.SetTargetPolicy(cfg.WebhookTargets)
+	webhookClient.SetConcurrency(webhook.QueueOptions{Workers: cfg.Webhooks.Workers, QueueSize: cfg.Webhooks.QueueSize})
+	if cfg.WebhookTargets.DenyPrivate {
+		log.Printf("[MAIN] Webhooks to private, loopback and link-local addresses refused (allowed: %v)", cfg.WebhookTargets.Allowed)
+	}
+	if cfg.Webhooks.VerifyReceivers {
+		webhookClient.EnableVerification(cfg.WebhookVerified)
+		log.Printf("[MAIN] Webhook receivers are challenged before use (trusted for %v)", cfg.WebhookVerified)
+	}
 
 	// Initialize handlers
-	handler := handlers.NewHandler(storage, webhookClient, cfg.Server.Verbose)
+	handler := handlers.NewHandler(store, webhookClient, cfg.Server.Verbose)
+	handler.SetMaxTTL(cfg.MaxReceiptTTL)
+	handler.SetReceiptFormats(cfg.Protocol.ReceiptFormats)
+	handler.SetEnvelopeLimits(cfg.Protocol.MinEncryptedBytes, cfg.Protocol.MaxEncryptedBytes, cfg.Protocol.ValidateEnvelope)
+	handler.SetRateLimits(cfg.RateLimit.SubmitPerMinute, cfg.RateLimit.CollectPerMinute)
+	handler.StartRateLimitSweep(time.Minute)
+	handler.SetSubmitNetworks(cfg.SubmitAllowList)
+	if len(cfg.SubmitAllowList.Allowed) > 0 {
+		log.Printf("[MAIN] Submissions accepted from %v only (trusted proxies: %v)", cfg.SubmitAllowList.Allowed, cfg.SubmitAllowList.TrustedProxies)
+	}
+	handler.SetBodyLimits(cfg.Server.MaxSubmitBytes, cfg.Server.MaxBatchBytes)
+	handler.SetHealthConfig(handlers.HealthConfig{
+		Backend:         cfg.Storage.Backend,
+		MaxReceiptAge:   cfg.MaxReceiptAge.String(),
+		GracePeriod:     cfg.GracePeriod.String(),
+		CleanupInterval: cfg.CleanupInterval.String(),
+		MaxReceipts:     cfg.Storage.MaxReceipts,
+		Deduplicate:     cfg.Storage.Deduplicate,
+	})
+	if snapshots != nil {
+		handler.SetSnapshots(snapshots)
+	}
+
+	// Collection challenges: redeemable by any instance when the store is shared
+	var challenges storage.ChallengeStore
+	if shared, ok := store.(storage.ChallengeStore); ok {
+		challenges = shared
+	} else {
+		memoryChallenges := storage.NewMemoryChallenges()
+		memoryChallenges.StartSweepRoutine(cfg.ChallengeTTL, cfg.Server.Verbose)
+		challenges = memoryChallenges
+	}
+	handler.SetPossession(challenges, cfg.ChallengeTTL, cfg.Collection.RequireProof)
+	handler.SetRetryAfter(cfg.RetryAfter)
+	if cfg.Collection.RequireProof {
+		log.Printf("[MAIN] Proof of possession required on /collect")
+		if cfg.Wallet.Enabled {
+			log.Printf("[MAIN] Warning: the wallet demo page can't sign challenges and will not be able to collect")
+		}
+	}
+
+	// Only listed cash registers may deposit receipts
+	if cfg.Registers.Required {
+		registry, err := registers.NewRegistry(cfg.Registers.Allowed, cfg.Registers.RevocationsFile, cfg.Server.Verbose)
+		if err != nil {
+			log.Fatalf("Failed to load cash register registry: %v", err)
+		}
+		handler.SetRegisters(registry)
+		log.Printf("[MAIN] Submission authentication enabled for %d register(s)", len(cfg.Registers.Allowed))
+	}
+
+	// Strict mode: only accept receipts the revenue authority has signed
+	if cfg.StrictMode.Enabled {
+		var authorityKey *ecdsa.PublicKey
+		if cfg.StrictMode.AuthorityKeyFile != "" {
+			authorityKey, err = attestation.LoadPublicKey(cfg.StrictMode.AuthorityKeyFile)
+		} else {
+			authorityKey, err = attestation.FetchPublicKey(cfg.StrictMode.AuthorityURL)
+		}
+		if err != nil {
+			log.Fatalf("Failed to load revenue authority key for strict mode: %v", err)
+		}
+		handler.SetAttestation(attestation.NewVerifier(authorityKey))
+		log.Printf("[MAIN] Strict mode enabled - submissions need a revenue authority signature")
+	}
+
+	// Anonymized lifecycle events for dashboards and capacity planning
+	if cfg.Analytics.Enabled {
+		var sink analytics.Sink
+		switch cfg.Analytics.Sink {
+		case config.SinkWebhook:
+			sink = analytics.NewWebhookSink(cfg.Analytics.WebhookURL, cfg.Analytics.WebhookSecret, cfg.SinkTimeout)
+		case config.SinkKafka:
+			sink = analytics.NewKafkaSink(cfg.Analytics.Kafka.RestProxyURL, cfg.Analytics.Kafka.Topic, cfg.SinkTimeout)
+		default:
+			fileSink, err := analytics.NewFileSink(cfg.Analytics.File)
+			if err != nil {
+				log.Fatalf("Failed to open analytics sink: %v", err)
+			}
+			sink = fileSink
+		}
+		events := analytics.NewEmitter(sink, analytics.Options{
+			Instance:      cfg.Analytics.Instance,
+			BufferSize:    cfg.Analytics.BufferSize,
+			BatchSize:     cfg.Analytics.BatchSize,
+			FlushInterval: cfg.AnalyticsFlush,
+		}, cfg.Server.Verbose)
+		defer events.Close()
+		handler.SetAnalytics(events)
+		if watcher, ok := store.(interface {
+			WatchExpiries(func(*models.Receipt, time.Time))
+		}); ok {
+			watcher.WatchExpiries(events.Expired)
+		}
+		log.Printf("[MAIN] Analytics events go to the %s sink", cfg.Analytics.Sink)
+	}
 
 	// Initialize and start server
 	srv := server.NewServer(handler, cfg.Server.Verbose)
+	if cfg.Server.TLS.CertFile != "" {
+		srv.EnableTLS(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+	}
+	if cfg.AccessLog.Enabled {
+		accessLog, err := accesslog.NewLogger(accesslog.Options{
+			File:       cfg.AccessLog.File,
+			MaxSize:    int64(cfg.AccessLog.MaxSizeMB) << 20,
+			MaxBackups: cfg.AccessLog.MaxBackups,
+			MaxAge:     cfg.AccessLogMaxAge,
+			RedactKeys: cfg.AccessLog.RedactKeys,
+			KeyPrefix:  cfg.AccessLog.KeyPrefixLength,
+		}, cfg.Server.Verbose)
+		if err != nil {
+			log.Fatalf("Failed to open access log: %v", err)
+		}
+		defer accessLog.Close()
+		srv.EnableAccessLog(accessLog)
+		log.Printf("[MAIN] Access log: %s", cfg.AccessLog.File)
+	}
+	if cfg.Admin.Enabled {
+		srv.EnableAdmin(cfg.Admin.Token)
+		handler.SetAdminToken(cfg.Admin.Token)
+	}
+	if cfg.CORS.Enabled {
+		srv.EnableCORS(server.CORSPolicy{
+			AllowedOrigins: cfg.CORS.AllowedOrigins,
+			AllowedMethods: cfg.CORS.AllowedMethods,
+			AllowedHeaders: cfg.CORS.AllowedHeaders,
+			MaxAge:         cfg.CORSMaxAge,
+		})
+	}
+	if cfg.WebSocket.Enabled {
+		handler.EnableSockets(cfg.SocketChallenge, cfg.SocketWait)
+		srv.EnableSockets()
+		// Receipts submitted through other instances wake this instance's sockets too
+		if watcher, ok := store.(interface{ WatchSubmissions(func(string)) }); ok {
+			watcher.WatchSubmissions(handler.NotifySubmitted)
+		}
+	}
+	if cfg.Wallet.Enabled {
+		srv.EnableWallet(wallet.NewHandler(cfg.Wallet.StaticDir, cfg.Wallet.AuthorityURL, cfg.WalletPoll, cfg.Server.Verbose))
+	}
+
+	listener, err := server.Listen(cfg.Listen)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", cfg.Listen, err)
+	}
+	// The port actually bound: systemd's socket or a host:port listen address may differ from server.port
+	port := 0
+	if tcpAddr, ok := listener.Addr().(*net.TCPAddr); ok {
+		port = tcpAddr.Port
+	}
 
 	// Get LAN IP address
 	lanIP := getLANIPAddress()
-	log.Printf("[MAIN] Receipt Bank ready - listening on port %d", cfg.Server.Port)
-	log.Printf("[MAIN] Service accessible at:")
-	log.Printf("[MAIN]   Local:  http://localhost:%d", cfg.Server.Port)
-	if lanIP != "" {
-		log.Printf("[MAIN]   LAN:    http://%s:%d", lanIP, cfg.Server.Port)
+	log.Printf("[MAIN] Receipt Bank ready - listening on %s", listener.Addr())
+	if port != 0 {
+		log.Printf("[MAIN] Service accessible at:")
+		if host, _, _ := net.SplitHostPort(cfg.Listen.Address); host != "" {
+			log.Printf("[MAIN]   http://%s", net.JoinHostPort(host, strconv.Itoa(port)))
+		} else {
+			log.Printf("[MAIN]   Local:  http://localhost:%d", port)
+			if lanIP != "" {
+				log.Printf("[MAIN]   LAN:    http://%s:%d", lanIP, port)
+			}
+		}
 	}
 	log.Printf("[MAIN] API endpoints:")
 	log.Printf("[MAIN]   POST /submit")
+	log.Printf("[MAIN]   POST /submit/batch")
 	log.Printf("[MAIN]   GET  /collect/{ephemeral_key}")
-	log.Printf("[MAIN]   GET  /health")
+	log.Printf("[MAIN]   HEAD /collect/{ephemeral_key} (existence check)")
+	log.Printf("[MAIN]   POST /collect/{ephemeral_key}/challenge")
+	log.Printf("[MAIN]   GET  /health (config and ?deep=true checks with the admin token)")
+	if cfg.WebSocket.Enabled {
+		log.Printf("[MAIN]   GET  /ws/collect/{ephemeral_key} (WebSocket, proof of possession)")
+	}
+	log.Printf("[MAIN]   GET  /version (receipt formats %v)", cfg.Protocol.ReceiptFormats)
+	if cfg.Admin.Enabled {
+		log.Printf("[MAIN]   POST /v1/admin/cleanup (admin)")
+		log.Printf("[MAIN]   GET  /v1/admin/cleanup/stats (admin)")
+		log.Printf("[MAIN]   GET  /v1/admin/stats (admin)")
+		log.Printf("[MAIN]   GET  /v1/admin/stats/history (admin)")
+		log.Printf("[MAIN]   GET  /v1/admin/receipts (admin)")
+		log.Printf("[MAIN]   DELETE /v1/admin/receipts/{receipt_id} (admin)")
+		log.Printf("[MAIN]   GET  /v1/admin/webhooks/failures (admin)")
+		log.Printf("[MAIN]   GET  /v1/admin/registers (admin)")
+		log.Printf("[MAIN]   POST /v1/admin/registers/{id}/revoke|reinstate (admin)")
+		log.Printf("[MAIN]   POST /v1/admin/compact (admin)")
+		if snapshots != nil {
+			log.Printf("[MAIN]   GET|POST /v1/admin/snapshot (admin)")
+			log.Printf("[MAIN]   POST /v1/admin/snapshot/restore (admin)")
+		}
+	}
+	if cfg.Wallet.Enabled {
+		log.Printf("[MAIN]   GET  /wallet/ (demo collector page)")
+	}
+
+	// Advertise on the LAN so cash registers can find us without static config
+	if cfg.Discovery.MDNS && port == 0 {
+		log.Printf("[MAIN] mDNS advertisement disabled: %s has no TCP port", cfg.Listen)
+	} else if cfg.Discovery.MDNS {
+		var ips []net.IP
+		if lanIP != "" {
+			ips = append(ips, net.ParseIP(lanIP))
+		}
+		advertiser, err := discovery.NewAdvertiser(cfg.Discovery.Instance, port, ips, cfg.Server.Verbose)
+		if err != nil {
+			log.Printf("[MAIN] mDNS advertisement disabled: %v", err)
+		} else {
+			defer advertiser.Shutdown()
+			log.Printf("[MAIN] Advertising via mDNS as %s (%s)", cfg.Discovery.Instance, discovery.ServiceName)
+		}
+	}
 
-	if err := srv.Start(cfg.Server.Port); err != nil {
+	if err := srv.Start(listener); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
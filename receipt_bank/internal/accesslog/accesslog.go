@@ -0,0 +1,262 @@
+package accesslog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Entry is one request, as written to the access log
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Route     string    `json:"route,omitempty"` // Path template of the matched endpoint
+	Status    int       `json:"status"`
+	LatencyMS float64   `json:"latency_ms"`
+	ClientIP  string    `json:"client_ip"`
+	ReceiptID string    `json:"receipt_id,omitempty"`
+	BytesIn   int64     `json:"bytes_in"`
+	BytesOut  int64     `json:"bytes_out"`
+
+	mu sync.Mutex
+}
+
+// Options configures the access log file
+type Options struct {
+	File       string        // JSON lines; "" disables the file
+	MaxSize    int64         // Rotate past this many bytes (0 = daily rotation only)
+	MaxBackups int           // Rotated files kept (0 = no count limit)
+	MaxAge     time.Duration // Rotated files older than this are removed (0 = kept)
+	RedactKeys bool          // Log only a prefix of ephemeral keys in paths
+	KeyPrefix  int           // Characters of an ephemeral key kept when redacting
+}
+
+// Logger writes an access log entry for every request, to a rotating file and, when
+// verbose, to the console
+type Logger struct {
+	out     *rotatingFile
+	opts    Options
+	verbose bool
+}
+
+// NewLogger opens the access log file described by opts
+func NewLogger(opts Options, verbose bool) (*Logger, error) {
+	l := &Logger{opts: opts, verbose: verbose}
+	if opts.File != "" {
+		out, err := openRotatingFile(opts.File, opts.MaxSize, opts.MaxBackups, opts.MaxAge, verbose)
+		if err != nil {
+			return nil, err
+		}
+		l.out = out
+	}
+	return l, nil
+}
+
+// Console returns a logger that only prints requests to the console when verbose
+func Console(verbose bool) *Logger {
+	return &Logger{verbose: verbose}
+}
+
+// Close closes the access log file
+func (l *Logger) Close() error {
+	if l.out == nil {
+		return nil
+	}
+	return l.out.Close()
+}
+
+type entryKey struct{}
+
+// Middleware times the request and logs it once the response is written. It wraps
+// the whole server so requests no route matched are logged too.
+func (l *Logger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &Entry{
+			Time:     start.UTC(),
+			Method:   r.Method,
+			Path:     r.URL.EscapedPath(),
+			ClientIP: clientIP(r),
+		}
+		// Redact from the raw path, not the route: 404s and 405s match no route but
+		// carry keys all the same
+		if l.opts.RedactKeys {
+			entry.Path = redactPath(entry.Path, l.opts.KeyPrefix)
+		}
+
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = body
+		}
+		recorder := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), entryKey{}, entry)))
+
+		entry.mu.Lock()
+		entry.Status = recorder.status()
+		entry.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+		entry.BytesIn = body.n
+		entry.BytesOut = recorder.written
+		entry.mu.Unlock()
+
+		l.write(entry)
+	})
+}
+
+// Annotate records the matched route. It is router middleware, so it only runs once
+// a route matched.
+func Annotate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if entry, ok := r.Context().Value(entryKey{}).(*Entry); ok {
+			entry.mu.Lock()
+			if route := mux.CurrentRoute(r); route != nil {
+				entry.Route, _ = route.GetPathTemplate()
+			}
+			entry.mu.Unlock()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SetReceiptID adds the receipt a request submitted or collected to its log entry
+func SetReceiptID(r *http.Request, receiptID string) {
+	if entry, ok := r.Context().Value(entryKey{}).(*Entry); ok {
+		entry.mu.Lock()
+		entry.ReceiptID = receiptID
+		entry.mu.Unlock()
+	}
+}
+
+func (l *Logger) write(entry *Entry) {
+	if l.verbose {
+		receipt := ""
+		if entry.ReceiptID != "" {
+			receipt = " receipt=" + entry.ReceiptID
+		}
+		log.Printf("[HTTP] %s %s %d - %.1fms%s", entry.Method, entry.Path, entry.Status, entry.LatencyMS, receipt)
+	}
+	if l.out == nil {
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("[ACCESS] Failed to encode access log entry: %v", err)
+		return
+	}
+	if _, err := l.out.Write(append(data, '\n')); err != nil {
+		log.Printf("[ACCESS] Failed to write access log: %v", err)
+	}
+}
+
+// redactPath redacts the ephemeral key in the segment after every "collect" segment,
+// which covers /collect/{ephemeral_key}, its sub-resources, the /ws push route and
+// the /v1 aliases
+func redactPath(path string, n int) string {
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		if segments[i-1] == "collect" && segments[i] != "" {
+			segments[i] = redact(segments[i], n)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// redact keeps the first n characters of an ephemeral key
+func redact(key string, n int) string {
+	if n <= 0 {
+		return "[redacted]"
+	}
+	if n >= len(key) {
+		return key
+	}
+	return key[:n] + "..."
+}
+
+// clientIP is the address the request came from
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// countingReader counts the request body bytes read by the handler
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// responseRecorder captures the status and body size, and passes through flushing
+// (streamed /collect) and hijacking (WebSocket collection)
+type responseRecorder struct {
+	http.ResponseWriter
+	code     int
+	written  int64
+	hijacked bool
+}
+
+func (w *responseRecorder) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *responseRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseRecorder) status() int {
+	switch {
+	case w.hijacked:
+		return http.StatusSwitchingProtocols
+	case w.code == 0:
+		return http.StatusOK
+	}
+	return w.code
+}
@@ -0,0 +1,107 @@
+package accesslog
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// testKey is a base64 ephemeral key with a '/' in it, as it appears in an escaped path
+const testKey = "AqF3x9Zk%2FbQ7mW2pLr8sT1vYc4nE6hJ0uGdKoXiRaBfS"
+
+func TestRedactKeysOnEveryPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	logger, err := NewLogger(Options{File: path, RedactKeys: true, KeyPrefix: 8}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter().UseEncodedPath()
+	router.HandleFunc("/v1/collect/{ephemeral_key}", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	router.Use(Annotate)
+	handler := logger.Middleware(router)
+
+	for _, tt := range []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/v1/collect/" + testKey, http.StatusOK},
+		{"POST", "/v1/collect/" + testKey, http.StatusMethodNotAllowed},
+		{"GET", "/v1/collect/" + testKey + "/unknown", http.StatusNotFound},
+		{"GET", "/ws/collect/" + testKey, http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.status {
+			t.Fatalf("%s %s: got %d, want %d", tt.method, tt.path, w.Code, tt.status)
+		}
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	type logged struct {
+		Path  string `json:"path"`
+		Route string `json:"route"`
+	}
+	var entries []logged
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), "bQ7mW2pLr8") {
+			t.Errorf("Access log leaks the ephemeral key: %s", scanner.Text())
+		}
+		var entry logged
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("Got %d entries, want 4", len(entries))
+	}
+
+	for i, want := range []string{
+		"/v1/collect/AqF3x9Zk...",
+		"/v1/collect/AqF3x9Zk...",
+		"/v1/collect/AqF3x9Zk.../unknown",
+		"/ws/collect/AqF3x9Zk...",
+	} {
+		if entries[i].Path != want {
+			t.Errorf("Entry %d: path %q, want %q", i, entries[i].Path, want)
+		}
+	}
+	if entries[0].Route != "/v1/collect/{ephemeral_key}" || entries[1].Route != "" {
+		t.Errorf("Routes %q and %q; want only the matched request to have one", entries[0].Route, entries[1].Route)
+	}
+}
+
+func TestRedactPath(t *testing.T) {
+	for _, tt := range []struct {
+		path string
+		n    int
+		want string
+	}{
+		{"/collect/abcdefghij/meta", 4, "/collect/abcd.../meta"},
+		{"/collect/abcdefghij", 0, "/collect/[redacted]"},
+		{"/collect/abc", 8, "/collect/abc"},
+		{"/collect/", 8, "/collect/"},
+		{"/v1/submit", 8, "/v1/submit"},
+	} {
+		if got := redactPath(tt.path, tt.n); got != tt.want {
+			t.Errorf("redactPath(%q, %d) = %q, want %q", tt.path, tt.n, got, tt.want)
+		}
+	}
+}
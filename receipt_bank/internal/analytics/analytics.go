@@ -0,0 +1,240 @@
+package analytics
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"receipt-bank/internal/models"
+)
+
+// Event types
+const (
+	EventSubmitted = "receipt_submitted"
+	EventCollected = "receipt_collected"
+	EventExpired   = "receipt_expired"
+)
+
+// Collection channels
+const (
+	ChannelHTTP      = "http"
+	ChannelWebSocket = "websocket"
+)
+
+// Event is one anonymized observation of a receipt's life. It deliberately carries no
+// receipt ID, register, ephemeral key, webhook URL or payload: only sizes and timings,
+// which is enough to watch the system's health without linking a receipt to anyone.
+type Event struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"` // Whole seconds
+	Instance  string    `json:"instance,omitempty"`
+	SizeBytes int       `json:"size_bytes,omitempty"` // Base64 payload length
+
+	// receipt_submitted
+	TTLSeconds    int64 `json:"ttl_seconds,omitempty"`    // Requested ttl, 0 = the bank's default
+	ReceiptFormat int   `json:"receipt_format,omitempty"` // Declared binary receipt version
+
+	// receipt_collected
+	Channel    string `json:"channel,omitempty"`    // http or websocket
+	Collection int    `json:"collection,omitempty"` // 1 for the first collection, more for re-fetches
+
+	// receipt_collected and receipt_expired
+	AgeSeconds float64 `json:"age_seconds,omitempty"` // Since submission
+}
+
+// Sink receives batches of events. Writes happen on one goroutine, in order.
+type Sink interface {
+	Write(events []Event) error
+	Close() error
+}
+
+// Options configures an Emitter
+type Options struct {
+	Instance      string        // Names this bank in events, for pipelines fed by several instances
+	BufferSize    int           // Events queued for the sink; more are dropped (0 = 1000)
+	BatchSize     int           // Events per sink write (0 = 100)
+	FlushInterval time.Duration // Longest an event waits for its batch to fill (0 = 5s)
+}
+
+// Stats counts events since startup
+type Stats struct {
+	Emitted int64 `json:"emitted"` // Written to the sink
+	Dropped int64 `json:"dropped"` // Queue full
+	Failed  int64 `json:"failed"`  // Lost to sink errors
+}
+
+// Emitter queues events and writes them to its sink in batches on a background
+// goroutine. Analytics are best effort: a slow or failing sink never holds up a
+// submission or collection, its events are dropped and counted instead.
+// A nil *Emitter emits nothing.
+type Emitter struct {
+	sink    Sink
+	opts    Options
+	verbose bool
+
+	mu     sync.RWMutex // Guards closed against emits racing Close
+	closed bool
+	queue  chan Event
+	done   chan struct{}
+
+	emitted atomic.Int64
+	dropped atomic.Int64
+	failed  atomic.Int64
+}
+
+// NewEmitter starts writing events to sink
+func NewEmitter(sink Sink, opts Options, verbose bool) *Emitter {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 1000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+
+	e := &Emitter{
+		sink:    sink,
+		opts:    opts,
+		verbose: verbose,
+		queue:   make(chan Event, opts.BufferSize),
+		done:    make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Submitted records a stored submission
+func (e *Emitter) Submitted(receipt *models.Receipt, receiptFormat int) {
+	if e == nil {
+		return
+	}
+	e.emit(Event{
+		Type:          EventSubmitted,
+		SizeBytes:     len(receipt.EncryptedData),
+		TTLSeconds:    int64(receipt.TTL / time.Second),
+		ReceiptFormat: receiptFormat,
+	})
+}
+
+// Collected records a collection over channel
+func (e *Emitter) Collected(receipt *models.Receipt, channel string) {
+	if e == nil {
+		return
+	}
+	e.emit(Event{
+		Type:       EventCollected,
+		SizeBytes:  len(receipt.EncryptedData),
+		Channel:    channel,
+		Collection: receipt.CollectionCount,
+		AgeSeconds: age(receipt.Timestamp, time.Now()),
+	})
+}
+
+// Expired records a receipt whose ttl elapsed uncollected. Stores that no longer have
+// the receipt when they notice (Redis) pass one with only what they know, leaving the
+// size or age out of the event.
+func (e *Emitter) Expired(receipt *models.Receipt, expiredAt time.Time) {
+	if e == nil {
+		return
+	}
+	e.emit(Event{
+		Type:       EventExpired,
+		SizeBytes:  len(receipt.EncryptedData),
+		AgeSeconds: age(receipt.Timestamp, expiredAt),
+	})
+}
+
+// Stats returns the event counters
+func (e *Emitter) Stats() Stats {
+	if e == nil {
+		return Stats{}
+	}
+	return Stats{
+		Emitted: e.emitted.Load(),
+		Dropped: e.dropped.Load(),
+		Failed:  e.failed.Load(),
+	}
+}
+
+// Close writes the queued events and closes the sink
+func (e *Emitter) Close() error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.mu.Unlock()
+
+	<-e.done
+	return e.sink.Close()
+}
+
+func (e *Emitter) emit(event Event) {
+	event.Time = time.Now().UTC().Truncate(time.Second)
+	event.Instance = e.opts.Instance
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.queue <- event:
+	default:
+		if e.dropped.Add(1) == 1 || e.verbose {
+			log.Printf("[ANALYTICS] Event queue full, dropping events")
+		}
+	}
+}
+
+func (e *Emitter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, e.opts.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.sink.Write(batch); err != nil {
+			e.failed.Add(int64(len(batch)))
+			log.Printf("[ANALYTICS] Failed to write %d events: %v", len(batch), err)
+		} else {
+			e.emitted.Add(int64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case event, ok := <-e.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= e.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// age is the time from submission to at, in seconds with millisecond precision
+// (0 when the submission time is unknown)
+func age(submittedAt, at time.Time) float64 {
+	if submittedAt.IsZero() || at.Before(submittedAt) {
+		return 0
+	}
+	return float64(at.Sub(submittedAt).Milliseconds()) / 1000
+}
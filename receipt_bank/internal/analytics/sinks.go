@@ -0,0 +1,150 @@
+package analytics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"receipt-bank/internal/webhook"
+)
+
+// FileSink appends events to a file as JSON lines, for a log shipper to pick up
+type FileSink struct {
+	file *os.File
+}
+
+// NewFileSink opens path for appending, creating it if needed
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open analytics file: %v", err)
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Write appends one line per event
+func (s *FileSink) Write(events []Event) error {
+	out := bufio.NewWriter(s.file)
+	encoder := json.NewEncoder(out)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// Close closes the file
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// WebhookSink POSTs each batch as {"events": [...]} to a collector URL, signed like
+// collection webhooks (X-Webhook-Signature and X-Webhook-Timestamp) when a secret is set
+type WebhookSink struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// NewWebhookSink posts batches to collectorURL
+func NewWebhookSink(collectorURL, secret string, timeout time.Duration) *WebhookSink {
+	return &WebhookSink{
+		url:    collectorURL,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Write posts the batch; any non-2xx answer fails it
+func (s *WebhookSink) Write(events []Event) error {
+	body, err := json.Marshal(struct {
+		Events []Event `json:"events"`
+	}{events})
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{"Content-Type": "application/json"}
+	if len(s.secret) > 0 {
+		headers[webhook.TimestampHeader], headers[webhook.SignatureHeader] = webhook.Sign(s.secret, body, time.Now())
+	}
+	return post(s.client, s.url, body, headers)
+}
+
+// Close does nothing; the sink holds no connection of its own
+func (s *WebhookSink) Close() error {
+	return nil
+}
+
+// KafkaSink produces events to a Kafka topic through a Kafka REST Proxy (Confluent
+// REST Proxy API v2), one record per event, so the bank needs no Kafka client or
+// broker access of its own
+type KafkaSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewKafkaSink produces to topic through the REST proxy at proxyURL
+func NewKafkaSink(proxyURL, topic string, timeout time.Duration) *KafkaSink {
+	return &KafkaSink{
+		url:    strings.TrimRight(proxyURL, "/") + "/topics/" + url.PathEscape(topic),
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Write produces the batch in one request
+func (s *KafkaSink) Write(events []Event) error {
+	type record struct {
+		Value Event `json:"value"`
+	}
+	records := make([]record, len(events))
+	for i, event := range events {
+		records[i] = record{Value: event}
+	}
+	body, err := json.Marshal(struct {
+		Records []record `json:"records"`
+	}{records})
+	if err != nil {
+		return err
+	}
+
+	return post(s.client, s.url, body, map[string]string{
+		"Content-Type": "application/vnd.kafka.json.v2+json",
+		"Accept":       "application/vnd.kafka.v2+json",
+	})
+}
+
+// Close does nothing; the sink holds no connection of its own
+func (s *KafkaSink) Close() error {
+	return nil
+}
+
+func post(client *http.Client, target string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", target, resp.Status)
+	}
+	return nil
+}
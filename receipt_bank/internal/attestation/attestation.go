@@ -0,0 +1,120 @@
+package attestation
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	hashSize      = 32 // SHA-256 of the binary receipt
+	signatureSize = 64 // r || s, as issued by the revenue authority
+
+	fetchTimeout = 10 * time.Second
+)
+
+// Verification errors
+var (
+	ErrMissing   = errors.New("receipt_hash and authority_signature are required in strict mode")
+	ErrMalformed = errors.New("malformed receipt attestation")
+	ErrInvalid   = errors.New("authority signature does not verify")
+)
+
+// Verifier checks that a submission carries a revenue authority signature over its
+// receipt hash. The bank never sees the receipt itself, so the hash is not matched
+// against the encrypted payload; it only proves the register obtained a real signature.
+// Nothing binds the pair to one submission either: a (hash, signature) pair seen once
+// verifies again alongside any other payload, so strict mode does not prevent replay.
+type Verifier struct {
+	publicKey *ecdsa.PublicKey
+}
+
+// NewVerifier creates a verifier for the authority's public key
+func NewVerifier(publicKey *ecdsa.PublicKey) *Verifier {
+	return &Verifier{publicKey: publicKey}
+}
+
+// Verify checks a base64 receipt hash and base64 authority signature. It does not
+// check whether the pair was already used.
+func (v *Verifier) Verify(hashBase64, signatureBase64 string) error {
+	if hashBase64 == "" || signatureBase64 == "" {
+		return ErrMissing
+	}
+
+	hash, err := base64.StdEncoding.DecodeString(hashBase64)
+	if err != nil || len(hash) != hashSize {
+		return fmt.Errorf("%w: receipt_hash must be %d bytes of base64", ErrMalformed, hashSize)
+	}
+	signature, err := base64.StdEncoding.DecodeString(signatureBase64)
+	if err != nil || len(signature) != signatureSize {
+		return fmt.Errorf("%w: authority_signature must be %d bytes of base64", ErrMalformed, signatureSize)
+	}
+
+	r := new(big.Int).SetBytes(signature[:signatureSize/2])
+	s := new(big.Int).SetBytes(signature[signatureSize/2:])
+	if !ecdsa.Verify(v.publicKey, hash, r, s) {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// LoadPublicKey reads the authority's public key from a PEM file
+func LoadPublicKey(path string) (*ecdsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authority public key: %v", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block in %s", path)
+	}
+	return parsePublicKey(block.Bytes)
+}
+
+// FetchPublicKey gets the authority's public key from its /public-key endpoint
+func FetchPublicKey(authorityURL string) (*ecdsa.PublicKey, error) {
+	client := &http.Client{Timeout: fetchTimeout}
+	resp, err := client.Get(authorityURL + "/public-key")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch authority public key: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("revenue authority returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		PublicKey string `json:"public_key"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode authority public key response: %v", err)
+	}
+
+	der, err := base64.StdEncoding.DecodeString(body.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("authority public key is not valid base64: %v", err)
+	}
+	return parsePublicKey(der)
+}
+
+func parsePublicKey(der []byte) (*ecdsa.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse authority public key: %v", err)
+	}
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("authority public key is not ECDSA")
+	}
+	return publicKey, nil
+}
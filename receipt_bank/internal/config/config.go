@@ -3,27 +3,172 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"receipt-bank/internal/handlers"
+	"receipt-bank/internal/registers"
+	"receipt-bank/internal/server"
+	"receipt-bank/internal/storage"
+	"receipt-bank/internal/webhook"
 )
 
 // Config represents the application configuration
 type Config struct {
 	Server struct {
-		Port    int  `yaml:"port"`
-		Verbose bool `yaml:"verbose"`
+		Port           int    `yaml:"port"`
+		Listen         string `yaml:"listen"` // "" (all interfaces), host, IP, host:port, unix:<path> or systemd
+		SocketMode     string `yaml:"socket_mode"`
+		Verbose        bool   `yaml:"verbose"`
+		MaxSubmitBytes int64  `yaml:"max_submit_bytes"`
+		MaxBatchBytes  int64  `yaml:"max_batch_bytes"`
+		TLS            struct {
+			CertFile string `yaml:"cert_file"`
+			KeyFile  string `yaml:"key_file"`
+		} `yaml:"tls"`
 	} `yaml:"server"`
 
+	AccessLog struct {
+		Enabled         bool   `yaml:"enabled"`
+		File            string `yaml:"file"`
+		MaxSizeMB       int    `yaml:"max_size_mb"`
+		MaxBackups      int    `yaml:"max_backups"`
+		MaxAge          string `yaml:"max_age"`
+		RedactKeys      bool   `yaml:"redact_keys"`
+		KeyPrefixLength int    `yaml:"key_prefix_length"`
+	} `yaml:"access_log"`
+
 	Storage struct {
-		CleanupInterval string `yaml:"cleanup_interval"`
-		MaxReceiptAge   string `yaml:"max_receipt_age"`
+		CleanupInterval       string   `yaml:"cleanup_interval"`
+		MaxReceiptAge         string   `yaml:"max_receipt_age"`
+		MaxReceiptTTL         string   `yaml:"max_receipt_ttl"`
+		CollectionGracePeriod string   `yaml:"collection_grace_period"`
+		CleanupStrategies     []string `yaml:"cleanup_strategies"`
+		MaxReceipts           int      `yaml:"max_receipts"`
+		Deduplicate           bool     `yaml:"deduplicate"`
+		UsageRetention        string   `yaml:"usage_retention"`
+		Backend               string   `yaml:"backend"`
+		Redis                 struct {
+			Address      string `yaml:"address"`
+			Username     string `yaml:"username"`
+			Password     string `yaml:"password"`
+			DB           int    `yaml:"db"`
+			KeyPrefix    string `yaml:"key_prefix"`
+			PoolSize     int    `yaml:"pool_size"`
+			MinIdleConns int    `yaml:"min_idle_conns"`
+			MaxRetries   int    `yaml:"max_retries"`
+			DialTimeout  string `yaml:"dial_timeout"`
+			ReadTimeout  string `yaml:"read_timeout"`
+			WriteTimeout string `yaml:"write_timeout"`
+		} `yaml:"redis"`
+		Snapshot struct {
+			Enabled        bool   `yaml:"enabled"`
+			File           string `yaml:"file"`
+			Passphrase     string `yaml:"passphrase"`
+			Interval       string `yaml:"interval"`
+			RestoreOnStart bool   `yaml:"restore_on_start"`
+		} `yaml:"snapshot"`
 	} `yaml:"storage"`
 
 	Webhooks struct {
 		Timeout    string `yaml:"timeout"`
 		MaxRetries int    `yaml:"max_retries"`
+		Secret     string `yaml:"secret"`
+		// Challenge each webhook_url before trusting it with confirmations
+		VerifyReceivers bool   `yaml:"verify_receivers"`
+		VerifiedTTL     string `yaml:"verified_ttl"`
+		// Refuse private, loopback and link-local targets outside AllowedTargets
+		DenyPrivateTargets bool     `yaml:"deny_private_targets"`
+		AllowedTargets     []string `yaml:"allowed_targets"`
+		// Delivery queue; notifications to one register go out one at a time
+		Workers   int `yaml:"workers"`
+		QueueSize int `yaml:"queue_size"`
 	} `yaml:"webhooks"`
+
+	Wallet struct {
+		Enabled      bool   `yaml:"enabled"`
+		StaticDir    string `yaml:"static_dir"`
+		AuthorityURL string `yaml:"authority_url"`
+		PollInterval string `yaml:"poll_interval"`
+	} `yaml:"wallet"`
+
+	RateLimit struct {
+		SubmitPerMinute  int `yaml:"submit_per_minute"`
+		CollectPerMinute int `yaml:"collect_per_minute"`
+	} `yaml:"rate_limit"`
+
+	SubmitNetworks struct {
+		Allowed        []string `yaml:"allowed"`
+		TrustedProxies []string `yaml:"trusted_proxies"`
+	} `yaml:"submit_networks"`
+
+	Collection struct {
+		RequireProof bool   `yaml:"require_proof"`
+		ChallengeTTL string `yaml:"challenge_ttl"`
+		RetryAfter   string `yaml:"retry_after"`
+	} `yaml:"collection"`
+
+	WebSocket struct {
+		Enabled          bool   `yaml:"enabled"`
+		ChallengeTimeout string `yaml:"challenge_timeout"`
+		WaitTimeout      string `yaml:"wait_timeout"`
+	} `yaml:"websocket"`
+
+	Admin struct {
+		Enabled bool   `yaml:"enabled"`
+		Token   string `yaml:"token"`
+	} `yaml:"admin"`
+
+	Discovery struct {
+		MDNS     bool   `yaml:"mdns"`
+		Instance string `yaml:"instance"`
+	} `yaml:"discovery"`
+
+	CORS struct {
+		Enabled        bool     `yaml:"enabled"`
+		AllowedOrigins []string `yaml:"allowed_origins"`
+		AllowedMethods []string `yaml:"allowed_methods"`
+		AllowedHeaders []string `yaml:"allowed_headers"`
+		MaxAge         string   `yaml:"max_age"`
+	} `yaml:"cors"`
+
+	StrictMode struct {
+		Enabled          bool   `yaml:"enabled"`
+		AuthorityKeyFile string `yaml:"authority_key_file"`
+		AuthorityURL     string `yaml:"authority_url"`
+	} `yaml:"strict_mode"`
+
+	Protocol struct {
+		ReceiptFormats    []int `yaml:"receipt_formats"`
+		MinEncryptedBytes int   `yaml:"min_encrypted_bytes"`
+		MaxEncryptedBytes int   `yaml:"max_encrypted_bytes"`
+		ValidateEnvelope  bool  `yaml:"validate_envelope"`
+	} `yaml:"protocol"`
+
+	Registers struct {
+		Required        bool              `yaml:"required"`
+		RevocationsFile string            `yaml:"revocations_file"`
+		Allowed         []registers.Entry `yaml:"allowed"`
+	} `yaml:"registers"`
+
+	Analytics struct {
+		Enabled       bool   `yaml:"enabled"`
+		Sink          string `yaml:"sink"`
+		File          string `yaml:"file"`
+		WebhookURL    string `yaml:"webhook_url"`
+		WebhookSecret string `yaml:"webhook_secret"`
+		Kafka         struct {
+			RestProxyURL string `yaml:"rest_proxy_url"`
+			Topic        string `yaml:"topic"`
+		} `yaml:"kafka"`
+		Instance      string `yaml:"instance"`
+		Timeout       string `yaml:"timeout"`
+		BufferSize    int    `yaml:"buffer_size"`
+		BatchSize     int    `yaml:"batch_size"`
+		FlushInterval string `yaml:"flush_interval"`
+	} `yaml:"analytics"`
 }
 
 // ParsedConfig contains parsed time.Duration values for easier use
@@ -31,9 +176,41 @@ type ParsedConfig struct {
 	Config
 	CleanupInterval time.Duration
 	MaxReceiptAge   time.Duration
+	MaxReceiptTTL   time.Duration
+	GracePeriod     time.Duration
 	WebhookTimeout  time.Duration
+	WebhookVerified time.Duration
+	WalletPoll      time.Duration
+	CORSMaxAge      time.Duration
+	ChallengeTTL    time.Duration
+	RetryAfter      time.Duration
+	SocketChallenge time.Duration
+	SocketWait      time.Duration
+	AccessLogMaxAge time.Duration
+	UsageRetention  time.Duration
+	AnalyticsFlush  time.Duration
+	SinkTimeout     time.Duration
+	SnapshotEvery   time.Duration
+	CleanupPolicy   storage.CleanupPolicy
+	Redis           storage.RedisOptions
+	WebhookTargets  webhook.TargetPolicy
+	SubmitAllowList handlers.NetworkPolicy
+	Listen          server.ListenAddress
 }
 
+// Storage backends
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// Analytics sinks
+const (
+	SinkFile    = "file"
+	SinkWebhook = "webhook"
+	SinkKafka   = "kafka"
+)
+
 // LoadConfig loads configuration from a YAML file
 func LoadConfig(filepath string) (*ParsedConfig, error) {
 	data, err := os.ReadFile(filepath)
@@ -57,11 +234,231 @@ func LoadConfig(filepath string) (*ParsedConfig, error) {
 		return nil, fmt.Errorf("invalid max_receipt_age: %v", err)
 	}
 
+	// Upper bound for per-receipt ttl overrides; by default they can only shorten max_receipt_age
+	maxReceiptTTL := maxReceiptAge
+	if cfg.Storage.MaxReceiptTTL != "" {
+		maxReceiptTTL, err = time.ParseDuration(cfg.Storage.MaxReceiptTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_receipt_ttl: %v", err)
+		}
+		if maxReceiptTTL < time.Second {
+			return nil, fmt.Errorf("invalid max_receipt_ttl: must be at least 1s")
+		}
+	}
+
+	// Grace period is optional; zero keeps one-time collection
+	var gracePeriod time.Duration
+	if cfg.Storage.CollectionGracePeriod != "" {
+		gracePeriod, err = time.ParseDuration(cfg.Storage.CollectionGracePeriod)
+		if err != nil {
+			return nil, fmt.Errorf("invalid collection_grace_period: %v", err)
+		}
+	}
+
 	webhookTimeout, err := time.ParseDuration(cfg.Webhooks.Timeout)
 	if err != nil {
 		return nil, fmt.Errorf("invalid webhook timeout: %v", err)
 	}
 
+	webhookVerified := 24 * time.Hour
+	if cfg.Webhooks.VerifiedTTL != "" {
+		webhookVerified, err = time.ParseDuration(cfg.Webhooks.VerifiedTTL)
+		if err != nil || webhookVerified <= 0 {
+			return nil, fmt.Errorf("invalid webhooks verified_ttl %q", cfg.Webhooks.VerifiedTTL)
+		}
+	}
+
+	allowedTargets, err := webhook.ParseAllowedTargets(cfg.Webhooks.AllowedTargets)
+	if err != nil {
+		return nil, err
+	}
+	webhookTargets := webhook.TargetPolicy{DenyPrivate: cfg.Webhooks.DenyPrivateTargets, Allowed: allowedTargets}
+
+	listen, err := server.ParseListenAddress(cfg.Server.Listen, cfg.Server.Port, cfg.Server.SocketMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server listen: %v", err)
+	}
+
+	submitNetworks := handlers.NetworkPolicy{}
+	if submitNetworks.Allowed, err = handlers.ParseNetworks(cfg.SubmitNetworks.Allowed); err != nil {
+		return nil, fmt.Errorf("invalid submit_networks allowed: %v", err)
+	}
+	if submitNetworks.TrustedProxies, err = handlers.ParseNetworks(cfg.SubmitNetworks.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid submit_networks trusted_proxies: %v", err)
+	}
+
+	walletPoll := 2 * time.Second
+	if cfg.Wallet.PollInterval != "" {
+		walletPoll, err = time.ParseDuration(cfg.Wallet.PollInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wallet poll_interval: %v", err)
+		}
+	}
+
+	var corsMaxAge time.Duration
+	if cfg.CORS.MaxAge != "" {
+		corsMaxAge, err = time.ParseDuration(cfg.CORS.MaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cors max_age: %v", err)
+		}
+	}
+
+	challengeTTL := time.Minute
+	if cfg.Collection.ChallengeTTL != "" {
+		challengeTTL, err = time.ParseDuration(cfg.Collection.ChallengeTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid collection challenge_ttl: %v", err)
+		}
+	}
+	if challengeTTL < time.Second {
+		return nil, fmt.Errorf("invalid collection challenge_ttl: must be at least 1s")
+	}
+
+	// Zero sends no Retry-After hint on /collect 404s
+	retryAfter := 2 * time.Second
+	if cfg.Collection.RetryAfter != "" {
+		retryAfter, err = time.ParseDuration(cfg.Collection.RetryAfter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid collection retry_after: %v", err)
+		}
+	}
+
+	socketChallenge := 10 * time.Second
+	if cfg.WebSocket.ChallengeTimeout != "" {
+		socketChallenge, err = time.ParseDuration(cfg.WebSocket.ChallengeTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid websocket challenge_timeout: %v", err)
+		}
+	}
+
+	socketWait := 5 * time.Minute
+	if cfg.WebSocket.WaitTimeout != "" {
+		socketWait, err = time.ParseDuration(cfg.WebSocket.WaitTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid websocket wait_timeout: %v", err)
+		}
+	}
+
+	var accessLogMaxAge time.Duration
+	if cfg.AccessLog.MaxAge != "" {
+		accessLogMaxAge, err = time.ParseDuration(cfg.AccessLog.MaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid access_log max_age: %v", err)
+		}
+	}
+
+	usageRetention := storage.DefaultUsageRetention
+	if cfg.Storage.UsageRetention != "" {
+		usageRetention, err = time.ParseDuration(cfg.Storage.UsageRetention)
+		if err != nil {
+			return nil, fmt.Errorf("invalid usage_retention: %v", err)
+		}
+		if usageRetention < storage.UsageBucket {
+			return nil, fmt.Errorf("invalid usage_retention: must be at least 1h")
+		}
+	}
+
+	analyticsFlush := 5 * time.Second
+	if cfg.Analytics.FlushInterval != "" {
+		analyticsFlush, err = time.ParseDuration(cfg.Analytics.FlushInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid analytics flush_interval: %v", err)
+		}
+	}
+
+	analyticsTimeout := 5 * time.Second
+	if cfg.Analytics.Timeout != "" {
+		analyticsTimeout, err = time.ParseDuration(cfg.Analytics.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid analytics timeout: %v", err)
+		}
+	}
+
+	// Zero takes snapshots only on demand and at shutdown
+	var snapshotEvery time.Duration
+	if cfg.Storage.Snapshot.Interval != "" {
+		snapshotEvery, err = time.ParseDuration(cfg.Storage.Snapshot.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot interval: %v", err)
+		}
+		if snapshotEvery != 0 && snapshotEvery < time.Minute {
+			return nil, fmt.Errorf("invalid snapshot interval: must be at least 1m")
+		}
+	}
+
+	if cfg.AccessLog.File == "" {
+		cfg.AccessLog.File = "access.log"
+	}
+
+	if cfg.Storage.Snapshot.File == "" {
+		cfg.Storage.Snapshot.File = "receipts.snapshot"
+	}
+
+	if cfg.Analytics.Sink == "" {
+		cfg.Analytics.Sink = SinkFile
+	}
+	if cfg.Analytics.File == "" {
+		cfg.Analytics.File = "analytics.jsonl"
+	}
+
+	if len(cfg.CORS.AllowedMethods) == 0 {
+		cfg.CORS.AllowedMethods = []string{"GET"}
+	}
+
+	if cfg.Wallet.StaticDir == "" {
+		cfg.Wallet.StaticDir = "web/wallet"
+	}
+
+	if cfg.Protocol.ReceiptFormats == nil {
+		cfg.Protocol.ReceiptFormats = []int{1, 2}
+	}
+
+	if cfg.Discovery.Instance == "" {
+		cfg.Discovery.Instance = "receipt-bank"
+	}
+
+	cleanupPolicy := storage.DefaultCleanupPolicy()
+	if len(cfg.Storage.CleanupStrategies) > 0 {
+		cleanupPolicy.Strategies, err = storage.ParseStrategies(cfg.Storage.CleanupStrategies)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cleanup_strategies: %v", err)
+		}
+	}
+	cleanupPolicy.MaxCount = cfg.Storage.MaxReceipts
+
+	if cfg.Storage.Backend == "" {
+		cfg.Storage.Backend = BackendMemory
+	}
+	if cfg.Storage.Redis.KeyPrefix == "" {
+		cfg.Storage.Redis.KeyPrefix = "receipt-bank:"
+	}
+
+	redisOptions := storage.RedisOptions{
+		Address:      cfg.Storage.Redis.Address,
+		Username:     cfg.Storage.Redis.Username,
+		Password:     cfg.Storage.Redis.Password,
+		DB:           cfg.Storage.Redis.DB,
+		KeyPrefix:    cfg.Storage.Redis.KeyPrefix,
+		PoolSize:     cfg.Storage.Redis.PoolSize,
+		MinIdleConns: cfg.Storage.Redis.MinIdleConns,
+		MaxRetries:   cfg.Storage.Redis.MaxRetries,
+	}
+	for name, timeout := range map[string]struct {
+		value string
+		dest  *time.Duration
+	}{
+		"dial_timeout":  {cfg.Storage.Redis.DialTimeout, &redisOptions.DialTimeout},
+		"read_timeout":  {cfg.Storage.Redis.ReadTimeout, &redisOptions.ReadTimeout},
+		"write_timeout": {cfg.Storage.Redis.WriteTimeout, &redisOptions.WriteTimeout},
+	} {
+		if timeout.value == "" {
+			continue // go-redis default
+		}
+		if *timeout.dest, err = time.ParseDuration(timeout.value); err != nil {
+			return nil, fmt.Errorf("invalid redis %s: %v", name, err)
+		}
+	}
+
 	// Validate configuration
 	if err := validateConfig(&cfg); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %v", err)
@@ -71,19 +468,141 @@ func LoadConfig(filepath string) (*ParsedConfig, error) {
 		Config:          cfg,
 		CleanupInterval: cleanupInterval,
 		MaxReceiptAge:   maxReceiptAge,
+		MaxReceiptTTL:   maxReceiptTTL,
+		GracePeriod:     gracePeriod,
 		WebhookTimeout:  webhookTimeout,
+		WebhookVerified: webhookVerified,
+		WebhookTargets:  webhookTargets,
+		SubmitAllowList: submitNetworks,
+		Listen:          listen,
+		WalletPoll:      walletPoll,
+		CORSMaxAge:      corsMaxAge,
+		ChallengeTTL:    challengeTTL,
+		RetryAfter:      retryAfter,
+		SocketChallenge: socketChallenge,
+		SocketWait:      socketWait,
+		AccessLogMaxAge: accessLogMaxAge,
+		UsageRetention:  usageRetention,
+		AnalyticsFlush:  analyticsFlush,
+		SinkTimeout:     analyticsTimeout,
+		SnapshotEvery:   snapshotEvery,
+		CleanupPolicy:   cleanupPolicy,
+		Redis:           redisOptions,
 	}, nil
 }
 
 // validateConfig validates the configuration values
 func validateConfig(cfg *Config) error {
-	if cfg.Server.Port <= 0 || cfg.Server.Port > 65535 {
+	// Unix and systemd sockets have no port
+	socket := cfg.Server.Listen == server.NetworkSystemd || strings.HasPrefix(cfg.Server.Listen, server.NetworkUnix+":")
+	if !socket && (cfg.Server.Port <= 0 || cfg.Server.Port > 65535) {
 		return fmt.Errorf("server port must be between 1 and 65535")
 	}
 
+	if cfg.Server.MaxSubmitBytes < 0 || cfg.Server.MaxBatchBytes < 0 {
+		return fmt.Errorf("server max_submit_bytes and max_batch_bytes must be non-negative")
+	}
+
+	if cfg.AccessLog.MaxSizeMB < 0 || cfg.AccessLog.MaxBackups < 0 || cfg.AccessLog.KeyPrefixLength < 0 {
+		return fmt.Errorf("access_log max_size_mb, max_backups and key_prefix_length must be non-negative")
+	}
+
+	if cfg.RateLimit.SubmitPerMinute < 0 || cfg.RateLimit.CollectPerMinute < 0 {
+		return fmt.Errorf("rate_limit submit_per_minute and collect_per_minute must be non-negative")
+	}
+
+	if cfg.Storage.MaxReceipts < 0 {
+		return fmt.Errorf("storage max_receipts must be non-negative")
+	}
+
+	switch cfg.Storage.Backend {
+	case BackendMemory:
+	case BackendRedis:
+		if cfg.Storage.Redis.Address == "" {
+			return fmt.Errorf("storage redis address is required for the redis backend")
+		}
+		if cfg.Storage.Deduplicate {
+			return fmt.Errorf("storage deduplicate is only supported by the memory backend")
+		}
+		if cfg.Storage.Snapshot.Enabled {
+			return fmt.Errorf("storage snapshot is only supported by the memory backend")
+		}
+		if cfg.Storage.Redis.PoolSize < 0 || cfg.Storage.Redis.MinIdleConns < 0 {
+			return fmt.Errorf("storage redis pool_size and min_idle_conns must be non-negative")
+		}
+	default:
+		return fmt.Errorf("unknown storage backend %q (valid: memory, redis)", cfg.Storage.Backend)
+	}
+
+	if cfg.Storage.Snapshot.Enabled && cfg.Storage.Snapshot.Passphrase == "" {
+		return fmt.Errorf("storage snapshot passphrase is required when snapshots are enabled")
+	}
+
+	if cfg.Admin.Enabled && cfg.Admin.Token == "" {
+		return fmt.Errorf("admin token is required when the admin API is enabled")
+	}
+
+	if (cfg.Server.TLS.CertFile == "") != (cfg.Server.TLS.KeyFile == "") {
+		return fmt.Errorf("server tls needs both cert_file and key_file")
+	}
+
+	if cfg.Registers.Required && len(cfg.Registers.Allowed) == 0 {
+		return fmt.Errorf("registers allowed list is empty but authentication is required")
+	}
+
+	for _, entry := range cfg.Registers.Allowed {
+		if entry.CertSHA256 != "" && cfg.Server.TLS.CertFile == "" {
+			return fmt.Errorf("register %q uses a client certificate but server tls is not configured", entry.ID)
+		}
+	}
+
+	if cfg.CORS.Enabled && len(cfg.CORS.AllowedOrigins) == 0 {
+		return fmt.Errorf("cors allowed_origins is empty but cors is enabled")
+	}
+
+	if cfg.StrictMode.Enabled && cfg.StrictMode.AuthorityKeyFile == "" && cfg.StrictMode.AuthorityURL == "" {
+		return fmt.Errorf("strict_mode needs authority_key_file or authority_url")
+	}
+
+	for _, format := range cfg.Protocol.ReceiptFormats {
+		if format <= 0 || format > 255 {
+			return fmt.Errorf("protocol receipt_formats must be versions between 1 and 255")
+		}
+	}
+
+	if cfg.Protocol.MinEncryptedBytes < 0 || cfg.Protocol.MaxEncryptedBytes < 0 {
+		return fmt.Errorf("protocol min_encrypted_bytes and max_encrypted_bytes must be non-negative")
+	}
+	if cfg.Protocol.MaxEncryptedBytes > 0 && cfg.Protocol.MinEncryptedBytes > cfg.Protocol.MaxEncryptedBytes {
+		return fmt.Errorf("protocol min_encrypted_bytes must not exceed max_encrypted_bytes")
+	}
+
 	if cfg.Webhooks.MaxRetries < 0 {
 		return fmt.Errorf("webhook max_retries must be non-negative")
 	}
 
+	if cfg.Webhooks.Workers < 0 || cfg.Webhooks.QueueSize < 0 {
+		return fmt.Errorf("webhooks workers and queue_size must be non-negative")
+	}
+
+	if cfg.Analytics.BufferSize < 0 || cfg.Analytics.BatchSize < 0 {
+		return fmt.Errorf("analytics buffer_size and batch_size must be non-negative")
+	}
+	if cfg.Analytics.Enabled {
+		switch cfg.Analytics.Sink {
+		case SinkFile:
+		case SinkWebhook:
+			if cfg.Analytics.WebhookURL == "" {
+				return fmt.Errorf("analytics webhook_url is required for the webhook sink")
+			}
+		case SinkKafka:
+			if cfg.Analytics.Kafka.RestProxyURL == "" || cfg.Analytics.Kafka.Topic == "" {
+				return fmt.Errorf("analytics kafka rest_proxy_url and topic are required for the kafka sink")
+			}
+		default:
+			return fmt.Errorf("unknown analytics sink %q (valid: file, webhook, kafka)", cfg.Analytics.Sink)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,50 @@
+package discovery
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+
+	"github.com/hashicorp/mdns"
+)
+
+// ServiceName is the DNS-SD service type cash registers browse for
+const ServiceName = "_receipt-bank._tcp"
+
+// Advertiser announces the receipt bank on the local network via mDNS
+type Advertiser struct {
+	server  *mdns.Server
+	verbose bool
+}
+
+// NewAdvertiser starts answering mDNS queries for the receipt bank service.
+// If ips is empty the host name is resolved to find the addresses to announce.
+func NewAdvertiser(instance string, port int, ips []net.IP, verbose bool) (*Advertiser, error) {
+	host, _ := os.Hostname()
+	info := []string{"path=/", "api=receipt-bank"}
+
+	service, err := mdns.NewMDNSService(instance, ServiceName, "", "", port, ips, info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mDNS service: %v", err)
+	}
+
+	server, err := mdns.NewServer(&mdns.Config{Zone: service})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start mDNS responder: %v", err)
+	}
+
+	if verbose {
+		log.Printf("[DISCOVERY] Advertising %s.%s.local on %s port %d", instance, ServiceName, host, port)
+	}
+
+	return &Advertiser{server: server, verbose: verbose}, nil
+}
+
+// Shutdown stops answering mDNS queries
+func (a *Advertiser) Shutdown() error {
+	if a.verbose {
+		log.Printf("[DISCOVERY] Stopping mDNS advertisement")
+	}
+	return a.server.Shutdown()
+}
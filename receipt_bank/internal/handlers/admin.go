@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"receipt-bank/internal/analytics"
+	"receipt-bank/internal/models"
+	"receipt-bank/internal/registers"
+	"receipt-bank/internal/storage"
+	"receipt-bank/internal/webhook"
+)
+
+// AdminTokenHeader carries the admin API token
+const AdminTokenHeader = "X-Admin-Token"
+
+// AdminStatsResponse is the body of GET /admin/stats
+type AdminStatsResponse struct {
+	Storage       storage.Stats          `json:"storage"`
+	Deduplication *storage.DedupStats    `json:"deduplication,omitempty"`
+	Cleanup       storage.CleanupStats   `json:"cleanup"`
+	Webhooks      webhook.Stats          `json:"webhooks"`            // This instance only
+	Analytics     *analytics.Stats       `json:"analytics,omitempty"` // This instance only, when enabled
+	Snapshots     *storage.SnapshotStats `json:"snapshots,omitempty"` // When enabled
+	Timestamp     time.Time              `json:"timestamp"`
+}
+
+// ReceiptListResponse is the body of GET /admin/receipts
+type ReceiptListResponse struct {
+	Receipts []storage.ReceiptInfo `json:"receipts"`
+	Total    int                   `json:"total"` // Matching receipts before the limit
+}
+
+// WebhookFailuresResponse is the body of GET /admin/webhooks/failures
+type WebhookFailuresResponse struct {
+	Failures []webhook.Failure `json:"failures"`
+	LastSeq  int64             `json:"last_seq"` // Pass as after to get only newer failures
+}
+
+// UsageHistoryResponse is the body of GET /admin/stats/history
+type UsageHistoryResponse struct {
+	Bucket  string         `json:"bucket"` // hour or day
+	From    time.Time      `json:"from"`
+	To      time.Time      `json:"to"`
+	Buckets []UsageSummary `json:"buckets"` // Every bucket in the range, oldest first
+	Totals  UsageSummary   `json:"totals"`
+}
+
+// UsageSummary is a usage bucket with the rates derived from its counters.
+// A rate is omitted when nothing it is computed from happened.
+type UsageSummary struct {
+	storage.Usage
+	AvgCollectionSeconds *float64 `json:"avg_collection_seconds,omitempty"`
+	ExpiryRate           *float64 `json:"expiry_rate,omitempty"`          // expired / (collected + expired)
+	WebhookSuccessRate   *float64 `json:"webhook_success_rate,omitempty"` // delivered / (delivered + failed)
+}
+
+// Usage history bucket sizes
+const (
+	UsageBucketHour = "hour"
+	UsageBucketDay  = "day"
+)
+
+// maxUsageRange bounds the range of one usage history request
+const maxUsageRange = 366 * 24 * time.Hour
+
+// AdminAuth rejects requests without the configured admin token
+func (h *Handler) AdminAuth(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !validAdminToken(r, token) {
+				h.writeError(w, r, http.StatusUnauthorized, models.ErrorCodeUnauthorized, "Invalid or missing admin token")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SetAdminToken lets requests carrying the admin token see the /health
+// configuration summary and run its deep checks
+func (h *Handler) SetAdminToken(token string) {
+	h.adminToken = token
+}
+
+// validAdminToken reports whether r carries token; an empty token admits no one
+func validAdminToken(r *http.Request, token string) bool {
+	provided := r.Header.Get(AdminTokenHeader)
+	return token != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// CleanupHandler handles POST /admin/cleanup and runs a cleanup immediately
+func (h *Handler) CleanupHandler(w http.ResponseWriter, r *http.Request) {
+	run := h.storage.Cleanup(storage.TriggerManual)
+	h.write(w, r, http.StatusOK, run)
+}
+
+// CleanupStatsHandler handles GET /admin/cleanup/stats
+func (h *Handler) CleanupStatsHandler(w http.ResponseWriter, r *http.Request) {
+	h.write(w, r, http.StatusOK, h.storage.CleanupStats())
+}
+
+// AdminStatsHandler handles GET /admin/stats
+func (h *Handler) AdminStatsHandler(w http.ResponseWriter, r *http.Request) {
+	resp := AdminStatsResponse{
+		Storage:       h.storage.Stats(),
+		Deduplication: h.storage.DedupStats(),
+		Cleanup:       h.storage.CleanupStats(),
+		Webhooks:      h.webhookClient.Stats(),
+		Timestamp:     time.Now().UTC(),
+	}
+	if h.events != nil {
+		stats := h.events.Stats()
+		resp.Analytics = &stats
+	}
+	if h.snapshots != nil {
+		stats := h.snapshots.Stats()
+		resp.Snapshots = &stats
+	}
+	h.write(w, r, http.StatusOK, resp)
+}
+
+// UsageHistoryHandler handles GET /admin/stats/history
+// Query: bucket (hour or day, default hour), from and to (RFC 3339; default the
+// last 24 hours, or the last 7 days by day)
+func (h *Handler) UsageHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	bucket := query.Get("bucket")
+	size := storage.UsageBucket
+	switch bucket {
+	case "", UsageBucketHour:
+		bucket = UsageBucketHour
+	case UsageBucketDay:
+		size = 24 * time.Hour
+	default:
+		h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidRequest, "bucket must be hour or day")
+		return
+	}
+
+	to := time.Now().UTC()
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidRequest, "to must be an RFC 3339 time")
+			return
+		}
+		to = parsed.UTC()
+	}
+	from := to.Add(-24 * time.Hour)
+	if bucket == UsageBucketDay {
+		from = to.Add(-7 * 24 * time.Hour)
+	}
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidRequest, "from must be an RFC 3339 time")
+			return
+		}
+		from = parsed.UTC()
+	}
+	if !from.Before(to) || to.Sub(from) > maxUsageRange {
+		h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidRequest, "from must be before to, at most 366 days apart")
+		return
+	}
+
+	// Buckets are aligned to UTC hours or days
+	from = from.Truncate(size)
+	usage, err := h.storage.Usage(from, to)
+	if err != nil {
+		log.Printf("[ADMIN] Failed to read usage history: %v", err)
+		h.writeError(w, r, http.StatusServiceUnavailable, models.ErrorCodeUnavailable, "Receipt storage temporarily unavailable")
+		return
+	}
+
+	response := UsageHistoryResponse{Bucket: bucket, From: from, To: to}
+	totals := storage.Usage{Start: from}
+	next := 0
+	for start := from; start.Before(to); start = start.Add(size) {
+		summed := storage.Usage{Start: start}
+		for ; next < len(usage) && usage[next].Start.Before(start.Add(size)); next++ {
+			summed.Add(usage[next])
+		}
+		totals.Add(summed)
+		response.Buckets = append(response.Buckets, summarizeUsage(summed))
+	}
+	response.Totals = summarizeUsage(totals)
+
+	h.write(w, r, http.StatusOK, response)
+}
+
+// summarizeUsage derives the rates of a usage bucket
+func summarizeUsage(usage storage.Usage) UsageSummary {
+	summary := UsageSummary{Usage: usage}
+	if usage.Collected > 0 {
+		avg := float64(usage.CollectionMs) / float64(usage.Collected) / 1000
+		summary.AvgCollectionSeconds = &avg
+	}
+	if settled := usage.Collected + usage.Expired; settled > 0 {
+		rate := float64(usage.Expired) / float64(settled)
+		summary.ExpiryRate = &rate
+	}
+	if sent := usage.WebhooksDelivered + usage.WebhooksFailed; sent > 0 {
+		rate := float64(usage.WebhooksDelivered) / float64(sent)
+		summary.WebhookSuccessRate = &rate
+	}
+	return summary
+}
+
+// ListReceiptsHandler handles GET /admin/receipts, oldest first
+// Query: register (one cash register's receipts), limit (only the newest)
+func (h *Handler) ListReceiptsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidRequest, "limit must be a positive number")
+			return
+		}
+		limit = parsed
+	}
+
+	infos, err := h.storage.List()
+	if err != nil {
+		log.Printf("[ADMIN] Failed to list receipts: %v", err)
+		h.writeError(w, r, http.StatusServiceUnavailable, models.ErrorCodeUnavailable, "Receipt storage temporarily unavailable")
+		return
+	}
+
+	if register := r.URL.Query().Get("register"); register != "" {
+		matching := infos[:0]
+		for _, info := range infos {
+			if info.RegisterID == register {
+				matching = append(matching, info)
+			}
+		}
+		infos = matching
+	}
+
+	response := ReceiptListResponse{Receipts: infos, Total: len(infos)}
+	if limit > 0 && len(infos) > limit {
+		response.Receipts = infos[len(infos)-limit:]
+	}
+	h.write(w, r, http.StatusOK, response)
+}
+
+// DeleteReceiptHandler handles DELETE /admin/receipts/{receipt_id}
+func (h *Handler) DeleteReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	receiptID := mux.Vars(r)["receipt_id"]
+	if err := h.storage.Delete(receiptID); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			h.writeError(w, r, http.StatusNotFound, models.ErrorCodeNotFound, "Receipt not found")
+		case errors.Is(err, storage.ErrUnavailable):
+			log.Printf("[ADMIN] Failed to delete receipt %s: %v", receiptID, err)
+			h.writeError(w, r, http.StatusServiceUnavailable, models.ErrorCodeUnavailable, "Receipt storage temporarily unavailable")
+		default:
+			h.writeError(w, r, http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to delete receipt")
+		}
+		return
+	}
+
+	log.Printf("[ADMIN] Deleted receipt %s", receiptID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// WebhookFailuresHandler handles GET /admin/webhooks/failures
+// Query: after (only failures with a higher seq, for tailing)
+func (h *Handler) WebhookFailuresHandler(w http.ResponseWriter, r *http.Request) {
+	var after int64
+	if value := r.URL.Query().Get("after"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidRequest, "after must be a sequence number")
+			return
+		}
+		after = parsed
+	}
+
+	response := WebhookFailuresResponse{
+		Failures: h.webhookClient.Failures(after),
+		LastSeq:  h.webhookClient.Stats().Failed,
+	}
+	h.write(w, r, http.StatusOK, response)
+}
+
+// RegistersHandler handles GET /admin/registers
+func (h *Handler) RegistersHandler(w http.ResponseWriter, r *http.Request) {
+	if h.registers == nil {
+		h.writeError(w, r, http.StatusNotFound, models.ErrorCodeNotFound, "Register authentication is not enabled")
+		return
+	}
+	h.write(w, r, http.StatusOK, h.registers.List())
+}
+
+// RevokeRegisterHandler handles POST /admin/registers/{id}/revoke
+func (h *Handler) RevokeRegisterHandler(w http.ResponseWriter, r *http.Request) {
+	h.updateRegister(w, r, h.registers.Revoke)
+}
+
+// ReinstateRegisterHandler handles POST /admin/registers/{id}/reinstate
+func (h *Handler) ReinstateRegisterHandler(w http.ResponseWriter, r *http.Request) {
+	h.updateRegister(w, r, h.registers.Reinstate)
+}
+
+func (h *Handler) updateRegister(w http.ResponseWriter, r *http.Request, update func(string) (registers.Info, error)) {
+	if h.registers == nil {
+		h.writeError(w, r, http.StatusNotFound, models.ErrorCodeNotFound, "Register authentication is not enabled")
+		return
+	}
+
+	info, err := update(mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, registers.ErrUnknownRegister) {
+			h.writeError(w, r, http.StatusNotFound, models.ErrorCodeNotFound, "Unknown cash register")
+		} else {
+			h.writeError(w, r, http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to update register")
+		}
+		return
+	}
+
+	h.write(w, r, http.StatusOK, info)
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"receipt-bank/internal/models"
+	"receipt-bank/internal/registers"
+	"receipt-bank/internal/storage"
+)
+
+// testAdminToken is the admin token adminRouter requires
+const testAdminToken = "admin-secret"
+
+// adminRouter mounts the admin API the way the server does
+func adminRouter(h *Handler) *mux.Router {
+	router := mux.NewRouter().UseEncodedPath()
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.HandleFunc("/cleanup", h.CleanupHandler).Methods("POST")
+	admin.HandleFunc("/cleanup/stats", h.CleanupStatsHandler).Methods("GET")
+	admin.HandleFunc("/stats", h.AdminStatsHandler).Methods("GET")
+	admin.HandleFunc("/stats/history", h.UsageHistoryHandler).Methods("GET")
+	admin.HandleFunc("/receipts", h.ListReceiptsHandler).Methods("GET")
+	admin.HandleFunc("/receipts/{receipt_id}", h.DeleteReceiptHandler).Methods("DELETE")
+	admin.HandleFunc("/webhooks/failures", h.WebhookFailuresHandler).Methods("GET")
+	admin.HandleFunc("/registers", h.RegistersHandler).Methods("GET")
+	admin.HandleFunc("/registers/{id}/revoke", h.RevokeRegisterHandler).Methods("POST")
+	admin.HandleFunc("/registers/{id}/reinstate", h.ReinstateRegisterHandler).Methods("POST")
+	admin.Use(h.AdminAuth(testAdminToken))
+	return router
+}
+
+// serveAdmin sends an admin request with the admin token and decodes a 2xx JSON body into v
+func serveAdmin(t *testing.T, router http.Handler, method, path string, v interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	w := serve(router, method, path, AdminTokenHeader, testAdminToken)
+	if v != nil && w.Code < 300 {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v in %s", method, path, err, w.Body)
+		}
+	}
+	return w
+}
+
+func TestAdminAuth(t *testing.T) {
+	h, _ := newTestHandler(t)
+	router := adminRouter(h)
+
+	for _, token := range []string{"", "wrong"} {
+		w := serve(router, "GET", "/admin/stats", AdminTokenHeader, token)
+		var body models.ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if w.Code != http.StatusUnauthorized || body.Code != models.ErrorCodeUnauthorized {
+			t.Errorf("Token %q: got %d %s, want 401 UNAUTHORIZED", token, w.Code, w.Body)
+		}
+	}
+	if w := serveAdmin(t, router, "GET", "/admin/stats", nil); w.Code != http.StatusOK {
+		t.Errorf("With the admin token: got %d", w.Code)
+	}
+
+	// An empty configured token admits no one, not an empty header
+	open := mux.NewRouter()
+	open.Handle("/admin/stats", h.AdminAuth("")(http.HandlerFunc(h.AdminStatsHandler)))
+	if w := serve(open, "GET", "/admin/stats", AdminTokenHeader, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Empty admin token: got %d, want 401", w.Code)
+	}
+}
+
+func TestAdminListAndDeleteReceipts(t *testing.T) {
+	h, store := newTestHandler(t)
+	router := adminRouter(h)
+
+	now := time.Now()
+	for i, register := range []string{"register-1", "register-2", "register-1"} {
+		_, key := newTestKey(t)
+		receipt := &models.Receipt{
+			EphemeralKey:  key,
+			EncryptedData: "cGF5bG9hZA==",
+			ReceiptID:     "receipt-" + string(rune('a'+i)),
+			RegisterID:    register,
+			Timestamp:     now.Add(time.Duration(i-3) * time.Minute),
+		}
+		if err := store.Store(receipt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := func(list ReceiptListResponse) []string {
+		var out []string
+		for _, info := range list.Receipts {
+			out = append(out, info.ReceiptID)
+		}
+		return out
+	}
+
+	var list ReceiptListResponse
+	serveAdmin(t, router, "GET", "/admin/receipts", &list)
+	if got := ids(list); list.Total != 3 || len(got) != 3 || got[0] != "receipt-a" || got[2] != "receipt-c" {
+		t.Errorf("List: got %v (total %d), want receipt-a..c oldest first", got, list.Total)
+	}
+	if list.Receipts[0].KeyPrefix == "" || list.Receipts[0].Size != len("cGF5bG9hZA==") {
+		t.Errorf("List is missing receipt metadata: %+v", list.Receipts[0])
+	}
+
+	list = ReceiptListResponse{}
+	serveAdmin(t, router, "GET", "/admin/receipts?register=register-1&limit=1", &list)
+	if got := ids(list); list.Total != 2 || len(got) != 1 || got[0] != "receipt-c" {
+		t.Errorf("register-1, limit 1: got %v (total %d), want the newest of 2", got, list.Total)
+	}
+
+	for _, limit := range []string{"0", "-1", "many"} {
+		if w := serveAdmin(t, router, "GET", "/admin/receipts?limit="+limit, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("limit=%s: got %d, want 400", limit, w.Code)
+		}
+	}
+
+	if w := serveAdmin(t, router, "DELETE", "/admin/receipts/receipt-b", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("Delete: got %d %s", w.Code, w.Body)
+	}
+	if w := serveAdmin(t, router, "DELETE", "/admin/receipts/receipt-b", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Second delete: got %d, want 404", w.Code)
+	}
+	if total := store.Stats().Total; total != 2 {
+		t.Errorf("Expected 2 receipts after the delete, got %d", total)
+	}
+}
+
+func TestAdminCleanupAndStats(t *testing.T) {
+	h, store := newTestHandler(t)
+	router := adminRouter(h)
+
+	// One receipt past its ttl, one still waiting
+	_, expired := newTestKey(t)
+	if err := store.Store(&models.Receipt{EphemeralKey: expired, EncryptedData: "cGF5bG9hZA==", ReceiptID: "expired",
+		Timestamp: time.Now().Add(-time.Minute), TTL: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	_, waiting := newTestKey(t)
+	storeTestReceipt(t, store, waiting, []byte("payload"))
+
+	var run storage.CleanupRun
+	serveAdmin(t, router, "POST", "/admin/cleanup", &run)
+	if run.Trigger != storage.TriggerManual || run.Removed != 1 || run.Remaining != 1 {
+		t.Errorf("Cleanup: got %+v, want a manual run removing 1 and leaving 1", run)
+	}
+
+	var stats storage.CleanupStats
+	serveAdmin(t, router, "GET", "/admin/cleanup/stats", &stats)
+	if stats.Runs != 1 || stats.TotalRemoved != 1 || stats.LastRun == nil || stats.LastRun.Trigger != storage.TriggerManual {
+		t.Errorf("Cleanup stats: got %+v", stats)
+	}
+
+	var admin AdminStatsResponse
+	serveAdmin(t, router, "GET", "/admin/stats", &admin)
+	if admin.Storage.Total != 1 || admin.Cleanup.Runs != 1 || admin.Timestamp.IsZero() {
+		t.Errorf("Admin stats: got %+v", admin)
+	}
+	if admin.Analytics != nil || admin.Snapshots != nil {
+		t.Errorf("Admin stats report features that are off: %+v", admin)
+	}
+}
+
+func TestAdminWebhookFailures(t *testing.T) {
+	h, _ := newTestHandler(t)
+	router := adminRouter(h)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+	now := time.Now()
+	for _, id := range []string{"receipt-1", "receipt-2"} {
+		if err := h.webhookClient.NotifyCollection(&models.Receipt{ReceiptID: id, WebhookURL: receiver.URL, Timestamp: now}); err == nil {
+			t.Fatalf("Expected the webhook to %s to fail", id)
+		}
+	}
+
+	var failures WebhookFailuresResponse
+	serveAdmin(t, router, "GET", "/admin/webhooks/failures", &failures)
+	if len(failures.Failures) != 2 || failures.LastSeq != 2 || failures.Failures[0].ReceiptID != "receipt-1" {
+		t.Fatalf("Failures: got %+v, want both, oldest first", failures)
+	}
+
+	// Tailing from the last sequence number returns only newer failures
+	failures = WebhookFailuresResponse{}
+	serveAdmin(t, router, "GET", "/admin/webhooks/failures?after=1", &failures)
+	if len(failures.Failures) != 1 || failures.Failures[0].ReceiptID != "receipt-2" {
+		t.Errorf("after=1: got %+v, want receipt-2 only", failures.Failures)
+	}
+
+	for _, after := range []string{"-1", "last"} {
+		if w := serveAdmin(t, router, "GET", "/admin/webhooks/failures?after="+after, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("after=%s: got %d, want 400", after, w.Code)
+		}
+	}
+}
+
+func TestAdminRegisters(t *testing.T) {
+	h, _ := newTestHandler(t)
+	router := adminRouter(h)
+
+	// Without register authentication there is nothing to manage
+	for _, request := range [][2]string{{"GET", "/admin/registers"}, {"POST", "/admin/registers/register-1/revoke"}} {
+		if w := serveAdmin(t, router, request[0], request[1], nil); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s without registers: got %d, want 404", request[0], request[1], w.Code)
+		}
+	}
+
+	registry, err := registers.NewRegistry([]registers.Entry{{ID: "register-1", APIKey: "key-1"}}, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetRegisters(registry)
+
+	var info registers.Info
+	serveAdmin(t, router, "POST", "/admin/registers/register-1/revoke", &info)
+	if !info.Revoked {
+		t.Errorf("Revoke: got %+v", info)
+	}
+	var list []registers.Info
+	serveAdmin(t, router, "GET", "/admin/registers", &list)
+	if len(list) != 1 || !list[0].Revoked {
+		t.Errorf("Registers after revoke: got %+v", list)
+	}
+
+	info = registers.Info{}
+	serveAdmin(t, router, "POST", "/admin/registers/register-1/reinstate", &info)
+	if info.Revoked {
+		t.Errorf("Reinstate: got %+v", info)
+	}
+	if w := serveAdmin(t, router, "POST", "/admin/registers/register-9/revoke", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Unknown register: got %d, want 404", w.Code)
+	}
+}
+
+func TestAdminUsageHistory(t *testing.T) {
+	h, store := newTestHandler(t)
+	router := adminRouter(h)
+
+	_, collected := newTestKey(t)
+	_, waiting := newTestKey(t)
+	storeTestReceipt(t, store, collected, []byte("payload"))
+	storeTestReceipt(t, store, waiting, []byte("payload"))
+	if _, err := store.Retrieve(collected); err != nil {
+		t.Fatal(err)
+	}
+	store.RecordWebhook(true)
+	store.RecordWebhook(false)
+
+	var history UsageHistoryResponse
+	serveAdmin(t, router, "GET", "/admin/stats/history", &history)
+	if history.Bucket != UsageBucketHour || len(history.Buckets) < 24 || len(history.Buckets) > 25 {
+		t.Fatalf("Default history: got %s with %d buckets, want a day of hours", history.Bucket, len(history.Buckets))
+	}
+	for i := 1; i < len(history.Buckets); i++ {
+		if got := history.Buckets[i].Start.Sub(history.Buckets[i-1].Start); got != time.Hour {
+			t.Fatalf("Buckets %d and %d are %v apart, want an hour", i-1, i, got)
+		}
+	}
+
+	// This hour's activity is in the last bucket and the totals
+	for name, summary := range map[string]UsageSummary{"last bucket": history.Buckets[len(history.Buckets)-1], "totals": history.Totals} {
+		if summary.Submitted != 2 || summary.Collected != 1 || summary.WebhooksDelivered != 1 || summary.WebhooksFailed != 1 {
+			t.Errorf("%s: got %+v", name, summary.Usage)
+		}
+		if summary.WebhookSuccessRate == nil || *summary.WebhookSuccessRate != 0.5 {
+			t.Errorf("%s: webhook success rate %v, want 0.5", name, summary.WebhookSuccessRate)
+		}
+		if summary.ExpiryRate == nil || *summary.ExpiryRate != 0 || summary.AvgCollectionSeconds == nil {
+			t.Errorf("%s: expiry rate %v and average collection %v, want 0 and a time", name, summary.ExpiryRate, summary.AvgCollectionSeconds)
+		}
+	}
+
+	// Rates are left out of idle buckets
+	if first := history.Buckets[0]; first.ExpiryRate != nil || first.WebhookSuccessRate != nil || first.AvgCollectionSeconds != nil {
+		t.Errorf("Idle bucket has rates: %+v", first)
+	}
+
+	history = UsageHistoryResponse{}
+	serveAdmin(t, router, "GET", "/admin/stats/history?bucket=day", &history)
+	if history.Bucket != UsageBucketDay || len(history.Buckets) < 7 || len(history.Buckets) > 8 || history.Totals.Submitted != 2 {
+		t.Errorf("Daily history: got %s with %d buckets and totals %+v", history.Bucket, len(history.Buckets), history.Totals.Usage)
+	}
+	if start := history.Buckets[0].Start; !start.Equal(start.Truncate(24 * time.Hour)) {
+		t.Errorf("Daily buckets start at %v, want a UTC midnight", start)
+	}
+
+	history = UsageHistoryResponse{}
+	serveAdmin(t, router, "GET", "/admin/stats/history?from=2026-01-01T10:30:00Z&to=2026-01-01T13:00:00Z", &history)
+	if len(history.Buckets) != 3 || !history.From.Equal(time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)) || history.Totals.Submitted != 0 {
+		t.Errorf("Explicit range: got %d buckets from %v, totals %+v", len(history.Buckets), history.From, history.Totals.Usage)
+	}
+
+	for _, query := range []string{
+		"bucket=week",
+		"from=yesterday",
+		"to=now",
+		"from=2026-01-02T00:00:00Z&to=2026-01-01T00:00:00Z",
+		"from=2024-01-01T00:00:00Z&to=2026-01-01T00:00:00Z",
+	} {
+		if w := serveAdmin(t, router, "GET", "/admin/stats/history?"+query, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"receipt-bank/internal/models"
+	"receipt-bank/internal/registers"
+)
+
+// RegisterKeyHeader carries a cash register's API key on /submit
+const RegisterKeyHeader = "X-API-Key"
+
+// authenticateRegister identifies the depositing cash register by API key or, failing that,
+// by TLS client certificate. It writes the error response and returns false on failure.
+// Without a registry submissions are anonymous and always allowed.
+func (h *Handler) authenticateRegister(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if h.registers == nil {
+		return "", true
+	}
+
+	registerID, err := "", registers.ErrUnknownRegister
+	if key := r.Header.Get(RegisterKeyHeader); key != "" {
+		registerID, err = h.registers.AuthenticateKey(key)
+	} else if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		registerID, err = h.registers.AuthenticateCertificate(r.TLS.PeerCertificates[0].Raw)
+	}
+
+	switch {
+	case err == nil:
+		return registerID, true
+	case errors.Is(err, registers.ErrRevoked):
+		log.Printf("[AUTH] Rejected submission from revoked register %s", registerID)
+		h.writeError(w, r, http.StatusForbidden, models.ErrorCodeForbidden, "Cash register has been revoked")
+	default:
+		if h.verbose {
+			log.Printf("[AUTH] Rejected unauthenticated submission from %s", r.RemoteAddr)
+		}
+		h.writeError(w, r, http.StatusUnauthorized, models.ErrorCodeUnauthorized, "Cash register authentication required ("+RegisterKeyHeader+" header or client certificate)")
+	}
+	return "", false
+}
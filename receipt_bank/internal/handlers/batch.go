@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"receipt-bank/internal/models"
+)
+
+// SubmitBatchHandler handles POST /submit/batch: each entry is validated and stored on its
+// own, as if sent to /submit, so one bad or duplicate receipt doesn't hold back the rest.
+// Each entry counts as one request against the submit rate limit; entries past it are
+// answered RATE_LIMITED, and a batch with none left is refused whole.
+func (h *Handler) SubmitBatchHandler(w http.ResponseWriter, r *http.Request) {
+	registerID, ok := h.authenticateRegister(w, r)
+	if !ok {
+		return
+	}
+	client := "ip:" + clientIP(r)
+	if registerID != "" {
+		client = "register:" + registerID
+	}
+
+	var req models.SubmitBatchRequest
+	if !h.decodeBody(w, r, &req) {
+		return
+	}
+	if len(req.Receipts) == 0 {
+		h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidRequest, "receipts must not be empty")
+		return
+	}
+	if len(req.Receipts) > models.MaxBatchSize {
+		h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			fmt.Sprintf("A batch may carry at most %d receipts", models.MaxBatchSize))
+		return
+	}
+
+	admitted, wait := len(req.Receipts), time.Duration(0)
+	if h.submitLimit != nil {
+		admitted, wait = h.submitLimit.allowN(client, len(req.Receipts))
+		if admitted == 0 {
+			h.writeRateLimited(w, r, h.submitLimit, wait)
+			return
+		}
+	}
+
+	resp := models.SubmitBatchResponse{
+		Results: make([]models.SubmitBatchResult, 0, len(req.Receipts)),
+		Summary: models.SubmitBatchSummary{Total: len(req.Receipts)},
+	}
+	for i := range req.Receipts {
+		submission := &req.Receipts[i]
+		result := models.SubmitBatchResult{ReceiptID: submission.ReceiptID, Status: http.StatusOK}
+
+		if i >= admitted {
+			result.Status, result.Code = http.StatusTooManyRequests, models.ErrorCodeRateLimited
+			result.Error = rateLimitMessage(h.submitLimit, retryAfterSeconds(wait))
+			resp.Summary.Failed++
+		} else if failure := h.storeSubmission(submission, registerID); failure != nil {
+			result.Status, result.Code, result.Error = failure.status, failure.code, failure.message
+			if failure.code == models.ErrorCodeDuplicateReceipt {
+				resp.Summary.Duplicate++
+			} else {
+				resp.Summary.Failed++
+			}
+		} else {
+			resp.Summary.Stored++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	if h.verbose {
+		log.Printf("[API] Batch of %d receipts: %d stored, %d duplicate, %d failed",
+			resp.Summary.Total, resp.Summary.Stored, resp.Summary.Duplicate, resp.Summary.Failed)
+	}
+
+	h.write(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"receipt-bank/internal/models"
+)
+
+// postBatch sends submissions to SubmitBatchHandler and decodes a 200 response
+func postBatch(t *testing.T, h *Handler, submissions []models.SubmitRequest) (*httptest.ResponseRecorder, models.SubmitBatchResponse) {
+	t.Helper()
+	body, err := json.Marshal(models.SubmitBatchRequest{Receipts: submissions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/submit/batch", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.SubmitBatchHandler(w, r)
+
+	var resp models.SubmitBatchResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Batch response: %v in %s", err, w.Body)
+		}
+	}
+	return w, resp
+}
+
+// testSubmission is a valid submission of receiptID to a fresh ephemeral key
+func testSubmission(t *testing.T, receiptID string) models.SubmitRequest {
+	t.Helper()
+	_, key := newTestKey(t)
+	return models.SubmitRequest{
+		EphemeralKey:  key,
+		EncryptedData: base64.StdEncoding.EncodeToString([]byte("encrypted " + receiptID)),
+		ReceiptID:     receiptID,
+		WebhookURL:    "https://register.example/webhook",
+	}
+}
+
+func TestSubmitBatch(t *testing.T) {
+	h, store := newTestHandler(t)
+	stored := testSubmission(t, "r-0")
+	if err := store.Store(&models.Receipt{EphemeralKey: stored.EphemeralKey, EncryptedData: stored.EncryptedData, ReceiptID: "r-0", Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	badKey := testSubmission(t, "r-bad")
+	badKey.EphemeralKey = "not a key"
+	w, resp := postBatch(t, h, []models.SubmitRequest{
+		testSubmission(t, "r-1"),
+		testSubmission(t, "r-1"),
+		badKey,
+		testSubmission(t, "r-0"),
+		testSubmission(t, "r-2"),
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Batch: %d %s", w.Code, w.Body)
+	}
+
+	want := []struct {
+		id     string
+		status int
+		code   string
+	}{
+		{"r-1", http.StatusOK, ""},
+		{"r-1", http.StatusConflict, models.ErrorCodeDuplicateReceipt},
+		{"r-bad", http.StatusBadRequest, models.ErrorCodeInvalidKey},
+		{"r-0", http.StatusConflict, models.ErrorCodeDuplicateReceipt},
+		{"r-2", http.StatusOK, ""},
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("Expected %d results, got %+v", len(want), resp.Results)
+	}
+	for i, result := range resp.Results {
+		if result.ReceiptID != want[i].id || result.Status != want[i].status || result.Code != want[i].code {
+			t.Errorf("Result %d: got %+v, want %s %d %s", i, result, want[i].id, want[i].status, want[i].code)
+		}
+	}
+	if summary := resp.Summary; summary != (models.SubmitBatchSummary{Total: 5, Stored: 2, Duplicate: 2, Failed: 1}) {
+		t.Errorf("Summary: got %+v", summary)
+	}
+	if total := store.Stats().Total; total != 3 {
+		t.Errorf("Expected 3 receipts stored, got %d", total)
+	}
+
+	if w, _ := postBatch(t, h, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Empty batch: got %d, want 400", w.Code)
+	}
+	if w, _ := postBatch(t, h, make([]models.SubmitRequest, models.MaxBatchSize+1)); w.Code != http.StatusBadRequest {
+		t.Errorf("Batch over %d: got %d, want 400", models.MaxBatchSize, w.Code)
+	}
+}
+
+func TestSubmitBatchRateLimit(t *testing.T) {
+	h, store := newTestHandler(t)
+	h.SetRateLimits(3, 0)
+	now := time.Date(2026, 1, 2, 3, 4, 30, 0, time.UTC)
+	h.submitLimit.now = func() time.Time { return now }
+
+	// Each entry counts against the limit
+	if w, resp := postBatch(t, h, []models.SubmitRequest{testSubmission(t, "r-1"), testSubmission(t, "r-2")}); w.Code != http.StatusOK || resp.Summary.Stored != 2 {
+		t.Fatalf("First batch: %d %s", w.Code, w.Body)
+	}
+
+	// Entries past it are refused on their own, and not stored
+	w, resp := postBatch(t, h, []models.SubmitRequest{testSubmission(t, "r-3"), testSubmission(t, "r-4")})
+	if w.Code != http.StatusOK || len(resp.Results) != 2 {
+		t.Fatalf("Second batch: %d %s", w.Code, w.Body)
+	}
+	if resp.Results[0].Status != http.StatusOK {
+		t.Errorf("Expected r-3 to fit the limit, got %+v", resp.Results[0])
+	}
+	if result := resp.Results[1]; result.Status != http.StatusTooManyRequests || result.Code != models.ErrorCodeRateLimited {
+		t.Errorf("Expected r-4 to be rate limited, got %+v", result)
+	}
+	if resp.Summary != (models.SubmitBatchSummary{Total: 2, Stored: 1, Failed: 1}) {
+		t.Errorf("Summary: got %+v", resp.Summary)
+	}
+	if total := store.Stats().Total; total != 3 {
+		t.Errorf("Expected 3 receipts stored, got %d", total)
+	}
+
+	// With no room left the batch is refused whole
+	w, _ = postBatch(t, h, []models.SubmitRequest{testSubmission(t, "r-4")})
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("Third batch: got %d with Retry-After %q, want 429 and 30", w.Code, w.Header().Get("Retry-After"))
+	}
+}
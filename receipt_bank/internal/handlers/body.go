@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"receipt-bank/internal/models"
+)
+
+// Default request body limits: a receipt is a few kilobytes, a batch at most MaxBatchSize of them
+const (
+	DefaultMaxSubmitBytes = 1 << 20
+	DefaultMaxBatchBytes  = 16 << 20
+)
+
+// SetBodyLimits bounds the request bodies of /submit and /submit/batch (0 = the default)
+func (h *Handler) SetBodyLimits(submitBytes, batchBytes int64) {
+	h.maxSubmitBytes = submitBytes
+	h.maxBatchBytes = batchBytes
+}
+
+// BodyLimits returns the largest request body /submit and /submit/batch accept
+func (h *Handler) BodyLimits() (submitBytes, batchBytes int64) {
+	submitBytes, batchBytes = h.maxSubmitBytes, h.maxBatchBytes
+	if submitBytes <= 0 {
+		submitBytes = DefaultMaxSubmitBytes
+	}
+	if batchBytes <= 0 {
+		batchBytes = DefaultMaxBatchBytes
+	}
+	return submitBytes, batchBytes
+}
+
+// JSONBody guards an endpoint that decodes a request body: the body must be labelled with
+// a supported Content-Type (415 otherwise) and be at most maxBytes long (413). A declared
+// Content-Length over the limit is refused before reading; an undeclared or understated one
+// is cut off at the limit, so an oversized upload is never held in memory.
+func JSONBody(maxBytes int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") == "" || requestCodec(r) == nil {
+			writeWithCodec(w, codecs[0], http.StatusUnsupportedMediaType, models.ErrorResponse{
+				Error: "Content-Type must be one of: " + strings.Join(SupportedContentTypes(), ", "),
+				Code:  models.ErrorCodeUnsupportedFormat,
+			})
+			return
+		}
+		if r.ContentLength > maxBytes {
+			writeWithCodec(w, codecs[0], http.StatusRequestEntityTooLarge, models.ErrorResponse{
+				Error: fmt.Sprintf("Request body exceeds %d bytes", maxBytes),
+				Code:  models.ErrorCodePayloadTooLarge,
+			})
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeBody decodes the request body into v, answering the request with a 400 or 413
+// that names the problem and returning false when it can't
+func (h *Handler) decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := requestCodec(r).Decode(r.Body, v)
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	message := "Invalid request payload"
+	switch {
+	case errors.As(err, &tooLarge):
+		h.writeError(w, r, http.StatusRequestEntityTooLarge, models.ErrorCodePayloadTooLarge,
+			fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit))
+		return false
+	case errors.Is(err, io.EOF):
+		message = "Request body is empty"
+	case errors.As(err, &syntaxErr):
+		message = fmt.Sprintf("Malformed JSON at byte %d", syntaxErr.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		message = "Request body ends in the middle of a JSON value"
+	case errors.As(err, &typeErr):
+		message = fmt.Sprintf("Field %s has the wrong type (expected %s)", typeErr.Field, typeErr.Type)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		message = "Unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field ")
+	case errors.Is(err, errTrailingData):
+		message = "Request body has data after the JSON value"
+	}
+	h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidRequest, message)
+	return false
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"receipt-bank/internal/models"
+	"receipt-bank/internal/storage"
+)
+
+// SetRetryAfter sets the Retry-After hint sent with 404 answers from /collect, telling
+// polling wallets how long to wait before asking again (0 sends no hint)
+func (h *Handler) SetRetryAfter(retryAfter time.Duration) {
+	h.retryAfter = retryAfter
+}
+
+// CollectHeadHandler handles HEAD /collect/{ephemeral_key}: an existence check that
+// answers 200 with the receipt's ETag once it was submitted, or 404 with Retry-After.
+// It doesn't collect the receipt or fire the webhook, but takes the same proof of
+// possession as GET, since the ETag and receipt ID tell who holds the QR code a sale exists.
+func (h *Handler) CollectHeadHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.checkRate(w, r, h.collectLimit, clientIP(r)) {
+		return
+	}
+
+	ephemeralKey, err := url.PathUnescape(mux.Vars(r)["ephemeral_key"])
+	if err != nil || models.ValidateEphemeralKey(ephemeralKey) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !h.checkPossession(w, r, ephemeralKey) {
+		return
+	}
+
+	receipt, status := h.peek(ephemeralKey)
+	switch status {
+	case http.StatusOK:
+		w.Header().Set("ETag", receipt.ETag())
+		w.Header().Set(ReceiptIDHeader, receipt.ReceiptID)
+	case http.StatusNotFound:
+		h.setRetryAfter(w)
+	}
+	w.WriteHeader(status)
+}
+
+// CollectMetaHandler handles GET /collect/{ephemeral_key}/meta: whether a receipt is
+// waiting, its size and submission time, so a wallet on a metered connection can decide
+// whether to collect it. Like HEAD it takes the proof of possession but doesn't collect
+// the receipt or fire the webhook; a receipt not submitted yet answers 200 with exists false.
+func (h *Handler) CollectMetaHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.checkRate(w, r, h.collectLimit, clientIP(r)) {
+		return
+	}
+
+	ephemeralKey, err := url.PathUnescape(mux.Vars(r)["ephemeral_key"])
+	if err != nil {
+		h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidKey, "ephemeral_key must be URL-encoded")
+		return
+	}
+	if err := models.ValidateEphemeralKey(ephemeralKey); err != nil {
+		h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidKey, err.Error())
+		return
+	}
+	if !h.checkPossession(w, r, ephemeralKey) {
+		return
+	}
+
+	receipt, status := h.peek(ephemeralKey)
+	switch status {
+	case http.StatusOK:
+		submittedAt := receipt.Timestamp
+		w.Header().Set("ETag", receipt.ETag())
+		h.write(w, r, http.StatusOK, models.ReceiptMetaResponse{
+			Exists:      true,
+			Size:        receipt.Size(),
+			SubmittedAt: &submittedAt,
+			Collected:   receipt.IsCollected(),
+		})
+	case http.StatusNotFound:
+		h.setRetryAfter(w)
+		h.write(w, r, http.StatusOK, models.ReceiptMetaResponse{})
+	default:
+		h.writeError(w, r, status, models.ErrorCodeUnavailable, "Receipt storage temporarily unavailable")
+	}
+}
+
+// checkNotModified answers a GET /collect carrying If-None-Match without collecting
+// the receipt: 304 when the wallet already holds this receipt, 404 when none was
+// submitted yet. It runs after checkPossession and returns false when it answered the request.
+func (h *Handler) checkNotModified(w http.ResponseWriter, r *http.Request, ephemeralKey string) bool {
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch == "" {
+		return true
+	}
+
+	receipt, status := h.peek(ephemeralKey)
+	switch status {
+	case http.StatusOK:
+		if !etagMatches(ifNoneMatch, receipt.ETag()) {
+			return true // Changed: collect it
+		}
+		w.Header().Set("ETag", receipt.ETag())
+		w.WriteHeader(http.StatusNotModified)
+	case http.StatusNotFound:
+		h.writeNotFound(w, r)
+	default:
+		h.writeError(w, r, status, models.ErrorCodeUnavailable, "Receipt storage temporarily unavailable")
+	}
+	return false
+}
+
+// peek looks a receipt up without collecting it, returning the status to answer with
+func (h *Handler) peek(ephemeralKey string) (*models.Receipt, int) {
+	receipt, err := h.storage.Peek(ephemeralKey)
+	switch {
+	case err == nil:
+		return receipt, http.StatusOK
+	case errors.Is(err, storage.ErrNotFound):
+		return nil, http.StatusNotFound
+	default:
+		log.Printf("[API] Failed to look up receipt: %v", err)
+		return nil, http.StatusServiceUnavailable
+	}
+}
+
+// writeNotFound answers a /collect for a receipt that isn't there (yet). Polling wallets
+// see this on every attempt, so it isn't logged.
+func (h *Handler) writeNotFound(w http.ResponseWriter, r *http.Request) {
+	h.setRetryAfter(w)
+	h.write(w, r, http.StatusNotFound, models.ErrorResponse{
+		Error: "No receipt found for given ephemeral key",
+		Code:  models.ErrorCodeNotFound,
+	})
+}
+
+func (h *Handler) setRetryAfter(w http.ResponseWriter) {
+	if h.retryAfter > 0 {
+		seconds := int((h.retryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+}
+
+// etagMatches reports whether an If-None-Match list names etag, using the weak
+// comparison RFC 9110 prescribes for If-None-Match
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
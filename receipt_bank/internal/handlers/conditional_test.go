@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"receipt-bank/internal/storage"
+)
+
+func TestCollectNotModified(t *testing.T) {
+	h, store := newTestHandler(t)
+	router := collectRouter(h)
+	_, ephemeralKey := newTestKey(t)
+	receipt := storeTestReceipt(t, store, ephemeralKey, []byte("receipt"))
+	path := "/collect/" + url.PathEscape(ephemeralKey)
+
+	w := serve(router, http.MethodGet, path, "If-None-Match", receipt.ETag())
+	if w.Code != http.StatusNotModified || w.Header().Get("ETag") != receipt.ETag() {
+		t.Fatalf("Matching ETag: got %d with ETag %q, want 304 with %s", w.Code, w.Header().Get("ETag"), receipt.ETag())
+	}
+	if peeked, _ := store.Peek(ephemeralKey); peeked.IsCollected() {
+		t.Error("A 304 collected the receipt")
+	}
+
+	w = serve(router, http.MethodGet, path, "If-None-Match", `"stale"`)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != receipt.ETag() {
+		t.Fatalf("Stale ETag: got %d with ETag %q, want 200 with %s", w.Code, w.Header().Get("ETag"), receipt.ETag())
+	}
+	if peeked, _ := store.Peek(ephemeralKey); !peeked.IsCollected() {
+		t.Error("A stale ETag didn't collect the receipt")
+	}
+}
+
+func TestCollectHead(t *testing.T) {
+	h, store := newTestHandler(t)
+	router := collectRouter(h)
+	_, ephemeralKey := newTestKey(t)
+	path := "/collect/" + url.PathEscape(ephemeralKey)
+
+	w := serve(router, http.MethodHead, path)
+	if w.Code != http.StatusNotFound || w.Header().Get("Retry-After") != "" {
+		t.Errorf("Before submission without a hint: got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	receipt := storeTestReceipt(t, store, ephemeralKey, []byte("receipt"))
+	w = serve(router, http.MethodHead, path)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != receipt.ETag() || w.Header().Get(ReceiptIDHeader) != receipt.ReceiptID {
+		t.Errorf("After submission: got %d, ETag %q, receipt ID %q", w.Code, w.Header().Get("ETag"), w.Header().Get(ReceiptIDHeader))
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("HEAD answered with a body: %q", w.Body)
+	}
+	if peeked, _ := store.Peek(ephemeralKey); peeked.IsCollected() {
+		t.Error("HEAD collected the receipt")
+	}
+}
+
+func TestCollectRetryAfter(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.SetRetryAfter(1500 * time.Millisecond)
+	router := collectRouter(h)
+	_, ephemeralKey := newTestKey(t)
+	path := "/collect/" + url.PathEscape(ephemeralKey)
+
+	for _, tt := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, path, http.StatusNotFound},
+		{http.MethodHead, path, http.StatusNotFound},
+		{http.MethodGet, path + "/meta", http.StatusOK},
+	} {
+		w := serve(router, tt.method, tt.path)
+		// Rounded up to whole seconds
+		if w.Code != tt.status || w.Header().Get("Retry-After") != "2" {
+			t.Errorf("%s %s: got %d with Retry-After %q, want %d with 2", tt.method, tt.path, w.Code, w.Header().Get("Retry-After"), tt.status)
+		}
+	}
+}
+
+func TestCollectChecksProofBeforeETag(t *testing.T) {
+	h, store := newTestHandler(t)
+	h.SetPossession(storage.NewMemoryChallenges(), time.Minute, true)
+	router := collectRouter(h)
+	key, ephemeralKey := newTestKey(t)
+	receipt := storeTestReceipt(t, store, ephemeralKey, []byte("receipt"))
+	path := "/collect/" + url.PathEscape(ephemeralKey)
+
+	// Without the wallet's key the QR code reveals neither the receipt nor that it exists
+	for _, tt := range []struct {
+		method  string
+		headers []string
+	}{
+		{http.MethodHead, nil},
+		{http.MethodGet, []string{"If-None-Match", receipt.ETag()}},
+		{http.MethodGet, []string{"If-None-Match", "*"}},
+	} {
+		w := serve(router, tt.method, path, tt.headers...)
+		if w.Code != http.StatusUnauthorized || w.Header().Get("ETag") != "" || w.Header().Get(ReceiptIDHeader) != "" {
+			t.Errorf("%s %v without a proof: got %d, ETag %q, receipt ID %q", tt.method, tt.headers, w.Code, w.Header().Get("ETag"), w.Header().Get(ReceiptIDHeader))
+		}
+	}
+
+	if w := serve(router, http.MethodHead, path, proveHeaders(t, router, key, path)...); w.Code != http.StatusOK || w.Header().Get("ETag") != receipt.ETag() {
+		t.Errorf("HEAD with a proof: got %d, ETag %q", w.Code, w.Header().Get("ETag"))
+	}
+	headers := append(proveHeaders(t, router, key, path), "If-None-Match", receipt.ETag())
+	if w := serve(router, http.MethodGet, path, headers...); w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match with a proof: got %d, want 304", w.Code)
+	}
+}
+
+func TestCollectMetaTakesProof(t *testing.T) {
+	h, store := newTestHandler(t)
+	h.SetPossession(storage.NewMemoryChallenges(), time.Minute, true)
+	router := collectRouter(h)
+	key, ephemeralKey := newTestKey(t)
+	receipt := storeTestReceipt(t, store, ephemeralKey, []byte("receipt"))
+	path := "/collect/" + url.PathEscape(ephemeralKey)
+
+	if w := serve(router, http.MethodGet, path+"/meta"); w.Code != http.StatusUnauthorized || w.Header().Get("ETag") != "" {
+		t.Errorf("Without a proof: got %d with ETag %q, want 401", w.Code, w.Header().Get("ETag"))
+	}
+
+	w := serve(router, http.MethodGet, path+"/meta", proveHeaders(t, router, key, path)...)
+	var meta map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &meta); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("With a proof: got %d %s", w.Code, w.Body)
+	}
+	if meta["exists"] != true || meta["size_bytes"] != float64(len("receipt")) {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+	if _, named := meta["receipt_id"]; named || strings.Contains(w.Body.String(), receipt.ReceiptID) {
+		t.Errorf("Metadata names the receipt: %s", w.Body)
+	}
+}
+
+func TestChallengeRateLimited(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.SetPossession(storage.NewMemoryChallenges(), time.Minute, true)
+	h.SetRateLimits(0, 2)
+	router := collectRouter(h)
+	_, ephemeralKey := newTestKey(t)
+	path := "/collect/" + url.PathEscape(ephemeralKey) + "/challenge"
+
+	for i := 0; i < 2; i++ {
+		if w := serve(router, http.MethodPost, path); w.Code != http.StatusOK {
+			t.Fatalf("Challenge %d: got %d", i+1, w.Code)
+		}
+	}
+	if w := serve(router, http.MethodPost, path); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Over the limit: got %d with Retry-After %q, want 429", w.Code, w.Header().Get("Retry-After"))
+	}
+}
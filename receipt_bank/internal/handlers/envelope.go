@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"receipt-bank/internal/models"
+)
+
+// Receipt envelope layout: the sender's temporary public key as an uncompressed P-256 point,
+// the AES-GCM nonce, then the ciphertext followed by the GCM tag
+const (
+	envelopeKeySize   = 65
+	envelopeNonceSize = 12
+	envelopeTagSize   = 16
+
+	// MinEnvelopeSize is the size of an envelope around an empty plaintext
+	MinEnvelopeSize = envelopeKeySize + envelopeNonceSize + envelopeTagSize
+)
+
+// envelopeSettings bounds what /submit accepts as encrypted_data
+type envelopeSettings struct {
+	minBytes   int  // Smallest decoded payload (0 = any)
+	maxBytes   int  // Largest decoded payload (0 = only the body limit)
+	checkPoint bool // The payload must start with a valid uncompressed P-256 point
+}
+
+// SetEnvelopeLimits bounds the decoded size of encrypted_data and, with checkPoint, requires
+// it to begin with the sender's temporary P-256 key. The bank still can't decrypt anything;
+// this only turns away payloads that could never be a receipt envelope.
+func (h *Handler) SetEnvelopeLimits(minBytes, maxBytes int, checkPoint bool) {
+	h.envelope = envelopeSettings{minBytes: minBytes, maxBytes: maxBytes, checkPoint: checkPoint}
+}
+
+// checkEnvelope applies the envelope limits to a submission's encrypted_data, which
+// Validate has already found to be base64
+func (h *Handler) checkEnvelope(encryptedData string) *submitFailure {
+	limits := h.envelope
+	if limits == (envelopeSettings{}) {
+		return nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil {
+		return &submitFailure{http.StatusBadRequest, models.ErrorCodeInvalidRequest, "encrypted_data must be valid base64"}
+	}
+
+	if limits.maxBytes > 0 && len(data) > limits.maxBytes {
+		return &submitFailure{http.StatusRequestEntityTooLarge, models.ErrorCodePayloadTooLarge,
+			fmt.Sprintf("encrypted_data decodes to %d bytes, more than %d", len(data), limits.maxBytes)}
+	}
+	if len(data) < limits.minBytes {
+		return &submitFailure{http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			fmt.Sprintf("encrypted_data decodes to %d bytes, fewer than %d", len(data), limits.minBytes)}
+	}
+
+	if limits.checkPoint {
+		if len(data) < envelopeKeySize {
+			return &submitFailure{http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+				"encrypted_data is too short to hold the sender's temporary key"}
+		}
+		if _, err := ecdh.P256().NewPublicKey(data[:envelopeKeySize]); err != nil {
+			return &submitFailure{http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+				"encrypted_data must begin with an uncompressed P-256 public key"}
+		}
+	}
+	return nil
+}
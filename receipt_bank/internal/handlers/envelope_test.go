@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	rwcrypto "receiptwallet/crypto"
+
+	"receipt-bank/internal/models"
+)
+
+func TestCheckEnvelope(t *testing.T) {
+	key, _ := newTestKey(t)
+	envelope, err := rwcrypto.Encrypt([]byte("receipt"), &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The uncompressed point prefix, but coordinates off the curve
+	notAPoint := append([]byte{0x04}, bytes.Repeat([]byte{0xff}, envelopeKeySize-1)...)
+	notAPoint = append(notAPoint, envelope[envelopeKeySize:]...)
+	encode := base64.StdEncoding.EncodeToString
+
+	h := &Handler{}
+	h.SetEnvelopeLimits(MinEnvelopeSize, len(envelope), true)
+
+	for _, tt := range []struct {
+		name   string
+		data   string
+		status int
+		code   string
+	}{
+		{"a real envelope, at the maximum", encode(envelope), 0, ""},
+		{"over the maximum", encode(append(envelope, 0)), http.StatusRequestEntityTooLarge, models.ErrorCodePayloadTooLarge},
+		{"exactly the minimum", encode(envelope[:MinEnvelopeSize]), 0, ""},
+		{"under the minimum", encode(envelope[:MinEnvelopeSize-1]), http.StatusBadRequest, models.ErrorCodeInvalidRequest},
+		{"bad base64", "not base64!", http.StatusBadRequest, models.ErrorCodeInvalidRequest},
+		{"an invalid point", encode(notAPoint), http.StatusBadRequest, models.ErrorCodeInvalidRequest},
+	} {
+		failure := h.checkEnvelope(tt.data)
+		switch {
+		case tt.status == 0 && failure != nil:
+			t.Errorf("%s: refused with %d %s: %s", tt.name, failure.status, failure.code, failure.message)
+		case tt.status != 0 && failure == nil:
+			t.Errorf("%s: accepted, want %d %s", tt.name, tt.status, tt.code)
+		case tt.status != 0 && (failure.status != tt.status || failure.code != tt.code):
+			t.Errorf("%s: got %d %s, want %d %s", tt.name, failure.status, failure.code, tt.status, tt.code)
+		}
+	}
+}
+
+func TestCheckEnvelopeDisabled(t *testing.T) {
+	h := &Handler{}
+	if failure := h.checkEnvelope("not base64!"); failure != nil {
+		t.Errorf("Without limits: refused with %s", failure.message)
+	}
+
+	// Without the point check a short payload only needs to meet the size limits
+	h.SetEnvelopeLimits(1, 0, false)
+	if failure := h.checkEnvelope(base64.StdEncoding.EncodeToString([]byte("x"))); failure != nil {
+		t.Errorf("Without the point check: refused with %s", failure.message)
+	}
+	if failure := h.checkEnvelope(""); failure == nil {
+		t.Error("Accepted an empty payload under a 1-byte minimum")
+	}
+}
@@ -1,48 +1,163 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/gorilla/mux"
 
+	"receipt-bank/internal/accesslog"
+	"receipt-bank/internal/analytics"
+	"receipt-bank/internal/attestation"
 	"receipt-bank/internal/models"
+	"receipt-bank/internal/registers"
 	"receipt-bank/internal/storage"
 	"receipt-bank/internal/webhook"
 )
 
 // Handler contains dependencies for HTTP handlers
 type Handler struct {
-	storage       *storage.MemoryStorage
-	webhookClient *webhook.Client
-	verbose       bool
+	storage        storage.Storage
+	webhookClient  *webhook.Client
+	registers      *registers.Registry
+	attestation    *attestation.Verifier
+	maxTTL         time.Duration // Upper bound for a submission's ttl (0 = unbounded)
+	receiptFormats []int         // Binary receipt versions accepted (nil = any)
+	sockets        *socketSettings
+	possession     *possessionSettings
+	submitLimit    *rateLimiter  // Per register or client IP (nil = unlimited)
+	collectLimit   *rateLimiter  // Per client IP (nil = unlimited)
+	submitNetworks NetworkPolicy // Networks /submit is served to
+	retryAfter     time.Duration // Retry-After hint on /collect 404s (0 = none)
+	maxSubmitBytes int64         // Request body limits (0 = the default)
+	maxBatchBytes  int64
+	envelope       envelopeSettings   // encrypted_data size and structure checks
+	events         *analytics.Emitter // Anonymized analytics (nil = off)
+	snapshots      *storage.Snapshots // Snapshot and restore endpoints (nil = off)
+	health         HealthConfig       // Configuration summary for /health
+	adminToken     string             // Unlocks the /health config summary and deep checks ("" = nobody)
+	startedAt      time.Time
+	verbose        bool
 }
 
 // NewHandler creates a new handler instance
-func NewHandler(storage *storage.MemoryStorage, webhookClient *webhook.Client, verbose bool) *Handler {
+func NewHandler(storage storage.Storage, webhookClient *webhook.Client, verbose bool) *Handler {
 	return &Handler{
 		storage:       storage,
 		webhookClient: webhookClient,
+		startedAt:     time.Now(),
 		verbose:       verbose,
 	}
 }
 
+// SetRegisters requires /submit callers to authenticate as one of the registry's cash registers
+func (h *Handler) SetRegisters(registry *registers.Registry) {
+	h.registers = registry
+}
+
+// SetAttestation enables strict mode: submissions must carry a receipt hash signed by the revenue authority
+func (h *Handler) SetAttestation(verifier *attestation.Verifier) {
+	h.attestation = verifier
+}
+
+// SetAnalytics emits anonymized submission and collection events to an analytics pipeline
+func (h *Handler) SetAnalytics(events *analytics.Emitter) {
+	h.events = events
+}
+
+// SetMaxTTL bounds the ttl a submission may request
+func (h *Handler) SetMaxTTL(maxTTL time.Duration) {
+	h.maxTTL = maxTTL
+}
+
 // SubmitHandler handles POST /submit
 func (h *Handler) SubmitHandler(w http.ResponseWriter, r *http.Request) {
+	registerID, ok := h.authenticateRegister(w, r)
+	if !ok {
+		return
+	}
+	client := "ip:" + clientIP(r)
+	if registerID != "" {
+		client = "register:" + registerID
+	}
+	if !h.checkRate(w, r, h.submitLimit, client) {
+		return
+	}
+
 	var req models.SubmitRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+	if !h.decodeBody(w, r, &req) {
 		return
 	}
+	accesslog.SetReceiptID(r, req.ReceiptID)
 
-	if err := req.Validate(); err != nil {
-		h.writeError(w, http.StatusBadRequest, err.Error())
+	if failure := h.storeSubmission(&req, registerID); failure != nil {
+		h.writeError(w, r, failure.status, failure.code, failure.message)
 		return
 	}
 
+	// Return success response
+	resp := models.SubmitResponse{
+		ReceiptID: req.ReceiptID,
+	}
+
+	h.write(w, r, http.StatusOK, resp)
+}
+
+// submitFailure is why a submission was not stored, as the HTTP status and error /submit answers
+type submitFailure struct {
+	status  int
+	code    string
+	message string
+}
+
+// storeSubmission validates req and stores it as a receipt deposited by registerID,
+// shared by /submit and each entry of /submit/batch
+func (h *Handler) storeSubmission(req *models.SubmitRequest, registerID string) *submitFailure {
+	if err := models.ValidateEphemeralKey(req.EphemeralKey); err != nil {
+		return &submitFailure{http.StatusBadRequest, models.ErrorCodeInvalidKey, err.Error()}
+	}
+	if err := req.Validate(); err != nil {
+		return &submitFailure{http.StatusBadRequest, models.ErrorCodeInvalidRequest, err.Error()}
+	}
+	if failure := h.checkEnvelope(req.EncryptedData); failure != nil {
+		return failure
+	}
+
+	if h.attestation != nil {
+		if err := h.attestation.Verify(req.ReceiptHash, req.AuthoritySignature); err != nil {
+			if h.verbose {
+				log.Printf("[API] Rejected unattested receipt %s: %v", req.ReceiptID, err)
+			}
+			if errors.Is(err, attestation.ErrInvalid) {
+				return &submitFailure{http.StatusUnprocessableEntity, models.ErrorCodeInvalidAttestation, err.Error()}
+			}
+			return &submitFailure{http.StatusBadRequest, models.ErrorCodeInvalidAttestation, err.Error()}
+		}
+	}
+
+	if req.ReceiptFormat != 0 && !h.supportsFormat(req.ReceiptFormat) {
+		return &submitFailure{http.StatusUnprocessableEntity, models.ErrorCodeUnsupportedFormat,
+			fmt.Sprintf("receipt_format %d is not supported; see /version", req.ReceiptFormat)}
+	}
+
+	if h.maxTTL > 0 && req.TTL > int64(h.maxTTL/time.Second) {
+		return &submitFailure{http.StatusBadRequest, models.ErrorCodeInvalidRequest,
+			fmt.Sprintf("ttl must not exceed %d seconds", int64(h.maxTTL/time.Second))}
+	}
+
+	// A host that doesn't resolve now is left to the checks made when notifying
+	if err := h.webhookClient.CheckTarget(req.WebhookURL); errors.Is(err, webhook.ErrForbiddenTarget) {
+		return &submitFailure{http.StatusBadRequest, models.ErrorCodeInvalidRequest, "webhook_url: " + err.Error()}
+	}
+	if err := h.webhookClient.Verify(req.WebhookURL); err != nil {
+		return &submitFailure{http.StatusUnprocessableEntity, models.ErrorCodeWebhookUnverified, err.Error()}
+	}
+
 	// Create receipt
 	receipt := &models.Receipt{
 		EphemeralKey:  req.EphemeralKey,
@@ -50,62 +165,101 @@ func (h *Handler) SubmitHandler(w http.ResponseWriter, r *http.Request) {
 		ReceiptID:     req.ReceiptID,
 		WebhookURL:    req.WebhookURL,
 		Timestamp:     time.Now(),
+		RegisterID:    registerID,
+		TTL:           time.Duration(req.TTL) * time.Second,
 	}
 
 	// Store receipt
 	if err := h.storage.Store(receipt); err != nil {
-		if err.Error() == "receipt_id already exists" {
-			h.writeError(w, http.StatusConflict, "Receipt ID already exists")
-		} else {
-			h.writeError(w, http.StatusInternalServerError, "Failed to store receipt")
+		switch {
+		case errors.Is(err, storage.ErrReceiptExists):
+			return &submitFailure{http.StatusConflict, models.ErrorCodeDuplicateReceipt, "Receipt ID already exists"}
+		case errors.Is(err, storage.ErrUnavailable):
+			log.Printf("[API] Failed to store receipt %s: %v", req.ReceiptID, err)
+			return &submitFailure{http.StatusServiceUnavailable, models.ErrorCodeUnavailable, "Receipt storage temporarily unavailable"}
+		default:
+			return &submitFailure{http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to store receipt"}
 		}
-		return
 	}
 
-	if h.verbose {
-		log.Printf("[API] Receipt submitted successfully: %s", req.ReceiptID)
+	if h.registers != nil {
+		h.registers.RecordDeposit(registerID)
 	}
+	h.NotifySubmitted(receipt.EphemeralKey)
+	h.events.Submitted(receipt, req.ReceiptFormat)
 
-	// Return success response
-	resp := models.SubmitResponse{
-		ReceiptID: req.ReceiptID,
+	if h.verbose {
+		if registerID != "" {
+			log.Printf("[API] Receipt submitted successfully: %s (register %s)", req.ReceiptID, registerID)
+		} else {
+			log.Printf("[API] Receipt submitted successfully: %s", req.ReceiptID)
+		}
 	}
-
-	h.writeJSON(w, http.StatusOK, resp)
+	return nil
 }
 
 // CollectHandler handles GET /collect/{ephemeral_key}
 func (h *Handler) CollectHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.checkRate(w, r, h.collectLimit, clientIP(r)) {
+		return
+	}
+
 	vars := mux.Vars(r)
-	ephemeralKey := vars["ephemeral_key"]
+	ephemeralKey, err := url.PathUnescape(vars["ephemeral_key"])
+	if err != nil {
+		h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidKey, "ephemeral_key must be URL-encoded")
+		return
+	}
 
 	// Validate ephemeral key format
 	if err := models.ValidateEphemeralKey(ephemeralKey); err != nil {
-		h.writeError(w, http.StatusBadRequest, err.Error())
+		h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidKey, err.Error())
+		return
+	}
+
+	// The proof comes first so the ETag and 404s below reveal nothing to someone who only saw the QR code
+	if !h.checkPossession(w, r, ephemeralKey) {
+		return
+	}
+
+	// A wallet polling with the ETag it already holds is answered without a collection
+	if !h.checkNotModified(w, r, ephemeralKey) {
+		return
+	}
+
+	if prefersStream(r) && r.Header.Get("Range") != "" {
+		h.collectRange(w, r, ephemeralKey)
 		return
 	}
 
 	// Retrieve receipt
 	receipt, err := h.storage.Retrieve(ephemeralKey)
 	if err != nil {
-		if err.Error() == "receipt not found" {
-			h.writeError(w, http.StatusNotFound, "No receipt found for given ephemeral key")
-		} else {
-			h.writeError(w, http.StatusInternalServerError, "Failed to retrieve receipt")
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			h.writeNotFound(w, r)
+		case errors.Is(err, storage.ErrUnavailable):
+			log.Printf("[API] Failed to retrieve receipt: %v", err)
+			h.writeError(w, r, http.StatusServiceUnavailable, models.ErrorCodeUnavailable, "Receipt storage temporarily unavailable")
+		default:
+			h.writeError(w, r, http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to retrieve receipt")
 		}
 		return
 	}
 
 	if h.verbose {
-		log.Printf("[API] Receipt collected successfully: %s", receipt.ReceiptID)
+		log.Printf("[API] Receipt collected successfully: %s (collection #%d)", receipt.ReceiptID, receipt.CollectionCount)
 	}
 
-	// Send webhook notification (non-blocking)
-	go func() {
-		if err := h.webhookClient.NotifyCollection(receipt.WebhookURL, receipt.ReceiptID); err != nil {
-			log.Printf("[WEBHOOK] Failed to notify collection: %v", err)
-		}
-	}()
+	accesslog.SetReceiptID(r, receipt.ReceiptID)
+	h.notifyCollection(receipt)
+	h.events.Collected(receipt, analytics.ChannelHTTP)
+
+	w.Header().Set("ETag", receipt.ETag())
+	if prefersStream(r) {
+		h.writeStream(w, receipt)
+		return
+	}
 
 	// Return success response
 	resp := models.CollectResponse{
@@ -113,42 +267,48 @@ func (h *Handler) CollectHandler(w http.ResponseWriter, r *http.Request) {
 		ReceiptID:     receipt.ReceiptID,
 	}
 
-	h.writeJSON(w, http.StatusOK, resp)
+	h.write(w, r, http.StatusOK, resp)
 }
 
-// HealthHandler handles GET /health
-func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
-	total, expired := h.storage.Stats()
-
-	status := map[string]interface{}{
-		"status":           "healthy",
-		"receipts_stored":  total,
-		"receipts_expired": expired,
-		"timestamp":        time.Now().UTC().Format(time.RFC3339),
+// notifyCollection queues the webhook notification on first collection only (non-blocking)
+func (h *Handler) notifyCollection(receipt *models.Receipt) {
+	if receipt.CollectionCount != 1 {
+		return
+	}
+	err := h.webhookClient.Enqueue(receipt, func(err error) {
+		if err != nil {
+			log.Printf("[WEBHOOK] Failed to notify collection: %v", err)
+		}
+		h.storage.RecordWebhook(err == nil)
+	})
+	if err != nil {
+		log.Printf("[WEBHOOK] Failed to notify collection of %s: %v", receipt.ReceiptID, err)
+		h.storage.RecordWebhook(false)
 	}
-
-	h.writeJSON(w, http.StatusOK, status)
 }
 
-// writeJSON writes a JSON response
-func (h *Handler) writeJSON(w http.ResponseWriter, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
+// write encodes a response in the content type negotiated from the Accept header
+func (h *Handler) write(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	codec := responseCodec(r)
+	if codec == nil {
+		codec = codecs[0]
+	}
 
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("[ERROR] Failed to write JSON response: %v", err)
+	if err := writeWithCodec(w, codec, status, data); err != nil {
+		log.Printf("[ERROR] Failed to write %s response: %v", codec.ContentType(), err)
 	}
 }
 
 // writeError writes an error response
-func (h *Handler) writeError(w http.ResponseWriter, status int, message string) {
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
 	if h.verbose {
-		log.Printf("[API] Error %d: %s", status, message)
+		log.Printf("[API] Error %d %s: %s", status, code, message)
 	}
 
 	resp := models.ErrorResponse{
 		Error: message,
+		Code:  code,
 	}
 
-	h.writeJSON(w, status, resp)
+	h.write(w, r, status, resp)
 }
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	rwcrypto "receiptwallet/crypto"
+
+	"receipt-bank/internal/models"
+	"receipt-bank/internal/storage"
+	"receipt-bank/internal/webhook"
+)
+
+// newTestHandler returns a handler over memory storage that keeps collected receipts for an hour
+func newTestHandler(t *testing.T) (*Handler, *storage.MemoryStorage) {
+	t.Helper()
+	store := storage.NewMemoryStorage(time.Hour, time.Hour, false)
+	return NewHandler(store, webhook.NewClient(time.Second, 0, false), false), store
+}
+
+// collectRouter mounts the /collect endpoints the way the server does
+func collectRouter(h *Handler) *mux.Router {
+	router := mux.NewRouter().UseEncodedPath()
+	router.HandleFunc("/collect/{ephemeral_key}", h.CollectHandler).Methods("GET")
+	router.HandleFunc("/collect/{ephemeral_key}", h.CollectHeadHandler).Methods("HEAD")
+	router.HandleFunc("/collect/{ephemeral_key}/meta", h.CollectMetaHandler).Methods("GET")
+	router.HandleFunc("/collect/{ephemeral_key}/challenge", h.ChallengeHandler).Methods("POST")
+	return router
+}
+
+// newTestKey returns a wallet's ephemeral key pair and its base64 compressed public key
+func newTestKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := rwcrypto.CompressKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, base64.StdEncoding.EncodeToString(compressed)
+}
+
+// storeTestReceipt stores payload for ephemeralKey
+func storeTestReceipt(t *testing.T, store storage.Storage, ephemeralKey string, payload []byte) *models.Receipt {
+	t.Helper()
+	receipt := &models.Receipt{
+		EphemeralKey:  ephemeralKey,
+		EncryptedData: base64.StdEncoding.EncodeToString(payload),
+		ReceiptID:     "receipt-" + ephemeralKey[:8],
+		Timestamp:     time.Now(),
+	}
+	if err := store.Store(receipt); err != nil {
+		t.Fatal(err)
+	}
+	return receipt
+}
+
+// serve sends a request through router, setting the headers given as name/value pairs
+func serve(router http.Handler, method, path string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+// proveHeaders fetches a challenge for ephemeralKey and returns the proof headers
+// signed with key, as name/value pairs for serve
+func proveHeaders(t *testing.T, router http.Handler, key *ecdsa.PrivateKey, path string) []string {
+	t.Helper()
+	w := serve(router, http.MethodPost, path+"/challenge")
+	var challenge models.ChallengeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &challenge); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Challenge: %d %s", w.Code, w.Body)
+	}
+	nonce, _ := base64.StdEncoding.DecodeString(challenge.Nonce)
+	signature, err := rwcrypto.SignPossession(key, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []string{
+		PossessionNonceHeader, challenge.Nonce,
+		PossessionSignatureHeader, base64.StdEncoding.EncodeToString(signature),
+	}
+}
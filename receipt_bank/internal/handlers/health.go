@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"receipt-bank/internal/models"
+	"receipt-bank/internal/storage"
+)
+
+// HealthConfig summarizes the configuration reported at /health to admins, without secrets
+type HealthConfig struct {
+	Backend         string `json:"backend"`
+	MaxReceiptAge   string `json:"max_receipt_age"`
+	GracePeriod     string `json:"collection_grace_period"`
+	CleanupInterval string `json:"cleanup_interval"`
+	MaxReceipts     int    `json:"max_receipts,omitempty"`
+	Deduplicate     bool   `json:"deduplicate"`
+	RegisterAuth    bool   `json:"register_auth"`
+	StrictMode      bool   `json:"strict_mode"`
+	RequireProof    bool   `json:"require_proof"`
+	Analytics       bool   `json:"analytics"`
+	Snapshots       bool   `json:"snapshots"`
+	VerifyWebhooks  bool   `json:"verify_webhooks"`
+	PrivateWebhooks bool   `json:"private_webhooks"` // Webhooks may go to private and loopback addresses
+}
+
+// HealthCheck is the outcome of one active check of GET /health?deep=true
+type HealthCheck struct {
+	Name       string  `json:"name"`
+	OK         bool    `json:"ok"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// StorageHealth reports the storage backend and whether it answers
+type StorageHealth struct {
+	Backend   string   `json:"backend"`
+	Reachable bool     `json:"reachable"`
+	PingMs    *float64 `json:"ping_ms,omitempty"` // Shared backends only
+	Error     string   `json:"error,omitempty"`
+}
+
+// SetHealthConfig sets the configuration summary reported at /health
+func (h *Handler) SetHealthConfig(cfg HealthConfig) {
+	h.health = cfg
+}
+
+// HealthHandler handles GET /health. Besides the receipt counts it reports the
+// storage backend and its connectivity, the webhook backlog and the last cleanup
+// run. With the admin token it adds a configuration summary, and ?deep=true runs
+// active checks against storage and the snapshot directory, any failure of which
+// makes the instance unhealthy. Both would tell anyone how the bank is set up, or
+// let them make it touch its disk on every request.
+func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	deep, _ := strconv.ParseBool(r.URL.Query().Get("deep"))
+	admin := validAdminToken(r, h.adminToken)
+	if deep && !admin {
+		h.writeError(w, r, http.StatusUnauthorized, models.ErrorCodeUnauthorized, "Deep health checks require the admin token")
+		return
+	}
+
+	// A shared backend that can't be reached makes this instance unhealthy,
+	// so a load balancer stops routing to it
+	backend := StorageHealth{Backend: h.health.Backend, Reachable: true}
+	if pinger, ok := h.storage.(interface{ Ping() error }); ok {
+		started := time.Now()
+		err := pinger.Ping()
+		ms := milliseconds(time.Since(started))
+		backend.PingMs = &ms
+		if err != nil {
+			backend.Reachable = false
+			backend.Error = err.Error()
+		}
+	}
+
+	status := map[string]interface{}{
+		"status":         "healthy",
+		"storage":        backend,
+		"webhooks":       h.webhookClient.Stats(),
+		"uptime_seconds": int64(time.Since(h.startedAt).Seconds()),
+		"timestamp":      time.Now().UTC().Format(time.RFC3339),
+	}
+	if admin {
+		status["config"] = h.healthConfig()
+	}
+	if !backend.Reachable {
+		status["status"] = "unhealthy"
+		status["error"] = backend.Error
+		h.write(w, r, http.StatusServiceUnavailable, status)
+		return
+	}
+
+	stats := h.storage.Stats()
+	status["receipts_stored"] = stats.Total
+	status["receipts_expired"] = stats.Expired
+	status["receipts_in_grace"] = stats.Collected
+	status["recollections"] = stats.Recollections
+	status["receipts_purged"] = stats.Purged
+	if dedup := h.storage.DedupStats(); dedup != nil {
+		status["deduplication"] = dedup
+	}
+	cleanup := h.storage.CleanupStats()
+	status["cleanup"] = map[string]interface{}{
+		"runs":     cleanup.Runs,
+		"last_run": cleanup.LastRun,
+	}
+
+	if deep {
+		checks := h.deepChecks()
+		status["checks"] = checks
+		for _, check := range checks {
+			if !check.OK {
+				status["status"] = "unhealthy"
+				h.write(w, r, http.StatusServiceUnavailable, status)
+				return
+			}
+		}
+	}
+
+	h.write(w, r, http.StatusOK, status)
+}
+
+// healthConfig completes the configuration summary with the features enabled on the handler
+func (h *Handler) healthConfig() HealthConfig {
+	cfg := h.health
+	cfg.RegisterAuth = h.registers != nil
+	cfg.StrictMode = h.attestation != nil
+	cfg.RequireProof = h.possession != nil && h.possession.required
+	cfg.Analytics = h.events != nil
+	cfg.Snapshots = h.snapshots != nil
+	cfg.VerifyWebhooks = h.webhookClient.VerificationEnabled()
+	cfg.PrivateWebhooks = !h.webhookClient.TargetsRestricted()
+	return cfg
+}
+
+// deepChecks exercises the storage read path with a key no receipt can have and,
+// when snapshots are on, writes a probe file next to the snapshot
+func (h *Handler) deepChecks() []HealthCheck {
+	probe := make([]byte, 16)
+	rand.Read(probe)
+
+	checks := []HealthCheck{runCheck("storage_read", func() error {
+		_, err := h.storage.Peek("health-probe-" + hex.EncodeToString(probe))
+		if err == nil || errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		return err
+	})}
+	if h.snapshots != nil {
+		checks = append(checks, runCheck("snapshot_directory", h.snapshots.CheckWritable))
+	}
+	return checks
+}
+
+// runCheck times one active health check
+func runCheck(name string, check func() error) HealthCheck {
+	started := time.Now()
+	err := check()
+	result := HealthCheck{Name: name, OK: err == nil, DurationMs: milliseconds(time.Since(started))}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// milliseconds converts d to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestHealthDetailsNeedAdminToken(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.SetAdminToken("secret")
+	health := http.HandlerFunc(h.HealthHandler)
+
+	w := serve(health, "GET", "/health")
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Plain /health: %d %s", w.Code, w.Body)
+	}
+	if _, found := body["config"]; found {
+		t.Error("Plain /health reported the configuration")
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if w := serve(health, "GET", "/health?deep=true", AdminTokenHeader, token); w.Code != http.StatusUnauthorized {
+			t.Errorf("Deep checks with token %q: got %d, want 401", token, w.Code)
+		}
+	}
+
+	w = serve(health, "GET", "/health?deep=true", AdminTokenHeader, "secret")
+	body = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Deep checks with the admin token: %d %s", w.Code, w.Body)
+	}
+	for _, field := range []string{"config", "checks"} {
+		if _, found := body[field]; !found {
+			t.Errorf("Admin /health?deep=true is missing %s", field)
+		}
+	}
+
+	// Without the admin API nobody can run them
+	h.SetAdminToken("")
+	if w := serve(health, "GET", "/health?deep=true", AdminTokenHeader, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Deep checks with the admin API off: got %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"receipt-bank/internal/models"
+)
+
+// APIVersion is the current receipt bank protocol version, served under /v1
+const APIVersion = "1"
+
+// Version headers returned on every response so clients can detect capabilities
+const (
+	VersionHeader      = "X-Receipt-Bank-API-Version"
+	CapabilitiesHeader = "X-Receipt-Bank-Capabilities"
+)
+
+// StreamContentType is the raw media type /collect can serve instead of a codec,
+// returning the encrypted bytes as the body and the metadata in headers
+const StreamContentType = "application/octet-stream"
+
+// Codec encodes and decodes API payloads for one media type
+type Codec interface {
+	ContentType() string
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+// jsonCodec is the default codec
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Encode(w io.Writer, v interface{}) error { return json.NewEncoder(w).Encode(v) }
+
+// Decode refuses fields the target doesn't have and anything after the value, so a
+// misspelled or mislabelled payload fails instead of being silently half-read
+func (jsonCodec) Decode(r io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
+
+// errTrailingData is returned by Decode when the body continues after the JSON value
+var errTrailingData = errors.New("data after the JSON value")
+
+// codecs lists supported codecs in order of server preference; the first is the default.
+// Add new media types (e.g. CBOR) here.
+var codecs = []Codec{jsonCodec{}}
+
+// RegisterCodec adds a codec for content negotiation
+func RegisterCodec(c Codec) {
+	codecs = append(codecs, c)
+}
+
+// SupportedContentTypes returns the media types the API can produce and consume
+func SupportedContentTypes() []string {
+	types := make([]string, len(codecs))
+	for i, c := range codecs {
+		types[i] = c.ContentType()
+	}
+	return types
+}
+
+// VersionMiddleware advertises the API version and supported media types
+func VersionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(VersionHeader, APIVersion)
+		w.Header().Set(CapabilitiesHeader, "codecs="+strings.Join(SupportedContentTypes(), ",")+"; stream="+StreamContentType)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NegotiationMiddleware rejects requests whose Accept header matches no codec (406)
+// or whose body uses an unsupported Content-Type (415).
+func NegotiationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if responseCodec(r) == nil && !prefersStream(r) {
+			writeWithCodec(w, codecs[0], http.StatusNotAcceptable, models.ErrorResponse{Error: "No acceptable content type; supported: " + strings.Join(SupportedContentTypes(), ", "), Code: models.ErrorCodeUnsupportedFormat})
+			return
+		}
+		if r.ContentLength != 0 && r.Header.Get("Content-Type") != "" && requestCodec(r) == nil {
+			writeWithCodec(w, codecs[0], http.StatusUnsupportedMediaType, models.ErrorResponse{Error: "Unsupported Content-Type; supported: " + strings.Join(SupportedContentTypes(), ", "), Code: models.ErrorCodeUnsupportedFormat})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestCodec picks the codec for the request body from Content-Type (default JSON)
+func requestCodec(r *http.Request) Codec {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return codecs[0]
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	for _, c := range codecs {
+		if c.ContentType() == mediaType {
+			return c
+		}
+	}
+	return nil
+}
+
+// responseCodec picks the codec for the response from Accept, or nil if none is acceptable
+func responseCodec(r *http.Request) Codec {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return codecs[0]
+	}
+
+	for _, mediaRange := range parseAccept(accept) {
+		for _, c := range codecs {
+			if mediaMatches(mediaRange, c.ContentType()) {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// prefersStream reports whether Accept ranks the raw stream type above every codec.
+// Wildcards select a codec, so clients must ask for the stream explicitly.
+func prefersStream(r *http.Request) bool {
+	for _, mediaRange := range parseAccept(r.Header.Get("Accept")) {
+		if mediaRange == StreamContentType {
+			return true
+		}
+		for _, c := range codecs {
+			if mediaMatches(mediaRange, c.ContentType()) {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// parseAccept returns media ranges with q > 0, highest quality first
+func parseAccept(accept string) []string {
+	type weighted struct {
+		mediaRange string
+		q          float64
+	}
+	var ranges []weighted
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, weighted{mediaType, q})
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	result := make([]string, len(ranges))
+	for i, w := range ranges {
+		result[i] = w.mediaRange
+	}
+	return result
+}
+
+func mediaMatches(mediaRange, contentType string) bool {
+	if mediaRange == "*/*" || mediaRange == contentType {
+		return true
+	}
+	if strings.HasSuffix(mediaRange, "/*") {
+		return strings.HasPrefix(contentType, strings.TrimSuffix(mediaRange, "*"))
+	}
+	return false
+}
+
+func writeWithCodec(w http.ResponseWriter, c Codec, status int, data interface{}) error {
+	w.Header().Set("Content-Type", c.ContentType())
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	return c.Encode(w, data)
+}
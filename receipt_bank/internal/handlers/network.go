@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"receipt-bank/internal/models"
+)
+
+// NetworkPolicy restricts /submit to the networks cash registers deposit from, e.g. the
+// store LAN. /collect stays open: wallets collect from wherever their owner is.
+type NetworkPolicy struct {
+	Allowed        []netip.Prefix // Networks /submit is served to (empty = any)
+	TrustedProxies []netip.Prefix // Reverse proxies whose X-Forwarded-For names the client
+}
+
+// ParseNetworks parses networks given as CIDR prefixes or single addresses
+func ParseNetworks(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: want an address or CIDR prefix", entry)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// ClientAddr returns the address a request came from. A peer that is a trusted proxy
+// speaks for the rightmost X-Forwarded-For entry that is not itself a trusted proxy;
+// entries to its left were written by the client and are not believed. It returns false
+// when a proxy forwarded an address that does not parse.
+func (p NetworkPolicy) ClientAddr(r *http.Request) (netip.Addr, bool) {
+	addr, ok := parseAddr(r.RemoteAddr)
+	if !ok || !contains(p.TrustedProxies, addr) {
+		return addr, ok
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if addr, ok = parseAddr(strings.TrimSpace(hops[i])); !ok {
+			return netip.Addr{}, false
+		}
+		if !contains(p.TrustedProxies, addr) {
+			break
+		}
+	}
+	// Only trusted proxies: the leftmost of them is the client
+	return addr, true
+}
+
+// Permits reports whether r may call /submit
+func (p NetworkPolicy) Permits(r *http.Request) bool {
+	if len(p.Allowed) == 0 {
+		return true
+	}
+	addr, ok := p.ClientAddr(r)
+	return ok && contains(p.Allowed, addr)
+}
+
+// SetSubmitNetworks restricts /submit and /submit/batch to policy's allowed networks
+func (h *Handler) SetSubmitNetworks(policy NetworkPolicy) {
+	h.submitNetworks = policy
+}
+
+// SubmitNetworks rejects submissions from outside the allowed networks with 403 FORBIDDEN,
+// before the body is read or the register authenticated
+func (h *Handler) SubmitNetworks(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.submitNetworks.Permits(r) {
+			if h.verbose {
+				log.Printf("[AUTH] Rejected submission from %s (X-Forwarded-For %q) outside the allowed networks",
+					r.RemoteAddr, r.Header.Values("X-Forwarded-For"))
+			}
+			h.writeError(w, r, http.StatusForbidden, models.ErrorCodeForbidden, "Submissions are not accepted from this network")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseAddr reads an address with or without a port
+func parseAddr(s string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(s)
+	return addr.Unmap(), err == nil
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNetworkPolicyClientAddr(t *testing.T) {
+	allowed, err := ParseNetworks([]string{"192.168.1.0/24", "2001:db8::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxies, err := ParseNetworks([]string{"10.0.0.1", "10.0.0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := NetworkPolicy{Allowed: allowed, TrustedProxies: proxies}
+
+	for _, tt := range []struct {
+		remote    string
+		forwarded []string
+		client    string
+		permitted bool
+	}{
+		{"192.168.1.20:5123", nil, "192.168.1.20", true},
+		{"[::ffff:192.168.1.20]:5123", nil, "192.168.1.20", true},
+		{"[2001:db8::1]:443", nil, "2001:db8::1", true},
+		{"203.0.113.9:5123", nil, "203.0.113.9", false},
+		// Only a trusted proxy's X-Forwarded-For counts
+		{"203.0.113.9:5123", []string{"192.168.1.20"}, "203.0.113.9", false},
+		{"10.0.0.1:80", []string{"192.168.1.20"}, "192.168.1.20", true},
+		{"10.0.0.1:80", []string{"203.0.113.9"}, "203.0.113.9", false},
+		// Entries left of the first untrusted one are the client's own claims
+		{"10.0.0.1:80", []string{"192.168.1.20, 203.0.113.9"}, "203.0.113.9", false},
+		{"10.0.0.1:80", []string{"203.0.113.9, 192.168.1.20, 10.0.0.2"}, "192.168.1.20", true},
+		{"10.0.0.1:80", []string{"203.0.113.9", "192.168.1.20"}, "192.168.1.20", true},
+		{"10.0.0.1:80", nil, "10.0.0.1", false},
+		{"10.0.0.1:80", []string{"not-an-address"}, "", false},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/v1/submit", nil)
+		r.RemoteAddr = tt.remote
+		for _, header := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", header)
+		}
+
+		client, ok := policy.ClientAddr(r)
+		if got := client.String(); ok && got != tt.client || !ok && tt.client != "" {
+			t.Errorf("%s %v: client %s (%v), want %s", tt.remote, tt.forwarded, got, ok, tt.client)
+		}
+		if got := policy.Permits(r); got != tt.permitted {
+			t.Errorf("%s %v: Permits = %v, want %v", tt.remote, tt.forwarded, got, tt.permitted)
+		}
+	}
+
+	if !(NetworkPolicy{}).Permits(httptest.NewRequest(http.MethodPost, "/v1/submit", nil)) {
+		t.Error("Expected an empty allow-list to permit any network")
+	}
+	if _, err := ParseNetworks([]string{"192.168.1.0/33"}); err == nil {
+		t.Error("Expected an invalid prefix to be refused")
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	rwcrypto "receiptwallet/crypto"
+
+	"receipt-bank/internal/models"
+	"receipt-bank/internal/storage"
+)
+
+// Headers carrying a proof of possession on GET /collect
+const (
+	PossessionNonceHeader     = "X-Possession-Nonce"
+	PossessionSignatureHeader = "X-Possession-Signature"
+)
+
+// possessionSettings configures proofs of possession on /collect
+type possessionSettings struct {
+	challenges storage.ChallengeStore
+	ttl        time.Duration
+	required   bool
+}
+
+// SetPossession enables POST /collect/{ephemeral_key}/challenge. Proofs sent with
+// /collect are always checked; when required, /collect without one is refused, so
+// someone who only saw the QR code can't collect the receipt.
+func (h *Handler) SetPossession(challenges storage.ChallengeStore, ttl time.Duration, required bool) {
+	h.possession = &possessionSettings{
+		challenges: challenges,
+		ttl:        ttl,
+		required:   required,
+	}
+}
+
+// proofOfPossession is the /collect policy advertised at /version
+func (h *Handler) proofOfPossession() string {
+	if h.possession != nil && h.possession.required {
+		return "required"
+	}
+	return "optional"
+}
+
+// ChallengeHandler handles POST /collect/{ephemeral_key}/challenge
+func (h *Handler) ChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	if h.possession == nil {
+		h.writeError(w, r, http.StatusNotFound, models.ErrorCodeNotFound, "Proof of possession is not enabled")
+		return
+	}
+	if !h.checkRate(w, r, h.collectLimit, clientIP(r)) {
+		return
+	}
+
+	ephemeralKey, _, ok := h.publicKeyParam(w, r)
+	if !ok {
+		return
+	}
+
+	nonce, err := rwcrypto.NewPossessionNonce()
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to create challenge")
+		return
+	}
+	err = h.possession.challenges.IssueChallenge(ephemeralKey, nonce, h.possession.ttl)
+	if errors.Is(err, storage.ErrTooManyChallenges) {
+		log.Printf("[API] Refused challenge: %v", err)
+		w.Header().Set("Retry-After", strconv.Itoa(int(h.possession.ttl/time.Second)))
+		h.writeError(w, r, http.StatusServiceUnavailable, models.ErrorCodeUnavailable, "Too many outstanding challenges, try again shortly")
+		return
+	}
+	if err != nil {
+		log.Printf("[API] Failed to store challenge: %v", err)
+		h.writeError(w, r, http.StatusServiceUnavailable, models.ErrorCodeUnavailable, "Receipt storage temporarily unavailable")
+		return
+	}
+
+	h.write(w, r, http.StatusOK, models.ChallengeResponse{
+		Nonce:     base64.StdEncoding.EncodeToString(nonce),
+		ExpiresIn: int64(h.possession.ttl / time.Second),
+	})
+}
+
+// checkPossession verifies the proof sent with a /collect request and redeems its
+// nonce. It answers the request itself and returns false when collection must stop.
+func (h *Handler) checkPossession(w http.ResponseWriter, r *http.Request, ephemeralKey string) bool {
+	if h.possession == nil {
+		return true
+	}
+
+	nonceHeader := r.Header.Get(PossessionNonceHeader)
+	signatureHeader := r.Header.Get(PossessionSignatureHeader)
+	if nonceHeader == "" && signatureHeader == "" {
+		if h.possession.required {
+			h.writeError(w, r, http.StatusUnauthorized, models.ErrorCodeUnauthorized, "Proof of possession required: sign a nonce from POST /collect/{ephemeral_key}/challenge")
+			return false
+		}
+		return true
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(nonceHeader)
+	if err != nil || len(nonce) != rwcrypto.PossessionNonceSize {
+		h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidRequest, PossessionNonceHeader+" must be a base64 challenge nonce")
+		return false
+	}
+	signature, err := base64.StdEncoding.DecodeString(signatureHeader)
+	if err != nil {
+		h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidRequest, PossessionSignatureHeader+" must be base64")
+		return false
+	}
+
+	compressedKey, _ := base64.StdEncoding.DecodeString(ephemeralKey)
+	if err := rwcrypto.VerifyPossession(compressedKey, nonce, signature); err != nil {
+		if h.verbose {
+			log.Printf("[API] Rejected collection: %v", err)
+		}
+		h.writeError(w, r, http.StatusForbidden, models.ErrorCodeForbidden, "Proof of possession failed")
+		return false
+	}
+
+	// Redeem only valid proofs, so a forged one can't burn the wallet's nonce
+	redeemed, err := h.possession.challenges.RedeemChallenge(ephemeralKey, nonce)
+	switch {
+	case errors.Is(err, storage.ErrUnavailable):
+		log.Printf("[API] Failed to redeem challenge: %v", err)
+		h.writeError(w, r, http.StatusServiceUnavailable, models.ErrorCodeUnavailable, "Receipt storage temporarily unavailable")
+		return false
+	case err != nil:
+		h.writeError(w, r, http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to redeem challenge")
+		return false
+	case !redeemed:
+		h.writeError(w, r, http.StatusForbidden, models.ErrorCodeForbidden, "Challenge is unknown, expired or already used")
+		return false
+	}
+	return true
+}
+
+// publicKeyParam reads the {ephemeral_key} path parameter of endpoints that verify
+// signatures, which additionally need it to be a valid P-256 public key
+func (h *Handler) publicKeyParam(w http.ResponseWriter, r *http.Request) (string, []byte, bool) {
+	ephemeralKey, err := url.PathUnescape(mux.Vars(r)["ephemeral_key"])
+	if err != nil {
+		h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidKey, "ephemeral_key must be URL-encoded")
+		return "", nil, false
+	}
+	if err := models.ValidateEphemeralKey(ephemeralKey); err != nil {
+		h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidKey, err.Error())
+		return "", nil, false
+	}
+	compressedKey, _ := base64.StdEncoding.DecodeString(ephemeralKey)
+	if _, err := rwcrypto.DecompressKey(compressedKey); err != nil {
+		h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidKey, "ephemeral_key is not a P-256 public key")
+		return "", nil, false
+	}
+	return ephemeralKey, compressedKey, true
+}
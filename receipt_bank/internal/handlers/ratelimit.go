@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"receipt-bank/internal/models"
+)
+
+// rateLimiter counts requests per client in fixed one-minute windows
+type rateLimiter struct {
+	perMinute int
+
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+	now     func() time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{
+		perMinute: perMinute,
+		windows:   make(map[string]*rateWindow),
+		now:       time.Now,
+	}
+}
+
+// allow records a request from client and returns how long to wait when it is over the limit
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	admitted, wait := l.allowN(client, 1)
+	return admitted == 1, wait
+}
+
+// allowN records up to n requests from client, as many as the current window has room
+// for, and returns how many it admitted and how long the rest have to wait
+func (l *rateLimiter) allowN(client string, n int) (int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	start := now.Truncate(time.Minute)
+
+	window, exists := l.windows[client]
+	if !exists || window.start.Before(start) {
+		window = &rateWindow{start: start}
+		l.windows[client] = window
+	}
+	admitted := min(n, l.perMinute-window.count)
+	window.count += admitted
+	if admitted < n {
+		return admitted, start.Add(time.Minute).Sub(now)
+	}
+	return admitted, 0
+}
+
+// sweep drops the counters of windows that have ended and returns how many it dropped
+func (l *rateLimiter) sweep() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	start := l.now().Truncate(time.Minute)
+	dropped := 0
+	for client, window := range l.windows {
+		if window.start.Before(start) {
+			delete(l.windows, client)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// SetRateLimits limits /submit per cash register (per client IP without register
+// authentication) and /collect per client IP to the given requests per minute. 0 disables a limit.
+func (h *Handler) SetRateLimits(submitPerMinute, collectPerMinute int) {
+	h.submitLimit, h.collectLimit = nil, nil
+	if submitPerMinute > 0 {
+		h.submitLimit = newRateLimiter(submitPerMinute)
+	}
+	if collectPerMinute > 0 {
+		h.collectLimit = newRateLimiter(collectPerMinute)
+	}
+}
+
+// StartRateLimitSweep drops ended rate-limit windows every interval, so clients
+// that stopped sending don't keep their counters
+func (h *Handler) StartRateLimitSweep(interval time.Duration) {
+	limiters := []*rateLimiter{h.submitLimit, h.collectLimit}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			for _, limiter := range limiters {
+				if limiter != nil {
+					limiter.sweep()
+				}
+			}
+		}
+	}()
+}
+
+// checkRate writes 429 RATE_LIMITED with Retry-After when client is over limiter's limit
+func (h *Handler) checkRate(w http.ResponseWriter, r *http.Request, limiter *rateLimiter, client string) bool {
+	if limiter == nil {
+		return true
+	}
+
+	allowed, wait := limiter.allow(client)
+	if allowed {
+		return true
+	}
+
+	h.writeRateLimited(w, r, limiter, wait)
+	return false
+}
+
+// writeRateLimited writes 429 RATE_LIMITED with Retry-After set to wait
+func (h *Handler) writeRateLimited(w http.ResponseWriter, r *http.Request, limiter *rateLimiter, wait time.Duration) {
+	retryAfter := retryAfterSeconds(wait)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	h.writeError(w, r, http.StatusTooManyRequests, models.ErrorCodeRateLimited, rateLimitMessage(limiter, retryAfter))
+}
+
+// retryAfterSeconds rounds wait to whole seconds, at least one
+func retryAfterSeconds(wait time.Duration) int {
+	return max(int(wait.Seconds()+0.5), 1)
+}
+
+func rateLimitMessage(limiter *rateLimiter, retryAfter int) string {
+	return fmt.Sprintf("Rate limit of %d requests per minute exceeded, retry after %d seconds", limiter.perMinute, retryAfter)
+}
+
+// clientIP is the address a request came from, the rate limit key for unauthenticated clients
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
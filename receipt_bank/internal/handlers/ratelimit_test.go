@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWindows(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 30, 0, time.UTC)
+	limiter := newRateLimiter(2)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.allow("a"); !allowed {
+			t.Fatalf("Request %d refused under the limit", i+1)
+		}
+	}
+	allowed, wait := limiter.allow("a")
+	if allowed || wait != 30*time.Second {
+		t.Fatalf("Third request: allowed %v, wait %v; want refused with 30s to wait", allowed, wait)
+	}
+	if allowed, _ := limiter.allow("b"); !allowed {
+		t.Error("Another client shares the first one's counter")
+	}
+
+	// Nothing has ended yet
+	if dropped := limiter.sweep(); dropped != 0 {
+		t.Errorf("Swept %d windows during their minute", dropped)
+	}
+
+	// A new minute starts a new window, even before the sweep
+	now = now.Add(time.Minute)
+	if allowed, _ := limiter.allow("a"); !allowed {
+		t.Error("Request refused in a new minute")
+	}
+	if dropped := limiter.sweep(); dropped != 1 {
+		t.Errorf("Swept %d windows, want b's ended one", dropped)
+	}
+	if _, kept := limiter.windows["a"]; !kept {
+		t.Error("Swept the current window")
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"receipt-bank/internal/models"
+	"receipt-bank/internal/storage"
+)
+
+// MaxSnapshotBytes bounds an uploaded snapshot, a few hundred thousand receipts
+const MaxSnapshotBytes = 1 << 30
+
+// SetSnapshots enables the snapshot and restore admin endpoints
+func (h *Handler) SetSnapshots(snapshots *storage.Snapshots) {
+	h.snapshots = snapshots
+}
+
+// SaveSnapshotHandler handles POST /admin/snapshot and writes the snapshot file now
+func (h *Handler) SaveSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if h.snapshots == nil {
+		h.writeError(w, r, http.StatusNotFound, models.ErrorCodeNotFound, "Snapshots are not enabled")
+		return
+	}
+
+	info, err := h.snapshots.Save()
+	if err != nil {
+		log.Printf("[ADMIN] Snapshot failed: %v", err)
+		h.writeError(w, r, http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to write snapshot")
+		return
+	}
+	log.Printf("[ADMIN] Wrote snapshot of %d receipt(s) to %s", info.Receipts, info.File)
+	h.write(w, r, http.StatusOK, info)
+}
+
+// DownloadSnapshotHandler handles GET /admin/snapshot and returns a fresh encrypted
+// snapshot as the body, for moving the receipts to another instance
+func (h *Handler) DownloadSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if h.snapshots == nil {
+		h.writeError(w, r, http.StatusNotFound, models.ErrorCodeNotFound, "Snapshots are not enabled")
+		return
+	}
+
+	data, snapshot, err := h.snapshots.Export()
+	if err != nil {
+		log.Printf("[ADMIN] Snapshot export failed: %v", err)
+		h.writeError(w, r, http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to export snapshot")
+		return
+	}
+	log.Printf("[ADMIN] Exported snapshot of %d receipt(s)", len(snapshot.Receipts))
+
+	w.Header().Set("Content-Type", StreamContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="receipts-%s.snapshot"`, snapshot.CreatedAt.Format("20060102-150405")))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// RestoreSnapshotHandler handles POST /admin/snapshot/restore. The body is an encrypted
+// snapshot (application/octet-stream); without a body the snapshot file is restored.
+func (h *Handler) RestoreSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if h.snapshots == nil {
+		h.writeError(w, r, http.StatusNotFound, models.ErrorCodeNotFound, "Snapshots are not enabled")
+		return
+	}
+	if r.ContentLength > MaxSnapshotBytes {
+		h.writeError(w, r, http.StatusRequestEntityTooLarge, models.ErrorCodePayloadTooLarge, fmt.Sprintf("Snapshot exceeds %d bytes", int64(MaxSnapshotBytes)))
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxSnapshotBytes))
+	if err != nil {
+		h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidRequest, "Failed to read snapshot")
+		return
+	}
+
+	started := time.Now()
+	var result storage.RestoreResult
+	if len(data) == 0 {
+		result, err = h.snapshots.Load()
+	} else {
+		result, err = h.snapshots.Import(data)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNoSnapshot):
+			h.writeError(w, r, http.StatusNotFound, models.ErrorCodeNotFound, "No snapshot file to restore")
+		case errors.Is(err, storage.ErrSnapshotKey), errors.Is(err, storage.ErrSnapshotFormat):
+			h.writeError(w, r, http.StatusBadRequest, models.ErrorCodeInvalidRequest, err.Error())
+		default:
+			log.Printf("[ADMIN] Restore failed: %v", err)
+			h.writeError(w, r, http.StatusInternalServerError, models.ErrorCodeInternal, "Failed to restore snapshot")
+		}
+		return
+	}
+
+	log.Printf("[ADMIN] Restored %d receipt(s) in %v (%d expired, %d already stored)",
+		result.Restored, time.Since(started), result.Expired, result.Existing)
+	h.write(w, r, http.StatusOK, result)
+}
+
+// CompactHandler handles POST /admin/compact and rebuilds the in-memory indexes
+func (h *Handler) CompactHandler(w http.ResponseWriter, r *http.Request) {
+	compactor, ok := h.storage.(storage.Snapshotter)
+	if !ok {
+		h.writeError(w, r, http.StatusNotFound, models.ErrorCodeNotFound, "The storage backend needs no compaction")
+		return
+	}
+	h.write(w, r, http.StatusOK, compactor.Compact())
+}
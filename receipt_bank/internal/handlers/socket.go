@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	rwcrypto "receiptwallet/crypto"
+
+	"receipt-bank/internal/accesslog"
+	"receipt-bank/internal/analytics"
+	"receipt-bank/internal/models"
+	"receipt-bank/internal/storage"
+)
+
+const (
+	socketWriteWait    = 10 * time.Second
+	socketPingInterval = 30 * time.Second // Also re-checks storage in case a wake-up was missed
+)
+
+// Wallets authenticate by proof of possession rather than by origin, so native
+// apps and pages on any origin may connect
+var socketUpgrader = websocket.Upgrader{
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// socketSettings configures push collection
+type socketSettings struct {
+	challengeTimeout time.Duration
+	waitTimeout      time.Duration
+	hub              *submissionHub
+}
+
+// submissionHub wakes collection sockets waiting for a receipt under an ephemeral key
+type submissionHub struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]bool
+}
+
+func (hub *submissionHub) wait(ephemeralKey string) chan struct{} {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	wake := make(chan struct{}, 1)
+	if hub.waiters[ephemeralKey] == nil {
+		hub.waiters[ephemeralKey] = make(map[chan struct{}]bool)
+	}
+	hub.waiters[ephemeralKey][wake] = true
+	return wake
+}
+
+func (hub *submissionHub) cancel(ephemeralKey string, wake chan struct{}) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	delete(hub.waiters[ephemeralKey], wake)
+	if len(hub.waiters[ephemeralKey]) == 0 {
+		delete(hub.waiters, ephemeralKey)
+	}
+}
+
+func (hub *submissionHub) notify(ephemeralKey string) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	for wake := range hub.waiters[ephemeralKey] {
+		select {
+		case wake <- struct{}{}:
+		default: // Already woken
+		}
+	}
+}
+
+// EnableSockets turns on push collection at /ws/collect/{ephemeral_key}. The wallet has
+// challengeTimeout to prove it holds the ephemeral key; the socket then stays open until
+// the receipt arrives or waitTimeout elapses.
+func (h *Handler) EnableSockets(challengeTimeout, waitTimeout time.Duration) {
+	h.sockets = &socketSettings{
+		challengeTimeout: challengeTimeout,
+		waitTimeout:      waitTimeout,
+		hub:              &submissionHub{waiters: make(map[string]map[chan struct{}]bool)},
+	}
+}
+
+// NotifySubmitted wakes sockets waiting for ephemeralKey. Shared storage backends
+// call it for receipts submitted through other instances.
+func (h *Handler) NotifySubmitted(ephemeralKey string) {
+	if h.sockets != nil {
+		h.sockets.hub.notify(ephemeralKey)
+	}
+}
+
+// CollectSocketHandler handles GET /ws/collect/{ephemeral_key}: after the wallet signs
+// the challenge with its ephemeral private key, the receipt is pushed as soon as it is
+// submitted (or immediately if it already was) and the socket closes.
+func (h *Handler) CollectSocketHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.checkRate(w, r, h.collectLimit, clientIP(r)) {
+		return
+	}
+
+	ephemeralKey, compressedKey, ok := h.publicKeyParam(w, r)
+	if !ok {
+		return
+	}
+
+	conn, err := socketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // The upgrader has already answered
+	}
+	defer conn.Close()
+
+	if !h.proveSocketPossession(conn, compressedKey) {
+		return
+	}
+
+	// Register before looking so a submission in between still wakes this socket
+	wake := h.sockets.hub.wait(ephemeralKey)
+	defer h.sockets.hub.cancel(ephemeralKey, wake)
+
+	if !h.sendSocket(conn, models.SocketMessage{Type: models.SocketWaiting}) {
+		return
+	}
+
+	// Reading notices the wallet going away and answers its pings
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		conn.SetReadDeadline(time.Time{})
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	timeout := time.NewTimer(h.sockets.waitTimeout)
+	defer timeout.Stop()
+	ping := time.NewTicker(socketPingInterval)
+	defer ping.Stop()
+
+	for {
+		receipt, err := h.storage.Peek(ephemeralKey)
+		switch {
+		case err == nil:
+			accesslog.SetReceiptID(r, receipt.ReceiptID)
+			if h.sendSocket(conn, models.SocketMessage{
+				Type:          models.SocketReceipt,
+				ReceiptID:     receipt.ReceiptID,
+				EncryptedData: receipt.EncryptedData,
+			}) {
+				h.collectPushed(ephemeralKey)
+				closeSocket(conn, websocket.CloseNormalClosure, "")
+			}
+			return
+		case !errors.Is(err, storage.ErrNotFound):
+			log.Printf("[API] Failed to retrieve receipt for WebSocket collection: %v", err)
+			h.failSocket(conn, websocket.CloseInternalServerErr, models.ErrorCodeUnavailable, "Receipt storage temporarily unavailable")
+			return
+		}
+
+		select {
+		case <-wake:
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait)); err != nil {
+				return
+			}
+		case <-timeout.C:
+			h.failSocket(conn, websocket.CloseNormalClosure, models.ErrorCodeNotFound, fmt.Sprintf("No receipt arrived within %v", h.sockets.waitTimeout))
+			return
+		case <-gone:
+			return
+		}
+	}
+}
+
+// collectPushed marks a receipt collected once it was written to the socket, so a push
+// that failed halfway leaves it for the wallet to collect again. A receipt taken by
+// another collection in between is that collection's to report.
+func (h *Handler) collectPushed(ephemeralKey string) {
+	receipt, err := h.storage.Retrieve(ephemeralKey)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("[API] Failed to mark pushed receipt collected: %v", err)
+		}
+		return
+	}
+
+	if h.verbose {
+		log.Printf("[API] Receipt pushed over WebSocket: %s (collection #%d)", receipt.ReceiptID, receipt.CollectionCount)
+	}
+	h.notifyCollection(receipt)
+	h.events.Collected(receipt, analytics.ChannelWebSocket)
+}
+
+// proveSocketPossession sends a challenge and checks the wallet's signature over it
+// with the ephemeral public key, so someone who only saw the QR code can't collect
+func (h *Handler) proveSocketPossession(conn *websocket.Conn, compressedKey []byte) bool {
+	nonce, err := rwcrypto.NewPossessionNonce()
+	if err != nil {
+		h.failSocket(conn, websocket.CloseInternalServerErr, models.ErrorCodeInternal, "Failed to create challenge")
+		return false
+	}
+	if !h.sendSocket(conn, models.SocketMessage{
+		Type:  models.SocketChallenge,
+		Nonce: base64.StdEncoding.EncodeToString(nonce),
+	}) {
+		return false
+	}
+
+	conn.SetReadDeadline(time.Now().Add(h.sockets.challengeTimeout))
+	var proof models.SocketMessage
+	if err := conn.ReadJSON(&proof); err != nil {
+		h.failSocket(conn, websocket.ClosePolicyViolation, models.ErrorCodeUnauthorized, "No proof of possession received")
+		return false
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(proof.Signature)
+	if err == nil && proof.Type == models.SocketProof {
+		err = rwcrypto.VerifyPossession(compressedKey, nonce, signature)
+	} else if err == nil {
+		err = fmt.Errorf("expected a %q message, got %q", models.SocketProof, proof.Type)
+	}
+	if err != nil {
+		if h.verbose {
+			log.Printf("[API] Rejected WebSocket collection: %v", err)
+		}
+		h.failSocket(conn, websocket.ClosePolicyViolation, models.ErrorCodeForbidden, "Proof of possession failed")
+		return false
+	}
+	return true
+}
+
+// sendSocket writes one message and reports whether it was delivered
+func (h *Handler) sendSocket(conn *websocket.Conn, message models.SocketMessage) bool {
+	conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	if err := conn.WriteJSON(message); err != nil {
+		if h.verbose {
+			log.Printf("[API] WebSocket write failed: %v", err)
+		}
+		return false
+	}
+	return true
+}
+
+// failSocket sends an error message with an ErrorCode and closes the socket with code
+func (h *Handler) failSocket(conn *websocket.Conn, code int, errorCode, message string) {
+	if h.verbose {
+		log.Printf("[API] WebSocket closed: %s", message)
+	}
+	if h.sendSocket(conn, models.SocketMessage{Type: models.SocketError, Error: message, Code: errorCode}) {
+		closeSocket(conn, code, message)
+	}
+}
+
+func closeSocket(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(socketWriteWait))
+}
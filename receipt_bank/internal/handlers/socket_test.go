@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	rwcrypto "receiptwallet/crypto"
+
+	"receipt-bank/internal/models"
+)
+
+func TestSocketCollectsAfterThePush(t *testing.T) {
+	h, store := newTestHandler(t)
+	h.EnableSockets(time.Second, time.Second)
+	router := mux.NewRouter().UseEncodedPath()
+	router.HandleFunc("/ws/collect/{ephemeral_key}", h.CollectSocketHandler)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	key, ephemeralKey := newTestKey(t)
+	stored := storeTestReceipt(t, store, ephemeralKey, []byte("payload"))
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/collect/"+url.PathEscape(ephemeralKey), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var challenge models.SocketMessage
+	if err := conn.ReadJSON(&challenge); err != nil || challenge.Type != models.SocketChallenge {
+		t.Fatalf("Expected a challenge, got %+v, %v", challenge, err)
+	}
+	nonce, _ := base64.StdEncoding.DecodeString(challenge.Nonce)
+	signature, err := rwcrypto.SignPossession(key, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteJSON(models.SocketMessage{Type: models.SocketProof, Signature: base64.StdEncoding.EncodeToString(signature)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The waiting message and the receipt, which is already there
+	var message models.SocketMessage
+	for message.Type != models.SocketReceipt {
+		message = models.SocketMessage{}
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("Reading the push: %v", err)
+		}
+	}
+	if message.ReceiptID != stored.ReceiptID || message.EncryptedData != stored.EncryptedData {
+		t.Errorf("Pushed %+v, want %s", message, stored.ReceiptID)
+	}
+
+	// The bank marks the receipt collected after writing it, before closing
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("Expected a normal close, got %v", err)
+	}
+	if stats := store.Stats(); stats.Collected != 1 {
+		t.Errorf("Expected the pushed receipt to be collected, got %+v", stats)
+	}
+}
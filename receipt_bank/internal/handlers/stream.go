@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"receipt-bank/internal/accesslog"
+	"receipt-bank/internal/analytics"
+	"receipt-bank/internal/models"
+	"receipt-bank/internal/storage"
+)
+
+// Metadata headers sent with raw /collect responses
+const (
+	ReceiptIDHeader       = "X-Receipt-ID"
+	CollectionCountHeader = "X-Receipt-Collection-Count"
+)
+
+// streamChunkSize is how many decoded bytes are written before flushing to the client
+const streamChunkSize = 16 * 1024
+
+// writeStream serves the whole encrypted receipt as raw bytes, decoding it from base64
+// while it is written, using chunked transfer
+func (h *Handler) writeStream(w http.ResponseWriter, receipt *models.Receipt) {
+	setStreamHeaders(w, receipt)
+	w.WriteHeader(http.StatusOK)
+
+	decoder := base64.NewDecoder(base64.StdEncoding, strings.NewReader(receipt.EncryptedData))
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, streamChunkSize)
+	for {
+		n, err := io.ReadFull(decoder, buf)
+		if n > 0 {
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				log.Printf("[API] Stream to client aborted: %v", writeErr)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return
+		}
+		if err != nil {
+			// Headers are already sent; the client sees a truncated body
+			log.Printf("[ERROR] Failed to decode receipt %s while streaming: %v", receipt.ReceiptID, err)
+			return
+		}
+	}
+}
+
+// collectRange answers a raw /collect carrying Range with 206 partial content, so large
+// payloads can be fetched page by page. Ranges are served from a peek: the receipt is
+// only collected, and its webhook fired, once a range reaching its last byte was sent.
+func (h *Handler) collectRange(w http.ResponseWriter, r *http.Request, ephemeralKey string) {
+	receipt, status := h.peek(ephemeralKey)
+	switch status {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		h.writeNotFound(w, r)
+		return
+	default:
+		h.writeError(w, r, status, models.ErrorCodeUnavailable, "Receipt storage temporarily unavailable")
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(receipt.EncryptedData)
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, models.ErrorCodeInternal, "Stored receipt is not valid base64")
+		return
+	}
+
+	setStreamHeaders(w, receipt)
+	w.Header().Set("ETag", receipt.ETag())
+	sent := &rangeWriter{ResponseWriter: w}
+	http.ServeContent(sent, r, "", receipt.Timestamp, bytes.NewReader(data))
+
+	switch {
+	case sent.err != nil:
+		log.Printf("[API] Range of receipt %s to client aborted: %v", receipt.ReceiptID, sent.err)
+		return
+	case sent.status == http.StatusPartialContent && rangeReachesEnd(r.Header.Get("Range"), int64(len(data))):
+	case sent.status == http.StatusOK: // The Range was ignored and the whole receipt sent
+	default:
+		return
+	}
+
+	collected, err := h.storage.Retrieve(ephemeralKey)
+	if err != nil {
+		// Already answered; a receipt purged meanwhile was collected by another request
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("[API] Failed to mark receipt %s collected: %v", receipt.ReceiptID, err)
+		}
+		return
+	}
+	if h.verbose {
+		log.Printf("[API] Receipt collected successfully: %s (collection #%d)", collected.ReceiptID, collected.CollectionCount)
+	}
+	accesslog.SetReceiptID(r, collected.ReceiptID)
+	h.notifyCollection(collected)
+	h.events.Collected(collected, analytics.ChannelHTTP)
+}
+
+// setStreamHeaders sets the metadata headers of a raw /collect response
+func setStreamHeaders(w http.ResponseWriter, receipt *models.Receipt) {
+	w.Header().Set("Content-Type", StreamContentType)
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set(ReceiptIDHeader, receipt.ReceiptID)
+	w.Header().Set(CollectionCountHeader, strconv.Itoa(receipt.CollectionCount))
+	w.Header().Set("Accept-Ranges", "bytes")
+}
+
+// rangeWriter records the status and the first write error of a range response
+type rangeWriter struct {
+	http.ResponseWriter
+	status int
+	err    error
+}
+
+func (w *rangeWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *rangeWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// rangeReachesEnd reports whether a Range header asks for the last byte of a payload
+// of size bytes: an open range ("500-"), a suffix range ("-500") or one ending there
+func rangeReachesEnd(header string, size int64) bool {
+	specs, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return false
+	}
+	for _, spec := range strings.Split(specs, ",") {
+		start, end, ok := strings.Cut(strings.TrimSpace(spec), "-")
+		if !ok {
+			continue
+		}
+		if start == "" || end == "" {
+			return true
+		}
+		if last, err := strconv.ParseInt(end, 10, 64); err == nil && last >= size-1 {
+			return true
+		}
+	}
+	return false
+}
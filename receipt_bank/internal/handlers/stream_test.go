@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestCollectRangeCollectsAfterTheLastByte(t *testing.T) {
+	h, store := newTestHandler(t)
+	router := collectRouter(h)
+	_, ephemeralKey := newTestKey(t)
+	payload := bytes.Repeat([]byte("0123456789"), 10)
+	storeTestReceipt(t, store, ephemeralKey, payload)
+	path := "/collect/" + url.PathEscape(ephemeralKey)
+
+	collected := func() bool {
+		receipt, err := store.Peek(ephemeralKey)
+		if err != nil {
+			t.Fatalf("Receipt gone after a range request: %v", err)
+		}
+		return receipt.IsCollected()
+	}
+
+	w := serve(router, http.MethodGet, path, "Accept", StreamContentType, "Range", "bytes=0-49")
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), payload[:50]) {
+		t.Fatalf("First page: got %d %q", w.Code, w.Body)
+	}
+	if collected() {
+		t.Error("Receipt marked collected after the first page")
+	}
+
+	// A range outside the payload doesn't collect it either
+	if w := serve(router, http.MethodGet, path, "Accept", StreamContentType, "Range", "bytes=500-"); w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("Range outside the payload: got %d, want 416", w.Code)
+	}
+	if collected() {
+		t.Error("Receipt marked collected by an unsatisfiable range")
+	}
+
+	w = serve(router, http.MethodGet, path, "Accept", StreamContentType, "Range", "bytes=50-99")
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), payload[50:]) {
+		t.Fatalf("Last page: got %d %q", w.Code, w.Body)
+	}
+	if !collected() {
+		t.Error("Receipt not marked collected after the last page")
+	}
+}
+
+func TestRangeReachesEnd(t *testing.T) {
+	for _, tt := range []struct {
+		header string
+		want   bool
+	}{
+		{"bytes=0-49", false},
+		{"bytes=0-99", true},
+		{"bytes=50-", true},
+		{"bytes=-10", true},
+		{"bytes=0-9, 90-99", true},
+		{"bytes=0-9, 10-19", false},
+		{"items=0-99", false},
+	} {
+		if got := rangeReachesEnd(tt.header, 100); got != tt.want {
+			t.Errorf("rangeReachesEnd(%q, 100) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
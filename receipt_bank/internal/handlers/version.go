@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+
+	"receipt-bank/internal/models"
+)
+
+// SupportedAPIVersions lists the protocol versions this bank serves
+var SupportedAPIVersions = []string{APIVersion}
+
+// SetReceiptFormats sets the binary receipt format versions advertised at /version.
+// Submissions declaring any other receipt_format are rejected.
+func (h *Handler) SetReceiptFormats(formats []int) {
+	h.receiptFormats = formats
+}
+
+// VersionHandler handles GET /version
+func (h *Handler) VersionHandler(w http.ResponseWriter, r *http.Request) {
+	formats := h.receiptFormats
+	if formats == nil {
+		formats = []int{}
+	}
+
+	h.write(w, r, http.StatusOK, models.VersionResponse{
+		APIVersion:           APIVersion,
+		SupportedAPIVersions: SupportedAPIVersions,
+		ReceiptFormats:       formats,
+		Codecs:               SupportedContentTypes(),
+		Stream:               StreamContentType,
+		ProofOfPossession:    h.proofOfPossession(),
+	})
+}
+
+// supportsFormat reports whether a declared receipt format may be submitted
+// (any format when none are configured)
+func (h *Handler) supportsFormat(format int) bool {
+	if h.receiptFormats == nil {
+		return true
+	}
+	for _, supported := range h.receiptFormats {
+		if supported == format {
+			return true
+		}
+	}
+	return false
+}
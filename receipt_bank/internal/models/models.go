@@ -1,10 +1,13 @@
 package models
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"net/url"
 	"regexp"
+	"strings"
 	"time"
 )
 
@@ -14,6 +17,13 @@ type SubmitRequest struct {
 	EncryptedData string `json:"encrypted_data"`
 	ReceiptID     string `json:"receipt_id"`
 	WebhookURL    string `json:"webhook_url"`
+	// Strict mode: SHA-256 of the binary receipt and the revenue authority's signature over it
+	ReceiptHash        string `json:"receipt_hash,omitempty"`
+	AuthoritySignature string `json:"authority_signature,omitempty"`
+	// Seconds until the receipt expires if uncollected (0 = the configured max_receipt_age)
+	TTL int64 `json:"ttl,omitempty"`
+	// Binary receipt format version inside the encrypted payload, checked when declared
+	ReceiptFormat int `json:"receipt_format,omitempty"`
 }
 
 // SubmitResponse represents the receipt submission response
@@ -21,33 +31,192 @@ type SubmitResponse struct {
 	ReceiptID string `json:"receipt_id"`
 }
 
+// MaxBatchSize is the most receipts one /submit/batch request may carry
+const MaxBatchSize = 100
+
+// SubmitBatchRequest carries several submissions, e.g. a register flushing its offline queue
+type SubmitBatchRequest struct {
+	Receipts []SubmitRequest `json:"receipts"`
+}
+
+// SubmitBatchResult is the outcome of one batch entry. Status is the code /submit would have
+// answered for it alone; Error and Code are set when it was not stored.
+type SubmitBatchResult struct {
+	ReceiptID string `json:"receipt_id"`
+	Status    int    `json:"status"`
+	Error     string `json:"error,omitempty"`
+	Code      string `json:"code,omitempty"`
+}
+
+// SubmitBatchSummary counts the entries of a batch by outcome
+type SubmitBatchSummary struct {
+	Total     int `json:"total"`
+	Stored    int `json:"stored"`
+	Duplicate int `json:"duplicate"` // Already stored, e.g. by an earlier flush whose response was lost
+	Failed    int `json:"failed"`
+}
+
+// SubmitBatchResponse lists one result per entry, in request order
+type SubmitBatchResponse struct {
+	Results []SubmitBatchResult `json:"results"`
+	Summary SubmitBatchSummary  `json:"summary"`
+}
+
 // CollectResponse represents the receipt collection response
 type CollectResponse struct {
 	EncryptedData string `json:"encrypted_data"`
 	ReceiptID     string `json:"receipt_id"`
 }
 
+// ReceiptMetaResponse is returned by GET /collect/{ephemeral_key}/meta: what a
+// collection would fetch, without collecting it
+type ReceiptMetaResponse struct {
+	Exists      bool       `json:"exists"`
+	Size        int        `json:"size_bytes,omitempty"` // Encrypted payload, as a raw collection sends it
+	SubmittedAt *time.Time `json:"submitted_at,omitempty"`
+	Collected   bool       `json:"collected,omitempty"` // Collected before, fetchable again during the grace period
+}
+
+// VersionResponse is returned by GET /version so cash registers can check compatibility
+// before submitting
+type VersionResponse struct {
+	APIVersion           string   `json:"api_version"`
+	SupportedAPIVersions []string `json:"supported_api_versions"`
+	ReceiptFormats       []int    `json:"receipt_formats"` // Binary receipt versions wallets collecting here can decode
+	Codecs               []string `json:"codecs"`
+	Stream               string   `json:"stream"`
+	ProofOfPossession    string   `json:"proof_of_possession"` // "optional" or "required" on /collect
+}
+
+// ChallengeResponse is returned by POST /collect/{ephemeral_key}/challenge
+type ChallengeResponse struct {
+	Nonce     string `json:"nonce"`      // Base64, 32 bytes, valid for one collection attempt
+	ExpiresIn int64  `json:"expires_in"` // Seconds
+}
+
+// Message types on the /ws/collect/{ephemeral_key} socket
+const (
+	SocketChallenge = "challenge" // bank -> wallet: nonce to sign
+	SocketProof     = "proof"     // wallet -> bank: signature over the challenge
+	SocketWaiting   = "waiting"   // bank -> wallet: proof accepted, receipt not submitted yet
+	SocketReceipt   = "receipt"   // bank -> wallet: the collected receipt, then the socket closes
+	SocketError     = "error"     // bank -> wallet: the socket closes without a receipt
+)
+
+// SocketMessage is one JSON text frame on the collection socket
+type SocketMessage struct {
+	Type          string `json:"type"`
+	Nonce         string `json:"nonce,omitempty"`     // Base64, 32 bytes
+	Signature     string `json:"signature,omitempty"` // Base64 r || s over SHA-256(domain || nonce || ephemeral key)
+	ReceiptID     string `json:"receipt_id,omitempty"`
+	EncryptedData string `json:"encrypted_data,omitempty"`
+	Error         string `json:"error,omitempty"`
+	Code          string `json:"code,omitempty"` // ErrorCode constant, with Error
+}
+
+// WebhookSchemaVersion is the schema_version of WebhookPayload. Payloads without the
+// field come from banks that sent only receipt_id, status and timestamp (version 1).
+const WebhookSchemaVersion = 2
+
 // WebhookPayload represents the payload sent to cash register webhook
 type WebhookPayload struct {
-	ReceiptID string `json:"receipt_id"`
-	Status    string `json:"status"`
-	Timestamp string `json:"timestamp"`
+	SchemaVersion       int    `json:"schema_version"`
+	ReceiptID           string `json:"receipt_id"`
+	Status              string `json:"status"`
+	Timestamp           string `json:"timestamp"`             // When this attempt was sent (RFC 3339)
+	SubmittedAt         string `json:"submitted_at"`          // RFC 3339, milliseconds
+	CollectedAt         string `json:"collected_at"`          // First collection, RFC 3339, milliseconds
+	CollectionLatencyMs int64  `json:"collection_latency_ms"` // From submission to first collection
+	Attempt             int    `json:"attempt"`               // 1 for the first delivery, then one more per retry
+}
+
+// WebhookTypeVerification is the type of the challenge sent to verify a webhook receiver
+const WebhookTypeVerification = "url_verification"
+
+// WebhookChallenge is posted to a webhook URL before the bank trusts it; the receiver
+// answers with WebhookChallengeResponse echoing the challenge
+type WebhookChallenge struct {
+	Type      string `json:"type"`      // Always WebhookTypeVerification
+	Challenge string `json:"challenge"` // One-time token, hex
+	Timestamp string `json:"timestamp"` // RFC 3339
+}
+
+// WebhookChallengeResponse is a receiver's answer to a WebhookChallenge
+type WebhookChallengeResponse struct {
+	Challenge string `json:"challenge"`
 }
 
 // Receipt represents a stored receipt
 type Receipt struct {
-	EphemeralKey  string    `json:"ephemeral_key"`
-	EncryptedData string    `json:"encrypted_data"`
-	ReceiptID     string    `json:"receipt_id"`
-	WebhookURL    string    `json:"webhook_url"`
-	Timestamp     time.Time `json:"timestamp"`
+	EphemeralKey    string        `json:"ephemeral_key"`
+	EncryptedData   string        `json:"encrypted_data"`
+	ReceiptID       string        `json:"receipt_id"`
+	WebhookURL      string        `json:"webhook_url"`
+	Timestamp       time.Time     `json:"timestamp"`
+	CollectedAt     *time.Time    `json:"collected_at,omitempty"`
+	CollectionCount int           `json:"collection_count"`
+	LastAccessedAt  time.Time     `json:"last_accessed_at"`      // Submission or latest collection, for LRU eviction
+	RegisterID      string        `json:"register_id,omitempty"` // Depositing cash register; never returned to collectors
+	PayloadHash     string        `json:"-"`                     // Shared payload key when storage deduplicates
+	TTL             time.Duration `json:"ttl,omitempty"`         // Overrides max_receipt_age for this receipt when non-zero
+}
+
+// Size returns the length of the decoded encrypted payload
+func (r *Receipt) Size() int {
+	padding := len(r.EncryptedData) - len(strings.TrimRight(r.EncryptedData, "="))
+	return base64.StdEncoding.DecodedLen(len(r.EncryptedData)) - padding
+}
+
+// IsCollected reports whether the receipt has been collected at least once
+func (r *Receipt) IsCollected() bool {
+	return r.CollectedAt != nil
+}
+
+// MaxAge returns how long the receipt is kept uncollected: its own TTL if set, else defaultMaxAge
+func (r *Receipt) MaxAge(defaultMaxAge time.Duration) time.Duration {
+	if r.TTL > 0 {
+		return r.TTL
+	}
+	return defaultMaxAge
+}
+
+// ETag identifies the receipt's content for conditional /collect requests: a strong
+// entity tag over the receipt ID and encrypted payload
+func (r *Receipt) ETag() string {
+	sum := sha256.Sum256([]byte(r.ReceiptID + "\x00" + r.EncryptedData))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// IsExpired reports whether an uncollected receipt has outlived its max age at now
+func (r *Receipt) IsExpired(now time.Time, defaultMaxAge time.Duration) bool {
+	return !r.IsCollected() && now.Sub(r.Timestamp) > r.MaxAge(defaultMaxAge)
 }
 
 // ErrorResponse represents an API error response
 type ErrorResponse struct {
 	Error string `json:"error"`
+	Code  string `json:"code,omitempty"` // Machine-readable; see the ErrorCode constants
 }
 
+// Error codes returned in ErrorResponse.Code. Clients should branch on these rather than
+// on the message text, which may change.
+const (
+	ErrorCodeInvalidRequest     = "INVALID_REQUEST"     // Malformed payload or a field failed validation
+	ErrorCodeInvalidKey         = "INVALID_KEY"         // The ephemeral key is missing, not base64 or not a P-256 point
+	ErrorCodeInvalidAttestation = "INVALID_ATTESTATION" // Strict mode: the authority signature does not verify
+	ErrorCodeUnsupportedFormat  = "UNSUPPORTED_FORMAT"  // receipt_format or content type the bank cannot handle
+	ErrorCodeDuplicateReceipt   = "DUPLICATE_RECEIPT"   // receipt_id is already stored
+	ErrorCodePayloadTooLarge    = "PAYLOAD_TOO_LARGE"   // The request body is over the endpoint's size limit
+	ErrorCodeNotFound           = "NOT_FOUND"           // No receipt (or register, or feature) by that name
+	ErrorCodeUnauthorized       = "UNAUTHORIZED"        // Missing or invalid credentials
+	ErrorCodeForbidden          = "FORBIDDEN"           // Credentials were valid but the request is refused
+	ErrorCodeRateLimited        = "RATE_LIMITED"        // Too many requests; retry after the Retry-After header
+	ErrorCodeStorageFull        = "STORAGE_FULL"        // Reserved for a storage limit that refuses submissions; not returned yet
+	ErrorCodeUnavailable        = "UNAVAILABLE"         // The storage backend cannot be reached; retry later
+	ErrorCodeWebhookUnverified  = "WEBHOOK_UNVERIFIED"  // The webhook_url receiver did not echo the verification challenge
+	ErrorCodeInternal           = "INTERNAL_ERROR"
+)
+
 // receiptIDRegex matches alphanumeric characters and hyphens only
 var receiptIDRegex = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
 
@@ -99,6 +268,14 @@ func (req *SubmitRequest) Validate() error {
 		return fmt.Errorf("webhook_url must use HTTP or HTTPS")
 	}
 
+	if req.ReceiptFormat < 0 {
+		return fmt.Errorf("receipt_format must be a positive version number")
+	}
+
+	if req.TTL < 0 {
+		return fmt.Errorf("ttl must be a positive number of seconds")
+	}
+
 	return nil
 }
 
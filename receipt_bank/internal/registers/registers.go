@@ -0,0 +1,297 @@
+package registers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authentication errors
+var (
+	ErrUnknownRegister = errors.New("unknown cash register")
+	ErrRevoked         = errors.New("cash register has been revoked")
+)
+
+// Entry is an allowed cash register as configured
+type Entry struct {
+	ID         string `yaml:"id"`
+	Name       string `yaml:"name"`
+	APIKey     string `yaml:"api_key"`
+	CertSHA256 string `yaml:"cert_sha256"` // Hex SHA-256 of the client certificate (DER)
+}
+
+// Info describes a register for the admin API. Credentials are never included.
+type Info struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	APIKey      bool       `json:"api_key"`
+	Certificate bool       `json:"certificate"`
+	Revoked     bool       `json:"revoked"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	Deposits    int        `json:"deposits"`
+	LastDeposit *time.Time `json:"last_deposit,omitempty"`
+}
+
+type register struct {
+	id          string
+	name        string
+	keyHash     [sha256.Size]byte
+	hasKey      bool
+	certHash    [sha256.Size]byte
+	hasCert     bool
+	revokedAt   *time.Time
+	deposits    int
+	lastDeposit *time.Time
+}
+
+// Registry holds the cash registers allowed to deposit receipts.
+// Revocations are kept in memory and, when a file is configured, persisted across restarts.
+type Registry struct {
+	mu              sync.RWMutex
+	registers       map[string]*register
+	revocationsFile string
+	verbose         bool
+}
+
+// NewRegistry builds a registry from configured entries and loads persisted revocations
+func NewRegistry(entries []Entry, revocationsFile string, verbose bool) (*Registry, error) {
+	registry := &Registry{
+		registers:       make(map[string]*register, len(entries)),
+		revocationsFile: revocationsFile,
+		verbose:         verbose,
+	}
+
+	keys := make(map[[sha256.Size]byte]string)
+	for _, entry := range entries {
+		if entry.ID == "" {
+			return nil, fmt.Errorf("register id is required")
+		}
+		if _, exists := registry.registers[entry.ID]; exists {
+			return nil, fmt.Errorf("duplicate register id %q", entry.ID)
+		}
+		if entry.APIKey == "" && entry.CertSHA256 == "" {
+			return nil, fmt.Errorf("register %q needs an api_key or cert_sha256", entry.ID)
+		}
+
+		reg := &register{id: entry.ID, name: entry.Name}
+		if entry.APIKey != "" {
+			reg.keyHash = sha256.Sum256([]byte(entry.APIKey))
+			reg.hasKey = true
+			if other, exists := keys[reg.keyHash]; exists {
+				return nil, fmt.Errorf("registers %q and %q share an api_key", other, entry.ID)
+			}
+			keys[reg.keyHash] = entry.ID
+		}
+		if entry.CertSHA256 != "" {
+			fingerprint, err := parseFingerprint(entry.CertSHA256)
+			if err != nil {
+				return nil, fmt.Errorf("register %q: %v", entry.ID, err)
+			}
+			reg.certHash = fingerprint
+			reg.hasCert = true
+		}
+		registry.registers[entry.ID] = reg
+	}
+
+	if err := registry.loadRevocations(); err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+// AuthenticateKey returns the ID of the register owning apiKey
+func (r *Registry) AuthenticateKey(apiKey string) (string, error) {
+	hash := sha256.Sum256([]byte(apiKey))
+	return r.authenticate(func(reg *register) bool {
+		return reg.hasKey && subtle.ConstantTimeCompare(hash[:], reg.keyHash[:]) == 1
+	})
+}
+
+// AuthenticateCertificate returns the ID of the register pinned to the DER-encoded certificate
+func (r *Registry) AuthenticateCertificate(der []byte) (string, error) {
+	hash := sha256.Sum256(der)
+	return r.authenticate(func(reg *register) bool {
+		return reg.hasCert && subtle.ConstantTimeCompare(hash[:], reg.certHash[:]) == 1
+	})
+}
+
+func (r *Registry) authenticate(match func(*register) bool) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, reg := range r.registers {
+		if !match(reg) {
+			continue
+		}
+		if reg.revokedAt != nil {
+			return reg.id, ErrRevoked
+		}
+		return reg.id, nil
+	}
+	return "", ErrUnknownRegister
+}
+
+// RecordDeposit counts a stored receipt against the register
+func (r *Registry) RecordDeposit(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if reg, ok := r.registers[id]; ok {
+		now := time.Now()
+		reg.deposits++
+		reg.lastDeposit = &now
+	}
+}
+
+// Revoke stops a register from depositing receipts
+func (r *Registry) Revoke(id string) (Info, error) {
+	return r.setRevoked(id, true)
+}
+
+// Reinstate allows a revoked register to deposit receipts again
+func (r *Registry) Reinstate(id string) (Info, error) {
+	return r.setRevoked(id, false)
+}
+
+func (r *Registry) setRevoked(id string, revoked bool) (Info, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reg, ok := r.registers[id]
+	if !ok {
+		return Info{}, ErrUnknownRegister
+	}
+
+	previous := reg.revokedAt
+	if revoked && reg.revokedAt == nil {
+		now := time.Now().UTC()
+		reg.revokedAt = &now
+	} else if !revoked {
+		reg.revokedAt = nil
+	}
+
+	if err := r.saveRevocations(); err != nil {
+		reg.revokedAt = previous
+		return Info{}, err
+	}
+
+	if r.verbose {
+		if revoked {
+			log.Printf("[REGISTERS] Revoked register %s", id)
+		} else {
+			log.Printf("[REGISTERS] Reinstated register %s", id)
+		}
+	}
+
+	return reg.info(), nil
+}
+
+// List returns all registers sorted by ID
+func (r *Registry) List() []Info {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	infos := make([]Info, 0, len(r.registers))
+	for _, reg := range r.registers {
+		infos = append(infos, reg.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+func (reg *register) info() Info {
+	return Info{
+		ID:          reg.id,
+		Name:        reg.name,
+		APIKey:      reg.hasKey,
+		Certificate: reg.hasCert,
+		Revoked:     reg.revokedAt != nil,
+		RevokedAt:   reg.revokedAt,
+		Deposits:    reg.deposits,
+		LastDeposit: reg.lastDeposit,
+	}
+}
+
+// loadRevocations applies revocations persisted by an earlier run
+func (r *Registry) loadRevocations() error {
+	if r.revocationsFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(r.revocationsFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read revocations file: %v", err)
+	}
+
+	var revoked map[string]time.Time
+	if err := json.Unmarshal(data, &revoked); err != nil {
+		return fmt.Errorf("failed to parse revocations file: %v", err)
+	}
+
+	for id, at := range revoked {
+		reg, ok := r.registers[id]
+		if !ok {
+			// Removed from config since; nothing left to revoke
+			continue
+		}
+		revokedAt := at
+		reg.revokedAt = &revokedAt
+		if r.verbose {
+			log.Printf("[REGISTERS] Register %s revoked since %s", id, at.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// saveRevocations writes the current revocations atomically (caller holds mu)
+func (r *Registry) saveRevocations() error {
+	if r.revocationsFile == "" {
+		return nil
+	}
+
+	revoked := make(map[string]time.Time)
+	for id, reg := range r.registers {
+		if reg.revokedAt != nil {
+			revoked[id] = *reg.revokedAt
+		}
+	}
+
+	data, err := json.MarshalIndent(revoked, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode revocations: %v", err)
+	}
+
+	tmp := r.revocationsFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write revocations file: %v", err)
+	}
+	if err := os.Rename(tmp, r.revocationsFile); err != nil {
+		return fmt.Errorf("failed to write revocations file: %v", err)
+	}
+	return nil
+}
+
+// parseFingerprint accepts hex with or without colon separators
+func parseFingerprint(s string) ([sha256.Size]byte, error) {
+	var fingerprint [sha256.Size]byte
+
+	b, err := hex.DecodeString(strings.ReplaceAll(s, ":", ""))
+	if err != nil || len(b) != sha256.Size {
+		return fingerprint, fmt.Errorf("cert_sha256 must be a hex SHA-256 fingerprint")
+	}
+	copy(fingerprint[:], b)
+	return fingerprint, nil
+}
@@ -0,0 +1,200 @@
+package registers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testCert stands in for a client certificate's DER bytes
+var testCert = []byte("register-2 certificate")
+
+func testEntries() []Entry {
+	fingerprint := sha256.Sum256(testCert)
+	return []Entry{
+		{ID: "register-1", Name: "Till 1", APIKey: "key-1"},
+		{ID: "register-2", Name: "Till 2", CertSHA256: hex.EncodeToString(fingerprint[:])},
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	registry, err := NewRegistry(testEntries(), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := registry.AuthenticateKey("key-1"); err != nil || id != "register-1" {
+		t.Errorf("AuthenticateKey(key-1) = %q, %v; want register-1", id, err)
+	}
+	if _, err := registry.AuthenticateKey("key-2"); !errors.Is(err, ErrUnknownRegister) {
+		t.Errorf("AuthenticateKey with an unknown key: got %v, want ErrUnknownRegister", err)
+	}
+	if _, err := registry.AuthenticateKey(""); !errors.Is(err, ErrUnknownRegister) {
+		t.Errorf("AuthenticateKey(\"\") matched a register without an api_key: %v", err)
+	}
+
+	if id, err := registry.AuthenticateCertificate(testCert); err != nil || id != "register-2" {
+		t.Errorf("AuthenticateCertificate = %q, %v; want register-2", id, err)
+	}
+	if _, err := registry.AuthenticateCertificate([]byte("another certificate")); !errors.Is(err, ErrUnknownRegister) {
+		t.Errorf("AuthenticateCertificate with an unpinned certificate: got %v, want ErrUnknownRegister", err)
+	}
+}
+
+func TestNewRegistryRefusesBadEntries(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		entries []Entry
+		want    string
+	}{
+		{"missing id", []Entry{{APIKey: "key"}}, "id is required"},
+		{"duplicate id", []Entry{{ID: "a", APIKey: "key-a"}, {ID: "a", APIKey: "key-b"}}, "duplicate"},
+		{"no credentials", []Entry{{ID: "a"}}, "api_key or cert_sha256"},
+		{"shared api key", []Entry{{ID: "a", APIKey: "key"}, {ID: "b", APIKey: "key"}}, "share an api_key"},
+		{"bad fingerprint", []Entry{{ID: "a", CertSHA256: "not-hex"}}, "cert_sha256"},
+	} {
+		if _, err := NewRegistry(tt.entries, "", false); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want an error about %q", tt.name, err, tt.want)
+		}
+	}
+
+	// Fingerprints copied from openssl keep their colons
+	fingerprint := sha256.Sum256(testCert)
+	colons := strings.ToUpper(hex.EncodeToString(fingerprint[:]))
+	var grouped []string
+	for i := 0; i < len(colons); i += 2 {
+		grouped = append(grouped, colons[i:i+2])
+	}
+	registry, err := NewRegistry([]Entry{{ID: "a", CertSHA256: strings.Join(grouped, ":")}}, "", false)
+	if err != nil {
+		t.Fatalf("Colon-separated fingerprint: %v", err)
+	}
+	if _, err := registry.AuthenticateCertificate(testCert); err != nil {
+		t.Errorf("Colon-separated fingerprint does not match: %v", err)
+	}
+}
+
+func TestRevokeAndReinstate(t *testing.T) {
+	registry, err := NewRegistry(testEntries(), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := registry.Revoke("register-1")
+	if err != nil || !info.Revoked || info.RevokedAt == nil {
+		t.Fatalf("Revoke = %+v, %v; want a revoked register", info, err)
+	}
+	revokedAt := *info.RevokedAt
+
+	// A revoked register is still identified, so the caller can tell it apart from an unknown one
+	if id, err := registry.AuthenticateKey("key-1"); id != "register-1" || !errors.Is(err, ErrRevoked) {
+		t.Errorf("AuthenticateKey after Revoke = %q, %v; want register-1, ErrRevoked", id, err)
+	}
+	if _, err := registry.AuthenticateCertificate(testCert); err != nil {
+		t.Errorf("Revoking one register affected another: %v", err)
+	}
+
+	// Revoking again keeps the original time
+	if info, err := registry.Revoke("register-1"); err != nil || !info.RevokedAt.Equal(revokedAt) {
+		t.Errorf("Second Revoke = %+v, %v; want revoked_at unchanged", info, err)
+	}
+
+	info, err = registry.Reinstate("register-1")
+	if err != nil || info.Revoked || info.RevokedAt != nil {
+		t.Fatalf("Reinstate = %+v, %v; want an active register", info, err)
+	}
+	if _, err := registry.AuthenticateKey("key-1"); err != nil {
+		t.Errorf("AuthenticateKey after Reinstate: %v", err)
+	}
+
+	if _, err := registry.Revoke("register-9"); !errors.Is(err, ErrUnknownRegister) {
+		t.Errorf("Revoke of an unknown register: got %v, want ErrUnknownRegister", err)
+	}
+	if _, err := registry.Reinstate("register-9"); !errors.Is(err, ErrUnknownRegister) {
+		t.Errorf("Reinstate of an unknown register: got %v, want ErrUnknownRegister", err)
+	}
+}
+
+func TestRevocationsPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revocations.json")
+	registry, err := NewRegistry(testEntries(), path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Revoke("register-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Revoke("register-2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Reinstate("register-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart keeps the revocation and the reinstatement
+	restarted, err := NewRegistry(testEntries(), path, false)
+	if err != nil {
+		t.Fatalf("Reloading revocations: %v", err)
+	}
+	if _, err := restarted.AuthenticateKey("key-1"); !errors.Is(err, ErrRevoked) {
+		t.Errorf("register-1 after a restart: got %v, want ErrRevoked", err)
+	}
+	if _, err := restarted.AuthenticateCertificate(testCert); err != nil {
+		t.Errorf("register-2 after a restart: %v", err)
+	}
+
+	// Revocations of registers since removed from the config are ignored
+	if _, err := NewRegistry(testEntries()[1:], path, false); err != nil {
+		t.Errorf("Revocation of a removed register: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRegistry(testEntries(), path, false); err == nil {
+		t.Error("Expected a corrupt revocations file to be refused")
+	}
+}
+
+func TestRevokeRollsBackWhenSaveFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "revocations.json")
+	registry, err := NewRegistry(testEntries(), path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := registry.Revoke("register-1"); err == nil {
+		t.Fatal("Expected Revoke to fail when the revocations file cannot be written")
+	}
+	if _, err := registry.AuthenticateKey("key-1"); err != nil {
+		t.Errorf("A revocation that was not saved still applies: %v", err)
+	}
+}
+
+func TestListAndDeposits(t *testing.T) {
+	registry, err := NewRegistry(testEntries(), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.RecordDeposit("register-2")
+	registry.RecordDeposit("register-2")
+	registry.RecordDeposit("register-9")
+
+	infos := registry.List()
+	if len(infos) != 2 || infos[0].ID != "register-1" || infos[1].ID != "register-2" {
+		t.Fatalf("List = %+v, want register-1 and register-2 in order", infos)
+	}
+	if !infos[0].APIKey || infos[0].Certificate || infos[1].APIKey || !infos[1].Certificate {
+		t.Errorf("List reports the wrong credential kinds: %+v", infos)
+	}
+	if infos[0].Deposits != 0 || infos[0].LastDeposit != nil {
+		t.Errorf("register-1 has deposits: %+v", infos[0])
+	}
+	if infos[1].Deposits != 2 || infos[1].LastDeposit == nil {
+		t.Errorf("register-2: got %+v, want 2 deposits", infos[1])
+	}
+}
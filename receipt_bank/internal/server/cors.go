@@ -0,0 +1,109 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"receipt-bank/internal/handlers"
+)
+
+// CORSPolicy controls which browser origins may call the API cross-origin
+type CORSPolicy struct {
+	AllowedOrigins []string // "*" allows any origin
+	AllowedMethods []string
+	AllowedHeaders []string
+	MaxAge         time.Duration // How long browsers may cache a preflight result
+}
+
+// exposedHeaders are the response headers browser wallets need to read
+var exposedHeaders = []string{
+	handlers.VersionHeader,
+	handlers.CapabilitiesHeader,
+	handlers.ReceiptIDHeader,
+	handlers.CollectionCountHeader,
+	"Content-Range",
+}
+
+// cors answers preflight requests and adds CORS headers for allowed origins. It wraps the
+// whole router because preflight OPTIONS requests match no API route.
+type cors struct {
+	policy  CORSPolicy
+	origins map[string]bool
+	any     bool
+	methods map[string]bool
+	verbose bool
+}
+
+func newCORS(policy CORSPolicy, verbose bool) *cors {
+	c := &cors{
+		policy:  policy,
+		origins: make(map[string]bool),
+		methods: make(map[string]bool),
+		verbose: verbose,
+	}
+	for _, origin := range policy.AllowedOrigins {
+		if origin == "*" {
+			c.any = true
+		}
+		c.origins[strings.TrimSuffix(origin, "/")] = true
+	}
+	for _, method := range policy.AllowedMethods {
+		c.methods[strings.ToUpper(method)] = true
+	}
+	return c
+}
+
+func (c *cors) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if !c.any && !c.origins[origin] {
+			if c.verbose {
+				log.Printf("[CORS] Origin not allowed: %s", origin)
+			}
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if c.any {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if !preflight {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(exposedHeaders, ", "))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		if !c.methods[r.Header.Get("Access-Control-Request-Method")] {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.policy.AllowedMethods, ", "))
+		if len(c.policy.AllowedHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.policy.AllowedHeaders, ", "))
+		}
+		if c.policy.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(c.policy.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Listen address kinds
+const (
+	NetworkTCP     = "tcp"
+	NetworkUnix    = "unix"
+	NetworkSystemd = "systemd"
+)
+
+// systemdFirstFD is the first file descriptor systemd passes to socket-activated services
+const systemdFirstFD = 3
+
+// ListenAddress is where the server accepts connections
+type ListenAddress struct {
+	Network    string      // tcp, unix or systemd
+	Address    string      // host:port, or the socket path
+	SocketMode os.FileMode // Permissions of a unix socket (0 = left to the umask)
+}
+
+// ParseListenAddress reads server.listen: "" binds port on all interfaces, a host or
+// IP (IPv6 with or without brackets) binds port on it, host:port binds that port
+// instead, "unix:<path>" a unix domain socket and "systemd" the socket systemd passes
+// in. socketMode is octal, e.g. "0660"; only unix sockets take it.
+func ParseListenAddress(listen string, port int, socketMode string) (ListenAddress, error) {
+	var address ListenAddress
+	if socketMode != "" {
+		mode, err := strconv.ParseUint(socketMode, 8, 32)
+		if err != nil || mode > 0o777 {
+			return address, fmt.Errorf("invalid socket_mode %q: want octal permissions such as 0660", socketMode)
+		}
+		address.SocketMode = os.FileMode(mode)
+	}
+
+	switch {
+	case listen == NetworkSystemd:
+		address.Network = NetworkSystemd
+	case strings.HasPrefix(listen, NetworkUnix+":"):
+		address.Network = NetworkUnix
+		address.Address = strings.TrimPrefix(listen, NetworkUnix+":")
+		if address.Address == "" {
+			return address, fmt.Errorf("invalid listen %q: the unix socket path is empty", listen)
+		}
+	default:
+		address.Network = NetworkTCP
+		host, portText, err := net.SplitHostPort(listen)
+		if err != nil {
+			// A bare host or IP takes server.port
+			host = strings.TrimSuffix(strings.TrimPrefix(listen, "["), "]")
+			portText = strconv.Itoa(port)
+		} else if p, err := strconv.Atoi(portText); err != nil || p <= 0 || p > 65535 {
+			return address, fmt.Errorf("invalid listen %q: port must be between 1 and 65535", listen)
+		}
+		if host != "" && net.ParseIP(host) == nil && strings.ContainsAny(host, ":[]/ ") {
+			return address, fmt.Errorf("invalid listen %q: want a host, IP, host:port, unix:<path> or systemd", listen)
+		}
+		address.Address = net.JoinHostPort(host, portText)
+	}
+
+	if address.SocketMode != 0 && address.Network != NetworkUnix {
+		return address, fmt.Errorf("socket_mode only applies to a unix: listen address")
+	}
+	return address, nil
+}
+
+// String describes the address for logs
+func (a ListenAddress) String() string {
+	switch a.Network {
+	case NetworkUnix:
+		return "unix socket " + a.Address
+	case NetworkSystemd:
+		return "socket passed by systemd"
+	}
+	return a.Address
+}
+
+// Listen opens the address. A unix socket left behind by a bank that did not shut down
+// is replaced; one another process still accepts on is not.
+func Listen(address ListenAddress) (net.Listener, error) {
+	switch address.Network {
+	case NetworkSystemd:
+		return systemdListener()
+	case NetworkUnix:
+		if err := removeStaleSocket(address.Address); err != nil {
+			return nil, err
+		}
+		listener, err := net.Listen(NetworkUnix, address.Address)
+		if err != nil {
+			return nil, err
+		}
+		if address.SocketMode != 0 {
+			if err := os.Chmod(address.Address, address.SocketMode); err != nil {
+				listener.Close()
+				return nil, fmt.Errorf("failed to set socket permissions: %v", err)
+			}
+		}
+		return listener, nil
+	}
+	return net.Listen(NetworkTCP, address.Address)
+}
+
+// removeStaleSocket removes the socket file at path unless a server is accepting on it
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout(NetworkUnix, path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another server", path)
+	}
+	return os.Remove(path)
+}
+
+// systemdListener takes the first socket passed by systemd socket activation
+// (LISTEN_PID and LISTEN_FDS, see sd_listen_fds(3)). The variables are cleared so
+// processes started by the bank do not inherit them.
+func systemdListener() (net.Listener, error) {
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	count, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if pid != os.Getpid() || count < 1 {
+		return nil, fmt.Errorf("no socket passed by systemd (start the bank from a .socket unit)")
+	}
+	if count > 1 {
+		return nil, fmt.Errorf("systemd passed %d sockets, the bank listens on one", count)
+	}
+
+	syscall.CloseOnExec(systemdFirstFD)
+	file := os.NewFile(systemdFirstFD, "systemd-socket")
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("socket passed by systemd is not a stream socket: %v", err)
+	}
+	return listener, nil
+}
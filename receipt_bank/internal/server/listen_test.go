@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	for _, tt := range []struct {
+		listen  string
+		network string
+		address string
+	}{
+		{"", NetworkTCP, ":4403"},
+		{"127.0.0.1", NetworkTCP, "127.0.0.1:4403"},
+		{"127.0.0.1:8080", NetworkTCP, "127.0.0.1:8080"},
+		{"::1", NetworkTCP, "[::1]:4403"},
+		{"[::1]", NetworkTCP, "[::1]:4403"},
+		{"[::]:8080", NetworkTCP, "[::]:8080"},
+		{"bank.lan", NetworkTCP, "bank.lan:4403"},
+		{"unix:/run/receipt-bank/bank.sock", NetworkUnix, "/run/receipt-bank/bank.sock"},
+		{"systemd", NetworkSystemd, ""},
+	} {
+		address, err := ParseListenAddress(tt.listen, 4403, "")
+		if err != nil {
+			t.Errorf("ParseListenAddress(%q): %v", tt.listen, err)
+			continue
+		}
+		if address.Network != tt.network || address.Address != tt.address {
+			t.Errorf("ParseListenAddress(%q) = %s %q, want %s %q", tt.listen, address.Network, address.Address, tt.network, tt.address)
+		}
+	}
+
+	for _, tt := range []struct{ listen, socketMode string }{
+		{"unix:", ""},
+		{"127.0.0.1:http", ""},
+		{"127.0.0.1:70000", ""},
+		{"fe80::1::2", ""},
+		{"unix:/tmp/bank.sock", "0999"},
+		{"127.0.0.1", "0660"},
+	} {
+		if _, err := ParseListenAddress(tt.listen, 4403, tt.socketMode); err == nil {
+			t.Errorf("ParseListenAddress(%q, socket_mode %q) succeeded, want an error", tt.listen, tt.socketMode)
+		}
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bank.sock")
+	address, err := ParseListenAddress("unix:"+path, 0, "0600")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := Listen(address)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Socket permissions %v, want 0600", info.Mode().Perm())
+	}
+
+	// A socket still being accepted on is not taken over
+	if second, err := Listen(address); err == nil {
+		second.Close()
+		t.Fatal("Listen on a socket in use succeeded")
+	}
+
+	// One left behind by a bank that exited without closing it is
+	first.(*net.UnixListener).SetUnlinkOnClose(false)
+	first.Close()
+	second, err := Listen(address)
+	if err != nil {
+		t.Fatalf("Listen over a stale socket: %v", err)
+	}
+	second.Close()
+}
@@ -1,29 +1,39 @@
 package server
 
 import (
-	"fmt"
+	"crypto/tls"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 
+	"receipt-bank/internal/accesslog"
 	"receipt-bank/internal/handlers"
+	"receipt-bank/internal/wallet"
 )
 
 // Server represents the HTTP server
 type Server struct {
-	router  *mux.Router
-	handler *handlers.Handler
-	verbose bool
+	router    *mux.Router
+	handler   *handlers.Handler
+	cors      *cors
+	accessLog *accesslog.Logger
+	certFile  string
+	keyFile   string
+	verbose   bool
 }
 
 // NewServer creates a new HTTP server
 func NewServer(handler *handlers.Handler, verbose bool) *Server {
 	server := &Server{
-		router:  mux.NewRouter(),
-		handler: handler,
-		verbose: verbose,
+		// Keep path parameters encoded so base64 keys containing '/' (%2F) route correctly
+		router:    mux.NewRouter().UseEncodedPath(),
+		handler:   handler,
+		accessLog: accesslog.Console(verbose),
+		verbose:   verbose,
 	}
 
 	server.setupRoutes()
@@ -32,51 +42,151 @@ func NewServer(handler *handlers.Handler, verbose bool) *Server {
 
 // setupRoutes configures the HTTP routes
 func (s *Server) setupRoutes() {
-	// API routes
-	s.router.HandleFunc("/submit", s.handler.SubmitHandler).Methods("POST")
-	s.router.HandleFunc("/collect/{ephemeral_key}", s.handler.CollectHandler).Methods("GET")
-	s.router.HandleFunc("/health", s.handler.HealthHandler).Methods("GET")
+	// Versioned API routes
+	v1 := s.router.PathPrefix("/v" + handlers.APIVersion).Subrouter()
+	s.registerAPIRoutes(v1)
 
-	// Add logging middleware
-	s.router.Use(s.loggingMiddleware)
+	// Legacy unversioned aliases, kept for existing clients
+	legacy := s.router.NewRoute().Subrouter()
+	s.registerAPIRoutes(legacy)
+
+	// Add access log annotation and version middleware
+	s.router.Use(accesslog.Annotate)
+	s.router.Use(handlers.VersionMiddleware)
 }
 
-// Start starts the HTTP server
-func (s *Server) Start(port int) error {
-	addr := fmt.Sprintf(":%d", port)
+// registerAPIRoutes adds the receipt bank API endpoints to a (sub)router
+func (s *Server) registerAPIRoutes(router *mux.Router) {
+	submitBytes, batchBytes := s.handler.BodyLimits()
+	// Submissions are checked against the allowed networks first; /collect is open to any network
+	allowed := s.handler.SubmitNetworks
+	router.Handle("/submit", allowed(handlers.JSONBody(submitBytes, http.HandlerFunc(s.handler.SubmitHandler)))).Methods("POST")
+	router.Handle("/submit/batch", allowed(handlers.JSONBody(batchBytes, http.HandlerFunc(s.handler.SubmitBatchHandler)))).Methods("POST")
+	router.HandleFunc("/collect/{ephemeral_key}", s.handler.CollectHandler).Methods("GET")
+	router.HandleFunc("/collect/{ephemeral_key}", s.handler.CollectHeadHandler).Methods("HEAD")
+	router.HandleFunc("/collect/{ephemeral_key}/meta", s.handler.CollectMetaHandler).Methods("GET")
+	router.HandleFunc("/collect/{ephemeral_key}/challenge", s.handler.ChallengeHandler).Methods("POST")
+	router.HandleFunc("/health", s.handler.HealthHandler).Methods("GET")
+	router.HandleFunc("/version", s.handler.VersionHandler).Methods("GET")
+
+	router.Use(handlers.NegotiationMiddleware)
+}
+
+// EnableAdmin mounts the token-protected admin API under /v1/admin
+func (s *Server) EnableAdmin(token string) {
+	prefix := "/v" + handlers.APIVersion + "/admin"
+	auth := s.handler.AdminAuth(token)
+
+	// Snapshots travel as raw encrypted bytes, so they bypass content negotiation
+	s.router.Handle(prefix+"/snapshot", auth(http.HandlerFunc(s.handler.DownloadSnapshotHandler))).Methods("GET")
+	s.router.Handle(prefix+"/snapshot/restore", auth(http.HandlerFunc(s.handler.RestoreSnapshotHandler))).Methods("POST")
+
+	admin := s.router.PathPrefix(prefix).Subrouter()
+	admin.HandleFunc("/cleanup", s.handler.CleanupHandler).Methods("POST")
+	admin.HandleFunc("/cleanup/stats", s.handler.CleanupStatsHandler).Methods("GET")
+	admin.HandleFunc("/stats", s.handler.AdminStatsHandler).Methods("GET")
+	admin.HandleFunc("/stats/history", s.handler.UsageHistoryHandler).Methods("GET")
+	admin.HandleFunc("/receipts", s.handler.ListReceiptsHandler).Methods("GET")
+	admin.HandleFunc("/receipts/{receipt_id}", s.handler.DeleteReceiptHandler).Methods("DELETE")
+	admin.HandleFunc("/webhooks/failures", s.handler.WebhookFailuresHandler).Methods("GET")
+	admin.HandleFunc("/registers", s.handler.RegistersHandler).Methods("GET")
+	admin.HandleFunc("/registers/{id}/revoke", s.handler.RevokeRegisterHandler).Methods("POST")
+	admin.HandleFunc("/registers/{id}/reinstate", s.handler.ReinstateRegisterHandler).Methods("POST")
+	admin.HandleFunc("/snapshot", s.handler.SaveSnapshotHandler).Methods("POST")
+	admin.HandleFunc("/compact", s.handler.CompactHandler).Methods("POST")
+	admin.Use(auth)
+	admin.Use(handlers.NegotiationMiddleware)
 
 	if s.verbose {
-		log.Printf("[SERVER] Starting Receipt Bank server on port %d", port)
-		log.Printf("[SERVER] Available endpoints:")
-		log.Printf("[SERVER]   POST /submit")
-		log.Printf("[SERVER]   GET  /collect/{ephemeral_key}")
-		log.Printf("[SERVER]   GET  /health")
+		log.Printf("[SERVER] Admin API enabled at /v%s/admin/", handlers.APIVersion)
+	}
+}
+
+// EnableSockets mounts push collection at /ws/collect/{ephemeral_key}, with a /v1 alias
+func (s *Server) EnableSockets() {
+	for _, prefix := range []string{"/v" + handlers.APIVersion, ""} {
+		s.router.HandleFunc(prefix+"/ws/collect/{ephemeral_key}", s.handler.CollectSocketHandler).Methods("GET")
+	}
+
+	if s.verbose {
+		log.Printf("[SERVER] WebSocket collection enabled at /ws/collect/{ephemeral_key}")
+	}
+}
+
+// EnableTLS serves HTTPS and asks clients for a certificate, which /submit
+// accepts as cash register authentication when its fingerprint is registered
+func (s *Server) EnableTLS(certFile, keyFile string) {
+	s.certFile = certFile
+	s.keyFile = keyFile
+}
+
+// EnableCORS lets browser wallets on the policy's origins call the API cross-origin
+func (s *Server) EnableCORS(policy CORSPolicy) {
+	s.cors = newCORS(policy, s.verbose)
+
+	if s.verbose {
+		log.Printf("[SERVER] CORS enabled for origins: %s", strings.Join(policy.AllowedOrigins, ", "))
+	}
+}
+
+// EnableAccessLog writes every request to the logger's access log file
+func (s *Server) EnableAccessLog(logger *accesslog.Logger) {
+	s.accessLog = logger
+}
+
+// EnableWallet mounts the browser wallet demo page
+func (s *Server) EnableWallet(walletHandler *wallet.Handler) {
+	walletHandler.RegisterRoutes(s.router)
+
+	if s.verbose {
+		log.Printf("[SERVER] Wallet demo page enabled at /wallet/")
+	}
+}
+
+// Start serves the API on listener until it fails
+func (s *Server) Start(listener net.Listener) error {
+	if s.verbose {
+		log.Printf("[SERVER] Starting Receipt Bank server on %s", listener.Addr())
+		log.Printf("[SERVER] Available endpoints (API v%s, legacy aliases without /v%s):", handlers.APIVersion, handlers.APIVersion)
+		log.Printf("[SERVER]   POST /v%s/submit", handlers.APIVersion)
+		log.Printf("[SERVER]   GET  /v%s/collect/{ephemeral_key}", handlers.APIVersion)
+		log.Printf("[SERVER]   HEAD /v%s/collect/{ephemeral_key}", handlers.APIVersion)
+		log.Printf("[SERVER]   GET  /v%s/collect/{ephemeral_key}/meta", handlers.APIVersion)
+		log.Printf("[SERVER]   GET  /v%s/health", handlers.APIVersion)
+		log.Printf("[SERVER]   GET  /v%s/version", handlers.APIVersion)
+	}
+
+	var handler http.Handler = s.router
+	if s.cors != nil {
+		handler = s.cors.wrap(handler)
+	}
+	handler = s.accessLog.Middleware(handler)
+	if listener.Addr().Network() == NetworkUnix {
+		handler = localPeer(handler)
 	}
 
 	server := &http.Server{
-		Addr:         addr,
-		Handler:      s.router,
+		Handler:      handler,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
-	return server.ListenAndServe()
+	if s.certFile != "" {
+		// Certificates are pinned per register, so no CA verification here
+		server.TLSConfig = &tls.Config{ClientAuth: tls.RequestClientCert}
+		return server.ServeTLS(listener, s.certFile, s.keyFile)
+	}
+
+	return server.Serve(listener)
 }
 
-// loggingMiddleware logs HTTP requests
-func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
+// localPeer gives requests over a unix socket, which have no remote address, the
+// loopback address: the peer is on this host, typically the reverse proxy, so
+// submit_networks.trusted_proxies can name it
+func localPeer(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if s.verbose {
-			start := time.Now()
-
-			// Call next handler
-			next.ServeHTTP(w, r)
-
-			// Log request
-			log.Printf("[HTTP] %s %s - %v", r.Method, r.URL.Path, time.Since(start))
-		} else {
-			next.ServeHTTP(w, r)
-		}
+		r.RemoteAddr = "127.0.0.1:0"
+		next.ServeHTTP(w, r)
 	})
 }
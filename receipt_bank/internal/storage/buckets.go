@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"time"
+
+	"receipt-bank/internal/models"
+)
+
+// bucketWindow is the span of removal deadlines sharing a bucket. It equals the usage
+// resolution, so every receipt expiring out of one bucket is counted in the same hour.
+const bucketWindow = UsageBucket
+
+// receiptBucket holds the receipts due for removal within one window: uncollected
+// receipts whose ttl ends in it and collected receipts whose grace period does.
+// Once the window has passed, every receipt in the bucket is due and the whole
+// bucket is dropped at once.
+type receiptBucket struct {
+	start   time.Time
+	byKey   map[string]*models.Receipt // key: ephemeral_key
+	byID    map[string]*models.Receipt // key: receipt_id
+	pending int                        // Uncollected receipts
+}
+
+// end returns when the last receipt in the bucket is due
+func (b *receiptBucket) end() time.Time {
+	return b.start.Add(bucketWindow)
+}
+
+// receiptBuckets partitions stored receipts by removal deadline, so cleanup never
+// touches receipts that aren't due. Lookups go through the key and ID indexes to
+// the receipt's bucket. The caller must hold the storage lock.
+type receiptBuckets struct {
+	buckets map[int64]*receiptBucket  // key: unix seconds of the window start
+	byKey   map[string]*receiptBucket // key: ephemeral_key
+	byID    map[string]*receiptBucket // key: receipt_id
+	count   int
+	pending int
+}
+
+// insert files receipt under its removal deadline and returns its bucket
+func (rb *receiptBuckets) insert(receipt *models.Receipt, deadline time.Time) *receiptBucket {
+	start := deadline.UTC().Truncate(bucketWindow)
+	if rb.buckets == nil {
+		rb.buckets = make(map[int64]*receiptBucket)
+	}
+	if rb.byKey == nil {
+		rb.byKey = make(map[string]*receiptBucket)
+		rb.byID = make(map[string]*receiptBucket)
+	}
+	b, exists := rb.buckets[start.Unix()]
+	if !exists {
+		b = &receiptBucket{
+			start: start,
+			byKey: make(map[string]*models.Receipt),
+			byID:  make(map[string]*models.Receipt),
+		}
+		rb.buckets[start.Unix()] = b
+	}
+
+	b.byKey[receipt.EphemeralKey] = receipt
+	b.byID[receipt.ReceiptID] = receipt
+	rb.byKey[receipt.EphemeralKey] = b
+	rb.byID[receipt.ReceiptID] = b
+	rb.count++
+	if !receipt.IsCollected() {
+		b.pending++
+		rb.pending++
+	}
+	return b
+}
+
+// find returns the receipt stored under an ephemeral key and its bucket
+func (rb *receiptBuckets) find(ephemeralKey string) (*models.Receipt, *receiptBucket) {
+	b, exists := rb.byKey[ephemeralKey]
+	if !exists {
+		return nil, nil
+	}
+	return b.byKey[ephemeralKey], b
+}
+
+// findID returns the receipt stored under a receipt ID and its bucket
+func (rb *receiptBuckets) findID(receiptID string) (*models.Receipt, *receiptBucket) {
+	b, exists := rb.byID[receiptID]
+	if !exists {
+		return nil, nil
+	}
+	return b.byID[receiptID], b
+}
+
+// take removes receipt from bucket b, dropping the bucket once it is empty. Call it
+// before changing whether the receipt is collected.
+func (rb *receiptBuckets) take(receipt *models.Receipt, b *receiptBucket) {
+	delete(b.byKey, receipt.EphemeralKey)
+	delete(b.byID, receipt.ReceiptID)
+	delete(rb.byKey, receipt.EphemeralKey)
+	delete(rb.byID, receipt.ReceiptID)
+	rb.count--
+	if !receipt.IsCollected() {
+		b.pending--
+		rb.pending--
+	}
+	if len(b.byKey) == 0 {
+		delete(rb.buckets, b.start.Unix())
+	}
+}
+
+// drop removes a whole bucket
+func (rb *receiptBuckets) drop(b *receiptBucket) {
+	for key, receipt := range b.byKey {
+		delete(rb.byKey, key)
+		delete(rb.byID, receipt.ReceiptID)
+	}
+	delete(rb.buckets, b.start.Unix())
+	rb.count -= len(b.byKey)
+	rb.pending -= b.pending
+}
+
+// all returns every stored receipt, in no particular order
+func (rb *receiptBuckets) all() []*models.Receipt {
+	receipts := make([]*models.Receipt, 0, rb.count)
+	for _, b := range rb.buckets {
+		for _, receipt := range b.byKey {
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts
+}
+
+// each yields every stored receipt, in no particular order, without copying them out
+func (rb *receiptBuckets) each(yield func(*models.Receipt) bool) {
+	for _, b := range rb.buckets {
+		for _, receipt := range b.byKey {
+			if !yield(receipt) {
+				return
+			}
+		}
+	}
+}
+
+// deadline returns when a receipt is due for removal: the end of its grace period
+// once collected, the end of its ttl before
+func (ms *MemoryStorage) deadline(receipt *models.Receipt) time.Time {
+	if receipt.IsCollected() {
+		return receipt.CollectedAt.Add(ms.gracePeriod)
+	}
+	return receipt.Timestamp.Add(receipt.MaxAge(ms.maxReceiptAge))
+}
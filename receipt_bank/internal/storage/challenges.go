@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// maxChallengesPerKey bounds the outstanding nonces kept for one ephemeral key,
+// so repeated challenge requests can't grow the store without limit
+const maxChallengesPerKey = 8
+
+// maxChallenges bounds the outstanding nonces across all keys, since every key a
+// client makes up gets its own maxChallengesPerKey
+const maxChallenges = 100_000
+
+// ErrTooManyChallenges is returned when maxChallenges nonces are outstanding
+var ErrTooManyChallenges = errors.New("too many outstanding challenges")
+
+// ChallengeStore keeps the proof-of-possession nonces issued for /collect until
+// they are redeemed or expire. Each nonce is valid once, for one ephemeral key.
+type ChallengeStore interface {
+	IssueChallenge(ephemeralKey string, nonce []byte, ttl time.Duration) error
+	// RedeemChallenge removes the nonce and reports whether it was outstanding for the key
+	RedeemChallenge(ephemeralKey string, nonce []byte) (bool, error)
+}
+
+// MemoryChallenges is a ChallengeStore for a single instance
+type MemoryChallenges struct {
+	mu      sync.Mutex
+	pending map[string]map[string]time.Time // ephemeral key -> nonce -> expiry
+	count   int                             // Nonces in pending
+}
+
+// NewMemoryChallenges creates an empty in-memory challenge store
+func NewMemoryChallenges() *MemoryChallenges {
+	return &MemoryChallenges{
+		pending: make(map[string]map[string]time.Time),
+	}
+}
+
+// IssueChallenge records a nonce for ephemeralKey, dropping the one closest to expiry
+// past maxChallengesPerKey. It fails with ErrTooManyChallenges once maxChallenges are
+// outstanding; expired nonces are only dropped by Sweep.
+func (mc *MemoryChallenges) IssueChallenge(ephemeralKey string, nonce []byte, ttl time.Duration) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	nonces := mc.pending[ephemeralKey]
+	if len(nonces) >= maxChallengesPerKey {
+		var oldest string
+		for n, expiry := range nonces {
+			if oldest == "" || expiry.Before(nonces[oldest]) {
+				oldest = n
+			}
+		}
+		delete(nonces, oldest)
+		mc.count--
+	} else if mc.count >= maxChallenges {
+		return ErrTooManyChallenges
+	}
+
+	if nonces == nil {
+		nonces = make(map[string]time.Time)
+		mc.pending[ephemeralKey] = nonces
+	}
+	nonces[base64.StdEncoding.EncodeToString(nonce)] = time.Now().Add(ttl)
+	mc.count++
+	return nil
+}
+
+// Sweep drops the expired nonces and returns how many it dropped
+func (mc *MemoryChallenges) Sweep() int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	now := time.Now()
+	dropped := 0
+	for key, nonces := range mc.pending {
+		for n, expiry := range nonces {
+			if now.After(expiry) {
+				delete(nonces, n)
+				dropped++
+			}
+		}
+		if len(nonces) == 0 {
+			delete(mc.pending, key)
+		}
+	}
+	mc.count -= dropped
+	return dropped
+}
+
+// StartSweepRoutine sweeps expired nonces every interval
+func (mc *MemoryChallenges) StartSweepRoutine(interval time.Duration, verbose bool) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if dropped := mc.Sweep(); dropped > 0 && verbose {
+				log.Printf("[STORAGE] Dropped %d expired challenge(s)", dropped)
+			}
+		}
+	}()
+}
+
+// RedeemChallenge consumes a nonce issued for ephemeralKey
+func (mc *MemoryChallenges) RedeemChallenge(ephemeralKey string, nonce []byte) (bool, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	nonces := mc.pending[ephemeralKey]
+	n := base64.StdEncoding.EncodeToString(nonce)
+	expiry, ok := nonces[n]
+	if !ok {
+		return false, nil
+	}
+	delete(nonces, n)
+	mc.count--
+	if len(nonces) == 0 {
+		delete(mc.pending, ephemeralKey)
+	}
+	return time.Now().Before(expiry), nil
+}
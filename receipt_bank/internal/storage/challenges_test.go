@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemoryChallengesRedeemOnce(t *testing.T) {
+	mc := NewMemoryChallenges()
+	nonce := []byte("nonce-1")
+	if err := mc.IssueChallenge("key", nonce, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := mc.RedeemChallenge("other-key", nonce); ok {
+		t.Error("Redeemed a nonce issued for another key")
+	}
+	if ok, _ := mc.RedeemChallenge("key", nonce); !ok {
+		t.Error("Failed to redeem an outstanding nonce")
+	}
+	if ok, _ := mc.RedeemChallenge("key", nonce); ok {
+		t.Error("Redeemed a nonce twice")
+	}
+}
+
+func TestMemoryChallengesPerKeyLimit(t *testing.T) {
+	mc := NewMemoryChallenges()
+	for i := 0; i <= maxChallengesPerKey; i++ {
+		ttl := time.Duration(i+1) * time.Minute
+		if err := mc.IssueChallenge("key", []byte("nonce-"+strconv.Itoa(i)), ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The nonce closest to expiry made room for the last one
+	if ok, _ := mc.RedeemChallenge("key", []byte("nonce-0")); ok {
+		t.Error("Oldest nonce still outstanding past the per-key limit")
+	}
+	if ok, _ := mc.RedeemChallenge("key", []byte("nonce-"+strconv.Itoa(maxChallengesPerKey))); !ok {
+		t.Error("Newest nonce not outstanding")
+	}
+}
+
+func TestMemoryChallengesGlobalLimit(t *testing.T) {
+	mc := NewMemoryChallenges()
+	for i := 0; i < maxChallenges; i++ {
+		if err := mc.IssueChallenge("key-"+strconv.Itoa(i), []byte("nonce"), time.Minute); err != nil {
+			t.Fatalf("Challenge %d: %v", i, err)
+		}
+	}
+	if err := mc.IssueChallenge("one-more", []byte("nonce"), time.Minute); !errors.Is(err, ErrTooManyChallenges) {
+		t.Fatalf("Past the limit: got %v, want ErrTooManyChallenges", err)
+	}
+
+	// Redeeming makes room again
+	if ok, _ := mc.RedeemChallenge("key-1", []byte("nonce")); !ok {
+		t.Fatal("Failed to redeem")
+	}
+	if err := mc.IssueChallenge("one-more", []byte("nonce"), time.Minute); err != nil {
+		t.Errorf("After a redemption: %v", err)
+	}
+}
+
+func TestMemoryChallengesSweep(t *testing.T) {
+	mc := NewMemoryChallenges()
+	mc.IssueChallenge("key", []byte("expired"), -time.Second)
+	mc.IssueChallenge("key", []byte("live"), time.Minute)
+	mc.IssueChallenge("other-key", []byte("expired"), -time.Second)
+
+	if dropped := mc.Sweep(); dropped != 2 {
+		t.Errorf("Sweep dropped %d nonces, want 2", dropped)
+	}
+	if mc.count != 1 || len(mc.pending) != 1 {
+		t.Errorf("After the sweep: %d nonces under %d keys, want 1 under 1", mc.count, len(mc.pending))
+	}
+	if ok, _ := mc.RedeemChallenge("key", []byte("live")); !ok {
+		t.Error("Sweep dropped a live nonce")
+	}
+}
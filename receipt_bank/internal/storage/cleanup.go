@@ -0,0 +1,328 @@
+package storage
+
+import (
+	"container/heap"
+	"fmt"
+	"iter"
+	"log"
+	"sort"
+	"time"
+
+	"receipt-bank/internal/models"
+)
+
+// Strategy selects which receipts a cleanup run removes
+type Strategy string
+
+const (
+	// StrategyTTL removes uncollected receipts older than their TTL (max_receipt_age
+	// unless overridden on submission) and collected receipts whose grace period has elapsed
+	StrategyTTL Strategy = "ttl"
+	// StrategyCollectedFirst evicts collected receipts (oldest collection first)
+	// while the store holds more than MaxCount receipts
+	StrategyCollectedFirst Strategy = "collected-first"
+	// StrategyLRU evicts the least recently submitted or collected receipts
+	// while the store holds more than MaxCount receipts
+	StrategyLRU Strategy = "lru"
+)
+
+// Cleanup triggers recorded in run statistics
+const (
+	TriggerScheduled = "scheduled"
+	TriggerManual    = "manual"
+	TriggerCapacity  = "capacity"
+)
+
+// cleanupHistorySize is how many recent runs are kept for the admin API
+const cleanupHistorySize = 20
+
+// CleanupPolicy configures cleanup runs; strategies are applied in order
+type CleanupPolicy struct {
+	Strategies []Strategy
+	MaxCount   int // Receipt count limit for count-based strategies (0 = unlimited)
+}
+
+// DefaultCleanupPolicy returns the plain TTL sweep
+func DefaultCleanupPolicy() CleanupPolicy {
+	return CleanupPolicy{Strategies: []Strategy{StrategyTTL}}
+}
+
+// ParseStrategies validates strategy names from configuration
+func ParseStrategies(names []string) ([]Strategy, error) {
+	strategies := make([]Strategy, 0, len(names))
+	for _, name := range names {
+		switch strategy := Strategy(name); strategy {
+		case StrategyTTL, StrategyCollectedFirst, StrategyLRU:
+			strategies = append(strategies, strategy)
+		default:
+			return nil, fmt.Errorf("unknown cleanup strategy %q (valid: ttl, collected-first, lru)", name)
+		}
+	}
+	return strategies, nil
+}
+
+// evictsByCount reports whether any configured strategy enforces MaxCount
+func (p CleanupPolicy) evictsByCount() bool {
+	for _, strategy := range p.Strategies {
+		if strategy == StrategyCollectedFirst || strategy == StrategyLRU {
+			return true
+		}
+	}
+	return false
+}
+
+// CleanupRun contains statistics for one cleanup run
+type CleanupRun struct {
+	Trigger    string         `json:"trigger"`
+	StartedAt  time.Time      `json:"started_at"`
+	DurationMs float64        `json:"duration_ms"`
+	Scanned    int            `json:"scanned"`
+	Removed    int            `json:"removed"`
+	RemovedBy  map[string]int `json:"removed_by_strategy"`
+	Remaining  int            `json:"remaining"`
+}
+
+// CleanupStats aggregates cleanup runs since startup
+type CleanupStats struct {
+	Strategies   []Strategy   `json:"strategies"`
+	MaxCount     int          `json:"max_count"`
+	Runs         int          `json:"runs"`
+	TotalRemoved int          `json:"total_removed"`
+	LastRun      *CleanupRun  `json:"last_run,omitempty"`
+	RecentRuns   []CleanupRun `json:"recent_runs"`
+}
+
+type cleanupHistory struct {
+	runs         int
+	totalRemoved int
+	recent       []CleanupRun // newest last
+}
+
+// SetCleanupPolicy replaces the cleanup policy
+func (ms *MemoryStorage) SetCleanupPolicy(policy CleanupPolicy) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if len(policy.Strategies) == 0 {
+		policy.Strategies = DefaultCleanupPolicy().Strategies
+	}
+	ms.policy = policy
+}
+
+// CleanupStats returns aggregated and recent cleanup run statistics
+func (ms *MemoryStorage) CleanupStats() CleanupStats {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.cleanupStats.stats(ms.policy)
+}
+
+// runCleanup applies every configured strategy; the caller must hold the lock.
+// A capacity run, made by a submission that pushed the store over MaxCount, only
+// evicts the excess: expired receipts are left to the scheduled sweep.
+func (ms *MemoryStorage) runCleanup(trigger string) CleanupRun {
+	start := time.Now()
+	run := CleanupRun{
+		Trigger:   trigger,
+		StartedAt: start,
+		Scanned:   ms.receipts.count,
+		RemovedBy: make(map[string]int),
+	}
+
+	for _, strategy := range ms.policy.Strategies {
+		var removed int
+		switch strategy {
+		case StrategyTTL:
+			if trigger == TriggerCapacity {
+				continue
+			}
+			removed = ms.sweepTTL(start)
+		case StrategyCollectedFirst:
+			removed = ms.evictOverLimit(func(r *models.Receipt) bool { return r.IsCollected() }, byCollectedAt)
+		case StrategyLRU:
+			removed = ms.evictOverLimit(func(*models.Receipt) bool { return true }, byLastAccess)
+		}
+		run.RemovedBy[string(strategy)] += removed
+		run.Removed += removed
+	}
+
+	run.Remaining = ms.receipts.count
+	run.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+
+	if ms.verbose && (run.Removed > 0 || trigger == TriggerManual) {
+		log.Printf("[STORAGE] Cleanup (%s) scanned %d, removed %d %v in %.2fms, %d remaining",
+			trigger, run.Scanned, run.Removed, run.RemovedBy, run.DurationMs, run.Remaining)
+	}
+
+	return run
+}
+
+// record stores run statistics; the caller must hold the storage lock
+func (h *cleanupHistory) record(run CleanupRun) {
+	h.runs++
+	h.totalRemoved += run.Removed
+	h.recent = append(h.recent, run)
+	if len(h.recent) > cleanupHistorySize {
+		h.recent = h.recent[len(h.recent)-cleanupHistorySize:]
+	}
+}
+
+// stats summarizes the history under policy; the caller must hold the storage lock
+func (h *cleanupHistory) stats(policy CleanupPolicy) CleanupStats {
+	stats := CleanupStats{
+		Strategies:   policy.Strategies,
+		MaxCount:     policy.MaxCount,
+		Runs:         h.runs,
+		TotalRemoved: h.totalRemoved,
+		RecentRuns:   append([]CleanupRun{}, h.recent...),
+	}
+	if n := len(stats.RecentRuns); n > 0 {
+		last := stats.RecentRuns[n-1]
+		stats.LastRun = &last
+	}
+	return stats
+}
+
+// sweepTTL removes expired uncollected receipts and collected receipts past their grace period.
+// Buckets whose window has passed are dropped whole; only the bucket due right now is
+// checked receipt by receipt, and later buckets are not touched.
+func (ms *MemoryStorage) sweepTTL(now time.Time) int {
+	removed := 0
+
+	for _, b := range ms.receipts.buckets {
+		switch {
+		case !b.end().After(now):
+			removed += ms.dropBucket(b)
+		case !b.start.After(now):
+			removed += ms.sweepBucket(b, now)
+		}
+	}
+
+	return removed
+}
+
+// dropBucket removes a bucket whose window has passed, counting its receipts as purged
+// or expired without checking them one by one
+func (ms *MemoryStorage) dropBucket(b *receiptBucket) int {
+	ms.receipts.drop(b)
+	removed := len(b.byKey)
+	ms.purged += removed - b.pending
+	if b.pending > 0 {
+		ms.usage.at(b.start).Expired += int64(b.pending)
+	}
+
+	// Payload references and expiry callbacks still need the receipts
+	if ms.dedup != nil || ms.onExpire != nil {
+		for _, receipt := range b.byKey {
+			if ms.onExpire != nil && !receipt.IsCollected() {
+				ms.onExpire(receipt, ms.deadline(receipt))
+			}
+			ms.release(receipt)
+		}
+	}
+
+	if ms.verbose {
+		log.Printf("[STORAGE] Dropped bucket %s: purged %d collected, expired %d uncollected receipts",
+			b.start.Format(time.RFC3339), removed-b.pending, b.pending)
+	}
+
+	return removed
+}
+
+// sweepBucket removes the due receipts from the bucket whose window contains now
+func (ms *MemoryStorage) sweepBucket(b *receiptBucket, now time.Time) int {
+	removed := 0
+
+	for _, receipt := range b.byKey {
+		if receipt.IsCollected() {
+			if now.Sub(*receipt.CollectedAt) > ms.gracePeriod {
+				ms.purge(receipt, b)
+				removed++
+
+				if ms.verbose {
+					log.Printf("[STORAGE] Purged collected receipt %s (grace period elapsed)", receipt.ReceiptID)
+				}
+			}
+			continue
+		}
+
+		if receipt.IsExpired(now, ms.maxReceiptAge) {
+			ms.expire(receipt, b)
+			removed++
+
+			if ms.verbose {
+				log.Printf("[STORAGE] Cleaned up expired receipt %s (age: %v)",
+					receipt.ReceiptID, now.Sub(receipt.Timestamp))
+			}
+		}
+	}
+
+	return removed
+}
+
+// evictOverLimit removes eligible receipts in the given order until the store is within MaxCount
+func (ms *MemoryStorage) evictOverLimit(eligible func(*models.Receipt) bool, less func(a, b *models.Receipt) bool) int {
+	victims := evictionCandidates(ms.receipts.each, ms.receipts.count, ms.policy.MaxCount, eligible, less)
+	for _, receipt := range victims {
+		_, b := ms.receipts.find(receipt.EphemeralKey)
+		ms.purge(receipt, b)
+
+		if ms.verbose {
+			log.Printf("[STORAGE] Evicted receipt %s (store over %d receipts)", receipt.ReceiptID, ms.policy.MaxCount)
+		}
+	}
+
+	return len(victims)
+}
+
+// evictionCandidates picks the eligible receipts, in the given order, whose removal
+// brings count receipts within maxCount (as far as eligible receipts allow). Only the
+// excess is kept while scanning, so a store one over its limit costs one pass and no sort
+// of the whole store.
+func evictionCandidates(receipts iter.Seq[*models.Receipt], count, maxCount int, eligible func(*models.Receipt) bool, less func(a, b *models.Receipt) bool) []*models.Receipt {
+	excess := count - maxCount
+	if maxCount <= 0 || excess <= 0 {
+		return nil
+	}
+
+	// A heap with the latest of the earliest excess receipts on top
+	victims := &victimHeap{less: less}
+	for receipt := range receipts {
+		if !eligible(receipt) {
+			continue
+		}
+		if victims.Len() < excess {
+			heap.Push(victims, receipt)
+		} else if less(receipt, victims.receipts[0]) {
+			victims.receipts[0] = receipt
+			heap.Fix(victims, 0)
+		}
+	}
+
+	sort.Slice(victims.receipts, func(i, j int) bool { return less(victims.receipts[i], victims.receipts[j]) })
+	return victims.receipts
+}
+
+// victimHeap is a max-heap of eviction candidates under less
+type victimHeap struct {
+	receipts []*models.Receipt
+	less     func(a, b *models.Receipt) bool
+}
+
+func (h *victimHeap) Len() int           { return len(h.receipts) }
+func (h *victimHeap) Less(i, j int) bool { return h.less(h.receipts[j], h.receipts[i]) }
+func (h *victimHeap) Swap(i, j int)      { h.receipts[i], h.receipts[j] = h.receipts[j], h.receipts[i] }
+func (h *victimHeap) Push(x any)         { h.receipts = append(h.receipts, x.(*models.Receipt)) }
+func (h *victimHeap) Pop() any {
+	last := h.receipts[len(h.receipts)-1]
+	h.receipts = h.receipts[:len(h.receipts)-1]
+	return last
+}
+
+func byCollectedAt(a, b *models.Receipt) bool {
+	return a.CollectedAt.Before(*b.CollectedAt)
+}
+
+func byLastAccess(a, b *models.Receipt) bool {
+	return a.LastAccessedAt.Before(b.LastAccessedAt)
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"receipt-bank/internal/models"
+)
+
+func TestCapacityEvictsOnlyTheExcess(t *testing.T) {
+	ms := NewMemoryStorage(time.Hour, time.Hour, false)
+	ms.SetCleanupPolicy(CleanupPolicy{Strategies: []Strategy{StrategyTTL, StrategyLRU}, MaxCount: 3})
+
+	now := time.Now()
+	store := func(key string, age, ttl time.Duration) {
+		t.Helper()
+		receipt := &models.Receipt{EphemeralKey: key, EncryptedData: "payload", ReceiptID: "receipt-" + key, Timestamp: now.Add(-age), TTL: ttl}
+		if err := ms.Store(receipt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store("oldest", 3*time.Minute, 0)
+	store("older", 2*time.Minute, 0)
+	store("expired", time.Minute, time.Second) // Most recently submitted, but past its ttl
+	store("newest", 0, 0)
+
+	// The submission over the limit evicts one receipt, the least recently used
+	run := ms.CleanupStats().LastRun
+	if run == nil || run.Trigger != TriggerCapacity || run.Removed != 1 || run.RemovedBy[string(StrategyLRU)] != 1 {
+		t.Fatalf("Expected a capacity run evicting one receipt by lru, got %+v", run)
+	}
+	if _, err := ms.Peek("oldest"); !errors.Is(err, ErrNotFound) {
+		t.Error("Expected the least recently used receipt to be evicted")
+	}
+	for _, key := range []string{"older", "newest"} {
+		if _, err := ms.Peek(key); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+
+	// Expired receipts wait for the scheduled sweep
+	if total := ms.Stats().Total; total != 3 {
+		t.Errorf("Expected 3 receipts after the capacity run, got %d", total)
+	}
+	if run := ms.Cleanup(TriggerScheduled); run.RemovedBy[string(StrategyTTL)] != 1 {
+		t.Errorf("Expected the scheduled run to sweep the expired receipt, got %+v", run)
+	}
+}
+
+func TestEvictionCandidates(t *testing.T) {
+	base := time.Now()
+	var receipts []*models.Receipt
+	for _, minutes := range []int{5, 2, 9, 1, 7, 3} {
+		receipts = append(receipts, &models.Receipt{ReceiptID: strconv.Itoa(minutes), LastAccessedAt: base.Add(time.Duration(minutes) * time.Minute)})
+	}
+	ids := func(victims []*models.Receipt) []string {
+		var out []string
+		for _, r := range victims {
+			out = append(out, r.ReceiptID)
+		}
+		return out
+	}
+	all := func(*models.Receipt) bool { return true }
+
+	victims := evictionCandidates(slices.Values(receipts), len(receipts), 3, all, byLastAccess)
+	if want := []string{"1", "2", "3"}; !reflect.DeepEqual(ids(victims), want) {
+		t.Errorf("Expected the three least recently used in order %v, got %v", want, ids(victims))
+	}
+
+	// Only eligible receipts are evicted, even if that leaves the store over the limit
+	odd := func(r *models.Receipt) bool { return r.LastAccessedAt.Sub(base)/time.Minute%2 == 1 }
+	victims = evictionCandidates(slices.Values(receipts), len(receipts), 1, odd, byLastAccess)
+	if want := []string{"1", "3", "5", "7", "9"}; !reflect.DeepEqual(ids(victims), want) {
+		t.Errorf("Expected every eligible receipt, got %v", ids(victims))
+	}
+
+	if victims := evictionCandidates(slices.Values(receipts), len(receipts), 6, all, byLastAccess); victims != nil {
+		t.Errorf("Expected nothing to evict within the limit, got %v", ids(victims))
+	}
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+
+	"receipt-bank/internal/models"
+)
+
+// payload is an encrypted payload shared by every stored receipt that submitted identical bytes
+type payload struct {
+	data string
+	refs int
+}
+
+// DedupStats reports content-hash deduplication of encrypted payloads
+type DedupStats struct {
+	UniquePayloads int   `json:"unique_payloads"`
+	SharedPayloads int   `json:"shared_payloads"`       // Payloads currently referenced by more than one receipt
+	Duplicates     int   `json:"duplicate_submissions"` // Since startup
+	BytesSaved     int64 `json:"bytes_saved"`           // Since startup, base64 payload bytes not stored again
+}
+
+type dedupState struct {
+	payloads   map[string]*payload // key: hex SHA-256 of the base64 payload
+	duplicates int
+	bytesSaved int64
+}
+
+// EnableDeduplication stores identical encrypted payloads once, reference counted.
+// Retries that resubmit the same payload under a new receipt_id then cost no extra
+// memory, at the price of hashing every submission.
+func (ms *MemoryStorage) EnableDeduplication() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.dedup == nil {
+		ms.dedup = &dedupState{payloads: make(map[string]*payload)}
+	}
+}
+
+// DedupStats returns deduplication statistics, or nil when deduplication is off
+func (ms *MemoryStorage) DedupStats() *DedupStats {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if ms.dedup == nil {
+		return nil
+	}
+
+	stats := &DedupStats{
+		UniquePayloads: len(ms.dedup.payloads),
+		Duplicates:     ms.dedup.duplicates,
+		BytesSaved:     ms.dedup.bytesSaved,
+	}
+	for _, p := range ms.dedup.payloads {
+		if p.refs > 1 {
+			stats.SharedPayloads++
+		}
+	}
+	return stats
+}
+
+// retain points receipt at the shared copy of its payload; the caller must hold the lock
+func (ms *MemoryStorage) retain(receipt *models.Receipt) {
+	if ms.dedup == nil {
+		return
+	}
+
+	sum := sha256.Sum256([]byte(receipt.EncryptedData))
+	hash := hex.EncodeToString(sum[:])
+	receipt.PayloadHash = hash
+
+	if p, exists := ms.dedup.payloads[hash]; exists {
+		p.refs++
+		receipt.EncryptedData = p.data // Drop the submitted copy
+		ms.dedup.duplicates++
+		ms.dedup.bytesSaved += int64(len(p.data))
+
+		if ms.verbose {
+			log.Printf("[STORAGE] Receipt %s has the same payload as %d stored receipt(s); stored once",
+				receipt.ReceiptID, p.refs-1)
+		}
+		return
+	}
+
+	ms.dedup.payloads[hash] = &payload{data: receipt.EncryptedData, refs: 1}
+}
+
+// release drops receipt's reference to its payload; the caller must hold the lock
+func (ms *MemoryStorage) release(receipt *models.Receipt) {
+	if ms.dedup == nil || receipt.PayloadHash == "" {
+		return
+	}
+
+	if p, exists := ms.dedup.payloads[receipt.PayloadHash]; exists {
+		p.refs--
+		if p.refs <= 0 {
+			delete(ms.dedup.payloads, receipt.PayloadHash)
+		}
+	}
+}
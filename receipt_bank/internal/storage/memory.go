@@ -1,7 +1,6 @@
 package storage
 
 import (
-	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -10,18 +9,43 @@ import (
 )
 
 // MemoryStorage provides thread-safe in-memory storage for receipts
+//
+// Receipt lifecycle: stored -> collected -> purged. With a zero grace period
+// receipts are purged immediately on collection (one-time retrieval); otherwise
+// a collected receipt can be re-fetched until the grace period elapses.
+//
+// Receipts are partitioned by the hour they are due for removal (see receiptBuckets),
+// so the ttl cleanup drops past hours whole instead of checking every receipt.
 type MemoryStorage struct {
 	mu            sync.RWMutex
-	receipts      map[string]*models.Receipt // key: ephemeral_key
+	receipts      receiptBuckets
 	maxReceiptAge time.Duration
+	gracePeriod   time.Duration
+	recollections int
+	purged        int
+	policy        CleanupPolicy
+	cleanupStats  cleanupHistory
+	usage         usageHistory
+	dedup         *dedupState // nil when deduplication is off
+	onExpire      func(receipt *models.Receipt, expiredAt time.Time)
 	verbose       bool
 }
 
-// NewMemoryStorage creates a new in-memory storage instance
-func NewMemoryStorage(maxReceiptAge time.Duration, verbose bool) *MemoryStorage {
+// Stats contains storage statistics
+type Stats struct {
+	Total         int `json:"receipts_stored"`
+	Expired       int `json:"receipts_expired"`
+	Collected     int `json:"receipts_in_grace"`
+	Recollections int `json:"recollections"`
+	Purged        int `json:"receipts_purged"`
+}
+
+// NewMemoryStorage creates a new in-memory storage instance using the TTL cleanup strategy
+func NewMemoryStorage(maxReceiptAge, gracePeriod time.Duration, verbose bool) *MemoryStorage {
 	return &MemoryStorage{
-		receipts:      make(map[string]*models.Receipt),
 		maxReceiptAge: maxReceiptAge,
+		gracePeriod:   gracePeriod,
+		policy:        DefaultCleanupPolicy(),
 		verbose:       verbose,
 	}
 }
@@ -32,13 +56,23 @@ func (ms *MemoryStorage) Store(receipt *models.Receipt) error {
 	defer ms.mu.Unlock()
 
 	// Check for duplicate receipt ID
-	for _, existingReceipt := range ms.receipts {
-		if existingReceipt.ReceiptID == receipt.ReceiptID {
-			return fmt.Errorf("receipt_id already exists")
-		}
+	if existing, _ := ms.receipts.findID(receipt.ReceiptID); existing != nil {
+		return ErrReceiptExists
+	}
+
+	receipt.LastAccessedAt = receipt.Timestamp
+	if replaced, b := ms.receipts.find(receipt.EphemeralKey); replaced != nil {
+		ms.remove(replaced, b)
+	}
+	ms.retain(receipt)
+	ms.receipts.insert(receipt, ms.deadline(receipt))
+
+	// Enforce the count limit right away instead of waiting for the next sweep
+	if ms.policy.MaxCount > 0 && ms.receipts.count > ms.policy.MaxCount && ms.policy.evictsByCount() {
+		ms.cleanupStats.record(ms.runCleanup(TriggerCapacity))
 	}
 
-	ms.receipts[receipt.EphemeralKey] = receipt
+	ms.usage.at(time.Now()).Submitted++
 
 	if ms.verbose {
 		log.Printf("[STORAGE] Stored receipt %s (ephemeral key: %s)",
@@ -48,57 +82,96 @@ func (ms *MemoryStorage) Store(receipt *models.Receipt) error {
 	return nil
 }
 
-// Retrieve retrieves and deletes a receipt by ephemeral key
+// Retrieve retrieves a receipt by ephemeral key and marks it collected.
+// The returned copy's CollectionCount is 1 on the first collection.
 func (ms *MemoryStorage) Retrieve(ephemeralKey string) (*models.Receipt, error) {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
-	receipt, exists := ms.receipts[ephemeralKey]
+	now := time.Now()
+
+	receipt, b := ms.receipts.find(ephemeralKey)
+	exists := receipt != nil
+	if exists && receipt.IsCollected() && now.Sub(*receipt.CollectedAt) > ms.gracePeriod {
+		// Grace period elapsed but cleanup hasn't run yet
+		ms.purge(receipt, b)
+		exists = false
+	} else if exists && receipt.IsExpired(now, ms.maxReceiptAge) {
+		// A short per-receipt TTL can elapse long before the next cleanup
+		ms.expire(receipt, b)
+		exists = false
+	}
+
 	if !exists {
 		if ms.verbose {
 			log.Printf("[STORAGE] Receipt not found for ephemeral key: %s", ephemeralKey)
-			log.Printf("[STORAGE] Available keys: %d", len(ms.receipts))
-			for key := range ms.receipts {
-				log.Printf("[STORAGE]   Available key: %s", key)
+			log.Printf("[STORAGE] Available keys: %d", ms.receipts.count)
+			for _, available := range ms.receipts.all() {
+				log.Printf("[STORAGE]   Available key: %s", available.EphemeralKey)
 			}
 		}
-		return nil, fmt.Errorf("receipt not found")
+		return nil, ErrNotFound
 	}
 
-	// Delete the receipt after retrieval (one-time collection)
-	delete(ms.receipts, ephemeralKey)
+	if receipt.IsCollected() {
+		ms.recollections++
+	} else {
+		// From now on the receipt is due at the end of its grace period
+		ms.receipts.take(receipt, b)
+		receipt.CollectedAt = &now
+		b = ms.receipts.insert(receipt, ms.deadline(receipt))
 
-	if ms.verbose {
-		log.Printf("[STORAGE] Retrieved and deleted receipt %s (ephemeral key: %s)",
-			receipt.ReceiptID, ephemeralKey)
+		bucket := ms.usage.at(now)
+		bucket.Collected++
+		bucket.CollectionMs += now.Sub(receipt.Timestamp).Milliseconds()
 	}
+	receipt.CollectionCount++
+	receipt.LastAccessedAt = now
+
+	result := *receipt
+
+	if ms.gracePeriod <= 0 {
+		// One-time collection
+		ms.purge(receipt, b)
 
-	return receipt, nil
+		if ms.verbose {
+			log.Printf("[STORAGE] Retrieved and deleted receipt %s (ephemeral key: %s)",
+				receipt.ReceiptID, ephemeralKey)
+		}
+	} else if ms.verbose {
+		log.Printf("[STORAGE] Retrieved receipt %s (collection #%d, purged after %v)",
+			receipt.ReceiptID, receipt.CollectionCount, ms.gracePeriod)
+	}
+
+	return &result, nil
 }
 
-// Cleanup removes expired receipts
-func (ms *MemoryStorage) Cleanup() {
+// Peek returns a copy of the receipt stored under an ephemeral key without
+// collecting it, for polling wallets; it never logs a miss
+func (ms *MemoryStorage) Peek(ephemeralKey string) (*models.Receipt, error) {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
 	now := time.Now()
-	removed := 0
+	receipt, _ := ms.receipts.find(ephemeralKey)
+	if receipt == nil || receipt.IsExpired(now, ms.maxReceiptAge) ||
+		(receipt.IsCollected() && now.Sub(*receipt.CollectedAt) > ms.gracePeriod) {
+		// Expired receipts are left to Retrieve or the next cleanup
+		return nil, ErrNotFound
+	}
 
-	for ephemeralKey, receipt := range ms.receipts {
-		if now.Sub(receipt.Timestamp) > ms.maxReceiptAge {
-			delete(ms.receipts, ephemeralKey)
-			removed++
+	result := *receipt
+	return &result, nil
+}
 
-			if ms.verbose {
-				log.Printf("[STORAGE] Cleaned up expired receipt %s (age: %v)",
-					receipt.ReceiptID, now.Sub(receipt.Timestamp))
-			}
-		}
-	}
+// Cleanup runs the configured cleanup strategies and returns the run statistics
+func (ms *MemoryStorage) Cleanup(trigger string) CleanupRun {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
 
-	if ms.verbose && removed > 0 {
-		log.Printf("[STORAGE] Cleanup completed: removed %d expired receipts", removed)
-	}
+	run := ms.runCleanup(trigger)
+	ms.cleanupStats.record(run)
+	return run
 }
 
 // StartCleanupRoutine starts a background routine to clean up expired receipts
@@ -108,29 +181,102 @@ func (ms *MemoryStorage) StartCleanupRoutine(interval time.Duration) {
 		defer ticker.Stop()
 
 		for range ticker.C {
-			ms.Cleanup()
+			ms.Cleanup(TriggerScheduled)
 		}
 	}()
 
 	if ms.verbose {
-		log.Printf("[STORAGE] Started cleanup routine (interval: %v)", interval)
+		log.Printf("[STORAGE] Started cleanup routine (interval: %v, strategies: %v)", interval, ms.policy.Strategies)
 	}
 }
 
 // Stats returns storage statistics
-func (ms *MemoryStorage) Stats() (int, int) {
+func (ms *MemoryStorage) Stats() Stats {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 
 	now := time.Now()
-	total := len(ms.receipts)
-	expired := 0
+	stats := Stats{
+		Total:         ms.receipts.count,
+		Collected:     ms.receipts.count - ms.receipts.pending,
+		Recollections: ms.recollections,
+		Purged:        ms.purged,
+	}
 
-	for _, receipt := range ms.receipts {
-		if now.Sub(receipt.Timestamp) > ms.maxReceiptAge {
-			expired++
+	// Waiting receipts are all expired in past buckets and none in future ones
+	for _, b := range ms.receipts.buckets {
+		switch {
+		case !b.end().After(now):
+			stats.Expired += b.pending
+		case !b.start.After(now):
+			for _, receipt := range b.byKey {
+				if receipt.IsExpired(now, ms.maxReceiptAge) {
+					stats.Expired++
+				}
+			}
 		}
 	}
 
-	return total, expired
+	return stats
+}
+
+// List returns the metadata of every stored receipt, oldest first
+func (ms *MemoryStorage) List() ([]ReceiptInfo, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	infos := make([]ReceiptInfo, 0, ms.receipts.count)
+	for _, receipt := range ms.receipts.all() {
+		infos = append(infos, newReceiptInfo(receipt, ms.maxReceiptAge, ms.gracePeriod))
+	}
+	sortReceiptInfos(infos)
+	return infos, nil
+}
+
+// Delete removes a receipt by receipt ID, collected or not
+func (ms *MemoryStorage) Delete(receiptID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	receipt, b := ms.receipts.findID(receiptID)
+	if receipt == nil {
+		return ErrNotFound
+	}
+	ms.remove(receipt, b)
+	if ms.verbose {
+		log.Printf("[STORAGE] Deleted receipt %s", receiptID)
+	}
+	return nil
+}
+
+// purge removes a collected receipt; the caller must hold the lock
+func (ms *MemoryStorage) purge(receipt *models.Receipt, b *receiptBucket) {
+	ms.remove(receipt, b)
+	ms.purged++
+}
+
+// expire removes an uncollected receipt whose TTL elapsed, counting it in the
+// hour it expired; the caller must hold the lock
+func (ms *MemoryStorage) expire(receipt *models.Receipt, b *receiptBucket) {
+	expiredAt := ms.deadline(receipt)
+	ms.usage.at(expiredAt).Expired++
+	if ms.onExpire != nil {
+		ms.onExpire(receipt, expiredAt)
+	}
+	ms.remove(receipt, b)
+}
+
+// WatchExpiries calls notify for every receipt that expires uncollected, with the time
+// its ttl elapsed. notify runs under the storage lock and must not block.
+func (ms *MemoryStorage) WatchExpiries(notify func(receipt *models.Receipt, expiredAt time.Time)) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.onExpire = notify
+}
+
+// remove deletes a receipt from its bucket and releases its payload; the caller must
+// hold the lock
+func (ms *MemoryStorage) remove(receipt *models.Receipt, b *receiptBucket) {
+	ms.receipts.take(receipt, b)
+	ms.release(receipt)
 }
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"receipt-bank/internal/models"
+)
+
+// benchReceipts is the store size the benchmarks run against
+const benchReceipts = 1_000_000
+
+// fillStorage stores n uncollected receipts submitted over the past day, so they fall
+// due across the next day's buckets
+func fillStorage(b *testing.B, ms *MemoryStorage, n int) {
+	b.Helper()
+	now := time.Now()
+	for i := 0; i < n; i++ {
+		receipt := &models.Receipt{
+			EphemeralKey:  "key-" + strconv.Itoa(i),
+			EncryptedData: "payload",
+			ReceiptID:     "receipt-" + strconv.Itoa(i),
+			Timestamp:     now.Add(-time.Duration(i%(24*60)) * time.Minute),
+		}
+		if err := ms.Store(receipt); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCleanup compares ttl sweeps removing 10k expired receipts from stores of 10k to
+// 1M: a flat map scanned receipt by receipt, the layout before buckets, against the buckets
+func BenchmarkCleanup(b *testing.B) {
+	const maxAge, grace = 24 * time.Hour, time.Hour
+
+	for _, size := range []int{10_000, 100_000, benchReceipts} {
+		ms := NewMemoryStorage(maxAge, grace, false)
+		fillStorage(b, ms, size)
+		flat := make(map[string]*models.Receipt, size)
+		for _, receipt := range ms.receipts.all() {
+			flat[receipt.EphemeralKey] = receipt
+		}
+
+		b.Run(strconv.Itoa(size)+"/flat", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				for _, receipt := range expiredReceipts(i) {
+					flat[receipt.EphemeralKey] = receipt
+				}
+				b.StartTimer()
+
+				if removed := sweepFlat(flat, time.Now(), maxAge, grace); removed != 10_000 {
+					b.Fatalf("Expected 10000 receipts removed, got %d", removed)
+				}
+			}
+		})
+		b.Run(strconv.Itoa(size)+"/buckets", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				for _, receipt := range expiredReceipts(i) {
+					ms.Store(receipt)
+				}
+				b.StartTimer()
+
+				if run := ms.Cleanup(TriggerManual); run.Removed != 10_000 {
+					b.Fatalf("Expected 10000 receipts removed, got %d", run.Removed)
+				}
+			}
+		})
+	}
+}
+
+// expiredReceipts returns batch n of 10k receipts submitted 26 hours ago
+func expiredReceipts(n int) []*models.Receipt {
+	expired := time.Now().Add(-26 * time.Hour)
+	receipts := make([]*models.Receipt, 10_000)
+	for i := range receipts {
+		id := strconv.Itoa(n) + "-" + strconv.Itoa(i)
+		receipts[i] = &models.Receipt{
+			EphemeralKey:  "expired-key-" + id,
+			EncryptedData: "payload",
+			ReceiptID:     "expired-" + id,
+			Timestamp:     expired,
+		}
+	}
+	return receipts
+}
+
+// sweepFlat is the ttl sweep over a flat map before buckets: every receipt is checked
+func sweepFlat(receipts map[string]*models.Receipt, now time.Time, maxAge, grace time.Duration) int {
+	removed := 0
+	for key, receipt := range receipts {
+		if receipt.IsCollected() && now.Sub(*receipt.CollectedAt) > grace || receipt.IsExpired(now, maxAge) {
+			delete(receipts, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// BenchmarkPeek measures a key lookup in a store of 1M receipts
+func BenchmarkPeek(b *testing.B) {
+	ms := NewMemoryStorage(24*time.Hour, time.Hour, false)
+	fillStorage(b, ms, benchReceipts)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := ms.Peek("key-" + strconv.Itoa(i%benchReceipts)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLookup compares lookups in a store of 1M receipts: a flat map keyed by
+// ephemeral key, the layout before buckets, against the buckets and their indexes
+func BenchmarkLookup(b *testing.B) {
+	ms := NewMemoryStorage(24*time.Hour, time.Hour, false)
+	fillStorage(b, ms, benchReceipts)
+	flat := make(map[string]*models.Receipt, benchReceipts)
+	for _, receipt := range ms.receipts.all() {
+		flat[receipt.EphemeralKey] = receipt
+	}
+
+	b.Run("flat", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if flat["key-"+strconv.Itoa(i%benchReceipts)] == nil {
+				b.Fatal("receipt not found")
+			}
+		}
+	})
+	b.Run("buckets/key", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if receipt, _ := ms.receipts.find("key-" + strconv.Itoa(i%benchReceipts)); receipt == nil {
+				b.Fatal("receipt not found")
+			}
+		}
+	})
+	b.Run("buckets/id", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if receipt, _ := ms.receipts.findID("receipt-" + strconv.Itoa(i%benchReceipts)); receipt == nil {
+				b.Fatal("receipt not found")
+			}
+		}
+	})
+}
+
+// BenchmarkStore measures submissions into a store of 1M receipts
+func BenchmarkStore(b *testing.B) {
+	ms := NewMemoryStorage(24*time.Hour, time.Hour, false)
+	fillStorage(b, ms, benchReceipts)
+	now := time.Now()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err := ms.Store(&models.Receipt{
+			EphemeralKey:  "new-key-" + strconv.Itoa(i),
+			EncryptedData: "payload",
+			ReceiptID:     "new-" + strconv.Itoa(i),
+			Timestamp:     now,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,770 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"receipt-bank/internal/models"
+)
+
+// Redis key layout below KeyPrefix
+const (
+	redisReceiptKey   = "receipt:"    // + ephemeral_key -> receipt JSON
+	redisReceiptIDKey = "receipt-id:" // + receipt_id -> ephemeral_key (duplicate detection)
+	redisStatsKey     = "stats"       // hash of shared counters
+	redisCleanupLock  = "cleanup-lock"
+	redisChallengeKey = "challenge:" // + ephemeral_key + ":" + hex nonce, expires with the challenge
+	redisSubmitted    = "submitted"  // pub/sub channel carrying the ephemeral key of each stored receipt
+	redisUsageKey     = "usage:"     // + unix seconds of an hour -> hash of that hour's usage counters
+	redisPendingKey   = "pending"    // sorted set of uncollected receipt IDs scored by expiry (unix ms)
+	redisCollectedKey = "collected"  // sorted set of collected receipt IDs scored by purge time (unix ms)
+)
+
+const (
+	redisScanBatch = 100
+	// redisTxRetries bounds optimistic retries when instances collect the same receipt at once
+	redisTxRetries = 5
+	// redisExpirySlack keeps the usage sweep from counting a receipt as expired
+	// before Redis has actually dropped it
+	redisExpirySlack = time.Second
+)
+
+// RedisOptions configures the connection to a Redis server shared by every receipt bank instance
+type RedisOptions struct {
+	Address      string
+	Username     string
+	Password     string
+	DB           int
+	KeyPrefix    string
+	PoolSize     int // Connections per instance (0 = go-redis default of 10 per CPU)
+	MinIdleConns int
+	MaxRetries   int // Retries of a failed command (0 = go-redis default, -1 = none)
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+// RedisStorage keeps receipts in Redis so several receipt bank instances behind a
+// load balancer share them: a receipt submitted through one instance can be
+// collected through any other.
+//
+// Expiry is native: a receipt is written with its TTL (max_receipt_age unless the
+// submission overrides it) and the TTL is reset to the grace period on first
+// collection, so the TTL strategy has nothing left to sweep. Count-based
+// strategies still run, from one instance at a time. Requires Redis 6.2 or newer.
+type RedisStorage struct {
+	client        *redis.Client
+	prefix        string
+	maxReceiptAge time.Duration
+	gracePeriod   time.Duration
+	instance      string // Cleanup lock owner
+
+	mu           sync.RWMutex // Guards the per-instance fields below
+	policy       CleanupPolicy
+	cleanupStats cleanupHistory
+	retention    time.Duration // Usage buckets
+	onExpire     func(receipt *models.Receipt, expiredAt time.Time)
+	verbose      bool
+}
+
+// NewRedisStorage connects to Redis and verifies the server is reachable
+func NewRedisStorage(opts RedisOptions, maxReceiptAge, gracePeriod time.Duration, verbose bool) (*RedisStorage, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:         opts.Address,
+		Username:     opts.Username,
+		Password:     opts.Password,
+		DB:           opts.DB,
+		PoolSize:     opts.PoolSize,
+		MinIdleConns: opts.MinIdleConns,
+		MaxRetries:   opts.MaxRetries,
+		DialTimeout:  opts.DialTimeout,
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+	})
+
+	hostname, _ := os.Hostname()
+	rs := &RedisStorage{
+		client:        client,
+		prefix:        opts.KeyPrefix,
+		maxReceiptAge: maxReceiptAge,
+		gracePeriod:   gracePeriod,
+		instance:      fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		policy:        DefaultCleanupPolicy(),
+		retention:     DefaultUsageRetention,
+		verbose:       verbose,
+	}
+
+	if err := rs.Ping(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Ping reports whether the Redis server is reachable
+func (rs *RedisStorage) Ping() error {
+	if err := rs.client.Ping(context.Background()).Err(); err != nil {
+		return unavailable(err)
+	}
+	return nil
+}
+
+// Close releases the connection pool
+func (rs *RedisStorage) Close() error {
+	return rs.client.Close()
+}
+
+// SetCleanupPolicy replaces the cleanup policy of this instance
+func (rs *RedisStorage) SetCleanupPolicy(policy CleanupPolicy) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if len(policy.Strategies) == 0 {
+		policy.Strategies = DefaultCleanupPolicy().Strategies
+	}
+	rs.policy = policy
+}
+
+// SetUsageRetention sets how long hourly usage buckets are kept. Buckets expire in
+// Redis, so instances should agree on it.
+func (rs *RedisStorage) SetUsageRetention(retention time.Duration) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if retention <= 0 {
+		retention = DefaultUsageRetention
+	}
+	rs.retention = retention
+}
+
+// Store stores a receipt indexed by ephemeral key
+func (rs *RedisStorage) Store(receipt *models.Receipt) error {
+	ctx := context.Background()
+
+	receipt.LastAccessedAt = receipt.Timestamp
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		return fmt.Errorf("failed to encode receipt: %v", err)
+	}
+
+	// Claim the receipt ID first; it lives exactly as long as the receipt
+	idKey := rs.receiptIDKey(receipt.ReceiptID)
+	ttl := receipt.MaxAge(rs.maxReceiptAge)
+	claimed, err := rs.client.SetNX(ctx, idKey, receipt.EphemeralKey, ttl).Result()
+	if err != nil {
+		return unavailable(err)
+	}
+	if !claimed {
+		return ErrReceiptExists
+	}
+
+	previous, err := rs.client.SetArgs(ctx, rs.receiptKey(receipt.EphemeralKey), data,
+		redis.SetArgs{TTL: ttl, Get: true}).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		rs.client.Del(ctx, idKey)
+		return unavailable(err)
+	}
+
+	// A resubmission under the same ephemeral key frees the replaced receipt's ID
+	if previous != "" {
+		var replaced models.Receipt
+		if json.Unmarshal([]byte(previous), &replaced) == nil && replaced.ReceiptID != receipt.ReceiptID {
+			rs.client.Del(ctx, rs.receiptIDKey(replaced.ReceiptID))
+			rs.client.ZRem(ctx, rs.pendingKey(), replaced.ReceiptID)
+			rs.client.ZRem(ctx, rs.collectedKey(), replaced.ReceiptID)
+		}
+	}
+
+	// Track the receipt until it is collected, so its expiry can be counted
+	now := time.Now()
+	pipe := rs.client.Pipeline()
+	pipe.ZAdd(ctx, rs.pendingKey(), redis.Z{Score: float64(now.Add(ttl).UnixMilli()), Member: receipt.ReceiptID})
+	rs.countUsage(ctx, pipe, now, "submitted", 1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[STORAGE] Failed to record usage for receipt %s: %v", receipt.ReceiptID, err)
+	}
+
+	if err := rs.client.Publish(ctx, rs.prefix+redisSubmitted, receipt.EphemeralKey).Err(); err != nil {
+		log.Printf("[STORAGE] Failed to announce receipt %s: %v", receipt.ReceiptID, err)
+	}
+
+	if rs.verbose {
+		log.Printf("[STORAGE] Stored receipt %s in Redis (ephemeral key: %s)",
+			receipt.ReceiptID, receipt.EphemeralKey)
+	}
+
+	// Count limits are enforced by the scheduled cleanup: counting the shared
+	// store on every submission would scan the whole keyspace
+	return nil
+}
+
+// Retrieve retrieves a receipt by ephemeral key and marks it collected.
+// The update is an optimistic transaction, so concurrent collections through
+// different instances are counted exactly once each.
+func (rs *RedisStorage) Retrieve(ephemeralKey string) (*models.Receipt, error) {
+	ctx := context.Background()
+	key := rs.receiptKey(ephemeralKey)
+
+	var result *models.Receipt
+	collect := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var receipt models.Receipt
+		if err := json.Unmarshal(data, &receipt); err != nil {
+			return fmt.Errorf("corrupt receipt under %s: %v", key, err)
+		}
+
+		now := time.Now()
+		recollected := receipt.IsCollected()
+		if !recollected {
+			receipt.CollectedAt = &now
+		}
+		receipt.CollectionCount++
+		receipt.LastAccessedAt = now
+
+		updated, err := json.Marshal(&receipt)
+		if err != nil {
+			return fmt.Errorf("failed to encode receipt: %v", err)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if recollected {
+				pipe.HIncrBy(ctx, rs.statsKey(), "recollections", 1)
+			} else {
+				pipe.ZRem(ctx, rs.pendingKey(), receipt.ReceiptID)
+				rs.countUsage(ctx, pipe, now, "collected", 1)
+				rs.countUsage(ctx, pipe, now, "collection_ms", now.Sub(receipt.Timestamp).Milliseconds())
+			}
+			switch {
+			case rs.gracePeriod <= 0:
+				// One-time collection
+				pipe.Del(ctx, key, rs.receiptIDKey(receipt.ReceiptID))
+				pipe.HIncrBy(ctx, rs.statsKey(), "purged", 1)
+			case recollected:
+				pipe.SetArgs(ctx, key, updated, redis.SetArgs{KeepTTL: true})
+			default:
+				// The grace period starts now; Redis purges the receipt when it elapses
+				pipe.Set(ctx, key, updated, rs.gracePeriod)
+				pipe.Expire(ctx, rs.receiptIDKey(receipt.ReceiptID), rs.gracePeriod)
+				pipe.ZAdd(ctx, rs.collectedKey(), redis.Z{Score: float64(now.Add(rs.gracePeriod).UnixMilli()), Member: receipt.ReceiptID})
+			}
+			return nil
+		})
+		if err == nil {
+			result = &receipt
+		}
+		return err
+	}
+
+	var err error
+	for attempt := 0; attempt < redisTxRetries; attempt++ {
+		err = rs.client.Watch(ctx, collect, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotFound):
+		if rs.verbose {
+			log.Printf("[STORAGE] Receipt not found in Redis for ephemeral key: %s", ephemeralKey)
+		}
+		return nil, ErrNotFound
+	case errors.Is(err, redis.TxFailedErr):
+		return nil, fmt.Errorf("%w: receipt %s is being collected concurrently", ErrUnavailable, ephemeralKey)
+	default:
+		return nil, unavailable(err)
+	}
+
+	if rs.verbose {
+		if rs.gracePeriod <= 0 {
+			log.Printf("[STORAGE] Retrieved and deleted receipt %s (ephemeral key: %s)",
+				result.ReceiptID, ephemeralKey)
+		} else {
+			log.Printf("[STORAGE] Retrieved receipt %s (collection #%d, purged after %v)",
+				result.ReceiptID, result.CollectionCount, rs.gracePeriod)
+		}
+	}
+
+	return result, nil
+}
+
+// Peek returns the receipt stored under an ephemeral key without collecting it
+func (rs *RedisStorage) Peek(ephemeralKey string) (*models.Receipt, error) {
+	key := rs.receiptKey(ephemeralKey)
+	data, err := rs.client.Get(context.Background(), key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, unavailable(err)
+	}
+
+	var receipt models.Receipt
+	if err := json.Unmarshal(data, &receipt); err != nil {
+		return nil, fmt.Errorf("corrupt receipt under %s: %v", key, err)
+	}
+	return &receipt, nil
+}
+
+// Cleanup runs the configured cleanup strategies against the shared store.
+// TTL is a no-op because Redis expires receipts itself; run statistics are
+// kept per instance.
+func (rs *RedisStorage) Cleanup(trigger string) CleanupRun {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	ctx := context.Background()
+	start := time.Now()
+	run := CleanupRun{
+		Trigger:   trigger,
+		StartedAt: start,
+		RemovedBy: make(map[string]int),
+	}
+
+	receipts, err := rs.loadAll(ctx)
+	if err != nil {
+		log.Printf("[STORAGE] Cleanup (%s) failed to scan Redis: %v", trigger, err)
+	}
+	run.Scanned = len(receipts)
+
+	for _, strategy := range rs.policy.Strategies {
+		var victims []*models.Receipt
+		switch strategy {
+		case StrategyCollectedFirst:
+			victims = evictionCandidates(slices.Values(receipts), len(receipts), rs.policy.MaxCount,
+				func(r *models.Receipt) bool { return r.IsCollected() }, byCollectedAt)
+		case StrategyLRU:
+			victims = evictionCandidates(slices.Values(receipts), len(receipts), rs.policy.MaxCount,
+				func(*models.Receipt) bool { return true }, byLastAccess)
+		}
+		if len(victims) == 0 {
+			continue
+		}
+
+		removed := rs.evict(ctx, victims)
+		receipts = without(receipts, victims)
+		run.RemovedBy[string(strategy)] += removed
+		run.Removed += removed
+	}
+
+	run.Remaining = len(receipts)
+	run.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	rs.cleanupStats.record(run)
+
+	if rs.verbose && (run.Removed > 0 || trigger == TriggerManual) {
+		log.Printf("[STORAGE] Cleanup (%s) scanned %d, removed %d %v in %.2fms, %d remaining",
+			trigger, run.Scanned, run.Removed, run.RemovedBy, run.DurationMs, run.Remaining)
+	}
+
+	return run
+}
+
+// CleanupStats returns this instance's aggregated and recent cleanup run statistics
+func (rs *RedisStorage) CleanupStats() CleanupStats {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	return rs.cleanupStats.stats(rs.policy)
+}
+
+// StartCleanupRoutine starts the background count-limit sweep. Each tick only the
+// instance holding the shared cleanup lock runs it, so replicas don't race to
+// evict the same receipts.
+func (rs *RedisStorage) StartCleanupRoutine(interval time.Duration) {
+	rs.mu.RLock()
+	policy := rs.policy
+	rs.mu.RUnlock()
+
+	if !policy.evictsByCount() || policy.MaxCount <= 0 {
+		if rs.verbose {
+			log.Printf("[STORAGE] No cleanup routine needed: Redis expires receipts natively")
+		}
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			// The lock expires before the next tick so any instance may take the next run
+			acquired, err := rs.client.SetNX(context.Background(), rs.prefix+redisCleanupLock, rs.instance, interval/2).Result()
+			if err != nil {
+				log.Printf("[STORAGE] Skipping scheduled cleanup: %v", err)
+				continue
+			}
+			if acquired {
+				rs.Cleanup(TriggerScheduled)
+			}
+		}
+	}()
+
+	if rs.verbose {
+		log.Printf("[STORAGE] Started cleanup routine (interval: %v, strategies: %v)", interval, policy.Strategies)
+	}
+}
+
+// Stats returns statistics for the shared store from the pending and collected sets,
+// without scanning the receipts. Expired is always zero because Redis drops expired
+// receipts itself.
+func (rs *RedisStorage) Stats() Stats {
+	ctx := context.Background()
+	var stats Stats
+
+	// Entries scored before now belong to receipts Redis has dropped or is about to
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	pipe := rs.client.Pipeline()
+	pending := pipe.ZCount(ctx, rs.pendingKey(), "("+now, "+inf")
+	pipe.ZRemRangeByScore(ctx, rs.collectedKey(), "-inf", now)
+	collected := pipe.ZCard(ctx, rs.collectedKey())
+	counters := pipe.HGetAll(ctx, rs.statsKey())
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[STORAGE] Failed to read Redis counters: %v", err)
+		return stats
+	}
+
+	stats.Collected = int(collected.Val())
+	stats.Total = int(pending.Val()) + stats.Collected
+	fmt.Sscan(counters.Val()["recollections"], &stats.Recollections)
+	fmt.Sscan(counters.Val()["purged"], &stats.Purged)
+
+	return stats
+}
+
+// List returns the metadata of every stored receipt, oldest first
+func (rs *RedisStorage) List() ([]ReceiptInfo, error) {
+	receipts, err := rs.loadAll(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]ReceiptInfo, 0, len(receipts))
+	for _, receipt := range receipts {
+		infos = append(infos, newReceiptInfo(receipt, rs.maxReceiptAge, rs.gracePeriod))
+	}
+	sortReceiptInfos(infos)
+	return infos, nil
+}
+
+// Delete removes a receipt by receipt ID, collected or not
+func (rs *RedisStorage) Delete(receiptID string) error {
+	ctx := context.Background()
+	idKey := rs.receiptIDKey(receiptID)
+
+	ephemeralKey, err := rs.client.Get(ctx, idKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return unavailable(err)
+	}
+
+	deleted, err := rs.client.Del(ctx, rs.receiptKey(ephemeralKey), idKey).Result()
+	if err != nil {
+		return unavailable(err)
+	}
+	if deleted < 2 {
+		return ErrNotFound // Collected or expired meanwhile
+	}
+	rs.client.ZRem(ctx, rs.pendingKey(), receiptID)
+	rs.client.ZRem(ctx, rs.collectedKey(), receiptID)
+
+	if rs.verbose {
+		log.Printf("[STORAGE] Deleted receipt %s from Redis", receiptID)
+	}
+	return nil
+}
+
+// WatchSubmissions calls notify with the ephemeral key of every receipt stored through
+// any instance, so collectors waiting on this instance hear about them. The
+// subscription reconnects by itself after Redis outages.
+func (rs *RedisStorage) WatchSubmissions(notify func(ephemeralKey string)) {
+	pubsub := rs.client.Subscribe(context.Background(), rs.prefix+redisSubmitted)
+	go func() {
+		for message := range pubsub.Channel() {
+			notify(message.Payload)
+		}
+	}()
+}
+
+// IssueChallenge records a proof-of-possession nonce, so any instance can redeem it
+func (rs *RedisStorage) IssueChallenge(ephemeralKey string, nonce []byte, ttl time.Duration) error {
+	if err := rs.client.Set(context.Background(), rs.challengeKey(ephemeralKey, nonce), 1, ttl).Err(); err != nil {
+		return unavailable(err)
+	}
+	return nil
+}
+
+// RedeemChallenge deletes the nonce; only the instance whose DEL removed it may accept the proof
+func (rs *RedisStorage) RedeemChallenge(ephemeralKey string, nonce []byte) (bool, error) {
+	deleted, err := rs.client.Del(context.Background(), rs.challengeKey(ephemeralKey, nonce)).Result()
+	if err != nil {
+		return false, unavailable(err)
+	}
+	return deleted == 1, nil
+}
+
+// Usage returns the hourly usage buckets between from and to, oldest first, after
+// counting receipts that expired uncollected since the last call. Hours without
+// activity are left out.
+func (rs *RedisStorage) Usage(from, to time.Time) ([]Usage, error) {
+	ctx := context.Background()
+	if err := rs.sweepExpired(ctx); err != nil {
+		return nil, unavailable(err)
+	}
+
+	start := usageHour(from)
+	if cutoff := usageHour(time.Now().Add(-rs.usageRetention())); start.Before(cutoff) {
+		start = cutoff
+	}
+
+	var hours []time.Time
+	var cmds []*redis.MapStringStringCmd
+	pipe := rs.client.Pipeline()
+	for hour := start; hour.Before(to); hour = hour.Add(UsageBucket) {
+		hours = append(hours, hour)
+		cmds = append(cmds, pipe.HGetAll(ctx, rs.usageKey(hour)))
+	}
+	usage := []Usage{}
+	if len(cmds) == 0 {
+		return usage, nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, unavailable(err)
+	}
+
+	for i, cmd := range cmds {
+		counters := cmd.Val()
+		if len(counters) == 0 {
+			continue
+		}
+		bucket := Usage{Start: hours[i]}
+		fmt.Sscan(counters["submitted"], &bucket.Submitted)
+		fmt.Sscan(counters["collected"], &bucket.Collected)
+		fmt.Sscan(counters["collection_ms"], &bucket.CollectionMs)
+		fmt.Sscan(counters["expired"], &bucket.Expired)
+		fmt.Sscan(counters["webhooks_delivered"], &bucket.WebhooksDelivered)
+		fmt.Sscan(counters["webhooks_failed"], &bucket.WebhooksFailed)
+		usage = append(usage, bucket)
+	}
+	return usage, nil
+}
+
+// RecordWebhook counts a collection notification that was delivered or failed after every retry
+func (rs *RedisStorage) RecordWebhook(delivered bool) {
+	ctx := context.Background()
+	field := "webhooks_failed"
+	if delivered {
+		field = "webhooks_delivered"
+	}
+
+	pipe := rs.client.Pipeline()
+	rs.countUsage(ctx, pipe, time.Now(), field, 1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[STORAGE] Failed to record webhook usage: %v", err)
+	}
+}
+
+// sweepExpired counts receipts whose TTL elapsed uncollected in the hour they expired.
+// Only the instance whose ZREM removes a receipt from the pending set counts it.
+func (rs *RedisStorage) sweepExpired(ctx context.Context) error {
+	due, err := rs.client.ZRangeByScoreWithScores(ctx, rs.pendingKey(), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Add(-redisExpirySlack).UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, receipt := range due {
+		removed, err := rs.client.ZRem(ctx, rs.pendingKey(), receipt.Member).Result()
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			continue // Collected or counted by another instance meanwhile
+		}
+
+		expiredAt := time.UnixMilli(int64(receipt.Score))
+		pipe := rs.client.Pipeline()
+		rs.countUsage(ctx, pipe, expiredAt, "expired", 1)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+
+		rs.mu.RLock()
+		onExpire := rs.onExpire
+		rs.mu.RUnlock()
+		if onExpire != nil {
+			// Redis dropped the receipt already: only its ID and expiry are known
+			onExpire(&models.Receipt{ReceiptID: fmt.Sprint(receipt.Member)}, expiredAt)
+		}
+	}
+	return nil
+}
+
+// WatchExpiries calls notify for every receipt this instance counts as expired. Redis
+// has dropped the receipt by then, so notify gets one with only its ID set.
+func (rs *RedisStorage) WatchExpiries(notify func(receipt *models.Receipt, expiredAt time.Time)) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.onExpire = notify
+}
+
+// countUsage queues an increment of a counter in the hour bucket holding at; the
+// bucket expires once it falls out of the usage retention
+func (rs *RedisStorage) countUsage(ctx context.Context, pipe redis.Pipeliner, at time.Time, field string, n int64) {
+	hour := usageHour(at)
+	key := rs.usageKey(hour)
+	pipe.HIncrBy(ctx, key, field, n)
+	pipe.ExpireAt(ctx, key, hour.Add(rs.usageRetention()+UsageBucket))
+}
+
+func (rs *RedisStorage) usageRetention() time.Duration {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	return rs.retention
+}
+
+// DedupStats returns nil: deduplication is only supported by the in-memory store
+func (rs *RedisStorage) DedupStats() *DedupStats {
+	return nil
+}
+
+// loadAll reads every stored receipt
+func (rs *RedisStorage) loadAll(ctx context.Context) ([]*models.Receipt, error) {
+	var receipts []*models.Receipt
+
+	iter := rs.client.Scan(ctx, 0, rs.prefix+redisReceiptKey+"*", redisScanBatch).Iterator()
+	keys := make([]string, 0, redisScanBatch)
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		values, err := rs.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return err
+		}
+		for i, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				continue // Expired since the scan
+			}
+			var receipt models.Receipt
+			if err := json.Unmarshal([]byte(data), &receipt); err != nil {
+				log.Printf("[STORAGE] Skipping corrupt receipt under %s: %v", keys[i], err)
+				continue
+			}
+			receipts = append(receipts, &receipt)
+		}
+		keys = keys[:0]
+		return nil
+	}
+
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == redisScanBatch {
+			if err := flush(); err != nil {
+				return receipts, unavailable(err)
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return receipts, unavailable(err)
+	}
+	if err := flush(); err != nil {
+		return receipts, unavailable(err)
+	}
+	return receipts, nil
+}
+
+// evict deletes receipts and their ID claims, counting them as purged
+func (rs *RedisStorage) evict(ctx context.Context, victims []*models.Receipt) int {
+	removed := 0
+	for _, receipt := range victims {
+		deleted, err := rs.client.Del(ctx, rs.receiptKey(receipt.EphemeralKey)).Result()
+		if err != nil {
+			log.Printf("[STORAGE] Failed to evict receipt %s: %v", receipt.ReceiptID, err)
+			continue
+		}
+		if deleted == 0 {
+			continue // Collected or expired meanwhile
+		}
+		rs.client.Del(ctx, rs.receiptIDKey(receipt.ReceiptID))
+		rs.client.ZRem(ctx, rs.pendingKey(), receipt.ReceiptID)
+		rs.client.ZRem(ctx, rs.collectedKey(), receipt.ReceiptID)
+		rs.client.HIncrBy(ctx, rs.statsKey(), "purged", 1)
+		removed++
+
+		if rs.verbose {
+			log.Printf("[STORAGE] Evicted receipt %s (store over %d receipts)", receipt.ReceiptID, rs.policy.MaxCount)
+		}
+	}
+	return removed
+}
+
+func (rs *RedisStorage) receiptKey(ephemeralKey string) string {
+	return rs.prefix + redisReceiptKey + ephemeralKey
+}
+
+func (rs *RedisStorage) receiptIDKey(receiptID string) string {
+	return rs.prefix + redisReceiptIDKey + receiptID
+}
+
+func (rs *RedisStorage) challengeKey(ephemeralKey string, nonce []byte) string {
+	return rs.prefix + redisChallengeKey + ephemeralKey + ":" + hex.EncodeToString(nonce)
+}
+
+func (rs *RedisStorage) usageKey(hour time.Time) string {
+	return rs.prefix + redisUsageKey + strconv.FormatInt(hour.Unix(), 10)
+}
+
+func (rs *RedisStorage) pendingKey() string {
+	return rs.prefix + redisPendingKey
+}
+
+func (rs *RedisStorage) collectedKey() string {
+	return rs.prefix + redisCollectedKey
+}
+
+func (rs *RedisStorage) statsKey() string {
+	return rs.prefix + redisStatsKey
+}
+
+// without returns receipts minus removed
+func without(receipts, removed []*models.Receipt) []*models.Receipt {
+	gone := make(map[*models.Receipt]bool, len(removed))
+	for _, receipt := range removed {
+		gone[receipt] = true
+	}
+	kept := receipts[:0:0]
+	for _, receipt := range receipts {
+		if !gone[receipt] {
+			kept = append(kept, receipt)
+		}
+	}
+	return kept
+}
+
+func unavailable(err error) error {
+	return fmt.Errorf("%w: %v", ErrUnavailable, err)
+}
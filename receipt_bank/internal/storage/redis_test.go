@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"receipt-bank/internal/models"
+)
+
+// newTestRedis returns a RedisStorage on an in-process Redis
+func newTestRedis(t *testing.T, gracePeriod time.Duration) (*RedisStorage, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	rs, err := NewRedisStorage(RedisOptions{Address: server.Addr(), KeyPrefix: "bank:"}, time.Hour, gracePeriod, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rs.Close() })
+	return rs, server
+}
+
+func newRedisReceipt(key, id string) *models.Receipt {
+	return &models.Receipt{
+		EphemeralKey:  key,
+		EncryptedData: "payload",
+		ReceiptID:     id,
+		Timestamp:     time.Now(),
+	}
+}
+
+func TestRedisStoreAndCollect(t *testing.T) {
+	rs, _ := newTestRedis(t, time.Hour)
+
+	if err := rs.Store(newRedisReceipt("key-1", "receipt-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.Store(newRedisReceipt("key-2", "receipt-1")); !errors.Is(err, ErrReceiptExists) {
+		t.Errorf("Duplicate receipt ID: got %v, want ErrReceiptExists", err)
+	}
+
+	peeked, err := rs.Peek("key-1")
+	if err != nil || peeked.ReceiptID != "receipt-1" || peeked.IsCollected() {
+		t.Fatalf("Peek: got %+v, %v", peeked, err)
+	}
+
+	for want := 1; want <= 2; want++ {
+		receipt, err := rs.Retrieve("key-1")
+		if err != nil || receipt.CollectionCount != want || !receipt.IsCollected() {
+			t.Fatalf("Collection %d: got %+v, %v", want, receipt, err)
+		}
+	}
+	if _, err := rs.Retrieve("key-unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Unknown key: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestRedisOneTimeCollection(t *testing.T) {
+	rs, _ := newTestRedis(t, 0)
+
+	rs.Store(newRedisReceipt("key-1", "receipt-1"))
+	if _, err := rs.Retrieve("key-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.Retrieve("key-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Second collection without a grace period: got %v, want ErrNotFound", err)
+	}
+	if stats := rs.Stats(); stats.Total != 0 || stats.Purged != 1 {
+		t.Errorf("Stats after a one-time collection: %+v", stats)
+	}
+}
+
+func TestRedisStats(t *testing.T) {
+	rs, server := newTestRedis(t, time.Hour)
+
+	for _, receipt := range []*models.Receipt{
+		newRedisReceipt("key-1", "receipt-1"),
+		newRedisReceipt("key-2", "receipt-2"),
+		newRedisReceipt("key-3", "receipt-3"),
+	} {
+		if err := rs.Store(receipt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rs.Retrieve("key-1")
+	rs.Retrieve("key-1")
+	rs.Retrieve("key-2")
+	if err := rs.Delete("receipt-3"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := rs.Stats()
+	if stats.Total != 2 || stats.Collected != 2 || stats.Recollections != 1 {
+		t.Errorf("Stats: got %+v, want 2 receipts, both collected, 1 recollection", stats)
+	}
+
+	// A resubmission under a collected receipt's key replaces it
+	rs.Store(newRedisReceipt("key-2", "receipt-4"))
+	if stats := rs.Stats(); stats.Total != 2 || stats.Collected != 1 {
+		t.Errorf("Stats after a resubmission: got %+v, want 2 receipts, 1 collected", stats)
+	}
+
+	// Stats only count from the pending and collected sets, never the receipts themselves
+	if keys := server.Keys(); len(keys) == 0 {
+		t.Fatal("Expected keys in Redis")
+	}
+	server.Del("bank:receipt:key-1")
+	if stats := rs.Stats(); stats.Total != 2 {
+		t.Errorf("Stats read the receipts: got %+v", stats)
+	}
+}
+
+func TestRedisStatsSkipExpired(t *testing.T) {
+	rs, server := newTestRedis(t, time.Second)
+
+	short := newRedisReceipt("key-1", "receipt-1")
+	short.TTL = time.Second
+	rs.Store(short)
+	rs.Store(newRedisReceipt("key-2", "receipt-2"))
+	rs.Retrieve("key-2")
+	if stats := rs.Stats(); stats.Total != 2 || stats.Collected != 1 {
+		t.Fatalf("Stats: got %+v, want 2 receipts, 1 collected", stats)
+	}
+
+	// The uncollected receipt's ttl and the collected one's grace period run out
+	time.Sleep(1100 * time.Millisecond)
+	server.FastForward(1100 * time.Millisecond)
+	if stats := rs.Stats(); stats.Total != 0 || stats.Collected != 0 {
+		t.Errorf("Stats after expiry: got %+v, want none", stats)
+	}
+	if _, err := rs.Peek("key-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expired receipt: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestRedisChallenges(t *testing.T) {
+	rs, server := newTestRedis(t, time.Hour)
+
+	if err := rs.IssueChallenge("key", []byte("nonce"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := rs.RedeemChallenge("other-key", []byte("nonce")); ok {
+		t.Error("Redeemed a nonce issued for another key")
+	}
+	if ok, _ := rs.RedeemChallenge("key", []byte("nonce")); !ok {
+		t.Error("Failed to redeem an outstanding nonce")
+	}
+	if ok, _ := rs.RedeemChallenge("key", []byte("nonce")); ok {
+		t.Error("Redeemed a nonce twice")
+	}
+
+	rs.IssueChallenge("key", []byte("expiring"), time.Minute)
+	server.FastForward(2 * time.Minute)
+	if ok, _ := rs.RedeemChallenge("key", []byte("expiring")); ok {
+		t.Error("Redeemed an expired nonce")
+	}
+}
+
+func TestRedisUnavailable(t *testing.T) {
+	rs, server := newTestRedis(t, time.Hour)
+	server.Close()
+
+	if err := rs.Store(newRedisReceipt("key-1", "receipt-1")); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Store: got %v, want ErrUnavailable", err)
+	}
+	if _, err := rs.Retrieve("key-1"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Retrieve: got %v, want ErrUnavailable", err)
+	}
+}
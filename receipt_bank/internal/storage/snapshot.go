@@ -0,0 +1,386 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"receipt-bank/internal/models"
+)
+
+// Snapshot file layout: magic(4) || salt(16) || nonce(12) || AES-256-GCM(JSON snapshot)
+const (
+	snapshotMagic            = "RBS1"
+	snapshotSaltSize         = 16
+	snapshotNonceSize        = 12
+	snapshotPBKDF2Iterations = 600_000
+)
+
+var (
+	// ErrSnapshotKey is returned when a snapshot does not decrypt with the passphrase
+	ErrSnapshotKey = errors.New("wrong snapshot passphrase or corrupted snapshot")
+	// ErrSnapshotFormat is returned for data that is not a receipt bank snapshot
+	ErrSnapshotFormat = errors.New("not a receipt bank snapshot")
+	// ErrNoSnapshot is returned when restoring from a snapshot file that does not exist
+	ErrNoSnapshot = errors.New("no snapshot file")
+)
+
+// Snapshot is the content of a snapshot file: every live receipt, with the
+// collection state and per-receipt ttl it had when the snapshot was taken
+type Snapshot struct {
+	CreatedAt time.Time         `json:"created_at"`
+	Receipts  []*models.Receipt `json:"receipts"`
+}
+
+// RestoreResult counts what a restore did with the receipts of a snapshot
+type RestoreResult struct {
+	Restored int `json:"restored"`
+	Expired  int `json:"expired"`  // Their ttl or grace period elapsed since the snapshot
+	Existing int `json:"existing"` // Receipt ID or ephemeral key already stored
+}
+
+// CompactResult describes a compaction
+type CompactResult struct {
+	Receipts int   `json:"receipts"`
+	Buckets  int   `json:"buckets"`
+	Payloads int   `json:"payloads,omitempty"` // Shared payloads, when deduplicating
+	Ms       int64 `json:"duration_ms"`
+}
+
+// SnapshotInfo describes a written snapshot
+type SnapshotInfo struct {
+	File      string    `json:"file,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Receipts  int       `json:"receipts"`
+	Size      int       `json:"size_bytes"`
+}
+
+// Snapshotter is implemented by storage that lives in process memory and would
+// lose its receipts on restart. Shared backends keep receipts themselves.
+type Snapshotter interface {
+	Snapshot() *Snapshot
+	Restore(snapshot *Snapshot) RestoreResult
+	Compact() CompactResult
+}
+
+// Snapshot returns a copy of every live receipt. Expired receipts and collected
+// ones past their grace period are left out, so a snapshot holds only what a
+// restore would keep.
+func (ms *MemoryStorage) Snapshot() *Snapshot {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	now := time.Now()
+	snapshot := &Snapshot{CreatedAt: now.UTC(), Receipts: make([]*models.Receipt, 0, ms.receipts.count)}
+	for _, receipt := range ms.receipts.all() {
+		if ms.deadline(receipt).After(now) {
+			copied := *receipt
+			snapshot.Receipts = append(snapshot.Receipts, &copied)
+		}
+	}
+	return snapshot
+}
+
+// Restore adds the receipts of a snapshot. Receipts that are already stored, by
+// receipt ID or ephemeral key, are kept as they are, and receipts whose ttl or grace
+// period has run out since the snapshot are dropped. Restored receipts don't count
+// as submissions, and max_receipts is enforced by the next cleanup.
+func (ms *MemoryStorage) Restore(snapshot *Snapshot) RestoreResult {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now()
+	var result RestoreResult
+	for _, restored := range snapshot.Receipts {
+		receipt := *restored
+		if existing, _ := ms.receipts.findID(receipt.ReceiptID); existing != nil {
+			result.Existing++
+			continue
+		}
+		if existing, _ := ms.receipts.find(receipt.EphemeralKey); existing != nil {
+			result.Existing++
+			continue
+		}
+		deadline := ms.deadline(&receipt)
+		if !deadline.After(now) {
+			result.Expired++
+			continue
+		}
+
+		receipt.PayloadHash = ""
+		ms.retain(&receipt)
+		ms.receipts.insert(&receipt, deadline)
+		result.Restored++
+	}
+
+	if ms.verbose {
+		log.Printf("[STORAGE] Restored %d receipt(s) from a snapshot of %s (%d expired, %d already stored)",
+			result.Restored, snapshot.CreatedAt.Format(time.RFC3339), result.Expired, result.Existing)
+	}
+	return result
+}
+
+// Compact rebuilds the receipt indexes and the shared payload table. Go maps keep the
+// memory of deleted entries, so after a burst of receipts has been collected or has
+// expired the storage would otherwise stay at its peak size.
+func (ms *MemoryStorage) Compact() CompactResult {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	started := time.Now()
+	compacted := receiptBuckets{
+		buckets: make(map[int64]*receiptBucket, len(ms.receipts.buckets)),
+		byKey:   make(map[string]*receiptBucket, ms.receipts.count),
+		byID:    make(map[string]*receiptBucket, ms.receipts.count),
+	}
+	for _, b := range ms.receipts.buckets {
+		for _, receipt := range b.byKey {
+			compacted.insert(receipt, b.start)
+		}
+	}
+	ms.receipts = compacted
+
+	result := CompactResult{Receipts: ms.receipts.count, Buckets: len(ms.receipts.buckets)}
+	if ms.dedup != nil {
+		payloads := make(map[string]*payload, len(ms.dedup.payloads))
+		for hash, p := range ms.dedup.payloads {
+			payloads[hash] = p
+		}
+		ms.dedup.payloads = payloads
+		result.Payloads = len(payloads)
+	}
+	result.Ms = time.Since(started).Milliseconds()
+
+	if ms.verbose {
+		log.Printf("[STORAGE] Compacted %d receipt(s) in %d bucket(s) in %v", result.Receipts, result.Buckets, time.Since(started))
+	}
+	return result
+}
+
+// EncryptSnapshot serializes snapshot and encrypts it with a key derived from passphrase
+func EncryptSnapshot(snapshot *Snapshot, passphrase string) ([]byte, error) {
+	plaintext, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %v", err)
+	}
+
+	salt := make([]byte, snapshotSaltSize)
+	nonce := make([]byte, snapshotNonceSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %v", err)
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	aead, err := snapshotAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, len(snapshotMagic)+snapshotSaltSize+snapshotNonceSize+len(plaintext)+aead.Overhead())
+	data = append(data, snapshotMagic...)
+	data = append(data, salt...)
+	data = append(data, nonce...)
+	return aead.Seal(data, nonce, plaintext, []byte(snapshotMagic)), nil
+}
+
+// DecryptSnapshot decrypts and decodes a snapshot written by EncryptSnapshot
+func DecryptSnapshot(data []byte, passphrase string) (*Snapshot, error) {
+	header := len(snapshotMagic) + snapshotSaltSize + snapshotNonceSize
+	if len(data) < header || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, ErrSnapshotFormat
+	}
+	salt := data[len(snapshotMagic) : len(snapshotMagic)+snapshotSaltSize]
+	nonce := data[len(snapshotMagic)+snapshotSaltSize : header]
+
+	aead, err := snapshotAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, data[header:], []byte(snapshotMagic))
+	if err != nil {
+		return nil, ErrSnapshotKey
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(plaintext, &snapshot); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotFormat, err)
+	}
+	return &snapshot, nil
+}
+
+func snapshotAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, snapshotPBKDF2Iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive snapshot key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// SnapshotStats reports the snapshots written by a Snapshots
+type SnapshotStats struct {
+	File     string        `json:"file"`
+	Interval string        `json:"interval,omitempty"` // Scheduled snapshots, when enabled
+	Written  int           `json:"written"`
+	Failed   int           `json:"failed"`
+	Last     *SnapshotInfo `json:"last,omitempty"`
+}
+
+// Snapshots writes encrypted snapshots of a storage to a file, on demand and on a
+// schedule, and restores them
+type Snapshots struct {
+	mu         sync.Mutex
+	store      Snapshotter
+	file       string
+	passphrase string
+	interval   time.Duration
+	written    int
+	failed     int
+	last       *SnapshotInfo
+	verbose    bool
+}
+
+// NewSnapshots creates snapshots of store in file, encrypted with passphrase
+func NewSnapshots(store Snapshotter, file, passphrase string, verbose bool) *Snapshots {
+	return &Snapshots{store: store, file: file, passphrase: passphrase, verbose: verbose}
+}
+
+// Export takes a snapshot and returns it encrypted, without writing the file
+func (s *Snapshots) Export() ([]byte, *Snapshot, error) {
+	snapshot := s.store.Snapshot()
+	data, err := EncryptSnapshot(snapshot, s.passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, snapshot, nil
+}
+
+// Save takes a snapshot and replaces the snapshot file with it
+func (s *Snapshots) Save() (SnapshotInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := s.save()
+	if err != nil {
+		s.failed++
+		return SnapshotInfo{}, err
+	}
+	s.written++
+	s.last = &info
+
+	if s.verbose {
+		log.Printf("[STORAGE] Wrote snapshot of %d receipt(s) to %s (%d bytes)", info.Receipts, info.File, info.Size)
+	}
+	return info, nil
+}
+
+func (s *Snapshots) save() (SnapshotInfo, error) {
+	data, snapshot, err := s.Export()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	if dir := filepath.Dir(s.file); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return SnapshotInfo{}, fmt.Errorf("failed to create snapshot directory: %v", err)
+		}
+	}
+	tmp := s.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to write snapshot: %v", err)
+	}
+	if err := os.Rename(tmp, s.file); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to replace snapshot: %v", err)
+	}
+
+	return SnapshotInfo{
+		File:      s.file,
+		CreatedAt: snapshot.CreatedAt,
+		Receipts:  len(snapshot.Receipts),
+		Size:      len(data),
+	}, nil
+}
+
+// Import decrypts an encrypted snapshot and restores its receipts
+func (s *Snapshots) Import(data []byte) (RestoreResult, error) {
+	snapshot, err := DecryptSnapshot(data, s.passphrase)
+	if err != nil {
+		return RestoreResult{}, err
+	}
+	return s.store.Restore(snapshot), nil
+}
+
+// Load restores the receipts of the snapshot file
+func (s *Snapshots) Load() (RestoreResult, error) {
+	data, err := os.ReadFile(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return RestoreResult{}, fmt.Errorf("%w: %s", ErrNoSnapshot, s.file)
+	}
+	if err != nil {
+		return RestoreResult{}, fmt.Errorf("failed to read snapshot: %v", err)
+	}
+	return s.Import(data)
+}
+
+// CheckWritable reports whether the next snapshot can be written next to the
+// snapshot file, by creating and removing a probe file there
+func (s *Snapshots) CheckWritable() error {
+	probe, err := os.CreateTemp(filepath.Dir(s.file), ".snapshot-probe-*")
+	if err != nil {
+		return fmt.Errorf("snapshot directory not writable: %v", err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// Stats returns the snapshot counters
+func (s *Snapshots) Stats() SnapshotStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := SnapshotStats{File: s.file, Written: s.written, Failed: s.failed}
+	if s.interval > 0 {
+		stats.Interval = s.interval.String()
+	}
+	if s.last != nil {
+		last := *s.last
+		stats.Last = &last
+	}
+	return stats
+}
+
+// StartSnapshotRoutine starts a background routine writing a snapshot every interval
+func (s *Snapshots) StartSnapshotRoutine(interval time.Duration) {
+	s.mu.Lock()
+	s.interval = interval
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := s.Save(); err != nil {
+				log.Printf("[STORAGE] Scheduled snapshot failed: %v", err)
+			}
+		}
+	}()
+
+	if s.verbose {
+		log.Printf("[STORAGE] Started snapshot routine (interval: %v, file: %s)", interval, s.file)
+	}
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"receipt-bank/internal/models"
+)
+
+const testPassphrase = "correct horse battery staple"
+
+func newSnapshotReceipt(key, id string, submitted time.Time) *models.Receipt {
+	return &models.Receipt{
+		EphemeralKey:  key,
+		EncryptedData: "payload-" + id,
+		ReceiptID:     id,
+		Timestamp:     submitted,
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "snapshots", "bank.snapshot")
+	source := NewMemoryStorage(time.Hour, time.Hour, false)
+	source.Store(newSnapshotReceipt("key-1", "receipt-1", time.Now()))
+	source.Store(newSnapshotReceipt("key-2", "receipt-2", time.Now()))
+	source.Retrieve("key-2")
+
+	info, err := NewSnapshots(source, file, testPassphrase, false).Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Receipts != 2 || info.File != file {
+		t.Errorf("Saved %+v, want 2 receipts in %s", info, file)
+	}
+	if stat, err := os.Stat(file); err != nil || stat.Mode().Perm() != 0600 {
+		t.Errorf("Snapshot file: %v, %v", stat, err)
+	}
+
+	restored := NewMemoryStorage(time.Hour, time.Hour, false)
+	result, err := NewSnapshots(restored, file, testPassphrase, false).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (RestoreResult{Restored: 2}) {
+		t.Errorf("Restore: got %+v, want 2 restored", result)
+	}
+
+	waiting, err := restored.Peek("key-1")
+	if err != nil || waiting.EncryptedData != "payload-receipt-1" || waiting.IsCollected() {
+		t.Errorf("Uncollected receipt: got %+v, %v", waiting, err)
+	}
+	collected, err := restored.Peek("key-2")
+	if err != nil || !collected.IsCollected() || collected.CollectionCount != 1 {
+		t.Errorf("Collected receipt: got %+v, %v", collected, err)
+	}
+}
+
+func TestDecryptSnapshotRefusesBadData(t *testing.T) {
+	snapshot := &Snapshot{CreatedAt: time.Now(), Receipts: []*models.Receipt{newSnapshotReceipt("key-1", "receipt-1", time.Now())}}
+	data, err := EncryptSnapshot(snapshot, testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DecryptSnapshot(data, "wrong passphrase"); !errors.Is(err, ErrSnapshotKey) {
+		t.Errorf("Wrong passphrase: got %v, want ErrSnapshotKey", err)
+	}
+
+	badMagic := append([]byte("RBS0"), data[len(snapshotMagic):]...)
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrSnapshotFormat},
+		{"truncated header", data[:len(snapshotMagic)+snapshotSaltSize], ErrSnapshotFormat},
+		{"bad magic", badMagic, ErrSnapshotFormat},
+		{"truncated ciphertext", data[:len(data)-1], ErrSnapshotKey},
+	} {
+		if _, err := DecryptSnapshot(tt.data, testPassphrase); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	decrypted, err := DecryptSnapshot(data, testPassphrase)
+	if err != nil || len(decrypted.Receipts) != 1 || decrypted.Receipts[0].ReceiptID != "receipt-1" {
+		t.Errorf("Intact snapshot: got %+v, %v", decrypted, err)
+	}
+}
+
+func TestRestoreSkipsExpiredAndExisting(t *testing.T) {
+	ms := NewMemoryStorage(time.Hour, time.Minute, false)
+	ms.Store(newSnapshotReceipt("key-1", "receipt-1", time.Now()))
+
+	collectedAt := time.Now().Add(-2 * time.Minute)
+	pastGrace := newSnapshotReceipt("key-5", "receipt-5", time.Now().Add(-10*time.Minute))
+	pastGrace.CollectedAt = &collectedAt
+	pastGrace.CollectionCount = 1
+
+	result := ms.Restore(&Snapshot{
+		CreatedAt: time.Now().Add(-2 * time.Hour),
+		Receipts: []*models.Receipt{
+			newSnapshotReceipt("key-1", "receipt-other", time.Now()),               // Ephemeral key already stored
+			newSnapshotReceipt("key-other", "receipt-1", time.Now()),               // Receipt ID already stored
+			newSnapshotReceipt("key-3", "receipt-3", time.Now().Add(-2*time.Hour)), // ttl ran out
+			newSnapshotReceipt("key-4", "receipt-4", time.Now()),
+			pastGrace,
+		},
+	})
+	if want := (RestoreResult{Restored: 1, Expired: 2, Existing: 2}); result != want {
+		t.Errorf("Restore: got %+v, want %+v", result, want)
+	}
+
+	if stored, _ := ms.Peek("key-1"); stored.ReceiptID != "receipt-1" {
+		t.Errorf("Restore replaced a stored receipt with %s", stored.ReceiptID)
+	}
+	if _, err := ms.Peek("key-4"); err != nil {
+		t.Errorf("Live receipt not restored: %v", err)
+	}
+	for _, key := range []string{"key-3", "key-5", "key-other"} {
+		if _, err := ms.Peek(key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: got %v, want ErrNotFound", key, err)
+		}
+	}
+}
+
+func TestLoadWithoutSnapshotFile(t *testing.T) {
+	snapshots := NewSnapshots(NewMemoryStorage(time.Hour, time.Hour, false), filepath.Join(t.TempDir(), "missing"), testPassphrase, false)
+	if _, err := snapshots.Load(); !errors.Is(err, ErrNoSnapshot) {
+		t.Errorf("Missing file: got %v, want ErrNoSnapshot", err)
+	}
+}
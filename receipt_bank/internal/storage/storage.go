@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"receipt-bank/internal/models"
+)
+
+var (
+	// ErrReceiptExists is returned when a receipt_id is already stored
+	ErrReceiptExists = errors.New("receipt_id already exists")
+	// ErrNotFound is returned when no receipt is stored under an ephemeral key (or receipt ID)
+	ErrNotFound = errors.New("receipt not found")
+	// ErrUnavailable is returned when a shared backend cannot be reached
+	ErrUnavailable = errors.New("storage unavailable")
+)
+
+// Storage keeps receipts between submission and collection.
+// MemoryStorage serves a single instance; RedisStorage lets several
+// receipt bank instances behind a load balancer share their receipts.
+type Storage interface {
+	Store(receipt *models.Receipt) error
+	Retrieve(ephemeralKey string) (*models.Receipt, error)
+	Peek(ephemeralKey string) (*models.Receipt, error)
+	Cleanup(trigger string) CleanupRun
+	CleanupStats() CleanupStats
+	StartCleanupRoutine(interval time.Duration)
+	Stats() Stats
+	DedupStats() *DedupStats
+	List() ([]ReceiptInfo, error)
+	Delete(receiptID string) error
+	Usage(from, to time.Time) ([]Usage, error)
+	RecordWebhook(delivered bool)
+}
+
+// ReceiptInfo describes a stored receipt for the admin API, without its payload
+// or the ephemeral key that would let an operator collect it
+type ReceiptInfo struct {
+	ReceiptID       string     `json:"receipt_id"`
+	RegisterID      string     `json:"register_id,omitempty"`
+	KeyPrefix       string     `json:"ephemeral_key_prefix"`
+	SubmittedAt     time.Time  `json:"submitted_at"`
+	ExpiresAt       time.Time  `json:"expires_at"` // Purged at, once collected
+	CollectedAt     *time.Time `json:"collected_at,omitempty"`
+	CollectionCount int        `json:"collection_count"`
+	Size            int        `json:"size_bytes"` // Base64 payload
+}
+
+// receiptKeyPrefixLength is how much of the ephemeral key ReceiptInfo shows
+const receiptKeyPrefixLength = 8
+
+func newReceiptInfo(receipt *models.Receipt, maxReceiptAge, gracePeriod time.Duration) ReceiptInfo {
+	info := ReceiptInfo{
+		ReceiptID:       receipt.ReceiptID,
+		RegisterID:      receipt.RegisterID,
+		KeyPrefix:       receipt.EphemeralKey,
+		SubmittedAt:     receipt.Timestamp,
+		ExpiresAt:       receipt.Timestamp.Add(receipt.MaxAge(maxReceiptAge)),
+		CollectedAt:     receipt.CollectedAt,
+		CollectionCount: receipt.CollectionCount,
+		Size:            len(receipt.EncryptedData),
+	}
+	if len(info.KeyPrefix) > receiptKeyPrefixLength {
+		info.KeyPrefix = info.KeyPrefix[:receiptKeyPrefixLength]
+	}
+	if receipt.IsCollected() {
+		info.ExpiresAt = receipt.CollectedAt.Add(gracePeriod)
+	}
+	return info
+}
+
+// sortReceiptInfos orders receipts oldest submission first
+func sortReceiptInfos(infos []ReceiptInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].SubmittedAt.Before(infos[j].SubmittedAt)
+	})
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"sort"
+	"time"
+)
+
+// UsageBucket is the resolution of the usage history
+const UsageBucket = time.Hour
+
+// DefaultUsageRetention is how long usage buckets are kept unless configured
+const DefaultUsageRetention = 30 * 24 * time.Hour
+
+// Usage counts receipt bank activity during one hour, across every instance
+// sharing the store. Receipts are counted as expired in the hour their TTL
+// elapsed without a collection.
+type Usage struct {
+	Start             time.Time `json:"start"`
+	Submitted         int64     `json:"submitted"`
+	Collected         int64     `json:"collected"`     // First collections only
+	CollectionMs      int64     `json:"collection_ms"` // Sum of submission-to-first-collection times
+	Expired           int64     `json:"expired"`
+	WebhooksDelivered int64     `json:"webhooks_delivered"`
+	WebhooksFailed    int64     `json:"webhooks_failed"`
+}
+
+// Add sums other's counters into u, keeping u's start
+func (u *Usage) Add(other Usage) {
+	u.Submitted += other.Submitted
+	u.Collected += other.Collected
+	u.CollectionMs += other.CollectionMs
+	u.Expired += other.Expired
+	u.WebhooksDelivered += other.WebhooksDelivered
+	u.WebhooksFailed += other.WebhooksFailed
+}
+
+// usageHour returns the start of the hour bucket holding t
+func usageHour(t time.Time) time.Time {
+	return t.UTC().Truncate(UsageBucket)
+}
+
+// usageHistory keeps the in-memory hour buckets; the zero value keeps
+// DefaultUsageRetention and the caller must hold the storage lock
+type usageHistory struct {
+	retention time.Duration
+	buckets   map[int64]*Usage // key: unix seconds of the bucket start
+}
+
+// at returns the bucket holding t. Buckets past the retention are dropped as
+// new ones are created; counts for such old times go nowhere.
+func (h *usageHistory) at(t time.Time) *Usage {
+	start := usageHour(t)
+	cutoff := h.cutoff(time.Now())
+	if start.Before(cutoff) {
+		return &Usage{}
+	}
+
+	if bucket, exists := h.buckets[start.Unix()]; exists {
+		return bucket
+	}
+	if h.buckets == nil {
+		h.buckets = make(map[int64]*Usage)
+	}
+	for key, bucket := range h.buckets {
+		if bucket.Start.Before(cutoff) {
+			delete(h.buckets, key)
+		}
+	}
+	bucket := &Usage{Start: start}
+	h.buckets[start.Unix()] = bucket
+	return bucket
+}
+
+// between returns copies of the non-empty buckets starting in [from, to), oldest first
+func (h *usageHistory) between(from, to time.Time) []Usage {
+	cutoff := h.cutoff(time.Now())
+	usage := []Usage{}
+	for _, bucket := range h.buckets {
+		if !bucket.Start.Before(cutoff) && !bucket.Start.Before(usageHour(from)) && bucket.Start.Before(to) {
+			usage = append(usage, *bucket)
+		}
+	}
+	sortUsage(usage)
+	return usage
+}
+
+func (h *usageHistory) cutoff(now time.Time) time.Time {
+	retention := h.retention
+	if retention <= 0 {
+		retention = DefaultUsageRetention
+	}
+	return usageHour(now.Add(-retention))
+}
+
+// sortUsage orders buckets oldest first
+func sortUsage(usage []Usage) {
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Start.Before(usage[j].Start)
+	})
+}
+
+// SetUsageRetention sets how long hourly usage buckets are kept
+func (ms *MemoryStorage) SetUsageRetention(retention time.Duration) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.usage.retention = retention
+}
+
+// Usage returns the hourly usage buckets between from and to, oldest first.
+// Hours without activity are left out.
+func (ms *MemoryStorage) Usage(from, to time.Time) ([]Usage, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.usage.between(from, to), nil
+}
+
+// RecordWebhook counts a collection notification that was delivered or failed after every retry
+func (ms *MemoryStorage) RecordWebhook(delivered bool) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	bucket := ms.usage.at(time.Now())
+	if delivered {
+		bucket.WebhooksDelivered++
+	} else {
+		bucket.WebhooksFailed++
+	}
+}
@@ -0,0 +1,192 @@
+package wallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Handler serves the optional browser wallet demo page and its supporting endpoints
+type Handler struct {
+	staticDir    string
+	authorityURL string
+	pollInterval time.Duration
+	httpClient   *http.Client
+	verbose      bool
+}
+
+// NewHandler creates a new wallet demo handler
+func NewHandler(staticDir, authorityURL string, pollInterval time.Duration, verbose bool) *Handler {
+	return &Handler{
+		staticDir:    staticDir,
+		authorityURL: authorityURL,
+		pollInterval: pollInterval,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		verbose: verbose,
+	}
+}
+
+// RegisterRoutes mounts the wallet demo under /wallet
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/wallet/config.json", h.ConfigHandler).Methods("GET")
+	router.HandleFunc("/wallet/format.json", h.FormatHandler).Methods("GET")
+	router.HandleFunc("/wallet/authority-key", h.AuthorityKeyHandler).Methods("GET")
+	router.Handle("/wallet", http.RedirectHandler("/wallet/", http.StatusMovedPermanently)).Methods("GET")
+	router.PathPrefix("/wallet/").Handler(
+		http.StripPrefix("/wallet/", http.FileServer(http.Dir(h.staticDir))),
+	).Methods("GET")
+}
+
+// ConfigHandler handles GET /wallet/config.json
+func (h *Handler) ConfigHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"collect_path":     "/v1/collect/",
+		"authority_key":    "/wallet/authority-key",
+		"format":           "/wallet/format.json",
+		"poll_interval_ms": h.pollInterval.Milliseconds(),
+	})
+}
+
+// FormatHandler handles GET /wallet/format.json
+// It describes the byte layouts a browser needs to decrypt and verify receipts.
+func (h *Handler) FormatHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, byteLayout)
+}
+
+// AuthorityKeyHandler handles GET /wallet/authority-key by proxying the
+// revenue authority's public key so the page avoids a cross-origin request
+func (h *Handler) AuthorityKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if h.authorityURL == "" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Revenue authority URL not configured"})
+		return
+	}
+
+	resp, err := h.httpClient.Get(h.authorityURL + "/public-key")
+	if err != nil {
+		if h.verbose {
+			log.Printf("[WALLET] Failed to fetch authority public key: %v", err)
+		}
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": "Revenue authority unreachable"})
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		writeJSON(w, http.StatusBadGateway, map[string]string{
+			"error": fmt.Sprintf("Revenue authority returned status %d", resp.StatusCode),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// layoutField describes one field of a binary structure
+type layoutField struct {
+	Name     string `json:"name"`
+	Size     int    `json:"size,omitempty"`
+	Encoding string `json:"encoding"`
+}
+
+// byteLayout documents the encrypted envelope, signed receipt and receipt v1/v2 layouts.
+// Sizes of 0 denote variable-length fields.
+var byteLayout = map[string]interface{}{
+	"byte_order": "big-endian",
+	"qr_payload": map[string]interface{}{
+		"fields": []layoutField{
+			{Name: "version", Size: 1, Encoding: "uint8 0x01"},
+			{Name: "ephemeral_key", Size: 33, Encoding: "compressed P-256 point (0x02/0x03 || X)"},
+			{Name: "bank_url", Encoding: "uint8 length + UTF-8 http(s) URL of the bank the wallet collects from (length 0 = none)"},
+			{Name: "crc32", Size: 4, Encoding: "CRC-32 (IEEE) of the preceding bytes"},
+		},
+		"text": "standard base64; a bare base64 compressed key (before version 1) is accepted too",
+	},
+	"encrypted_envelope": map[string]interface{}{
+		"fields": []layoutField{
+			{Name: "temp_public_key", Size: 65, Encoding: "uncompressed P-256 point (0x04 || X || Y)"},
+			{Name: "nonce", Size: 12, Encoding: "AES-GCM nonce"},
+			{Name: "ciphertext", Encoding: "AES-256-GCM ciphertext with 16-byte tag appended"},
+		},
+		"key_agreement": "ECDH P-256, shared secret is the X coordinate with leading zero bytes stripped",
+		"kdf": map[string]string{
+			"algorithm": "HKDF-SHA256",
+			"salt":      "empty",
+			"info":      "Privacy-preserving-ECDH",
+			"length":    "32",
+		},
+	},
+	"signed_receipt": map[string]interface{}{
+		"fields": []layoutField{
+			{Name: "receipt", Encoding: "binary receipt (see receipt_v1 and receipt_v2)"},
+			{Name: "signature", Size: 64, Encoding: "ECDSA P-256 r || s over SHA-256(receipt)"},
+			{Name: "device_signature", Size: 64, Encoding: "present only when the receipt carries a device key extension (tag 0x02): ECDSA P-256 r || s over SHA-256(receipt) with that key"},
+			{Name: "timestamp_token", Size: 73, Encoding: "present only when header flag 0x01 is set: version(1) || uint64 unix seconds || ECDSA r || s over SHA-256(SHA-256(receipt) || unix seconds)"},
+		},
+	},
+	"receipt_v1": map[string]interface{}{
+		"fields": []layoutField{
+			{Name: "magic", Size: 2, Encoding: "uint16 0x5452"},
+			{Name: "version", Size: 1, Encoding: "uint8 0x01"},
+			{Name: "flags", Size: 1, Encoding: "uint8 bit field, 0x01 = timestamp token trailer, 0x02 = currency extension, 0x04 = compressed body, 0x08 = weighed items (v2 only), 0x10 = item notes (v2 only), 0x20 = customer extension, 0x40 = refund extension"},
+			{Name: "timestamp", Size: 8, Encoding: "uint64 unix seconds"},
+			{Name: "z_report_number", Size: 4, Encoding: "uint32"},
+			{Name: "transaction_id", Size: 4, Encoding: "uint32"},
+			{Name: "store_vkn", Size: 4, Encoding: "uint32"},
+			{Name: "store_name", Encoding: "uint32 length + UTF-8"},
+			{Name: "store_address", Encoding: "uint32 length + UTF-8"},
+			{Name: "total_amount", Size: 4, Encoding: "uint32 kuruş"},
+			{Name: "payment_method", Encoding: "uint32 length + UTF-8"},
+			{Name: "receipt_serial", Size: 4, Encoding: "uint32"},
+			{Name: "item_count", Size: 2, Encoding: "uint16"},
+			{Name: "items", Encoding: "item_count × item"},
+			{Name: "tax_breakdown", Size: 20, Encoding: "5 × uint32 kuruş: tax10 base, tax10 amount, tax20 base, tax20 amount, total tax"},
+			{Name: "currency", Size: 15, Encoding: "present only when header flag 0x02 is set: 3-byte ISO 4217 code || uint64 rate in millionths of a lira || uint32 total in the currency's minor unit"},
+			{Name: "customer", Encoding: "present only when header flag 0x20 is set: uint32 length + ASCII tax number (10-digit VKN or 11-digit TCKN) || uint32 length + UTF-8 name"},
+			{Name: "refund", Size: 16, Encoding: "present only when header flag 0x40 is set: the refunded sale's uint64 unix seconds || uint32 transaction_id || uint32 receipt_serial"},
+		},
+		"compression": "when header flag 0x04 is set, every field after flags is a zlib stream (RFC 1950) inflating to at most 2 MiB; the signature covers the compressed bytes",
+		"item": []layoutField{
+			{Name: "kisim_id", Size: 2, Encoding: "uint16"},
+			{Name: "quantity", Size: 2, Encoding: "uint16"},
+			{Name: "unit_price", Size: 4, Encoding: "uint32 kuruş"},
+			{Name: "total_price", Size: 4, Encoding: "uint32 kuruş"},
+			{Name: "tax_rate", Size: 1, Encoding: "uint8 percent"},
+		},
+	},
+	"receipt_v2": map[string]interface{}{
+		"differences": "version byte 0x02; identical to receipt_v1 except for the widths below. Amounts are at most 2^53 kuruş",
+		"fields": []layoutField{
+			{Name: "total_amount", Size: 8, Encoding: "uint64 kuruş"},
+			{Name: "tax_breakdown", Size: 40, Encoding: "5 × uint64 kuruş: tax10 base, tax10 amount, tax20 base, tax20 amount, total tax"},
+			{Name: "currency", Size: 19, Encoding: "present only when header flag 0x02 is set: 3-byte ISO 4217 code || uint64 rate in millionths of a lira || uint64 total in the currency's minor unit"},
+		},
+		"item": []layoutField{
+			{Name: "kisim_id", Size: 2, Encoding: "uint16"},
+			{Name: "quantity", Size: 4, Encoding: "uint32"},
+			{Name: "unit_price", Size: 8, Encoding: "uint64 kuruş"},
+			{Name: "total_price", Size: 8, Encoding: "uint64 kuruş"},
+			{Name: "tax_rate", Size: 1, Encoding: "uint8 percent"},
+			{Name: "unit", Size: 1, Encoding: "present only when header flag 0x08 is set: 0x00 = pieces, 0x01 = grams (quantity is a weight, unit_price is per kilogram)"},
+			{Name: "note", Encoding: "present only when header flag 0x10 is set: uint8 length + UTF-8 (length 0 = no note)"},
+		},
+	},
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("[ERROR] Failed to write JSON response: %v", err)
+	}
+}
@@ -3,20 +3,86 @@ package webhook
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"receipt-bank/internal/models"
 )
 
+// When a signing secret is set, SignatureHeader carries "sha256=<hex HMAC-SHA256 of
+// "<timestamp>.<body>">" and TimestampHeader the Unix time it was signed at, so receivers
+// can refuse a captured request replayed later
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+)
+
+// maxFailures is how many recent failures the client keeps for the admin API
+const maxFailures = 200
+
+// Failure records a notification that failed after every retry
+type Failure struct {
+	Seq        int64     `json:"seq"` // Increases by one per failure, for tailing
+	ReceiptID  string    `json:"receipt_id"`
+	WebhookURL string    `json:"webhook_url"`
+	Attempts   int       `json:"attempts"`
+	Error      string    `json:"error"`
+	FailedAt   time.Time `json:"failed_at"`
+}
+
+// Stats counts notifications since startup
+type Stats struct {
+	Delivered int64 `json:"delivered"`
+	Failed    int64 `json:"failed"`
+	Pending   int64 `json:"pending"`  // Notifications not yet delivered or given up on
+	Retrying  int64 `json:"retrying"` // Of those, waiting out a backoff before the next attempt
+
+	// Delivery queue (see Enqueue)
+	Workers       int64   `json:"workers"`
+	Queued        int64   `json:"queued"` // Waiting for a worker
+	QueueCapacity int64   `json:"queue_capacity"`
+	Dropped       int64   `json:"dropped"`        // Refused with the queue full, also counted as failed
+	LatencyAvgMs  float64 `json:"latency_avg_ms"` // From queued to delivered, retries included
+	LatencyMaxMs  int64   `json:"latency_max_ms"`
+
+	// Receiver verification (see EnableVerification)
+	Verified   int64 `json:"verified"`   // Challenges answered
+	Unverified int64 `json:"unverified"` // Challenges failed
+}
+
 // Client handles webhook notifications to cash registers
 type Client struct {
 	httpClient *http.Client
 	maxRetries int
+	secret     []byte
+	guard      *guard // Target address checks (nil = any target)
 	verbose    bool
+
+	mu       sync.Mutex
+	stats    Stats
+	failures []Failure // Oldest first, at most maxFailures
+
+	// Delivery queue, started by SetConcurrency or the first Enqueue
+	queueOptions QueueOptions
+	startOnce    sync.Once
+	queue        *queue
+	latencyTotal time.Duration // Over latencyCount delivered notifications
+	latencyCount int64
+
+	// Receiver verification (nil maps = off)
+	verifyTTL       time.Duration
+	verified        map[string]time.Time // Webhook URL -> trusted until
+	verifying       map[string]*verification
+	challengeClient *http.Client
 }
 
 // NewClient creates a new webhook client
@@ -30,22 +96,46 @@ func NewClient(timeout time.Duration, maxRetries int, verbose bool) *Client {
 	}
 }
 
-// NotifyCollection sends a webhook notification about receipt collection
-func (c *Client) NotifyCollection(webhookURL, receiptID string) error {
+// SetSigningSecret signs every webhook body so registers can verify it came from this bank
+func (c *Client) SetSigningSecret(secret string) {
+	c.secret = []byte(secret)
+}
+
+// timestampFormat is RFC 3339 with milliseconds, for collection timings
+const timestampFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// NotifyCollection sends a webhook notification about the first collection of receipt
+// and waits for the outcome. Enqueue delivers it on the queue's workers instead.
+func (c *Client) NotifyCollection(receipt *models.Receipt) error {
+	c.count(&c.stats.Pending, 1)
+	defer c.count(&c.stats.Pending, -1)
+	return c.notify(receipt)
+}
+
+func (c *Client) notify(receipt *models.Receipt) error {
+	collectedAt := time.Now()
+	if receipt.CollectedAt != nil {
+		collectedAt = *receipt.CollectedAt
+	}
 	payload := models.WebhookPayload{
-		ReceiptID: receiptID,
-		Status:    "downloaded",
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		SchemaVersion:       models.WebhookSchemaVersion,
+		ReceiptID:           receipt.ReceiptID,
+		Status:              "downloaded",
+		SubmittedAt:         receipt.Timestamp.UTC().Format(timestampFormat),
+		CollectedAt:         collectedAt.UTC().Format(timestampFormat),
+		CollectionLatencyMs: max(collectedAt.Sub(receipt.Timestamp).Milliseconds(), 0),
 	}
 
-	return c.sendWebhook(webhookURL, payload)
+	return c.sendWebhook(receipt.WebhookURL, payload)
 }
 
-// sendWebhook sends a webhook with retry logic
+// sendWebhook sends a webhook with retry logic. Every attempt carries its own
+// timestamp and attempt number, so the body is marshalled and signed per attempt.
 func (c *Client) sendWebhook(webhookURL string, payload models.WebhookPayload) error {
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal webhook payload: %v", err)
+	// Confirmations only go to receivers that proved they asked for them
+	if err := c.Verify(webhookURL); err != nil {
+		c.recordFailure(webhookURL, payload.ReceiptID, 0, err)
+		return err
 	}
 
 	var lastErr error
@@ -53,13 +143,22 @@ func (c *Client) sendWebhook(webhookURL string, payload models.WebhookPayload) e
 		if attempt > 0 {
 			// Exponential backoff for retries
 			backoff := time.Duration(attempt) * time.Second
+			c.count(&c.stats.Retrying, 1)
 			time.Sleep(backoff)
+			c.count(&c.stats.Retrying, -1)
 
 			if c.verbose {
 				log.Printf("[WEBHOOK] Retry attempt %d for receipt %s", attempt, payload.ReceiptID)
 			}
 		}
 
+		payload.Attempt = attempt + 1
+		payload.Timestamp = time.Now().UTC().Format(time.RFC3339)
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal webhook payload: %v", err)
+		}
+
 		ctx, cancel := context.WithTimeout(context.Background(), c.httpClient.Timeout)
 		req, err := http.NewRequestWithContext(ctx, "POST", webhookURL, bytes.NewBuffer(payloadBytes))
 		if err != nil {
@@ -69,21 +168,31 @@ func (c *Client) sendWebhook(webhookURL string, payload models.WebhookPayload) e
 		}
 
 		req.Header.Set("Content-Type", "application/json")
+		c.sign(req, payloadBytes)
 
 		resp, err := c.httpClient.Do(req)
 		cancel()
 
 		if err != nil {
-			lastErr = fmt.Errorf("webhook request failed: %v", err)
+			lastErr = fmt.Errorf("webhook request failed: %w", err)
 			if c.verbose {
 				log.Printf("[WEBHOOK] Request failed for receipt %s: %v", payload.ReceiptID, err)
 			}
+			// The target won't become allowed by waiting
+			if errors.Is(err, ErrForbiddenTarget) {
+				c.recordFailure(webhookURL, payload.ReceiptID, attempt+1, lastErr)
+				return lastErr
+			}
 			continue
 		}
 
 		resp.Body.Close()
 
 		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			c.mu.Lock()
+			c.stats.Delivered++
+			c.mu.Unlock()
+
 			if c.verbose {
 				log.Printf("[WEBHOOK] Successfully notified receipt collection: %s", payload.ReceiptID)
 			}
@@ -99,6 +208,71 @@ func (c *Client) sendWebhook(webhookURL string, payload models.WebhookPayload) e
 	// All retries failed
 	log.Printf("[WEBHOOK] Failed to notify receipt collection after %d attempts: %s (last error: %v)",
 		c.maxRetries+1, payload.ReceiptID, lastErr)
+	c.recordFailure(webhookURL, payload.ReceiptID, c.maxRetries+1, lastErr)
 
 	return lastErr
 }
+
+// sign adds the body's signature and timestamp headers when a signing secret is set
+func (c *Client) sign(req *http.Request, body []byte) {
+	if len(c.secret) > 0 {
+		timestamp, signature := Sign(c.secret, body, time.Now())
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, signature)
+	}
+}
+
+// Sign returns the TimestampHeader and SignatureHeader values for body signed at now
+func Sign(secret, body []byte, now time.Time) (timestamp, signature string) {
+	timestamp = strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return timestamp, "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// count adds delta to one of the stats counters
+func (c *Client) count(counter *int64, delta int64) {
+	c.mu.Lock()
+	*counter += delta
+	c.mu.Unlock()
+}
+
+func (c *Client) recordFailure(webhookURL, receiptID string, attempts int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Failed++
+	c.failures = append(c.failures, Failure{
+		Seq:        c.stats.Failed,
+		ReceiptID:  receiptID,
+		WebhookURL: webhookURL,
+		Attempts:   attempts, // 0 when the receiver failed verification
+		Error:      err.Error(),
+		FailedAt:   time.Now().UTC(),
+	})
+	if len(c.failures) > maxFailures {
+		c.failures = c.failures[len(c.failures)-maxFailures:]
+	}
+}
+
+// Failures returns the kept failures with a sequence number above after, oldest first
+func (c *Client) Failures(after int64) []Failure {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	failures := []Failure{}
+	for _, failure := range c.failures {
+		if failure.Seq > after {
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
+
+// Stats returns the notification counts of this instance
+func (c *Client) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxRedirects bounds the redirects a notification follows; each hop is checked anew
+const maxRedirects = 3
+
+// ErrForbiddenTarget is returned for a webhook URL that resolves to a private, loopback
+// or link-local address outside the allowed networks
+var ErrForbiddenTarget = errors.New("webhook target is a private, loopback or link-local address")
+
+// TargetPolicy restricts where webhooks may be sent. Submitters choose the webhook URL,
+// so without it they can make the bank POST to services only it can reach.
+type TargetPolicy struct {
+	DenyPrivate bool           // Refuse RFC 1918, unique local, loopback, link-local and unspecified addresses
+	Allowed     []netip.Prefix // Networks allowed even so, e.g. registers on the bank's LAN
+}
+
+// ParseAllowedTargets parses allowed networks given as CIDR prefixes or single addresses
+func ParseAllowedTargets(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed webhook target %q: want an address or CIDR prefix", entry)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// Permits reports whether webhooks may be sent to addr
+func (p TargetPolicy) Permits(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !p.DenyPrivate {
+		return true
+	}
+	for _, prefix := range p.Allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return !(addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsUnspecified())
+}
+
+// guard dials webhook targets only after checking every address their host resolves to.
+// It resolves on every dial and connections are not reused, so a host that re-resolves
+// to an internal address between attempts (DNS rebinding) is caught on the next attempt.
+type guard struct {
+	policy TargetPolicy
+	lookup func(ctx context.Context, host string) ([]netip.Addr, error)
+	dialer *net.Dialer
+}
+
+func newGuard(policy TargetPolicy, timeout time.Duration) *guard {
+	return &guard{
+		policy: policy,
+		lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+		dialer: &net.Dialer{Timeout: timeout},
+	}
+}
+
+// resolve returns the addresses of host, refusing it if any of them is forbidden
+func (g *guard) resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	addrs := []netip.Addr{}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = append(addrs, addr)
+	} else {
+		addrs, err = g.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("no addresses for %s", host)
+		}
+	}
+
+	for _, addr := range addrs {
+		if !g.policy.Permits(addr) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrForbiddenTarget, host, addr.Unmap())
+		}
+	}
+	return addrs, nil
+}
+
+// dialContext connects to one of the checked addresses of the requested host
+func (g *guard) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := g.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := g.dialer.DialContext(ctx, network, net.JoinHostPort(addr.Unmap().String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// transport is an HTTP transport that dials through the guard. It ignores proxy
+// settings, whose address would be checked instead of the target's.
+func (g *guard) transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = g.dialContext
+	transport.DisableKeepAlives = true
+	return transport
+}
+
+// checkRedirect refuses redirects to other schemes and long redirect chains; the
+// target of each hop is checked when it is dialed
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("%w: redirect to %s", ErrForbiddenTarget, req.URL.Scheme)
+	}
+	return nil
+}
+
+// SetTargetPolicy restricts the addresses webhooks, and verification challenges, are
+// sent to. Call it before the client is used.
+func (c *Client) SetTargetPolicy(policy TargetPolicy) {
+	if !policy.DenyPrivate {
+		c.guard = nil
+		return
+	}
+	c.guard = newGuard(policy, c.httpClient.Timeout)
+	c.httpClient.Transport = c.guard.transport()
+	c.httpClient.CheckRedirect = checkRedirect
+	if c.challengeClient != nil {
+		c.challengeClient.Transport = c.httpClient.Transport
+	}
+}
+
+// TargetsRestricted reports whether private webhook targets are refused
+func (c *Client) TargetsRestricted() bool {
+	return c.guard != nil
+}
+
+// CheckTarget resolves the host of webhookURL and refuses it when any of its addresses
+// is forbidden, so a submission fails up front rather than at collection. Notifications
+// check again on every attempt.
+func (c *Client) CheckTarget(webhookURL string) error {
+	if c.guard == nil {
+		return nil
+	}
+	parsed, err := url.Parse(webhookURL)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.httpClient.Timeout)
+	defer cancel()
+	_, err = c.guard.resolve(ctx, parsed.Hostname())
+	return err
+}
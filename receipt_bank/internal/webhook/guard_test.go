@@ -0,0 +1,147 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"receipt-bank/internal/models"
+)
+
+func TestTargetPolicyPermits(t *testing.T) {
+	allowed, err := ParseAllowedTargets([]string{"127.0.0.1", "10.20.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := TargetPolicy{DenyPrivate: true, Allowed: allowed}
+
+	for _, tt := range []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", true}, // Allowed
+		{"127.0.0.2", false},
+		{"::1", false},
+		{"10.20.3.4", true}, // Allowed
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.10", false},
+		{"169.254.169.254", false}, // Cloud metadata
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::ffff:192.168.1.10", false}, // IPv4-mapped
+		{"::ffff:127.0.0.1", true},
+	} {
+		if got := policy.Permits(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("Permits(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+
+	if !(TargetPolicy{}).Permits(netip.MustParseAddr("10.1.2.3")) {
+		t.Error("A policy that doesn't deny private targets refused one")
+	}
+	if _, err := ParseAllowedTargets([]string{"lan"}); err == nil {
+		t.Error("Expected an error for an allowed target that is no address")
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	client := NewClient(time.Second, 0, false)
+	client.SetTargetPolicy(TargetPolicy{DenyPrivate: true})
+	client.guard.lookup = func(ctx context.Context, host string) ([]netip.Addr, error) {
+		// One bad address among good ones is enough to refuse the host
+		return []netip.Addr{netip.MustParseAddr("93.184.216.34"), netip.MustParseAddr("10.0.0.5")}, nil
+	}
+
+	if err := client.CheckTarget("http://169.254.169.254/latest/meta-data"); !errors.Is(err, ErrForbiddenTarget) {
+		t.Errorf("Expected ErrForbiddenTarget for a link-local address, got %v", err)
+	}
+	if err := client.CheckTarget("http://register.example/webhook"); !errors.Is(err, ErrForbiddenTarget) {
+		t.Errorf("Expected ErrForbiddenTarget for a host resolving to a private address, got %v", err)
+	}
+	if err := client.CheckTarget("https://93.184.216.34/webhook"); err != nil {
+		t.Errorf("Public address refused: %v", err)
+	}
+}
+
+// listenOn starts a server counting its requests on addr, skipping the test where the
+// address can't be bound (127.0.0.2 is only routed to loopback on some systems)
+func listenOn(t *testing.T, addr string, handler http.HandlerFunc) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("cannot listen on %s: %v", addr, err)
+	}
+	hits := &atomic.Int32{}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		handler(w, r)
+	}))
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, hits
+}
+
+func TestRedirectToForbiddenTarget(t *testing.T) {
+	internal, internalHits := listenOn(t, "127.0.0.2:0", func(w http.ResponseWriter, r *http.Request) {})
+	public, publicHits := listenOn(t, "127.0.0.1:0", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL+"/admin", http.StatusTemporaryRedirect)
+	})
+
+	client := NewClient(time.Second, 2, false)
+	client.SetTargetPolicy(TargetPolicy{DenyPrivate: true, Allowed: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}})
+
+	err := client.NotifyCollection(&models.Receipt{ReceiptID: "r1", WebhookURL: public.URL, Timestamp: time.Now()})
+	if !errors.Is(err, ErrForbiddenTarget) {
+		t.Fatalf("Expected ErrForbiddenTarget, got %v", err)
+	}
+	if internalHits.Load() != 0 {
+		t.Error("The redirect reached the internal address")
+	}
+	if publicHits.Load() != 1 {
+		t.Errorf("Expected one attempt, not retried, got %d", publicHits.Load())
+	}
+	if failures := client.Failures(0); len(failures) != 1 || failures[0].Attempts != 1 {
+		t.Errorf("Expected one recorded failure after 1 attempt, got %+v", failures)
+	}
+}
+
+func TestDNSRebindingBetweenAttempts(t *testing.T) {
+	server, hits := listenOn(t, "127.0.0.1:0", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable) // Forces a retry
+	})
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	client := NewClient(time.Second, 1, false)
+	client.SetTargetPolicy(TargetPolicy{DenyPrivate: true, Allowed: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}})
+	var lookups atomic.Int32
+	client.guard.lookup = func(ctx context.Context, host string) ([]netip.Addr, error) {
+		// Allowed on the first resolution, then rebound to another loopback address
+		if lookups.Add(1) == 1 {
+			return []netip.Addr{netip.MustParseAddr("127.0.0.1")}, nil
+		}
+		return []netip.Addr{netip.MustParseAddr("127.0.0.2")}, nil
+	}
+
+	err := client.NotifyCollection(&models.Receipt{ReceiptID: "r1", WebhookURL: "http://register.example:" + port + "/webhook", Timestamp: time.Now()})
+	if !errors.Is(err, ErrForbiddenTarget) {
+		t.Fatalf("Expected ErrForbiddenTarget on the retry, got %v", err)
+	}
+	if lookups.Load() != 2 {
+		t.Errorf("Expected the host resolved once per attempt, got %d lookups", lookups.Load())
+	}
+	if hits.Load() != 1 {
+		t.Errorf("Expected only the first attempt to arrive, got %d", hits.Load())
+	}
+}
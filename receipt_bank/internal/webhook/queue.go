@@ -0,0 +1,168 @@
+package webhook
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"receipt-bank/internal/models"
+)
+
+// Queue defaults
+const (
+	DefaultWorkers   = 8
+	DefaultQueueSize = 1000
+)
+
+// ErrQueueFull is returned for a notification refused because the delivery queue is full
+var ErrQueueFull = errors.New("webhook delivery queue is full")
+
+// QueueOptions sizes the delivery queue
+type QueueOptions struct {
+	Workers   int // Notifications delivered at once (0 = DefaultWorkers)
+	QueueSize int // Notifications waiting for a worker; more are refused (0 = DefaultQueueSize)
+}
+
+// delivery is a queued collection notification
+type delivery struct {
+	receipt  *models.Receipt
+	queuedAt time.Time
+	done     func(error)
+}
+
+// queue holds notifications for a fixed set of workers. Notifications to one
+// destination are delivered one at a time and in order, so a burst of collections
+// for one register doesn't hit it with parallel requests; workers take turns
+// between destinations instead.
+type queue struct {
+	size  int
+	ready chan string // Destinations with waiting notifications and no worker on them
+
+	mu      sync.Mutex
+	waiting map[string][]*delivery // Destination -> notifications in order; present while a worker holds or awaits it
+	depth   int                    // Notifications waiting, all destinations
+}
+
+// SetConcurrency sizes the delivery queue and starts its workers. Without it the
+// first Enqueue starts them with the defaults; once started they keep their size.
+func (c *Client) SetConcurrency(options QueueOptions) {
+	c.queueOptions = options
+	c.startOnce.Do(c.startWorkers)
+}
+
+// Enqueue queues a collection notification for the first collection of receipt
+// and calls done with its outcome once delivered or given up on. A full queue
+// refuses the notification with ErrQueueFull, counted as a failure, and done is
+// not called.
+func (c *Client) Enqueue(receipt *models.Receipt, done func(error)) error {
+	c.startOnce.Do(c.startWorkers)
+
+	destination := destinationOf(receipt.WebhookURL)
+	q := c.queue
+	q.mu.Lock()
+	if q.depth >= q.size {
+		q.mu.Unlock()
+		c.count(&c.stats.Dropped, 1)
+		c.recordFailure(receipt.WebhookURL, receipt.ReceiptID, 0, ErrQueueFull)
+		return ErrQueueFull
+	}
+	pending, busy := q.waiting[destination]
+	q.waiting[destination] = append(pending, &delivery{receipt: receipt, queuedAt: time.Now(), done: done})
+	q.depth++
+	if !busy {
+		// Never blocks: at most one entry per waiting notification is ever in ready
+		q.ready <- destination
+	}
+	c.mu.Lock()
+	c.stats.Pending++
+	c.stats.Queued++
+	c.mu.Unlock()
+	q.mu.Unlock()
+	return nil
+}
+
+func (c *Client) startWorkers() {
+	workers, size := c.queueOptions.Workers, c.queueOptions.QueueSize
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+
+	c.queue = &queue{
+		size:    size,
+		ready:   make(chan string, size),
+		waiting: make(map[string][]*delivery),
+	}
+	c.mu.Lock()
+	c.stats.Workers = int64(workers)
+	c.stats.QueueCapacity = int64(size)
+	c.mu.Unlock()
+
+	for i := 0; i < workers; i++ {
+		go c.work()
+	}
+	if c.verbose {
+		log.Printf("[WEBHOOK] Delivering with %d workers, up to %d notifications queued", workers, size)
+	}
+}
+
+// work delivers the next notification of each ready destination, handing the
+// destination back to the queue while more of its notifications wait
+func (c *Client) work() {
+	q := c.queue
+	for destination := range q.ready {
+		q.mu.Lock()
+		next := q.waiting[destination][0]
+		q.waiting[destination] = q.waiting[destination][1:]
+		q.depth--
+		c.count(&c.stats.Queued, -1)
+		q.mu.Unlock()
+
+		err := c.notify(next.receipt)
+		c.delivered(next.queuedAt, err)
+		if next.done != nil {
+			next.done(err)
+		}
+
+		q.mu.Lock()
+		if len(q.waiting[destination]) == 0 {
+			delete(q.waiting, destination)
+		} else {
+			q.ready <- destination
+		}
+		q.mu.Unlock()
+	}
+}
+
+// delivered records the outcome of a queued notification, and its latency from
+// being queued when it was delivered
+func (c *Client) delivered(queuedAt time.Time, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Pending--
+	if err != nil {
+		return
+	}
+	latency := time.Since(queuedAt)
+	c.latencyTotal += latency
+	c.latencyCount++
+	c.stats.LatencyAvgMs = float64(c.latencyTotal.Microseconds()) / float64(c.latencyCount) / 1000
+	if ms := latency.Milliseconds(); ms > c.stats.LatencyMaxMs {
+		c.stats.LatencyMaxMs = ms
+	}
+}
+
+// destinationOf names the register a webhook URL reaches: its host and port
+func destinationOf(webhookURL string) string {
+	u, err := url.Parse(webhookURL)
+	if err != nil || u.Host == "" {
+		return webhookURL
+	}
+	return strings.ToLower(u.Host)
+}
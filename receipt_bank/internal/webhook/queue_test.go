@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"receipt-bank/internal/models"
+)
+
+func TestQueueSerializesPerDestination(t *testing.T) {
+	started, release := make(chan struct{}, 10), make(chan struct{})
+	var mu sync.Mutex
+	var order []string
+	inFlight, maxInFlight := 0, 0
+	busy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload models.WebhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		order = append(order, payload.ReceiptID)
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		started <- struct{}{}
+		<-release
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer busy.Close()
+	idle := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer idle.Close()
+
+	client := NewClient(5*time.Second, 0, false)
+	client.SetConcurrency(QueueOptions{Workers: 2, QueueSize: 3})
+
+	results := make(chan string, 10)
+	enqueue := func(id, url string) error {
+		return client.Enqueue(&models.Receipt{ReceiptID: id, WebhookURL: url, Timestamp: time.Now()}, func(err error) {
+			if err != nil {
+				t.Errorf("Delivering %s: %v", id, err)
+			}
+			results <- id
+		})
+	}
+	for _, id := range []string{"a1", "a2", "a3"} {
+		if err := enqueue(id, busy.URL); err != nil {
+			t.Fatalf("Enqueue %s: %v", id, err)
+		}
+	}
+
+	<-started
+
+	// The second worker isn't held up by the busy register
+	if err := enqueue("b1", idle.URL); err != nil {
+		t.Fatalf("Enqueue b1: %v", err)
+	}
+	select {
+	case id := <-results:
+		if id != "b1" {
+			t.Fatalf("Expected b1 delivered first, got %s", id)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("b1 waited behind the busy register")
+	}
+
+	// a2 and a3 wait, a1 is being delivered: one more fits
+	if err := enqueue("a4", busy.URL); err != nil {
+		t.Fatalf("Enqueue a4: %v", err)
+	}
+	if err := enqueue("a5", busy.URL); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Expected ErrQueueFull, got %v", err)
+	}
+	if stats := client.Stats(); stats.Queued != 3 || stats.Pending != 4 {
+		t.Errorf("Expected 3 queued of 4 pending, got %+v", stats)
+	}
+
+	close(release)
+	for i := 0; i < 4; i++ {
+		select {
+		case <-results:
+		case <-time.After(3 * time.Second):
+			t.Fatal("Queued notifications were not delivered")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if maxInFlight != 1 {
+		t.Errorf("Expected one request at a time to the busy register, got %d", maxInFlight)
+	}
+	if want := []string{"a1", "a2", "a3", "a4"}; !slices.Equal(order, want) {
+		t.Errorf("Expected delivery in order %v, got %v", want, order)
+	}
+	stats := client.Stats()
+	if stats.Delivered != 5 || stats.Failed != 1 || stats.Dropped != 1 || stats.Pending != 0 || stats.Queued != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if failures := client.Failures(0); len(failures) != 1 || failures[0].ReceiptID != "a5" || failures[0].Attempts != 0 {
+		t.Errorf("Expected the dropped a5 among the failures, got %+v", failures)
+	}
+}
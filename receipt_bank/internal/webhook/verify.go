@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"receipt-bank/internal/models"
+)
+
+// maxChallengeResponse bounds how much of a challenge answer is read
+const maxChallengeResponse = 4096
+
+// maxVerifiedURLs bounds the verified receivers kept; expired ones are dropped beyond it
+const maxVerifiedURLs = 10000
+
+// ErrUnverified is returned for a webhook URL whose receiver did not echo the challenge
+var ErrUnverified = errors.New("webhook receiver did not answer the verification challenge")
+
+// verification is a challenge in flight; concurrent callers for the same URL wait for it
+type verification struct {
+	done chan struct{}
+	err  error
+}
+
+// EnableVerification makes the client challenge each webhook URL before trusting it:
+// the receiver must echo a one-time token before any receipt notification is sent
+// there. A verified URL is trusted for ttl, then challenged again.
+func (c *Client) EnableVerification(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.verifyTTL = ttl
+	c.verified = make(map[string]time.Time)
+	c.verifying = make(map[string]*verification)
+	// Challenges go to URLs nobody vouched for yet, so redirects are not followed
+	c.challengeClient = &http.Client{
+		Timeout:   c.httpClient.Timeout,
+		Transport: c.httpClient.Transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// VerificationEnabled reports whether webhook URLs are challenged before use
+func (c *Client) VerificationEnabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.verified != nil
+}
+
+// Verify challenges webhookURL unless it passed a challenge within the verification
+// TTL. It returns nil when verification is off.
+func (c *Client) Verify(webhookURL string) error {
+	c.mu.Lock()
+	if c.verified == nil {
+		c.mu.Unlock()
+		return nil
+	}
+	if until, ok := c.verified[webhookURL]; ok && time.Now().Before(until) {
+		c.mu.Unlock()
+		return nil
+	}
+	if pending, ok := c.verifying[webhookURL]; ok {
+		c.mu.Unlock()
+		<-pending.done
+		return pending.err
+	}
+	pending := &verification{done: make(chan struct{})}
+	c.verifying[webhookURL] = pending
+	c.mu.Unlock()
+
+	pending.err = c.challenge(webhookURL)
+
+	c.mu.Lock()
+	delete(c.verifying, webhookURL)
+	if pending.err == nil {
+		c.stats.Verified++
+		c.trust(webhookURL)
+	} else {
+		c.stats.Unverified++
+	}
+	c.mu.Unlock()
+	close(pending.done)
+
+	if pending.err != nil {
+		log.Printf("[WEBHOOK] Verification of %s failed: %v", webhookURL, pending.err)
+	} else if c.verbose {
+		log.Printf("[WEBHOOK] Verified receiver %s", webhookURL)
+	}
+	return pending.err
+}
+
+// trust records webhookURL as verified. Callers hold mu.
+func (c *Client) trust(webhookURL string) {
+	now := time.Now()
+	if len(c.verified) >= maxVerifiedURLs {
+		for url, until := range c.verified {
+			if now.After(until) {
+				delete(c.verified, url)
+			}
+		}
+	}
+	if len(c.verified) < maxVerifiedURLs {
+		c.verified[webhookURL] = now.Add(c.verifyTTL)
+	}
+}
+
+// challenge posts a one-time token to webhookURL and expects it echoed back
+func (c *Client) challenge(webhookURL string) error {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return fmt.Errorf("failed to generate challenge: %v", err)
+	}
+	payload := models.WebhookChallenge{
+		Type:      models.WebhookTypeVerification,
+		Challenge: hex.EncodeToString(token),
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal challenge: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.challengeClient.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnverified, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.sign(req, body)
+
+	resp, err := c.challengeClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnverified, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%w: status %d", ErrUnverified, resp.StatusCode)
+	}
+	var answer models.WebhookChallengeResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxChallengeResponse)).Decode(&answer); err != nil {
+		return fmt.Errorf("%w: unreadable answer", ErrUnverified)
+	}
+	if answer.Challenge != payload.Challenge {
+		return fmt.Errorf("%w: wrong challenge echoed", ErrUnverified)
+	}
+	return nil
+}
@@ -4,6 +4,13 @@
 # Usage: ./test_api.sh (assumes server is running on port 4403)
 
 BASE_URL="http://localhost:4403"
+REGISTER_KEY="${REGISTER_KEY:-demo-register-key}"
+
+# A wallet's compressed ephemeral key and a well-formed envelope (temporary key, nonce,
+# ciphertext and tag) that passes protocol.min_encrypted_bytes and validate_envelope
+EPHEMERAL_KEY="A1XHN8xsCk0zmQ9U/6qq234DoZrGMZQAZDbBY9/IgKOa"
+EPHEMERAL_KEY_PATH="A1XHN8xsCk0zmQ9U%2F6qq234DoZrGMZQAZDbBY9%2FIgKOa"
+ENCRYPTED_DATA="BKstNyd4u7jRetzTp8kIaTOIatnZZVK8o/QIHQga7nFjGOoIDSxtfDi0r34yRyNKvzrihpOGT/9ca+XMavYKSTpjogFa6pZl3ap4nzCPJFQdc1xPGcrM6O30mo5EW2oAbBjYtTz2jl/w8XBy1h9akVLmLsPd9g0TcpVHggM="
 
 echo "Testing Receipt Bank API..."
 
@@ -16,9 +23,10 @@ echo
 echo "2. Testing submit receipt..."
 SUBMIT_RESPONSE=$(curl -s -X POST "$BASE_URL/submit" \
   -H "Content-Type: application/json" \
+  -H "X-API-Key: $REGISTER_KEY" \
   -d '{
-    "ephemeral_key": "AwHr8L0AKZqGWxUqR8Ao4qoO+0LzW+5OXQ==",
-    "encrypted_data": "dGVzdF9lbmNyeXB0ZWRfZGF0YQ==",
+    "ephemeral_key": "'"$EPHEMERAL_KEY"'",
+    "encrypted_data": "'"$ENCRYPTED_DATA"'",
     "receipt_id": "test-receipt-123",
     "webhook_url": "http://localhost:8080/webhook"
   }')
@@ -26,16 +34,53 @@ SUBMIT_RESPONSE=$(curl -s -X POST "$BASE_URL/submit" \
 echo "Submit response: $SUBMIT_RESPONSE"
 echo
 
+# Test receipt metadata (doesn't collect it)
+echo "3. Testing receipt metadata..."
+META_RESPONSE=$(curl -s -X GET "$BASE_URL/collect/$EPHEMERAL_KEY_PATH/meta")
+echo "Meta response: $META_RESPONSE"
+echo
+
 # Test collect receipt  
-echo "3. Testing collect receipt..."
-COLLECT_RESPONSE=$(curl -s -X GET "$BASE_URL/collect/AwHr8L0AKZqGWxUqR8Ao4qoO+0LzW+5OXQ==")
+echo "4. Testing collect receipt..."
+COLLECT_RESPONSE=$(curl -s -X GET "$BASE_URL/collect/$EPHEMERAL_KEY_PATH")
 echo "Collect response: $COLLECT_RESPONSE"
 echo
 
+# Test raw collect (first 64 bytes, metadata in headers)
+echo "5. Testing raw collect..."
+curl -s -D - -o /dev/null -H "Accept: application/octet-stream" -H "Range: bytes=0-63" \
+  "$BASE_URL/collect/$EPHEMERAL_KEY_PATH"
+echo
+
 # Test collect again (should fail - already collected)
-echo "4. Testing collect again (should fail)..."
-COLLECT_RESPONSE2=$(curl -s -X GET "$BASE_URL/collect/AwHr8L0AKZqGWxUqR8Ao4qoO+0LzW+5OXQ==")
+echo "6. Testing collect again (should fail)..."
+COLLECT_RESPONSE2=$(curl -s -X GET "$BASE_URL/collect/$EPHEMERAL_KEY_PATH")
 echo "Second collect response: $COLLECT_RESPONSE2"
 echo
 
+# Test payloads that can't be a receipt envelope (should fail with 400)
+echo "7. Testing undersized encrypted_data (should fail)..."
+curl -s -X POST "$BASE_URL/submit" \
+  -H "Content-Type: application/json" \
+  -H "X-API-Key: $REGISTER_KEY" \
+  -d '{
+    "ephemeral_key": "'"$EPHEMERAL_KEY"'",
+    "encrypted_data": "dGVzdF9lbmNyeXB0ZWRfZGF0YQ==",
+    "receipt_id": "test-receipt-short",
+    "webhook_url": "http://localhost:8080/webhook"
+  }'
+echo
+
+echo "8. Testing encrypted_data without a temporary key (should fail)..."
+curl -s -X POST "$BASE_URL/submit" \
+  -H "Content-Type: application/json" \
+  -H "X-API-Key: $REGISTER_KEY" \
+  -d '{
+    "ephemeral_key": "'"$EPHEMERAL_KEY"'",
+    "encrypted_data": "BMYq7J7B3V+Q81XkmaVsfoEsihHUD63a9odmkgBtFxHQ7vjYBS1l4MJ9PFgwM3cgg+cBHSd+QO83/1CSHJgqwJNoDjIxVnvggH8Dst9dpgh19W2en3r1KnC8R4ZcD34wr/BmVI5deu6BDioENTT2qdEPPVNJoTsFb/r/XaU=",
+    "receipt_id": "test-receipt-garbage",
+    "webhook_url": "http://localhost:8080/webhook"
+  }'
+echo
+
 echo "API testing complete."
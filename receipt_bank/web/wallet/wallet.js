@@ -0,0 +1,514 @@
+// Receipt Wallet demo collector
+// Generates an ephemeral P-256 key pair with WebCrypto, shows the compressed
+// public key and this bank's URL as a QR payload, polls the receipt bank and
+// decrypts/verifies locally.
+// Byte layouts are documented at /wallet/format.json.
+class ReceiptWallet {
+    constructor() {
+        this.config = null;
+        this.keyPair = null;
+        this.ephemeralKeyBase64 = '';
+        this.pollTimer = null;
+
+        this.init();
+    }
+
+    async init() {
+        const response = await fetch('/wallet/config.json');
+        this.config = await response.json();
+
+        document.getElementById('new-key-btn').addEventListener('click', () => this.newKey());
+        await this.newKey();
+    }
+
+    async newKey() {
+        this.stopPolling();
+        document.getElementById('receipt-section').classList.add('hidden');
+        document.getElementById('qr-section').classList.remove('hidden');
+
+        this.keyPair = await crypto.subtle.generateKey(
+            { name: 'ECDH', namedCurve: 'P-256' }, false, ['deriveBits']
+        );
+        const raw = new Uint8Array(await crypto.subtle.exportKey('raw', this.keyPair.publicKey));
+        this.ephemeralKeyBase64 = toBase64(compressPoint(raw));
+
+        const qrContainer = document.getElementById('qr-code');
+        qrContainer.innerHTML = '';
+        const qrText = toBase64(encodeQRPayload(compressPoint(raw), window.location.origin));
+        new QRCode(qrContainer, { text: qrText, width: 220, height: 220 });
+        document.getElementById('key-display').textContent = this.ephemeralKeyBase64;
+
+        this.setPollStatus('Kasada QR kodu okutun, fiş bekleniyor...');
+        this.startPolling();
+    }
+
+    startPolling() {
+        this.pollTimer = setInterval(() => this.poll(), this.config.poll_interval_ms);
+    }
+
+    stopPolling() {
+        if (this.pollTimer) {
+            clearInterval(this.pollTimer);
+            this.pollTimer = null;
+        }
+    }
+
+    async poll() {
+        const response = await fetch(this.config.collect_path + encodeURIComponent(this.ephemeralKeyBase64));
+        if (response.status === 404) {
+            return;
+        }
+        this.stopPolling();
+
+        if (!response.ok) {
+            const error = await response.json();
+            this.setPollStatus('Hata: ' + (error.error || response.status));
+            return;
+        }
+
+        const data = await response.json();
+        try {
+            const signedReceipt = await this.decrypt(fromBase64(data.encrypted_data));
+            const { receipt, receiptBytes, signature, deviceSignature, timestampToken } = await splitSignedReceipt(signedReceipt);
+            let verified = await this.verify(receiptBytes, signature);
+            if (deviceSignature) {
+                receipt.deviceSigned = await verifyDeviceSignature(receipt.deviceKey, receiptBytes, deviceSignature);
+                if (receipt.deviceSigned === false) {
+                    verified = false;
+                }
+            }
+            if (timestampToken) {
+                receipt.timestampToken = await this.verifyTimestampToken(receiptBytes, timestampToken);
+            }
+            this.showReceipt(receipt, verified);
+        } catch (error) {
+            this.setPollStatus('Fiş çözülemedi: ' + error.message);
+        }
+    }
+
+    async decrypt(envelope) {
+        const tempPublicKey = await crypto.subtle.importKey(
+            'raw', envelope.slice(0, 65), { name: 'ECDH', namedCurve: 'P-256' }, false, []
+        );
+        const nonce = envelope.slice(65, 77);
+        const ciphertext = envelope.slice(77);
+
+        const sharedX = new Uint8Array(await crypto.subtle.deriveBits(
+            { name: 'ECDH', public: tempPublicKey }, this.keyPair.privateKey, 256
+        ));
+        // The register uses big.Int.Bytes(), which drops leading zero bytes
+        let start = 0;
+        while (start < sharedX.length - 1 && sharedX[start] === 0) {
+            start++;
+        }
+
+        const hkdfKey = await crypto.subtle.importKey('raw', sharedX.slice(start), 'HKDF', false, ['deriveKey']);
+        const aesKey = await crypto.subtle.deriveKey(
+            { name: 'HKDF', hash: 'SHA-256', salt: new Uint8Array(0), info: new TextEncoder().encode('Privacy-preserving-ECDH') },
+            hkdfKey, { name: 'AES-GCM', length: 256 }, false, ['decrypt']
+        );
+
+        return new Uint8Array(await crypto.subtle.decrypt({ name: 'AES-GCM', iv: nonce }, aesKey, ciphertext));
+    }
+
+    async authorityKey() {
+        const response = await fetch(this.config.authority_key);
+        if (!response.ok) {
+            return null;
+        }
+        const data = await response.json();
+        return crypto.subtle.importKey(
+            'spki', fromBase64(data.public_key), { name: 'ECDSA', namedCurve: 'P-256' }, false, ['verify']
+        );
+    }
+
+    async verify(receiptBytes, signature) {
+        try {
+            const publicKey = await this.authorityKey();
+            if (!publicKey) {
+                return null;
+            }
+            return await crypto.subtle.verify({ name: 'ECDSA', hash: 'SHA-256' }, publicKey, signature, receiptBytes);
+        } catch (error) {
+            return null;
+        }
+    }
+
+    // Token: version(1) || unix seconds(8) || signature(64) over SHA-256(receipt hash || unix seconds)
+    async verifyTimestampToken(receiptBytes, token) {
+        const result = { signedAt: null, verified: null };
+        if (token.length !== 73 || token[0] !== 0x01) {
+            result.verified = false;
+            return result;
+        }
+        const seconds = token.slice(1, 9);
+        result.signedAt = new Date(Number(new DataView(seconds.buffer, seconds.byteOffset).getBigUint64(0)) * 1000);
+        try {
+            const publicKey = await this.authorityKey();
+            if (!publicKey) {
+                return result;
+            }
+            const receiptHash = new Uint8Array(await crypto.subtle.digest('SHA-256', receiptBytes));
+            const message = new Uint8Array(receiptHash.length + seconds.length);
+            message.set(receiptHash);
+            message.set(seconds, receiptHash.length);
+            result.verified = await crypto.subtle.verify({ name: 'ECDSA', hash: 'SHA-256' }, publicKey, token.slice(9), message);
+        } catch (error) {
+            result.verified = null;
+        }
+        return result;
+    }
+
+    showReceipt(receipt, verified) {
+        document.getElementById('qr-section').classList.add('hidden');
+        document.getElementById('receipt-section').classList.remove('hidden');
+
+        const status = document.getElementById('verify-status');
+        if (verified === true) {
+            status.className = 'rounded px-3 py-2 text-sm font-semibold mb-3 bg-green-100 text-green-800';
+            status.textContent = 'İmza doğrulandı (Gelir İdaresi)';
+        } else if (verified === false) {
+            status.className = 'rounded px-3 py-2 text-sm font-semibold mb-3 bg-red-100 text-red-800';
+            status.textContent = 'İMZA GEÇERSİZ';
+        } else {
+            status.className = 'rounded px-3 py-2 text-sm font-semibold mb-3 bg-yellow-100 text-yellow-800';
+            status.textContent = 'İmza doğrulanamadı (anahtar alınamadı)';
+        }
+
+        const lines = [
+            receipt.storeName,
+            receipt.storeAddress,
+            'VKN: ' + receipt.storeVKN,
+            new Date(receipt.timestamp * 1000).toLocaleString('tr-TR'),
+            'Z: ' + receipt.zReportNumber + '  FİŞ: ' + receipt.receiptSerial,
+            '--------------------------------',
+        ];
+        if (receipt.refundOf) {
+            const original = receipt.refundOf;
+            lines.push('İADE FİŞİ');
+            lines.push('ASIL FİŞ: ' + original.receiptSerial + '  ' + new Date(original.timestamp * 1000).toLocaleString('tr-TR'));
+            lines.push('--------------------------------');
+        }
+        if (receipt.customer) {
+            const { taxNumber, name } = receipt.customer;
+            lines.push('SAYIN: ' + name);
+            lines.push((taxNumber.length === 11 ? 'TCKN: ' : 'VKN: ') + taxNumber);
+            lines.push('--------------------------------');
+        }
+        receipt.items.forEach(item => {
+            const quantity = item.weighed ? (item.quantity / 1000).toFixed(3).replace('.', ',') + ' kg' : item.quantity;
+            lines.push(`KISIM ${item.kisimId}  ${quantity} x ${formatKurus(item.unitPrice)}  %${item.taxRate}`);
+            lines.push(`${''.padStart(20)}${formatKurus(item.totalPrice).padStart(12)}`);
+            if (item.note) {
+                lines.push('  ' + item.note);
+            }
+        });
+        (receipt.surcharges || []).forEach(surcharge => {
+            lines.push(`${surcharge.name}  %${surcharge.taxRate}`);
+            lines.push(`${''.padStart(20)}${formatKurus(surcharge.amount).padStart(12)}`);
+        });
+        lines.push('--------------------------------');
+        lines.push('TOPKDV' + formatKurus(receipt.tax.totalTax).padStart(26));
+        lines.push('TOPLAM' + formatKurus(receipt.totalAmount).padStart(26));
+        if (receipt.currency) {
+            const { code, rate, foreignTotal } = receipt.currency;
+            const exponent = { JPY: 0, KRW: 0, KWD: 3, BHD: 3 }[code] ?? 2;
+            lines.push(code + (foreignTotal / 10 ** exponent).toFixed(exponent).padStart(29));
+            lines.push(`KUR 1 ${code} = ${rate.toFixed(4)} TL`);
+        }
+        lines.push(receipt.paymentMethod);
+        if (receipt.timestampToken) {
+            const token = receipt.timestampToken;
+            const mark = token.verified === true ? '✓' : token.verified === false ? '✗' : '?';
+            const signedAt = token.signedAt ? token.signedAt.toLocaleString('tr-TR') : '-';
+            lines.push(`GİB ZAMAN DAMGASI ${mark} ${signedAt}`);
+        }
+        if (receipt.deviceKey) {
+            const mark = receipt.deviceSigned === true ? '✓' : receipt.deviceSigned === false ? '✗' : '?';
+            lines.push(`CİHAZ İMZASI ${mark} ${toHex(receipt.deviceKey.slice(0, 8))}`);
+        }
+
+        document.getElementById('receipt-display').textContent = lines.join('\n');
+    }
+
+    setPollStatus(message) {
+        document.getElementById('poll-status').textContent = message;
+    }
+}
+
+// splitSignedReceipt cuts a signed receipt into the receipt and its trailers: the authority
+// signature, the register's device signature when the receipt carries a device key (tag 0x02)
+// and the 73-byte timestamp token when header flag 0x01 is set. Only the receipt itself
+// declares the device signature, so receipts with tagged extensions (flag 0x80) are first
+// split as device signed, and that split is kept only if the receipt names a device key.
+async function splitSignedReceipt(signedReceipt) {
+    const tokenSize = signedReceipt.length > 4 && (signedReceipt[3] & 0x01) !== 0 ? 73 : 0;
+    const split = async (deviceSignatureSize) => {
+        const signatureStart = signedReceipt.length - tokenSize - deviceSignatureSize - 64;
+        const receiptBytes = signedReceipt.slice(0, signatureStart);
+        const receipt = parseReceipt(await inflateReceipt(receiptBytes));
+        if (Boolean(receipt.deviceKey) !== deviceSignatureSize > 0) {
+            throw new Error(receipt.deviceKey ? 'Device key without device signature' : 'Device signature without device key');
+        }
+        const deviceStart = signatureStart + 64;
+        return {
+            receipt,
+            receiptBytes,
+            signature: signedReceipt.slice(signatureStart, deviceStart),
+            deviceSignature: deviceSignatureSize ? signedReceipt.slice(deviceStart, deviceStart + 64) : null,
+            timestampToken: tokenSize ? signedReceipt.slice(signedReceipt.length - tokenSize) : null,
+        };
+    };
+    if (signedReceipt.length > 4 && (signedReceipt[3] & 0x80) !== 0) {
+        try {
+            return await split(64);
+        } catch (error) {
+            // Not device signed
+        }
+    }
+    return split(0);
+}
+
+// verifyDeviceSignature checks the register's signature over the receipt with the device key
+// the receipt carries; null when the key can't be used
+async function verifyDeviceSignature(deviceKey, receiptBytes, signature) {
+    try {
+        const publicKey = await crypto.subtle.importKey(
+            'raw', decompressPoint(deviceKey), { name: 'ECDSA', namedCurve: 'P-256' }, false, ['verify']
+        );
+        return await crypto.subtle.verify({ name: 'ECDSA', hash: 'SHA-256' }, publicKey, signature, receiptBytes);
+    } catch (error) {
+        return null;
+    }
+}
+
+// MAX_DECOMPRESSED_SIZE matches receiptformat.MaxDecompressedSize: the largest body a
+// compressed receipt may inflate to
+const MAX_DECOMPRESSED_SIZE = 2 << 20;
+
+// inflateReceipt decompresses the body of a receipt with header flag 0x04 (zlib stream after
+// the 4-byte header); other receipts are returned as they are. Inflation stops, and the
+// receipt is refused, once the body passes MAX_DECOMPRESSED_SIZE.
+async function inflateReceipt(bytes) {
+    if (bytes.length < 4 || (bytes[3] & 0x04) === 0) {
+        return bytes;
+    }
+    const reader = new Blob([bytes.slice(4)]).stream().pipeThrough(new DecompressionStream('deflate')).getReader();
+    const chunks = [];
+    let size = 0;
+    for (;;) {
+        const { done, value } = await reader.read();
+        if (done) {
+            break;
+        }
+        size += value.length;
+        if (size > MAX_DECOMPRESSED_SIZE) {
+            await reader.cancel();
+            throw new Error(`Compressed body inflates beyond ${MAX_DECOMPRESSED_SIZE} bytes`);
+        }
+        chunks.push(value);
+    }
+    const inflated = new Uint8Array(4 + size);
+    inflated.set(bytes.slice(0, 4));
+    let offset = 4;
+    for (const chunk of chunks) {
+        inflated.set(chunk, offset);
+        offset += chunk.length;
+    }
+    return inflated;
+}
+
+// parseReceipt decodes binary receipt format v1 or v2 (already inflated)
+function parseReceipt(bytes) {
+    const view = new DataView(bytes.buffer, bytes.byteOffset, bytes.byteLength);
+    const decoder = new TextDecoder();
+    let offset = 0;
+
+    const u8 = () => view.getUint8(offset++);
+    const u16 = () => { const v = view.getUint16(offset); offset += 2; return v; };
+    const u32 = () => { const v = view.getUint32(offset); offset += 4; return v; };
+    const u64 = () => { const v = Number(view.getBigUint64(offset)); offset += 8; return v; };
+    const str = () => { const len = u32(); const s = decoder.decode(bytes.slice(offset, offset + len)); offset += len; return s; };
+
+    if (u16() !== 0x5452) {
+        throw new Error('Invalid receipt format');
+    }
+    const version = u8();
+    if (version !== 0x01 && version !== 0x02) {
+        throw new Error('Unsupported receipt version ' + version);
+    }
+    const flags = u8();
+
+    // v2 widens quantities to uint32 and amounts to uint64 kuruş (at most 2^53, exact as a Number)
+    const quantity = version === 0x02 ? u32 : u16;
+    const amount = version === 0x02 ? u64 : u32;
+
+    const receipt = {
+        timestamp: u64(),
+        zReportNumber: u32(),
+        transactionId: u32(),
+        storeVKN: u32(),
+        storeName: str(),
+        storeAddress: str(),
+        totalAmount: amount(),
+        paymentMethod: str(),
+        receiptSerial: u32(),
+        items: [],
+    };
+
+    // Flag 0x08 (v2): each item ends with a unit byte, 0x01 = grams priced per kilogram
+    // Flag 0x10 (v2): then with a uint8 length-prefixed UTF-8 note
+    const itemCount = u16();
+    for (let i = 0; i < itemCount; i++) {
+        const item = {
+            kisimId: u16(), quantity: quantity(), unitPrice: amount(), totalPrice: amount(), taxRate: u8(),
+        };
+        if (flags & 0x08) {
+            item.weighed = u8() === 0x01;
+        }
+        if (flags & 0x10) {
+            const len = u8();
+            item.note = decoder.decode(bytes.slice(offset, offset + len));
+            offset += len;
+        }
+        receipt.items.push(item);
+    }
+
+    receipt.tax = {
+        tax10Base: amount(), tax10Amount: amount(), tax20Base: amount(), tax20Amount: amount(), totalTax: amount(),
+    };
+
+    // Flag 0x02: foreign currency extension (ISO 4217 code, rate in millionths, total in minor units)
+    if (flags & 0x02) {
+        const code = decoder.decode(bytes.slice(offset, offset + 3));
+        offset += 3;
+        receipt.currency = { code, rate: u64() / 1e6, foreignTotal: amount() };
+    }
+
+    // Flag 0x20: customer extension (VKN or TCKN digits, then the customer's name)
+    if (flags & 0x20) {
+        receipt.customer = { taxNumber: str(), name: str() };
+    }
+
+    // Flag 0x40: refund extension (timestamp, transaction and serial of the sale paid back)
+    if (flags & 0x40) {
+        receipt.refundOf = { timestamp: u64(), transactionId: u32(), receiptSerial: u32() };
+    }
+
+    // Flag 0x80: tagged extensions (tag, uint32 length, data) to the end of the body.
+    // Tag 0x01 holds the surcharges, tag 0x02 the register's compressed device key; newer
+    // tags are skipped.
+    if (flags & 0x80) {
+        while (offset < bytes.length) {
+            const tag = u8();
+            const end = u32() + offset;
+            if (tag === 0x01) {
+                const count = u8();
+                receipt.surcharges = [];
+                for (let i = 0; i < count; i++) {
+                    receipt.surcharges.push({ name: str(), amount: amount(), taxRate: u8() });
+                }
+            } else if (tag === 0x02) {
+                receipt.deviceKey = bytes.slice(offset, end);
+            }
+            offset = end;
+        }
+    }
+    return receipt;
+}
+
+// compressPoint converts a 65-byte uncompressed point to 33-byte compressed form
+function compressPoint(raw) {
+    const compressed = new Uint8Array(33);
+    compressed[0] = (raw[64] & 1) ? 0x03 : 0x02;
+    compressed.set(raw.slice(1, 33), 1);
+    return compressed;
+}
+
+// decompressPoint converts a 33-byte compressed P-256 point to the 65-byte uncompressed
+// form every browser's WebCrypto imports: y = sqrt(x³ - 3x + b) mod p, picked by parity
+function decompressPoint(compressed) {
+    const p = 0xffffffff00000001000000000000000000000000ffffffffffffffffffffffffn;
+    const b = 0x5ac635d8aa3a93e7b3ebbd55769886bc651d06b0cc53b0f63bce3c3e27d2604bn;
+    if (compressed.length !== 33 || (compressed[0] !== 0x02 && compressed[0] !== 0x03)) {
+        throw new Error('Invalid compressed point');
+    }
+    const modPow = (base, exponent) => {
+        let result = 1n;
+        for (base %= p; exponent > 0n; exponent >>= 1n) {
+            if (exponent & 1n) {
+                result = result * base % p;
+            }
+            base = base * base % p;
+        }
+        return result;
+    };
+
+    const x = BigInt('0x' + toHex(compressed.slice(1)));
+    const rhs = ((x * x % p * x - 3n * x + b) % p + p) % p;
+    let y = modPow(rhs, (p + 1n) / 4n);
+    if (y * y % p !== rhs) {
+        throw new Error('Point not on curve');
+    }
+    if ((y & 1n) !== BigInt(compressed[0] & 1)) {
+        y = p - y;
+    }
+
+    const raw = new Uint8Array(65);
+    raw[0] = 0x04;
+    raw.set(compressed.slice(1), 1);
+    const yHex = y.toString(16).padStart(64, '0');
+    for (let i = 0; i < 32; i++) {
+        raw[33 + i] = parseInt(yHex.slice(2 * i, 2 * i + 2), 16);
+    }
+    return raw;
+}
+
+// encodeQRPayload writes QR payload version 1 (receiptwallet/qrpayload):
+// version(1) || compressed key(33) || bank URL length(1) || bank URL || CRC-32 of the rest(4)
+function encodeQRPayload(compressedKey, bankURL) {
+    const url = new TextEncoder().encode(bankURL);
+    if (url.length > 255) {
+        throw new Error('Bank URL too long for the QR payload');
+    }
+    const bytes = new Uint8Array(1 + 33 + 1 + url.length + 4);
+    bytes[0] = 0x01;
+    bytes.set(compressedKey, 1);
+    bytes[34] = url.length;
+    bytes.set(url, 35);
+    const body = bytes.subarray(0, bytes.length - 4);
+    new DataView(bytes.buffer).setUint32(body.length, crc32(body));
+    return bytes;
+}
+
+// crc32 is CRC-32/IEEE, as Go's hash/crc32.ChecksumIEEE
+function crc32(bytes) {
+    let crc = 0xffffffff;
+    for (const byte of bytes) {
+        crc ^= byte;
+        for (let bit = 0; bit < 8; bit++) {
+            crc = (crc >>> 1) ^ (0xedb88320 & -(crc & 1));
+        }
+    }
+    return (crc ^ 0xffffffff) >>> 0;
+}
+
+function formatKurus(kurus) {
+    return (kurus / 100).toFixed(2).replace('.', ',');
+}
+
+function toHex(bytes) {
+    return Array.from(bytes, b => b.toString(16).padStart(2, '0')).join('');
+}
+
+function toBase64(bytes) {
+    return btoa(String.fromCharCode(...bytes));
+}
+
+function fromBase64(text) {
+    return Uint8Array.from(atob(text), c => c.charCodeAt(0));
+}
+
+document.addEventListener('DOMContentLoaded', () => {
+    new ReceiptWallet();
+});
@@ -0,0 +1,337 @@
+// Package authority is the Go client for the revenue authority receipt service
+// (revenue_authority_receipt_service), whose API is described by the OpenAPI
+// document in openapi.yaml, also served by the authority at /openapi.yaml.
+//
+// Every Client method makes a single request; retrying and circuit breaking are
+// left to the caller, which can tell what is worth retrying from the errors:
+// ErrUnreachable for transport failures, *StatusError for error responses, and
+// ErrInvalidResponse or crypto.ErrInvalidResponseSignature for answers that
+// can't be trusted.
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	rwcrypto "receiptwallet/crypto"
+)
+
+// OpenAPI is the OpenAPI 3 document of the revenue authority API (YAML)
+//
+//go:embed openapi.yaml
+var OpenAPI []byte
+
+// APIKeyHeader identifies the register; the authority maps the key to its VKN
+const APIKeyHeader = "X-API-Key"
+
+// DefaultTimeout bounds requests of a Client created without an HTTP client
+const DefaultTimeout = 10 * time.Second
+
+// signedPaths are the endpoints whose responses the authority signs, besides the
+// device lists under signedPrefix
+var signedPaths = map[string]bool{"/sign": true, "/sign-receipt": true, "/public-key": true, "/certificate": true}
+
+const signedPrefix = "/devices/"
+
+// maxResponseSize bounds the responses read; certificate chains are the largest
+const maxResponseSize = 1 << 20
+
+var (
+	// ErrUnreachable is wrapped by transport failures: the request may not have
+	// reached the authority, or its answer was lost
+	ErrUnreachable = errors.New("revenue authority unreachable")
+
+	// ErrInvalidResponse is wrapped when a successful response can't be decoded, or
+	// serves a public key other than the pinned one
+	ErrInvalidResponse = errors.New("invalid revenue authority response")
+)
+
+// StatusError is an error response from the authority
+type StatusError struct {
+	StatusCode int
+	Message    string // The "error" field, or the body when it isn't JSON
+	RetryAfter string // Retry-After header, sent with 429 and 503
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("revenue authority error (%d): %s", e.StatusCode, e.Message)
+}
+
+// Signature is a decoded signing response
+type Signature struct {
+	Signature      []byte // 64-byte r || s
+	TimestampToken []byte // Nil unless requested
+	SignedAt       string // RFC 3339 time in the token
+}
+
+// Client calls a revenue authority
+type Client struct {
+	baseURL     string
+	httpClient  *http.Client
+	apiKey      string
+	responseKey *ecdsa.PublicKey
+}
+
+// NewClient creates a client for the authority at baseURL (e.g. http://localhost:4406).
+// A nil httpClient uses one with DefaultTimeout.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: httpClient}
+}
+
+// SetAPIKey sends key in X-API-Key, identifying the register for quotas and Z-reports
+func (c *Client) SetAPIKey(key string) {
+	c.apiKey = key
+}
+
+// SetResponseKey pins the authority key: signing, key and certificate requests carry a
+// fresh nonce, their responses must be signed over it with key, and /public-key must
+// serve key
+func (c *Client) SetResponseKey(key *ecdsa.PublicKey) {
+	c.responseKey = key
+}
+
+// Sign asks POST /sign to sign a SHA-256 hash, with a timestamp token when withTimestamp
+func (c *Client) Sign(ctx context.Context, hash []byte, withTimestamp bool) (*Signature, error) {
+	if len(hash) != 32 {
+		return nil, fmt.Errorf("invalid hash length: expected 32 bytes, got %d", len(hash))
+	}
+	return c.sign(ctx, "/sign", SignRequest{
+		Hash:      base64.StdEncoding.EncodeToString(hash),
+		Timestamp: withTimestamp,
+	})
+}
+
+// SignReceipt sends a binary receipt to POST /sign-receipt, so the authority checks its
+// VKN, total, timestamp and serial before signing its hash
+func (c *Client) SignReceipt(ctx context.Context, receipt []byte, withTimestamp bool) (*Signature, error) {
+	return c.sign(ctx, "/sign-receipt", SignReceiptRequest{
+		Receipt:   base64.StdEncoding.EncodeToString(receipt),
+		Timestamp: withTimestamp,
+	})
+}
+
+func (c *Client) sign(ctx context.Context, path string, signReq any) (*Signature, error) {
+	var signResp SignResponse
+	if _, err := c.do(ctx, http.MethodPost, path, signReq, nil, &signResp); err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(signResp.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature is not base64: %v", ErrInvalidResponse, err)
+	}
+	result := &Signature{Signature: signature, SignedAt: signResp.SignedAt}
+	if signResp.TimestampToken != "" {
+		if result.TimestampToken, err = base64.StdEncoding.DecodeString(signResp.TimestampToken); err != nil {
+			return nil, fmt.Errorf("%w: timestamp token is not base64: %v", ErrInvalidResponse, err)
+		}
+	}
+	return result, nil
+}
+
+// PublicKey fetches GET /public-key and returns the DER key and its ETag. With etag
+// the request is conditional: a nil key and no error mean the key is unchanged.
+func (c *Client) PublicKey(ctx context.Context, etag string) ([]byte, string, error) {
+	header := http.Header{}
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	var keyResp PublicKeyResponse
+	resp, err := c.do(ctx, http.MethodGet, "/public-key", nil, header, &keyResp)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, nil
+	}
+
+	der, err := base64.StdEncoding.DecodeString(keyResp.PublicKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: public key is not base64: %v", ErrInvalidResponse, err)
+	}
+	// The pinned key signs the responses, so it is the key the authority must serve
+	if c.responseKey != nil {
+		publicKey, err := x509.ParsePKIXPublicKey(der)
+		if err != nil || !c.responseKey.Equal(publicKey) {
+			return nil, "", fmt.Errorf("%w: public key does not match the pinned response key", ErrInvalidResponse)
+		}
+	}
+	return der, resp.Header.Get("ETag"), nil
+}
+
+// Certificate fetches GET /certificate: the PEM certificate chain of the signing key,
+// to check with crypto.VerifyCertificateChainPEM. Without a certificate configured
+// the authority answers 404.
+func (c *Client) Certificate(ctx context.Context) ([]byte, error) {
+	var chain []byte
+	if _, err := c.do(ctx, http.MethodGet, "/certificate", nil, nil, &chain); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// TrustBundle fetches GET /trust-bundle: the authority's keys signed by the current
+// one, to check with trustbundle.Parse or Bundle.VerifyUpdate. Without the endpoint
+// configured the authority answers 404.
+func (c *Client) TrustBundle(ctx context.Context) ([]byte, error) {
+	var bundle []byte
+	if _, err := c.do(ctx, http.MethodGet, "/trust-bundle", nil, nil, &bundle); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// SubmitZReport posts a Z-report to POST /zreport and returns the recorded report.
+// 409 Conflict means the number was already recorded.
+func (c *Client) SubmitZReport(ctx context.Context, submission ZReportSubmission) (*ZReportResponse, error) {
+	var recorded ZReportResponse
+	if _, err := c.do(ctx, http.MethodPost, "/zreport", submission, nil, &recorded); err != nil {
+		return nil, err
+	}
+	return &recorded, nil
+}
+
+// NewDeviceEnrollment signs an enrollment of deviceKey for vkn with the key itself
+func NewDeviceEnrollment(vkn, label string, deviceKey *ecdsa.PrivateKey) (DeviceEnrollmentRequest, error) {
+	compressed, err := rwcrypto.CompressKey(&deviceKey.PublicKey)
+	if err != nil {
+		return DeviceEnrollmentRequest{}, err
+	}
+	enrollment, err := json.Marshal(DeviceEnrollment{
+		VKN:       vkn,
+		PublicKey: base64.StdEncoding.EncodeToString(compressed),
+		Label:     label,
+	})
+	if err != nil {
+		return DeviceEnrollmentRequest{}, fmt.Errorf("failed to marshal enrollment: %v", err)
+	}
+	digest := sha256.Sum256(enrollment)
+	signature, err := rwcrypto.Sign(deviceKey, digest[:])
+	if err != nil {
+		return DeviceEnrollmentRequest{}, fmt.Errorf("failed to sign enrollment: %v", err)
+	}
+	return DeviceEnrollmentRequest{
+		Enrollment: enrollment,
+		Signature:  base64.StdEncoding.EncodeToString(signature),
+	}, nil
+}
+
+// EnrollDevice posts an enrollment to POST /devices and returns the enrolled device.
+// 409 Conflict means the key is already enrolled.
+func (c *Client) EnrollDevice(ctx context.Context, req DeviceEnrollmentRequest) (*Device, error) {
+	var device Device
+	if _, err := c.do(ctx, http.MethodPost, "/devices", req, nil, &device); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// Devices fetches GET /devices/{vkn}, the device keys enrolled for a VKN. With a pinned
+// response key the list must be signed by the authority.
+func (c *Client) Devices(ctx context.Context, vkn string) (*DevicesResponse, error) {
+	var devices DevicesResponse
+	if _, err := c.do(ctx, http.MethodGet, "/devices/"+url.PathEscape(vkn), nil, nil, &devices); err != nil {
+		return nil, err
+	}
+	return &devices, nil
+}
+
+// do sends a request with a JSON body (nil for none) and decodes a 200 response into
+// out, or copies it when out is a *[]byte. Error responses become *StatusError; a
+// 304 to a conditional request is returned without decoding.
+func (c *Client) do(ctx context.Context, method, path string, body any, header http.Header, out any) (*http.Response, error) {
+	url := c.baseURL + path
+
+	var requestBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s request: %v", path, err)
+		}
+		requestBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %v", path, err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set(APIKeyHeader, c.apiKey)
+	}
+
+	var nonce string
+	verify := c.responseKey != nil && (signedPaths[path] || strings.HasPrefix(path, signedPrefix))
+	if verify {
+		if nonce, err = rwcrypto.NewResponseNonce(); err != nil {
+			return nil, fmt.Errorf("failed to generate response nonce: %v", err)
+		}
+		req.Header.Set(rwcrypto.ResponseNonceHeader, nonce)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w at %s: %w", ErrUnreachable, url, err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read response from %s: %w", ErrUnreachable, url, err)
+	}
+
+	if verify {
+		signature := resp.Header.Get(rwcrypto.ResponseSignatureHeader)
+		if err := rwcrypto.VerifyResponse(c.responseKey, nonce, req.URL.Path, resp.StatusCode, responseBody, signature); err != nil {
+			// An overloaded authority sheds the response signature too; an unsigned 503
+			// only makes the caller retry, so it is reported as such
+			if resp.StatusCode == http.StatusServiceUnavailable && signature == "" {
+				return nil, &StatusError{StatusCode: resp.StatusCode, RetryAfter: resp.Header.Get("Retry-After"), Message: "unsigned response"}
+			}
+			return nil, fmt.Errorf("revenue authority response from %s: %w", url, err)
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && req.Header.Get("If-None-Match") != "":
+		return resp, nil
+	case resp.StatusCode != http.StatusOK:
+		statusErr := &StatusError{StatusCode: resp.StatusCode, RetryAfter: resp.Header.Get("Retry-After")}
+		var errorResp ErrorResponse
+		if json.Unmarshal(responseBody, &errorResp) == nil && errorResp.Error != "" {
+			statusErr.Message = errorResp.Error
+		} else {
+			statusErr.Message = strings.TrimSpace(string(responseBody))
+		}
+		return nil, statusErr
+	}
+
+	if raw, ok := out.(*[]byte); ok {
+		*raw = responseBody
+		return resp, nil
+	}
+	if err := json.Unmarshal(responseBody, out); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse %s response: %v", ErrInvalidResponse, path, err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,211 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	rwcrypto "receiptwallet/crypto"
+)
+
+func TestSign(t *testing.T) {
+	hash := bytes.Repeat([]byte{0xab}, 32)
+	signature := bytes.Repeat([]byte{0x01}, 64)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sign" || r.Header.Get(APIKeyHeader) != "key-1" {
+			t.Errorf("Unexpected request %s with API key %q", r.URL.Path, r.Header.Get(APIKeyHeader))
+		}
+		var req SignRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Hash != base64.StdEncoding.EncodeToString(hash) || !req.Timestamp {
+			t.Errorf("Unexpected sign request %+v", req)
+		}
+		json.NewEncoder(w).Encode(SignResponse{
+			Signature:      base64.StdEncoding.EncodeToString(signature),
+			TimestampToken: base64.StdEncoding.EncodeToString([]byte("token")),
+			SignedAt:       "2026-10-16T09:00:00Z",
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/", nil)
+	client.SetAPIKey("key-1")
+	result, err := client.Sign(context.Background(), hash, true)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if !bytes.Equal(result.Signature, signature) || string(result.TimestampToken) != "token" || result.SignedAt != "2026-10-16T09:00:00Z" {
+		t.Errorf("Unexpected signature %+v", result)
+	}
+
+	if _, err := client.Sign(context.Background(), hash[:16], false); err == nil {
+		t.Error("Expected an error for a short hash")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var status int
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	client := NewClient(server.URL, nil)
+	receipt := []byte{0x54, 0x52, 0x02}
+
+	status, body = http.StatusTooManyRequests, `{"error":"quota exceeded"}`
+	_, err := client.SignReceipt(context.Background(), receipt, false)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests || statusErr.Message != "quota exceeded" || statusErr.RetryAfter != "30" {
+		t.Errorf("Expected a 429 StatusError, got %#v", err)
+	}
+
+	status, body = http.StatusBadGateway, "upstream down\n"
+	_, err = client.SignReceipt(context.Background(), receipt, false)
+	if !errors.As(err, &statusErr) || statusErr.Message != "upstream down" {
+		t.Errorf("Expected the plain body as message, got %v", err)
+	}
+
+	status, body = http.StatusOK, "not json"
+	if _, err := client.SignReceipt(context.Background(), receipt, false); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("Expected ErrInvalidResponse, got %v", err)
+	}
+
+	server.Close()
+	if _, err := client.SignReceipt(context.Background(), receipt, false); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Expected ErrUnreachable, got %v", err)
+	}
+}
+
+func TestPublicKey(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	signResponses := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, body := http.StatusOK, []byte(`{"public_key":"`+base64.StdEncoding.EncodeToString(der)+`"}`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			status, body = http.StatusNotModified, nil
+		}
+		if signResponses {
+			signature, _ := rwcrypto.SignResponse(key, r.Header.Get(rwcrypto.ResponseNonceHeader), r.URL.Path, status, body)
+			w.Header().Set(rwcrypto.ResponseSignatureHeader, signature)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, nil)
+	client.SetResponseKey(&key.PublicKey)
+	got, etag, err := client.PublicKey(context.Background(), "")
+	if err != nil || !bytes.Equal(got, der) || etag != `"v1"` {
+		t.Fatalf("Unexpected public key %x, ETag %q, error %v", got, etag, err)
+	}
+	got, etag, err = client.PublicKey(context.Background(), `"v1"`)
+	if err != nil || got != nil || etag != `"v1"` {
+		t.Errorf("Expected an unchanged key, got %x, ETag %q, error %v", got, etag, err)
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	client.SetResponseKey(&other.PublicKey)
+	if _, _, err := client.PublicKey(context.Background(), ""); !errors.Is(err, rwcrypto.ErrInvalidResponseSignature) {
+		t.Errorf("Expected a response signed by another key to be refused, got %v", err)
+	}
+
+	signResponses = false
+	client.SetResponseKey(&key.PublicKey)
+	if _, _, err := client.PublicKey(context.Background(), ""); !errors.Is(err, rwcrypto.ErrInvalidResponseSignature) {
+		t.Errorf("Expected an unsigned response to be refused, got %v", err)
+	}
+}
+
+func TestDevices(t *testing.T) {
+	authorityKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	deviceKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var enrolled []Device
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/devices" {
+			// Check the proof of possession as the authority does
+			var req DeviceEnrollmentRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			var enrollment DeviceEnrollment
+			json.Unmarshal(req.Enrollment, &enrollment)
+			compressed, _ := base64.StdEncoding.DecodeString(enrollment.PublicKey)
+			signature, _ := base64.StdEncoding.DecodeString(req.Signature)
+			key, err := rwcrypto.DecompressKey(compressed)
+			digest := sha256.Sum256(req.Enrollment)
+			if err != nil || !rwcrypto.Verify(key, digest[:], signature) {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(ErrorResponse{Error: "Enrollment signature does not verify against the device key"})
+				return
+			}
+			device := Device{VKN: enrollment.VKN, PublicKey: enrollment.PublicKey, Label: enrollment.Label, Proven: true}
+			enrolled = append(enrolled, device)
+			json.NewEncoder(w).Encode(device)
+			return
+		}
+		if r.URL.Path != "/devices/1234567890" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := json.Marshal(DevicesResponse{VKN: "1234567890", Devices: enrolled})
+		signature, _ := rwcrypto.SignResponse(authorityKey, r.Header.Get(rwcrypto.ResponseNonceHeader), r.URL.Path, http.StatusOK, body)
+		w.Header().Set(rwcrypto.ResponseSignatureHeader, signature)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, nil)
+	req, err := NewDeviceEnrollment("1234567890", "Kasa 1", deviceKey)
+	if err != nil {
+		t.Fatalf("Failed to create enrollment: %v", err)
+	}
+	if _, err := client.EnrollDevice(context.Background(), req); err != nil {
+		t.Fatalf("EnrollDevice failed: %v", err)
+	}
+
+	// A signature by another key than the enrolled one proves nothing
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	forged, _ := NewDeviceEnrollment("1234567890", "Kasa 2", other)
+	forged.Enrollment = req.Enrollment
+	var statusErr *StatusError
+	if _, err := client.EnrollDevice(context.Background(), forged); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a forged enrollment, got %v", err)
+	}
+
+	client.SetResponseKey(&authorityKey.PublicKey)
+	list, err := client.Devices(context.Background(), "1234567890")
+	if err != nil {
+		t.Fatalf("Devices failed: %v", err)
+	}
+	compressed, _ := rwcrypto.CompressKey(&deviceKey.PublicKey)
+	if len(list.Devices) != 1 || list.Devices[0].PublicKey != base64.StdEncoding.EncodeToString(compressed) {
+		t.Errorf("Unexpected devices %+v", list.Devices)
+	}
+
+	client.SetResponseKey(&other.PublicKey)
+	if _, err := client.Devices(context.Background(), "1234567890"); !errors.Is(err, rwcrypto.ErrInvalidResponseSignature) {
+		t.Errorf("Expected a device list signed by another key to be refused, got %v", err)
+	}
+}
+
+func TestOpenAPIDescribesClient(t *testing.T) {
+	for _, path := range []string{"/sign:", "/sign-receipt:", "/public-key:", "/certificate:", "/trust-bundle:", "/zreport:", "/devices:"} {
+		if !bytes.Contains(OpenAPI, []byte("\n  "+path+"\n")) {
+			t.Errorf("openapi.yaml does not describe %s", path)
+		}
+	}
+}
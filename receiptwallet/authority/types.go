@@ -0,0 +1,100 @@
+package authority
+
+import "encoding/json"
+
+// SignRequest is the body of POST /sign
+type SignRequest struct {
+	Hash      string `json:"hash"` // Base64 SHA-256
+	Timestamp bool   `json:"timestamp,omitempty"`
+}
+
+// SignReceiptRequest is the body of POST /sign-receipt: the binary receipt the authority
+// checks and hashes itself
+type SignReceiptRequest struct {
+	Receipt   string `json:"receipt"` // Base64 binary receipt v1 or v2
+	Timestamp bool   `json:"timestamp,omitempty"`
+}
+
+// SignResponse answers POST /sign and POST /sign-receipt
+type SignResponse struct {
+	Signature      string `json:"signature"`                 // Base64 64-byte r || s
+	TimestampToken string `json:"timestamp_token,omitempty"` // Base64, when requested
+	SignedAt       string `json:"signed_at,omitempty"`       // RFC 3339 time in the token
+}
+
+// PublicKeyResponse answers GET /public-key
+type PublicKeyResponse struct {
+	PublicKey string `json:"public_key"` // Base64 DER (PKIX)
+}
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// DeviceEnrollmentRequest is the body of POST /devices: the enrollment plus the device
+// key's signature over the enrollment's exact JSON bytes (see NewDeviceEnrollment)
+type DeviceEnrollmentRequest struct {
+	Enrollment json.RawMessage `json:"enrollment"`
+	Signature  string          `json:"signature"` // Base64 r || s over SHA-256(enrollment)
+}
+
+// DeviceEnrollment declares a register's device key for its VKN
+type DeviceEnrollment struct {
+	VKN       string `json:"vkn"`
+	PublicKey string `json:"public_key"` // Base64 33-byte compressed P-256 key
+	Label     string `json:"label,omitempty"`
+}
+
+// Device is a device key the authority has enrolled
+type Device struct {
+	VKN        string `json:"vkn"`
+	PublicKey  string `json:"public_key"` // Base64 33-byte compressed P-256 key
+	KeyID      string `json:"key_id"`     // SHA-256 of the compressed key, hex
+	Label      string `json:"label,omitempty"`
+	Proven     bool   `json:"proven"`      // Enrolled with a signature by the device key
+	EnrolledAt string `json:"enrolled_at"` // RFC 3339
+}
+
+// DevicesResponse answers GET /devices/{vkn}
+type DevicesResponse struct {
+	VKN     string   `json:"vkn"`
+	Devices []Device `json:"devices"`
+}
+
+// ZReportSubmission is the body of POST /zreport: the summary plus the register's
+// signature over the summary's exact JSON bytes
+type ZReportSubmission struct {
+	Summary   json.RawMessage `json:"summary"`
+	Signature string          `json:"signature,omitempty"` // Base64 r || s over SHA-256(summary)
+}
+
+// ZReportSummary is the end-of-day summary a register declares to the authority
+type ZReportSummary struct {
+	VKN           string             `json:"vkn"`
+	Date          string             `json:"date"` // YYYY-MM-DD, local date the report closed
+	ZReportNumber string             `json:"z_report_number"`
+	OpenedAt      string             `json:"opened_at"` // RFC 3339
+	ClosedAt      string             `json:"closed_at"` // RFC 3339
+	ReceiptCount  int                `json:"receipt_count"`
+	FirstSerial   string             `json:"first_serial,omitempty"`
+	LastSerial    string             `json:"last_serial,omitempty"`
+	TotalAmount   float64            `json:"total_amount"`
+	TotalTax      float64            `json:"total_tax"`
+	TaxTotals     []ZReportTaxTotal  `json:"tax_totals"`
+	PaymentTotals map[string]float64 `json:"payment_totals,omitempty"`
+}
+
+// ZReportTaxTotal is the taxable amount and tax collected at one rate
+type ZReportTaxTotal struct {
+	Rate          int     `json:"rate"` // Percent
+	TaxableAmount float64 `json:"taxable_amount"`
+	TaxAmount     float64 `json:"tax_amount"`
+}
+
+// ZReportResponse is a Z-report as the authority recorded it
+type ZReportResponse struct {
+	ZReportSummary
+	Signed     bool   `json:"signed"`
+	ReceivedAt string `json:"received_at"` // RFC 3339
+}
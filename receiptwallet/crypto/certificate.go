@@ -0,0 +1,105 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CertificateChainContentType is served by the revenue authority's /certificate endpoint
+const CertificateChainContentType = "application/pem-certificate-chain"
+
+// ErrUntrustedCertificate is returned when a certificate chain does not lead to a trusted root
+var ErrUntrustedCertificate = errors.New("certificate not trusted")
+
+// ParseCertificateChainPEM parses concatenated "CERTIFICATE" PEM blocks, signing
+// certificate first and each following certificate issuing the one before it
+func ParseCertificateChainPEM(data []byte) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %d: %v", len(chain)+1, err)
+		}
+		chain = append(chain, certificate)
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no CERTIFICATE PEM block found")
+	}
+	return chain, nil
+}
+
+// ParseRootsPEM builds a pool of trusted roots from concatenated "CERTIFICATE" PEM blocks
+func ParseRootsPEM(data []byte) (*x509.CertPool, error) {
+	certificates, err := ParseCertificateChainPEM(data)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	for _, certificate := range certificates {
+		roots.AddCert(certificate)
+	}
+	return roots, nil
+}
+
+// VerifyCertificateChain checks that chain[0] is valid at the given time and chains
+// to one of roots through the remaining certificates, then returns its P-256 key.
+// The signing certificate must allow digital signatures when it restricts key usage.
+func VerifyCertificateChain(chain []*x509.Certificate, roots *x509.CertPool, at time.Time) (*ecdsa.PublicKey, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%w: empty certificate chain", ErrUntrustedCertificate)
+	}
+	if roots == nil {
+		return nil, fmt.Errorf("%w: no trusted roots configured", ErrUntrustedCertificate)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range chain[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	leaf := chain[0]
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUntrustedCertificate, err)
+	}
+
+	if leaf.KeyUsage != 0 && leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return nil, fmt.Errorf("%w: certificate %q does not allow digital signatures",
+			ErrUntrustedCertificate, leaf.Subject.CommonName)
+	}
+
+	publicKey, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+	if !ok || publicKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%w: certificate key is not ECDSA P-256", ErrInvalidKey)
+	}
+	return publicKey, nil
+}
+
+// VerifyCertificateChainPEM parses a PEM chain as served at /certificate and verifies it against roots
+func VerifyCertificateChainPEM(data []byte, roots *x509.CertPool, at time.Time) (*ecdsa.PublicKey, error) {
+	chain, err := ParseCertificateChainPEM(data)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyCertificateChain(chain, roots, at)
+}
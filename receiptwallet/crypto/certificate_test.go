@@ -0,0 +1,114 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+// issue creates a certificate for a fresh P-256 key, signed by parent (self-signed when nil)
+func issue(t *testing.T, name string, parent *testCA, isCA bool, usage x509.KeyUsage, notAfter time.Time) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              usage,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{certificate: certificate, key: key}
+}
+
+func encodeChain(certificates ...*testCA) []byte {
+	var data []byte
+	for _, c := range certificates {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.certificate.Raw})...)
+	}
+	return data
+}
+
+func TestVerifyCertificateChain(t *testing.T) {
+	year := time.Now().AddDate(1, 0, 0)
+	caUsage := x509.KeyUsageCertSign
+
+	root := issue(t, "Test Root", nil, true, caUsage, year)
+	intermediate := issue(t, "Test Intermediate", root, true, caUsage, year)
+	leaf := issue(t, "Test Authority", intermediate, false, x509.KeyUsageDigitalSignature, year)
+
+	roots, err := ParseRootsPEM(encodeChain(root))
+	if err != nil {
+		t.Fatalf("ParseRootsPEM: %v", err)
+	}
+
+	publicKey, err := VerifyCertificateChainPEM(encodeChain(leaf, intermediate), roots, time.Now())
+	if err != nil {
+		t.Fatalf("valid chain rejected: %v", err)
+	}
+	if !publicKey.Equal(&leaf.key.PublicKey) {
+		t.Fatal("returned key is not the signing certificate's key")
+	}
+
+	otherRoot := issue(t, "Other Root", nil, true, caUsage, year)
+	otherRoots, _ := ParseRootsPEM(encodeChain(otherRoot))
+	expiring := issue(t, "Expiring Authority", intermediate, false, x509.KeyUsageDigitalSignature, time.Now().Add(time.Hour))
+	encipherOnly := issue(t, "Encipher Authority", intermediate, false, x509.KeyUsageKeyEncipherment, year)
+
+	tests := []struct {
+		name  string
+		chain []byte
+		roots *x509.CertPool
+		at    time.Time
+	}{
+		{"untrusted root", encodeChain(leaf, intermediate), otherRoots, time.Now()},
+		{"missing intermediate", encodeChain(leaf), roots, time.Now()},
+		{"expired", encodeChain(expiring, intermediate), roots, time.Now().Add(2 * time.Hour)},
+		{"no signature usage", encodeChain(encipherOnly, intermediate), roots, time.Now()},
+		{"no roots", encodeChain(leaf, intermediate), nil, time.Now()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyCertificateChainPEM(tt.chain, tt.roots, tt.at)
+			if !errors.Is(err, ErrUntrustedCertificate) {
+				t.Fatalf("expected ErrUntrustedCertificate, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseCertificateChainPEMRejectsEmpty(t *testing.T) {
+	if _, err := ParseCertificateChainPEM([]byte("not a certificate")); err == nil {
+		t.Fatal("expected an error for input without certificates")
+	}
+}
@@ -0,0 +1,244 @@
+// Package crypto holds the receipt wallet cryptography shared by the cash
+// register and wallets: ECIES-style receipt encryption (ECDH P-256, HKDF-SHA256,
+// AES-256-GCM), compressed key encoding for QR codes, and fixed-size ECDSA signatures.
+//
+// Envelope layout: temp_public_key(65, uncompressed) || nonce(12) || ciphertext || tag(16)
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+const (
+	CompressedKeySize   = 33 // 0x02/0x03 || X
+	UncompressedKeySize = 65 // 0x04 || X || Y
+	SignatureSize       = 64 // r || s, each left-padded to 32 bytes
+	NonceSize           = 12
+	TagSize             = 16
+	KeySize             = 32 // AES-256
+
+	// HKDFInfo binds derived keys to the receipt wallet protocol
+	HKDFInfo = "Privacy-preserving-ECDH"
+
+	// MinEnvelopeSize is an envelope carrying an empty plaintext
+	MinEnvelopeSize = UncompressedKeySize + NonceSize + TagSize
+)
+
+// Errors returned by Decrypt and the key helpers
+var (
+	ErrInvalidKey       = errors.New("invalid P-256 public key")
+	ErrEnvelopeTooShort = errors.New("encrypted envelope too short")
+	ErrDecryptFailed    = errors.New("failed to decrypt envelope")
+)
+
+// Encrypt seals plaintext for the holder of recipient's private key.
+// A fresh temporary key pair and nonce are generated for every call.
+func Encrypt(plaintext []byte, recipient *ecdsa.PublicKey) ([]byte, error) {
+	recipientECDH, err := recipient.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	tempKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate temporary key: %v", err)
+	}
+
+	nonce := make([]byte, NonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	return seal(plaintext, recipientECDH, tempKey, nonce)
+}
+
+// EncryptToCompressed seals plaintext for a 33-byte compressed public key as carried in wallet QR codes
+func EncryptToCompressed(plaintext []byte, compressedKey []byte) ([]byte, error) {
+	recipient, err := DecompressKey(compressedKey)
+	if err != nil {
+		return nil, err
+	}
+	return Encrypt(plaintext, recipient)
+}
+
+// Decrypt opens an envelope produced by Encrypt with the recipient's private key
+func Decrypt(envelope []byte, recipient *ecdsa.PrivateKey) ([]byte, error) {
+	if len(envelope) < MinEnvelopeSize {
+		return nil, ErrEnvelopeTooShort
+	}
+
+	recipientECDH, err := recipient.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	tempPublic, err := ecdh.P256().NewPublicKey(envelope[:UncompressedKeySize])
+	if err != nil {
+		return nil, fmt.Errorf("%w: temporary key: %v", ErrInvalidKey, err)
+	}
+
+	aead, err := newAEAD(recipientECDH, tempPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := envelope[UncompressedKeySize : UncompressedKeySize+NonceSize]
+	plaintext, err := aead.Open(nil, nonce, envelope[UncompressedKeySize+NonceSize:], nil)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return plaintext, nil
+}
+
+// seal encrypts with explicit temporary key and nonce; Encrypt supplies random ones
+func seal(plaintext []byte, recipient *ecdh.PublicKey, tempKey *ecdh.PrivateKey, nonce []byte) ([]byte, error) {
+	aead, err := newAEAD(tempKey, recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	tempPublic := tempKey.PublicKey().Bytes()
+	envelope := make([]byte, 0, len(tempPublic)+NonceSize+len(plaintext)+TagSize)
+	envelope = append(envelope, tempPublic...)
+	envelope = append(envelope, nonce...)
+	return aead.Seal(envelope, nonce, plaintext, nil), nil
+}
+
+// newAEAD derives the AES-256-GCM key shared by private and peer
+func newAEAD(private *ecdh.PrivateKey, peer *ecdh.PublicKey) (cipher.AEAD, error) {
+	sharedX, err := private.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("ECDH failed: %v", err)
+	}
+	defer clear(sharedX)
+
+	// The first register release fed big.Int.Bytes() of the shared X into HKDF,
+	// which drops leading zero bytes; wallets do the same, so keep it for compatibility
+	secret := sharedX
+	for len(secret) > 1 && secret[0] == 0 {
+		secret = secret[1:]
+	}
+
+	key, err := hkdf.Key(sha256.New, secret, nil, HKDFInfo, KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive encryption key: %v", err)
+	}
+	defer clear(key)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// CompressKey encodes a P-256 public key in 33-byte compressed form
+func CompressKey(publicKey *ecdsa.PublicKey) ([]byte, error) {
+	if publicKey == nil || publicKey.Curve != elliptic.P256() || !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+		return nil, ErrInvalidKey
+	}
+	return elliptic.MarshalCompressed(elliptic.P256(), publicKey.X, publicKey.Y), nil
+}
+
+// DecompressKey parses a 33-byte compressed P-256 public key, rejecting points off the curve
+func DecompressKey(compressed []byte) (*ecdsa.PublicKey, error) {
+	if len(compressed) != CompressedKeySize {
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidKey, CompressedKeySize, len(compressed))
+	}
+
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), compressed)
+	if x == nil {
+		return nil, fmt.Errorf("%w: point is not on the curve", ErrInvalidKey)
+	}
+
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
+
+// ParsePublicKeyPEM parses a PKIX "PUBLIC KEY" PEM block holding a P-256 key
+func ParsePublicKeyPEM(data []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok || publicKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%w: not an ECDSA P-256 key", ErrInvalidKey)
+	}
+	return publicKey, nil
+}
+
+// ParsePrivateKeyPEM parses an "EC PRIVATE KEY" (SEC 1) or "PRIVATE KEY" (PKCS #8) PEM block holding a P-256 key
+func ParsePrivateKeyPEM(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	var privateKey *ecdsa.PrivateKey
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %v", err)
+		}
+		privateKey = key
+	default:
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %v", err)
+		}
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: not an ECDSA key", ErrInvalidKey)
+		}
+		privateKey = ecKey
+	}
+
+	if privateKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%w: not a P-256 key", ErrInvalidKey)
+	}
+	return privateKey, nil
+}
+
+// Sign signs a SHA-256 digest and returns a fixed-size 64-byte r || s signature
+func Sign(privateKey *ecdsa.PrivateKey, digest []byte) ([]byte, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, privateKey, digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign digest: %v", err)
+	}
+
+	signature := make([]byte, SignatureSize)
+	r.FillBytes(signature[:SignatureSize/2])
+	s.FillBytes(signature[SignatureSize/2:])
+	return signature, nil
+}
+
+// Verify checks a 64-byte r || s signature over a SHA-256 digest
+func Verify(publicKey *ecdsa.PublicKey, digest []byte, signature []byte) bool {
+	if publicKey == nil || len(signature) != SignatureSize {
+		return false
+	}
+
+	r := new(big.Int).SetBytes(signature[:SignatureSize/2])
+	s := new(big.Int).SetBytes(signature[SignatureSize/2:])
+	return ecdsa.Verify(publicKey, digest, r, s)
+}
@@ -0,0 +1,266 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+)
+
+// vectors mirrors testdata/vectors.json, shared with other implementations (see verify_vectors.mjs)
+type vectors struct {
+	Encryption []struct {
+		Name                string `json:"name"`
+		RecipientPrivateKey string `json:"recipient_private_key"`
+		RecipientPublicKey  string `json:"recipient_public_key"`
+		TempPrivateKey      string `json:"temp_private_key"`
+		Nonce               string `json:"nonce"`
+		Plaintext           string `json:"plaintext"`
+		Envelope            string `json:"envelope"`
+	} `json:"encryption"`
+	KeyCompression []struct {
+		Uncompressed string `json:"uncompressed"`
+		Compressed   string `json:"compressed"`
+	} `json:"key_compression"`
+	Signatures []struct {
+		PublicKey string `json:"public_key"`
+		Message   string `json:"message"`
+		Digest    string `json:"digest"`
+		Signature string `json:"signature"`
+		Valid     bool   `json:"valid"`
+	} `json:"signatures"`
+}
+
+func loadVectors(t *testing.T) vectors {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatalf("failed to read vectors: %v", err)
+	}
+	var v vectors
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("failed to parse vectors: %v", err)
+	}
+	return v
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
+
+func privateKeyFromScalar(t *testing.T, scalar []byte) *ecdsa.PrivateKey {
+	t.Helper()
+
+	d := new(big.Int).SetBytes(scalar)
+	key := &ecdsa.PrivateKey{D: d}
+	key.Curve = elliptic.P256()
+	key.X, key.Y = elliptic.P256().ScalarBaseMult(scalar)
+	return key
+}
+
+func TestEncryptionVectors(t *testing.T) {
+	for _, v := range loadVectors(t).Encryption {
+		t.Run(v.Name, func(t *testing.T) {
+			recipient := privateKeyFromScalar(t, mustHex(t, v.RecipientPrivateKey))
+			compressed, err := CompressKey(&recipient.PublicKey)
+			if err != nil || hex.EncodeToString(compressed) != v.RecipientPublicKey {
+				t.Fatalf("recipient public key mismatch: %x (%v)", compressed, err)
+			}
+
+			recipientECDH, err := recipient.PublicKey.ECDH()
+			if err != nil {
+				t.Fatalf("ECDH key conversion failed: %v", err)
+			}
+			tempKey, err := ecdh.P256().NewPrivateKey(mustHex(t, v.TempPrivateKey))
+			if err != nil {
+				t.Fatalf("bad temporary key: %v", err)
+			}
+
+			envelope, err := seal(mustHex(t, v.Plaintext), recipientECDH, tempKey, mustHex(t, v.Nonce))
+			if err != nil {
+				t.Fatalf("seal failed: %v", err)
+			}
+			if hex.EncodeToString(envelope) != v.Envelope {
+				t.Errorf("envelope mismatch:\n got %x\nwant %s", envelope, v.Envelope)
+			}
+
+			plaintext, err := Decrypt(mustHex(t, v.Envelope), recipient)
+			if err != nil {
+				t.Fatalf("decrypt failed: %v", err)
+			}
+			if hex.EncodeToString(plaintext) != v.Plaintext {
+				t.Errorf("plaintext mismatch: %x", plaintext)
+			}
+		})
+	}
+}
+
+func TestKeyCompressionVectors(t *testing.T) {
+	for _, v := range loadVectors(t).KeyCompression {
+		publicKey, err := DecompressKey(mustHex(t, v.Compressed))
+		if err != nil {
+			t.Fatalf("decompress %s failed: %v", v.Compressed, err)
+		}
+		uncompressed := elliptic.Marshal(elliptic.P256(), publicKey.X, publicKey.Y)
+		if hex.EncodeToString(uncompressed) != v.Uncompressed {
+			t.Errorf("decompress %s: got %x", v.Compressed, uncompressed)
+		}
+
+		compressed, err := CompressKey(publicKey)
+		if err != nil || hex.EncodeToString(compressed) != v.Compressed {
+			t.Errorf("compress round trip: got %x (%v)", compressed, err)
+		}
+	}
+}
+
+func TestSignatureVectors(t *testing.T) {
+	for _, v := range loadVectors(t).Signatures {
+		publicKey, err := DecompressKey(mustHex(t, v.PublicKey))
+		if err != nil {
+			t.Fatalf("bad public key: %v", err)
+		}
+		digest := sha256.Sum256(mustHex(t, v.Message))
+		if hex.EncodeToString(digest[:]) != v.Digest {
+			t.Fatalf("digest mismatch")
+		}
+		if got := Verify(publicKey, digest[:], mustHex(t, v.Signature)); got != v.Valid {
+			t.Errorf("Verify = %v, want %v", got, v.Valid)
+		}
+	}
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	recipient, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("key generation failed: %v", err)
+	}
+	compressed, err := CompressKey(&recipient.PublicKey)
+	if err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+
+	plaintext := bytes.Repeat([]byte("signed receipt "), 20)
+	envelope, err := EncryptToCompressed(plaintext, compressed)
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if len(envelope) != MinEnvelopeSize+len(plaintext) {
+		t.Errorf("unexpected envelope size %d", len(envelope))
+	}
+
+	decrypted, err := Decrypt(envelope, recipient)
+	if err != nil {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Error("round trip changed plaintext")
+	}
+
+	envelope[len(envelope)-1] ^= 0x01
+	if _, err := Decrypt(envelope, recipient); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("expected ErrDecryptFailed for tampered envelope, got %v", err)
+	}
+	if _, err := Decrypt(envelope[:MinEnvelopeSize-1], recipient); !errors.Is(err, ErrEnvelopeTooShort) {
+		t.Errorf("expected ErrEnvelopeTooShort, got %v", err)
+	}
+}
+
+func TestDecompressKeyRejectsInvalidKeys(t *testing.T) {
+	cases := map[string][]byte{
+		"empty":        nil,
+		"wrong length": make([]byte, 32),
+		"bad prefix":   append([]byte{0x04}, make([]byte, 32)...),
+		"off curve":    append([]byte{0x02}, bytes.Repeat([]byte{0xFF}, 32)...),
+	}
+	for name, key := range cases {
+		if _, err := DecompressKey(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%s: expected ErrInvalidKey, got %v", name, err)
+		}
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("key generation failed: %v", err)
+	}
+	digest := sha256.Sum256([]byte("receipt"))
+
+	signature, err := Sign(key, digest[:])
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if len(signature) != SignatureSize {
+		t.Fatalf("signature has %d bytes", len(signature))
+	}
+	if !Verify(&key.PublicKey, digest[:], signature) {
+		t.Error("valid signature rejected")
+	}
+
+	other := sha256.Sum256([]byte("other receipt"))
+	if Verify(&key.PublicKey, other[:], signature) {
+		t.Error("signature accepted for a different digest")
+	}
+	if Verify(&key.PublicKey, digest[:], signature[:63]) {
+		t.Error("short signature accepted")
+	}
+}
+
+func TestParsePEM(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("key generation failed: %v", err)
+	}
+
+	sec1, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal SEC 1 failed: %v", err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal PKCS #8 failed: %v", err)
+	}
+	pkix, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal PKIX failed: %v", err)
+	}
+
+	for _, block := range []*pem.Block{{Type: "EC PRIVATE KEY", Bytes: sec1}, {Type: "PRIVATE KEY", Bytes: pkcs8}} {
+		parsed, err := ParsePrivateKeyPEM(pem.EncodeToMemory(block))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", block.Type, err)
+		}
+		if !parsed.Equal(key) {
+			t.Errorf("%s: parsed key differs", block.Type)
+		}
+	}
+
+	publicKey, err := ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix}))
+	if err != nil {
+		t.Fatalf("public key parse failed: %v", err)
+	}
+	if !publicKey.Equal(&key.PublicKey) {
+		t.Error("parsed public key differs")
+	}
+
+	if _, err := ParsePublicKeyPEM([]byte("not pem")); err == nil {
+		t.Error("expected error for missing PEM block")
+	}
+}
@@ -0,0 +1,65 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// PossessionDomain prefixes every collection proof so a wallet's ephemeral key
+// signature can't be replayed as any other kind of signature
+const PossessionDomain = "receipt-bank-collect-v1"
+
+// PossessionNonceSize is the size of the challenge a receipt bank issues
+const PossessionNonceSize = 32
+
+// ErrInvalidProof is returned when a collection proof does not verify
+var ErrInvalidProof = errors.New("invalid proof of possession")
+
+// NewPossessionNonce generates a random collection challenge
+func NewPossessionNonce() ([]byte, error) {
+	nonce := make([]byte, PossessionNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return nonce, nil
+}
+
+// PossessionMessage is what a wallet signs to prove it holds the private half of
+// compressedKey: domain || nonce || compressed key. The signature is ECDSA P-256
+// over SHA-256 of the message, as WebCrypto produces with {name: "ECDSA", hash: "SHA-256"}.
+func PossessionMessage(nonce, compressedKey []byte) []byte {
+	message := make([]byte, 0, len(PossessionDomain)+len(nonce)+len(compressedKey))
+	message = append(message, PossessionDomain...)
+	message = append(message, nonce...)
+	return append(message, compressedKey...)
+}
+
+// SignPossession answers a collection challenge with the ephemeral private key
+func SignPossession(privateKey *ecdsa.PrivateKey, nonce []byte) ([]byte, error) {
+	compressed, err := CompressKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(PossessionMessage(nonce, compressed))
+	return Sign(privateKey, digest[:])
+}
+
+// VerifyPossession checks a 64-byte r || s proof over nonce against the compressed ephemeral key
+func VerifyPossession(compressedKey, nonce, signature []byte) error {
+	publicKey, err := DecompressKey(compressedKey)
+	if err != nil {
+		return err
+	}
+	if len(nonce) != PossessionNonceSize {
+		return fmt.Errorf("%w: nonce must be %d bytes", ErrInvalidProof, PossessionNonceSize)
+	}
+
+	digest := sha256.Sum256(PossessionMessage(nonce, compressedKey))
+	if !Verify(publicKey, digest[:], signature) {
+		return ErrInvalidProof
+	}
+	return nil
+}
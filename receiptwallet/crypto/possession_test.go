@@ -0,0 +1,44 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestPossessionProof(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("key generation failed: %v", err)
+	}
+	compressed, _ := CompressKey(&key.PublicKey)
+
+	nonce, err := NewPossessionNonce()
+	if err != nil {
+		t.Fatalf("nonce generation failed: %v", err)
+	}
+	proof, err := SignPossession(key, nonce)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if err := VerifyPossession(compressed, nonce, proof); err != nil {
+		t.Fatalf("valid proof rejected: %v", err)
+	}
+
+	otherNonce, _ := NewPossessionNonce()
+	if err := VerifyPossession(compressed, otherNonce, proof); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("proof accepted for another nonce: %v", err)
+	}
+
+	thief, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	stolen, _ := SignPossession(thief, nonce)
+	if err := VerifyPossession(compressed, nonce, stolen); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("proof from another key accepted: %v", err)
+	}
+
+	if err := VerifyPossession(compressed, nonce[:16], proof); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("short nonce accepted: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestResponseSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("key generation failed: %v", err)
+	}
+
+	nonce, err := NewResponseNonce()
+	if err != nil {
+		t.Fatalf("nonce generation failed: %v", err)
+	}
+	body := []byte(`{"signature":"c2lnbmF0dXJl"}`)
+	signature, err := SignResponse(key, nonce, "/sign", http.StatusOK, body)
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if err := VerifyResponse(&key.PublicKey, nonce, "/sign", http.StatusOK, body, signature); err != nil {
+		t.Fatalf("valid response rejected: %v", err)
+	}
+
+	otherNonce, _ := NewResponseNonce()
+	mitm, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	forged, _ := SignResponse(mitm, nonce, "/sign", http.StatusOK, body)
+
+	tests := []struct {
+		name      string
+		nonce     string
+		path      string
+		status    int
+		body      []byte
+		signature string
+	}{
+		{"replayed for another request", otherNonce, "/sign", http.StatusOK, body, signature},
+		{"another endpoint", nonce, "/public-key", http.StatusOK, body, signature},
+		{"another status", nonce, "/sign", http.StatusBadRequest, body, signature},
+		{"substituted body", nonce, "/sign", http.StatusOK, []byte(`{"signature":"b3RoZXI="}`), signature},
+		{"signed by another key", nonce, "/sign", http.StatusOK, body, forged},
+		{"unsigned", nonce, "/sign", http.StatusOK, body, ""},
+		{"malformed", nonce, "/sign", http.StatusOK, body, "not base64!"},
+	}
+	for _, tt := range tests {
+		err := VerifyResponse(&key.PublicKey, tt.nonce, tt.path, tt.status, tt.body, tt.signature)
+		if !errors.Is(err, ErrInvalidResponseSignature) {
+			t.Errorf("%s: expected ErrInvalidResponseSignature, got %v", tt.name, err)
+		}
+	}
+}
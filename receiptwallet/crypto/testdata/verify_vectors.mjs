@@ -0,0 +1,58 @@
+// Checks vectors.json against WebCrypto using the same steps as the browser wallet.
+// Usage: node verify_vectors.mjs
+import { readFileSync } from 'node:fs';
+import { ECDH, webcrypto } from 'node:crypto';
+
+const { subtle } = webcrypto;
+const vectors = JSON.parse(readFileSync(new URL('./vectors.json', import.meta.url)));
+const hex = s => Uint8Array.from(Buffer.from(s, 'hex'));
+const b64url = bytes => Buffer.from(bytes).toString('base64url');
+const uncompress = compressed => hex(ECDH.convertKey(compressed, 'prime256v1', 'hex', 'hex', 'uncompressed'));
+
+async function decrypt(privateKeyHex, publicKeyCompressedHex, envelope) {
+    const publicKey = uncompress(publicKeyCompressedHex);
+    const jwk = {
+        kty: 'EC', crv: 'P-256', d: b64url(hex(privateKeyHex)),
+        x: b64url(publicKey.slice(1, 33)), y: b64url(publicKey.slice(33)),
+    };
+    const privateKey = await subtle.importKey('jwk', jwk, { name: 'ECDH', namedCurve: 'P-256' }, false, ['deriveBits']);
+    const tempPublicKey = await subtle.importKey('raw', envelope.slice(0, 65), { name: 'ECDH', namedCurve: 'P-256' }, false, []);
+
+    const sharedX = new Uint8Array(await subtle.deriveBits({ name: 'ECDH', public: tempPublicKey }, privateKey, 256));
+    let start = 0;
+    while (start < sharedX.length - 1 && sharedX[start] === 0) {
+        start++;
+    }
+
+    const hkdfKey = await subtle.importKey('raw', sharedX.slice(start), 'HKDF', false, ['deriveKey']);
+    const aesKey = await subtle.deriveKey(
+        { name: 'HKDF', hash: 'SHA-256', salt: new Uint8Array(0), info: new TextEncoder().encode('Privacy-preserving-ECDH') },
+        hkdfKey, { name: 'AES-GCM', length: 256 }, false, ['decrypt']
+    );
+    return new Uint8Array(await subtle.decrypt({ name: 'AES-GCM', iv: envelope.slice(65, 77) }, aesKey, envelope.slice(77)));
+}
+
+let failures = 0;
+const check = (ok, name) => {
+    console.log(`${ok ? 'ok  ' : 'FAIL'} ${name}`);
+    if (!ok) failures++;
+};
+
+for (const v of vectors.encryption) {
+    const plaintext = await decrypt(v.recipient_private_key, v.recipient_public_key, hex(v.envelope));
+    check(Buffer.from(plaintext).toString('hex') === v.plaintext, 'decrypt: ' + v.name);
+}
+
+for (const v of vectors.key_compression) {
+    check(Buffer.from(uncompress(v.compressed)).toString('hex') === v.uncompressed, 'decompress: ' + v.compressed.slice(0, 16));
+}
+
+for (const v of vectors.signatures) {
+    // The signed digest is SHA-256(message); WebCrypto hashes the message itself
+    const key = await subtle.importKey('raw', uncompress(v.public_key), { name: 'ECDSA', namedCurve: 'P-256' }, false, ['verify']);
+    const digest = new Uint8Array(await subtle.digest('SHA-256', hex(v.message)));
+    const valid = await subtle.verify({ name: 'ECDSA', hash: 'SHA-256' }, key, hex(v.signature), hex(v.message));
+    check(Buffer.from(digest).toString('hex') === v.digest && valid === v.valid, `signature valid=${v.valid}`);
+}
+
+process.exit(failures ? 1 : 0);
@@ -0,0 +1,3 @@
+module receiptwallet
+
+go 1.24.0
@@ -0,0 +1,145 @@
+// Package qrpayload is the content of the QR code a wallet shows at the register:
+// the ephemeral key the receipt is encrypted to and, optionally, the receipt bank
+// the wallet collects from.
+//
+// Layout (version 1), big-endian, carried in the QR code as standard base64:
+//
+//	version(1)          0x01
+//	ephemeral_key(33)   compressed P-256 key (0x02/0x03 || X)
+//	bank_url_length(1)  0 = no bank URL hint
+//	bank_url(n)         UTF-8 http or https URL
+//	crc32(4)            CRC-32 (IEEE) of every byte before it
+//
+// QR codes from before version 1 carry the bare 33-byte key in base64; Decode
+// accepts those as a payload without a hint.
+package qrpayload
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/url"
+	"strings"
+
+	rwcrypto "receiptwallet/crypto"
+)
+
+// Version is the payload version written by Marshal
+const Version = 1
+
+// MaxBankURLLength bounds the bank URL hint
+const MaxBankURLLength = 255
+
+const (
+	headerSize  = 1 + rwcrypto.CompressedKeySize + 1
+	crcSize     = 4
+	minimumSize = headerSize + crcSize
+)
+
+// Errors returned by Unmarshal and Decode; ErrChecksum wraps ErrMalformed
+var (
+	ErrMalformed          = errors.New("malformed QR payload")
+	ErrChecksum           = fmt.Errorf("%w: checksum mismatch", ErrMalformed)
+	ErrUnsupportedVersion = errors.New("unsupported QR payload version")
+)
+
+// Payload is what a wallet's QR code tells the register
+type Payload struct {
+	Version      int    // Of the decoded payload; 0 for a bare key
+	EphemeralKey []byte // 33-byte compressed P-256 key
+	// BankURL is the receipt bank the wallet collects from (empty = none given). It is
+	// a hint: registers deposit with the bank they are configured for.
+	BankURL string
+}
+
+// Marshal writes p in the version 1 layout
+func (p *Payload) Marshal() ([]byte, error) {
+	if _, err := rwcrypto.DecompressKey(p.EphemeralKey); err != nil {
+		return nil, err
+	}
+	if err := checkBankURL(p.BankURL); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, minimumSize+len(p.BankURL))
+	data = append(data, Version)
+	data = append(data, p.EphemeralKey...)
+	data = append(data, byte(len(p.BankURL)))
+	data = append(data, p.BankURL...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data)), nil
+}
+
+// Encode returns the QR code text for p
+func (p *Payload) Encode() (string, error) {
+	data, err := p.Marshal()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Unmarshal reads a version 1 payload, or a bare compressed key
+func Unmarshal(data []byte) (*Payload, error) {
+	if len(data) == rwcrypto.CompressedKeySize {
+		if _, err := rwcrypto.DecompressKey(data); err != nil {
+			return nil, err
+		}
+		return &Payload{EphemeralKey: append([]byte(nil), data...)}, nil
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty", ErrMalformed)
+	}
+	if data[0] != Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[0])
+	}
+	if len(data) < minimumSize {
+		return nil, fmt.Errorf("%w: %d bytes, at least %d needed", ErrMalformed, len(data), minimumSize)
+	}
+	urlLength := int(data[headerSize-1])
+	if len(data) != minimumSize+urlLength {
+		return nil, fmt.Errorf("%w: %d bytes for a %d-byte bank URL", ErrMalformed, len(data), urlLength)
+	}
+	body := data[:len(data)-crcSize]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(body):]) {
+		return nil, ErrChecksum
+	}
+
+	p := &Payload{
+		Version:      Version,
+		EphemeralKey: append([]byte(nil), data[1:1+rwcrypto.CompressedKeySize]...),
+		BankURL:      string(data[headerSize:len(body)]),
+	}
+	if _, err := rwcrypto.DecompressKey(p.EphemeralKey); err != nil {
+		return nil, err
+	}
+	if err := checkBankURL(p.BankURL); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Decode reads QR code text: a base64 version 1 payload, or a base64 bare key
+func Decode(text string) (*Payload, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return Unmarshal(data)
+}
+
+func checkBankURL(bankURL string) error {
+	if bankURL == "" {
+		return nil
+	}
+	if len(bankURL) > MaxBankURLLength {
+		return fmt.Errorf("%w: bank URL longer than %d bytes", ErrMalformed, MaxBankURLLength)
+	}
+	u, err := url.Parse(bankURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: bank URL %q is not an http(s) URL", ErrMalformed, bankURL)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package qrpayload
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	rwcrypto "receiptwallet/crypto"
+)
+
+// generator is the P-256 base point, compressed
+const generator = "036b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c296"
+
+// Fixed encodings for other implementations (the browser wallet) to check against
+var vectors = []struct {
+	bankURL string
+	text    string
+}{
+	{"", "AQNrF9Hy4SxCR/i85uVjpEDydwN9gS3rM6D0oTlF2JjClgAswVeA"},
+	{"https://bank.example", "AQNrF9Hy4SxCR/i85uVjpEDydwN9gS3rM6D0oTlF2JjClhRodHRwczovL2JhbmsuZXhhbXBsZeXgweA="},
+}
+
+func generatorKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := hex.DecodeString(generator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVectors(t *testing.T) {
+	key := generatorKey(t)
+	for _, v := range vectors {
+		text, err := (&Payload{EphemeralKey: key, BankURL: v.bankURL}).Encode()
+		if err != nil {
+			t.Fatalf("Encode(%q): %v", v.bankURL, err)
+		}
+		if text != v.text {
+			t.Errorf("Encode(%q) = %s, want %s", v.bankURL, text, v.text)
+		}
+
+		p, err := Decode(v.text)
+		if err != nil {
+			t.Fatalf("Decode(%s): %v", v.text, err)
+		}
+		if p.Version != Version || !bytes.Equal(p.EphemeralKey, key) || p.BankURL != v.bankURL {
+			t.Errorf("Decode(%s) = %+v", v.text, p)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := rwcrypto.CompressKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	longest := "http://" + strings.Repeat("b", MaxBankURLLength-len("http://"))
+	for _, bankURL := range []string{"", "http://192.168.1.20:4403", longest} {
+		text, err := (&Payload{EphemeralKey: compressed, BankURL: bankURL}).Encode()
+		if err != nil {
+			t.Fatalf("Encode(%q): %v", bankURL, err)
+		}
+		p, err := Decode(text)
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if !bytes.Equal(p.EphemeralKey, compressed) || p.BankURL != bankURL {
+			t.Errorf("Round trip of %q gave %+v", bankURL, p)
+		}
+	}
+}
+
+func TestDecodeBareKey(t *testing.T) {
+	key := generatorKey(t)
+	p, err := Decode(base64.StdEncoding.EncodeToString(key) + "\n")
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if p.Version != 0 || !bytes.Equal(p.EphemeralKey, key) || p.BankURL != "" {
+		t.Errorf("Bare key decoded to %+v", p)
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	valid, _ := base64.StdEncoding.DecodeString(vectors[1].text)
+	modify := func(change func([]byte) []byte) string {
+		return base64.StdEncoding.EncodeToString(change(append([]byte(nil), valid...)))
+	}
+	offCurve := generatorKey(t)
+	offCurve[32] ^= 0xff
+
+	for _, tt := range []struct {
+		name string
+		text string
+		want error
+	}{
+		{"not base64", "mock_ephemeral_key_fallback", ErrMalformed},
+		{"empty", "", ErrMalformed},
+		{"flipped bit", modify(func(b []byte) []byte { b[10] ^= 0x01; return b }), ErrChecksum},
+		{"truncated", modify(func(b []byte) []byte { return b[:len(b)-1] }), ErrMalformed},
+		{"trailing byte", modify(func(b []byte) []byte { return append(b, 0) }), ErrMalformed},
+		{"version 2", modify(func(b []byte) []byte { b[0] = 2; return b }), ErrUnsupportedVersion},
+		{"bare key off the curve", base64.StdEncoding.EncodeToString(offCurve), rwcrypto.ErrInvalidKey},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.text); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalRejects(t *testing.T) {
+	key := generatorKey(t)
+	for _, p := range []*Payload{
+		{EphemeralKey: key[:32]},
+		{EphemeralKey: key, BankURL: "ftp://bank.example"},
+		{EphemeralKey: key, BankURL: "bank.example"},
+		{EphemeralKey: key, BankURL: "https://" + strings.Repeat("b", MaxBankURLLength)},
+	} {
+		if _, err := p.Marshal(); err == nil {
+			t.Errorf("Marshal accepted %+v", p)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+// Package receiptbank is the Go client for the receipt bank (receipt_bank): registers
+// submit encrypted receipts with it and wallets collect them, proving possession of
+// the ephemeral key when the bank asks.
+//
+// Errors from the bank are *Error, unwrapping to ErrDuplicateReceipt, ErrNotFound and
+// the other sentinels by error code; transport failures wrap ErrUnreachable.
+// Temporary tells what is worth retrying. A Client makes one attempt per call unless
+// SetRetry allows more.
+package receiptbank
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	rwcrypto "receiptwallet/crypto"
+)
+
+// APIVersion is the bank protocol version the client speaks (/v1/...)
+const APIVersion = "1"
+
+// Headers carrying a proof of possession on GET /collect
+const (
+	PossessionNonceHeader     = "X-Possession-Nonce"
+	PossessionSignatureHeader = "X-Possession-Signature"
+)
+
+// DefaultTimeout bounds requests of a Client created without an HTTP client
+const DefaultTimeout = 15 * time.Second
+
+// maxResponseSize bounds the responses read; a batch response is the largest
+const maxResponseSize = 4 << 20
+
+// RetryPolicy retries temporary failures with exponential backoff, waiting at least
+// as long as the bank's Retry-After
+type RetryPolicy struct {
+	Attempts  int           // Including the first (0 or 1 = no retries)
+	BaseDelay time.Duration // Before the first retry, doubled for each next one
+	MaxDelay  time.Duration // Caps the delay (0 = uncapped)
+}
+
+// Client calls a receipt bank
+type Client struct {
+	baseURL    string
+	resolve    func() string
+	httpClient *http.Client
+	apiKey     string
+	retry      RetryPolicy
+}
+
+// NewClient creates a client for the bank at baseURL (e.g. http://localhost:4407).
+// A nil httpClient uses one with DefaultTimeout.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Client{baseURL: baseURL, httpClient: httpClient}
+}
+
+// SetAPIKey sends key in X-API-Key, identifying the register to banks that require it
+func (c *Client) SetAPIKey(key string) {
+	c.apiKey = key
+}
+
+// SetURLResolver asks resolve for the bank URL on every request, e.g. after discovery;
+// an empty answer falls back to the URL given to NewClient
+func (c *Client) SetURLResolver(resolve func() string) {
+	c.resolve = resolve
+}
+
+// SetRetry retries temporary failures within each call
+func (c *Client) SetRetry(policy RetryPolicy) {
+	c.retry = policy
+}
+
+// Submit stores a receipt. When a retry finds the receipt ID already stored, an
+// earlier attempt got through before its answer was lost, so that counts as success.
+func (c *Client) Submit(ctx context.Context, submission SubmitRequest) (*SubmitResponse, error) {
+	var submitResp SubmitResponse
+	err := c.withRetry(ctx, func(attempt int) error {
+		_, err := c.call(ctx, http.MethodPost, "/v"+APIVersion+"/submit", submission, nil, &submitResp)
+		if attempt > 1 && errors.Is(err, ErrDuplicateReceipt) {
+			submitResp = SubmitResponse{ReceiptID: submission.ReceiptID}
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &submitResp, nil
+}
+
+// BatchResult is the outcome of one receipt of SubmitBatch: Err (an *Error) is nil once
+// the bank holds the receipt. Duplicate marks a receipt ID the bank already held.
+type BatchResult struct {
+	ReceiptID string
+	Duplicate bool
+	Err       error
+}
+
+// SubmitBatch stores up to MaxBatchSize receipts in one request. Each receipt is stored
+// or refused on its own; the returned error covers only the request as a whole.
+// A batch usually flushes receipts whose earlier submission failed, and that failure may
+// have been a lost answer after the bank stored the receipt. So a duplicate counts as
+// stored on any attempt, not only on a retry of this batch, with Duplicate set.
+func (c *Client) SubmitBatch(ctx context.Context, submissions []SubmitRequest) ([]BatchResult, SubmitBatchSummary, error) {
+	if len(submissions) > MaxBatchSize {
+		return nil, SubmitBatchSummary{}, fmt.Errorf("batch of %d receipts exceeds the receipt bank's limit of %d", len(submissions), MaxBatchSize)
+	}
+
+	var batchResp SubmitBatchResponse
+	err := c.withRetry(ctx, func(int) error {
+		_, err := c.call(ctx, http.MethodPost, "/v"+APIVersion+"/submit/batch", SubmitBatchRequest{Receipts: submissions}, nil, &batchResp)
+		return err
+	})
+	if err != nil {
+		return nil, SubmitBatchSummary{}, err
+	}
+	if len(batchResp.Results) != len(submissions) {
+		return nil, SubmitBatchSummary{}, fmt.Errorf("%w: %d results for %d receipts", ErrInvalidResponse, len(batchResp.Results), len(submissions))
+	}
+
+	results := make([]BatchResult, len(batchResp.Results))
+	for i, entry := range batchResp.Results {
+		results[i].ReceiptID = entry.ReceiptID
+		if entry.Status == http.StatusOK || entry.Status == http.StatusCreated {
+			continue
+		}
+		bankErr := &Error{Status: entry.Status, Code: entry.Code, Message: entry.Error}
+		if errors.Is(bankErr, ErrDuplicateReceipt) {
+			results[i].Duplicate = true
+			continue
+		}
+		results[i].Err = bankErr
+	}
+	return results, batchResp.Summary, nil
+}
+
+// Collected is a receipt taken from the bank
+type Collected struct {
+	ReceiptID     string
+	EncryptedData []byte // Envelope for crypto.Decrypt
+	ETag          string
+}
+
+// Collect takes the receipt submitted under ephemeralKey (compressed, base64). With
+// privateKey, the ephemeral key's private half, the collection carries a proof of
+// possession when the bank offers challenges. A receipt not submitted yet is ErrNotFound.
+func (c *Client) Collect(ctx context.Context, ephemeralKey string, privateKey *ecdsa.PrivateKey) (*Collected, error) {
+	path := "/v" + APIVersion + "/collect/" + url.PathEscape(ephemeralKey)
+
+	var collectResp CollectResponse
+	var etag string
+	err := c.withRetry(ctx, func(int) error {
+		header := http.Header{}
+		if privateKey != nil {
+			if err := c.prove(ctx, path, privateKey, header); err != nil {
+				return err
+			}
+		}
+		header.Set("Accept", "application/json")
+		resp, err := c.call(ctx, http.MethodGet, path, nil, header, &collectResp)
+		if err != nil {
+			return err
+		}
+		etag = resp.Header.Get("ETag")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedData, err := base64.StdEncoding.DecodeString(collectResp.EncryptedData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: encrypted data is not base64: %v", ErrInvalidResponse, err)
+	}
+	return &Collected{ReceiptID: collectResp.ReceiptID, EncryptedData: encryptedData, ETag: etag}, nil
+}
+
+// Meta reports whether a receipt is waiting under ephemeralKey and how large it is,
+// without collecting it. privateKey proves possession as for Collect, which banks that
+// require proofs ask for here too. Banks that predate the endpoint answer 404 (ErrNotFound).
+func (c *Client) Meta(ctx context.Context, ephemeralKey string, privateKey *ecdsa.PrivateKey) (*ReceiptMeta, error) {
+	collectPath := "/v" + APIVersion + "/collect/" + url.PathEscape(ephemeralKey)
+
+	var meta ReceiptMeta
+	err := c.withRetry(ctx, func(int) error {
+		header := http.Header{}
+		if privateKey != nil {
+			if err := c.prove(ctx, collectPath, privateKey, header); err != nil {
+				return err
+			}
+		}
+		header.Set("Accept", "application/json")
+		_, err := c.call(ctx, http.MethodGet, collectPath+"/meta", nil, header, &meta)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// prove fetches a challenge for a collection and sets the signed answer on header.
+// Banks without challenges (404, 405) get the collection unsigned.
+func (c *Client) prove(ctx context.Context, collectPath string, privateKey *ecdsa.PrivateKey, header http.Header) error {
+	var challenge ChallengeResponse
+	_, err := c.call(ctx, http.MethodPost, collectPath+"/challenge", nil, nil, &challenge)
+	var bankErr *Error
+	if errors.As(err, &bankErr) && (bankErr.Status == http.StatusNotFound || bankErr.Status == http.StatusMethodNotAllowed) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(challenge.Nonce)
+	if err != nil {
+		return fmt.Errorf("%w: challenge nonce is not base64: %v", ErrInvalidResponse, err)
+	}
+	signature, err := rwcrypto.SignPossession(privateKey, nonce)
+	if err != nil {
+		return fmt.Errorf("failed to sign challenge: %v", err)
+	}
+	header.Set(PossessionNonceHeader, challenge.Nonce)
+	header.Set(PossessionSignatureHeader, base64.StdEncoding.EncodeToString(signature))
+	return nil
+}
+
+// Health fetches GET /health. An unhealthy bank answers 503 with its health, which is
+// returned together with the *Error.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var health Health
+	_, body, err := c.do(ctx, http.MethodGet, "/health", nil, nil)
+	var bankErr *Error
+	if err != nil && !(errors.As(err, &bankErr) && bankErr.Status == http.StatusServiceUnavailable) {
+		return nil, err
+	}
+	if json.Unmarshal(body, &health) != nil || health.Status == "" {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: failed to parse /health response", ErrInvalidResponse)
+	}
+	return &health, err
+}
+
+// Version fetches the GET /version handshake. Banks that predate it answer 404 (ErrNotFound).
+func (c *Client) Version(ctx context.Context) (*VersionResponse, error) {
+	var version VersionResponse
+	if _, err := c.call(ctx, http.MethodGet, "/version", nil, nil, &version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// endpoint returns the bank URL for the next request
+func (c *Client) endpoint() string {
+	if c.resolve != nil {
+		if url := c.resolve(); url != "" {
+			return strings.TrimSuffix(url, "/")
+		}
+	}
+	return strings.TrimSuffix(c.baseURL, "/")
+}
+
+// withRetry runs attempt until it succeeds, fails for good or the policy's attempts
+// run out, sleeping between attempts unless ctx ends first
+func (c *Client) withRetry(ctx context.Context, attempt func(attempt int) error) error {
+	attempts := max(c.retry.Attempts, 1)
+	delay := c.retry.BaseDelay
+	for n := 1; ; n++ {
+		err := attempt(n)
+		if err == nil || n >= attempts || !Temporary(err) {
+			return err
+		}
+
+		wait := delay
+		var bankErr *Error
+		if errors.As(err, &bankErr) && bankErr.RetryAfter > wait {
+			wait = bankErr.RetryAfter
+		}
+		if c.retry.MaxDelay > 0 && wait > c.retry.MaxDelay {
+			wait = c.retry.MaxDelay
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// do sends a request with a JSON body (nil for none) and returns the response and its
+// body. Responses other than 200 and 201 become *Error, still returned with the body.
+func (c *Client) do(ctx context.Context, method, path string, body any, header http.Header) (*http.Response, []byte, error) {
+	url := c.endpoint() + path
+
+	var requestBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal %s request: %v", path, err)
+		}
+		requestBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, requestBody)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create %s request: %v", path, err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w at %s: %w", ErrUnreachable, url, err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to read response from %s: %w", ErrUnreachable, url, err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		bankErr := &Error{Status: resp.StatusCode, Message: strings.TrimSpace(string(responseBody))}
+		var errorResp ErrorResponse
+		if json.Unmarshal(responseBody, &errorResp) == nil && errorResp.Error != "" {
+			bankErr.Code, bankErr.Message = errorResp.Code, errorResp.Error
+		}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			bankErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return resp, responseBody, bankErr
+	}
+	return resp, responseBody, nil
+}
+
+// call is do for JSON responses: it decodes a successful response into out
+func (c *Client) call(ctx context.Context, method, path string, body any, header http.Header, out any) (*http.Response, error) {
+	resp, responseBody, err := c.do(ctx, method, path, body, header)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(responseBody, out); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse %s response: %v", ErrInvalidResponse, path, err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,233 @@
+package receiptbank
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	rwcrypto "receiptwallet/crypto"
+)
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestErrorCodes(t *testing.T) {
+	tests := []struct {
+		status    int
+		code      string
+		sentinel  error
+		temporary bool
+	}{
+		{http.StatusBadRequest, CodeInvalidKey, ErrInvalidKey, false},
+		{http.StatusConflict, CodeDuplicateReceipt, ErrDuplicateReceipt, false},
+		{http.StatusConflict, "", ErrDuplicateReceipt, false}, // Banks without codes
+		{http.StatusNotFound, "", ErrNotFound, false},
+		{http.StatusTooManyRequests, CodeRateLimited, ErrRateLimited, true},
+		{http.StatusTooManyRequests, "", ErrRateLimited, true}, // A proxy's rate limit
+		{http.StatusInsufficientStorage, CodeStorageFull, ErrStorageFull, true},
+		{http.StatusServiceUnavailable, CodeUnavailable, ErrUnavailable, true},
+		{http.StatusUnprocessableEntity, CodeWebhookUnverified, ErrWebhookUnverified, false},
+		{http.StatusInternalServerError, "", nil, true},
+		{http.StatusBadRequest, "", nil, false},
+	}
+	for _, tt := range tests {
+		err := error(&Error{Status: tt.status, Code: tt.code, Message: "refused"})
+		if tt.sentinel != nil && !errors.Is(err, tt.sentinel) {
+			t.Errorf("%d %q: expected %v", tt.status, tt.code, tt.sentinel)
+		}
+		if Temporary(err) != tt.temporary {
+			t.Errorf("%d %q: expected Temporary = %v", tt.status, tt.code, tt.temporary)
+		}
+	}
+	if !Temporary(ErrUnreachable) {
+		t.Error("Expected transport failures to be temporary")
+	}
+}
+
+func TestSubmitRetry(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.URL.Path != "/v1/submit" || r.Header.Get("X-API-Key") != "register-key" {
+			t.Errorf("Unexpected request to %s with API key %q", r.URL.Path, r.Header.Get("X-API-Key"))
+		}
+		if attempts == 1 {
+			// Stored, but the answer is lost
+			writeJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "Receipt storage temporarily unavailable", Code: CodeUnavailable})
+			return
+		}
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: "Receipt ID already exists", Code: CodeDuplicateReceipt})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, nil)
+	client.SetAPIKey("register-key")
+	if _, err := client.Submit(context.Background(), SubmitRequest{ReceiptID: "r-1"}); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Expected ErrUnavailable without retries, got %v", err)
+	}
+
+	attempts = 0
+	client.SetRetry(RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond})
+	resp, err := client.Submit(context.Background(), SubmitRequest{ReceiptID: "r-1"})
+	if err != nil || resp.ReceiptID != "r-1" {
+		t.Fatalf("Expected the duplicate on retry to count as stored, got %+v, %v", resp, err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+
+	// A duplicate on the first attempt is a refusal
+	attempts = 1
+	if _, err := client.Submit(context.Background(), SubmitRequest{ReceiptID: "r-1"}); !errors.Is(err, ErrDuplicateReceipt) {
+		t.Errorf("Expected ErrDuplicateReceipt, got %v", err)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	compressed, _ := rwcrypto.CompressKey(&privateKey.PublicKey)
+	ephemeralKey := base64.StdEncoding.EncodeToString(compressed)
+	nonce := make([]byte, rwcrypto.PossessionNonceSize)
+	submitted := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/challenge"):
+			writeJSON(w, http.StatusOK, ChallengeResponse{Nonce: base64.StdEncoding.EncodeToString(nonce), ExpiresIn: 60})
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/collect/"+ephemeralKey:
+			signature, _ := base64.StdEncoding.DecodeString(r.Header.Get(PossessionSignatureHeader))
+			if err := rwcrypto.VerifyPossession(compressed, nonce, signature); err != nil {
+				writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "invalid proof", Code: CodeForbidden})
+				return
+			}
+			if !submitted {
+				writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "No receipt found for given ephemeral key", Code: CodeNotFound})
+				return
+			}
+			w.Header().Set("ETag", `"abc"`)
+			writeJSON(w, http.StatusOK, CollectResponse{ReceiptID: "r-1", EncryptedData: base64.StdEncoding.EncodeToString([]byte("envelope"))})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, nil)
+	if _, err := client.Collect(context.Background(), ephemeralKey, privateKey); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound before submission, got %v", err)
+	}
+
+	submitted = true
+	collected, err := client.Collect(context.Background(), ephemeralKey, privateKey)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if collected.ReceiptID != "r-1" || string(collected.EncryptedData) != "envelope" || collected.ETag != `"abc"` {
+		t.Errorf("Unexpected collection %+v", collected)
+	}
+
+	if _, err := client.Collect(context.Background(), ephemeralKey, nil); err == nil {
+		t.Error("Expected a collection without proof to be refused")
+	}
+}
+
+func TestMeta(t *testing.T) {
+	submittedAt := time.Date(2025, 3, 29, 13, 21, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/v1/collect/AqF3%2Fx/meta":
+			writeJSON(w, http.StatusOK, ReceiptMeta{Exists: true, Size: 412, SubmittedAt: &submittedAt})
+		case "/v1/collect/AqF3%2Fy/meta":
+			writeJSON(w, http.StatusOK, ReceiptMeta{})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, nil)
+	meta, err := client.Meta(context.Background(), "AqF3/x", nil)
+	if err != nil {
+		t.Fatalf("Meta failed: %v", err)
+	}
+	if !meta.Exists || meta.Size != 412 || !meta.SubmittedAt.Equal(submittedAt) {
+		t.Errorf("Unexpected metadata %+v", meta)
+	}
+
+	meta, err = client.Meta(context.Background(), "AqF3/y", nil)
+	if err != nil || meta.Exists {
+		t.Errorf("Expected no receipt waiting, got %+v, %v", meta, err)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status == http.StatusOK {
+			writeJSON(w, status, Health{Status: "healthy", ReceiptsStored: 3})
+			return
+		}
+		writeJSON(w, status, Health{Status: "unhealthy", Error: "redis: connection refused"})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, nil)
+	health, err := client.Health(context.Background())
+	if err != nil || health.Status != "healthy" || health.ReceiptsStored != 3 {
+		t.Errorf("Unexpected health %+v, %v", health, err)
+	}
+
+	status = http.StatusServiceUnavailable
+	health, err = client.Health(context.Background())
+	var bankErr *Error
+	if !errors.As(err, &bankErr) || health == nil || health.Error != "redis: connection refused" {
+		t.Errorf("Expected the unhealthy report with an error, got %+v, %v", health, err)
+	}
+
+	server.Close()
+	if _, err := client.Health(context.Background()); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Expected ErrUnreachable, got %v", err)
+	}
+}
+
+func TestSubmitBatchDuplicates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, SubmitBatchResponse{
+			Results: []SubmitBatchResult{
+				{ReceiptID: "r-1", Status: http.StatusOK},
+				{ReceiptID: "r-2", Status: http.StatusConflict, Error: "Receipt ID already exists", Code: CodeDuplicateReceipt},
+				{ReceiptID: "r-3", Status: http.StatusTooManyRequests, Error: "Rate limit exceeded", Code: CodeRateLimited},
+			},
+			Summary: SubmitBatchSummary{Total: 3, Stored: 1, Duplicate: 1, Failed: 1},
+		})
+	}))
+	defer server.Close()
+
+	// r-2 was stored by an earlier submission whose answer was lost; this is the batch's first attempt
+	results, summary, err := NewClient(server.URL, nil).SubmitBatch(context.Background(),
+		[]SubmitRequest{{ReceiptID: "r-1"}, {ReceiptID: "r-2"}, {ReceiptID: "r-3"}})
+	if err != nil || summary.Duplicate != 1 {
+		t.Fatalf("SubmitBatch: %+v, %v", summary, err)
+	}
+	if results[0].Err != nil || results[0].Duplicate {
+		t.Errorf("r-1: got %+v, want stored", results[0])
+	}
+	if results[1].Err != nil || !results[1].Duplicate {
+		t.Errorf("r-2: got %+v, want held by the bank as a duplicate", results[1])
+	}
+	if !errors.Is(results[2].Err, ErrRateLimited) || !Temporary(results[2].Err) {
+		t.Errorf("r-3: got %v, want a temporary ErrRateLimited", results[2].Err)
+	}
+}
@@ -0,0 +1,112 @@
+package receiptbank
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Error codes of ErrorResponse.Code. Branch on these (or the sentinels they unwrap to)
+// rather than on the message text.
+const (
+	CodeInvalidRequest     = "INVALID_REQUEST"
+	CodeInvalidKey         = "INVALID_KEY"
+	CodeInvalidAttestation = "INVALID_ATTESTATION"
+	CodeUnsupportedFormat  = "UNSUPPORTED_FORMAT"
+	CodeDuplicateReceipt   = "DUPLICATE_RECEIPT"
+	CodePayloadTooLarge    = "PAYLOAD_TOO_LARGE"
+	CodeNotFound           = "NOT_FOUND"
+	CodeUnauthorized       = "UNAUTHORIZED"
+	CodeForbidden          = "FORBIDDEN"
+	CodeRateLimited        = "RATE_LIMITED"
+	CodeStorageFull        = "STORAGE_FULL"
+	CodeUnavailable        = "UNAVAILABLE"
+	CodeWebhookUnverified  = "WEBHOOK_UNVERIFIED"
+)
+
+var (
+	// ErrUnreachable is wrapped by transport failures: the request may not have
+	// reached the bank, or its answer was lost
+	ErrUnreachable = errors.New("receipt bank unreachable")
+
+	// ErrInvalidResponse is wrapped when a successful response can't be decoded
+	ErrInvalidResponse = errors.New("invalid receipt bank response")
+)
+
+// Refusals, matched with errors.Is against an *Error
+var (
+	ErrInvalidKey       = errors.New("receipt bank refused the ephemeral key")
+	ErrDuplicateReceipt = errors.New("receipt ID already stored at the receipt bank")
+	ErrNotFound         = errors.New("no receipt found for given ephemeral key")
+	ErrRateLimited      = errors.New("receipt bank rate limit exceeded")
+	ErrStorageFull      = errors.New("receipt bank storage is full")
+	ErrUnavailable      = errors.New("receipt bank storage is unavailable")
+	// ErrWebhookUnverified is returned when the bank's challenge to the webhook URL
+	// went unanswered, so it won't take receipts that would notify it
+	ErrWebhookUnverified = errors.New("receipt bank could not verify the webhook URL")
+)
+
+// Error is an error response from the bank. It unwraps to the sentinel matching its
+// code; banks that predate codes, and proxies in front of the bank, answer a bare 404,
+// 409 or 429, which unwrap to ErrNotFound, ErrDuplicateReceipt and ErrRateLimited.
+type Error struct {
+	Status     int
+	Code       string // Empty from banks that predate error codes
+	Message    string
+	RetryAfter time.Duration // Retry-After header, 0 when absent
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("receipt bank error (%d): %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("receipt bank error (%d %s): %s", e.Status, e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	switch e.Code {
+	case CodeInvalidKey:
+		return ErrInvalidKey
+	case CodeDuplicateReceipt:
+		return ErrDuplicateReceipt
+	case CodeNotFound:
+		return ErrNotFound
+	case CodeRateLimited:
+		return ErrRateLimited
+	case CodeStorageFull:
+		return ErrStorageFull
+	case CodeUnavailable:
+		return ErrUnavailable
+	case CodeWebhookUnverified:
+		return ErrWebhookUnverified
+	case "":
+		switch e.Status {
+		case http.StatusNotFound:
+			return ErrNotFound
+		case http.StatusConflict:
+			return ErrDuplicateReceipt
+		case http.StatusTooManyRequests:
+			return ErrRateLimited
+		}
+	}
+	return nil
+}
+
+// Temporary reports whether err may clear up on retry: transport failures, rate
+// limiting (429 with or without a code), a full or unavailable store, and other 5xx
+// responses. Other refusals are final.
+func Temporary(err error) bool {
+	if errors.Is(err, ErrUnreachable) {
+		return true
+	}
+	var bankErr *Error
+	if !errors.As(err, &bankErr) {
+		return false
+	}
+	switch bankErr.Code {
+	case CodeRateLimited, CodeStorageFull, CodeUnavailable:
+		return true
+	}
+	return bankErr.Status == http.StatusTooManyRequests || bankErr.Status >= http.StatusInternalServerError
+}
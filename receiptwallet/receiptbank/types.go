@@ -0,0 +1,101 @@
+package receiptbank
+
+import "time"
+
+// SubmitRequest is a receipt for POST /v1/submit: the wallet's compressed ephemeral
+// key and the encrypted receipt, both base64
+type SubmitRequest struct {
+	EphemeralKey  string `json:"ephemeral_key"`
+	EncryptedData string `json:"encrypted_data"`
+	ReceiptID     string `json:"receipt_id"`
+	WebhookURL    string `json:"webhook_url"`
+	// Attested submissions: SHA-256 of the binary receipt and the authority signature over it
+	ReceiptHash        string `json:"receipt_hash,omitempty"`
+	AuthoritySignature string `json:"authority_signature,omitempty"`
+	// Seconds until the receipt expires if uncollected (0 = the bank's max_receipt_age)
+	TTL int64 `json:"ttl,omitempty"`
+	// Binary receipt format version inside the encrypted data, checked by the bank
+	ReceiptFormat int `json:"receipt_format,omitempty"`
+}
+
+// SubmitResponse answers POST /v1/submit
+type SubmitResponse struct {
+	ReceiptID string `json:"receipt_id"`
+}
+
+// MaxBatchSize is the most receipts the bank takes in one /v1/submit/batch request
+const MaxBatchSize = 100
+
+// SubmitBatchRequest is the body of POST /v1/submit/batch
+type SubmitBatchRequest struct {
+	Receipts []SubmitRequest `json:"receipts"`
+}
+
+// SubmitBatchResult is the outcome of one batch entry, with the status /submit would have answered
+type SubmitBatchResult struct {
+	ReceiptID string `json:"receipt_id"`
+	Status    int    `json:"status"`
+	Error     string `json:"error,omitempty"`
+	Code      string `json:"code,omitempty"`
+}
+
+// SubmitBatchSummary counts the entries of a batch by outcome
+type SubmitBatchSummary struct {
+	Total     int `json:"total"`
+	Stored    int `json:"stored"`
+	Duplicate int `json:"duplicate"`
+	Failed    int `json:"failed"`
+}
+
+// SubmitBatchResponse lists one result per submitted receipt, in request order
+type SubmitBatchResponse struct {
+	Results []SubmitBatchResult `json:"results"`
+	Summary SubmitBatchSummary  `json:"summary"`
+}
+
+// CollectResponse answers GET /v1/collect/{ephemeral_key}
+type CollectResponse struct {
+	EncryptedData string `json:"encrypted_data"` // Base64 envelope
+	ReceiptID     string `json:"receipt_id"`
+}
+
+// ReceiptMeta answers GET /v1/collect/{ephemeral_key}/meta without collecting the receipt
+type ReceiptMeta struct {
+	Exists      bool       `json:"exists"`
+	Size        int        `json:"size_bytes,omitempty"` // Encrypted envelope
+	SubmittedAt *time.Time `json:"submitted_at,omitempty"`
+	Collected   bool       `json:"collected,omitempty"` // Collected before, within the bank's grace period
+}
+
+// ChallengeResponse answers POST /v1/collect/{ephemeral_key}/challenge
+type ChallengeResponse struct {
+	Nonce     string `json:"nonce"`      // Base64, 32 bytes, valid for one collection attempt
+	ExpiresIn int64  `json:"expires_in"` // Seconds
+}
+
+// VersionResponse is the bank's GET /version handshake
+type VersionResponse struct {
+	APIVersion           string   `json:"api_version"`
+	SupportedAPIVersions []string `json:"supported_api_versions"`
+	ReceiptFormats       []int    `json:"receipt_formats"` // Binary receipt versions its wallets can decode
+	Codecs               []string `json:"codecs,omitempty"`
+	Stream               string   `json:"stream,omitempty"`
+	ProofOfPossession    string   `json:"proof_of_possession,omitempty"` // "optional" or "required" on /collect
+}
+
+// Health is the summary of GET /health
+type Health struct {
+	Status          string `json:"status"` // "healthy" or "unhealthy"
+	Error           string `json:"error,omitempty"`
+	UptimeSeconds   int64  `json:"uptime_seconds"`
+	Timestamp       string `json:"timestamp"`
+	ReceiptsStored  int    `json:"receipts_stored"`
+	ReceiptsExpired int    `json:"receipts_expired"`
+	ReceiptsInGrace int    `json:"receipts_in_grace"`
+}
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"` // One of the Code constants
+}
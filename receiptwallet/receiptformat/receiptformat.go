@@ -0,0 +1,583 @@
+// Package receiptformat parses the binary receipts issued by the cash register
+// (BINARY_RECEIPT_FORMAT.md in fake_cash_register), v1 and v2, compressed or not,
+// with every extension. The wallet and the revenue authority parse with it, and
+// third parties should too, so a receipt is read the same way everywhere.
+//
+// Amounts are kuruş integers. Parse is strict; Options relax or tighten it.
+package receiptformat
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	rwcrypto "receiptwallet/crypto"
+)
+
+// Binary receipt values (see the cash register's BINARY_RECEIPT_FORMAT.md)
+const (
+	MagicBytes     = 0x5452
+	FormatVersion1 = 0x01 // uint16 quantities, uint32 kuruş amounts
+	FormatVersion2 = 0x02 // uint32 quantities, uint64 kuruş amounts
+
+	FlagTimestampToken = 0x01
+	FlagCurrency       = 0x02
+	FlagCompressed     = 0x04 // Body after the header is a zlib stream
+	FlagWeighedItems   = 0x08 // Every item ends with a unit byte (v2 only)
+	FlagItemNotes      = 0x10 // Every item ends with a uint8 length-prefixed note (v2 only)
+	FlagCustomer       = 0x20 // Receipt ends with the customer's tax number and name
+	FlagRefund         = 0x40 // Receipt refunds an earlier sale, named after the customer extension
+	FlagExtensions     = 0x80 // Receipt ends with tagged extensions; the last flag bit, so later extensions are tags
+	KnownFlags         = FlagTimestampToken | FlagCurrency | FlagCompressed | FlagWeighedItems | FlagItemNotes | FlagCustomer | FlagRefund | FlagExtensions
+
+	// Tags of the extensions after FlagExtensions, each a uint8 tag, a uint32 length and its data
+	ExtensionSurcharges = 0x01 // Surcharge lines: payment method fees with their own tax rate
+	ExtensionDeviceKey  = 0x02 // Register device key; a device signature follows the authority signature
+
+	UnitPieces = 0x00
+	UnitGrams  = 0x01 // Quantity is grams, the unit price is per kilogram
+
+	HeaderSize           = 4
+	ItemSize             = 13 // v1; v2 items are 23 bytes
+	TaxBreakdownSize     = 20 // v1; v2 is 40 bytes
+	SignatureSize        = 64
+	DeviceKeySize        = 33 // Compressed P-256 key
+	TimestampTokenSize   = 73
+	MaxStringFieldLength = 1024
+	ExchangeRateScale    = 1_000_000
+	MaxAmountV2          = 1 << 53 // Largest v2 amount; keeps totals exact in float64 consumers
+	MaxDecompressedSize  = 2 << 20 // Largest body a compressed receipt may inflate to; larger v2 bodies (up to about 18 MB) are stored uncompressed
+)
+
+var (
+	// ErrMalformed is wrapped by every error for data that is not a valid binary receipt
+	ErrMalformed = errors.New("malformed receipt")
+	// ErrUnsupported is wrapped by every error for a valid receipt this parser won't read
+	ErrUnsupported = errors.New("unsupported receipt")
+
+	// ErrBadMagic is returned for data that doesn't start with MagicBytes
+	ErrBadMagic = fmt.Errorf("%w: bad magic bytes", ErrMalformed)
+	// ErrTruncated is returned when a field runs past the end of the data
+	ErrTruncated = fmt.Errorf("%w: truncated", ErrMalformed)
+	// ErrUnsupportedVersion is returned for an unknown version or one Options.Versions leaves out
+	ErrUnsupportedVersion = fmt.Errorf("%w: version", ErrUnsupported)
+	// ErrUnknownFlags is returned in strict mode for header flags outside KnownFlags
+	ErrUnknownFlags = fmt.Errorf("%w: header flags", ErrUnsupported)
+	// ErrUnknownExtension is returned in strict mode for extension tags this package doesn't know
+	ErrUnknownExtension = fmt.Errorf("%w: extension", ErrUnsupported)
+	// ErrTooManyItems is returned for more items than Options.MaxItems
+	ErrTooManyItems = fmt.Errorf("%w: too many items", ErrUnsupported)
+)
+
+// Options configures Parse. The zero value is strict, with no item limit and every known version.
+type Options struct {
+	// Lenient reads receipts from newer registers: header flags outside KnownFlags and
+	// unknown extension tags are accepted, and whatever follows the known extensions is
+	// ignored. Everything this package knows is still checked.
+	Lenient bool
+	// MaxItems rejects receipts with more items (0 = as many as the data holds)
+	MaxItems int
+	// Versions lists the format versions accepted (nil = FormatVersion1 and FormatVersion2)
+	Versions []uint8
+}
+
+// acceptsVersion reports whether version may be parsed
+func (o Options) acceptsVersion(version uint8) bool {
+	if version != FormatVersion1 && version != FormatVersion2 {
+		return false
+	}
+	if o.Versions == nil {
+		return true
+	}
+	for _, v := range o.Versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Receipt is a decoded binary receipt. Amounts are in kuruş so totals add up exactly.
+type Receipt struct {
+	Version       uint8
+	Flags         uint8
+	Timestamp     time.Time
+	ZReport       uint32
+	Transaction   uint32
+	StoreVKN      string
+	StoreName     string
+	StoreAddress  string
+	Total         int64
+	PaymentMethod string
+	Serial        string
+	Items         []Item
+	Tax           TaxBreakdown
+	// Foreign currency extension, set when FlagCurrency is present
+	Currency     string
+	ExchangeRate float64 // Base currency units per foreign unit
+	ForeignTotal uint64  // In the currency's minor unit
+	// Business customer of an invoiced sale, set when FlagCustomer is present
+	CustomerTaxNumber string // VKN (10 digits) or TCKN (11 digits)
+	CustomerName      string
+	// Sale this receipt pays back, set when FlagRefund is present
+	RefundOf *Original
+	// Fees added for the payment method, from the ExtensionSurcharges extension. They
+	// count towards Total and Tax like items.
+	Surcharges []Surcharge
+	// Compressed public key of the register device that co-signed the receipt, from the
+	// ExtensionDeviceKey extension
+	DeviceKey []byte
+}
+
+// Surcharge is a fee line, e.g. a card scheme's 2% or a delivery fee
+type Surcharge struct {
+	Name    string
+	Amount  int64 // Tax-inclusive, like an item's TotalPrice
+	TaxRate int   // Percent
+}
+
+// Original identifies the sale a refund pays back
+type Original struct {
+	Timestamp   time.Time
+	Transaction uint32
+	Serial      string
+}
+
+// TransactionID formats the original sale's transaction number as the cash register does
+func (o *Original) TransactionID() string {
+	return fmt.Sprintf("TX%s%04d", o.Timestamp.Format("20060102"), o.Transaction)
+}
+
+// Refund reports whether the receipt pays money back rather than recording a sale
+func (r *Receipt) Refund() bool {
+	return r.RefundOf != nil
+}
+
+// TransactionID formats the transaction number as the cash register does
+func (r *Receipt) TransactionID() string {
+	return fmt.Sprintf("TX%s%04d", r.Timestamp.Format("20060102"), r.Transaction)
+}
+
+// Item is one receipt line
+type Item struct {
+	KisimID    int
+	Quantity   int // Grams when Weighed
+	UnitPrice  int64
+	TotalPrice int64
+	TaxRate    int    // Percent
+	Weighed    bool   // Sold by weight, priced per kilogram
+	Note       string // Free text printed under the line
+}
+
+// TaxBreakdown holds the taxable base and tax per rate
+type TaxBreakdown struct {
+	Taxable10 int64
+	Tax10     int64
+	Taxable20 int64
+	Tax20     int64
+	TotalTax  int64
+}
+
+// Signed is a signed receipt split into its parts
+type Signed struct {
+	Receipt        *Receipt
+	Bytes          []byte // The signed binary receipt
+	Signature      []byte // 64-byte r || s
+	TimestampToken []byte // Present only when FlagTimestampToken is set
+	// The register device's 64-byte r || s over the same hash as Signature, present only
+	// when the receipt carries a DeviceKey
+	DeviceSignature []byte
+}
+
+// ParseSigned splits a signed receipt (binary receipt || signature [|| device signature]
+// [|| timestamp token]) and decodes the receipt part strictly
+func ParseSigned(data []byte) (*Signed, error) {
+	return Options{}.ParseSigned(data)
+}
+
+// ParseSigned splits a signed receipt and decodes the receipt part with these options.
+//
+// The header flags declare the timestamp token, but the device signature is declared by
+// the device key extension inside the receipt. Receipts with tagged extensions are first
+// split as if device signed; that split is kept when its receipt part parses and carries
+// a device key, otherwise the receipt part must parse without one.
+func (o Options) ParseSigned(data []byte) (*Signed, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("%w: signed receipt too short", ErrTruncated)
+	}
+
+	trailer := SignatureSize
+	if data[3]&FlagTimestampToken != 0 {
+		trailer += TimestampTokenSize
+	}
+	if len(data) < HeaderSize+trailer {
+		return nil, fmt.Errorf("%w: signed receipt too short", ErrTruncated)
+	}
+
+	if data[3]&FlagExtensions != 0 && len(data) >= HeaderSize+trailer+SignatureSize {
+		if signed, err := o.split(data, trailer, true); err == nil {
+			return signed, nil
+		}
+	}
+	return o.split(data, trailer, false)
+}
+
+// split cuts trailer bytes of signature and timestamp token, and a device signature
+// between them when deviceSigned, off data. The receipt must carry a device key exactly
+// when deviceSigned.
+func (o Options) split(data []byte, trailer int, deviceSigned bool) (*Signed, error) {
+	if deviceSigned {
+		trailer += SignatureSize
+	}
+	end := len(data) - trailer
+	receipt, err := o.Parse(data[:end])
+	if err != nil {
+		return nil, err
+	}
+	if receipt.DeviceKey != nil && !deviceSigned {
+		return nil, fmt.Errorf("%w: device key without device signature", ErrMalformed)
+	}
+	if receipt.DeviceKey == nil && deviceSigned {
+		return nil, fmt.Errorf("%w: device signature without device key", ErrMalformed)
+	}
+
+	signed := &Signed{
+		Receipt: receipt,
+		Bytes:   data[:end:end],
+	}
+	rest := data[end:]
+	signed.Signature, rest = rest[:SignatureSize:SignatureSize], rest[SignatureSize:]
+	if deviceSigned {
+		signed.DeviceSignature, rest = rest[:SignatureSize:SignatureSize], rest[SignatureSize:]
+	}
+	if data[3]&FlagTimestampToken != 0 {
+		signed.TimestampToken = rest
+	}
+	return signed, nil
+}
+
+// Parse decodes a binary receipt v1 or v2, compressed or not, strictly. Length prefixes are checked against
+// the remaining input before anything is allocated, so hostile input only produces an error.
+func Parse(data []byte) (*Receipt, error) {
+	return Options{}.Parse(data)
+}
+
+// Parse decodes a binary receipt with these options
+func (o Options) Parse(data []byte) (*Receipt, error) {
+	r := &reader{r: bytes.NewReader(data)}
+
+	magic := r.uint16()
+	receipt := &Receipt{Version: r.uint8(), Flags: r.uint8()}
+	if r.err != nil {
+		return nil, fmt.Errorf("%w header", ErrTruncated)
+	}
+	if magic != MagicBytes {
+		return nil, ErrBadMagic
+	}
+	if !o.acceptsVersion(receipt.Version) {
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedVersion, receipt.Version)
+	}
+	if receipt.Version == FormatVersion1 {
+		r.quantitySize, r.amountSize = 2, 4
+	} else {
+		r.quantitySize, r.amountSize = 4, 8
+	}
+	if receipt.Flags&^KnownFlags != 0 && !o.Lenient {
+		return nil, fmt.Errorf("%w 0x%02x", ErrUnknownFlags, receipt.Flags&^KnownFlags)
+	}
+	unitSize := 0
+	if receipt.Flags&FlagWeighedItems != 0 {
+		if receipt.Version == FormatVersion1 {
+			return nil, fmt.Errorf("%w: weighed items in a v1 receipt", ErrMalformed)
+		}
+		unitSize = 1
+	}
+	noteSize := 0
+	if receipt.Flags&FlagItemNotes != 0 {
+		if receipt.Version == FormatVersion1 {
+			return nil, fmt.Errorf("%w: item notes in a v1 receipt", ErrMalformed)
+		}
+		noteSize = 1
+	}
+	if receipt.Flags&FlagCompressed != 0 {
+		body, err := Inflate(data[HeaderSize:])
+		if err != nil {
+			return nil, err
+		}
+		r.r = bytes.NewReader(body)
+	}
+
+	receipt.Timestamp = time.Unix(int64(r.uint64()), 0)
+	receipt.ZReport = r.uint32()
+	receipt.Transaction = r.uint32()
+	receipt.StoreVKN = fmt.Sprintf("%010d", r.uint32())
+	receipt.StoreName = r.string()
+	receipt.StoreAddress = r.string()
+	receipt.Total = r.amount()
+	receipt.PaymentMethod = r.string()
+	receipt.Serial = fmt.Sprintf("F%04d", r.uint32())
+
+	itemCount := int(r.uint16())
+	if r.err == nil && o.MaxItems > 0 && itemCount > o.MaxItems {
+		return nil, fmt.Errorf("%w: %d (max %d)", ErrTooManyItems, itemCount, o.MaxItems)
+	}
+	itemSize := 2 + r.quantitySize + 2*r.amountSize + 1 + unitSize + noteSize // Without note text
+	if r.err == nil && itemCount*itemSize+5*r.amountSize > r.r.Len() {
+		r.err = fmt.Errorf("%w: item count %d exceeds remaining data", ErrTruncated, itemCount)
+	}
+	if r.err == nil {
+		receipt.Items = make([]Item, itemCount)
+		for i := range receipt.Items {
+			receipt.Items[i] = Item{
+				KisimID:    int(r.uint16()),
+				Quantity:   int(r.uint(r.quantitySize)),
+				UnitPrice:  r.amount(),
+				TotalPrice: r.amount(),
+				TaxRate:    int(r.uint8()),
+			}
+			if unitSize > 0 {
+				switch unit := r.uint8(); unit {
+				case UnitPieces:
+				case UnitGrams:
+					receipt.Items[i].Weighed = true
+				default:
+					if r.err == nil {
+						r.err = fmt.Errorf("%w: item unit %d", ErrMalformed, unit)
+					}
+				}
+			}
+			if noteSize > 0 {
+				note := r.read(int(r.uint8()))
+				if r.err == nil && !utf8.Valid(note) {
+					r.err = fmt.Errorf("%w: invalid UTF-8", ErrMalformed)
+				}
+				receipt.Items[i].Note = string(note)
+			}
+		}
+	}
+
+	receipt.Tax = TaxBreakdown{
+		Taxable10: r.amount(),
+		Tax10:     r.amount(),
+		Taxable20: r.amount(),
+		Tax20:     r.amount(),
+		TotalTax:  r.amount(),
+	}
+
+	if receipt.Flags&FlagCurrency != 0 {
+		receipt.Currency = string(r.read(3))
+		receipt.ExchangeRate = float64(r.uint64()) / ExchangeRateScale
+		receipt.ForeignTotal = r.uint(r.amountSize)
+	}
+	if receipt.Flags&FlagCustomer != 0 {
+		receipt.CustomerTaxNumber = r.string()
+		receipt.CustomerName = r.string()
+		if r.err == nil && (!isTaxNumber(receipt.CustomerTaxNumber) || receipt.CustomerName == "") {
+			r.err = fmt.Errorf("%w: invalid customer", ErrMalformed)
+		}
+	}
+	if receipt.Flags&FlagRefund != 0 {
+		receipt.RefundOf = &Original{
+			Timestamp:   time.Unix(int64(r.uint64()), 0),
+			Transaction: r.uint32(),
+			Serial:      fmt.Sprintf("F%04d", r.uint32()),
+		}
+	}
+
+	if receipt.Flags&FlagExtensions != 0 {
+		r.extensions(receipt, o.Lenient)
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.r.Len() != 0 && !o.Lenient {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrMalformed, r.r.Len())
+	}
+	return receipt, nil
+}
+
+// extensions reads the tagged extensions that run to the end of the body: at least one,
+// in ascending tag order. Unknown tags are skipped when lenient.
+func (rr *reader) extensions(receipt *Receipt, lenient bool) {
+	last := -1
+	for rr.err == nil && (last < 0 || rr.r.Len() > 0) {
+		tag := int(rr.uint8())
+		data := rr.read(int(rr.uint32()))
+		if rr.err != nil {
+			return
+		}
+		if tag <= last {
+			rr.err = fmt.Errorf("%w: extension 0x%02x out of order", ErrMalformed, tag)
+			return
+		}
+		last = tag
+
+		ext := &reader{r: bytes.NewReader(data), quantitySize: rr.quantitySize, amountSize: rr.amountSize}
+		switch tag {
+		case ExtensionSurcharges:
+			ext.surcharges(receipt)
+		case ExtensionDeviceKey:
+			receipt.DeviceKey = bytes.Clone(ext.read(DeviceKeySize))
+			if _, err := rwcrypto.DecompressKey(receipt.DeviceKey); ext.err == nil && err != nil {
+				ext.err = fmt.Errorf("%w: device key: %v", ErrMalformed, err)
+			}
+		default:
+			if !lenient {
+				rr.err = fmt.Errorf("%w 0x%02x", ErrUnknownExtension, tag)
+			}
+			continue
+		}
+		if ext.err == nil && ext.r.Len() != 0 {
+			ext.err = fmt.Errorf("%w: %d trailing bytes in extension 0x%02x", ErrMalformed, ext.r.Len(), tag)
+		}
+		if ext.err != nil {
+			rr.err = ext.err
+		}
+	}
+}
+
+// surcharges reads the ExtensionSurcharges data: a uint8 count of at least one, then
+// per line a name, a tax-inclusive amount and a tax rate
+func (rr *reader) surcharges(receipt *Receipt) {
+	count := int(rr.uint8())
+	if rr.err == nil && count == 0 {
+		rr.err = fmt.Errorf("%w: surcharge extension without surcharges", ErrMalformed)
+	}
+	for i := 0; i < count && rr.err == nil; i++ {
+		surcharge := Surcharge{Name: rr.string(), Amount: rr.amount(), TaxRate: int(rr.uint8())}
+		if rr.err == nil && surcharge.Name == "" {
+			rr.err = fmt.Errorf("%w: unnamed surcharge", ErrMalformed)
+		}
+		receipt.Surcharges = append(receipt.Surcharges, surcharge)
+	}
+}
+
+// isTaxNumber reports whether s has the shape of a VKN or TCKN. The register checks
+// the check digits; the signature covers the rest.
+func isTaxNumber(s string) bool {
+	if len(s) != 10 && len(s) != 11 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Inflate decompresses the zlib stream of a compressed receipt body, which must fill
+// the rest of the receipt and stay within MaxDecompressedSize
+func Inflate(stream []byte) ([]byte, error) {
+	r := bytes.NewReader(stream)
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid compressed body: %v", ErrMalformed, err)
+	}
+	defer zr.Close()
+
+	body, err := io.ReadAll(io.LimitReader(zr, MaxDecompressedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid compressed body: %v", ErrMalformed, err)
+	}
+	if len(body) > MaxDecompressedSize {
+		return nil, fmt.Errorf("%w: compressed body inflates beyond %d bytes", ErrMalformed, MaxDecompressedSize)
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%w: %d bytes after the compressed body", ErrMalformed, r.Len())
+	}
+	return body, nil
+}
+
+// reader reads big-endian fields and keeps the first error
+type reader struct {
+	r   *bytes.Reader
+	err error
+	// Field widths of the receipt's format version
+	quantitySize int
+	amountSize   int
+}
+
+func (rr *reader) read(n int) []byte {
+	if rr.err != nil {
+		return nil
+	}
+	if n > rr.r.Len() {
+		rr.err = ErrTruncated
+		return nil
+	}
+	buf := make([]byte, n)
+	io.ReadFull(rr.r, buf)
+	return buf
+}
+
+func (rr *reader) uint8() uint8 {
+	if b := rr.read(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (rr *reader) uint16() uint16 {
+	if b := rr.read(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (rr *reader) uint32() uint32 {
+	if b := rr.read(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (rr *reader) uint64() uint64 {
+	if b := rr.read(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// uint reads an unsigned integer of size bytes (2, 4 or 8)
+func (rr *reader) uint(size int) uint64 {
+	switch size {
+	case 2:
+		return uint64(rr.uint16())
+	case 4:
+		return uint64(rr.uint32())
+	default:
+		return rr.uint64()
+	}
+}
+
+// amount reads a kuruş amount in the version's width
+func (rr *reader) amount() int64 {
+	kurus := rr.uint(rr.amountSize)
+	if rr.err == nil && kurus > MaxAmountV2 {
+		rr.err = fmt.Errorf("%w: amount %d kuruş out of range", ErrMalformed, kurus)
+	}
+	return int64(kurus)
+}
+
+func (rr *reader) string() string {
+	length := rr.uint32()
+	if rr.err != nil {
+		return ""
+	}
+	if length > MaxStringFieldLength {
+		rr.err = fmt.Errorf("%w: string field length %d exceeds maximum %d", ErrMalformed, length, MaxStringFieldLength)
+		return ""
+	}
+	b := rr.read(int(length))
+	if rr.err == nil && !utf8.Valid(b) {
+		rr.err = fmt.Errorf("%w: invalid UTF-8", ErrMalformed)
+	}
+	return string(b)
+}
@@ -0,0 +1,212 @@
+package receiptformat
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	rwcrypto "receiptwallet/crypto"
+)
+
+// build encodes a binary receipt v2 with flags and n items of 1 × 10.00 at 20%
+func build(t *testing.T, flags uint8, n int) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	write := func(v any) {
+		if err := binary.Write(buf, binary.BigEndian, v); err != nil {
+			t.Fatalf("Failed to encode receipt: %v", err)
+		}
+	}
+	writeString := func(s string) {
+		write(uint32(len(s)))
+		buf.WriteString(s)
+	}
+
+	total := uint64(n) * 1000
+	write(uint16(MagicBytes))
+	write(uint8(FormatVersion2))
+	write(flags)
+	write(uint64(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC).Unix()))
+	write(uint32(1)) // Z-report
+	write(uint32(7)) // Transaction
+	write(uint32(1234567890))
+	writeString("Test Market")
+	writeString("Test Sokak 1")
+	write(total)
+	writeString("Nakit")
+	write(uint32(42))
+	write(uint16(n))
+	for range n {
+		write(uint16(2))
+		write(uint32(1))
+		write(uint64(1000))
+		write(uint64(1000))
+		write(uint8(20))
+	}
+	tax := total / 6
+	for _, amount := range []uint64{0, 0, total - tax, tax, tax} {
+		write(amount)
+	}
+	return buf.Bytes()
+}
+
+// extension encodes a tagged extension for receipts with FlagExtensions
+func extension(tag uint8, data []byte) []byte {
+	ext := []byte{tag, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(ext[1:], uint32(len(data)))
+	return append(ext, data...)
+}
+
+func TestParseStrict(t *testing.T) {
+	data := build(t, 0, 3)
+	receipt, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Failed to parse receipt: %v", err)
+	}
+	if receipt.Serial != "F0042" || receipt.Total != 3000 || len(receipt.Items) != 3 || receipt.TransactionID() != "TX202610160007" {
+		t.Errorf("Unexpected receipt: %+v", receipt)
+	}
+
+	badMagic := append([]byte{}, data...)
+	badMagic[0] = 0
+	newer := append([]byte{}, data...)
+	newer[2] = 3
+	for name, tc := range map[string]struct {
+		data []byte
+		want error
+	}{
+		"bad magic":         {badMagic, ErrBadMagic},
+		"short header":      {data[:3], ErrTruncated},
+		"truncated":         {data[:len(data)-1], ErrTruncated},
+		"version 3":         {newer, ErrUnsupportedVersion},
+		"unknown extension": {append(build(t, FlagExtensions, 1), extension(0x7f, nil)...), ErrUnknownExtension},
+		"trailing data":     {append(append([]byte{}, data...), 0), ErrMalformed},
+	} {
+		if _, err := Parse(tc.data); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", name, tc.want, err)
+		}
+	}
+
+	// The specific errors still match the broad ones
+	if _, err := Parse(badMagic); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Expected ErrBadMagic to be ErrMalformed, got %v", err)
+	}
+	if _, err := Parse(newer); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupportedVersion to be ErrUnsupported, got %v", err)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	// A newer register's extension: a tag this package doesn't know
+	future := append(build(t, FlagExtensions, 2), extension(0x7f, []byte{0xde, 0xad})...)
+	lenient := Options{Lenient: true}
+	receipt, err := lenient.Parse(future)
+	if err != nil {
+		t.Fatalf("Expected the lenient parser to skip the unknown extension, got %v", err)
+	}
+	if receipt.Flags != FlagExtensions || len(receipt.Items) != 2 {
+		t.Errorf("Unexpected receipt: %+v", receipt)
+	}
+	if _, err := lenient.Parse(build(t, 0, 2)[:50]); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Expected the lenient parser to reject truncated data, got %v", err)
+	}
+
+	if _, err := (Options{MaxItems: 2}).Parse(build(t, 0, 3)); !errors.Is(err, ErrTooManyItems) {
+		t.Errorf("Expected ErrTooManyItems, got %v", err)
+	}
+	if _, err := (Options{MaxItems: 3}).Parse(build(t, 0, 3)); err != nil {
+		t.Errorf("Expected 3 items to be allowed, got %v", err)
+	}
+
+	v1Only := Options{Versions: []uint8{FormatVersion1}}
+	if _, err := v1Only.Parse(build(t, 0, 1)); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected ErrUnsupportedVersion for v2, got %v", err)
+	}
+
+	signed := append(build(t, 0, 1), make([]byte, SignatureSize)...)
+	if _, err := v1Only.ParseSigned(signed); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected ParseSigned to apply the options, got %v", err)
+	}
+	if s, err := ParseSigned(signed); err != nil || len(s.Signature) != SignatureSize {
+		t.Errorf("Failed to parse signed receipt: %v", err)
+	}
+}
+
+func TestParseSurcharges(t *testing.T) {
+	data := []byte{2}
+	for _, s := range []Surcharge{{"Kart komisyonu", 40, 20}, {"Teslimat", 1500, 20}} {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(s.Name)))
+		data = append(data, s.Name...)
+		data = binary.BigEndian.AppendUint64(data, uint64(s.Amount))
+		data = append(data, uint8(s.TaxRate))
+	}
+
+	receipt, err := Parse(append(build(t, FlagExtensions, 1), extension(ExtensionSurcharges, data)...))
+	if err != nil {
+		t.Fatalf("Failed to parse receipt with surcharges: %v", err)
+	}
+	if len(receipt.Surcharges) != 2 || receipt.Surcharges[1] != (Surcharge{"Teslimat", 1500, 20}) {
+		t.Errorf("Unexpected surcharges: %+v", receipt.Surcharges)
+	}
+
+	for name, tc := range map[string]struct {
+		data []byte
+		want error
+	}{
+		"no extensions":      {build(t, FlagExtensions, 1), ErrTruncated},
+		"no surcharges":      {append(build(t, FlagExtensions, 1), extension(ExtensionSurcharges, []byte{0})...), ErrMalformed},
+		"short extension":    {append(build(t, FlagExtensions, 1), extension(ExtensionSurcharges, data[:len(data)-1])...), ErrTruncated},
+		"extension trailing": {append(build(t, FlagExtensions, 1), extension(ExtensionSurcharges, append(data, 0))...), ErrMalformed},
+		"repeated tag": {append(append(build(t, FlagExtensions, 1), extension(ExtensionSurcharges, data)...),
+			extension(ExtensionSurcharges, data)...), ErrMalformed},
+	} {
+		if _, err := Parse(tc.data); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", name, tc.want, err)
+		}
+	}
+}
+
+func TestParseSignedDeviceKey(t *testing.T) {
+	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	deviceKey, _ := rwcrypto.CompressKey(&privateKey.PublicKey)
+	signature := bytes.Repeat([]byte{0xa1}, SignatureSize)
+	deviceSignature := bytes.Repeat([]byte{0xd5}, SignatureSize)
+	token := bytes.Repeat([]byte{0x70}, TimestampTokenSize)
+
+	receipt := append(build(t, FlagExtensions|FlagTimestampToken, 1), extension(ExtensionDeviceKey, deviceKey)...)
+	data := slices.Concat(receipt, signature, deviceSignature, token)
+	signed, err := ParseSigned(data)
+	if err != nil {
+		t.Fatalf("Failed to parse device signed receipt: %v", err)
+	}
+	if !bytes.Equal(signed.Receipt.DeviceKey, deviceKey) || !bytes.Equal(signed.Bytes, receipt) ||
+		!bytes.Equal(signed.Signature, signature) || !bytes.Equal(signed.DeviceSignature, deviceSignature) ||
+		!bytes.Equal(signed.TimestampToken, token) {
+		t.Errorf("Device signed receipt split wrongly: %+v", signed)
+	}
+
+	// Tagged extensions without a device key keep the one signature
+	plain := append(build(t, FlagExtensions, 1), extension(ExtensionSurcharges, []byte{1, 0, 0, 0, 1, 'X', 0, 0, 0, 0, 0, 0, 0, 1, 20})...)
+	signed, err = ParseSigned(slices.Concat(plain, signature))
+	if err != nil || signed.DeviceSignature != nil || !bytes.Equal(signed.Signature, signature) {
+		t.Errorf("Expected a plain signed receipt, got %+v, %v", signed, err)
+	}
+
+	receipt = append(build(t, FlagExtensions, 1), extension(ExtensionDeviceKey, deviceKey)...)
+	if _, err := ParseSigned(slices.Concat(receipt, signature)); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Expected a device key without device signature to be malformed, got %v", err)
+	}
+	uncompressed := bytes.Clone(deviceKey)
+	uncompressed[0] = 0x04
+	receipt = append(build(t, FlagExtensions, 1), extension(ExtensionDeviceKey, uncompressed)...)
+	if _, err := Parse(receipt); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Expected an invalid device key to be malformed, got %v", err)
+	}
+}
@@ -0,0 +1,327 @@
+// Package trustbundle reads and writes the revenue authority's trust bundle: its
+// receipt signing keys with the periods each signed in, and who the authority is,
+// signed by one of those keys. Wallets ship a bundle and verify receipts against it
+// without asking the authority for its key.
+//
+// A bundle's self-signature only shows it is intact and was made by a key it lists.
+// Where a bundle comes from decides whether it is trusted: shipped with the wallet,
+// or accepted through Bundle.VerifyUpdate from one already trusted.
+package trustbundle
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	rwcrypto "receiptwallet/crypto"
+)
+
+// Format identifies the bundle layout, and prefixes the signed digest so a bundle
+// signature can't be mistaken for a receipt or response signature
+const Format = "revenue-authority-trust-bundle-v1"
+
+// ContentType is served with a bundle by the revenue authority's /trust-bundle endpoint
+const ContentType = "application/json"
+
+var (
+	// ErrInvalidBundle is wrapped by every error for data that is not a valid, intact bundle
+	ErrInvalidBundle = errors.New("invalid trust bundle")
+	// ErrExpired is returned for a bundle past its expiry
+	ErrExpired = errors.New("trust bundle expired")
+	// ErrUntrustedUpdate is returned by VerifyUpdate for a bundle the current one doesn't vouch for
+	ErrUntrustedUpdate = errors.New("trust bundle update not signed by a trusted key")
+	// ErrNoKey is returned by Verify when no key valid at the signing time verifies the signature
+	ErrNoKey = errors.New("no trusted key verifies the signature")
+)
+
+// Authority describes the revenue authority that issued the bundle
+type Authority struct {
+	Name    string `json:"name"`
+	Country string `json:"country,omitempty"` // ISO 3166-1 alpha-2
+	URL     string `json:"url,omitempty"`
+}
+
+// Key is a receipt signing key and the period it signed in. A zero NotBefore or
+// NotAfter leaves that end of the period open.
+type Key struct {
+	ID        string // SHA-256 of the DER public key, hex, as /health reports it
+	PublicKey *ecdsa.PublicKey
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// ValidAt reports whether the key signed at t
+func (k Key) ValidAt(t time.Time) bool {
+	return (k.NotBefore.IsZero() || !t.Before(k.NotBefore)) && (k.NotAfter.IsZero() || !t.After(k.NotAfter))
+}
+
+// Bundle is a parsed and verified trust bundle
+type Bundle struct {
+	Authority Authority
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Keys      []Key
+	SignedBy  string // ID of the key that signed the bundle
+}
+
+// envelope is the bundle file: the contents exactly as signed, and the signature
+type envelope struct {
+	Format    string `json:"format"`
+	Payload   string `json:"payload"` // Base64 of the contents JSON
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature"` // Base64 64-byte r || s over Digest(payload)
+}
+
+type contents struct {
+	Format    string    `json:"format"`
+	Authority Authority `json:"authority"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Keys      []keyJSON `json:"keys"`
+}
+
+type keyJSON struct {
+	KeyID     string    `json:"key_id"`
+	PublicKey string    `json:"public_key"` // Base64 DER, as /public-key serves it
+	NotBefore time.Time `json:"not_before,omitzero"`
+	NotAfter  time.Time `json:"not_after,omitzero"`
+}
+
+// KeyID returns the ID of a public key: SHA-256 of its DER encoding, hex
+func KeyID(publicKey *ecdsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", rwcrypto.ErrInvalidKey, err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Digest is what a bundle's signature covers: SHA-256(Format || 0 || payload)
+func Digest(payload []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(Format))
+	h.Write([]byte{0})
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// Sign writes b as a bundle file signed by privateKey, which must be one of b's keys
+// and valid at b.IssuedAt. Key IDs are filled in from the keys; b.SignedBy is ignored.
+func Sign(b *Bundle, privateKey *ecdsa.PrivateKey) ([]byte, error) {
+	signerID, err := KeyID(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	c := contents{
+		Format:    Format,
+		Authority: b.Authority,
+		IssuedAt:  b.IssuedAt.UTC(),
+		ExpiresAt: b.ExpiresAt.UTC(),
+		Keys:      make([]keyJSON, len(b.Keys)),
+	}
+	signerListed := false
+	for i, k := range b.Keys {
+		der, err := x509.MarshalPKIXPublicKey(k.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w: %v", i+1, rwcrypto.ErrInvalidKey, err)
+		}
+		sum := sha256.Sum256(der)
+		id := hex.EncodeToString(sum[:])
+		c.Keys[i] = keyJSON{
+			KeyID:     id,
+			PublicKey: base64.StdEncoding.EncodeToString(der),
+			NotBefore: k.NotBefore.UTC(),
+			NotAfter:  k.NotAfter.UTC(),
+		}
+		if id == signerID {
+			signerListed = k.ValidAt(b.IssuedAt)
+		}
+	}
+	if !signerListed {
+		return nil, fmt.Errorf("signing key %s is not a bundle key valid at %s", signerID, c.IssuedAt.Format(time.RFC3339))
+	}
+	if _, err := c.bundle(signerID); err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := rwcrypto.Sign(privateKey, Digest(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(envelope{
+		Format:    Format,
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		KeyID:     signerID,
+		Signature: base64.StdEncoding.EncodeToString(signature),
+	}, "", "  ")
+}
+
+// Parse reads a bundle file and checks that it is intact, signed by one of its own
+// keys while that key was valid, and not expired at the given time
+func Parse(data []byte, at time.Time) (*Bundle, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	if env.Format != Format {
+		return nil, fmt.Errorf("%w: format %q, expected %q", ErrInvalidBundle, env.Format, Format)
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: payload: %v", ErrInvalidBundle, err)
+	}
+	var c contents
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, fmt.Errorf("%w: payload: %v", ErrInvalidBundle, err)
+	}
+	if c.Format != Format {
+		return nil, fmt.Errorf("%w: payload format %q, expected %q", ErrInvalidBundle, c.Format, Format)
+	}
+
+	b, err := c.bundle(env.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := b.Key(env.KeyID)
+	if !ok {
+		return nil, fmt.Errorf("%w: signed by key %s, which it does not list", ErrInvalidBundle, env.KeyID)
+	}
+	signature, err := base64.StdEncoding.DecodeString(env.Signature)
+	if err != nil || !rwcrypto.Verify(signer.PublicKey, Digest(payload), signature) {
+		return nil, fmt.Errorf("%w: signature does not verify", ErrInvalidBundle)
+	}
+	if !signer.ValidAt(b.IssuedAt) {
+		return nil, fmt.Errorf("%w: signing key %s was not valid at issue", ErrInvalidBundle, env.KeyID)
+	}
+
+	if at.After(b.ExpiresAt) {
+		return nil, fmt.Errorf("%w on %s", ErrExpired, b.ExpiresAt.Format(time.RFC3339))
+	}
+	return b, nil
+}
+
+// Load reads and parses a bundle file
+func Load(path string, at time.Time) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust bundle: %v", err)
+	}
+	return Parse(data, at)
+}
+
+// bundle checks the contents and decodes their keys
+func (c contents) bundle(signedBy string) (*Bundle, error) {
+	if c.Authority.Name == "" {
+		return nil, fmt.Errorf("%w: no authority name", ErrInvalidBundle)
+	}
+	if c.IssuedAt.IsZero() || !c.ExpiresAt.After(c.IssuedAt) {
+		return nil, fmt.Errorf("%w: expiry must follow issue", ErrInvalidBundle)
+	}
+	if len(c.Keys) == 0 {
+		return nil, fmt.Errorf("%w: no keys", ErrInvalidBundle)
+	}
+
+	b := &Bundle{
+		Authority: c.Authority,
+		IssuedAt:  c.IssuedAt,
+		ExpiresAt: c.ExpiresAt,
+		Keys:      make([]Key, len(c.Keys)),
+		SignedBy:  signedBy,
+	}
+	seen := make(map[string]bool, len(c.Keys))
+	for i, k := range c.Keys {
+		der, err := base64.StdEncoding.DecodeString(k.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %d: %v", ErrInvalidBundle, i+1, err)
+		}
+		parsed, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %d: %v", ErrInvalidBundle, i+1, err)
+		}
+		publicKey, ok := parsed.(*ecdsa.PublicKey)
+		if !ok || publicKey.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: key %d: %w", ErrInvalidBundle, i+1, rwcrypto.ErrInvalidKey)
+		}
+		sum := sha256.Sum256(der)
+		if id := hex.EncodeToString(sum[:]); k.KeyID != id {
+			return nil, fmt.Errorf("%w: key %d has ID %s, its key hashes to %s", ErrInvalidBundle, i+1, k.KeyID, id)
+		}
+		if seen[k.KeyID] {
+			return nil, fmt.Errorf("%w: key %s listed twice", ErrInvalidBundle, k.KeyID)
+		}
+		seen[k.KeyID] = true
+		if !k.NotBefore.IsZero() && !k.NotAfter.IsZero() && k.NotAfter.Before(k.NotBefore) {
+			return nil, fmt.Errorf("%w: key %s ends before it starts", ErrInvalidBundle, k.KeyID)
+		}
+
+		b.Keys[i] = Key{ID: k.KeyID, PublicKey: publicKey, NotBefore: k.NotBefore, NotAfter: k.NotAfter}
+	}
+	return b, nil
+}
+
+// Key returns the key with the given ID
+func (b *Bundle) Key(id string) (Key, bool) {
+	for _, k := range b.Keys {
+		if k.ID == id {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+// KeysAt returns the keys that signed at t
+func (b *Bundle) KeysAt(t time.Time) []Key {
+	var keys []Key
+	for _, k := range b.Keys {
+		if k.ValidAt(t) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Verify checks a 64-byte r || s signature over a SHA-256 digest made at signedAt,
+// usually the receipt timestamp, and returns the key that verifies it
+func (b *Bundle) Verify(digest, signature []byte, signedAt time.Time) (Key, error) {
+	for _, k := range b.KeysAt(signedAt) {
+		if rwcrypto.Verify(k.PublicKey, digest, signature) {
+			return k, nil
+		}
+	}
+	return Key{}, ErrNoKey
+}
+
+// VerifyUpdate parses a newer bundle and accepts it only when it was signed by a
+// key of b valid at its issue, so trust carries over key rotations without a
+// wallet release. A bundle issued before b is refused, so old keys can't return.
+func (b *Bundle) VerifyUpdate(data []byte, at time.Time) (*Bundle, error) {
+	next, err := Parse(data, at)
+	if err != nil {
+		return nil, err
+	}
+	if next.IssuedAt.Before(b.IssuedAt) {
+		return nil, fmt.Errorf("%w: issued %s, before the current bundle", ErrUntrustedUpdate, next.IssuedAt.Format(time.RFC3339))
+	}
+	signer, ok := b.Key(next.SignedBy)
+	if !ok || !signer.ValidAt(next.IssuedAt) {
+		return nil, fmt.Errorf("%w: signed by key %s", ErrUntrustedUpdate, next.SignedBy)
+	}
+	return next, nil
+}
@@ -0,0 +1,170 @@
+package trustbundle
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	rwcrypto "receiptwallet/crypto"
+)
+
+var issued = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func generateKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// rotated is a bundle after one rotation: old signed until a month before issue, current since
+func rotated(old, current *ecdsa.PrivateKey) *Bundle {
+	rotation := issued.AddDate(0, -1, 0)
+	return &Bundle{
+		Authority: Authority{Name: "Gelir İdaresi Başkanlığı", Country: "TR", URL: "https://authority.example"},
+		IssuedAt:  issued,
+		ExpiresAt: issued.AddDate(0, 3, 0),
+		Keys: []Key{
+			{PublicKey: &old.PublicKey, NotAfter: rotation},
+			{PublicKey: &current.PublicKey, NotBefore: rotation},
+		},
+	}
+}
+
+func TestSignAndParse(t *testing.T) {
+	old, current := generateKey(t), generateKey(t)
+	data, err := Sign(rotated(old, current), current)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	b, err := Parse(data, issued.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	currentID, _ := KeyID(&current.PublicKey)
+	if b.SignedBy != currentID || b.Authority.Country != "TR" || len(b.Keys) != 2 {
+		t.Fatalf("unexpected bundle: %+v", b)
+	}
+	if !b.Keys[0].NotBefore.IsZero() || !b.Keys[0].PublicKey.Equal(&old.PublicKey) {
+		t.Errorf("old key not read back: %+v", b.Keys[0])
+	}
+
+	// Receipts verify with the key in use when they were signed
+	digest := sha256.Sum256([]byte("receipt"))
+	before, after := issued.AddDate(0, -2, 0), issued.AddDate(0, 0, -1)
+	oldSignature, _ := rwcrypto.Sign(old, digest[:])
+	if k, err := b.Verify(digest[:], oldSignature, before); err != nil || !k.PublicKey.Equal(&old.PublicKey) {
+		t.Errorf("old receipt: key %v, err %v", k.ID, err)
+	}
+	if _, err := b.Verify(digest[:], oldSignature, after); !errors.Is(err, ErrNoKey) {
+		t.Errorf("old key after rotation: err = %v, want ErrNoKey", err)
+	}
+	currentSignature, _ := rwcrypto.Sign(current, digest[:])
+	if k, err := b.Verify(digest[:], currentSignature, after); err != nil || k.ID != currentID {
+		t.Errorf("current receipt: key %v, err %v", k.ID, err)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	old, current := generateKey(t), generateKey(t)
+	data, err := Sign(rotated(old, current), current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := base64.StdEncoding.DecodeString(env.Payload)
+	var c contents
+	if err := json.Unmarshal(payload, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	// reseal re-encodes modified contents under the original signature
+	reseal := func(modify func(*contents)) []byte {
+		modified := c
+		modified.Keys = append([]keyJSON(nil), c.Keys...)
+		modify(&modified)
+		p, _ := json.Marshal(modified)
+		e := env
+		e.Payload = base64.StdEncoding.EncodeToString(p)
+		out, _ := json.Marshal(e)
+		return out
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		at   time.Time
+		want error
+	}{
+		{"expired", data, issued.AddDate(1, 0, 0), ErrExpired},
+		{"not JSON", []byte("bundle"), issued, ErrInvalidBundle},
+		{"extended expiry", reseal(func(c *contents) { c.ExpiresAt = c.ExpiresAt.AddDate(10, 0, 0) }), issued, ErrInvalidBundle},
+		{"dropped key", reseal(func(c *contents) { c.Keys = c.Keys[1:] }), issued, ErrInvalidBundle},
+		{"wrong key ID", reseal(func(c *contents) { c.Keys[0].KeyID = c.Keys[1].KeyID }), issued, ErrInvalidBundle},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.data, tt.at); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignRequiresListedKey(t *testing.T) {
+	old, current := generateKey(t), generateKey(t)
+	if _, err := Sign(rotated(old, current), generateKey(t)); err == nil {
+		t.Error("signed with a key the bundle does not list")
+	}
+	// The old key was retired before the bundle was issued
+	if _, err := Sign(rotated(old, current), old); err == nil {
+		t.Error("signed with a retired key")
+	}
+}
+
+func TestVerifyUpdate(t *testing.T) {
+	old, current, next := generateKey(t), generateKey(t), generateKey(t)
+	data, _ := Sign(rotated(old, current), current)
+	b, err := Parse(data, issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The next rotation, vouched for by the current key
+	update := rotated(current, next)
+	update.IssuedAt = issued.AddDate(0, 1, 0)
+	update.ExpiresAt = update.IssuedAt.AddDate(0, 3, 0)
+	update.Keys[0].NotAfter = update.IssuedAt
+	update.Keys[1].NotBefore = update.IssuedAt
+	signedByCurrent, _ := Sign(update, current)
+	if _, err := b.VerifyUpdate(signedByCurrent, update.IssuedAt); err != nil {
+		t.Errorf("update signed by the current key: %v", err)
+	}
+
+	// Self-signed by a key the current bundle has never seen
+	signedByNext, _ := Sign(update, next)
+	if _, err := b.VerifyUpdate(signedByNext, update.IssuedAt); !errors.Is(err, ErrUntrustedUpdate) {
+		t.Errorf("update signed by an unknown key: err = %v, want ErrUntrustedUpdate", err)
+	}
+
+	// An older bundle can't roll trust back
+	stale := rotated(old, current)
+	stale.IssuedAt = issued.AddDate(0, 0, -1)
+	signedStale, _ := Sign(stale, current)
+	if _, err := b.VerifyUpdate(signedStale, issued); !errors.Is(err, ErrUntrustedUpdate) {
+		t.Errorf("older bundle: err = %v, want ErrUntrustedUpdate", err)
+	}
+}
@@ -13,9 +13,101 @@ type Config struct {
 		Verbose bool `yaml:"verbose"`
 	} `yaml:"server"`
 	Keys struct {
-		PrivateKeyPath string `yaml:"private_key_path"`
-		PublicKeyPath  string `yaml:"public_key_path"`
+		PrivateKeyPath       string `yaml:"private_key_path"`
+		PrivateKeyPassphrase string `yaml:"private_key_passphrase"`
+		PublicKeyPath        string `yaml:"public_key_path"`
+		CertificatePath      string `yaml:"certificate_path"`
+		ExitOnError          bool   `yaml:"exit_on_error"`
+		Ephemeral            bool   `yaml:"ephemeral"`
 	} `yaml:"keys"`
+	Health struct {
+		ErrorWindowMinutes int     `yaml:"error_window_minutes"`
+		MaxErrorRate       float64 `yaml:"max_error_rate"`
+		MinRequests        int     `yaml:"min_requests"`
+	} `yaml:"health"`
+	Quota struct {
+		Enabled   bool            `yaml:"enabled"`
+		PerMinute int             `yaml:"per_minute"`
+		PerDay    int             `yaml:"per_day"`
+		Clients   []QuotaClient   `yaml:"clients"`
+		Overrides []QuotaOverride `yaml:"overrides"`
+	} `yaml:"quota"`
+	Signing struct {
+		ReceiptEndpoint           bool    `yaml:"receipt_endpoint"`
+		RequireReceipt            bool    `yaml:"require_receipt"`
+		TimestampToleranceSeconds int     `yaml:"timestamp_tolerance_seconds"`
+		MaxTotal                  float64 `yaml:"max_total"`
+		SignResponses             bool    `yaml:"sign_responses"`
+		Workers                   int     `yaml:"workers"`
+		QueueSize                 int     `yaml:"queue_size"`
+		RequestTimeoutMs          int     `yaml:"request_timeout_ms"`
+	} `yaml:"signing"`
+	Monitoring struct {
+		RetentionDays int    `yaml:"retention_days"`
+		AdminToken    string `yaml:"admin_token"`
+		Anomalies     struct {
+			SpikeFactor  float64 `yaml:"spike_factor"`
+			BaselineDays int     `yaml:"baseline_days"`
+			MinVolume    int     `yaml:"min_volume"`
+			DailyLimit   int     `yaml:"daily_limit"`
+		} `yaml:"anomalies"`
+	} `yaml:"monitoring"`
+	Metrics struct {
+		Enabled bool `yaml:"enabled"`
+	} `yaml:"metrics"`
+	ZReport struct {
+		RequireSignature bool          `yaml:"require_signature"`
+		RegisterKeys     []RegisterKey `yaml:"register_keys"`
+	} `yaml:"zreport"`
+	Devices struct {
+		Enrollment     bool             `yaml:"enrollment"`
+		AllowAnonymous bool             `yaml:"allow_anonymous"`
+		RegistryFile   string           `yaml:"registry_file"`
+		Enrolled       []EnrolledDevice `yaml:"enrolled"`
+	} `yaml:"devices"`
+	TrustBundle struct {
+		Endpoint     bool `yaml:"endpoint"`
+		ValidityDays int  `yaml:"validity_days"`
+		Authority    struct {
+			Name    string `yaml:"name"`
+			Country string `yaml:"country"`
+			URL     string `yaml:"url"`
+		} `yaml:"authority"`
+		CurrentKeyNotBefore string       `yaml:"current_key_not_before"`
+		RetiredKeys         []RetiredKey `yaml:"retired_keys"`
+	} `yaml:"trust_bundle"`
+}
+
+// RetiredKey is a signing key rotated out, listed in trust bundles so receipts it
+// signed keep verifying. Times are RFC 3339; an empty one leaves that end open.
+type RetiredKey struct {
+	PublicKeyPath string `yaml:"public_key_path"`
+	NotBefore     string `yaml:"not_before"`
+	NotAfter      string `yaml:"not_after"`
+}
+
+// RegisterKey is the public key a cash register signs its Z-report summaries with
+type RegisterKey struct {
+	VKN           string `yaml:"vkn"`
+	PublicKeyPath string `yaml:"public_key_path"`
+}
+
+// EnrolledDevice is a register device key known to be legitimate without enrollment
+type EnrolledDevice struct {
+	VKN           string `yaml:"vkn"`
+	PublicKeyPath string `yaml:"public_key_path"`
+	Label         string `yaml:"label"`
+}
+
+type QuotaClient struct {
+	APIKey string `yaml:"api_key"`
+	VKN    string `yaml:"vkn"`
+}
+
+type QuotaOverride struct {
+	VKN       string `yaml:"vkn"`
+	PerMinute int    `yaml:"per_minute"`
+	PerDay    int    `yaml:"per_day"`
 }
 
 func Load() *Config {
@@ -3,100 +3,369 @@ package crypto
 import (
 	"crypto/ecdsa"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
-	"log"
+	"math/big"
 	"os"
+	"sync"
+	"time"
+
+	rwcrypto "receiptwallet/crypto"
+)
+
+const (
+	// TimestampTokenVersion identifies the timestamp token layout:
+	// version(1) || unix_seconds(8, big-endian) || signature(64)
+	TimestampTokenVersion = 0x01
+	TimestampTokenSize    = 1 + 8 + 64
 )
 
 type CryptoService struct {
+	files KeyFiles
+
+	mu         sync.RWMutex
 	privateKey *ecdsa.PrivateKey
 	publicKey  *ecdsa.PublicKey
+	chain      []*x509.Certificate // Signing certificate first, then its issuers
+	loadErr    error               // Why no key pair is loaded, until one is
+	keyCreated time.Time           // Modification time of the private key file
+	ephemeral  bool                // Generated in memory by NewEphemeralCryptoService; Load keeps it
 }
 
-func NewCryptoService(privateKeyPath, publicKeyPath string) *CryptoService {
-	privateKey := loadPrivateKey(privateKeyPath)
-	publicKey := loadPublicKey(publicKeyPath)
-	
+// KeyFiles locates the signing key pair and its optional certificate chain
+type KeyFiles struct {
+	PrivateKeyPath  string
+	PublicKeyPath   string
+	CertificatePath string // Optional
+	Passphrase      string // For an encrypted private key
+}
+
+// KeyStatus describes the signing key for health and readiness checks
+type KeyStatus struct {
+	Loaded            bool
+	KeyPairMatch      bool
+	Fingerprint       string // SHA-256 of the DER public key, hex
+	CertificateExpiry *time.Time
+	KeyCreated        time.Time // Modification time of the private key file, when it was generated or rotated
+	Error             string    // Why the key pair could not be loaded
+	Ephemeral         bool      // Generated at startup and lost on exit (NewEphemeralCryptoService)
+}
+
+// NewCryptoService creates the service without a key pair; signing fails with
+// ErrKeyUnavailable until Load succeeds
+func NewCryptoService(files KeyFiles) *CryptoService {
 	return &CryptoService{
-		privateKey: privateKey,
-		publicKey:  publicKey,
+		files:   files,
+		loadErr: ErrKeyUnavailable,
 	}
 }
 
-func (c *CryptoService) SignHash(hashBase64 string) (string, error) {
-	if len(hashBase64) != 44 {
-		return "", fmt.Errorf("invalid hash length: expected 44 characters, got %d", len(hashBase64))
+// Load reads the key pair and certificate chain from disk. When it fails the service
+// keeps signing with the key pair it already had; without one, KeyStatus reports why.
+func (c *CryptoService) Load() error {
+	if c.ephemeral {
+		return nil
 	}
+	privateKey, publicKey, chain, err := c.readKeys()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	hashBytes, err := base64.StdEncoding.DecodeString(hashBase64)
 	if err != nil {
-		return "", fmt.Errorf("invalid base64 encoding: %v", err)
+		if c.privateKey == nil {
+			c.loadErr = err
+		}
+		return err
 	}
 
-	if len(hashBytes) != 32 {
-		return "", fmt.Errorf("invalid hash length: expected 32 bytes, got %d", len(hashBytes))
+	c.privateKey = privateKey
+	c.publicKey = publicKey
+	c.chain = chain
+	c.loadErr = nil
+	c.keyCreated = time.Time{}
+	if info, err := os.Stat(c.files.PrivateKeyPath); err == nil {
+		c.keyCreated = info.ModTime()
+	}
+	return nil
+}
+
+func (c *CryptoService) readKeys() (*ecdsa.PrivateKey, *ecdsa.PublicKey, []*x509.Certificate, error) {
+	privateKey, err := LoadPrivateKey(c.files.PrivateKeyPath, c.files.Passphrase)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	publicKey, err := LoadPublicKey(c.files.PublicKeyPath)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
-	r, s, err := ecdsa.Sign(rand.Reader, c.privateKey, hashBytes)
+	var chain []*x509.Certificate
+	if c.files.CertificatePath != "" {
+		if chain, err = loadCertificateChain(c.files.CertificatePath, publicKey); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return privateKey, publicKey, chain, nil
+}
+
+func (c *CryptoService) SignHash(hashBase64 string) (string, error) {
+	hashBytes, err := decodeHash(hashBase64)
 	if err != nil {
-		return "", fmt.Errorf("failed to sign hash: %v", err)
+		return "", err
+	}
+
+	signature, err := c.sign(hashBytes)
+	if err != nil {
+		return "", err
 	}
 
-	signature := append(r.Bytes(), s.Bytes()...)
 	return base64.StdEncoding.EncodeToString(signature), nil
 }
 
-func (c *CryptoService) GetPublicKeyBase64() (string, error) {
-	publicKeyBytes, err := x509.MarshalPKIXPublicKey(c.publicKey)
+// SignTimestamp issues a token attesting that the authority saw hashBase64 at signedAt.
+// The token signature covers SHA-256(hash || unix_seconds).
+func (c *CryptoService) SignTimestamp(hashBase64 string, signedAt time.Time) (string, error) {
+	hashBytes, err := decodeHash(hashBase64)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal public key: %v", err)
+		return "", err
 	}
-	
-	return base64.StdEncoding.EncodeToString(publicKeyBytes), nil
+
+	timeBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(timeBytes, uint64(signedAt.UTC().Unix()))
+
+	digest := sha256.Sum256(append(hashBytes, timeBytes...))
+	signature, err := c.sign(digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	token := make([]byte, 0, TimestampTokenSize)
+	token = append(token, TimestampTokenVersion)
+	token = append(token, timeBytes...)
+	token = append(token, signature...)
+
+	return base64.StdEncoding.EncodeToString(token), nil
 }
 
-func loadPrivateKey(path string) *ecdsa.PrivateKey {
-	keyData, err := os.ReadFile(path)
+// SignResponse signs an HTTP response to a client's nonce so registers without TLS can
+// detect substituted signatures or keys (see receiptwallet/crypto.ResponseDigest)
+func (c *CryptoService) SignResponse(nonce, path string, status int, body []byte) (string, error) {
+	privateKey, err := c.signingKey()
 	if err != nil {
-		log.Fatalf("Failed to read private key: %v", err)
+		return "", err
 	}
+	return rwcrypto.SignResponse(privateKey, nonce, path, status, body)
+}
 
-	block, _ := pem.Decode(keyData)
-	if block == nil {
-		log.Fatalf("Failed to decode PEM block for private key")
+// signingKey returns the loaded private key, or ErrKeyUnavailable
+func (c *CryptoService) signingKey() (*ecdsa.PrivateKey, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.privateKey == nil {
+		return nil, ErrKeyUnavailable
+	}
+	return c.privateKey, nil
+}
+
+// sign produces a fixed-size 64-byte r || s signature
+func (c *CryptoService) sign(digest []byte) ([]byte, error) {
+	privateKey, err := c.signingKey()
+	if err != nil {
+		return nil, err
+	}
+
+	r, s, err := ecdsa.Sign(rand.Reader, privateKey, digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign hash: %v", err)
+	}
+
+	return encodeSignature(r, s), nil
+}
+
+func decodeHash(hashBase64 string) ([]byte, error) {
+	if len(hashBase64) != 44 {
+		return nil, fmt.Errorf("invalid hash length: expected 44 characters, got %d", len(hashBase64))
+	}
+
+	hashBytes, err := base64.StdEncoding.DecodeString(hashBase64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 encoding: %v", err)
+	}
+
+	if len(hashBytes) != 32 {
+		return nil, fmt.Errorf("invalid hash length: expected 32 bytes, got %d", len(hashBytes))
 	}
 
-	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
+	return hashBytes, nil
+}
+
+// encodeSignature left-pads r and s to 32 bytes each so signatures are always 64 bytes
+func encodeSignature(r, s *big.Int) []byte {
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signature
+}
+
+// loadCertificateChain reads the X.509 certificate issued for the signing key, optionally
+// followed by the intermediate certificates that issued it, so wallets can chain the key
+// to a root they trust. Each certificate must be signed by the one after it.
+func loadCertificateChain(path string, publicKey *ecdsa.PublicKey) ([]*x509.Certificate, error) {
+	certData, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatalf("Failed to parse private key: %v", err)
+		return nil, fmt.Errorf("failed to read certificate: %v", err)
+	}
+
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, certData = pem.Decode(certData)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %d: %v", len(chain)+1, err)
+		}
+		chain = append(chain, certificate)
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("failed to decode PEM block for certificate")
+	}
+
+	if !publicKey.Equal(chain[0].PublicKey) {
+		return nil, fmt.Errorf("certificate does not match the configured public key")
+	}
+
+	for i := 1; i < len(chain); i++ {
+		if err := chain[i-1].CheckSignatureFrom(chain[i]); err != nil {
+			return nil, fmt.Errorf("certificate %d is not issued by certificate %d: %v", i, i+1, err)
+		}
 	}
 
-	return privateKey
+	return chain, nil
 }
 
-func loadPublicKey(path string) *ecdsa.PublicKey {
+// CertificateChainPEM returns the loaded certificate chain, signing certificate first,
+// or nil when no certificate is configured
+func (c *CryptoService) CertificateChainPEM() []byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var data []byte
+	for _, certificate := range c.chain {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})...)
+	}
+	return data
+}
+
+func (c *CryptoService) KeyStatus() KeyStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	status := KeyStatus{
+		Loaded:    c.privateKey != nil && c.publicKey != nil,
+		Ephemeral: c.ephemeral,
+	}
+	if !status.Loaded {
+		if c.loadErr != nil {
+			status.Error = c.loadErr.Error()
+		}
+		return status
+	}
+
+	status.KeyPairMatch = c.privateKey.PublicKey.Equal(c.publicKey)
+	status.KeyCreated = c.keyCreated
+
+	if der, err := x509.MarshalPKIXPublicKey(c.publicKey); err == nil {
+		sum := sha256.Sum256(der)
+		status.Fingerprint = hex.EncodeToString(sum[:])
+	}
+
+	// The chain stops verifying when any certificate in it expires
+	for _, certificate := range c.chain {
+		if status.CertificateExpiry == nil || certificate.NotAfter.Before(*status.CertificateExpiry) {
+			expiry := certificate.NotAfter
+			status.CertificateExpiry = &expiry
+		}
+	}
+
+	return status
+}
+
+func (c *CryptoService) GetPublicKeyBase64() (string, error) {
+	c.mu.RLock()
+	publicKey := c.publicKey
+	c.mu.RUnlock()
+
+	if publicKey == nil {
+		return "", ErrKeyUnavailable
+	}
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %v", err)
+	}
+	
+	return base64.StdEncoding.EncodeToString(publicKeyBytes), nil
+}
+
+// LoadRegisterKey reads the PEM public key a cash register signs its submissions with
+func LoadRegisterKey(path string) (*ecdsa.PublicKey, error) {
 	keyData, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatalf("Failed to read public key: %v", err)
+		return nil, fmt.Errorf("failed to read register key: %v", err)
 	}
 
 	block, _ := pem.Decode(keyData)
 	if block == nil {
-		log.Fatalf("Failed to decode PEM block for public key")
+		return nil, fmt.Errorf("failed to decode PEM block for register key")
 	}
 
 	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
-		log.Fatalf("Failed to parse public key: %v", err)
+		return nil, fmt.Errorf("failed to parse register key: %v", err)
 	}
 
 	ecdsaPublicKey, ok := publicKey.(*ecdsa.PublicKey)
 	if !ok {
-		log.Fatalf("Public key is not ECDSA")
+		return nil, fmt.Errorf("register key is not ECDSA")
+	}
+
+	return ecdsaPublicKey, nil
+}
+
+// LoadDeviceKey reads a register's PEM device public key in the 33-byte compressed form
+// receipts carry it in
+func LoadDeviceKey(path string) ([]byte, error) {
+	publicKey, err := LoadRegisterKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return rwcrypto.CompressKey(publicKey)
+}
+
+// VerifySignature checks a base64 64-byte r || s signature over a SHA-256 digest
+func VerifySignature(publicKey *ecdsa.PublicKey, digest []byte, signatureBase64 string) bool {
+	signature, err := base64.StdEncoding.DecodeString(signatureBase64)
+	if err != nil || len(signature) != 64 {
+		return false
 	}
 
-	return ecdsaPublicKey
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	return ecdsa.Verify(publicKey, digest, r, s)
 }
\ No newline at end of file
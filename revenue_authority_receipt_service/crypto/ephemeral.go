@@ -0,0 +1,27 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"time"
+)
+
+// NewEphemeralCryptoService creates a service signing with a P-256 key pair generated in
+// memory, for integration tests and demos that shouldn't need key files. The public key
+// is served as usual, but it changes on every start: receipts signed by an earlier run
+// no longer verify against it. Load does nothing, so SIGHUP keeps the key.
+func NewEphemeralCryptoService() (*CryptoService, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+
+	return &CryptoService{
+		privateKey: key,
+		publicKey:  &key.PublicKey,
+		keyCreated: time.Now(),
+		ephemeral:  true,
+	}, nil
+}
@@ -0,0 +1,110 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+// GeneratedKeys is a fresh signing key pair in the PEM forms the service loads
+type GeneratedKeys struct {
+	PrivateKeyPEM  []byte // SEC1 "EC PRIVATE KEY", unencrypted, as openssl ecparam writes it
+	PublicKeyPEM   []byte // PKIX "PUBLIC KEY"
+	CertificatePEM []byte // Self-signed certificate, when requested
+	Fingerprint    string // SHA-256 of the DER public key, hex, as reported by /health
+}
+
+// GenerateKeys creates a P-256 signing key pair. With a non-zero validity it also issues
+// a self-signed certificate for the key, for installs without a CA that still want to
+// serve /certificate; wallets then have to trust that certificate itself as a root.
+func GenerateKeys(commonName string, validity time.Duration) (*GeneratedKeys, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+
+	privateDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %v", err)
+	}
+	sum := sha256.Sum256(publicDER)
+
+	generated := &GeneratedKeys{
+		PrivateKeyPEM: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateDER}),
+		PublicKeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}),
+		Fingerprint:   hex.EncodeToString(sum[:]),
+	}
+
+	if validity > 0 {
+		certDER, err := selfSignedCertificate(key, commonName, validity)
+		if err != nil {
+			return nil, err
+		}
+		generated.CertificatePEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	}
+	return generated, nil
+}
+
+// selfSignedCertificate issues a certificate for key signed by key itself, limited to
+// signing (not a CA, so it can't vouch for other keys)
+func selfSignedCertificate(key *ecdsa.PrivateKey, commonName string, validity time.Duration) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-5 * time.Minute), // Tolerate clients with a slightly late clock
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %v", err)
+	}
+	return der, nil
+}
+
+// WriteKeyFile writes a generated PEM file; private keys are readable by the owner only.
+// An existing file is only replaced with overwrite.
+func WriteKeyFile(path string, data []byte, private, overwrite bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags |= os.O_EXCL
+	}
+	mode := os.FileMode(0644)
+	if private {
+		mode = 0600
+	}
+
+	f, err := os.OpenFile(path, flags, mode)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%s already exists", path)
+		}
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,254 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+)
+
+var (
+	// ErrKeyUnavailable is returned for signing requests while no key pair is loaded
+	ErrKeyUnavailable = errors.New("signing key not loaded")
+	// ErrPassphraseRequired is returned for an encrypted private key without a passphrase
+	ErrPassphraseRequired = errors.New("private key is encrypted; set keys.private_key_passphrase or RA_KEY_PASSPHRASE")
+	// ErrIncorrectPassphrase is returned when an encrypted private key does not decrypt
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase for private key")
+)
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// maxPBKDF2Iterations bounds the work an encrypted key file can demand at startup;
+// OpenSSL writes 2048 by default and the strongest common settings stay far below
+const maxPBKDF2Iterations = 10_000_000
+
+// LoadPrivateKey reads a P-256 private key from a PEM file in SEC1 ("EC PRIVATE KEY",
+// as openssl ecparam writes it) or PKCS#8 ("PRIVATE KEY") form. Keys encrypted by
+// openssl ec -aes256 or by openssl pkcs8 -topk8 / genpkey -aes256 (PBES2 with PBKDF2
+// and AES-CBC) are decrypted with passphrase.
+func LoadPrivateKey(path, passphrase string) (*ecdsa.PrivateKey, error) {
+	keyData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %v", err)
+	}
+
+	block, err := decodeKeyBlock(keyData, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key any
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		der := block.Bytes
+		// Legacy PEM encryption is deprecated but still what openssl ec -aes256 writes
+		if x509.IsEncryptedPEMBlock(block) {
+			if passphrase == "" {
+				return nil, fmt.Errorf("%s: %w", path, ErrPassphraseRequired)
+			}
+			der, err = x509.DecryptPEMBlock(block, []byte(passphrase))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, ErrIncorrectPassphrase)
+			}
+		}
+		key, err = x509.ParseECPrivateKey(der)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		if passphrase == "" {
+			return nil, fmt.Errorf("%s: %w", path, ErrPassphraseRequired)
+		}
+		der, decryptErr := decryptPKCS8(block.Bytes, passphrase)
+		if decryptErr != nil {
+			return nil, fmt.Errorf("%s: %w", path, decryptErr)
+		}
+		if key, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+			// Garbage that happened to end in valid padding
+			return nil, fmt.Errorf("%s: %w", path, ErrIncorrectPassphrase)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q for private key (expected EC PRIVATE KEY, PRIVATE KEY or ENCRYPTED PRIVATE KEY)", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %v", path, err)
+	}
+
+	privateKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: private key is %T, not ECDSA", path, key)
+	}
+	if privateKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%s: private key uses %s, signatures need P-256", path, privateKey.Curve.Params().Name)
+	}
+
+	return privateKey, nil
+}
+
+// LoadPublicKey reads a PKIX ("PUBLIC KEY") P-256 public key from a PEM file
+func LoadPublicKey(path string) (*ecdsa.PublicKey, error) {
+	keyData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %v", err)
+	}
+
+	block, err := decodeKeyBlock(keyData, path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("%s: unsupported PEM block %q for public key (expected PUBLIC KEY)", path, block.Type)
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %v", path, err)
+	}
+
+	ecdsaPublicKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: public key is %T, not ECDSA", path, publicKey)
+	}
+	if ecdsaPublicKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%s: public key uses %s, signatures need P-256", path, ecdsaPublicKey.Curve.Params().Name)
+	}
+
+	return ecdsaPublicKey, nil
+}
+
+// decodeKeyBlock returns the first PEM block that isn't EC PARAMETERS, which
+// openssl ecparam -genkey writes ahead of the key unless given -noout
+func decodeKeyBlock(data []byte, path string) (*pem.Block, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s: no PEM block found (is it a PEM file?)", path)
+		}
+		if block.Type != "EC PARAMETERS" {
+			return block, nil
+		}
+	}
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts a PKCS#8 EncryptedPrivateKeyInfo using PBES2 (RFC 8018)
+// with PBKDF2 and AES-CBC, the scheme OpenSSL uses by default
+func decryptPKCS8(der []byte, passphrase string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse encrypted private key: %v", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption %v (only PBES2 is supported)", info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("failed to parse PBES2 parameters: %v", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation %v (only PBKDF2 is supported)", params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("failed to parse PBKDF2 parameters: %v", err)
+	}
+	if kdf.IterationCount < 1 || kdf.IterationCount > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("PBKDF2 iteration count %d out of range (1 to %d)", kdf.IterationCount, maxPBKDF2Iterations)
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdf.PRF.Algorithm) == 0, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 PRF %v", kdf.PRF.Algorithm)
+	}
+
+	var keyLength int
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLength = 16
+	case scheme.Equal(oidAES192CBC):
+		keyLength = 24
+	case scheme.Equal(oidAES256CBC):
+		keyLength = 32
+	default:
+		return nil, fmt.Errorf("unsupported private key cipher %v (only AES-CBC is supported)", scheme)
+	}
+	// The key length is optional, but when present it must be the cipher's
+	if kdf.KeyLength != 0 && kdf.KeyLength != keyLength {
+		return nil, fmt.Errorf("PBKDF2 key length %d does not match the cipher's %d", kdf.KeyLength, keyLength)
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid AES-CBC IV in encrypted private key")
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted private key is not a whole number of AES blocks")
+	}
+
+	key, err := pbkdf2.Key(prf, passphrase, kdf.Salt, kdf.IterationCount, keyLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, info.EncryptedData)
+
+	// A wrong passphrase almost always shows up as broken PKCS#7 padding
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, ErrIncorrectPassphrase
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return nil, ErrIncorrectPassphrase
+		}
+	}
+
+	return plaintext[:len(plaintext)-padding], nil
+}
@@ -0,0 +1,134 @@
+package crypto
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The fixtures in testdata are one P-256 key written by openssl 3:
+//
+//	openssl ecparam -name prime256v1 -genkey -noout -out sec1.pem
+//	openssl pkcs8 -topk8 -nocrypt -in sec1.pem -out pkcs8.pem
+//	openssl pkcs8 -topk8 -v2 aes-256-cbc -v2prf hmacWithSHA256 -passout pass:correct-horse -in sec1.pem -out pkcs8_encrypted.pem
+//	openssl pkcs8 -topk8 -v2 aes-128-cbc -v2prf hmacWithSHA1 -passout pass:correct-horse -in sec1.pem -out pkcs8_encrypted_sha1.pem
+//	openssl ec -in sec1.pem -aes256 -passout pass:correct-horse -out sec1_encrypted.pem
+//	openssl ec -in sec1.pem -pubout -out public.pem
+//	openssl ecparam -name secp384r1 -genkey -noout -out p384.pem
+const fixturePassphrase = "correct-horse"
+
+func TestLoadPrivateKeyForms(t *testing.T) {
+	publicKey, err := LoadPublicKey("testdata/public.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		file       string
+		passphrase string
+	}{
+		{"sec1.pem", ""},
+		{"pkcs8.pem", ""},
+		{"pkcs8_encrypted.pem", fixturePassphrase},
+		{"pkcs8_encrypted_sha1.pem", fixturePassphrase},
+		{"sec1_encrypted.pem", fixturePassphrase},
+	} {
+		key, err := LoadPrivateKey(filepath.Join("testdata", tt.file), tt.passphrase)
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if !key.PublicKey.Equal(publicKey) {
+			t.Errorf("%s: loaded a key that doesn't match public.pem", tt.file)
+		}
+	}
+}
+
+func TestLoadPrivateKeyPassphrase(t *testing.T) {
+	for _, file := range []string{"pkcs8_encrypted.pem", "pkcs8_encrypted_sha1.pem", "sec1_encrypted.pem"} {
+		path := filepath.Join("testdata", file)
+		if _, err := LoadPrivateKey(path, ""); !errors.Is(err, ErrPassphraseRequired) {
+			t.Errorf("%s without a passphrase: got %v, want ErrPassphraseRequired", file, err)
+		}
+		if _, err := LoadPrivateKey(path, "wrong-horse"); !errors.Is(err, ErrIncorrectPassphrase) {
+			t.Errorf("%s with a wrong passphrase: got %v, want ErrIncorrectPassphrase", file, err)
+		}
+	}
+}
+
+func TestLoadPrivateKeyWrongCurve(t *testing.T) {
+	_, err := LoadPrivateKey("testdata/p384.pem", "")
+	if err == nil || !strings.Contains(err.Error(), "P-256") {
+		t.Errorf("P-384 key: got %v, want a P-256 error", err)
+	}
+}
+
+func TestDecryptPKCS8Parameters(t *testing.T) {
+	data, err := os.ReadFile("testdata/pkcs8_encrypted.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+
+	for _, tt := range []struct {
+		name   string
+		modify func(kdf *pbkdf2Params)
+		want   string
+	}{
+		{"iterations above the cap", func(kdf *pbkdf2Params) { kdf.IterationCount = maxPBKDF2Iterations + 1 }, "iteration count"},
+		{"zero iterations", func(kdf *pbkdf2Params) { kdf.IterationCount = 0 }, "iteration count"},
+		{"key length of another cipher", func(kdf *pbkdf2Params) { kdf.KeyLength = 16 }, "key length"},
+	} {
+		der := rewritePBKDF2(t, block.Bytes, tt.modify)
+		if _, err := decryptPKCS8(der, fixturePassphrase); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want an error about the %s", tt.name, err, tt.want)
+		}
+	}
+
+	// A matching key length is accepted
+	der := rewritePBKDF2(t, block.Bytes, func(kdf *pbkdf2Params) { kdf.KeyLength = 32 })
+	plaintext, err := decryptPKCS8(der, fixturePassphrase)
+	if err != nil {
+		t.Fatalf("Explicit key length 32 for AES-256: %v", err)
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(plaintext); err != nil {
+		t.Errorf("Decrypted key does not parse: %v", err)
+	}
+}
+
+// rewritePBKDF2 re-encodes an EncryptedPrivateKeyInfo with modified PBKDF2 parameters
+func rewritePBKDF2(t *testing.T, der []byte, modify func(kdf *pbkdf2Params)) []byte {
+	t.Helper()
+	var info encryptedPrivateKeyInfo
+	var params pbes2Params
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		t.Fatal(err)
+	}
+
+	modify(&kdf)
+
+	var err error
+	if params.KeyDerivationFunc.Parameters.FullBytes, err = asn1.Marshal(kdf); err != nil {
+		t.Fatal(err)
+	}
+	if info.Algorithm.Parameters.FullBytes, err = asn1.Marshal(params); err != nil {
+		t.Fatal(err)
+	}
+	out, err := asn1.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
@@ -0,0 +1,51 @@
+package crypto
+
+import (
+	"fmt"
+	"time"
+
+	"receiptwallet/trustbundle"
+)
+
+// TrustBundleOptions describes a trust bundle beyond the loaded signing key
+type TrustBundleOptions struct {
+	Authority   trustbundle.Authority
+	RetiredKeys []trustbundle.Key // Keys that signed before the loaded one, with the periods they signed in
+	NotBefore   time.Time         // When the loaded key started signing; its certificate's start when zero
+	Validity    time.Duration     // How long wallets accept the bundle
+}
+
+// TrustBundle signs a bundle of the retired keys and the loaded key with the loaded
+// key. The loaded key's period ends when its certificate chain expires, or is left
+// open without a certificate.
+func (c *CryptoService) TrustBundle(options TrustBundleOptions, now time.Time) ([]byte, error) {
+	c.mu.RLock()
+	privateKey, chain := c.privateKey, c.chain
+	c.mu.RUnlock()
+
+	if privateKey == nil {
+		return nil, ErrKeyUnavailable
+	}
+
+	current := trustbundle.Key{PublicKey: &privateKey.PublicKey, NotBefore: options.NotBefore}
+	for i, certificate := range chain {
+		if i == 0 && current.NotBefore.IsZero() {
+			current.NotBefore = certificate.NotBefore
+		}
+		if current.NotAfter.IsZero() || certificate.NotAfter.Before(current.NotAfter) {
+			current.NotAfter = certificate.NotAfter
+		}
+	}
+
+	bundle := &trustbundle.Bundle{
+		Authority: options.Authority,
+		IssuedAt:  now.Truncate(time.Second),
+		ExpiresAt: now.Truncate(time.Second).Add(options.Validity),
+		Keys:      append(append([]trustbundle.Key{}, options.RetiredKeys...), current),
+	}
+	data, err := trustbundle.Sign(bundle, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign trust bundle: %v", err)
+	}
+	return data, nil
+}
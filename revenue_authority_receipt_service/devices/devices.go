@@ -0,0 +1,187 @@
+package devices
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDuplicate is returned for a device key already enrolled for the VKN
+	ErrDuplicate = errors.New("device key already enrolled")
+	// ErrKeyInUse is returned for a device key enrolled for another VKN
+	ErrKeyInUse = errors.New("device key is enrolled for another VKN")
+)
+
+// Device is a cash register's device key enrolled as legitimate for a VKN
+type Device struct {
+	VKN        string
+	PublicKey  []byte // 33-byte compressed P-256 key, as receipts carry it
+	Label      string
+	Proven     bool // Enrolled with a signature by the device key, not from configuration
+	EnrolledAt time.Time
+}
+
+// KeyID identifies a device key: SHA-256 of its compressed form, hex
+func (d Device) KeyID() string {
+	return KeyID(d.PublicKey)
+}
+
+// storedDevice is a proven enrollment as kept in the registry file
+type storedDevice struct {
+	VKN        string    `json:"vkn"`
+	PublicKey  []byte    `json:"public_key"`
+	Label      string    `json:"label,omitempty"`
+	EnrolledAt time.Time `json:"enrolled_at"`
+}
+
+// Registry keeps the device keys enrolled per VKN in enrollment order
+type Registry struct {
+	mu      sync.RWMutex
+	devices map[string][]Device
+	owners  map[string]string // key: key ID, value: VKN
+	path    string            // Registry file for proven enrollments, "" = memory only
+}
+
+// NewRegistry creates an empty device registry kept in memory
+func NewRegistry() *Registry {
+	return &Registry{
+		devices: make(map[string][]Device),
+		owners:  make(map[string]string),
+	}
+}
+
+// Open creates a device registry that keeps proven enrollments in the file at path,
+// loading those already there. A missing file is an empty registry.
+func Open(path string) (*Registry, error) {
+	r := NewRegistry()
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		var stored []storedDevice
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return nil, fmt.Errorf("device registry %s: %v", path, err)
+		}
+		for _, s := range stored {
+			device := Device{VKN: s.VKN, PublicKey: s.PublicKey, Label: s.Label, Proven: true, EnrolledAt: s.EnrolledAt}
+			if err := r.add(device); err != nil {
+				return nil, fmt.Errorf("device registry %s: %v", path, err)
+			}
+		}
+	}
+	r.path = path
+	return r, nil
+}
+
+// Enroll records a device key for its VKN. A key belongs to one VKN only, so a
+// register's device can't vouch for receipts of another taxpayer. Proven enrollments
+// are written to the registry file before Enroll returns; if that fails the device
+// is not enrolled.
+func (r *Registry) Enroll(device Device) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.add(device); err != nil {
+		return err
+	}
+	if r.path == "" || !device.Proven {
+		return nil
+	}
+	if err := r.save(); err != nil {
+		r.remove(device)
+		return fmt.Errorf("failed to save device registry: %v", err)
+	}
+	return nil
+}
+
+func (r *Registry) add(device Device) error {
+	keyID := device.KeyID()
+	if owner, enrolled := r.owners[keyID]; enrolled {
+		if owner == device.VKN {
+			return fmt.Errorf("%w: %s for VKN %s", ErrDuplicate, keyID[:16], device.VKN)
+		}
+		return fmt.Errorf("%w: %s", ErrKeyInUse, keyID[:16])
+	}
+
+	device.PublicKey = bytes.Clone(device.PublicKey)
+	r.devices[device.VKN] = append(r.devices[device.VKN], device)
+	r.owners[keyID] = device.VKN
+	return nil
+}
+
+// remove undoes add for the device enrolled last for its VKN
+func (r *Registry) remove(device Device) {
+	list := r.devices[device.VKN]
+	r.devices[device.VKN] = list[:len(list)-1]
+	if len(r.devices[device.VKN]) == 0 {
+		delete(r.devices, device.VKN)
+	}
+	delete(r.owners, device.KeyID())
+}
+
+// save rewrites the registry file with every proven enrollment, through a temporary
+// file so a crash never leaves it half written
+func (r *Registry) save() error {
+	vkns := make([]string, 0, len(r.devices))
+	for vkn := range r.devices {
+		vkns = append(vkns, vkn)
+	}
+	sort.Strings(vkns)
+
+	stored := []storedDevice{}
+	for _, vkn := range vkns {
+		for _, d := range r.devices[vkn] {
+			if d.Proven {
+				stored = append(stored, storedDevice{VKN: d.VKN, PublicKey: d.PublicKey, Label: d.Label, EnrolledAt: d.EnrolledAt})
+			}
+		}
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+// List returns the devices enrolled for a VKN, oldest first
+func (r *Registry) List(vkn string) []Device {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]Device, len(r.devices[vkn]))
+	copy(result, r.devices[vkn])
+	return result
+}
+
+// KeyID is the hex SHA-256 of a compressed device key
+func KeyID(compressed []byte) string {
+	sum := sha256.Sum256(compressed)
+	return hex.EncodeToString(sum[:])
+}
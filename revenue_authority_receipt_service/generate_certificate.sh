@@ -0,0 +1,60 @@
+#!/bin/bash
+
+# Revenue Authority Receipt Service - Demo Certificate Chain
+# Issues an X.509 certificate for the existing signing key through a demo
+# root and intermediate CA, so wallets can verify /certificate against a root.
+
+PRIVATE_KEY_PATH="keys/private_key.pem"
+CA_DIR="keys/ca"
+ROOT_CERT_PATH="keys/root_ca.pem"
+CHAIN_PATH="keys/certificate.pem"
+DAYS=365
+
+if [ ! -f "$PRIVATE_KEY_PATH" ]; then
+    echo "Error: $PRIVATE_KEY_PATH not found; run ./generate_keys.sh first"
+    exit 1
+fi
+
+mkdir -p "$CA_DIR"
+
+echo "Generating demo root CA..."
+openssl ecparam -genkey -name prime256v1 -noout -out "$CA_DIR/root_key.pem" || exit 1
+if ! openssl req -x509 -new -key "$CA_DIR/root_key.pem" -days 3650 \
+    -subj "/CN=Demo Revenue Authority Root CA" \
+    -addext "basicConstraints=critical,CA:TRUE" \
+    -addext "keyUsage=critical,keyCertSign,cRLSign" \
+    -out "$ROOT_CERT_PATH"; then
+    echo "Error: Failed to create root certificate"
+    exit 1
+fi
+
+echo "Generating demo intermediate CA..."
+openssl ecparam -genkey -name prime256v1 -noout -out "$CA_DIR/intermediate_key.pem" || exit 1
+openssl req -new -key "$CA_DIR/intermediate_key.pem" \
+    -subj "/CN=Demo Revenue Authority Signing CA" -out "$CA_DIR/intermediate.csr" || exit 1
+if ! openssl x509 -req -in "$CA_DIR/intermediate.csr" -days 1825 \
+    -CA "$ROOT_CERT_PATH" -CAkey "$CA_DIR/root_key.pem" -CAcreateserial \
+    -extfile <(printf "basicConstraints=critical,CA:TRUE,pathlen:0\nkeyUsage=critical,keyCertSign,cRLSign\n") \
+    -out "$CA_DIR/intermediate.pem" 2>/dev/null; then
+    echo "Error: Failed to create intermediate certificate"
+    exit 1
+fi
+
+echo "Issuing signing certificate..."
+openssl req -new -key "$PRIVATE_KEY_PATH" \
+    -subj "/CN=Demo Revenue Authority Receipt Signing" -out "$CA_DIR/signing.csr" || exit 1
+if ! openssl x509 -req -in "$CA_DIR/signing.csr" -days "$DAYS" \
+    -CA "$CA_DIR/intermediate.pem" -CAkey "$CA_DIR/intermediate_key.pem" -CAcreateserial \
+    -extfile <(printf "basicConstraints=critical,CA:FALSE\nkeyUsage=critical,digitalSignature\n") \
+    -out "$CA_DIR/signing.pem" 2>/dev/null; then
+    echo "Error: Failed to issue signing certificate"
+    exit 1
+fi
+
+# Served at /certificate: signing certificate first, then its issuer
+cat "$CA_DIR/signing.pem" "$CA_DIR/intermediate.pem" > "$CHAIN_PATH"
+rm -f "$CA_DIR"/*.csr
+
+echo "Certificate chain generated successfully:"
+echo "  - Chain (set keys.certificate_path): $CHAIN_PATH"
+echo "  - Root for wallets: $ROOT_CERT_PATH"
@@ -40,3 +40,7 @@ require (
 	golang.org/x/tools v0.34.0 // indirect
 	google.golang.org/protobuf v1.36.9 // indirect
 )
+
+require receiptwallet v0.0.0
+
+replace receiptwallet => ../receiptwallet
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	rwcrypto "receiptwallet/crypto"
+
+	"revenue-authority-receipt-service/crypto"
+	"revenue-authority-receipt-service/devices"
+	"revenue-authority-receipt-service/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxDeviceLabel bounds the free-text label of an enrolled device, in characters
+const maxDeviceLabel = 64
+
+type DeviceHandler struct {
+	registry       *devices.Registry
+	identify       func(r *http.Request, clientIP string) (string, string)
+	allowAnonymous bool
+}
+
+// NewDeviceHandler creates the device enrollment handler; identify resolves the VKN of the
+// requesting register so a register cannot enroll devices for another VKN
+func NewDeviceHandler(registry *devices.Registry, identify func(r *http.Request, clientIP string) (string, string)) *DeviceHandler {
+	return &DeviceHandler{
+		registry: registry,
+		identify: identify,
+	}
+}
+
+// SetAllowAnonymous also accepts enrollments from registers not identified by an API key
+// or client certificate, for any VKN; for lab setups only
+func (h *DeviceHandler) SetAllowAnonymous(allowed bool) {
+	h.allowAnonymous = allowed
+}
+
+// EnrollDevice records a register's device key as legitimate for its VKN
+func (h *DeviceHandler) EnrollDevice(c *gin.Context) {
+	var req models.DeviceEnrollmentRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid request format",
+		})
+		return
+	}
+
+	var enrollment models.DeviceEnrollment
+	if err := json.Unmarshal(req.Enrollment, &enrollment); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "enrollment must be a JSON object",
+		})
+		return
+	}
+	if !vknPattern.MatchString(enrollment.VKN) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "vkn must be 10 or 11 digits",
+		})
+		return
+	}
+	if utf8.RuneCountInString(enrollment.Label) > maxDeviceLabel {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "label must be at most 64 characters",
+		})
+		return
+	}
+	compressed, err := base64.StdEncoding.DecodeString(enrollment.PublicKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "public_key must be base64",
+		})
+		return
+	}
+	deviceKey, err := rwcrypto.DecompressKey(compressed)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "public_key must be a 33-byte compressed P-256 key",
+		})
+		return
+	}
+
+	// Proof of possession: the signature covers the enrollment bytes exactly as sent
+	digest := sha256.Sum256(req.Enrollment)
+	if req.Signature == "" || !crypto.VerifySignature(deviceKey, digest[:], req.Signature) {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Enrollment signature does not verify against the device key",
+		})
+		return
+	}
+
+	_, requesterVKN := h.identify(c.Request, c.ClientIP())
+	if requesterVKN == "" && !h.allowAnonymous {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Enrollment needs the register's API key or client certificate",
+		})
+		return
+	}
+	if requesterVKN != "" && requesterVKN != enrollment.VKN {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error: "Device VKN does not match the requesting register",
+		})
+		return
+	}
+
+	device := devices.Device{
+		VKN:        enrollment.VKN,
+		PublicKey:  compressed,
+		Label:      enrollment.Label,
+		Proven:     true,
+		EnrolledAt: time.Now().UTC(),
+	}
+	if err := h.registry.Enroll(device); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, devices.ErrDuplicate) || errors.Is(err, devices.ErrKeyInUse) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	log.Printf("Enrolled device %s for VKN %s (%s)", device.KeyID()[:16], device.VKN, device.Label)
+
+	c.JSON(http.StatusOK, deviceResponse(device))
+}
+
+// Devices lists the device keys enrolled for one VKN; wallets check a receipt's device key
+// against it. A VKN without devices gets an empty list.
+func (h *DeviceHandler) Devices(c *gin.Context) {
+	vkn := c.Param("vkn")
+	if !vknPattern.MatchString(vkn) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "vkn must be 10 or 11 digits",
+		})
+		return
+	}
+
+	enrolled := h.registry.List(vkn)
+	response := models.DevicesResponse{
+		VKN:     vkn,
+		Devices: make([]models.DeviceResponse, len(enrolled)),
+	}
+	for i, device := range enrolled {
+		response.Devices[i] = deviceResponse(device)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func deviceResponse(device devices.Device) models.DeviceResponse {
+	return models.DeviceResponse{
+		VKN:        device.VKN,
+		PublicKey:  base64.StdEncoding.EncodeToString(device.PublicKey),
+		KeyID:      device.KeyID(),
+		Label:      device.Label,
+		Proven:     device.Proven,
+		EnrolledAt: device.EnrolledAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// publicKeyETag is the strong entity tag of a /public-key response: the key's
+// fingerprint, which changes exactly when the key is rotated
+func publicKeyETag(publicKeyBase64 string) string {
+	der, err := base64.StdEncoding.DecodeString(publicKeyBase64)
+	if err != nil {
+		der = []byte(publicKeyBase64)
+	}
+	sum := sha256.Sum256(der)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag (or is "*").
+// Weak tags match too, as If-None-Match compares weakly.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -1,16 +1,23 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"revenue-authority-receipt-service/crypto"
 	"revenue-authority-receipt-service/models"
+	"revenue-authority-receipt-service/receipt"
+	"revenue-authority-receipt-service/signing"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Handler struct {
 	cryptoService *crypto.CryptoService
+	policy        receipt.Policy
+	identify      func(r *http.Request, clientIP string) (string, string)
+	pool          *signing.Pool
 }
 
 func NewHandler(cryptoService *crypto.CryptoService) *Handler {
@@ -19,6 +26,13 @@ func NewHandler(cryptoService *crypto.CryptoService) *Handler {
 	}
 }
 
+// SetReceiptPolicy configures the checks POST /sign-receipt applies before signing;
+// identify resolves the VKN of the requesting register
+func (h *Handler) SetReceiptPolicy(policy receipt.Policy, identify func(r *http.Request, clientIP string) (string, string)) {
+	h.policy = policy
+	h.identify = identify
+}
+
 func (h *Handler) SignHash(c *gin.Context) {
 	var req models.SignRequest
 	
@@ -29,7 +43,53 @@ func (h *Handler) SignHash(c *gin.Context) {
 		return
 	}
 
-	signature, err := h.cryptoService.SignHash(req.Hash)
+	h.sign(c, req.Hash, req.Timestamp)
+}
+
+// SetSigningPool bounds concurrent signing; without one every request signs in its own goroutine
+func (h *Handler) SetSigningPool(pool *signing.Pool) {
+	h.pool = pool
+}
+
+// RefuseHashSigning answers POST /sign when the authority only signs checked receipts
+func (h *Handler) RefuseHashSigning(c *gin.Context) {
+	c.JSON(http.StatusForbidden, models.ErrorResponse{
+		Error: "Blind hash signing is disabled; submit the receipt to /sign-receipt",
+	})
+}
+
+// sign writes the signature (and optional timestamp token) for a base64 SHA-256 hash
+func (h *Handler) sign(c *gin.Context, hashBase64 string, withTimestamp bool) {
+	var signature, token string
+	var signedAt time.Time
+	var err, tokenErr error
+	poolErr := h.run(c, func() {
+		signature, err = h.cryptoService.SignHash(hashBase64)
+		if err == nil && withTimestamp {
+			signedAt = time.Now().UTC()
+			token, tokenErr = h.cryptoService.SignTimestamp(hashBase64, signedAt)
+		}
+	})
+	if poolErr != nil {
+		// Shed load rather than queue without bound; registers retry later
+		message := "Signing capacity exceeded, retry later"
+		if errors.Is(poolErr, signing.ErrTimeout) {
+			message = "Signing timed out, retry later"
+		}
+		c.Error(poolErr)
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error: message,
+		})
+		return
+	}
+
+	if errors.Is(err, crypto.ErrKeyUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error: "Signing key not available",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
 			Error: err.Error(),
@@ -37,13 +97,41 @@ func (h *Handler) SignHash(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, models.SignResponse{
+	response := models.SignResponse{
 		Signature: signature,
-	})
+	}
+
+	if withTimestamp {
+		if tokenErr != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to issue timestamp token",
+			})
+			return
+		}
+		response.TimestampToken = token
+		response.SignedAt = signedAt.Format(time.RFC3339)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// run signs on the pool when one is set, else right away
+func (h *Handler) run(c *gin.Context, fn func()) error {
+	if h.pool == nil {
+		fn()
+		return nil
+	}
+	return h.pool.Do(c.Request.Context(), fn)
 }
 
 func (h *Handler) GetPublicKey(c *gin.Context) {
 	publicKey, err := h.cryptoService.GetPublicKeyBase64()
+	if errors.Is(err, crypto.ErrKeyUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error: "Signing key not available",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to retrieve public key",
@@ -51,7 +139,28 @@ func (h *Handler) GetPublicKey(c *gin.Context) {
 		return
 	}
 
+	// Registers refresh the key periodically; an unchanged key costs them a 304
+	etag := publicKeyETag(publicKey)
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
 	c.JSON(http.StatusOK, models.PublicKeyResponse{
 		PublicKey: publicKey,
 	})
-}
\ No newline at end of file
+}
+
+// GetCertificate serves the signing certificate and its intermediates as a PEM chain
+func (h *Handler) GetCertificate(c *gin.Context) {
+	chain := h.cryptoService.CertificateChainPEM()
+	if len(chain) == 0 {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "No signing certificate configured",
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/pem-certificate-chain", chain)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"revenue-authority-receipt-service/crypto"
+	"revenue-authority-receipt-service/health"
+	"revenue-authority-receipt-service/models"
+	"revenue-authority-receipt-service/signing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	cryptoService *crypto.CryptoService
+	monitor       *health.Monitor
+	maxErrorRate  float64 // 0 disables error-rate gating
+	minRequests   int     // Requests needed before the error rate counts
+	pool          *signing.Pool
+}
+
+func NewHealthHandler(cryptoService *crypto.CryptoService, monitor *health.Monitor, maxErrorRate float64, minRequests int) *HealthHandler {
+	return &HealthHandler{
+		cryptoService: cryptoService,
+		monitor:       monitor,
+		maxErrorRate:  maxErrorRate,
+		minRequests:   minRequests,
+	}
+}
+
+// SetSigningPool adds the signing worker pool's load to /health
+func (h *HealthHandler) SetSigningPool(pool *signing.Pool) {
+	h.pool = pool
+}
+
+// Health reports liveness details; it answers 200 whenever the process is serving
+func (h *HealthHandler) Health(c *gin.Context) {
+	status := "healthy"
+	if len(h.notReadyReasons()) > 0 {
+		status = "degraded"
+	}
+
+	response := models.HealthResponse{
+		Status:        status,
+		Service:       "revenue-authority-receipt-service",
+		UptimeSeconds: int64(h.monitor.Uptime().Seconds()),
+		StartedAt:     h.monitor.StartedAt().UTC().Format(time.RFC3339),
+		Key:           h.keyStatus(),
+		Requests:      h.errorRate(),
+	}
+	if h.pool != nil {
+		pool := h.pool.Stats()
+		response.Signing = &models.SigningPoolResponse{
+			Workers:   pool.Workers,
+			QueueSize: pool.QueueSize,
+			Busy:      pool.Busy,
+			Queued:    pool.Queued,
+			Completed: pool.Completed,
+			Rejected:  pool.Rejected,
+			TimedOut:  pool.TimedOut,
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Ready answers 503 while the service should not receive signing traffic
+func (h *HealthHandler) Ready(c *gin.Context) {
+	reasons := h.notReadyReasons()
+	if len(reasons) > 0 {
+		c.JSON(http.StatusServiceUnavailable, models.ReadyResponse{Ready: false, Reasons: reasons})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ReadyResponse{Ready: true})
+}
+
+func (h *HealthHandler) notReadyReasons() []string {
+	var reasons []string
+
+	key := h.cryptoService.KeyStatus()
+	if !key.Loaded && key.Error != "" {
+		reasons = append(reasons, "signing key not loaded: "+key.Error)
+	} else if !key.Loaded {
+		reasons = append(reasons, "signing key not loaded")
+	} else if !key.KeyPairMatch {
+		reasons = append(reasons, "private key does not match public key")
+	}
+	if key.CertificateExpiry != nil && time.Now().After(*key.CertificateExpiry) {
+		reasons = append(reasons, "signing certificate expired")
+	}
+
+	stats := h.monitor.Stats()
+	if h.maxErrorRate > 0 && stats.Requests >= h.minRequests && stats.ErrorRate() > h.maxErrorRate {
+		reasons = append(reasons, fmt.Sprintf("error rate %.1f%% exceeds %.1f%%", stats.ErrorRate()*100, h.maxErrorRate*100))
+	}
+
+	return reasons
+}
+
+func (h *HealthHandler) keyStatus() models.KeyStatusResponse {
+	key := h.cryptoService.KeyStatus()
+	response := models.KeyStatusResponse{
+		Loaded:       key.Loaded,
+		KeyPairMatch: key.KeyPairMatch,
+		Fingerprint:  key.Fingerprint,
+		Error:        key.Error,
+		Ephemeral:    key.Ephemeral,
+	}
+	if key.CertificateExpiry != nil {
+		response.CertificateExpiry = key.CertificateExpiry.UTC().Format(time.RFC3339)
+		response.ExpiresInSeconds = int64(time.Until(*key.CertificateExpiry).Seconds())
+	}
+	return response
+}
+
+func (h *HealthHandler) errorRate() models.ErrorRateResponse {
+	stats := h.monitor.Stats()
+	return models.ErrorRateResponse{
+		WindowSeconds: int64(stats.Window.Seconds()),
+		Requests:      stats.Requests,
+		ClientErrors:  stats.ClientErrors,
+		ServerErrors:  stats.ServerErrors,
+		ErrorRate:     stats.ErrorRate(),
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"receiptwallet/authority"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// OpenAPIHandler serves the API description shared with the Go client
+// (receiptwallet/authority), as YAML and converted to JSON
+type OpenAPIHandler struct {
+	json []byte
+}
+
+// NewOpenAPIHandler converts the document to JSON once, failing if it is not valid YAML
+func NewOpenAPIHandler() (*OpenAPIHandler, error) {
+	var document any
+	if err := yaml.Unmarshal(authority.OpenAPI, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %v", err)
+	}
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert OpenAPI document to JSON: %v", err)
+	}
+	return &OpenAPIHandler{json: data}, nil
+}
+
+// YAML serves GET /openapi.yaml
+func (h *OpenAPIHandler) YAML(c *gin.Context) {
+	c.Data(http.StatusOK, "application/yaml", authority.OpenAPI)
+}
+
+// JSON serves GET /openapi.json
+func (h *OpenAPIHandler) JSON(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", h.json)
+}
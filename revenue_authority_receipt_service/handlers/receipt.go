@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"revenue-authority-receipt-service/models"
+	"revenue-authority-receipt-service/receipt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SignReceipt checks a receipt before signing it: the authority parses the binary receipt
+// and signs its SHA-256 itself, so it never signs bytes it has not checked.
+func (h *Handler) SignReceipt(c *gin.Context) {
+	var req models.SignReceiptRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid request format",
+		})
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(req.Receipt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "receipt must be valid base64",
+		})
+		return
+	}
+	summary, err := receipt.Parse(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+	hash := sha256.Sum256(data)
+	hashBase64 := base64.StdEncoding.EncodeToString(hash[:])
+
+	var requesterVKN string
+	if h.identify != nil {
+		_, requesterVKN = h.identify(c.Request, c.ClientIP())
+	}
+
+	if err := h.policy.Check(summary, requesterVKN, time.Now()); err != nil {
+		log.Printf("Refused to sign receipt from VKN %s: %v", summary.VKN, err)
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, receipt.ErrUnidentified):
+			status = http.StatusUnauthorized
+		case errors.Is(err, receipt.ErrImplausible):
+			status = http.StatusUnprocessableEntity
+		}
+		c.JSON(status, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	h.sign(c, hashBase64, req.Timestamp)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+
+	"revenue-authority-receipt-service/crypto"
+	"revenue-authority-receipt-service/models"
+	"revenue-authority-receipt-service/signing"
+
+	rwcrypto "receiptwallet/crypto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bufferedWriter holds the response body back until it has been signed
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// SignResponses signs every response of the routes it wraps, errors included, over the
+// client's X-Response-Nonce, path, status and body. The signature goes in
+// X-Response-Signature; a register that pins the authority key can then detect a
+// man in the middle swapping signatures or keys even on plain HTTP.
+// The signature is made on pool like any other, so a signed /sign costs two jobs; when
+// the pool sheds it the response is replaced by an unsigned 503.
+func SignResponses(cryptoService *crypto.CryptoService, pool *signing.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		nonce := c.GetHeader(rwcrypto.ResponseNonceHeader)
+		if len(nonce) > rwcrypto.MaxResponseNonceLength {
+			// Signed without it, so the client sees a signature that doesn't verify
+			nonce = ""
+		}
+
+		writer := &bufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		body := writer.body.Bytes()
+		var signature string
+		var err error
+		sign := func() {
+			signature, err = cryptoService.SignResponse(nonce, c.Request.URL.Path, writer.Status(), body)
+		}
+		if pool == nil {
+			sign()
+		} else if poolErr := pool.Do(c.Request.Context(), sign); poolErr != nil {
+			message := "Signing capacity exceeded, retry later"
+			if errors.Is(poolErr, signing.ErrTimeout) {
+				message = "Signing timed out, retry later"
+			}
+			c.Error(poolErr)
+			c.Header("Retry-After", "1")
+			c.Header("ETag", "") // Removes the handler's
+			c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+				Error: message,
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to sign response for %s: %v", c.Request.URL.Path, err)
+		} else {
+			c.Header(rwcrypto.ResponseSignatureHeader, signature)
+		}
+
+		c.Writer.WriteHeaderNow()
+		c.Writer.Write(body)
+	}
+}
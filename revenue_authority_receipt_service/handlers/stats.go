@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"regexp"
+	"time"
+
+	"revenue-authority-receipt-service/models"
+	"revenue-authority-receipt-service/stats"
+
+	"github.com/gin-gonic/gin"
+)
+
+// vknPattern accepts 10-digit tax numbers and 11-digit TC identity numbers
+var vknPattern = regexp.MustCompile(`^[0-9]{10,11}$`)
+
+// AdminTokenHeader carries the token for monitoring endpoints
+const AdminTokenHeader = "X-Admin-Token"
+
+type StatsHandler struct {
+	tracker *stats.Tracker
+}
+
+func NewStatsHandler(tracker *stats.Tracker) *StatsHandler {
+	return &StatsHandler{
+		tracker: tracker,
+	}
+}
+
+// AdminAuth rejects requests without the configured admin token; with no token configured
+// every request is rejected
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided := c.GetHeader(AdminTokenHeader)
+		if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error: "Invalid or missing admin token",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// VKNStats reports daily signature counts and anomalies for one VKN
+func (h *StatsHandler) VKNStats(c *gin.Context) {
+	vkn := c.Param("vkn")
+	if !vknPattern.MatchString(vkn) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "vkn must be 10 or 11 digits",
+		})
+		return
+	}
+
+	summary, found := h.tracker.Summary(vkn)
+	if !found {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "No signatures recorded for this VKN",
+		})
+		return
+	}
+
+	response := models.VKNStatsResponse{
+		VKN:                  summary.VKN,
+		Today:                dailyCount(summary.Today),
+		BaselineDailyAverage: summary.Baseline,
+		TotalSignatures:      summary.Total,
+		Days:                 make([]models.DailyCountResponse, len(summary.Days)),
+		Anomalies:            make([]models.AnomalyResponse, len(summary.Anomalies)),
+	}
+	for i, day := range summary.Days {
+		response.Days[i] = dailyCount(day)
+	}
+	for i, anomaly := range summary.Anomalies {
+		response.Anomalies[i] = models.AnomalyResponse{
+			Flag:      anomaly.Flag,
+			Date:      anomaly.Date,
+			FirstSeen: anomaly.FirstSeen.Format(time.RFC3339),
+			Detail:    anomaly.Detail,
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func dailyCount(day stats.Day) models.DailyCountResponse {
+	return models.DailyCountResponse{
+		Date:       day.Date,
+		Signatures: day.Signatures,
+		Flagged:    day.Flagged,
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"revenue-authority-receipt-service/crypto"
+	"revenue-authority-receipt-service/models"
+
+	"receiptwallet/trustbundle"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrustBundleHandler serves the signed trust bundle wallets embed to verify receipts offline
+type TrustBundleHandler struct {
+	cryptoService *crypto.CryptoService
+	options       crypto.TrustBundleOptions
+}
+
+func NewTrustBundleHandler(cryptoService *crypto.CryptoService, options crypto.TrustBundleOptions) *TrustBundleHandler {
+	return &TrustBundleHandler{
+		cryptoService: cryptoService,
+		options:       options,
+	}
+}
+
+// TrustBundle signs a fresh bundle with the current key, so a rotation shows up at once
+func (h *TrustBundleHandler) TrustBundle(c *gin.Context) {
+	bundle, err := h.cryptoService.TrustBundle(h.options, time.Now())
+	if errors.Is(err, crypto.ErrKeyUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error: "Signing key not available",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to build trust bundle: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to build trust bundle",
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, trustbundle.ContentType, bundle)
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"revenue-authority-receipt-service/crypto"
+	"revenue-authority-receipt-service/models"
+	"revenue-authority-receipt-service/stats"
+	"revenue-authority-receipt-service/zreport"
+
+	"github.com/gin-gonic/gin"
+)
+
+// zReportDateLayout is the business day format of summaries and reconciliation
+const zReportDateLayout = "2006-01-02"
+
+type ZReportHandler struct {
+	ledger           *zreport.Ledger
+	tracker          *stats.Tracker
+	identify         func(r *http.Request, clientIP string) (string, string)
+	registerKeys     map[string]*ecdsa.PublicKey // key: VKN
+	requireSignature bool
+}
+
+// NewZReportHandler creates the Z-report handler; identify resolves the VKN of the
+// requesting register, which must match the report's VKN and is the only proof
+// accepted for an unsigned report, and
+// tracker supplies the signatures issued when a day is reconciled
+func NewZReportHandler(ledger *zreport.Ledger, tracker *stats.Tracker, identify func(r *http.Request, clientIP string) (string, string)) *ZReportHandler {
+	return &ZReportHandler{
+		ledger:   ledger,
+		tracker:  tracker,
+		identify: identify,
+	}
+}
+
+// SetRegisterKeys sets the public keys registers sign their summaries with. A VKN with a
+// key must sign; with requireSignature, summaries from VKNs without a key are refused.
+func (h *ZReportHandler) SetRegisterKeys(keys map[string]*ecdsa.PublicKey, requireSignature bool) {
+	h.registerKeys = keys
+	h.requireSignature = requireSignature
+}
+
+// SubmitZReport records a cash register's end-of-day summary
+func (h *ZReportHandler) SubmitZReport(c *gin.Context) {
+	var req models.ZReportRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid request format",
+		})
+		return
+	}
+
+	var summary models.ZReportSummary
+	if err := json.Unmarshal(req.Summary, &summary); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "summary must be a JSON object",
+		})
+		return
+	}
+
+	report, err := parseZReport(&summary)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	_, requesterVKN := h.identify(c.Request, c.ClientIP())
+	if requesterVKN != "" && requesterVKN != report.VKN {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error: "Z-report VKN does not match the requesting register",
+		})
+		return
+	}
+
+	// The signature covers the summary bytes exactly as sent
+	if key, registered := h.registerKeys[report.VKN]; registered {
+		digest := sha256.Sum256(req.Summary)
+		if req.Signature == "" || !crypto.VerifySignature(key, digest[:], req.Signature) {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error: "Z-report signature does not verify against the register's key",
+			})
+			return
+		}
+		report.Signed = true
+	} else if h.requireSignature {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "No register key on file for this VKN",
+		})
+		return
+	}
+
+	// An unsigned report must come from the register itself: anyone else could claim a
+	// high number for the VKN and the ledger would refuse its real reports as out of order
+	if !report.Signed && requesterVKN == "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Unsigned Z-reports need the register's API key or client certificate",
+		})
+		return
+	}
+
+	if err := h.ledger.Record(report); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, zreport.ErrDuplicate) || errors.Is(err, zreport.ErrOutOfOrder) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	log.Printf("Recorded Z%04d for VKN %s on %s: %d receipts, total %.2f (signed: %v)",
+		report.Number, report.VKN, report.Date, report.ReceiptCount, report.TotalAmount, report.Signed)
+
+	c.JSON(http.StatusOK, zReportResponse(report))
+}
+
+// ZReports lists the Z-reports recorded for one VKN
+func (h *ZReportHandler) ZReports(c *gin.Context) {
+	vkn := c.Param("vkn")
+	if !vknPattern.MatchString(vkn) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "vkn must be 10 or 11 digits",
+		})
+		return
+	}
+
+	reports := h.ledger.List(vkn)
+	response := make([]models.ZReportResponse, len(reports))
+	for i, report := range reports {
+		response[i] = zReportResponse(report)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Reconcile sets the Z-reports a VKN declared for a day against the signatures issued to it
+func (h *ZReportHandler) Reconcile(c *gin.Context) {
+	vkn := c.Param("vkn")
+	if !vknPattern.MatchString(vkn) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "vkn must be 10 or 11 digits",
+		})
+		return
+	}
+	date := c.Param("date")
+	if _, err := time.Parse(zReportDateLayout, date); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "date must be YYYY-MM-DD",
+		})
+		return
+	}
+
+	response := models.ReconciliationResponse{
+		VKN:     vkn,
+		Date:    date,
+		Reports: []models.ZReportResponse{},
+	}
+	for _, report := range h.ledger.ForDate(vkn, date) {
+		response.Reports = append(response.Reports, zReportResponse(report))
+		response.DeclaredReceipts += report.ReceiptCount
+		response.DeclaredTotal += report.TotalAmount
+	}
+	if day, ok := h.tracker.Day(vkn, date); ok {
+		response.SignaturesIssued = day.Signatures
+	}
+	response.Difference = response.SignaturesIssued - response.DeclaredReceipts
+
+	c.JSON(http.StatusOK, response)
+}
+
+func parseZReport(req *models.ZReportSummary) (zreport.Report, error) {
+	report := zreport.Report{
+		VKN:           req.VKN,
+		Date:          req.Date,
+		ReceiptCount:  req.ReceiptCount,
+		FirstSerial:   req.FirstSerial,
+		LastSerial:    req.LastSerial,
+		TotalAmount:   req.TotalAmount,
+		TotalTax:      req.TotalTax,
+		PaymentTotals: req.PaymentTotals,
+		ReceivedAt:    time.Now().UTC(),
+	}
+
+	if !vknPattern.MatchString(req.VKN) {
+		return report, fmt.Errorf("vkn must be 10 or 11 digits")
+	}
+	if _, err := time.Parse(zReportDateLayout, req.Date); err != nil {
+		return report, fmt.Errorf("date must be YYYY-MM-DD")
+	}
+	if _, err := fmt.Sscanf(req.ZReportNumber, "Z%d", &report.Number); err != nil || report.Number <= 0 {
+		return report, fmt.Errorf("z_report_number must look like Z0001")
+	}
+
+	var err error
+	if report.OpenedAt, err = time.Parse(time.RFC3339, req.OpenedAt); err != nil {
+		return report, fmt.Errorf("opened_at must be an RFC 3339 timestamp")
+	}
+	if report.ClosedAt, err = time.Parse(time.RFC3339, req.ClosedAt); err != nil {
+		return report, fmt.Errorf("closed_at must be an RFC 3339 timestamp")
+	}
+	if report.ClosedAt.Before(report.OpenedAt) {
+		return report, fmt.Errorf("closed_at is before opened_at")
+	}
+	if report.ReceiptCount < 0 || report.TotalAmount < 0 || report.TotalTax < 0 {
+		return report, fmt.Errorf("receipt_count and totals must not be negative")
+	}
+
+	for _, t := range req.TaxTotals {
+		if t.Rate < 0 || t.TaxableAmount < 0 || t.TaxAmount < 0 {
+			return report, fmt.Errorf("tax_totals must not be negative")
+		}
+		report.TaxTotals = append(report.TaxTotals, zreport.TaxTotal{Rate: t.Rate, TaxableAmount: t.TaxableAmount, TaxAmount: t.TaxAmount})
+	}
+
+	return report, nil
+}
+
+func zReportResponse(report zreport.Report) models.ZReportResponse {
+	taxTotals := make([]models.TaxTotal, len(report.TaxTotals))
+	for i, t := range report.TaxTotals {
+		taxTotals[i] = models.TaxTotal{Rate: t.Rate, TaxableAmount: t.TaxableAmount, TaxAmount: t.TaxAmount}
+	}
+
+	return models.ZReportResponse{
+		VKN:           report.VKN,
+		Date:          report.Date,
+		ZReportNumber: fmt.Sprintf("Z%04d", report.Number),
+		OpenedAt:      report.OpenedAt.Format(time.RFC3339),
+		ClosedAt:      report.ClosedAt.Format(time.RFC3339),
+		ReceiptCount:  report.ReceiptCount,
+		FirstSerial:   report.FirstSerial,
+		LastSerial:    report.LastSerial,
+		TotalAmount:   report.TotalAmount,
+		TotalTax:      report.TotalTax,
+		TaxTotals:     taxTotals,
+		PaymentTotals: report.PaymentTotals,
+		Signed:        report.Signed,
+		ReceivedAt:    report.ReceivedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"revenue-authority-receipt-service/stats"
+	"revenue-authority-receipt-service/zreport"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testVKN       = "1234567890"
+	signedVKN     = "9876543210"
+	testAPIKey    = "register-key"
+	apiKeyHeader  = "X-API-Key"
+	zReportTarget = "/zreport"
+)
+
+// testIdentify stands in for quota.Limiter.Identify: only testAPIKey names a VKN
+func testIdentify(r *http.Request, clientIP string) (string, string) {
+	if r.Header.Get(apiKeyHeader) == testAPIKey {
+		return "key:" + testAPIKey, testVKN
+	}
+	return "ip:" + clientIP, ""
+}
+
+func newZReportRouter(t *testing.T) (*gin.Engine, *ecdsa.PrivateKey) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	registerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewZReportHandler(zreport.NewLedger(), stats.NewTracker(stats.Thresholds{}, 30), testIdentify)
+	h.SetRegisterKeys(map[string]*ecdsa.PublicKey{signedVKN: &registerKey.PublicKey}, false)
+
+	router := gin.New()
+	router.POST(zReportTarget, h.SubmitZReport)
+	return router, registerKey
+}
+
+// postZReport submits report number n for vkn, signed when key is set
+func postZReport(t *testing.T, router http.Handler, vkn string, n int, key *ecdsa.PrivateKey, apiKey string) int {
+	t.Helper()
+	summary := fmt.Sprintf(`{"vkn":%q,"date":"2026-10-16","z_report_number":"Z%04d",`+
+		`"opened_at":"2026-10-16T08:00:00Z","closed_at":"2026-10-16T22:00:00Z","receipt_count":1,`+
+		`"total_amount":10,"total_tax":1}`, vkn, n)
+	body := map[string]interface{}{"summary": json.RawMessage(summary)}
+	if key != nil {
+		digest := sha256.Sum256([]byte(summary))
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		body["signature"] = base64.StdEncoding.EncodeToString(signature)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, zReportTarget, bytes.NewReader(data))
+	if apiKey != "" {
+		req.Header.Set(apiKeyHeader, apiKey)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestSubmitZReportNeedsProof(t *testing.T) {
+	router, registerKey := newZReportRouter(t)
+
+	// An anonymous caller can't claim a number for a VKN without a key on file
+	if code := postZReport(t, router, testVKN, 9999, nil, ""); code != http.StatusUnauthorized {
+		t.Errorf("Anonymous unsigned Z9999: got %d, want 401", code)
+	}
+	if code := postZReport(t, router, testVKN, 1, nil, testAPIKey); code != http.StatusOK {
+		t.Errorf("Unsigned Z0001 from the register: got %d, want 200", code)
+	}
+	if code := postZReport(t, router, signedVKN, 1, nil, testAPIKey); code != http.StatusForbidden {
+		t.Errorf("Report for another VKN: got %d, want 403", code)
+	}
+
+	// A VKN with a key on file must sign, and a valid signature needs no API key
+	if code := postZReport(t, router, signedVKN, 1, nil, ""); code != http.StatusUnauthorized {
+		t.Errorf("Unsigned report for a VKN with a key: got %d, want 401", code)
+	}
+	if code := postZReport(t, router, signedVKN, 1, registerKey, ""); code != http.StatusOK {
+		t.Errorf("Signed report: got %d, want 200", code)
+	}
+
+	// The refused Z9999 left the ordering alone
+	if code := postZReport(t, router, testVKN, 2, nil, testAPIKey); code != http.StatusOK {
+		t.Errorf("Z0002 after a refused Z9999: got %d, want 200", code)
+	}
+}
@@ -0,0 +1,115 @@
+package health
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stats summarizes requests seen within the monitoring window
+type Stats struct {
+	Window       time.Duration
+	Requests     int
+	ClientErrors int // 4xx
+	ServerErrors int // 5xx
+}
+
+// ErrorRate is the share of requests that failed with a server error
+func (s Stats) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.ServerErrors) / float64(s.Requests)
+}
+
+type bucket struct {
+	minute       int64 // unix minute
+	requests     int
+	clientErrors int
+	serverErrors int
+}
+
+// Monitor tracks uptime and per-minute request outcomes over a sliding window
+type Monitor struct {
+	mu      sync.Mutex
+	started time.Time
+	window  time.Duration
+	buckets []bucket
+	now     func() time.Time
+}
+
+func NewMonitor(window time.Duration) *Monitor {
+	if window < time.Minute {
+		window = time.Minute
+	}
+	return &Monitor{
+		started: time.Now(),
+		window:  window,
+		buckets: make([]bucket, int(window/time.Minute)),
+		now:     time.Now,
+	}
+}
+
+// Middleware records the status of every request it wraps except those to the exclude
+// routes, so probes polling /health and /ready don't dilute the error rate
+func (m *Monitor) Middleware(exclude ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(exclude))
+	for _, route := range exclude {
+		skip[route] = true
+	}
+	return func(c *gin.Context) {
+		c.Next()
+		if skip[c.FullPath()] {
+			return
+		}
+		m.Record(c.Writer.Status())
+	}
+}
+
+// Record counts one request with the given HTTP status
+func (m *Monitor) Record(status int) {
+	minute := m.now().Unix() / 60
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := &m.buckets[minute%int64(len(m.buckets))]
+	if b.minute != minute {
+		*b = bucket{minute: minute}
+	}
+	b.requests++
+	switch {
+	case status >= 500:
+		b.serverErrors++
+	case status >= 400:
+		b.clientErrors++
+	}
+}
+
+// Stats returns totals over the monitoring window
+func (m *Monitor) Stats() Stats {
+	oldest := m.now().Unix()/60 - int64(len(m.buckets)) + 1
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := Stats{Window: m.window}
+	for _, b := range m.buckets {
+		if b.minute < oldest {
+			continue
+		}
+		stats.Requests += b.requests
+		stats.ClientErrors += b.clientErrors
+		stats.ServerErrors += b.serverErrors
+	}
+	return stats
+}
+
+func (m *Monitor) StartedAt() time.Time {
+	return m.started
+}
+
+func (m *Monitor) Uptime() time.Duration {
+	return m.now().Sub(m.started)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"revenue-authority-receipt-service/crypto"
+)
+
+// keyFile is one file written by keygen
+type keyFile struct {
+	name    string
+	private bool
+	data    func(*crypto.GeneratedKeys) []byte
+}
+
+// runKeygen implements `revenue-authority keygen`: it writes a fresh signing key pair,
+// and optionally a self-signed certificate, under the names config.yaml expects, so a
+// new install can start without running openssl first
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	outDir := fs.String("out-dir", "keys", "Directory for private_key.pem, public_key.pem and certificate.pem")
+	force := fs.Bool("force", false, "Replace existing key files")
+	cert := fs.Bool("cert", false, "Also write a self-signed certificate.pem (set keys.certificate_path to serve it at /certificate)")
+	commonName := fs.String("common-name", "Revenue Authority Receipt Signing", "Certificate subject common name")
+	days := fs.Int("days", 365, "Certificate validity in days")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s keygen [flags]\n\nGenerates a P-256 signing key pair in PEM form.\n\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if *cert && *days <= 0 {
+		return fmt.Errorf("-days must be positive")
+	}
+
+	files := []keyFile{
+		{"private_key.pem", true, func(k *crypto.GeneratedKeys) []byte { return k.PrivateKeyPEM }},
+		{"public_key.pem", false, func(k *crypto.GeneratedKeys) []byte { return k.PublicKeyPEM }},
+	}
+	if *cert {
+		files = append(files, keyFile{"certificate.pem", false, func(k *crypto.GeneratedKeys) []byte { return k.CertificatePEM }})
+	}
+
+	// Refuse before writing anything, so a half-replaced key pair can't happen. A
+	// certificate left from an earlier key counts even without -cert: it would no
+	// longer match the key.
+	certPath := filepath.Join(*outDir, "certificate.pem")
+	if !*force {
+		for _, f := range files {
+			if _, err := os.Stat(filepath.Join(*outDir, f.name)); err == nil {
+				return fmt.Errorf("%s already exists; pass -force to replace the key pair", filepath.Join(*outDir, f.name))
+			}
+		}
+		if _, err := os.Stat(certPath); err == nil {
+			return fmt.Errorf("%s already exists; pass -force to replace the key pair", certPath)
+		}
+	}
+
+	var validity time.Duration
+	if *cert {
+		validity = time.Duration(*days) * 24 * time.Hour
+	}
+	keys, err := crypto.GenerateKeys(*commonName, validity)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*outDir, 0700); err != nil {
+		return err
+	}
+	for _, f := range files {
+		path := filepath.Join(*outDir, f.name)
+		if err := crypto.WriteKeyFile(path, f.data(keys), f.private, *force); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+	if !*cert {
+		if err := os.Remove(certPath); err == nil {
+			fmt.Printf("Removed %s, which certified the replaced key\n", certPath)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s certifying the replaced key: %v", certPath, err)
+		}
+	}
+	fmt.Printf("Public key fingerprint: %s\n", keys.Fingerprint)
+	return nil
+}
@@ -1,28 +1,91 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"revenue-authority-receipt-service/config"
 	"revenue-authority-receipt-service/crypto"
+	"revenue-authority-receipt-service/devices"
 	"revenue-authority-receipt-service/handlers"
+	"revenue-authority-receipt-service/health"
+	"revenue-authority-receipt-service/metrics"
+	"revenue-authority-receipt-service/quota"
+	"revenue-authority-receipt-service/receipt"
+	"revenue-authority-receipt-service/signing"
+	"revenue-authority-receipt-service/stats"
+	"revenue-authority-receipt-service/zreport"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "keygen" {
+		if err := runKeygen(os.Args[2:]); err != nil {
+			if err != flag.ErrHelp {
+				log.Fatalf("keygen: %v", err)
+			}
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "trust-bundle" {
+		if err := runTrustBundle(os.Args[2:]); err != nil {
+			if err != flag.ErrHelp {
+				log.Fatalf("trust-bundle: %v", err)
+			}
+		}
+		return
+	}
+
+	ephemeralKeys := flag.Bool("ephemeral-keys", false, "Sign with a key pair generated in memory instead of the key files (tests and demos)")
+	flag.Parse()
+
 	// Load configuration
 	cfg := config.Load()
+	if *ephemeralKeys {
+		cfg.Keys.Ephemeral = true
+	}
 
-	// Initialize crypto service
-	cryptoService := crypto.NewCryptoService(
-		cfg.Keys.PrivateKeyPath,
-		cfg.Keys.PublicKeyPath,
-	)
+	var cryptoService *crypto.CryptoService
+	if cfg.Keys.Ephemeral {
+		cryptoService = newEphemeralCryptoService()
+	} else {
+		cryptoService = newFileCryptoService(cfg)
+	}
+
+	// Request outcomes for health reporting
+	monitor := health.NewMonitor(time.Duration(cfg.Health.ErrorWindowMinutes) * time.Minute)
+
+	// Per-VKN signature counters and anomaly flags
+	tracker := stats.NewTracker(stats.Thresholds{
+		SpikeFactor:  cfg.Monitoring.Anomalies.SpikeFactor,
+		BaselineDays: cfg.Monitoring.Anomalies.BaselineDays,
+		MinVolume:    cfg.Monitoring.Anomalies.MinVolume,
+		DailyLimit:   cfg.Monitoring.Anomalies.DailyLimit,
+	}, cfg.Monitoring.RetentionDays)
 
 	// Initialize handlers
 	handler := handlers.NewHandler(cryptoService)
+	statsHandler := handlers.NewStatsHandler(tracker)
+	healthHandler := handlers.NewHealthHandler(cryptoService, monitor, cfg.Health.MaxErrorRate, cfg.Health.MinRequests)
+
+	// Bounded signing: a burst beyond the workers and queue is refused with 503
+	signingPool := signing.NewPool(signing.Options{
+		Workers:   cfg.Signing.Workers,
+		QueueSize: cfg.Signing.QueueSize,
+		Timeout:   time.Duration(cfg.Signing.RequestTimeoutMs) * time.Millisecond,
+	})
+	handler.SetSigningPool(signingPool)
+	healthHandler.SetSigningPool(signingPool)
+	poolStats := signingPool.Stats()
+	log.Printf("Signing with %d workers, queue of %d", poolStats.Workers, poolStats.QueueSize)
 
 	// Set up Gin router with logging based on verbose config
 	var router *gin.Engine
@@ -35,10 +98,123 @@ func main() {
 		router = gin.New() // No default middleware in production
 		router.Use(gin.Recovery()) // Still use recovery middleware for safety
 	}
+	router.Use(monitor.Middleware("/health", "/ready"))
+
+	// Prometheus metrics; the middleware must wrap every route, so it goes before them
+	if cfg.Metrics.Enabled {
+		requestMetrics := metrics.NewMetrics(cryptoService)
+		requestMetrics.SetSigningPool(signingPool)
+		router.Use(requestMetrics.Middleware())
+		router.GET("/metrics", requestMetrics.Handler)
+		log.Printf("Prometheus metrics enabled at /metrics")
+	}
 
 	// Define routes
-	router.POST("/sign", handler.SignHash)
-	router.GET("/public-key", handler.GetPublicKey)
+	// The limiter also resolves the requesting VKN for monitoring when quotas are off
+	limiter := newQuotaLimiter(cfg)
+	// Responses carrying signatures or keys are signed first, so refusals are signed too
+	var keyMiddleware []gin.HandlerFunc
+	if cfg.Signing.SignResponses {
+		keyMiddleware = append(keyMiddleware, handlers.SignResponses(cryptoService, signingPool))
+		log.Printf("Response signing enabled for signing and key endpoints")
+	}
+	signMiddleware := append([]gin.HandlerFunc{}, keyMiddleware...)
+	if cfg.Quota.Enabled {
+		signMiddleware = append(signMiddleware, limiter.Middleware())
+		log.Printf("Signing quota enabled: %d/minute, %d/day (%d overrides)",
+			cfg.Quota.PerMinute, cfg.Quota.PerDay, len(cfg.Quota.Overrides))
+	}
+
+	signMiddleware = append(signMiddleware, tracker.Middleware(limiter.Identify))
+
+	if cfg.Signing.RequireReceipt {
+		if !cfg.Signing.ReceiptEndpoint {
+			log.Fatalf("signing.require_receipt needs signing.receipt_endpoint")
+		}
+		router.POST("/sign", append(keyMiddleware, handler.RefuseHashSigning)...)
+	} else {
+		router.POST("/sign", append(signMiddleware, handler.SignHash)...)
+	}
+
+	// Checked signing: the receipt's VKN, total, timestamp and serial must be plausible
+	if cfg.Signing.ReceiptEndpoint {
+		handler.SetReceiptPolicy(receipt.Policy{
+			TimestampTolerance: time.Duration(cfg.Signing.TimestampToleranceSeconds) * time.Second,
+			MaxTotalKurus:      uint64(cfg.Signing.MaxTotal * 100),
+		}, limiter.Identify)
+		router.POST("/sign-receipt", append(signMiddleware, handler.SignReceipt)...)
+	}
+	router.GET("/public-key", append(keyMiddleware, handler.GetPublicKey)...)
+	router.GET("/certificate", append(keyMiddleware, handler.GetCertificate)...)
+	router.GET("/stats/:vkn", handlers.AdminAuth(cfg.Monitoring.AdminToken), statsHandler.VKNStats)
+
+	// Signed key list for wallets that verify offline; it is self-signed, so no response signing
+	if cfg.TrustBundle.Endpoint {
+		options, err := trustBundleOptions(cfg)
+		if err != nil {
+			log.Fatalf("Invalid trust_bundle configuration: %v", err)
+		}
+		router.GET("/trust-bundle", handlers.NewTrustBundleHandler(cryptoService, options).TrustBundle)
+		log.Printf("Trust bundle enabled at /trust-bundle (%d retired keys, valid for %d days)",
+			len(options.RetiredKeys), cfg.TrustBundle.ValidityDays)
+	}
+
+	// End-of-day Z-report summaries declared by cash registers
+	zReportHandler := handlers.NewZReportHandler(zreport.NewLedger(), tracker, limiter.Identify)
+	registerKeys := make(map[string]*ecdsa.PublicKey, len(cfg.ZReport.RegisterKeys))
+	for _, k := range cfg.ZReport.RegisterKeys {
+		key, err := crypto.LoadRegisterKey(k.PublicKeyPath)
+		if err != nil {
+			log.Fatalf("Failed to load register key for VKN %s: %v", k.VKN, err)
+		}
+		registerKeys[k.VKN] = key
+	}
+	zReportHandler.SetRegisterKeys(registerKeys, cfg.ZReport.RequireSignature)
+	// Reconciliation shows the signatures issued to a VKN, like /stats. The dashed
+	// paths are aliases kept for clients built against them.
+	zReportAdmin := handlers.AdminAuth(cfg.Monitoring.AdminToken)
+	router.POST("/zreport", zReportHandler.SubmitZReport)
+	router.GET("/zreport/:vkn", zReportAdmin, zReportHandler.ZReports)
+	router.GET("/zreport/:vkn/:date", zReportAdmin, zReportHandler.Reconcile)
+	router.POST("/z-report", zReportHandler.SubmitZReport)
+	router.GET("/z-reports/:vkn", zReportAdmin, zReportHandler.ZReports)
+	router.GET("/z-reports/:vkn/:date", zReportAdmin, zReportHandler.Reconcile)
+
+	// Register device keys that co-sign receipts, published for wallets
+	deviceRegistry := devices.NewRegistry()
+	if cfg.Devices.RegistryFile != "" {
+		var err error
+		if deviceRegistry, err = devices.Open(cfg.Devices.RegistryFile); err != nil {
+			log.Fatalf("Failed to open device registry: %v", err)
+		}
+	}
+	for _, d := range cfg.Devices.Enrolled {
+		key, err := crypto.LoadDeviceKey(d.PublicKeyPath)
+		if err != nil {
+			log.Fatalf("Failed to load device key for VKN %s: %v", d.VKN, err)
+		}
+		// A configured key may also have been enrolled through POST /devices
+		if err := deviceRegistry.Enroll(devices.Device{VKN: d.VKN, PublicKey: key, Label: d.Label, EnrolledAt: time.Now().UTC()}); err != nil && !errors.Is(err, devices.ErrDuplicate) {
+			log.Fatalf("Failed to enroll device for VKN %s: %v", d.VKN, err)
+		}
+	}
+	deviceHandler := handlers.NewDeviceHandler(deviceRegistry, limiter.Identify)
+	deviceHandler.SetAllowAnonymous(cfg.Devices.AllowAnonymous)
+	if cfg.Devices.Enrollment {
+		router.POST("/devices", deviceHandler.EnrollDevice)
+		log.Printf("Device enrollment enabled at /devices (%d preloaded)", len(cfg.Devices.Enrolled))
+	}
+	router.GET("/devices/:vkn", append(keyMiddleware, deviceHandler.Devices)...)
+	router.GET("/health", healthHandler.Health)
+	router.GET("/ready", healthHandler.Ready)
+
+	// API description, shared with the Go client in receiptwallet/authority
+	openAPIHandler, err := handlers.NewOpenAPIHandler()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	router.GET("/openapi.yaml", openAPIHandler.YAML)
+	router.GET("/openapi.json", openAPIHandler.JSON)
 
 	// Start server
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
@@ -47,4 +223,75 @@ func main() {
 	if err := router.Run(addr); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
-}
\ No newline at end of file
+}
+
+// newFileCryptoService loads the signing key pair from the configured files and reloads
+// it on SIGHUP; the environment keeps the passphrase out of config.yaml
+func newFileCryptoService(cfg *config.Config) *crypto.CryptoService {
+	passphrase := cfg.Keys.PrivateKeyPassphrase
+	if env := os.Getenv("RA_KEY_PASSPHRASE"); env != "" {
+		passphrase = env
+	}
+	cryptoService := crypto.NewCryptoService(crypto.KeyFiles{
+		PrivateKeyPath:  cfg.Keys.PrivateKeyPath,
+		PublicKeyPath:   cfg.Keys.PublicKeyPath,
+		CertificatePath: cfg.Keys.CertificatePath,
+		Passphrase:      passphrase,
+	})
+
+	if err := cryptoService.Load(); err != nil {
+		if cfg.Keys.ExitOnError {
+			log.Fatalf("Failed to load signing key: %v", err)
+		}
+		log.Printf("WARNING: Failed to load signing key: %v", err)
+		log.Printf("WARNING: Signing is unavailable and /ready answers 503 until the keys are fixed and reloaded with SIGHUP")
+	} else {
+		log.Printf("Signing key loaded (fingerprint %s)", cryptoService.KeyStatus().Fingerprint)
+	}
+	go reloadKeysOnSignal(cryptoService)
+	return cryptoService
+}
+
+// newEphemeralCryptoService signs with a key pair that only lives as long as the process
+func newEphemeralCryptoService() *crypto.CryptoService {
+	cryptoService, err := crypto.NewEphemeralCryptoService()
+	if err != nil {
+		log.Fatalf("Failed to generate ephemeral signing key: %v", err)
+	}
+	log.Printf("WARNING: Signing with an ephemeral in-memory key (fingerprint %s); it changes on every start, so signatures from this run stop verifying after a restart",
+		cryptoService.KeyStatus().Fingerprint)
+	return cryptoService
+}
+
+// reloadKeysOnSignal reloads the keys on SIGHUP, so a fixed or rotated key takes
+// effect without a restart
+func reloadKeysOnSignal(cryptoService *crypto.CryptoService) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		if err := cryptoService.Load(); err != nil {
+			log.Printf("Failed to reload signing key: %v", err)
+			continue
+		}
+		log.Printf("Signing key reloaded (fingerprint %s)", cryptoService.KeyStatus().Fingerprint)
+	}
+}
+
+func newQuotaLimiter(cfg *config.Config) *quota.Limiter {
+	overrides := make(map[string]quota.Limits, len(cfg.Quota.Overrides))
+	for _, o := range cfg.Quota.Overrides {
+		overrides[o.VKN] = quota.Limits{PerMinute: o.PerMinute, PerDay: o.PerDay}
+	}
+
+	clients := make([]quota.Client, len(cfg.Quota.Clients))
+	for i, c := range cfg.Quota.Clients {
+		clients[i] = quota.Client{APIKey: c.APIKey, VKN: c.VKN}
+	}
+
+	return quota.NewLimiter(
+		quota.Limits{PerMinute: cfg.Quota.PerMinute, PerDay: cfg.Quota.PerDay},
+		overrides,
+		clients,
+	)
+}
@@ -0,0 +1,260 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"revenue-authority-receipt-service/crypto"
+	"revenue-authority-receipt-service/signing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the Prometheus text exposition format served by Handler
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// LatencyBuckets are the upper bounds, in seconds, of the request latency histograms
+var LatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// Methods that keep their own method label; any other becomes "OTHER" so clients can't
+// grow the histogram without bound
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodConnect: true,
+	http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// Routes whose outcomes are counted on top of their latency
+var (
+	signRoutes = map[string]bool{"/sign": true, "/sign-receipt": true}
+	keyRoutes  = map[string]bool{"/public-key": true, "/certificate": true}
+)
+
+type outcome struct {
+	endpoint string
+	result   string
+}
+
+type route struct {
+	method string
+	path   string
+}
+
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+// Metrics counts signing requests, key fetches and request latencies for GET /metrics
+type Metrics struct {
+	keys *crypto.CryptoService
+	pool *signing.Pool
+
+	mu         sync.Mutex
+	signs      map[outcome]uint64
+	keyFetches map[outcome]uint64
+	latencies  map[route]*histogram
+	now        func() time.Time
+}
+
+func NewMetrics(keys *crypto.CryptoService) *Metrics {
+	return &Metrics{
+		keys:       keys,
+		signs:      make(map[outcome]uint64),
+		keyFetches: make(map[outcome]uint64),
+		latencies:  make(map[route]*histogram),
+		now:        time.Now,
+	}
+}
+
+// SetSigningPool adds the signing worker pool's load to the metrics
+func (m *Metrics) SetSigningPool(pool *signing.Pool) {
+	m.pool = pool
+}
+
+// Middleware times every request it wraps and counts the outcome of signing and key requests
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := m.now()
+		c.Next()
+
+		// Shed signing requests answer 503 like a missing key; tell them apart
+		result := Result(c.Writer.Status())
+		if last := c.Errors.Last(); last != nil {
+			switch {
+			case errors.Is(last, signing.ErrOverloaded):
+				result = "overloaded"
+			case errors.Is(last, signing.ErrTimeout):
+				result = "timeout"
+			}
+		}
+		m.RecordResult(c.Request.Method, c.FullPath(), result, m.now().Sub(start))
+	}
+}
+
+// Record counts one request to path (the route pattern, "" when no route matched)
+func (m *Metrics) Record(method, path string, status int, elapsed time.Duration) {
+	m.RecordResult(method, path, Result(status), elapsed)
+}
+
+// RecordResult counts one request like Record, with its result already named
+func (m *Metrics) RecordResult(method, path, result string, elapsed time.Duration) {
+	if path == "" {
+		path = "unmatched"
+	}
+	if !knownMethods[method] {
+		method = "OTHER"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case signRoutes[path]:
+		m.signs[outcome{path, result}]++
+	case keyRoutes[path]:
+		m.keyFetches[outcome{path, result}]++
+	}
+
+	key := route{method, path}
+	h, exists := m.latencies[key]
+	if !exists {
+		h = &histogram{counts: make([]uint64, len(LatencyBuckets)+1)}
+		m.latencies[key] = h
+	}
+	seconds := elapsed.Seconds()
+	h.counts[sort.SearchFloat64s(LatencyBuckets, seconds)]++
+	h.sum += seconds
+	h.count++
+}
+
+// Result names the outcome of a request by its status, the failure reason on the counters
+func Result(status int) string {
+	switch {
+	case status < 300:
+		return "success"
+	case status == http.StatusBadRequest:
+		return "invalid_request"
+	case status == http.StatusForbidden:
+		return "forbidden"
+	case status == http.StatusNotFound:
+		return "not_found"
+	case status == http.StatusUnprocessableEntity:
+		return "refused" // Receipt checks failed
+	case status == http.StatusTooManyRequests:
+		return "quota_exceeded"
+	case status == http.StatusServiceUnavailable:
+		return "key_unavailable"
+	case status >= 500:
+		return "error"
+	default:
+		return "client_error"
+	}
+}
+
+// Handler serves GET /metrics
+func (m *Metrics) Handler(c *gin.Context) {
+	var b strings.Builder
+	m.Write(&b)
+	c.Data(http.StatusOK, ContentType, []byte(b.String()))
+}
+
+// Write writes all metrics in the Prometheus text exposition format
+func (m *Metrics) Write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP revenue_authority_sign_requests_total Signing requests by endpoint and result (success or failure reason).")
+	fmt.Fprintln(w, "# TYPE revenue_authority_sign_requests_total counter")
+	writeOutcomes(w, "revenue_authority_sign_requests_total", m.signs)
+
+	fmt.Fprintln(w, "# HELP revenue_authority_public_key_fetches_total Public key and certificate requests by endpoint and result.")
+	fmt.Fprintln(w, "# TYPE revenue_authority_public_key_fetches_total counter")
+	writeOutcomes(w, "revenue_authority_public_key_fetches_total", m.keyFetches)
+
+	fmt.Fprintln(w, "# HELP revenue_authority_http_request_duration_seconds Request latency by method and route.")
+	fmt.Fprintln(w, "# TYPE revenue_authority_http_request_duration_seconds histogram")
+	routes := make([]route, 0, len(m.latencies))
+	for r := range m.latencies {
+		routes = append(routes, r)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].path != routes[j].path {
+			return routes[i].path < routes[j].path
+		}
+		return routes[i].method < routes[j].method
+	})
+	for _, r := range routes {
+		h := m.latencies[r]
+		labels := fmt.Sprintf(`method=%q,route=%q`, r.method, r.path)
+		var cumulative uint64
+		for i, bound := range LatencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "revenue_authority_http_request_duration_seconds_bucket{%s,le=%q} %d\n",
+				labels, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "revenue_authority_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "revenue_authority_http_request_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "revenue_authority_http_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	key := m.keys.KeyStatus()
+	loaded := 0
+	if key.Loaded {
+		loaded = 1
+	}
+	fmt.Fprintln(w, "# HELP revenue_authority_signing_key_loaded Whether a signing key pair is loaded.")
+	fmt.Fprintln(w, "# TYPE revenue_authority_signing_key_loaded gauge")
+	fmt.Fprintf(w, "revenue_authority_signing_key_loaded %d\n", loaded)
+	if key.Loaded && !key.KeyCreated.IsZero() {
+		fmt.Fprintln(w, "# HELP revenue_authority_signing_key_age_seconds Seconds since the private key file was written (generated or rotated).")
+		fmt.Fprintln(w, "# TYPE revenue_authority_signing_key_age_seconds gauge")
+		fmt.Fprintf(w, "revenue_authority_signing_key_age_seconds %d\n", int64(m.now().Sub(key.KeyCreated).Seconds()))
+	}
+	if key.CertificateExpiry != nil {
+		fmt.Fprintln(w, "# HELP revenue_authority_certificate_expiry_timestamp_seconds Unix time the signing certificate chain expires.")
+		fmt.Fprintln(w, "# TYPE revenue_authority_certificate_expiry_timestamp_seconds gauge")
+		fmt.Fprintf(w, "revenue_authority_certificate_expiry_timestamp_seconds %d\n", key.CertificateExpiry.Unix())
+	}
+
+	if m.pool != nil {
+		pool := m.pool.Stats()
+		fmt.Fprintln(w, "# HELP revenue_authority_signing_workers Signing workers in the pool.")
+		fmt.Fprintln(w, "# TYPE revenue_authority_signing_workers gauge")
+		fmt.Fprintf(w, "revenue_authority_signing_workers %d\n", pool.Workers)
+		fmt.Fprintln(w, "# HELP revenue_authority_signing_busy_workers Signing workers running a job.")
+		fmt.Fprintln(w, "# TYPE revenue_authority_signing_busy_workers gauge")
+		fmt.Fprintf(w, "revenue_authority_signing_busy_workers %d\n", pool.Busy)
+		fmt.Fprintln(w, "# HELP revenue_authority_signing_queue_depth Signing jobs waiting for a worker.")
+		fmt.Fprintln(w, "# TYPE revenue_authority_signing_queue_depth gauge")
+		fmt.Fprintf(w, "revenue_authority_signing_queue_depth %d\n", pool.Queued)
+		fmt.Fprintln(w, "# HELP revenue_authority_signing_shed_total Signing requests refused under load, by reason.")
+		fmt.Fprintln(w, "# TYPE revenue_authority_signing_shed_total counter")
+		fmt.Fprintf(w, "revenue_authority_signing_shed_total{reason=\"overloaded\"} %d\n", pool.Rejected)
+		fmt.Fprintf(w, "revenue_authority_signing_shed_total{reason=\"timeout\"} %d\n", pool.TimedOut)
+	}
+}
+
+func writeOutcomes(w io.Writer, name string, counts map[outcome]uint64) {
+	outcomes := make([]outcome, 0, len(counts))
+	for o := range counts {
+		outcomes = append(outcomes, o)
+	}
+	sort.Slice(outcomes, func(i, j int) bool {
+		if outcomes[i].endpoint != outcomes[j].endpoint {
+			return outcomes[i].endpoint < outcomes[j].endpoint
+		}
+		return outcomes[i].result < outcomes[j].result
+	})
+	for _, o := range outcomes {
+		fmt.Fprintf(w, "%s{endpoint=%q,result=%q} %d\n", name, o.endpoint, o.result, counts[o])
+	}
+}
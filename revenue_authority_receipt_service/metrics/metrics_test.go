@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"revenue-authority-receipt-service/crypto"
+	"revenue-authority-receipt-service/signing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestMetrics(t *testing.T) *Metrics {
+	t.Helper()
+	keys, err := crypto.NewEphemeralCryptoService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewMetrics(keys)
+}
+
+func exposition(m *Metrics) string {
+	var b strings.Builder
+	m.Write(&b)
+	return b.String()
+}
+
+func TestMiddlewareCountsOutcomes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newTestMetrics(t)
+
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.POST("/sign", func(c *gin.Context) {
+		switch c.Query("fail") {
+		case "overloaded":
+			c.Error(signing.ErrOverloaded)
+			c.Status(http.StatusServiceUnavailable)
+		case "invalid":
+			c.Status(http.StatusBadRequest)
+		default:
+			c.Status(http.StatusOK)
+		}
+	})
+	router.GET("/stats/:vkn", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, target := range []string{"/sign", "/sign", "/sign?fail=invalid", "/sign?fail=overloaded"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, target, nil))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stats/1234567890", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	out := exposition(m)
+	for _, want := range []string{
+		`revenue_authority_sign_requests_total{endpoint="/sign",result="success"} 2`,
+		`revenue_authority_sign_requests_total{endpoint="/sign",result="invalid_request"} 1`,
+		`revenue_authority_sign_requests_total{endpoint="/sign",result="overloaded"} 1`,
+		`revenue_authority_http_request_duration_seconds_count{method="POST",route="/sign"} 4`,
+		`revenue_authority_http_request_duration_seconds_count{method="GET",route="/stats/:vkn"} 1`,
+		`revenue_authority_http_request_duration_seconds_count{method="GET",route="unmatched"} 1`,
+		"revenue_authority_signing_key_loaded 1",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Missing %s in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "1234567890") {
+		t.Error("Route label carries the request path instead of the route pattern")
+	}
+}
+
+func TestUnknownMethodsShareOneLabel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newTestMetrics(t)
+
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.GET("/public-key", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, method := range []string{"PROPFIND", "BREW", "X-RANDOM-1", "X-RANDOM-2", http.MethodOptions} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/public-key", nil))
+	}
+
+	out := exposition(m)
+	if want := `revenue_authority_http_request_duration_seconds_count{method="OTHER",route="unmatched"} 4`; !strings.Contains(out, want) {
+		t.Errorf("Missing %s in:\n%s", want, out)
+	}
+	if want := `revenue_authority_http_request_duration_seconds_count{method="OPTIONS",route="unmatched"} 1`; !strings.Contains(out, want) {
+		t.Errorf("Missing %s in:\n%s", want, out)
+	}
+	for _, method := range []string{"PROPFIND", "BREW", "X-RANDOM"} {
+		if strings.Contains(out, method) {
+			t.Errorf("Method %s became a label value", method)
+		}
+	}
+}
+
+func TestLatencyBuckets(t *testing.T) {
+	m := newTestMetrics(t)
+	m.Record(http.MethodGet, "/certificate", http.StatusOK, 3*time.Millisecond)
+	m.Record(http.MethodGet, "/certificate", http.StatusNotFound, 3*time.Second)
+
+	out := exposition(m)
+	for _, want := range []string{
+		`revenue_authority_http_request_duration_seconds_bucket{method="GET",route="/certificate",le="0.0025"} 0`,
+		`revenue_authority_http_request_duration_seconds_bucket{method="GET",route="/certificate",le="0.005"} 1`,
+		`revenue_authority_http_request_duration_seconds_bucket{method="GET",route="/certificate",le="2.5"} 1`,
+		`revenue_authority_http_request_duration_seconds_bucket{method="GET",route="/certificate",le="+Inf"} 2`,
+		`revenue_authority_public_key_fetches_total{endpoint="/certificate",result="not_found"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Missing %s in:\n%s", want, out)
+		}
+	}
+}
@@ -1,11 +1,21 @@
 package models
 
+import "encoding/json"
+
 type SignRequest struct {
-	Hash string `json:"hash" binding:"required"`
+	Hash      string `json:"hash" binding:"required"`
+	Timestamp bool   `json:"timestamp"`
+}
+
+type SignReceiptRequest struct {
+	Receipt   string `json:"receipt" binding:"required"` // Base64 binary receipt v1 or v2
+	Timestamp bool   `json:"timestamp"`
 }
 
 type SignResponse struct {
-	Signature string `json:"signature"`
+	Signature      string `json:"signature"`
+	TimestampToken string `json:"timestamp_token,omitempty"`
+	SignedAt       string `json:"signed_at,omitempty"`
 }
 
 type PublicKeyResponse struct {
@@ -14,4 +24,152 @@ type PublicKeyResponse struct {
 
 type ErrorResponse struct {
 	Error string `json:"error"`
-}
\ No newline at end of file
+}
+type KeyStatusResponse struct {
+	Loaded            bool   `json:"loaded"`
+	KeyPairMatch      bool   `json:"key_pair_match"`
+	Fingerprint       string `json:"fingerprint,omitempty"`
+	CertificateExpiry string `json:"certificate_expiry,omitempty"`
+	ExpiresInSeconds  int64  `json:"expires_in_seconds,omitempty"`
+	Error             string `json:"error,omitempty"`
+	Ephemeral         bool   `json:"ephemeral,omitempty"` // In-memory key from -ephemeral-keys; signatures stop verifying after a restart
+}
+
+type ErrorRateResponse struct {
+	WindowSeconds int64   `json:"window_seconds"`
+	Requests      int     `json:"requests"`
+	ClientErrors  int     `json:"client_errors"`
+	ServerErrors  int     `json:"server_errors"`
+	ErrorRate     float64 `json:"error_rate"`
+}
+
+// SigningPoolResponse reports the signing worker pool's capacity and load
+type SigningPoolResponse struct {
+	Workers   int    `json:"workers"`
+	QueueSize int    `json:"queue_size"`
+	Busy      int    `json:"busy"`
+	Queued    int    `json:"queued"`
+	Completed uint64 `json:"completed"`
+	Rejected  uint64 `json:"rejected"`
+	TimedOut  uint64 `json:"timed_out"`
+}
+
+type HealthResponse struct {
+	Status        string               `json:"status"`
+	Service       string               `json:"service"`
+	UptimeSeconds int64                `json:"uptime_seconds"`
+	StartedAt     string               `json:"started_at"`
+	Key           KeyStatusResponse    `json:"key"`
+	Requests      ErrorRateResponse    `json:"requests"`
+	Signing       *SigningPoolResponse `json:"signing,omitempty"`
+}
+
+type ReadyResponse struct {
+	Ready   bool     `json:"ready"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+type DailyCountResponse struct {
+	Date       string `json:"date"`
+	Signatures int    `json:"signatures"`
+	Flagged    int    `json:"flagged"`
+}
+
+type AnomalyResponse struct {
+	Flag      string `json:"flag"`
+	Date      string `json:"date"`
+	FirstSeen string `json:"first_seen"`
+	Detail    string `json:"detail"`
+}
+
+type VKNStatsResponse struct {
+	VKN                  string               `json:"vkn"`
+	Today                DailyCountResponse   `json:"today"`
+	BaselineDailyAverage float64              `json:"baseline_daily_average"`
+	TotalSignatures      int                  `json:"total_signatures"`
+	Days                 []DailyCountResponse `json:"days"`
+	Anomalies            []AnomalyResponse    `json:"anomalies"`
+}
+
+// ZReportRequest carries a summary and the register's signature over its exact bytes
+type ZReportRequest struct {
+	Summary   json.RawMessage `json:"summary" binding:"required"`
+	Signature string          `json:"signature"` // Base64 r || s over SHA-256 of summary
+}
+
+type ZReportSummary struct {
+	VKN           string             `json:"vkn"`
+	Date          string             `json:"date"` // YYYY-MM-DD
+	ZReportNumber string             `json:"z_report_number"`
+	OpenedAt      string             `json:"opened_at"` // RFC 3339
+	ClosedAt      string             `json:"closed_at"` // RFC 3339
+	ReceiptCount  int                `json:"receipt_count"`
+	FirstSerial   string             `json:"first_serial"`
+	LastSerial    string             `json:"last_serial"`
+	TotalAmount   float64            `json:"total_amount"`
+	TotalTax      float64            `json:"total_tax"`
+	TaxTotals     []TaxTotal         `json:"tax_totals"`
+	PaymentTotals map[string]float64 `json:"payment_totals"`
+}
+
+type TaxTotal struct {
+	Rate          int     `json:"rate"` // Percent
+	TaxableAmount float64 `json:"taxable_amount"`
+	TaxAmount     float64 `json:"tax_amount"`
+}
+
+type ZReportResponse struct {
+	VKN           string             `json:"vkn"`
+	Date          string             `json:"date"`
+	ZReportNumber string             `json:"z_report_number"`
+	OpenedAt      string             `json:"opened_at"`
+	ClosedAt      string             `json:"closed_at"`
+	ReceiptCount  int                `json:"receipt_count"`
+	FirstSerial   string             `json:"first_serial,omitempty"`
+	LastSerial    string             `json:"last_serial,omitempty"`
+	TotalAmount   float64            `json:"total_amount"`
+	TotalTax      float64            `json:"total_tax"`
+	TaxTotals     []TaxTotal         `json:"tax_totals,omitempty"`
+	PaymentTotals map[string]float64 `json:"payment_totals,omitempty"`
+	Signed        bool               `json:"signed"`
+	ReceivedAt    string             `json:"received_at"`
+}
+
+// ReconciliationResponse sets a day's declared Z-reports against the signatures issued
+type ReconciliationResponse struct {
+	VKN              string            `json:"vkn"`
+	Date             string            `json:"date"`
+	Reports          []ZReportResponse `json:"reports"`
+	DeclaredReceipts int               `json:"declared_receipts"`
+	DeclaredTotal    float64           `json:"declared_total"`
+	SignaturesIssued int               `json:"signatures_issued"`
+	// Difference is signatures issued minus receipts declared; non-zero warrants a closer look
+	Difference int `json:"difference"`
+}
+
+// DeviceEnrollmentRequest carries an enrollment and the device key's signature over its
+// exact bytes, proving the register holds the private key
+type DeviceEnrollmentRequest struct {
+	Enrollment json.RawMessage `json:"enrollment" binding:"required"`
+	Signature  string          `json:"signature"` // Base64 r || s by the device key over SHA-256 of enrollment
+}
+
+type DeviceEnrollment struct {
+	VKN       string `json:"vkn"`
+	PublicKey string `json:"public_key"` // Base64 33-byte compressed P-256 key
+	Label     string `json:"label"`
+}
+
+type DeviceResponse struct {
+	VKN        string `json:"vkn"`
+	PublicKey  string `json:"public_key"`
+	KeyID      string `json:"key_id"` // SHA-256 of the compressed key, hex
+	Label      string `json:"label,omitempty"`
+	Proven     bool   `json:"proven"` // Enrolled with a signature by the device key
+	EnrolledAt string `json:"enrolled_at"`
+}
+
+type DevicesResponse struct {
+	VKN     string           `json:"vkn"`
+	Devices []DeviceResponse `json:"devices"`
+}
@@ -0,0 +1,224 @@
+package quota
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"revenue-authority-receipt-service/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// sweepInterval is how often counters of clients that went idle are dropped
+const sweepInterval = time.Minute
+
+// Limits defines how many signatures a single client may request per window.
+// A zero value disables that window.
+type Limits struct {
+	PerMinute int
+	PerDay    int
+}
+
+// Client is a register known to the authority by API key
+type Client struct {
+	APIKey string
+	VKN    string
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+type usage struct {
+	vkn    string
+	minute window
+	day    window
+}
+
+// Limiter tracks fixed-window request counters per client
+type Limiter struct {
+	mu        sync.Mutex
+	defaults  Limits
+	overrides map[string]Limits // key: VKN
+	clients   map[string]Client // key: API key
+	usage     map[string]*usage // key: client identity
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewLimiter(defaults Limits, overrides map[string]Limits, clients []Client) *Limiter {
+	clientMap := make(map[string]Client, len(clients))
+	for _, client := range clients {
+		clientMap[client.APIKey] = client
+	}
+
+	if overrides == nil {
+		overrides = make(map[string]Limits)
+	}
+
+	return &Limiter{
+		defaults:  defaults,
+		overrides: overrides,
+		clients:   clientMap,
+		usage:     make(map[string]*usage),
+		now:       time.Now,
+	}
+}
+
+// Result describes the outcome of a quota check
+type Result struct {
+	Allowed         bool
+	Limits          Limits
+	MinuteRemaining int
+	DayRemaining    int
+	MinuteReset     time.Time
+	DayReset        time.Time
+	RetryAfter      time.Duration
+}
+
+// Allow records a request for the given identity and reports whether it fits the quota
+func (l *Limiter) Allow(identity, vkn string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limits := l.limitsFor(vkn)
+	now := l.now()
+
+	minuteStart := now.Truncate(time.Minute)
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(minuteStart, dayStart)
+		l.lastSweep = now
+	}
+
+	u, exists := l.usage[identity]
+	if !exists {
+		u = &usage{vkn: vkn}
+		l.usage[identity] = u
+	}
+
+	if !u.minute.start.Equal(minuteStart) {
+		u.minute = window{start: minuteStart}
+	}
+
+	if !u.day.start.Equal(dayStart) {
+		u.day = window{start: dayStart}
+	}
+
+	result := Result{
+		Limits:      limits,
+		MinuteReset: minuteStart.Add(time.Minute),
+		DayReset:    dayStart.AddDate(0, 0, 1),
+	}
+
+	minuteExceeded := limits.PerMinute > 0 && u.minute.count >= limits.PerMinute
+	dayExceeded := limits.PerDay > 0 && u.day.count >= limits.PerDay
+
+	switch {
+	case dayExceeded:
+		result.RetryAfter = result.DayReset.Sub(now)
+	case minuteExceeded:
+		result.RetryAfter = result.MinuteReset.Sub(now)
+	default:
+		u.minute.count++
+		u.day.count++
+		result.Allowed = true
+	}
+
+	result.MinuteRemaining = remaining(limits.PerMinute, u.minute.count)
+	result.DayRemaining = remaining(limits.PerDay, u.day.count)
+
+	return result
+}
+
+// sweep drops the counters of clients whose windows have all expired: nothing
+// counted this minute, and nothing counted today that a daily limit still needs
+func (l *Limiter) sweep(minuteStart, dayStart time.Time) {
+	for identity, u := range l.usage {
+		if u.minute.start.Equal(minuteStart) {
+			continue
+		}
+		if u.day.start.Equal(dayStart) && l.limitsFor(u.vkn).PerDay > 0 {
+			continue
+		}
+		delete(l.usage, identity)
+	}
+}
+
+// Identify resolves the quota identity and VKN of a request.
+// Known API keys map to their configured VKN, client certificates use the
+// certificate common name as VKN, and anonymous callers are keyed by IP
+// without a VKN: a VKN the caller merely claims is never trusted.
+func (l *Limiter) Identify(r *http.Request, clientIP string) (string, string) {
+	if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+		if client, exists := l.clients[apiKey]; exists {
+			return "key:" + apiKey, client.VKN
+		}
+	}
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+		return "cert:" + commonName, commonName
+	}
+
+	return "ip:" + clientIP, ""
+}
+
+// Middleware enforces the quota and sets rate limit headers on every response
+func (l *Limiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, vkn := l.Identify(c.Request, c.ClientIP())
+		result := l.Allow(identity, vkn)
+
+		setHeaders(c, result)
+
+		if !result.Allowed {
+			retryAfter := int(result.RetryAfter.Seconds() + 0.5)
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Error: fmt.Sprintf("quota exceeded, retry after %d seconds", retryAfter),
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func (l *Limiter) limitsFor(vkn string) Limits {
+	if vkn != "" {
+		if limits, exists := l.overrides[vkn]; exists {
+			return limits
+		}
+	}
+	return l.defaults
+}
+
+func setHeaders(c *gin.Context, result Result) {
+	if result.Limits.PerMinute > 0 {
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limits.PerMinute))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.MinuteRemaining))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(result.MinuteReset.Unix(), 10))
+	}
+	if result.Limits.PerDay > 0 {
+		c.Header("X-Quota-Limit", strconv.Itoa(result.Limits.PerDay))
+		c.Header("X-Quota-Remaining", strconv.Itoa(result.DayRemaining))
+		c.Header("X-Quota-Reset", strconv.FormatInt(result.DayReset.Unix(), 10))
+	}
+}
+
+func remaining(limit, used int) int {
+	if limit <= 0 || used >= limit {
+		return 0
+	}
+	return limit - used
+}
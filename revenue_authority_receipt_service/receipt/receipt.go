@@ -0,0 +1,131 @@
+package receipt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"receiptwallet/receiptformat"
+)
+
+var (
+	// ErrMalformed is wrapped by every error for data that is not a binary receipt v1 or v2
+	ErrMalformed = receiptformat.ErrMalformed
+	// ErrImplausible is returned when a receipt's fields fail the signing policy
+	ErrImplausible = errors.New("implausible receipt")
+	// ErrUnidentified is returned when the caller has no VKN to check the receipt against
+	ErrUnidentified = errors.New("unidentified register")
+)
+
+// MaxAmountKurus bounds every amount the authority adds up (2^53 kuruş), far above any
+// real receipt, so item totals can't wrap around to match a forged total
+const MaxAmountKurus = 1 << 53
+
+// parseOptions reads receipts with the parser the wallets use. Lenient, because
+// extensions newer than this authority don't change the fields it checks.
+var parseOptions = receiptformat.Options{Lenient: true}
+
+// Summary holds the receipt fields the authority checks before signing
+type Summary struct {
+	VKN             string
+	Timestamp       time.Time
+	Serial          uint32
+	TotalKurus      uint64
+	Items           int
+	ItemsTotalKurus uint64 // Items and surcharges
+}
+
+// Parse reads the fields the authority needs from a binary receipt v1 or v2,
+// compressed or not
+func Parse(data []byte) (*Summary, error) {
+	r, err := parseOptions.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := strconv.ParseUint(strings.TrimPrefix(r.Serial, "F"), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%w: serial %s", ErrMalformed, r.Serial)
+	}
+
+	if r.Total < 0 || r.Total > MaxAmountKurus {
+		return nil, fmt.Errorf("%w: total %d kuruş is out of range", ErrMalformed, r.Total)
+	}
+
+	summary := &Summary{
+		VKN:        r.StoreVKN,
+		Timestamp:  r.Timestamp.UTC(),
+		Serial:     uint32(serial),
+		TotalKurus: uint64(r.Total),
+		Items:      len(r.Items),
+	}
+	for _, item := range r.Items {
+		if err := summary.addLine(item.TotalPrice); err != nil {
+			return nil, err
+		}
+	}
+	// Surcharges are lines of the sale too, charged in whole kuruş
+	for _, surcharge := range r.Surcharges {
+		if err := summary.addLine(surcharge.Amount); err != nil {
+			return nil, err
+		}
+	}
+	return summary, nil
+}
+
+// addLine adds one line amount to ItemsTotalKurus, refusing amounts and sums beyond
+// MaxAmountKurus instead of letting them wrap
+func (s *Summary) addLine(amount int64) error {
+	if amount < 0 || amount > MaxAmountKurus {
+		return fmt.Errorf("%w: line amount %d kuruş is out of range", ErrMalformed, amount)
+	}
+	if s.ItemsTotalKurus+uint64(amount) > MaxAmountKurus {
+		return fmt.Errorf("%w: line amounts add up to more than %d kuruş", ErrMalformed, uint64(MaxAmountKurus))
+	}
+	s.ItemsTotalKurus += uint64(amount)
+	return nil
+}
+
+// DefaultTimestampTolerance applies when the policy sets none
+const DefaultTimestampTolerance = 5 * time.Minute
+
+// Policy decides whether a receipt is plausible enough to sign
+type Policy struct {
+	TimestampTolerance time.Duration // Allowed distance between receipt time and authority clock (0 = default)
+	MaxTotalKurus      uint64        // 0 = no upper bound
+}
+
+// Check validates a receipt summary. requesterVKN is the VKN the caller authenticated
+// as by API key or client certificate; a caller without one, or a receipt issued under
+// another VKN, is refused.
+func (p Policy) Check(s *Summary, requesterVKN string, now time.Time) error {
+	if requesterVKN == "" {
+		return fmt.Errorf("%w: the requesting register is not identified by an API key or client certificate", ErrUnidentified)
+	}
+	tolerance := p.TimestampTolerance
+	if tolerance <= 0 {
+		tolerance = DefaultTimestampTolerance
+	}
+	if s.TotalKurus == 0 {
+		return fmt.Errorf("%w: total must be positive", ErrImplausible)
+	}
+	if p.MaxTotalKurus > 0 && s.TotalKurus > p.MaxTotalKurus {
+		return fmt.Errorf("%w: total %d kuruş exceeds limit %d", ErrImplausible, s.TotalKurus, p.MaxTotalKurus)
+	}
+	if s.Serial == 0 {
+		return fmt.Errorf("%w: serial must be positive", ErrImplausible)
+	}
+	if skew := now.Sub(s.Timestamp); skew > tolerance || skew < -tolerance {
+		return fmt.Errorf("%w: timestamp %s is more than %s from authority time", ErrImplausible, s.Timestamp.Format(time.RFC3339), tolerance)
+	}
+	if requesterVKN != s.VKN {
+		return fmt.Errorf("%w: receipt VKN %s does not match requesting register %s", ErrImplausible, s.VKN, requesterVKN)
+	}
+	// Item totals are rounded to kuruş individually, so allow one kuruş per item
+	diff := int64(s.ItemsTotalKurus) - int64(s.TotalKurus)
+	if diff < -int64(s.Items) || diff > int64(s.Items) {
+		return fmt.Errorf("%w: item totals (%d kuruş) do not add up to total (%d kuruş)", ErrImplausible, s.ItemsTotalKurus, s.TotalKurus)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package signing
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrOverloaded is returned when every worker is busy and the queue is full
+	ErrOverloaded = errors.New("signing capacity exceeded")
+	// ErrTimeout is returned when a job did not finish within the request timeout
+	ErrTimeout = errors.New("signing timed out")
+)
+
+// Options size a Pool. Zero values pick the defaults.
+type Options struct {
+	Workers   int           // Concurrent signers (default: number of CPUs)
+	QueueSize int           // Jobs waiting for a worker (default: 4 per worker)
+	Timeout   time.Duration // Longest a request waits for its job, queueing included (default: 2s)
+}
+
+// Stats reports pool capacity and load
+type Stats struct {
+	Workers   int
+	QueueSize int
+	Busy      int
+	Queued    int
+	Completed uint64
+	Rejected  uint64 // Refused with a full queue
+	TimedOut  uint64 // Gave up waiting
+}
+
+type job struct {
+	ctx  context.Context
+	run  func()
+	done chan struct{}
+}
+
+// Pool runs signing jobs on a fixed number of workers, so a burst of requests queues
+// up to a bound and is then refused instead of starting a goroutine per signature
+type Pool struct {
+	jobs    chan job
+	timeout time.Duration
+	workers int
+
+	mu        sync.Mutex
+	busy      int
+	completed uint64
+	rejected  uint64
+	timedOut  uint64
+}
+
+// NewPool starts the workers
+func NewPool(opts Options) *Pool {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 4 * opts.Workers
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+
+	p := &Pool{
+		jobs:    make(chan job, opts.QueueSize),
+		timeout: opts.Timeout,
+		workers: opts.Workers,
+	}
+	for i := 0; i < opts.Workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Do runs fn on a worker and waits for it. It fails fast with ErrOverloaded when the
+// queue is full, and with ErrTimeout when fn has not finished within the timeout or ctx
+// ends first; fn then still runs if a worker had picked it up, so it must not write to
+// anything the caller reads after an error.
+func (p *Pool) Do(ctx context.Context, fn func()) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	j := job{ctx: ctx, run: fn, done: make(chan struct{})}
+	select {
+	case p.jobs <- j:
+	default:
+		p.mu.Lock()
+		p.rejected++
+		p.mu.Unlock()
+		return ErrOverloaded
+	}
+
+	select {
+	case <-j.done:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.timedOut++
+		p.mu.Unlock()
+		return ErrTimeout
+	}
+}
+
+// Stats returns the current load and totals since startup
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return Stats{
+		Workers:   p.workers,
+		QueueSize: cap(p.jobs),
+		Busy:      p.busy,
+		Queued:    len(p.jobs),
+		Completed: p.completed,
+		Rejected:  p.rejected,
+		TimedOut:  p.timedOut,
+	}
+}
+
+func (p *Pool) work() {
+	for j := range p.jobs {
+		// Skip jobs whose requester stopped waiting while they were queued
+		if j.ctx.Err() != nil {
+			continue
+		}
+
+		p.mu.Lock()
+		p.busy++
+		p.mu.Unlock()
+
+		j.run()
+
+		p.mu.Lock()
+		p.busy--
+		p.completed++
+		p.mu.Unlock()
+		close(j.done)
+	}
+}
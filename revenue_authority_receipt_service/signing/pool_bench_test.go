@@ -0,0 +1,114 @@
+package signing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"runtime"
+	"slices"
+	"testing"
+
+	"revenue-authority-receipt-service/crypto"
+)
+
+// Signing capacity benchmarks; signs/s is the number to plan with, e.g.
+//
+//	go test ./signing -run xxx -bench . -cpu 1,2,4
+func benchSigner(b *testing.B) (*crypto.CryptoService, string) {
+	b.Helper()
+	cryptoService, err := crypto.NewEphemeralCryptoService()
+	if err != nil {
+		b.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte("benchmark receipt"))
+	return cryptoService, base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func reportRate(b *testing.B) {
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "signs/s")
+}
+
+// BenchmarkSignHash signs on one goroutine
+func BenchmarkSignHash(b *testing.B) {
+	cryptoService, hash := benchSigner(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := cryptoService.SignHash(hash); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportRate(b)
+}
+
+// BenchmarkSignHashParallel signs on GOMAXPROCS goroutines without a pool
+func BenchmarkSignHashParallel(b *testing.B) {
+	cryptoService, hash := benchSigner(b)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := cryptoService.SignHash(hash); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+	reportRate(b)
+}
+
+// BenchmarkPool signs through pools of growing size, with 4 requests per worker in flight
+func BenchmarkPool(b *testing.B) {
+	cryptoService, hash := benchSigner(b)
+
+	counts := []int{1, 2, 4, runtime.NumCPU()}
+	slices.Sort(counts)
+	for _, workers := range slices.Compact(counts) {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			pool := NewPool(Options{Workers: workers, QueueSize: b.N})
+			b.SetParallelism(4 * workers)
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					var err error
+					if poolErr := pool.Do(context.Background(), func() {
+						_, err = cryptoService.SignHash(hash)
+					}); poolErr != nil {
+						b.Error(poolErr)
+						return
+					}
+					if err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			reportRate(b)
+		})
+	}
+}
+
+// BenchmarkPoolOverload measures how fast a saturated pool refuses requests
+func BenchmarkPoolOverload(b *testing.B) {
+	pool := NewPool(Options{Workers: 1, QueueSize: 1})
+	release := make(chan struct{})
+	defer close(release)
+	// One job holds the worker, the next fills the queue
+	go pool.Do(context.Background(), func() { <-release })
+	for pool.Stats().Busy == 0 {
+		runtime.Gosched()
+	}
+	go pool.Do(context.Background(), func() {})
+	for pool.Stats().Queued == 0 {
+		runtime.Gosched()
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := pool.Do(context.Background(), func() {}); err != ErrOverloaded {
+			b.Fatalf("Expected ErrOverloaded, got %v", err)
+		}
+	}
+}
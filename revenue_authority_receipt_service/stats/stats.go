@@ -0,0 +1,283 @@
+package stats
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AnomalyHeader lists the anomaly flags raised for a signing request
+const AnomalyHeader = "X-Anomaly-Flags"
+
+const dateLayout = "2006-01-02"
+
+// Anomaly flags
+const (
+	FlagVolumeSpike = "volume_spike"
+	FlagDailyLimit  = "daily_limit"
+)
+
+// Thresholds configures anomaly detection. A zero value disables that rule.
+type Thresholds struct {
+	SpikeFactor  float64 // Today's count above this multiple of the baseline average
+	BaselineDays int     // Previous days averaged for the baseline (days without signatures are skipped)
+	MinVolume    int     // Spikes below this daily count are ignored
+	DailyLimit   int     // Absolute signatures per VKN per day
+}
+
+// Day is one VKN's signature count for a calendar day
+type Day struct {
+	Date       string
+	Signatures int
+	Flagged    int
+}
+
+// Anomaly records the first time a flag was raised for a VKN on a day
+type Anomaly struct {
+	Flag      string
+	Date      string
+	FirstSeen time.Time
+	Detail    string
+}
+
+// Summary is the monitoring view of one VKN
+type Summary struct {
+	VKN       string
+	Today     Day
+	Baseline  float64
+	Total     int
+	Days      []Day
+	Anomalies []Anomaly
+}
+
+type vknStats struct {
+	days      map[string]*Day // key: date
+	anomalies []Anomaly
+	total     int
+}
+
+// Tracker counts signatures issued per requesting VKN per day and flags unusual volume
+type Tracker struct {
+	mu            sync.Mutex
+	thresholds    Thresholds
+	retentionDays int
+	vkns          map[string]*vknStats
+	now           func() time.Time
+}
+
+func NewTracker(thresholds Thresholds, retentionDays int) *Tracker {
+	if thresholds.BaselineDays <= 0 {
+		thresholds.BaselineDays = 7
+	}
+	if retentionDays < thresholds.BaselineDays+1 {
+		retentionDays = thresholds.BaselineDays + 1
+	}
+	return &Tracker{
+		thresholds:    thresholds,
+		retentionDays: retentionDays,
+		vkns:          make(map[string]*vknStats),
+		now:           time.Now,
+	}
+}
+
+// Check returns the anomaly flags the next signature for vkn would raise
+func (t *Tracker) Check(vkn string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, exists := t.vkns[vkn]
+	if !exists {
+		return nil
+	}
+
+	now := t.now()
+	count := 1
+	if day, ok := s.days[now.Format(dateLayout)]; ok {
+		count += day.Signatures
+	}
+
+	flags, _ := t.evaluate(s, now, count)
+	return flags
+}
+
+// Record counts a signature issued to vkn with the flags raised for it,
+// logging a warning the first time each flag is raised for the VKN that day
+func (t *Tracker) Record(vkn string, flags []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	date := now.Format(dateLayout)
+
+	s, exists := t.vkns[vkn]
+	if !exists {
+		s = &vknStats{days: make(map[string]*Day)}
+		t.vkns[vkn] = s
+	}
+
+	day, ok := s.days[date]
+	if !ok {
+		day = &Day{Date: date}
+		s.days[date] = day
+		t.prune(s, now)
+	}
+	day.Signatures++
+	s.total++
+
+	if len(flags) == 0 {
+		return
+	}
+	day.Flagged++
+
+	_, details := t.evaluate(s, now, day.Signatures)
+	for _, flag := range flags {
+		if s.hasAnomaly(flag, date) {
+			continue
+		}
+		anomaly := Anomaly{Flag: flag, Date: date, FirstSeen: now.UTC(), Detail: details[flag]}
+		s.anomalies = append(s.anomalies, anomaly)
+		log.Printf("WARNING: anomaly %s for VKN %s: %s", flag, vkn, anomaly.Detail)
+	}
+}
+
+// Summary returns the counters and anomalies of vkn, or false if it never requested a signature
+func (t *Tracker) Summary(vkn string) (Summary, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, exists := t.vkns[vkn]
+	if !exists {
+		return Summary{}, false
+	}
+
+	now := t.now()
+	today := now.Format(dateLayout)
+
+	summary := Summary{
+		VKN:       vkn,
+		Today:     Day{Date: today},
+		Baseline:  t.baseline(s, now),
+		Total:     s.total,
+		Days:      make([]Day, 0, len(s.days)),
+		Anomalies: append([]Anomaly{}, s.anomalies...),
+	}
+	if day, ok := s.days[today]; ok {
+		summary.Today = *day
+	}
+	for _, day := range s.days {
+		summary.Days = append(summary.Days, *day)
+	}
+	sort.Slice(summary.Days, func(i, j int) bool { return summary.Days[i].Date > summary.Days[j].Date })
+
+	return summary, true
+}
+
+// Day returns the signatures issued to vkn on date (YYYY-MM-DD), or false if none
+// were recorded or the day is past the retention period
+func (t *Tracker) Day(vkn, date string) (Day, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, exists := t.vkns[vkn]
+	if !exists {
+		return Day{}, false
+	}
+	day, ok := s.days[date]
+	if !ok {
+		return Day{}, false
+	}
+	return *day, true
+}
+
+// Middleware counts successful signatures per VKN and marks flagged requests with AnomalyHeader.
+// identify resolves the requesting register; only registers authenticated by API key or
+// client certificate are tracked, so nobody can inflate another VKN's counts.
+func (t *Tracker) Middleware(identify func(r *http.Request, clientIP string) (string, string)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, vkn := identify(c.Request, c.ClientIP())
+		if vkn == "" || !(strings.HasPrefix(identity, "key:") || strings.HasPrefix(identity, "cert:")) {
+			c.Next()
+			return
+		}
+
+		flags := t.Check(vkn)
+		if len(flags) > 0 {
+			c.Header(AnomalyHeader, strings.Join(flags, ","))
+		}
+
+		c.Next()
+
+		if c.Writer.Status() == http.StatusOK {
+			t.Record(vkn, flags)
+		}
+	}
+}
+
+// evaluate applies the thresholds to a daily count (caller holds mu)
+func (t *Tracker) evaluate(s *vknStats, now time.Time, count int) ([]string, map[string]string) {
+	var flags []string
+	details := make(map[string]string)
+
+	if t.thresholds.DailyLimit > 0 && count > t.thresholds.DailyLimit {
+		flags = append(flags, FlagDailyLimit)
+		details[FlagDailyLimit] = fmt.Sprintf("%d signatures today exceeds daily limit of %d", count, t.thresholds.DailyLimit)
+	}
+
+	if t.thresholds.SpikeFactor > 0 && count >= t.thresholds.MinVolume {
+		if baseline := t.baseline(s, now); baseline > 0 && float64(count) > baseline*t.thresholds.SpikeFactor {
+			flags = append(flags, FlagVolumeSpike)
+			details[FlagVolumeSpike] = fmt.Sprintf("%d signatures today is %.1fx the %d-day average of %.1f",
+				count, float64(count)/baseline, t.thresholds.BaselineDays, baseline)
+		}
+	}
+
+	return flags, details
+}
+
+// baseline averages the active days among the previous BaselineDays (caller holds mu)
+func (t *Tracker) baseline(s *vknStats, now time.Time) float64 {
+	total, active := 0, 0
+	for i := 1; i <= t.thresholds.BaselineDays; i++ {
+		if day, ok := s.days[now.AddDate(0, 0, -i).Format(dateLayout)]; ok {
+			total += day.Signatures
+			active++
+		}
+	}
+	if active == 0 {
+		return 0
+	}
+	return float64(total) / float64(active)
+}
+
+// prune drops days and anomalies older than the retention period (caller holds mu)
+func (t *Tracker) prune(s *vknStats, now time.Time) {
+	cutoff := now.AddDate(0, 0, -t.retentionDays).Format(dateLayout)
+	for date := range s.days {
+		if date <= cutoff {
+			delete(s.days, date)
+		}
+	}
+
+	kept := s.anomalies[:0]
+	for _, anomaly := range s.anomalies {
+		if anomaly.Date > cutoff {
+			kept = append(kept, anomaly)
+		}
+	}
+	s.anomalies = kept
+}
+
+func (s *vknStats) hasAnomaly(flag, date string) bool {
+	for _, anomaly := range s.anomalies {
+		if anomaly.Flag == flag && anomaly.Date == date {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"revenue-authority-receipt-service/config"
+	"revenue-authority-receipt-service/crypto"
+
+	"receiptwallet/trustbundle"
+)
+
+// runTrustBundle implements `revenue-authority trust-bundle`: it signs a trust bundle
+// with the configured key and writes it for wallets to ship, as GET /trust-bundle
+// serves it
+func runTrustBundle(args []string) error {
+	fs := flag.NewFlagSet("trust-bundle", flag.ContinueOnError)
+	out := fs.String("out", "trust_bundle.json", "File to write the bundle to (- for standard output)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s trust-bundle [flags]\n\nSigns the keys in config.yaml's trust_bundle section with the signing key.\n\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	cfg := config.Load()
+	if cfg.Keys.Ephemeral {
+		return fmt.Errorf("keys.ephemeral is set; a bundle of an in-memory key stops verifying on restart")
+	}
+	options, err := trustBundleOptions(cfg)
+	if err != nil {
+		return err
+	}
+
+	passphrase := cfg.Keys.PrivateKeyPassphrase
+	if env := os.Getenv("RA_KEY_PASSPHRASE"); env != "" {
+		passphrase = env
+	}
+	cryptoService := crypto.NewCryptoService(crypto.KeyFiles{
+		PrivateKeyPath:  cfg.Keys.PrivateKeyPath,
+		PublicKeyPath:   cfg.Keys.PublicKeyPath,
+		CertificatePath: cfg.Keys.CertificatePath,
+		Passphrase:      passphrase,
+	})
+	if err := cryptoService.Load(); err != nil {
+		return err
+	}
+
+	bundle, err := cryptoService.TrustBundle(options, time.Now())
+	if err != nil {
+		return err
+	}
+	if *out == "-" {
+		_, err = os.Stdout.Write(append(bundle, '\n'))
+		return err
+	}
+	if err := os.WriteFile(*out, append(bundle, '\n'), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s (signed by %s, valid for %d days)\n", *out, cryptoService.KeyStatus().Fingerprint, cfg.TrustBundle.ValidityDays)
+	return nil
+}
+
+// trustBundleOptions reads the trust_bundle section, loading the retired keys
+func trustBundleOptions(cfg *config.Config) (crypto.TrustBundleOptions, error) {
+	tb := cfg.TrustBundle
+	if tb.Authority.Name == "" {
+		return crypto.TrustBundleOptions{}, fmt.Errorf("trust_bundle.authority.name is required")
+	}
+	if tb.ValidityDays <= 0 {
+		return crypto.TrustBundleOptions{}, fmt.Errorf("trust_bundle.validity_days must be positive")
+	}
+
+	options := crypto.TrustBundleOptions{
+		Authority: trustbundle.Authority{Name: tb.Authority.Name, Country: tb.Authority.Country, URL: tb.Authority.URL},
+		Validity:  time.Duration(tb.ValidityDays) * 24 * time.Hour,
+	}
+	var err error
+	if options.NotBefore, err = parseBundleTime(tb.CurrentKeyNotBefore, "trust_bundle.current_key_not_before"); err != nil {
+		return crypto.TrustBundleOptions{}, err
+	}
+
+	for _, retired := range tb.RetiredKeys {
+		publicKey, err := crypto.LoadPublicKey(retired.PublicKeyPath)
+		if err != nil {
+			return crypto.TrustBundleOptions{}, fmt.Errorf("retired key: %v", err)
+		}
+		key := trustbundle.Key{PublicKey: publicKey}
+		if key.NotBefore, err = parseBundleTime(retired.NotBefore, retired.PublicKeyPath+" not_before"); err != nil {
+			return crypto.TrustBundleOptions{}, err
+		}
+		if key.NotAfter, err = parseBundleTime(retired.NotAfter, retired.PublicKeyPath+" not_after"); err != nil {
+			return crypto.TrustBundleOptions{}, err
+		}
+		options.RetiredKeys = append(options.RetiredKeys, key)
+	}
+	return options, nil
+}
+
+// parseBundleTime reads an RFC 3339 time; empty is the zero time, an open end
+func parseBundleTime(value, name string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %v", name, err)
+	}
+	return t, nil
+}
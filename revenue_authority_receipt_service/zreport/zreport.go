@@ -0,0 +1,106 @@
+package zreport
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDuplicate is returned for a Z-report number already recorded for the VKN
+	ErrDuplicate = errors.New("Z-report already recorded")
+	// ErrOutOfOrder is returned for a Z-report number below the VKN's latest one
+	ErrOutOfOrder = errors.New("Z-report number is older than the latest recorded")
+)
+
+// Report is an end-of-day summary declared by a cash register
+type Report struct {
+	VKN           string
+	Number        int
+	Date          string // Business day the report closes, YYYY-MM-DD
+	OpenedAt      time.Time
+	ClosedAt      time.Time
+	ReceiptCount  int
+	FirstSerial   string
+	LastSerial    string
+	TotalAmount   float64
+	TotalTax      float64
+	TaxTotals     []TaxTotal
+	PaymentTotals map[string]float64
+	Signed        bool // Signature verified against the register's registered key
+	ReceivedAt    time.Time
+}
+
+// TaxTotal is the taxable amount and tax collected at one rate
+type TaxTotal struct {
+	Rate          int // Percent
+	TaxableAmount float64
+	TaxAmount     float64
+}
+
+// Ledger keeps the Z-reports declared by each VKN in number order
+type Ledger struct {
+	mu      sync.RWMutex
+	reports map[string][]Report
+}
+
+// NewLedger creates an empty Z-report ledger
+func NewLedger() *Ledger {
+	return &Ledger{
+		reports: make(map[string][]Report),
+	}
+}
+
+// Record stores a report. Numbers must increase per VKN; a gap is accepted but logged,
+// since the missing reports may still arrive from a register that was offline.
+func (l *Ledger) Record(report Report) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	existing := l.reports[report.VKN]
+	if n := len(existing); n > 0 {
+		last := existing[n-1].Number
+		switch {
+		case report.Number == last:
+			return fmt.Errorf("%w: Z%04d for VKN %s", ErrDuplicate, report.Number, report.VKN)
+		case report.Number < last:
+			for _, r := range existing {
+				if r.Number == report.Number {
+					return fmt.Errorf("%w: Z%04d for VKN %s", ErrDuplicate, report.Number, report.VKN)
+				}
+			}
+			return fmt.Errorf("%w: Z%04d after Z%04d for VKN %s", ErrOutOfOrder, report.Number, last, report.VKN)
+		case report.Number > last+1:
+			log.Printf("Z-report gap for VKN %s: Z%04d follows Z%04d", report.VKN, report.Number, last)
+		}
+	}
+
+	l.reports[report.VKN] = append(existing, report)
+	return nil
+}
+
+// List returns the reports recorded for a VKN, oldest first
+func (l *Ledger) List(vkn string) []Report {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	result := make([]Report, len(l.reports[vkn]))
+	copy(result, l.reports[vkn])
+	return result
+}
+
+// ForDate returns the reports a VKN declared for one business day, oldest first
+func (l *Ledger) ForDate(vkn, date string) []Report {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var result []Report
+	for _, report := range l.reports[vkn] {
+		if report.Date == date {
+			result = append(result, report)
+		}
+	}
+	return result
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	rwcrypto "receiptwallet/crypto"
+	"receiptwallet/qrpayload"
+	"receiptwallet/receiptbank"
+	"receiptwallet/receiptformat"
+
+	"wallet/internal/authority"
+	"wallet/internal/ledger"
+)
+
+const usage = `Usage: wallet <command> [flags]
+
+Commands:
+  receive   Generate an ephemeral key for the register and collect the receipt from the bank
+  import    Add a decrypted signed receipt file to the ledger
+  list      List collected receipts
+  show      Print one receipt (by serial or ID prefix)
+  stats     Spending by store, KISIM and tax rate
+
+The ledger is encrypted with the passphrase in WALLET_PASSPHRASE and stored at
+WALLET_LEDGER (default ~/.receipt-wallet/ledger.enc).
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "receive":
+		err = receiveCommand(args)
+	case "import":
+		err = importCommand(args)
+	case "list":
+		err = listCommand(args)
+	case "show":
+		err = showCommand(args)
+	case "stats":
+		err = statsCommand(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "wallet: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func receiveCommand(args []string) error {
+	flags := flag.NewFlagSet("receive", flag.ExitOnError)
+	bankURL := flags.String("bank", "http://127.0.0.1:4403", "Receipt bank URL")
+	authorityURL := flags.String("authority", "http://127.0.0.1:4406", "Revenue authority URL (for its public key)")
+	authorityKey := flags.String("authority-key", "", "Revenue authority public key PEM file, instead of fetching it")
+	authorityRoot := flags.String("authority-root", "", "Trusted root certificate PEM file; fetch /certificate and verify its chain instead of /public-key")
+	timeout := flags.Duration("timeout", 5*time.Minute, "How long to wait for the receipt")
+	poll := flags.Bool("poll", false, "Poll /collect instead of waiting on the bank's WebSocket")
+	flags.Parse(args)
+
+	l, err := openLedger()
+	if err != nil {
+		return err
+	}
+	publicKey, err := authority.LoadKey(*authorityURL, *authorityKey, *authorityRoot)
+	if err != nil {
+		return err
+	}
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate ephemeral key: %v", err)
+	}
+	compressed, err := rwcrypto.CompressKey(&privateKey.PublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to compress ephemeral key: %v", err)
+	}
+	ephemeralKey := base64.StdEncoding.EncodeToString(compressed)
+	qrCode, err := (&qrpayload.Payload{EphemeralKey: compressed, BankURL: *bankURL}).Encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode QR payload: %v", err)
+	}
+
+	fmt.Printf("Give this to the cash register (QR code content):\n\n  %s\n\nWaiting for the receipt...\n", qrCode)
+
+	var envelope []byte
+	if !*poll {
+		envelope, err = waitForPush(*bankURL, privateKey, ephemeralKey, *timeout)
+	}
+	if *poll || errors.Is(err, errNoPush) {
+		envelope, err = pollBank(*bankURL, privateKey, ephemeralKey, *timeout)
+	}
+	if err != nil {
+		return err
+	}
+	signedReceipt, err := rwcrypto.Decrypt(envelope, privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt receipt: %v", err)
+	}
+
+	return addToLedger(l, signedReceipt, publicKey)
+}
+
+func importCommand(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	authorityURL := flags.String("authority", "http://127.0.0.1:4406", "Revenue authority URL (for its public key)")
+	authorityKey := flags.String("authority-key", "", "Revenue authority public key PEM file, instead of fetching it")
+	authorityRoot := flags.String("authority-root", "", "Trusted root certificate PEM file; fetch /certificate and verify its chain instead of /public-key")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: wallet import [flags] <signed-receipt-file>")
+	}
+
+	signedReceipt, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read receipt: %v", err)
+	}
+
+	l, err := openLedger()
+	if err != nil {
+		return err
+	}
+	publicKey, err := authority.LoadKey(*authorityURL, *authorityKey, *authorityRoot)
+	if err != nil {
+		return err
+	}
+
+	return addToLedger(l, signedReceipt, publicKey)
+}
+
+func listCommand(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	month := flags.String("month", "", "Only receipts from this month (YYYY-MM)")
+	flags.Parse(args)
+
+	l, err := openLedger()
+	if err != nil {
+		return err
+	}
+
+	entries := ledger.InMonth(l.Entries(), *month)
+	if len(entries) == 0 {
+		fmt.Println("No receipts")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDATE\tSERIAL\tSTORE\tTOTAL\tVERIFIED")
+	for _, entry := range entries {
+		r := entry.Receipt
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%v\n",
+			entry.ID[:12], r.Timestamp.Format("2006-01-02 15:04"), r.Serial, r.StoreName, formatKurus(r.Total), entry.Verified)
+	}
+	return w.Flush()
+}
+
+func showCommand(args []string) error {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: wallet show <serial|id>")
+	}
+
+	l, err := openLedger()
+	if err != nil {
+		return err
+	}
+	entry, err := l.Find(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	r := entry.Receipt
+	fmt.Printf("%s\n%s\nVKN: %s\n\n", r.StoreName, r.StoreAddress, r.StoreVKN)
+	fmt.Printf("Date:        %s\n", r.Timestamp.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Receipt:     %s (Z%04d)\n", r.Serial, r.ZReport)
+	fmt.Printf("Transaction: %s\n", r.TransactionID())
+	if r.CustomerTaxNumber != "" {
+		fmt.Printf("Customer:    %s (%s)\n", r.CustomerName, r.CustomerTaxNumber)
+	}
+	if r.RefundOf != nil {
+		fmt.Printf("Refund of:   %s (%s, %s)\n", r.RefundOf.Serial, r.RefundOf.TransactionID(), r.RefundOf.Timestamp.Format("2006-01-02"))
+	}
+	fmt.Println()
+	for _, item := range r.Items {
+		if item.Weighed {
+			fmt.Printf("KISIM %-3d %.3f kg x %10s  %%%-2d %12s\n",
+				item.KisimID, float64(item.Quantity)/1000, formatKurus(item.UnitPrice), item.TaxRate, formatKurus(item.TotalPrice))
+		} else {
+			fmt.Printf("KISIM %-3d %3d x %10s  %%%-2d %12s\n",
+				item.KisimID, item.Quantity, formatKurus(item.UnitPrice), item.TaxRate, formatKurus(item.TotalPrice))
+		}
+		if item.Note != "" {
+			fmt.Printf("          %s\n", item.Note)
+		}
+	}
+	for _, surcharge := range r.Surcharges {
+		fmt.Printf("%-26s  %%%-2d %12s\n", surcharge.Name, surcharge.TaxRate, formatKurus(surcharge.Amount))
+	}
+	fmt.Println()
+	if r.Tax.Taxable10 > 0 || r.Tax.Tax10 > 0 {
+		fmt.Printf("KDV %%10 on %s: %s\n", formatKurus(r.Tax.Taxable10), formatKurus(r.Tax.Tax10))
+	}
+	if r.Tax.Taxable20 > 0 || r.Tax.Tax20 > 0 {
+		fmt.Printf("KDV %%20 on %s: %s\n", formatKurus(r.Tax.Taxable20), formatKurus(r.Tax.Tax20))
+	}
+	fmt.Printf("Total tax:   %s\n", formatKurus(r.Tax.TotalTax))
+	fmt.Printf("TOTAL:       %s (%s)\n", formatKurus(r.Total), r.PaymentMethod)
+	if r.Currency != "" {
+		fmt.Printf("Paid in %s at %.6f\n", r.Currency, r.ExchangeRate)
+	}
+	fmt.Printf("\nID: %s\nCollected: %s, authority signature verified: %v\n",
+		entry.ID, entry.CollectedAt.Local().Format("2006-01-02 15:04"), entry.Verified)
+	return nil
+}
+
+func statsCommand(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	month := flags.String("month", "", "Only receipts from this month (YYYY-MM, default all)")
+	flags.Parse(args)
+	if *month != "" {
+		if _, err := time.Parse("2006-01", *month); err != nil {
+			return fmt.Errorf("-month must be YYYY-MM")
+		}
+	}
+
+	l, err := openLedger()
+	if err != nil {
+		return err
+	}
+
+	stats := ledger.Aggregate(ledger.InMonth(l.Entries(), *month))
+	period := *month
+	if period == "" {
+		period = "all time"
+	}
+	fmt.Printf("Spending (%s): %s in %d receipts, %s tax\n\n", period, formatKurus(stats.Total), stats.Receipts, formatKurus(stats.TotalTax))
+	if stats.Receipts == 0 {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STORE\tVKN\tRECEIPTS\tTOTAL")
+	for _, s := range stats.ByStore {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", s.Name, s.VKN, s.Receipts, formatKurus(s.Total))
+	}
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KISIM\tITEMS\tTOTAL")
+	for _, k := range stats.ByKisim {
+		fmt.Fprintf(w, "%d\t%d\t%s\n", k.KisimID, k.Items, formatKurus(k.Total))
+	}
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KDV RATE\tTAXABLE\tTAX")
+	for _, t := range stats.ByTax {
+		fmt.Fprintf(w, "%%%d\t%s\t%s\n", t.Rate, formatKurus(t.Taxable), formatKurus(t.Tax))
+	}
+	return w.Flush()
+}
+
+// addToLedger verifies the authority signature over the receipt, and the register's device
+// signature when it carries one, and saves it in the ledger
+func addToLedger(l *ledger.Ledger, signedReceipt []byte, authorityKey *ecdsa.PublicKey) error {
+	signed, err := receiptformat.ParseSigned(signedReceipt)
+	if err != nil {
+		return fmt.Errorf("failed to parse receipt: %w", err)
+	}
+	hash := sha256.Sum256(signed.Bytes)
+	if !rwcrypto.Verify(authorityKey, hash[:], signed.Signature) {
+		return fmt.Errorf("revenue authority signature does not verify; receipt not saved")
+	}
+	if signed.DeviceSignature != nil {
+		deviceKey, err := rwcrypto.DecompressKey(signed.Receipt.DeviceKey)
+		if err != nil || !rwcrypto.Verify(deviceKey, hash[:], signed.DeviceSignature) {
+			return fmt.Errorf("register device signature does not verify; receipt not saved")
+		}
+	}
+
+	entry, err := l.Add(signedReceipt, true)
+	if errors.Is(err, ledger.ErrDuplicate) {
+		fmt.Printf("Receipt %s is already in the ledger\n", entry.Receipt.Serial)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := l.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Saved receipt %s from %s: %s (ID %s)\n",
+		entry.Receipt.Serial, entry.Receipt.StoreName, formatKurus(entry.Receipt.Total), entry.ID[:12])
+	return nil
+}
+
+// pollBank waits for the receipt submitted under ephemeralKey and returns the encrypted envelope.
+// Each attempt proves possession of the ephemeral key when the bank offers challenges.
+func pollBank(bankURL string, privateKey *ecdsa.PrivateKey, ephemeralKey string, timeout time.Duration) ([]byte, error) {
+	client := receiptbank.NewClient(bankURL, &http.Client{Timeout: 10 * time.Second})
+	deadline := time.Now().Add(timeout)
+
+	for {
+		collected, err := client.Collect(context.Background(), ephemeralKey, privateKey)
+		if err == nil {
+			return collected.EncryptedData, nil
+		}
+		// Not submitted yet, or the bank is unreachable or busy: try again
+		if !errors.Is(err, receiptbank.ErrNotFound) && !receiptbank.Temporary(err) {
+			return nil, err
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("no receipt arrived within %s", timeout)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func openLedger() (*ledger.Ledger, error) {
+	path := os.Getenv("WALLET_LEDGER")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("set WALLET_LEDGER: %v", err)
+		}
+		path = filepath.Join(home, ".receipt-wallet", "ledger.enc")
+	}
+
+	passphrase := os.Getenv("WALLET_PASSPHRASE")
+	if passphrase == "" {
+		return nil, fmt.Errorf("set WALLET_PASSPHRASE to unlock the ledger")
+	}
+	return ledger.Open(path, passphrase)
+}
+
+func formatKurus(kurus int64) string {
+	return fmt.Sprintf("₺%d.%02d", kurus/100, kurus%100)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	rwcrypto "receiptwallet/crypto"
+)
+
+// errNoPush means the bank does not offer WebSocket collection, so the caller should poll
+var errNoPush = errors.New("receipt bank does not offer push collection")
+
+// socketMessage is one JSON frame on the bank's /ws/collect/{key} socket
+type socketMessage struct {
+	Type          string `json:"type"`
+	Nonce         string `json:"nonce,omitempty"`
+	Signature     string `json:"signature,omitempty"`
+	ReceiptID     string `json:"receipt_id,omitempty"`
+	EncryptedData string `json:"encrypted_data,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// waitForPush connects to the bank's collection socket, proves it holds the ephemeral
+// private key, and returns the encrypted envelope the bank pushes once it is submitted
+func waitForPush(bankURL string, privateKey *ecdsa.PrivateKey, ephemeralKey string, timeout time.Duration) ([]byte, error) {
+	socketURL, err := url.Parse(strings.TrimRight(bankURL, "/") + "/v1/ws/collect/" + url.PathEscape(ephemeralKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bank URL: %v", err)
+	}
+	switch socketURL.Scheme {
+	case "https":
+		socketURL.Scheme = "wss"
+	default:
+		socketURL.Scheme = "ws"
+	}
+
+	conn, resp, err := websocket.DefaultDialer.Dial(socketURL.String(), nil)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed) {
+			return nil, errNoPush
+		}
+		return nil, fmt.Errorf("failed to connect to %s: %v", socketURL, err)
+	}
+	defer conn.Close()
+
+	// The bank ends the wait itself; the extra minute covers the handshake and delivery
+	conn.SetReadDeadline(time.Now().Add(timeout + time.Minute))
+
+	for {
+		var message socketMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			return nil, fmt.Errorf("receipt bank connection closed: %v", err)
+		}
+
+		switch message.Type {
+		case "challenge":
+			nonce, err := base64.StdEncoding.DecodeString(message.Nonce)
+			if err != nil {
+				return nil, fmt.Errorf("invalid challenge from receipt bank: %v", err)
+			}
+			signature, err := rwcrypto.SignPossession(privateKey, nonce)
+			if err != nil {
+				return nil, err
+			}
+			if err := conn.WriteJSON(socketMessage{Type: "proof", Signature: base64.StdEncoding.EncodeToString(signature)}); err != nil {
+				return nil, fmt.Errorf("failed to answer challenge: %v", err)
+			}
+		case "waiting":
+			// Proof accepted; the receipt has not been submitted yet
+		case "receipt":
+			envelope, err := base64.StdEncoding.DecodeString(message.EncryptedData)
+			if err != nil {
+				return nil, fmt.Errorf("invalid receipt data from receipt bank: %v", err)
+			}
+			return envelope, nil
+		case "error":
+			return nil, fmt.Errorf("receipt bank: %s", message.Error)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"receiptwallet/receiptformat"
+
+	"wallet/internal/authority"
+	"wallet/internal/verify"
+)
+
+// Exit codes
+const (
+	exitPassed = 0
+	exitFailed = 1 // At least one receipt failed a check
+	exitError  = 2 // Bad usage, or the key or a file could not be read
+)
+
+const usage = `Usage: verify-receipt [flags] <signed-receipt-file>...
+
+Checks signed binary receipts (as decrypted from the bank envelope, raw or base64):
+structure, line totals, receipt total, tax breakdown, the revenue authority
+signature and, when present, the register device signature and the timestamp
+token. With -check-devices, device keys must also be enrolled with the authority.
+Use - to read standard input.
+
+Exits 0 when every check passes, 1 when any fails and 2 on errors.
+
+Flags:
+`
+
+func main() {
+	flags := flag.NewFlagSet("verify-receipt", flag.ExitOnError)
+	authorityURL := flags.String("authority", "http://127.0.0.1:4406", "Revenue authority URL (for its public key)")
+	authorityKey := flags.String("authority-key", "", "Revenue authority public key PEM file, instead of fetching it")
+	authorityRoot := flags.String("authority-root", "", "Trusted root certificate PEM file; fetch /certificate and verify its chain instead of /public-key")
+	checkDevices := flags.Bool("check-devices", false, "Check device keys against the devices the authority enrolled for the store's VKN (GET /devices/{vkn}, signed by the authority key)")
+	quiet := flags.Bool("quiet", false, "Print only failed checks and the result")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(exitError)
+	}
+
+	publicKey, err := authority.LoadKey(*authorityURL, *authorityKey, *authorityRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify-receipt: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	enrolled := make(map[string][][]byte) // key: VKN
+	code := exitPassed
+	for i, path := range flags.Args() {
+		data, err := readReceipt(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "verify-receipt: %v\n", err)
+			os.Exit(exitError)
+		}
+
+		if i > 0 {
+			fmt.Println()
+		}
+		report := verify.Signed(data, publicKey)
+		if *checkDevices && report.Signed != nil && report.Signed.Receipt.DeviceKey != nil {
+			vkn := report.Signed.Receipt.StoreVKN
+			if _, fetched := enrolled[vkn]; !fetched {
+				if enrolled[vkn], err = authority.EnrolledDevices(*authorityURL, vkn, publicKey); err != nil {
+					fmt.Fprintf(os.Stderr, "verify-receipt: %v\n", err)
+					os.Exit(exitError)
+				}
+			}
+			report.CheckEnrollment(enrolled[vkn])
+		}
+		printReport(path, report, *quiet)
+		if !report.Passed() {
+			code = exitFailed
+		}
+	}
+	os.Exit(code)
+}
+
+// readReceipt reads a signed receipt file, decoding it when it holds base64 text
+func readReceipt(path string) ([]byte, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read receipt: %v", err)
+	}
+
+	// Binary receipts start with the magic bytes "TR"; base64 text of one starts with "VFI"
+	if len(data) >= 2 && data[0] == receiptformat.MagicBytes>>8 && data[1] == receiptformat.MagicBytes&0xff {
+		return data, nil
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data))); err == nil {
+		return decoded, nil
+	}
+	return data, nil
+}
+
+func printReport(path string, report *verify.Report, quiet bool) {
+	fmt.Println(path)
+	if signed := report.Signed; signed != nil && !quiet {
+		r := signed.Receipt
+		fmt.Printf("  Store:    %s (VKN %s)\n", r.StoreName, r.StoreVKN)
+		fmt.Printf("  Receipt:  %s, Z%04d, %s, %s\n", r.Serial, r.ZReport, r.TransactionID(), r.Timestamp.Format("2006-01-02 15:04:05"))
+		fmt.Printf("  Total:    ₺%d.%02d (%s)\n", r.Total/100, r.Total%100, r.PaymentMethod)
+		fmt.Println()
+	}
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, check := range report.Checks {
+		status := "PASS"
+		if !check.Passed {
+			status = "FAIL"
+			failed++
+		} else if quiet {
+			continue
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", status, check.Name, check.Detail)
+	}
+	w.Flush()
+
+	if failed == 0 {
+		fmt.Printf("  Result: PASS (%d checks)\n", len(report.Checks))
+	} else {
+		fmt.Printf("  Result: FAIL (%d of %d checks failed)\n", failed, len(report.Checks))
+	}
+}
@@ -0,0 +1,10 @@
+module wallet
+
+go 1.24.0
+
+require (
+	github.com/gorilla/websocket v1.5.3
+	receiptwallet v0.0.0
+)
+
+replace receiptwallet => ../receiptwallet
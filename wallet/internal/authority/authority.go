@@ -0,0 +1,114 @@
+package authority
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	rwauthority "receiptwallet/authority"
+	rwcrypto "receiptwallet/crypto"
+)
+
+// LoadKey reads the authority public key from a PEM file, takes it from the
+// certificate chain at /certificate when a trusted root is given, or fetches it from /public-key
+func LoadKey(authorityURL, keyFile, rootFile string) (*ecdsa.PublicKey, error) {
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read authority key: %v", err)
+		}
+		return rwcrypto.ParsePublicKeyPEM(data)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	if rootFile != "" {
+		return fetchCertifiedKey(client, authorityURL, rootFile)
+	}
+
+	resp, err := client.Get(strings.TrimRight(authorityURL, "/") + "/public-key")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch authority public key: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("revenue authority returned %d for /public-key", resp.StatusCode)
+	}
+
+	var keyResp struct {
+		PublicKey string `json:"public_key"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&keyResp); err != nil {
+		return nil, fmt.Errorf("failed to decode authority public key: %v", err)
+	}
+	der, err := base64.StdEncoding.DecodeString(keyResp.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authority public key encoding: %v", err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse authority public key: %v", err)
+	}
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("authority public key is not ECDSA")
+	}
+	return publicKey, nil
+}
+
+// fetchCertifiedKey fetches the authority's certificate chain and verifies it up to the root in rootFile
+func fetchCertifiedKey(client *http.Client, authorityURL, rootFile string) (*ecdsa.PublicKey, error) {
+	rootData, err := os.ReadFile(rootFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authority root: %v", err)
+	}
+	roots, err := rwcrypto.ParseRootsPEM(rootData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse authority root: %v", err)
+	}
+
+	resp, err := client.Get(strings.TrimRight(authorityURL, "/") + "/certificate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch authority certificate: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("revenue authority returned %d for /certificate", resp.StatusCode)
+	}
+
+	chain, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authority certificate: %v", err)
+	}
+	publicKey, err := rwcrypto.VerifyCertificateChainPEM(chain, roots, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("authority certificate rejected: %v", err)
+	}
+	return publicKey, nil
+}
+
+// EnrolledDevices fetches the compressed device keys the authority enrolled for vkn. The
+// list must be signed by authorityKey, so it is trusted as far as that key is.
+func EnrolledDevices(authorityURL, vkn string, authorityKey *ecdsa.PublicKey) ([][]byte, error) {
+	client := rwauthority.NewClient(authorityURL, nil)
+	client.SetResponseKey(authorityKey)
+	list, err := client.Devices(context.Background(), vkn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch enrolled devices: %w", err)
+	}
+
+	keys := make([][]byte, len(list.Devices))
+	for i, device := range list.Devices {
+		if keys[i], err = base64.StdEncoding.DecodeString(device.PublicKey); err != nil {
+			return nil, fmt.Errorf("invalid enrolled device key encoding: %v", err)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,215 @@
+package ledger
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"receiptwallet/receiptformat"
+)
+
+// Ledger file layout: magic(4) || salt(16) || nonce(12) || AES-256-GCM(JSON entries)
+const (
+	fileMagic        = "RWL1"
+	saltSize         = 16
+	nonceSize        = 12
+	pbkdf2Iterations = 600_000
+)
+
+var (
+	// ErrWrongPassphrase is returned when the ledger does not decrypt with the passphrase
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted ledger")
+	// ErrDuplicate is returned when the receipt is already in the ledger
+	ErrDuplicate = errors.New("receipt already in ledger")
+	// ErrNotFound is returned when no entry matches a reference
+	ErrNotFound = errors.New("no receipt matches")
+	// ErrAmbiguous is returned when a reference matches several entries
+	ErrAmbiguous = errors.New("reference matches several receipts")
+)
+
+// Entry is a collected receipt. Only the signed bytes are stored; Receipt is decoded on load.
+type Entry struct {
+	ID          string                 `json:"id"` // Hex SHA-256 of the signed receipt bytes
+	CollectedAt time.Time              `json:"collected_at"`
+	Verified    bool                   `json:"verified"` // Authority signature checked on collection
+	Signed      []byte                 `json:"signed"`
+	Receipt     *receiptformat.Receipt `json:"-"`
+}
+
+// Ledger is the wallet's encrypted store of collected receipts
+type Ledger struct {
+	path    string
+	key     []byte
+	salt    []byte
+	entries []*Entry
+}
+
+// Open decrypts the ledger at path with passphrase, or starts an empty one if the file does not exist
+func Open(path, passphrase string) (*Ledger, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("a passphrase is required")
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, fmt.Errorf("failed to generate salt: %v", err)
+		}
+		key, err := deriveKey(passphrase, salt)
+		if err != nil {
+			return nil, err
+		}
+		return &Ledger{path: path, key: key, salt: salt}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ledger: %v", err)
+	}
+
+	if len(data) < len(fileMagic)+saltSize+nonceSize || string(data[:len(fileMagic)]) != fileMagic {
+		return nil, fmt.Errorf("%s is not a wallet ledger", path)
+	}
+	salt := data[len(fileMagic) : len(fileMagic)+saltSize]
+	nonce := data[len(fileMagic)+saltSize : len(fileMagic)+saltSize+nonceSize]
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, data[len(fileMagic)+saltSize+nonceSize:], []byte(fileMagic))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	l := &Ledger{path: path, key: key, salt: append([]byte(nil), salt...)}
+	if err := json.Unmarshal(plaintext, &l.entries); err != nil {
+		return nil, fmt.Errorf("failed to decode ledger: %v", err)
+	}
+	for _, entry := range l.entries {
+		signed, err := receiptformat.ParseSigned(entry.Signed)
+		if err != nil {
+			return nil, fmt.Errorf("ledger entry %s: %w", entry.ID[:12], err)
+		}
+		entry.Receipt = signed.Receipt
+	}
+	return l, nil
+}
+
+// Add records a signed receipt; verified says whether its authority signature was checked
+func (l *Ledger) Add(signedReceipt []byte, verified bool) (*Entry, error) {
+	signed, err := receiptformat.ParseSigned(signedReceipt)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(signedReceipt)
+	id := hex.EncodeToString(sum[:])
+	for _, entry := range l.entries {
+		if entry.ID == id {
+			return entry, ErrDuplicate
+		}
+	}
+
+	entry := &Entry{
+		ID:          id,
+		CollectedAt: time.Now().UTC(),
+		Verified:    verified,
+		Signed:      append([]byte(nil), signedReceipt...),
+		Receipt:     signed.Receipt,
+	}
+	l.entries = append(l.entries, entry)
+	return entry, nil
+}
+
+// Entries returns the receipts ordered by receipt time, oldest first
+func (l *Ledger) Entries() []*Entry {
+	entries := append([]*Entry(nil), l.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Receipt.Timestamp.Before(entries[j].Receipt.Timestamp)
+	})
+	return entries
+}
+
+// Find returns the entry whose ID starts with ref, or whose receipt serial equals ref
+func (l *Ledger) Find(ref string) (*Entry, error) {
+	var matches []*Entry
+	for _, entry := range l.entries {
+		if strings.HasPrefix(entry.ID, strings.ToLower(ref)) || entry.Receipt.Serial == strings.ToUpper(ref) {
+			matches = append(matches, entry)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w %q", ErrNotFound, ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("%w: %q (use the receipt ID)", ErrAmbiguous, ref)
+	}
+}
+
+// Save encrypts the ledger and replaces the file atomically
+func (l *Ledger) Save() error {
+	plaintext, err := json.Marshal(l.entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode ledger: %v", err)
+	}
+
+	aead, err := newAEAD(l.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	data := make([]byte, 0, len(fileMagic)+saltSize+nonceSize+len(plaintext)+aead.Overhead())
+	data = append(data, fileMagic...)
+	data = append(data, l.salt...)
+	data = append(data, nonce...)
+	data = aead.Seal(data, nonce, plaintext, []byte(fileMagic))
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return fmt.Errorf("failed to create ledger directory: %v", err)
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write ledger: %v", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("failed to replace ledger: %v", err)
+	}
+	return nil
+}
+
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive ledger key: %v", err)
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
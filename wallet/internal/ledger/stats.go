@@ -0,0 +1,139 @@
+package ledger
+
+import (
+	"sort"
+	"time"
+)
+
+// Stats aggregates spending over a set of receipts. Amounts are in kuruş.
+type Stats struct {
+	Receipts int
+	Total    int64
+	TotalTax int64
+	ByStore  []StoreTotal
+	ByKisim  []KisimTotal
+	ByTax    []TaxTotal
+}
+
+// StoreTotal is the spending at one store (VKN)
+type StoreTotal struct {
+	VKN      string
+	Name     string
+	Receipts int
+	Total    int64
+}
+
+// KisimTotal is the spending in one KISIM (department/category)
+type KisimTotal struct {
+	KisimID int
+	Items   int // Quantity summed over lines; a weighed line counts once
+	Total   int64
+}
+
+// TaxTotal is the taxable amount and tax paid at one rate
+type TaxTotal struct {
+	Rate    int
+	Taxable int64
+	Tax     int64
+}
+
+// InMonth keeps the entries whose receipt time falls in month ("2006-01", local time).
+// An empty month keeps every entry.
+func InMonth(entries []*Entry, month string) []*Entry {
+	if month == "" {
+		return entries
+	}
+	var result []*Entry
+	for _, entry := range entries {
+		if entry.Receipt.Timestamp.In(time.Local).Format("2006-01") == month {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// Aggregate sums entries by store, KISIM and tax rate, largest spending first.
+// Refunds count as receipts and take their amounts off the spending.
+func Aggregate(entries []*Entry) Stats {
+	var stats Stats
+	stores := make(map[string]*StoreTotal)
+	kisims := make(map[int]*KisimTotal)
+	taxes := make(map[int]*TaxTotal)
+
+	addTax := func(rate int, taxable, tax int64) {
+		if taxable == 0 && tax == 0 {
+			return
+		}
+		t, ok := taxes[rate]
+		if !ok {
+			t = &TaxTotal{Rate: rate}
+			taxes[rate] = t
+		}
+		t.Taxable += taxable
+		t.Tax += tax
+	}
+
+	for _, entry := range entries {
+		r := entry.Receipt
+		sign := int64(1)
+		if r.Refund() {
+			sign = -1
+		}
+		stats.Receipts++
+		stats.Total += sign * r.Total
+		stats.TotalTax += sign * r.Tax.TotalTax
+
+		store, ok := stores[r.StoreVKN]
+		if !ok {
+			store = &StoreTotal{VKN: r.StoreVKN}
+			stores[r.StoreVKN] = store
+		}
+		store.Name = r.StoreName // Latest name wins if the store renamed
+		store.Receipts++
+		store.Total += sign * r.Total
+
+		for _, item := range r.Items {
+			kisim, ok := kisims[item.KisimID]
+			if !ok {
+				kisim = &KisimTotal{KisimID: item.KisimID}
+				kisims[item.KisimID] = kisim
+			}
+			if item.Weighed {
+				kisim.Items += int(sign)
+			} else {
+				kisim.Items += int(sign) * item.Quantity
+			}
+			kisim.Total += sign * item.TotalPrice
+		}
+
+		addTax(10, sign*r.Tax.Taxable10, sign*r.Tax.Tax10)
+		addTax(20, sign*r.Tax.Taxable20, sign*r.Tax.Tax20)
+	}
+
+	for _, store := range stores {
+		stats.ByStore = append(stats.ByStore, *store)
+	}
+	sort.Slice(stats.ByStore, func(i, j int) bool {
+		if stats.ByStore[i].Total != stats.ByStore[j].Total {
+			return stats.ByStore[i].Total > stats.ByStore[j].Total
+		}
+		return stats.ByStore[i].VKN < stats.ByStore[j].VKN
+	})
+
+	for _, kisim := range kisims {
+		stats.ByKisim = append(stats.ByKisim, *kisim)
+	}
+	sort.Slice(stats.ByKisim, func(i, j int) bool {
+		if stats.ByKisim[i].Total != stats.ByKisim[j].Total {
+			return stats.ByKisim[i].Total > stats.ByKisim[j].Total
+		}
+		return stats.ByKisim[i].KisimID < stats.ByKisim[j].KisimID
+	})
+
+	for _, tax := range taxes {
+		stats.ByTax = append(stats.ByTax, *tax)
+	}
+	sort.Slice(stats.ByTax, func(i, j int) bool { return stats.ByTax[i].Rate < stats.ByTax[j].Rate })
+
+	return stats
+}
@@ -0,0 +1,282 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+
+	rwcrypto "receiptwallet/crypto"
+	"receiptwallet/receiptformat"
+)
+
+// Timestamp token layout: version(1) || uint64 unix seconds || ECDSA r || s
+const timestampTokenVersion = 0x01
+
+// Check is the outcome of one verification step
+type Check struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+// Report lists every check made on a signed receipt
+type Report struct {
+	Signed *receiptformat.Signed // nil when the receipt could not be parsed
+	Checks []Check
+}
+
+// Passed reports whether every check passed
+func (r *Report) Passed() bool {
+	for _, check := range r.Checks {
+		if !check.Passed {
+			return false
+		}
+	}
+	return len(r.Checks) > 0
+}
+
+func (r *Report) add(name string, passed bool, format string, args ...any) {
+	r.Checks = append(r.Checks, Check{Name: name, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+}
+
+// Signed checks a signed receipt (binary receipt || signature [|| device signature]
+// [|| timestamp token]): its structure, the line, total and tax arithmetic, the authority
+// signature and timestamp token against authorityKey, and a device signature against the
+// device key the receipt carries.
+//
+// Tax amounts are derived from tax-inclusive line totals, so the register rounds them;
+// they may be off by up to one kuruş per line at that rate.
+func Signed(data []byte, authorityKey *ecdsa.PublicKey) *Report {
+	report := &Report{}
+
+	signed, err := receiptformat.ParseSigned(data)
+	if err != nil {
+		report.add("structure", false, "%v", err)
+		return report
+	}
+	report.Signed = signed
+	r := signed.Receipt
+	report.add("structure", true, "v%d, flags 0x%02x, %d items, %d bytes signed", r.Version, r.Flags, len(r.Items), len(signed.Bytes))
+
+	checkItems(report, r)
+	checkTotal(report, r)
+	checkTax(report, r)
+
+	hash := sha256.Sum256(signed.Bytes)
+	if rwcrypto.Verify(authorityKey, hash[:], signed.Signature) {
+		report.add("signature", true, "ECDSA P-256 over SHA-256 %x", hash[:8])
+	} else {
+		report.add("signature", false, "does not verify with the authority key")
+	}
+
+	if signed.DeviceSignature != nil {
+		checkDeviceSignature(report, signed, hash[:])
+	}
+
+	if signed.TimestampToken != nil {
+		checkTimestampToken(report, signed.TimestampToken, hash[:], r.Timestamp, authorityKey)
+	}
+	return report
+}
+
+// checkDeviceSignature verifies the register device's signature over the receipt hash with
+// the device key in the receipt. The authority signature covers that key, so a device
+// signature that verifies ties the receipt to the register the authority signed it for.
+func checkDeviceSignature(report *Report, signed *receiptformat.Signed, hash []byte) {
+	deviceKey, err := rwcrypto.DecompressKey(signed.Receipt.DeviceKey)
+	if err != nil {
+		report.add("device signature", false, "invalid device key: %v", err)
+		return
+	}
+	if rwcrypto.Verify(deviceKey, hash, signed.DeviceSignature) {
+		report.add("device signature", true, "ECDSA P-256 by device key %x", signed.Receipt.DeviceKey[:8])
+	} else {
+		report.add("device signature", false, "does not verify with device key %x", signed.Receipt.DeviceKey[:8])
+	}
+}
+
+// CheckEnrollment adds a check that the receipt's device key is one the authority enrolled
+// for the store's VKN. A device signature alone only shows that the receipt names the key
+// that signed it; enrollment shows the key belongs to a register of that taxpayer.
+// Receipts without a device key are left as they are.
+func (r *Report) CheckEnrollment(enrolled [][]byte) {
+	if r.Signed == nil || r.Signed.Receipt.DeviceKey == nil {
+		return
+	}
+	deviceKey := r.Signed.Receipt.DeviceKey
+	for _, key := range enrolled {
+		if bytes.Equal(key, deviceKey) {
+			r.add("device enrolled", true, "device key %x enrolled for VKN %s", deviceKey[:8], r.Signed.Receipt.StoreVKN)
+			return
+		}
+	}
+	r.add("device enrolled", false, "device key %x is not among the %d enrolled for VKN %s", deviceKey[:8], len(enrolled), r.Signed.Receipt.StoreVKN)
+}
+
+// checkItems recomputes every line total from its quantity and unit price
+func checkItems(report *Report, r *receiptformat.Receipt) {
+	wrong := 0
+	for i, item := range r.Items {
+		product, ok := mulKurus(item.UnitPrice, item.Quantity)
+		if ok && item.Weighed {
+			_, ok = addKurus(product, 500)
+		}
+		if !ok {
+			report.add(fmt.Sprintf("item %d", i+1), false, "KISIM %d quantity × unit price overflows", item.KisimID)
+			wrong++
+			continue
+		}
+		expected := product
+		matches := item.TotalPrice == expected
+		if item.Weighed {
+			// Price per kilogram times grams, rounded to the kuruş; an exact half
+			// may round either way in the register's floating point arithmetic
+			expected = (product + 500) / 1000
+			half := product%1000 == 500
+			matches = item.TotalPrice == expected || half && item.TotalPrice == expected-1
+		}
+		if !matches {
+			report.add(fmt.Sprintf("item %d", i+1), false, "KISIM %d total %s, expected %s",
+				item.KisimID, formatKurus(item.TotalPrice), formatKurus(expected))
+			wrong++
+		}
+	}
+	if wrong == 0 {
+		report.add("items", true, "%d line totals match quantity × unit price", len(r.Items))
+	}
+}
+
+// checkTotal compares the receipt total with the sum of its lines, surcharges included
+func checkTotal(report *Report, r *receiptformat.Receipt) {
+	var sum int64
+	ok := true
+	for _, item := range r.Items {
+		if sum, ok = addKurus(sum, item.TotalPrice); !ok {
+			break
+		}
+	}
+	for _, surcharge := range r.Surcharges {
+		if !ok {
+			break
+		}
+		sum, ok = addKurus(sum, surcharge.Amount)
+	}
+	if !ok {
+		report.add("total", false, "%s, lines sum beyond what an amount can hold", formatKurus(r.Total))
+		return
+	}
+	if r.Total == sum {
+		report.add("total", true, "%s is the sum of the lines", formatKurus(r.Total))
+	} else {
+		report.add("total", false, "%s, lines sum to %s", formatKurus(r.Total), formatKurus(sum))
+	}
+}
+
+// checkTax recomputes the taxable base and tax per rate from the tax-inclusive line totals
+func checkTax(report *Report, r *receiptformat.Receipt) {
+	lines := map[int]int64{}
+	gross := map[int]int64{}
+	for _, item := range r.Items {
+		lines[item.TaxRate]++
+		gross[item.TaxRate] += item.TotalPrice
+	}
+	for _, surcharge := range r.Surcharges {
+		lines[surcharge.TaxRate]++
+		gross[surcharge.TaxRate] += surcharge.Amount
+	}
+	rates := make([]int, 0, len(gross))
+	for rate := range gross {
+		rates = append(rates, rate)
+	}
+	sort.Ints(rates)
+	for _, rate := range rates {
+		if rate != 10 && rate != 20 {
+			report.add(fmt.Sprintf("tax %d%%", rate), true, "%d lines, not part of the tax breakdown (it only carries 10%% and 20%%)", lines[rate])
+		}
+	}
+
+	for _, rate := range []struct {
+		percent        int
+		taxable, taxed int64
+	}{
+		{10, r.Tax.Taxable10, r.Tax.Tax10},
+		{20, r.Tax.Taxable20, r.Tax.Tax20},
+	} {
+		base := float64(gross[rate.percent]) / (1 + float64(rate.percent)/100)
+		expectedBase := int64(base + 0.5)
+		expectedTax := int64(base*float64(rate.percent)/100 + 0.5)
+		tolerance := max(lines[rate.percent], 1)
+
+		name := fmt.Sprintf("tax %d%%", rate.percent)
+		if abs(rate.taxable-expectedBase) > tolerance || abs(rate.taxed-expectedTax) > tolerance {
+			report.add(name, false, "base %s and tax %s, expected %s and %s",
+				formatKurus(rate.taxable), formatKurus(rate.taxed), formatKurus(expectedBase), formatKurus(expectedTax))
+		} else {
+			report.add(name, true, "base %s, tax %s", formatKurus(rate.taxable), formatKurus(rate.taxed))
+		}
+	}
+
+	if sum := r.Tax.Tax10 + r.Tax.Tax20; abs(r.Tax.TotalTax-sum) > 1 {
+		report.add("total tax", false, "%s, rates sum to %s", formatKurus(r.Tax.TotalTax), formatKurus(sum))
+	} else {
+		report.add("total tax", true, "%s", formatKurus(r.Tax.TotalTax))
+	}
+}
+
+// checkTimestampToken verifies the authority's signature over the receipt hash and signing time
+func checkTimestampToken(report *Report, token, hash []byte, issued time.Time, authorityKey *ecdsa.PublicKey) {
+	if token[0] != timestampTokenVersion {
+		report.add("timestamp token", false, "unknown token version %d", token[0])
+		return
+	}
+
+	signedAt := token[1:9]
+	digest := sha256.Sum256(append(append([]byte{}, hash...), signedAt...))
+	if !rwcrypto.Verify(authorityKey, digest[:], token[9:]) {
+		report.add("timestamp token", false, "does not verify with the authority key")
+		return
+	}
+
+	at := time.Unix(int64(binary.BigEndian.Uint64(signedAt)), 0)
+	report.add("timestamp token", true, "signed at %s, %v after the receipt time",
+		at.Format(time.RFC3339), at.Sub(issued))
+}
+
+// mulKurus multiplies a non-negative amount by a quantity, reporting false when the
+// product does not fit an int64
+func mulKurus(amount int64, quantity int) (int64, bool) {
+	if amount < 0 || quantity < 0 {
+		return 0, false
+	}
+	hi, lo := bits.Mul64(uint64(amount), uint64(quantity))
+	if hi != 0 || lo > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(lo), true
+}
+
+// addKurus adds two non-negative amounts, reporting false when the sum does not fit
+// an int64
+func addKurus(a, b int64) (int64, bool) {
+	if a < 0 || b < 0 || a > math.MaxInt64-b {
+		return 0, false
+	}
+	return a + b, true
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func formatKurus(kurus int64) string {
+	return fmt.Sprintf("₺%d.%02d", kurus/100, kurus%100)
+}
@@ -0,0 +1,369 @@
+package tests
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"receiptwallet/receiptformat"
+
+	"wallet/internal/ledger"
+)
+
+type testItem struct {
+	kisim, quantity, unitPrice, taxRate int
+}
+
+// buildSignedReceipt encodes a binary receipt v1 followed by a dummy 64-byte signature
+func buildSignedReceipt(t *testing.T, ts time.Time, vkn uint32, store string, serial uint32, items []testItem) []byte {
+	t.Helper()
+	return buildSignedReceiptVersion(t, receiptformat.FormatVersion1, ts, vkn, store, serial, items)
+}
+
+// buildSignedReceiptVersion encodes a binary receipt of the given version followed by a dummy signature
+func buildSignedReceiptVersion(t *testing.T, version uint8, ts time.Time, vkn uint32, store string, serial uint32, items []testItem) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	write := func(v any) {
+		if err := binary.Write(buf, binary.BigEndian, v); err != nil {
+			t.Fatalf("Failed to encode receipt: %v", err)
+		}
+	}
+	writeString := func(s string) {
+		write(uint32(len(s)))
+		buf.WriteString(s)
+	}
+	// v2 widens quantities to uint32 and amounts to uint64
+	writeQuantity := func(q int) {
+		if version == receiptformat.FormatVersion2 {
+			write(uint32(q))
+		} else {
+			write(uint16(q))
+		}
+	}
+	writeAmount := func(kurus uint64) {
+		if version == receiptformat.FormatVersion2 {
+			write(kurus)
+		} else {
+			write(uint32(kurus))
+		}
+	}
+
+	var total, taxable10, tax10, taxable20, tax20 uint64
+	for _, item := range items {
+		line := uint64(item.quantity) * uint64(item.unitPrice)
+		total += line
+		tax := line * uint64(item.taxRate) / uint64(100+item.taxRate)
+		if item.taxRate == 10 {
+			taxable10, tax10 = taxable10+line-tax, tax10+tax
+		} else {
+			taxable20, tax20 = taxable20+line-tax, tax20+tax
+		}
+	}
+
+	write(uint16(receiptformat.MagicBytes))
+	write(version)
+	write(uint8(0))
+	write(uint64(ts.Unix()))
+	write(uint32(1))      // Z-report
+	write(uint32(serial)) // Transaction
+	write(vkn)
+	writeString(store)
+	writeString("Test Sokak 1, İstanbul")
+	writeAmount(total)
+	writeString("Nakit")
+	write(serial)
+	write(uint16(len(items)))
+	for _, item := range items {
+		write(uint16(item.kisim))
+		writeQuantity(item.quantity)
+		writeAmount(uint64(item.unitPrice))
+		writeAmount(uint64(item.quantity) * uint64(item.unitPrice))
+		write(uint8(item.taxRate))
+	}
+	for _, amount := range []uint64{taxable10, tax10, taxable20, tax20, tax10 + tax20} {
+		writeAmount(amount)
+	}
+	buf.Write(make([]byte, receiptformat.SignatureSize))
+
+	return buf.Bytes()
+}
+
+func TestParseSignedReceipt(t *testing.T) {
+	ts := time.Date(2026, 10, 16, 12, 30, 0, 0, time.Local)
+	data := buildSignedReceipt(t, ts, 1234567890, "Test Market", 7, []testItem{{1, 2, 550, 10}, {3, 1, 1200, 20}})
+
+	signed, err := receiptformat.ParseSigned(data)
+	if err != nil {
+		t.Fatalf("Failed to parse receipt: %v", err)
+	}
+	r := signed.Receipt
+	if r.Serial != "F0007" || r.StoreVKN != "1234567890" || r.StoreName != "Test Market" {
+		t.Errorf("Unexpected header fields: %+v", r)
+	}
+	if !r.Timestamp.Equal(ts) {
+		t.Errorf("Expected timestamp %s, got %s", ts, r.Timestamp)
+	}
+	if r.Total != 2300 || len(r.Items) != 2 || r.Items[1].TotalPrice != 1200 {
+		t.Errorf("Unexpected amounts: total %d, items %+v", r.Total, r.Items)
+	}
+	if len(signed.Signature) != receiptformat.SignatureSize || len(signed.Bytes) != len(data)-receiptformat.SignatureSize {
+		t.Errorf("Signature not split off the receipt bytes")
+	}
+
+	if _, err := receiptformat.Parse(signed.Bytes[:len(signed.Bytes)-1]); !errors.Is(err, receiptformat.ErrMalformed) {
+		t.Errorf("Expected ErrMalformed for a truncated receipt, got %v", err)
+	}
+	corrupted := append([]byte{}, data...)
+	corrupted[2] = 0x03
+	if _, err := receiptformat.ParseSigned(corrupted); !errors.Is(err, receiptformat.ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported for version 3, got %v", err)
+	}
+}
+
+func TestParseSignedReceiptV2(t *testing.T) {
+	items := []testItem{{1, 10_000_000, 125, 10}, {2, 1, 5_000_000_000, 20}}
+	data := buildSignedReceiptVersion(t, receiptformat.FormatVersion2, time.Now(), 1234567890, "Toptan Market", 3, items)
+
+	signed, err := receiptformat.ParseSigned(data)
+	if err != nil {
+		t.Fatalf("Failed to parse v2 receipt: %v", err)
+	}
+	r := signed.Receipt
+	if r.Version != receiptformat.FormatVersion2 || r.Items[0].Quantity != 10_000_000 || r.Items[1].TotalPrice != 5_000_000_000 {
+		t.Errorf("Unexpected v2 fields: version %d, items %+v", r.Version, r.Items)
+	}
+	if r.Total != 1_250_000_000+5_000_000_000 {
+		t.Errorf("Expected total 6250000000, got %d", r.Total)
+	}
+}
+
+func TestParseCompressedReceipt(t *testing.T) {
+	items := make([]testItem, 200)
+	for i := range items {
+		items[i] = testItem{1 + i%5, 1, 995, 10}
+	}
+	plain := buildSignedReceipt(t, time.Now(), 1234567890, "Test Market", 9, items)
+	body := plain[receiptformat.HeaderSize : len(plain)-receiptformat.SignatureSize]
+
+	// Header with FlagCompressed, zlib stream of the body, then the signature
+	compressed := bytes.NewBuffer(append([]byte{}, plain[:receiptformat.HeaderSize]...))
+	compressed.Bytes()[3] |= receiptformat.FlagCompressed
+	zw := zlib.NewWriter(compressed)
+	zw.Write(body)
+	zw.Close()
+	compressed.Write(make([]byte, receiptformat.SignatureSize))
+	data := compressed.Bytes()
+	if len(data) >= len(plain) {
+		t.Fatalf("Expected the compressed receipt to be smaller (%d >= %d bytes)", len(data), len(plain))
+	}
+
+	signed, err := receiptformat.ParseSigned(data)
+	if err != nil {
+		t.Fatalf("Failed to parse compressed receipt: %v", err)
+	}
+	if len(signed.Receipt.Items) != 200 || signed.Receipt.Total != 200*995 || signed.Receipt.Flags&receiptformat.FlagCompressed == 0 {
+		t.Errorf("Unexpected compressed receipt: flags 0x%02x, %d items, total %d",
+			signed.Receipt.Flags, len(signed.Receipt.Items), signed.Receipt.Total)
+	}
+
+	// Bytes after the zlib stream are not part of the receipt
+	if _, err := receiptformat.Parse(append(append([]byte{}, signed.Bytes...), 0)); !errors.Is(err, receiptformat.ErrMalformed) {
+		t.Errorf("Expected ErrMalformed for data after the compressed body, got %v", err)
+	}
+}
+
+func TestParseWeighedReceipt(t *testing.T) {
+	// 1.234 kg at 50,00 per kg, with its unit byte inserted before the tax breakdown
+	plain := buildSignedReceiptVersion(t, receiptformat.FormatVersion2, time.Now(), 1234567890, "Manav", 4, []testItem{{4, 1234, 5000, 10}})
+	taxAt := len(plain) - receiptformat.SignatureSize - 5*8
+	data := append(append(append([]byte{}, plain[:taxAt]...), receiptformat.UnitGrams), plain[taxAt:]...)
+	data[3] |= receiptformat.FlagWeighedItems
+
+	signed, err := receiptformat.ParseSigned(data)
+	if err != nil {
+		t.Fatalf("Failed to parse weighed receipt: %v", err)
+	}
+	if item := signed.Receipt.Items[0]; !item.Weighed || item.Quantity != 1234 {
+		t.Errorf("Expected a weighed 1234 g line, got %+v", item)
+	}
+
+	data[taxAt] = 7
+	if _, err := receiptformat.ParseSigned(data); !errors.Is(err, receiptformat.ErrMalformed) {
+		t.Errorf("Expected ErrMalformed for an unknown unit, got %v", err)
+	}
+}
+
+func TestParseItemNotes(t *testing.T) {
+	// A note after the item, before the tax breakdown
+	plain := buildSignedReceiptVersion(t, receiptformat.FormatVersion2, time.Now(), 1234567890, "Kafe", 5, []testItem{{1, 1, 4500, 10}})
+	taxAt := len(plain) - receiptformat.SignatureSize - 5*8
+	note := "şekersiz"
+	data := append(append([]byte{}, plain[:taxAt]...), byte(len(note)))
+	data = append(append(data, note...), plain[taxAt:]...)
+	data[3] |= receiptformat.FlagItemNotes
+
+	signed, err := receiptformat.ParseSigned(data)
+	if err != nil {
+		t.Fatalf("Failed to parse receipt with item notes: %v", err)
+	}
+	if got := signed.Receipt.Items[0].Note; got != note {
+		t.Errorf("Expected note %q, got %q", note, got)
+	}
+
+	data[taxAt] = byte(len(note) + 1)
+	if _, err := receiptformat.ParseSigned(data); !errors.Is(err, receiptformat.ErrMalformed) {
+		t.Errorf("Expected ErrMalformed for a note running into the tax breakdown, got %v", err)
+	}
+}
+
+func TestParseCustomer(t *testing.T) {
+	// The customer extension follows the tax breakdown, in v1 as in v2
+	plain := buildSignedReceipt(t, time.Now(), 1234567890, "Kırtasiye", 6, []testItem{{2, 3, 1500, 20}})
+	end := len(plain) - receiptformat.SignatureSize
+	extension := new(bytes.Buffer)
+	for _, field := range []string{"4840847211", "ACME BİLİŞİM LTD. ŞTİ."} {
+		binary.Write(extension, binary.BigEndian, uint32(len(field)))
+		extension.WriteString(field)
+	}
+	data := append(append(append([]byte{}, plain[:end]...), extension.Bytes()...), plain[end:]...)
+	data[3] |= receiptformat.FlagCustomer
+
+	signed, err := receiptformat.ParseSigned(data)
+	if err != nil {
+		t.Fatalf("Failed to parse receipt with customer: %v", err)
+	}
+	if r := signed.Receipt; r.CustomerTaxNumber != "4840847211" || r.CustomerName != "ACME BİLİŞİM LTD. ŞTİ." {
+		t.Errorf("Unexpected customer %q %q", r.CustomerTaxNumber, r.CustomerName)
+	}
+
+	data[end+4] = 'X'
+	if _, err := receiptformat.ParseSigned(data); !errors.Is(err, receiptformat.ErrMalformed) {
+		t.Errorf("Expected ErrMalformed for a tax number with letters, got %v", err)
+	}
+}
+
+func TestParseRefund(t *testing.T) {
+	// The refund extension comes last and names the sale paid back
+	sold := time.Date(2026, 10, 5, 10, 0, 0, 0, time.Local)
+	plain := buildSignedReceipt(t, sold.Add(24*time.Hour), 1234567890, "Kırtasiye", 7, []testItem{{2, 1, 1500, 20}})
+	end := len(plain) - receiptformat.SignatureSize
+	extension := new(bytes.Buffer)
+	binary.Write(extension, binary.BigEndian, uint64(sold.Unix()))
+	binary.Write(extension, binary.BigEndian, uint32(12))
+	binary.Write(extension, binary.BigEndian, uint32(3))
+	data := append(append(append([]byte{}, plain[:end]...), extension.Bytes()...), plain[end:]...)
+	data[3] |= receiptformat.FlagRefund
+
+	signed, err := receiptformat.ParseSigned(data)
+	if err != nil {
+		t.Fatalf("Failed to parse refund receipt: %v", err)
+	}
+	original := signed.Receipt.RefundOf
+	if !signed.Receipt.Refund() || original.Serial != "F0003" || original.TransactionID() != "TX202610050012" {
+		t.Fatalf("Unexpected refunded sale %+v", original)
+	}
+
+	l, err := ledger.Open(filepath.Join(t.TempDir(), "ledger.enc"), "pass")
+	if err != nil {
+		t.Fatalf("Failed to open ledger: %v", err)
+	}
+	sale := buildSignedReceipt(t, sold, 1234567890, "Kırtasiye", 3, []testItem{{2, 2, 1500, 20}})
+	for _, raw := range [][]byte{sale, data} {
+		if _, err := l.Add(raw, true); err != nil {
+			t.Fatalf("Failed to add receipt: %v", err)
+		}
+	}
+	stats := ledger.Aggregate(l.Entries())
+	if stats.Receipts != 2 || stats.Total != 1500 || stats.ByKisim[0].Items != 1 {
+		t.Errorf("Expected the refund to take 1500 off 3000 spent, got %+v", stats)
+	}
+}
+
+func TestLedgerEncryptedRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.enc")
+	data := buildSignedReceipt(t, time.Now(), 1234567890, "Secret Store", 1, []testItem{{1, 1, 500, 10}})
+
+	l, err := ledger.Open(path, "correct horse")
+	if err != nil {
+		t.Fatalf("Failed to open new ledger: %v", err)
+	}
+	entry, err := l.Add(data, true)
+	if err != nil {
+		t.Fatalf("Failed to add receipt: %v", err)
+	}
+	if _, err := l.Add(data, true); !errors.Is(err, ledger.ErrDuplicate) {
+		t.Errorf("Expected ErrDuplicate, got %v", err)
+	}
+	if err := l.Save(); err != nil {
+		t.Fatalf("Failed to save ledger: %v", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read ledger file: %v", err)
+	}
+	if bytes.Contains(raw, []byte("Secret Store")) {
+		t.Errorf("Ledger file contains the store name in plaintext")
+	}
+
+	if _, err := ledger.Open(path, "wrong"); !errors.Is(err, ledger.ErrWrongPassphrase) {
+		t.Errorf("Expected ErrWrongPassphrase, got %v", err)
+	}
+
+	reopened, err := ledger.Open(path, "correct horse")
+	if err != nil {
+		t.Fatalf("Failed to reopen ledger: %v", err)
+	}
+	found, err := reopened.Find("f0001")
+	if err != nil {
+		t.Fatalf("Failed to find receipt by serial: %v", err)
+	}
+	if found.ID != entry.ID || !found.Verified || found.Receipt.StoreName != "Secret Store" {
+		t.Errorf("Reopened entry differs: %+v", found)
+	}
+	if _, err := reopened.Find(entry.ID[:8]); err != nil {
+		t.Errorf("Failed to find receipt by ID prefix: %v", err)
+	}
+}
+
+func TestLedgerStats(t *testing.T) {
+	l, err := ledger.Open(filepath.Join(t.TempDir(), "ledger.enc"), "pass")
+	if err != nil {
+		t.Fatalf("Failed to open ledger: %v", err)
+	}
+
+	october := time.Date(2026, 10, 5, 10, 0, 0, 0, time.Local)
+	september := time.Date(2026, 9, 30, 10, 0, 0, 0, time.Local)
+	receipts := [][]byte{
+		buildSignedReceipt(t, october, 1111111111, "Market A", 1, []testItem{{1, 2, 550, 10}}),
+		buildSignedReceipt(t, october.Add(time.Hour), 1111111111, "Market A", 2, []testItem{{2, 1, 10000, 20}}),
+		buildSignedReceipt(t, october.Add(48*time.Hour), 2222222222, "Market B", 1, []testItem{{1, 1, 300, 10}, {2, 1, 1200, 20}}),
+		buildSignedReceipt(t, september, 2222222222, "Market B", 9, []testItem{{2, 1, 99900, 20}}),
+	}
+	for _, data := range receipts {
+		if _, err := l.Add(data, true); err != nil {
+			t.Fatalf("Failed to add receipt: %v", err)
+		}
+	}
+
+	stats := ledger.Aggregate(ledger.InMonth(l.Entries(), "2026-10"))
+	if stats.Receipts != 3 || stats.Total != 1100+10000+1500 {
+		t.Fatalf("Expected 3 October receipts totalling 12600, got %d totalling %d", stats.Receipts, stats.Total)
+	}
+	if len(stats.ByStore) != 2 || stats.ByStore[0].Name != "Market A" || stats.ByStore[0].Receipts != 2 {
+		t.Errorf("Unexpected store totals: %+v", stats.ByStore)
+	}
+	if len(stats.ByKisim) != 2 || stats.ByKisim[0].KisimID != 2 || stats.ByKisim[0].Total != 11200 || stats.ByKisim[1].Items != 3 {
+		t.Errorf("Unexpected KISIM totals: %+v", stats.ByKisim)
+	}
+	if len(stats.ByTax) != 2 || stats.ByTax[0].Rate != 10 || stats.ByTax[0].Taxable+stats.ByTax[0].Tax != 1400 {
+		t.Errorf("Unexpected tax totals: %+v", stats.ByTax)
+	}
+}
@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	rwcrypto "receiptwallet/crypto"
+
+	"wallet/internal/verify"
+)
+
+// receiptVectorsFile is the register's reference corpus; this wallet must decode and
+// verify every receipt in it the way the register encoded it
+const receiptVectorsFile = "../../fake_cash_register/tests/testdata/receipt_vectors.json"
+
+type receiptVectors struct {
+	AuthorityPublicKey string `json:"authority_public_key"`
+	WalletPrivateKey   string `json:"wallet_private_key"`
+	Receipts           []struct {
+		Name      string `json:"name"`
+		Version   uint8  `json:"version"`
+		Flags     uint8  `json:"flags"`
+		Binary    string `json:"binary"`
+		Hash      string `json:"hash"`
+		Signature string `json:"signature"`
+		Envelope  string `json:"envelope"`
+		Receipt   struct {
+			Timestamp     time.Time `json:"timestamp"`
+			TransactionID string    `json:"transaction_id"`
+			StoreVKN      string    `json:"store_vkn"`
+			StoreName     string    `json:"store_name"`
+			TotalAmount   float64   `json:"total_amount"`
+			PaymentMethod string    `json:"payment_method"`
+			ReceiptSerial string    `json:"receipt_serial"`
+			Items         []struct {
+				Quantity int     `json:"quantity"`
+				Weighed  bool    `json:"weighed"`
+				Note     string  `json:"note"`
+				Total    float64 `json:"total_price"`
+			} `json:"items"`
+			Currency string `json:"currency"`
+			Customer *struct {
+				TaxNumber string `json:"tax_number"`
+				Name      string `json:"name"`
+			} `json:"customer"`
+		} `json:"receipt"`
+	} `json:"receipts"`
+}
+
+func kurus(lira float64) int64 {
+	return int64(math.Round(lira * 100))
+}
+
+// TestReceiptVectors opens every envelope of the register's corpus with the published
+// wallet key and checks the decoded receipt against its JSON form
+func TestReceiptVectors(t *testing.T) {
+	data, err := os.ReadFile(receiptVectorsFile)
+	if err != nil {
+		t.Fatalf("Failed to read vectors: %v", err)
+	}
+	var vectors receiptVectors
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("Failed to parse vectors: %v", err)
+	}
+
+	scalar, _ := hex.DecodeString(vectors.WalletPrivateKey)
+	walletKey := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(scalar)}
+	walletKey.Curve = elliptic.P256()
+	walletKey.X, walletKey.Y = elliptic.P256().ScalarBaseMult(scalar)
+	authorityPublicKey, _ := hex.DecodeString(vectors.AuthorityPublicKey)
+	authorityKey, err := rwcrypto.DecompressKey(authorityPublicKey)
+	if err != nil {
+		t.Fatalf("Bad authority key: %v", err)
+	}
+
+	for _, v := range vectors.Receipts {
+		t.Run(v.Name, func(t *testing.T) {
+			envelope, _ := hex.DecodeString(v.Envelope)
+			plaintext, err := rwcrypto.Decrypt(envelope, walletKey)
+			if err != nil {
+				t.Fatalf("Decrypt failed: %v", err)
+			}
+
+			report := verify.Signed(plaintext, authorityKey)
+			if !report.Passed() {
+				t.Fatalf("Verification failed: %v", failedChecks(report))
+			}
+			signed := report.Signed
+			if hex.EncodeToString(signed.Bytes) != v.Binary || hex.EncodeToString(signed.Signature) != v.Signature {
+				t.Error("Envelope holds different bytes than the vector")
+			}
+			if hash := sha256.Sum256(signed.Bytes); hex.EncodeToString(hash[:]) != v.Hash {
+				t.Error("Hash mismatch")
+			}
+
+			r, want := signed.Receipt, v.Receipt
+			if r.Version != v.Version || r.Flags != v.Flags {
+				t.Errorf("Got v%d flags 0x%02x, want v%d flags 0x%02x", r.Version, r.Flags, v.Version, v.Flags)
+			}
+			if !r.Timestamp.Equal(want.Timestamp) || r.TransactionID() != want.TransactionID || r.Serial != want.ReceiptSerial {
+				t.Errorf("Got %s %s %s", r.Timestamp.UTC(), r.TransactionID(), r.Serial)
+			}
+			if r.StoreVKN != want.StoreVKN || r.StoreName != want.StoreName || r.PaymentMethod != want.PaymentMethod {
+				t.Errorf("Got store %s %q paid %q", r.StoreVKN, r.StoreName, r.PaymentMethod)
+			}
+			if r.Total != kurus(want.TotalAmount) || len(r.Items) != len(want.Items) {
+				t.Fatalf("Got total %d with %d items, want %d with %d", r.Total, len(r.Items), kurus(want.TotalAmount), len(want.Items))
+			}
+			for i, item := range r.Items {
+				w := want.Items[i]
+				if item.Quantity != w.Quantity || item.Weighed != w.Weighed || item.Note != w.Note || item.TotalPrice != kurus(w.Total) {
+					t.Errorf("Item %d: got %+v", i+1, item)
+				}
+			}
+			if r.Currency != want.Currency {
+				t.Errorf("Got currency %q, want %q", r.Currency, want.Currency)
+			}
+			if want.Customer != nil && (r.CustomerTaxNumber != want.Customer.TaxNumber || r.CustomerName != want.Customer.Name) {
+				t.Errorf("Got customer %s %q", r.CustomerTaxNumber, r.CustomerName)
+			}
+		})
+	}
+}
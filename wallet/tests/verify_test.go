@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	rwcrypto "receiptwallet/crypto"
+	"receiptwallet/receiptformat"
+
+	"wallet/internal/verify"
+)
+
+// signReceipt replaces the dummy signature of a built receipt with a real one
+func signReceipt(t *testing.T, key *ecdsa.PrivateKey, data []byte) []byte {
+	t.Helper()
+	body := data[:len(data)-receiptformat.SignatureSize]
+	hash := sha256.Sum256(body)
+	signature, err := rwcrypto.Sign(key, hash[:])
+	if err != nil {
+		t.Fatalf("Failed to sign receipt: %v", err)
+	}
+	return append(append([]byte{}, body...), signature...)
+}
+
+func failedChecks(report *verify.Report) []string {
+	var failed []string
+	for _, check := range report.Checks {
+		if !check.Passed {
+			failed = append(failed, check.Name+": "+check.Detail)
+		}
+	}
+	return failed
+}
+
+func TestVerifyReceipt(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	items := []testItem{{1, 2, 550, 10}, {3, 1, 1200, 20}, {2, 3, 999, 20}}
+	data := signReceipt(t, key, buildSignedReceipt(t, time.Now(), 1234567890, "Test Market", 7, items))
+
+	report := verify.Signed(data, &key.PublicKey)
+	if !report.Passed() {
+		t.Fatalf("Expected a valid receipt to pass, failed: %v", failedChecks(report))
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if report := verify.Signed(data, &other.PublicKey); report.Passed() {
+		t.Error("Expected the signature check to fail with another authority key")
+	}
+
+	// Raise the receipt total by one kuruş and sign it again, so only the arithmetic is wrong
+	tampered := append([]byte{}, data[:len(data)-receiptformat.SignatureSize]...)
+	totalAt := 4 + 8 + 4 + 4 + 4 + 4 + len("Test Market") + 4 + len("Test Sokak 1, İstanbul")
+	binary.BigEndian.PutUint32(tampered[totalAt:], binary.BigEndian.Uint32(tampered[totalAt:])+1)
+	tampered = signReceipt(t, key, append(tampered, make([]byte, receiptformat.SignatureSize)...))
+
+	report = verify.Signed(tampered, &key.PublicKey)
+	failed := failedChecks(report)
+	if len(failed) != 1 || !strings.HasPrefix(failed[0], "total:") {
+		t.Errorf("Expected only the total check to fail, got %v", failed)
+	}
+
+	if report := verify.Signed(data[:10], &key.PublicKey); report.Passed() || report.Signed != nil {
+		t.Error("Expected a truncated receipt to fail the structure check")
+	}
+}
+
+func TestVerifyDeviceSignedReceipt(t *testing.T) {
+	authorityKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	deviceKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	compressed, _ := rwcrypto.CompressKey(&deviceKey.PublicKey)
+
+	// The receipt declares the device key in a tagged extension
+	data := buildSignedReceipt(t, time.Now(), 1234567890, "Test Market", 7, []testItem{{1, 2, 550, 10}})
+	body := append([]byte{}, data[:len(data)-receiptformat.SignatureSize]...)
+	body[3] |= receiptformat.FlagExtensions
+	body = append(body, receiptformat.ExtensionDeviceKey, 0, 0, 0, byte(len(compressed)))
+	body = append(body, compressed...)
+
+	hash := sha256.Sum256(body)
+	signature, _ := rwcrypto.Sign(authorityKey, hash[:])
+	deviceSignature, _ := rwcrypto.Sign(deviceKey, hash[:])
+	signed := append(append(append([]byte{}, body...), signature...), deviceSignature...)
+
+	report := verify.Signed(signed, &authorityKey.PublicKey)
+	if !report.Passed() {
+		t.Fatalf("Expected a device signed receipt to pass, failed: %v", failedChecks(report))
+	}
+	found := false
+	for _, check := range report.Checks {
+		found = found || check.Name == "device signature"
+	}
+	if !found {
+		t.Error("Expected a device signature check")
+	}
+
+	// Cross-checked against the devices the authority enrolled for the VKN
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherCompressed, _ := rwcrypto.CompressKey(&other.PublicKey)
+	report.CheckEnrollment([][]byte{otherCompressed, compressed})
+	if !report.Passed() {
+		t.Errorf("Expected an enrolled device to pass, failed: %v", failedChecks(report))
+	}
+	unenrolled := verify.Signed(signed, &authorityKey.PublicKey)
+	unenrolled.CheckEnrollment([][]byte{otherCompressed})
+	if failed := failedChecks(unenrolled); len(failed) != 1 || !strings.HasPrefix(failed[0], "device enrolled:") {
+		t.Errorf("Expected only the enrollment check to fail, got %v", failed)
+	}
+
+	// Signed by another device than the receipt names
+	otherSignature, _ := rwcrypto.Sign(other, hash[:])
+	forged := append(append(append([]byte{}, body...), signature...), otherSignature...)
+	failed := failedChecks(verify.Signed(forged, &authorityKey.PublicKey))
+	if len(failed) != 1 || !strings.HasPrefix(failed[0], "device signature:") {
+		t.Errorf("Expected only the device signature check to fail, got %v", failed)
+	}
+}
+
+func TestVerifyOverflowingLine(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	// 4096 × 2^52 kuruş is 2^64, which wraps to a line total of 0 in 64 bits
+	items := []testItem{{1, 1 << 12, 1 << 52, 20}}
+	data := signReceipt(t, key, buildSignedReceiptVersion(t, receiptformat.FormatVersion2, time.Now(), 1234567890, "Test Market", 7, items))
+
+	report := verify.Signed(data, &key.PublicKey)
+	if report.Signed == nil {
+		t.Fatalf("Expected the receipt to parse, failed: %v", failedChecks(report))
+	}
+	failed := failedChecks(report)
+	if len(failed) != 1 || !strings.HasPrefix(failed[0], "item 1:") || !strings.Contains(failed[0], "overflows") {
+		t.Errorf("Expected only the item check to fail with an overflow, got %v", failed)
+	}
+}